@@ -10,11 +10,16 @@ import (
 	"time"
 
 	"mark7888/speedtest-data-server/internal/api"
+	"mark7888/speedtest-data-server/internal/api/middleware"
 	"mark7888/speedtest-data-server/internal/auth"
 	"mark7888/speedtest-data-server/internal/config"
+	"mark7888/speedtest-data-server/internal/control"
 	"mark7888/speedtest-data-server/internal/db"
+	"mark7888/speedtest-data-server/internal/grpcapi"
+	"mark7888/speedtest-data-server/internal/ingest"
 	"mark7888/speedtest-data-server/internal/logger"
 	"mark7888/speedtest-data-server/internal/services"
+	"mark7888/speedtest-data-server/internal/tracing"
 	"mark7888/speedtest-data-server/internal/version"
 
 	"go.uber.org/zap"
@@ -42,6 +47,22 @@ func main() {
 		zap.Int("port", cfg.Server.Port),
 	)
 
+	// Export traces when a collector is configured
+	shutdownTracing, err := tracing.Init(cfg.Tracing)
+	if err != nil {
+		logger.Log.Fatal("Failed to initialize tracing", zap.Error(err))
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			logger.Log.Warn("Failed to flush traces", zap.Error(err))
+		}
+	}()
+	if cfg.Tracing.Endpoint != "" {
+		logger.Log.Info("Tracing enabled", zap.String("endpoint", cfg.Tracing.Endpoint))
+	}
+
 	// Connect to database
 	database, err := db.New(cfg)
 	if err != nil {
@@ -66,9 +87,43 @@ func main() {
 
 	// Initialize JWT manager
 	jwtManager := auth.NewJWTManager(cfg.JWT.Secret, cfg.JWT.Expiry)
+	jwtManager.AcceptPreviousSecrets(cfg.JWT.PreviousSecrets)
+
+	// One ingest service is shared by every transport
+	ingestService := ingest.NewService(database, cfg)
+
+	// Control channel hub tracks nodes connected over WebSocket
+	hub := control.NewHub(database, ingestService, cfg.Node.AliveTimeout)
+	defer hub.Close()
+
+	// The node CA signs client certificates through the admin API
+	var nodeCA *auth.CertificateAuthority
+	if cfg.Server.NodeCACert != "" {
+		nodeCA, err = auth.LoadCertificateAuthority(cfg.Server.NodeCACert, cfg.Server.NodeCAKey)
+		if err != nil {
+			logger.Log.Fatal("Failed to load node CA", zap.Error(err))
+		}
+	}
+
+	// One rate limiter covers every transport, so splitting calls between
+	// them does not raise a node's budget
+	rateLimiter := middleware.NewRateLimiter(cfg.API.RateLimit)
+	rateLimiter.Cleanup()
 
 	// Setup router
-	router := api.SetupRouter(cfg, database, jwtManager)
+	router := api.SetupRouter(cfg, database, jwtManager, ingestService, hub, nodeCA, rateLimiter)
+
+	// Start gRPC ingestion server on its own port
+	if cfg.GRPC.Enabled {
+		grpcServer, err := grpcapi.NewServer(cfg, database, ingestService, rateLimiter)
+		if err != nil {
+			logger.Log.Fatal("Failed to create gRPC server", zap.Error(err))
+		}
+		if err := grpcServer.Start(); err != nil {
+			logger.Log.Fatal("Failed to start gRPC server", zap.Error(err))
+		}
+		defer grpcServer.Stop()
+	}
 
 	// Create HTTP server
 	addr := fmt.Sprintf("%s:%d", cfg.Server.Host, cfg.Server.Port)
@@ -79,9 +134,22 @@ func main() {
 		WriteTimeout: cfg.API.Timeout,
 		IdleTimeout:  2 * cfg.API.Timeout,
 	}
+	if cfg.Server.TLSEnabled {
+		clientCAs, err := auth.LoadCertPool(cfg.Server.TLSClientCA, cfg.Server.NodeCACert)
+		if err != nil {
+			logger.Log.Fatal("Failed to load client CAs", zap.Error(err))
+		}
+		server.TLSConfig, err = auth.ServerTLSConfig(cfg.Server.TLSCert, cfg.Server.TLSKey, clientCAs)
+		if err != nil {
+			logger.Log.Fatal("Failed to load TLS configuration", zap.Error(err))
+		}
+		if clientCAs != nil {
+			logger.Log.Info("Client certificate authentication enabled for nodes")
+		}
+	}
 
 	// Start background services
-	nodeTracker := services.NewNodeTracker(database, cfg)
+	nodeTracker := services.NewNodeTracker(database, hub, cfg)
 	nodeTracker.Start()
 	defer nodeTracker.Stop()
 
@@ -89,6 +157,12 @@ func main() {
 	cleanupService.Start()
 	defer cleanupService.Stop()
 
+	if cfg.MQTT.Enabled {
+		mqttIngest := services.NewMQTTIngest(database, ingestService, cfg)
+		mqttIngest.Start()
+		defer mqttIngest.Stop()
+	}
+
 	// Start server in a goroutine
 	go func() {
 		logger.Log.Info("Server listening", zap.String("addr", addr))
@@ -99,7 +173,8 @@ func main() {
 				zap.String("cert", cfg.Server.TLSCert),
 				zap.String("key", cfg.Server.TLSKey),
 			)
-			err = server.ListenAndServeTLS(cfg.Server.TLSCert, cfg.Server.TLSKey)
+			// The certificate is already loaded into server.TLSConfig
+			err = server.ListenAndServeTLS("", "")
 		} else {
 			err = server.ListenAndServe()
 		}
@@ -4,13 +4,14 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"mark7888/speedtest-data-server/internal/api/validators"
 	"mark7888/speedtest-data-server/internal/auth"
 	"mark7888/speedtest-data-server/internal/config"
+	"mark7888/speedtest-data-server/internal/control"
 	"mark7888/speedtest-data-server/internal/db"
-	"mark7888/speedtest-data-server/internal/logger"
 	"mark7888/speedtest-data-server/pkg/models"
 
 	"github.com/gin-gonic/gin"
@@ -18,23 +19,45 @@ import (
 	"go.uber.org/zap"
 )
 
+// maxMFAAttempts is how many wrong codes a pre-authentication token allows
+// before the password has to be entered again
+const maxMFAAttempts = 5
+
 // AdminHandler handles admin-related endpoints
 type AdminHandler struct {
-	db         db.Database
-	jwtManager *auth.JWTManager
-	config     *config.Config
+	db          db.Database
+	jwtManager  *auth.JWTManager
+	config      *config.Config
+	hub         *control.Hub
+	mfaAttempts *auth.AttemptLimiter
+
+	// adminTOTPStep is the time step of the last TOTP code the admin
+	// account from the configuration logged in with
+	adminTOTPMu   sync.Mutex
+	adminTOTPStep int64
 }
 
 // NewAdminHandler creates a new admin handler
-func NewAdminHandler(database db.Database, jwtManager *auth.JWTManager, cfg *config.Config) *AdminHandler {
+func NewAdminHandler(database db.Database, jwtManager *auth.JWTManager, cfg *config.Config, hub *control.Hub) *AdminHandler {
 	return &AdminHandler{
-		db:         database,
-		jwtManager: jwtManager,
-		config:     cfg,
+		db:          database,
+		jwtManager:  jwtManager,
+		config:      cfg,
+		hub:         hub,
+		mfaAttempts: auth.NewAttemptLimiter(maxMFAAttempts),
 	}
 }
 
-// HandleLogin handles admin login
+// loginAccount is an account someone is logging in to
+type loginAccount struct {
+	username string
+	role     string
+	user     *models.User // nil for the admin account from the configuration
+}
+
+// HandleLogin handles admin login. Accounts with two-factor authentication
+// get a short-lived pre-authentication token instead of a session, which
+// HandleLoginMFA exchanges for one together with a code.
 // POST /api/v1/admin/login
 func (h *AdminHandler) HandleLogin(c *gin.Context) {
 	var req models.LoginRequest
@@ -47,59 +70,258 @@ func (h *AdminHandler) HandleLogin(c *gin.Context) {
 	}
 
 	// Verify credentials
-	if req.Username != h.config.Admin.Username {
+	account, ok := h.authenticate(c, req.Username, req.Password)
+	if !ok {
 		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
 			Error: "Invalid credentials",
 		})
 		return
 	}
 
-	if !auth.VerifyPassword(req.Password, h.config.Admin.Password) {
-		// Hash the password if it's not hashed yet (for first login)
-		if req.Password == h.config.Admin.Password {
-			// Direct match - password not hashed in config
-			// In production, you should hash the password in config
-		} else {
-			c.JSON(http.StatusUnauthorized, models.ErrorResponse{
-				Error: "Invalid credentials",
+	if h.totpRequired(account) {
+		mfaToken, expiresAt, err := h.jwtManager.GenerateMFAToken(account.username)
+		if err != nil {
+			requestLog(c).Error("Failed to generate pre-authentication token", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+				Error: "Failed to generate token",
 			})
 			return
 		}
+
+		requestLog(c).Info("Admin password accepted, awaiting second factor", zap.String("username", account.username))
+
+		c.JSON(http.StatusOK, models.MFAChallengeResponse{
+			MFARequired: true,
+			MFAToken:    mfaToken,
+			ExpiresAt:   expiresAt,
+		})
+		return
 	}
 
-	// Generate JWT token
-	token, expiresAt, err := h.jwtManager.Generate(req.Username)
+	h.completeLogin(c, account, nil)
+}
+
+// HandleLoginMFA completes a login with the pre-authentication token from
+// HandleLogin and a TOTP code or a recovery code
+// POST /api/v1/admin/login/mfa
+func (h *AdminHandler) HandleLoginMFA(c *gin.Context) {
+	var req models.MFALoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "Invalid request body",
+			Details: err.Error(),
+		})
+		return
+	}
+
+	claims, err := h.jwtManager.ValidateMFAToken(req.MFAToken)
 	if err != nil {
-		logger.Log.Error("Failed to generate JWT", zap.Error(err))
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Error: "Invalid or expired login, sign in again",
+		})
+		return
+	}
+
+	now := time.Now()
+	if !h.mfaAttempts.Allow(claims.ID, now) {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Error: "Too many attempts, sign in again",
+		})
+		return
+	}
+
+	account, ok := h.currentAccount(c, claims.Username)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Error: "Account is disabled or no longer exists",
+		})
+		return
+	}
+
+	recoveryCodesRemaining, ok := h.verifySecondFactor(c, account, req.Code, now)
+	if !ok {
+		h.mfaAttempts.Fail(claims.ID, claims.ExpiresAt.Time, now)
+		requestLog(c).Warn("Invalid second factor", zap.String("username", account.username))
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Error: "Invalid code",
+		})
+		return
+	}
+	h.mfaAttempts.Done(claims.ID, claims.ExpiresAt.Time, now)
+
+	h.completeLogin(c, account, recoveryCodesRemaining)
+}
+
+// completeLogin starts a session for an account that passed every check.
+// recoveryCodesRemaining is set when a recovery code was used.
+func (h *AdminHandler) completeLogin(c *gin.Context, account *loginAccount, recoveryCodesRemaining *int) {
+	response, err := startSession(c, h.db, h.jwtManager, h.config, account.username, account.role, "")
+	if err != nil {
+		requestLog(c).Error("Failed to start session", zap.Error(err))
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 			Error: "Failed to generate token",
 		})
 		return
 	}
 
-	logger.Log.Info("Admin login successful", zap.String("username", req.Username))
+	if account.user != nil {
+		if err := h.db.UpdateUserLastLogin(c.Request.Context(), account.user.ID); err != nil {
+			requestLog(c).Warn("Failed to record login", zap.String("username", account.username), zap.Error(err))
+		}
+	}
 
-	c.JSON(http.StatusOK, models.LoginResponse{
-		Token:     token,
-		ExpiresAt: expiresAt,
-		Username:  req.Username,
-	})
+	requestLog(c).Info("Admin login successful",
+		zap.String("username", account.username),
+		zap.String("role", account.role),
+		zap.Bool("recovery_code_used", recoveryCodesRemaining != nil),
+	)
+
+	response.RecoveryCodesRemaining = recoveryCodesRemaining
+	c.JSON(http.StatusOK, response)
 }
 
-// HandleRefreshToken handles token refresh
+// authenticate checks a username and password against the admin account
+// from the configuration, then against the users in the database
+func (h *AdminHandler) authenticate(c *gin.Context, username, password string) (*loginAccount, bool) {
+	if username == h.config.Admin.Username {
+		// The configured password may be a bcrypt hash or plain text
+		if auth.VerifyPassword(password, h.config.Admin.Password) || password == h.config.Admin.Password {
+			return &loginAccount{username: username, role: models.UserRoleAdmin}, true
+		}
+		return nil, false
+	}
+
+	user, err := h.db.GetUserByUsername(c.Request.Context(), username)
+	if err != nil {
+		if !strings.Contains(err.Error(), "not found") {
+			requestLog(c).Error("Failed to get user", zap.Error(err))
+		}
+		return nil, false
+	}
+	if !user.Enabled || !auth.VerifyPassword(password, user.PasswordHash) {
+		return nil, false
+	}
+
+	return &loginAccount{username: username, role: user.Role, user: user}, true
+}
+
+// totpRequired reports whether an account needs a second factor to log in
+func (h *AdminHandler) totpRequired(account *loginAccount) bool {
+	if account.user == nil {
+		return h.config.Admin.TOTPSecret != ""
+	}
+	return account.user.TOTPEnabled
+}
+
+// verifySecondFactor checks a TOTP code or a recovery code for an account.
+// It returns how many recovery codes are left if one was used.
+func (h *AdminHandler) verifySecondFactor(c *gin.Context, account *loginAccount, code string, now time.Time) (*int, bool) {
+	if account.user != nil {
+		return verifyUserCode(c, h.db, account.user, code, true, now)
+	}
+
+	// The admin account from the configuration has a TOTP secret but no
+	// recovery codes; whoever can change the configuration can reset it
+	if h.config.Admin.TOTPSecret == "" {
+		return nil, false
+	}
+	step, ok := auth.VerifyTOTP(h.config.Admin.TOTPSecret, strings.TrimSpace(code), now)
+	if !ok {
+		return nil, false
+	}
+
+	h.adminTOTPMu.Lock()
+	defer h.adminTOTPMu.Unlock()
+	if step <= h.adminTOTPStep {
+		return nil, false
+	}
+	h.adminTOTPStep = step
+	return nil, true
+}
+
+// currentAccount returns an account as it is now, or false if the user has
+// been disabled or deleted since logging in
+func (h *AdminHandler) currentAccount(c *gin.Context, username string) (*loginAccount, bool) {
+	if username == h.config.Admin.Username {
+		return &loginAccount{username: username, role: models.UserRoleAdmin}, true
+	}
+
+	user, err := h.db.GetUserByUsername(c.Request.Context(), username)
+	if err != nil {
+		if !strings.Contains(err.Error(), "not found") {
+			requestLog(c).Error("Failed to get user", zap.Error(err))
+		}
+		return nil, false
+	}
+	if !user.Enabled {
+		return nil, false
+	}
+	return &loginAccount{username: username, role: user.Role, user: user}, true
+}
+
+// HandleRefreshToken exchanges a refresh token for a new access token and
+// refresh token, until the session expires. Each refresh token works once:
+// one presented again has been copied, and its session is revoked. The
+// access token carries the user's current role, and users that were
+// disabled or deleted get none. Single sign-on sessions keep the role they
+// logged in with.
 // POST /api/v1/admin/refresh
 func (h *AdminHandler) HandleRefreshToken(c *gin.Context) {
-	username, exists := c.Get("username")
-	if !exists {
+	var req models.RefreshTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "Invalid request body",
+			Details: err.Error(),
+		})
+		return
+	}
+
+	refreshToken, err := auth.GenerateRefreshToken()
+	if err != nil {
+		requestLog(c).Error("Failed to generate refresh token", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to refresh token",
+		})
+		return
+	}
+
+	session, err := h.db.RotateRefreshToken(c.Request.Context(), req.RefreshToken, refreshToken)
+	if err != nil {
+		switch msg := err.Error(); {
+		case strings.Contains(msg, "already used"):
+			requestLog(c).Warn("Refresh token reused", zap.Error(err))
+		case strings.Contains(msg, "invalid") || strings.Contains(msg, "ended"):
+		default:
+			requestLog(c).Error("Failed to rotate refresh token", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+				Error: "Failed to refresh token",
+			})
+			return
+		}
 		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
-			Error: "Unauthorized",
+			Error: "Invalid or expired refresh token, sign in again",
 		})
 		return
 	}
 
-	token, expiresAt, err := h.jwtManager.Generate(username.(string))
+	role := session.Role
+	if session.Source != auth.SourceOIDC {
+		account, ok := h.currentAccount(c, session.Username)
+		if !ok {
+			if err := h.db.RevokeSession(c.Request.Context(), session.ID); err != nil {
+				requestLog(c).Error("Failed to revoke session", zap.Error(err))
+			}
+			c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+				Error: "Account is disabled or no longer exists",
+			})
+			return
+		}
+		role = account.role
+	}
+
+	token, expiresAt, err := h.jwtManager.Generate(session.Username, role, session.Source, session.ID)
 	if err != nil {
-		logger.Log.Error("Failed to refresh token", zap.Error(err))
+		requestLog(c).Error("Failed to refresh token", zap.Error(err))
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 			Error: "Failed to refresh token",
 		})
@@ -107,8 +329,10 @@ func (h *AdminHandler) HandleRefreshToken(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusOK, models.RefreshTokenResponse{
-		Token:     token,
-		ExpiresAt: expiresAt,
+		Token:            token,
+		ExpiresAt:        expiresAt,
+		RefreshToken:     refreshToken,
+		SessionExpiresAt: session.ExpiresAt,
 	})
 }
 
@@ -129,9 +353,9 @@ func (h *AdminHandler) HandleListNodes(c *gin.Context) {
 		return
 	}
 
-	nodes, total, err := h.db.GetAllNodes(status, page, limit)
+	nodes, total, err := h.db.GetAllNodes(c.Request.Context(), status, page, limit)
 	if err != nil {
-		logger.Log.Error("Failed to get nodes", zap.Error(err))
+		requestLog(c).Error("Failed to get nodes", zap.Error(err))
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 			Error: "Failed to retrieve nodes",
 		})
@@ -141,14 +365,14 @@ func (h *AdminHandler) HandleListNodes(c *gin.Context) {
 	// Enhance nodes with latest measurement info
 	var nodesWithStats []models.NodeWithStats
 	for _, node := range nodes {
-		nodeStats, err := h.db.GetNodeWithStats(node.ID)
+		nodeStats, err := h.db.GetNodeWithStats(c.Request.Context(), node.ID)
 		if err != nil {
 			// If we can't get stats, just use basic node info
-			nodesWithStats = append(nodesWithStats, models.NodeWithStats{
+			nodeStats = &models.NodeWithStats{
 				Node: node,
-			})
-			continue
+			}
 		}
+		h.hub.AnnotateNode(&nodeStats.Node)
 		nodesWithStats = append(nodesWithStats, *nodeStats)
 	}
 
@@ -171,13 +395,13 @@ func (h *AdminHandler) HandleGetNodeDetails(c *gin.Context) {
 		return
 	}
 
-	nodeWithStats, err := h.db.GetNodeWithStats(nodeID)
+	nodeWithStats, err := h.db.GetNodeWithStats(c.Request.Context(), nodeID)
 	if err != nil {
 		// Log at Info level for "not found" errors (expected 404s), Error level for actual DB issues
 		if strings.Contains(err.Error(), "not found") {
-			logger.Log.Info("Node not found", zap.String("node_id", nodeID.String()))
+			requestLog(c).Info("Node not found", zap.String("node_id", nodeID.String()))
 		} else {
-			logger.Log.Error("Failed to get node details", zap.Error(err))
+			requestLog(c).Error("Failed to get node details", zap.Error(err))
 		}
 		c.JSON(http.StatusNotFound, models.ErrorResponse{
 			Error: "Node not found",
@@ -185,6 +409,7 @@ func (h *AdminHandler) HandleGetNodeDetails(c *gin.Context) {
 		return
 	}
 
+	h.hub.AnnotateNode(&nodeWithStats.Node)
 	c.JSON(http.StatusOK, nodeWithStats)
 }
 
@@ -225,9 +450,9 @@ func (h *AdminHandler) HandleGetNodeMeasurements(c *gin.Context) {
 		}
 	}
 
-	measurements, total, err := h.db.GetMeasurementsByNode(nodeID, from, to, page, limit, status)
+	measurements, total, err := h.db.GetMeasurementsByNode(c.Request.Context(), nodeID, from, to, page, limit, status)
 	if err != nil {
-		logger.Log.Error("Failed to get measurements", zap.Error(err))
+		requestLog(c).Error("Failed to get measurements", zap.Error(err))
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 			Error: "Failed to retrieve measurements",
 		})
@@ -328,9 +553,9 @@ func (h *AdminHandler) HandleGetAggregatedMeasurements(c *gin.Context) {
 		}
 	}
 
-	measurements, err := h.db.GetAggregatedMeasurements(nodeIDs, from, to, interval, hideArchived)
+	measurements, err := h.db.GetAggregatedMeasurements(c.Request.Context(), nodeIDs, from, to, interval, hideArchived)
 	if err != nil {
-		logger.Log.Error("Failed to get aggregated measurements", zap.Error(err))
+		requestLog(c).Error("Failed to get aggregated measurements", zap.Error(err))
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 			Error: "Failed to retrieve aggregated measurements",
 		})
@@ -348,9 +573,9 @@ func (h *AdminHandler) HandleGetAggregatedMeasurements(c *gin.Context) {
 // GET /api/v1/admin/dashboard
 func (h *AdminHandler) HandleGetDashboard(c *gin.Context) {
 	// Get node counts
-	totalNodes, activeNodes, unreachableNodes, inactiveNodes, err := h.db.GetNodeCounts()
+	totalNodes, activeNodes, unreachableNodes, inactiveNodes, err := h.db.GetNodeCounts(c.Request.Context())
 	if err != nil {
-		logger.Log.Error("Failed to get node counts", zap.Error(err))
+		requestLog(c).Error("Failed to get node counts", zap.Error(err))
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 			Error: "Failed to retrieve dashboard data",
 		})
@@ -358,9 +583,9 @@ func (h *AdminHandler) HandleGetDashboard(c *gin.Context) {
 	}
 
 	// Get measurement counts
-	totalMeasurements, last24h, lastTimestamp, err := h.db.GetMeasurementCounts()
+	totalMeasurements, last24h, lastTimestamp, err := h.db.GetMeasurementCounts(c.Request.Context())
 	if err != nil {
-		logger.Log.Error("Failed to get measurement counts", zap.Error(err))
+		requestLog(c).Error("Failed to get measurement counts", zap.Error(err))
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 			Error: "Failed to retrieve dashboard data",
 		})
@@ -368,9 +593,9 @@ func (h *AdminHandler) HandleGetDashboard(c *gin.Context) {
 	}
 
 	// Get last 24h stats
-	stats, err := h.db.GetLast24hStats()
+	stats, err := h.db.GetLast24hStats(c.Request.Context())
 	if err != nil {
-		logger.Log.Error("Failed to get last 24h stats", zap.Error(err))
+		requestLog(c).Error("Failed to get last 24h stats", zap.Error(err))
 		stats = nil // Continue without stats
 	}
 
@@ -379,6 +604,7 @@ func (h *AdminHandler) HandleGetDashboard(c *gin.Context) {
 		ActiveNodes:         activeNodes,
 		UnreachableNodes:    unreachableNodes,
 		InactiveNodes:       inactiveNodes,
+		ConnectedNodes:      len(h.hub.ConnectedNodeIDs()),
 		TotalMeasurements:   totalMeasurements,
 		MeasurementsLast24h: last24h,
 		LastMeasurement:     lastTimestamp,
@@ -417,7 +643,7 @@ func (h *AdminHandler) HandleArchiveNode(c *gin.Context) {
 		return
 	}
 
-	err = h.db.ArchiveNode(nodeID, *req.Archived)
+	err = h.db.ArchiveNode(c.Request.Context(), nodeID, *req.Archived)
 	if err != nil {
 		if strings.Contains(err.Error(), "not found") {
 			c.JSON(http.StatusNotFound, models.ErrorResponse{
@@ -425,7 +651,7 @@ func (h *AdminHandler) HandleArchiveNode(c *gin.Context) {
 			})
 			return
 		}
-		logger.Log.Error("Failed to archive node", zap.Error(err))
+		requestLog(c).Error("Failed to archive node", zap.Error(err))
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 			Error: "Failed to update node",
 		})
@@ -437,7 +663,7 @@ func (h *AdminHandler) HandleArchiveNode(c *gin.Context) {
 		action = "unarchived"
 	}
 
-	logger.Log.Info("Node "+action,
+	requestLog(c).Info("Node "+action,
 		zap.String("node_id", nodeID.String()),
 	)
 
@@ -476,7 +702,7 @@ func (h *AdminHandler) HandleSetNodeFavorite(c *gin.Context) {
 		return
 	}
 
-	err = h.db.SetNodeFavorite(nodeID, *req.Favorite)
+	err = h.db.SetNodeFavorite(c.Request.Context(), nodeID, *req.Favorite)
 	if err != nil {
 		if strings.Contains(err.Error(), "not found") {
 			c.JSON(http.StatusNotFound, models.ErrorResponse{
@@ -484,7 +710,7 @@ func (h *AdminHandler) HandleSetNodeFavorite(c *gin.Context) {
 			})
 			return
 		}
-		logger.Log.Error("Failed to set node favorite", zap.Error(err))
+		requestLog(c).Error("Failed to set node favorite", zap.Error(err))
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 			Error: "Failed to update node",
 		})
@@ -496,7 +722,7 @@ func (h *AdminHandler) HandleSetNodeFavorite(c *gin.Context) {
 		action = "removed from"
 	}
 
-	logger.Log.Info("Node "+action+" favorites",
+	requestLog(c).Info("Node "+action+" favorites",
 		zap.String("node_id", nodeID.String()),
 	)
 
@@ -517,7 +743,7 @@ func (h *AdminHandler) HandleDeleteNode(c *gin.Context) {
 		return
 	}
 
-	err = h.db.DeleteNode(nodeID)
+	err = h.db.DeleteNode(c.Request.Context(), nodeID)
 	if err != nil {
 		if strings.Contains(err.Error(), "not found") {
 			c.JSON(http.StatusNotFound, models.ErrorResponse{
@@ -525,14 +751,14 @@ func (h *AdminHandler) HandleDeleteNode(c *gin.Context) {
 			})
 			return
 		}
-		logger.Log.Error("Failed to delete node", zap.Error(err))
+		requestLog(c).Error("Failed to delete node", zap.Error(err))
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 			Error: "Failed to delete node",
 		})
 		return
 	}
 
-	logger.Log.Info("Node deleted",
+	requestLog(c).Info("Node deleted",
 		zap.String("node_id", nodeID.String()),
 	)
 
@@ -2,17 +2,23 @@ package handlers
 
 import (
 	"net/http"
+	"strings"
+	"time"
 
 	"mark7888/speedtest-data-server/internal/api/validators"
 	"mark7888/speedtest-data-server/internal/auth"
 	"mark7888/speedtest-data-server/internal/db"
-	"mark7888/speedtest-data-server/internal/logger"
 	"mark7888/speedtest-data-server/pkg/models"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"go.uber.org/zap"
 )
 
+// defaultRotationGrace is how long a rotated key keeps working when the
+// request does not say
+const defaultRotationGrace = 24 * time.Hour
+
 // APIKeyHandler handles API key management endpoints
 type APIKeyHandler struct {
 	db db.Database
@@ -28,9 +34,9 @@ func NewAPIKeyHandler(database db.Database) *APIKeyHandler {
 // HandleListAPIKeys lists all API keys
 // GET /api/v1/admin/api-keys
 func (h *APIKeyHandler) HandleListAPIKeys(c *gin.Context) {
-	apiKeys, err := h.db.GetAllAPIKeys()
+	apiKeys, err := h.db.GetAllAPIKeys(c.Request.Context())
 	if err != nil {
-		logger.Log.Error("Failed to get API keys", zap.Error(err))
+		requestLog(c).Error("Failed to get API keys", zap.Error(err))
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 			Error: "Failed to retrieve API keys",
 		})
@@ -55,6 +61,20 @@ func (h *APIKeyHandler) HandleCreateAPIKey(c *gin.Context) {
 		return
 	}
 
+	now := time.Now()
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(now) {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "expires_at must be in the future",
+		})
+		return
+	}
+	if req.GracePeriod != "" && req.Replaces == nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "grace_period requires replaces",
+		})
+		return
+	}
+
 	// Get username from context
 	username, _ := c.Get("username")
 	createdBy := ""
@@ -62,43 +82,144 @@ func (h *APIKeyHandler) HandleCreateAPIKey(c *gin.Context) {
 		createdBy = u
 	}
 
+	newKey := models.NewAPIKey{
+		Name:      req.Name,
+		CreatedBy: createdBy,
+		Scopes:    req.Scopes,
+		NodeID:    req.NodeID,
+	}
+	if req.ExpiresAt != nil {
+		expiresAt := req.ExpiresAt.UTC()
+		newKey.ExpiresAt = &expiresAt
+	}
+
 	// Generate API key
 	plainKey, err := auth.GenerateAPIKey()
 	if err != nil {
-		logger.Log.Error("Failed to generate API key", zap.Error(err))
+		requestLog(c).Error("Failed to generate API key", zap.Error(err))
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 			Error: "Failed to generate API key",
 		})
 		return
 	}
 
-	// Create API key in database
-	apiKey, err := h.db.CreateAPIKey(req.Name, plainKey, createdBy)
-	if err != nil {
-		logger.Log.Error("Failed to create API key", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error: "Failed to create API key",
-		})
-		return
+	var apiKey *models.APIKey
+	var replacedExpiresAt *time.Time
+	if req.Replaces != nil {
+		apiKey, replacedExpiresAt = h.rotateAPIKey(c, &req, plainKey, newKey, now)
+		if apiKey == nil {
+			return
+		}
+	} else {
+		// Create API key in database
+		apiKey, err = h.db.CreateAPIKey(c.Request.Context(), plainKey, newKey)
+		if err != nil {
+			requestLog(c).Error("Failed to create API key", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+				Error: "Failed to create API key",
+			})
+			return
+		}
 	}
 
-	logger.Log.Info("API key created",
+	requestLog(c).Info("API key created",
 		zap.String("id", apiKey.ID.String()),
 		zap.String("name", req.Name),
 		zap.String("created_by", createdBy),
+		zap.Strings("scopes", apiKey.Scopes),
 	)
 
 	c.JSON(http.StatusCreated, models.CreateAPIKeyResponse{
-		ID:        apiKey.ID,
-		Name:      apiKey.Name,
-		Key:       plainKey, // Only shown once
-		Enabled:   apiKey.Enabled,
-		CreatedAt: apiKey.CreatedAt,
-		Warning:   "Save this key securely. It won't be shown again.",
+		ID:                apiKey.ID,
+		Name:              apiKey.Name,
+		Key:               plainKey, // Only shown once
+		Enabled:           apiKey.Enabled,
+		CreatedAt:         apiKey.CreatedAt,
+		NodeID:            apiKey.NodeID,
+		Scopes:            apiKey.Scopes,
+		ExpiresAt:         apiKey.ExpiresAt,
+		Replaces:          req.Replaces,
+		ReplacedExpiresAt: replacedExpiresAt,
+		Warning:           "Save this key securely. It won't be shown again.",
 	})
 }
 
-// HandleUpdateAPIKey updates an API key (enable/disable)
+// rotateAPIKey creates the successor of the key in req.Replaces, taking over
+// its scopes and node binding unless req sets them. It returns the new key
+// and when the old one expires, or a nil key after writing an error response.
+func (h *APIKeyHandler) rotateAPIKey(c *gin.Context, req *models.CreateAPIKeyRequest, plainKey string, newKey models.NewAPIKey, now time.Time) (*models.APIKey, *time.Time) {
+	grace := defaultRotationGrace
+	if req.GracePeriod != "" {
+		var err error
+		grace, err = time.ParseDuration(req.GracePeriod)
+		if err != nil || grace < 0 {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Error: "grace_period must be a duration such as 24h",
+			})
+			return nil, nil
+		}
+	}
+
+	oldKey, err := h.db.GetAPIKeyByID(c.Request.Context(), *req.Replaces)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{
+				Error: "API key to replace not found",
+			})
+			return nil, nil
+		}
+		requestLog(c).Error("Failed to get API key", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to rotate API key",
+		})
+		return nil, nil
+	}
+	if oldKey.ReplacedBy != nil {
+		c.JSON(http.StatusConflict, models.ErrorResponse{
+			Error:   "API key has already been replaced",
+			Details: oldKey.ReplacedBy.String(),
+		})
+		return nil, nil
+	}
+
+	if len(newKey.Scopes) == 0 {
+		newKey.Scopes = oldKey.Scopes
+	}
+	if newKey.NodeID == nil {
+		newKey.NodeID = oldKey.NodeID
+	}
+
+	// The grace period never extends the old key's life
+	oldExpiresAt := now.Add(grace).UTC()
+	if oldKey.ExpiresAt != nil && oldKey.ExpiresAt.Before(oldExpiresAt) {
+		oldExpiresAt = *oldKey.ExpiresAt
+	}
+
+	apiKey, err := h.db.RotateAPIKey(c.Request.Context(), oldKey.ID, oldExpiresAt, plainKey, newKey)
+	if err != nil {
+		if strings.Contains(err.Error(), "already replaced") {
+			c.JSON(http.StatusConflict, models.ErrorResponse{
+				Error: "API key has already been replaced",
+			})
+			return nil, nil
+		}
+		requestLog(c).Error("Failed to rotate API key", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to rotate API key",
+		})
+		return nil, nil
+	}
+
+	requestLog(c).Info("API key rotated",
+		zap.String("old_id", oldKey.ID.String()),
+		zap.String("new_id", apiKey.ID.String()),
+		zap.Time("old_expires_at", oldExpiresAt),
+	)
+
+	return apiKey, &oldExpiresAt
+}
+
+// HandleUpdateAPIKey updates an API key (enable/disable, scopes, expiry)
 // PATCH /api/v1/admin/api-keys/:id
 func (h *APIKeyHandler) HandleUpdateAPIKey(c *gin.Context) {
 	keyID, err := validators.ValidateUUID(c.Param("id"))
@@ -118,10 +239,38 @@ func (h *APIKeyHandler) HandleUpdateAPIKey(c *gin.Context) {
 		return
 	}
 
+	if req.NoExpiry && req.ExpiresAt != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "expires_at and no_expiry cannot be combined",
+		})
+		return
+	}
+
+	var updates []func() error
 	if req.Enabled != nil {
-		err := h.db.UpdateAPIKeyEnabled(keyID, *req.Enabled)
-		if err != nil {
-			logger.Log.Error("Failed to update API key", zap.Error(err))
+		updates = append(updates, func() error {
+			return h.db.UpdateAPIKeyEnabled(c.Request.Context(), keyID, *req.Enabled)
+		})
+	}
+	if req.Scopes != nil {
+		updates = append(updates, func() error {
+			return h.db.UpdateAPIKeyScopes(c.Request.Context(), keyID, req.Scopes)
+		})
+	}
+	if req.ExpiresAt != nil || req.NoExpiry {
+		var expiresAt *time.Time
+		if req.ExpiresAt != nil {
+			utc := req.ExpiresAt.UTC()
+			expiresAt = &utc
+		}
+		updates = append(updates, func() error {
+			return h.db.UpdateAPIKeyExpiry(c.Request.Context(), keyID, expiresAt)
+		})
+	}
+
+	for _, update := range updates {
+		if err := update(); err != nil {
+			requestLog(c).Error("Failed to update API key", zap.Error(err))
 			c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 				Error: "Failed to update API key",
 			})
@@ -130,18 +279,19 @@ func (h *APIKeyHandler) HandleUpdateAPIKey(c *gin.Context) {
 	}
 
 	// Get updated API key
-	apiKey, err := h.db.GetAPIKeyByID(keyID)
+	apiKey, err := h.db.GetAPIKeyByID(c.Request.Context(), keyID)
 	if err != nil {
-		logger.Log.Error("Failed to get updated API key", zap.Error(err))
+		requestLog(c).Error("Failed to get updated API key", zap.Error(err))
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 			Error: "Failed to retrieve updated API key",
 		})
 		return
 	}
 
-	logger.Log.Info("API key updated",
+	requestLog(c).Info("API key updated",
 		zap.String("id", keyID.String()),
 		zap.Bool("enabled", apiKey.Enabled),
+		zap.Strings("scopes", apiKey.Scopes),
 	)
 
 	c.JSON(http.StatusOK, apiKey)
@@ -158,16 +308,123 @@ func (h *APIKeyHandler) HandleDeleteAPIKey(c *gin.Context) {
 		return
 	}
 
-	err = h.db.DeleteAPIKey(keyID)
+	err = h.db.DeleteAPIKey(c.Request.Context(), keyID)
 	if err != nil {
-		logger.Log.Error("Failed to delete API key", zap.Error(err))
+		requestLog(c).Error("Failed to delete API key", zap.Error(err))
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 			Error: "Failed to delete API key",
 		})
 		return
 	}
 
-	logger.Log.Info("API key deleted", zap.String("id", keyID.String()))
+	requestLog(c).Info("API key deleted", zap.String("id", keyID.String()))
 
 	c.Status(http.StatusNoContent)
 }
+
+// HandleGetAPIKeyBinding shows the node an API key is bound to
+// GET /api/v1/admin/api-keys/:id/binding
+func (h *APIKeyHandler) HandleGetAPIKeyBinding(c *gin.Context) {
+	keyID, err := validators.ValidateUUID(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Invalid API key ID",
+		})
+		return
+	}
+
+	h.respondBinding(c, keyID)
+}
+
+// HandleBindAPIKey binds an API key to a node, replacing any earlier binding
+// PUT /api/v1/admin/api-keys/:id/binding
+func (h *APIKeyHandler) HandleBindAPIKey(c *gin.Context) {
+	keyID, err := validators.ValidateUUID(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Invalid API key ID",
+		})
+		return
+	}
+
+	var req models.BindAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "Invalid request body",
+			Details: err.Error(),
+		})
+		return
+	}
+
+	if err := h.db.SetAPIKeyNode(c.Request.Context(), keyID, &req.NodeID); err != nil {
+		h.respondBindingError(c, err, "Failed to update API key binding")
+		return
+	}
+
+	requestLog(c).Info("API key bound to node",
+		zap.String("id", keyID.String()),
+		zap.String("node_id", req.NodeID.String()),
+	)
+
+	h.respondBinding(c, keyID)
+}
+
+// HandleResetAPIKeyBinding unbinds an API key; it is bound again to the next
+// node that uses it
+// DELETE /api/v1/admin/api-keys/:id/binding
+func (h *APIKeyHandler) HandleResetAPIKeyBinding(c *gin.Context) {
+	keyID, err := validators.ValidateUUID(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Invalid API key ID",
+		})
+		return
+	}
+
+	if err := h.db.SetAPIKeyNode(c.Request.Context(), keyID, nil); err != nil {
+		h.respondBindingError(c, err, "Failed to update API key binding")
+		return
+	}
+
+	requestLog(c).Info("API key binding reset", zap.String("id", keyID.String()))
+
+	h.respondBinding(c, keyID)
+}
+
+// respondBinding writes the current binding of an API key
+func (h *APIKeyHandler) respondBinding(c *gin.Context, keyID uuid.UUID) {
+	apiKey, err := h.db.GetAPIKeyByID(c.Request.Context(), keyID)
+	if err != nil {
+		h.respondBindingError(c, err, "Failed to retrieve API key binding")
+		return
+	}
+
+	binding := models.APIKeyBinding{
+		APIKeyID: apiKey.ID,
+		NodeID:   apiKey.NodeID,
+		BoundAt:  apiKey.BoundAt,
+	}
+	// The node may not have reported in yet when bound by an admin
+	if apiKey.NodeID != nil {
+		if node, err := h.db.GetNodeByID(c.Request.Context(), *apiKey.NodeID); err == nil {
+			binding.NodeName = &node.Name
+		}
+	}
+
+	c.JSON(http.StatusOK, binding)
+}
+
+// respondBindingError writes the response for a failed binding lookup or change
+func (h *APIKeyHandler) respondBindingError(c *gin.Context, err error, message string) {
+	if strings.Contains(err.Error(), "not found") {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error: "API key not found",
+		})
+		return
+	}
+
+	requestLog(c).Error(message, zap.Error(err))
+	c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+		Error: message,
+	})
+}
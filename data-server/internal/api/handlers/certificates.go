@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"mark7888/speedtest-data-server/internal/auth"
+	"mark7888/speedtest-data-server/pkg/models"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// CertificateHandler issues client certificates that nodes authenticate
+// with instead of an API key
+type CertificateHandler struct {
+	ca       *auth.CertificateAuthority
+	validity time.Duration
+}
+
+// NewCertificateHandler creates a new certificate handler signing with ca
+func NewCertificateHandler(ca *auth.CertificateAuthority, validity time.Duration) *CertificateHandler {
+	return &CertificateHandler{
+		ca:       ca,
+		validity: validity,
+	}
+}
+
+// HandleSignCertificate signs a node's CSR with the node CA
+// POST /api/v1/admin/certificates
+func (h *CertificateHandler) HandleSignCertificate(c *gin.Context) {
+	var req models.SignCertificateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "Invalid request body",
+			Details: err.Error(),
+		})
+		return
+	}
+
+	cert, certPEM, err := h.ca.SignNodeCSR([]byte(req.CSR), req.NodeID, h.validity)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "Failed to sign certificate",
+			Details: err.Error(),
+		})
+		return
+	}
+
+	// Get username from context
+	username, _ := c.Get("username")
+	signedBy, _ := username.(string)
+
+	requestLog(c).Info("Node certificate issued",
+		zap.String("node_id", req.NodeID.String()),
+		zap.String("serial_number", cert.SerialNumber.Text(16)),
+		zap.Time("not_after", cert.NotAfter),
+		zap.String("signed_by", signedBy),
+	)
+
+	c.JSON(http.StatusCreated, models.SignCertificateResponse{
+		NodeID:        req.NodeID,
+		SerialNumber:  cert.SerialNumber.Text(16),
+		NotAfter:      cert.NotAfter,
+		Certificate:   string(certPEM),
+		CACertificate: string(h.ca.CertificatePEM()),
+	})
+}
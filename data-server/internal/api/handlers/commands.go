@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"mark7888/speedtest-data-server/internal/api/validators"
+	"mark7888/speedtest-data-server/internal/db"
+	"mark7888/speedtest-data-server/internal/ingest"
+	"mark7888/speedtest-data-server/pkg/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// CommandHandler handles commands queued for nodes. Commands are delivered
+// in the node's next alive response and the node reports back on its own.
+type CommandHandler struct {
+	db     db.Database
+	ingest *ingest.Service
+}
+
+// NewCommandHandler creates a new command handler
+func NewCommandHandler(database db.Database, ingestService *ingest.Service) *CommandHandler {
+	return &CommandHandler{
+		db:     database,
+		ingest: ingestService,
+	}
+}
+
+// HandleRunTest queues an on-demand speedtest for a node
+// POST /api/v1/admin/nodes/:id/run-test
+func (h *CommandHandler) HandleRunTest(c *gin.Context) {
+	nodeID, err := validators.ValidateUUID(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Invalid node ID",
+		})
+		return
+	}
+
+	if _, err := h.db.GetNodeByID(c.Request.Context(), nodeID); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{
+				Error: "Node not found",
+			})
+			return
+		}
+		requestLog(c).Error("Failed to get node", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to queue test",
+		})
+		return
+	}
+
+	createdBy := currentUsername(c)
+
+	// Only one test per node at a time; a second one would just queue behind
+	// it. The database enforces this, so concurrent requests cannot both
+	// queue one.
+	command, err := h.db.CreateNodeCommand(c.Request.Context(), nodeID, models.NodeCommandRunTest, createdBy)
+	if err != nil {
+		if strings.Contains(err.Error(), "already active") {
+			c.JSON(http.StatusConflict, models.ErrorResponse{
+				Error:   "A test is already queued or running on this node",
+				Details: h.activeTestID(c, nodeID),
+			})
+			return
+		}
+		requestLog(c).Error("Failed to create node command", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to queue test",
+		})
+		return
+	}
+
+	requestLog(c).Info("Speedtest queued for node",
+		zap.String("node_id", nodeID.String()),
+		zap.String("command_id", command.ID.String()),
+		zap.String("created_by", createdBy),
+	)
+
+	c.JSON(http.StatusAccepted, command)
+}
+
+// activeTestID returns the ID of the test queued or running on a node, or
+// an empty string if it cannot be found, e.g. because it just finished
+func (h *CommandHandler) activeTestID(c *gin.Context, nodeID uuid.UUID) string {
+	active, err := h.db.GetNodeCommands(c.Request.Context(), nodeID, true, 50)
+	if err != nil {
+		requestLog(c).Warn("Failed to get node commands", zap.Error(err))
+		return ""
+	}
+	for _, command := range active {
+		if command.Command == models.NodeCommandRunTest {
+			return command.ID.String()
+		}
+	}
+	return ""
+}
+
+// HandleListNodeCommands lists the most recent commands queued for a node
+// GET /api/v1/admin/nodes/:id/commands
+func (h *CommandHandler) HandleListNodeCommands(c *gin.Context) {
+	nodeID, err := validators.ValidateUUID(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Invalid node ID",
+		})
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	_, limit, _ = validators.ValidatePagination(1, limit)
+
+	commands, err := h.db.GetNodeCommands(c.Request.Context(), nodeID, false, limit)
+	if err != nil {
+		requestLog(c).Error("Failed to get node commands", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to retrieve commands",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.NodeCommandsResponse{
+		Commands: commands,
+	})
+}
+
+// HandleGetNodeCommand returns the status of a queued command
+// GET /api/v1/admin/nodes/:id/commands/:commandId
+func (h *CommandHandler) HandleGetNodeCommand(c *gin.Context) {
+	nodeID, err := validators.ValidateUUID(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Invalid node ID",
+		})
+		return
+	}
+
+	commandID, err := validators.ValidateUUID(c.Param("commandId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Invalid command ID",
+		})
+		return
+	}
+
+	command, err := h.db.GetNodeCommand(c.Request.Context(), commandID)
+	if err != nil && !strings.Contains(err.Error(), "not found") {
+		requestLog(c).Error("Failed to get node command", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to retrieve command",
+		})
+		return
+	}
+	if err != nil || command.NodeID != nodeID {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error: "Command not found",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, command)
+}
+
+// HandleCommandResult records a node's progress on a queued command
+// POST /api/v1/node/commands/:id/result
+func (h *CommandHandler) HandleCommandResult(c *gin.Context) {
+	commandID, err := validators.ValidateUUID(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Invalid command ID",
+		})
+		return
+	}
+
+	var req models.CommandResultRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		requestLog(c).Warn("Invalid command result request", zap.Error(err))
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "Invalid request body",
+			Details: err.Error(),
+		})
+		return
+	}
+
+	c.Set("node_id", req.NodeID.String())
+
+	response, err := h.ingest.ReportCommandResult(c.Request.Context(), commandID, &req)
+	if err != nil {
+		if forbidden(c, err) {
+			return
+		}
+		if strings.Contains(err.Error(), "not found") {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{
+				Error: "Command not found or already finished",
+			})
+			return
+		}
+		requestLog(c).Error("Failed to update node command", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to record command result",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
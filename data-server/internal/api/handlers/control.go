@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"mark7888/speedtest-data-server/internal/api/validators"
+	"mark7888/speedtest-data-server/internal/auth"
+	"mark7888/speedtest-data-server/internal/control"
+	"mark7888/speedtest-data-server/pkg/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+)
+
+// commandTimeout is how long the admin API waits for a node to answer a command
+const commandTimeout = 30 * time.Second
+
+// ControlHandler handles the node control channel and admin commands
+type ControlHandler struct {
+	hub      *control.Hub
+	upgrader websocket.Upgrader
+}
+
+// NewControlHandler creates a new control channel handler
+func NewControlHandler(hub *control.Hub) *ControlHandler {
+	return &ControlHandler{
+		hub: hub,
+		upgrader: websocket.Upgrader{
+			HandshakeTimeout: 10 * time.Second,
+			// Nodes are not browsers and authenticate with their API key
+			// or client certificate, so the Origin header carries no
+			// meaning here
+			CheckOrigin: func(r *http.Request) bool { return true },
+		},
+	}
+}
+
+// HandleConnect upgrades a node connection to a WebSocket control channel
+// GET /api/v1/node/ws
+func (h *ControlHandler) HandleConnect(c *gin.Context) {
+	ws, err := h.upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// Upgrade already wrote an HTTP error response
+		requestLog(c).Warn("Control channel upgrade failed", zap.Error(err))
+		return
+	}
+
+	apiKey, _ := auth.APIKeyFromContext(c.Request.Context())
+	cert, _ := auth.NodeCertificateFromContext(c.Request.Context())
+	h.hub.Serve(ws, apiKey, cert)
+}
+
+// HandleListConnectedNodes lists nodes with an open control channel
+// GET /api/v1/admin/nodes/connected
+func (h *ControlHandler) HandleListConnectedNodes(c *gin.Context) {
+	nodes := h.hub.ConnectedNodes()
+	c.JSON(http.StatusOK, gin.H{
+		"nodes": nodes,
+		"total": len(nodes),
+	})
+}
+
+// HandleSendCommand sends a command to a connected node and returns its result
+// POST /api/v1/admin/nodes/:id/commands
+func (h *ControlHandler) HandleSendCommand(c *gin.Context) {
+	nodeID, err := validators.ValidateUUID(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Invalid node ID",
+		})
+		return
+	}
+
+	var req models.SendCommandRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "Invalid request body",
+			Details: err.Error(),
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), commandTimeout)
+	defer cancel()
+
+	result, err := h.hub.SendCommand(ctx, nodeID, req.Name, req.Args)
+	if err != nil {
+		switch {
+		case errors.Is(err, control.ErrNodeNotConnected):
+			c.JSON(http.StatusConflict, models.ErrorResponse{
+				Error: "Node is not connected",
+			})
+		case errors.Is(err, context.DeadlineExceeded):
+			c.JSON(http.StatusGatewayTimeout, models.ErrorResponse{
+				Error: "Node did not respond in time",
+			})
+		default:
+			requestLog(c).Warn("Failed to send command", zap.Error(err), zap.String("node_id", nodeID.String()))
+			c.JSON(http.StatusBadGateway, models.ErrorResponse{
+				Error:   "Failed to send command",
+				Details: err.Error(),
+			})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
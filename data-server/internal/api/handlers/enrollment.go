@@ -0,0 +1,215 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"mark7888/speedtest-data-server/internal/api/validators"
+	"mark7888/speedtest-data-server/internal/auth"
+	"mark7888/speedtest-data-server/internal/db"
+	"mark7888/speedtest-data-server/pkg/models"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// defaultEnrollmentTokenTTL is how long an enrollment token works when the
+// request does not say
+const defaultEnrollmentTokenTTL = 24 * time.Hour
+
+// EnrollmentHandler handles enrollment tokens and the nodes enrolling with them
+type EnrollmentHandler struct {
+	db db.Database
+}
+
+// NewEnrollmentHandler creates a new enrollment handler
+func NewEnrollmentHandler(database db.Database) *EnrollmentHandler {
+	return &EnrollmentHandler{
+		db: database,
+	}
+}
+
+// HandleListEnrollmentTokens lists all enrollment tokens
+// GET /api/v1/admin/enrollment-tokens
+func (h *EnrollmentHandler) HandleListEnrollmentTokens(c *gin.Context) {
+	tokens, err := h.db.GetAllEnrollmentTokens(c.Request.Context())
+	if err != nil {
+		requestLog(c).Error("Failed to get enrollment tokens", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to retrieve enrollment tokens",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.ListEnrollmentTokensResponse{
+		EnrollmentTokens: tokens,
+		Total:            len(tokens),
+	})
+}
+
+// HandleCreateEnrollmentToken creates a new enrollment token
+// POST /api/v1/admin/enrollment-tokens
+func (h *EnrollmentHandler) HandleCreateEnrollmentToken(c *gin.Context) {
+	var req models.CreateEnrollmentTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "Invalid request body",
+			Details: err.Error(),
+		})
+		return
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(defaultEnrollmentTokenTTL)
+	if req.ExpiresAt != nil {
+		if !req.ExpiresAt.After(now) {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Error: "expires_at must be in the future",
+			})
+			return
+		}
+		expiresAt = *req.ExpiresAt
+	}
+	maxUses := req.MaxUses
+	if maxUses == 0 {
+		maxUses = 1
+	}
+
+	// Get username from context
+	username, _ := c.Get("username")
+	createdBy := ""
+	if u, ok := username.(string); ok {
+		createdBy = u
+	}
+
+	plainToken, err := auth.GenerateEnrollmentToken()
+	if err != nil {
+		requestLog(c).Error("Failed to generate enrollment token", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to generate enrollment token",
+		})
+		return
+	}
+
+	token, err := h.db.CreateEnrollmentToken(c.Request.Context(), plainToken, models.NewEnrollmentToken{
+		Name:      req.Name,
+		CreatedBy: createdBy,
+		Scopes:    req.Scopes,
+		MaxUses:   maxUses,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		requestLog(c).Error("Failed to create enrollment token", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to create enrollment token",
+		})
+		return
+	}
+
+	requestLog(c).Info("Enrollment token created",
+		zap.String("id", token.ID.String()),
+		zap.String("name", token.Name),
+		zap.String("created_by", createdBy),
+		zap.Int("max_uses", token.MaxUses),
+		zap.Time("expires_at", token.ExpiresAt),
+	)
+
+	c.JSON(http.StatusCreated, models.CreateEnrollmentTokenResponse{
+		EnrollmentToken: *token,
+		Token:           plainToken, // Only shown once
+		Warning:         "Save this token securely. It won't be shown again.",
+	})
+}
+
+// HandleDeleteEnrollmentToken deletes an enrollment token. Keys already
+// issued with it keep working.
+// DELETE /api/v1/admin/enrollment-tokens/:id
+func (h *EnrollmentHandler) HandleDeleteEnrollmentToken(c *gin.Context) {
+	tokenID, err := validators.ValidateUUID(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Invalid enrollment token ID",
+		})
+		return
+	}
+
+	if err := h.db.DeleteEnrollmentToken(c.Request.Context(), tokenID); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{
+				Error: "Enrollment token not found",
+			})
+			return
+		}
+		requestLog(c).Error("Failed to delete enrollment token", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to delete enrollment token",
+		})
+		return
+	}
+
+	requestLog(c).Info("Enrollment token deleted", zap.String("id", tokenID.String()))
+
+	c.Status(http.StatusNoContent)
+}
+
+// HandleEnroll exchanges an enrollment token for an API key bound to the
+// enrolling node
+// POST /api/v1/enroll
+func (h *EnrollmentHandler) HandleEnroll(c *gin.Context) {
+	var req models.EnrollRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "Invalid request body",
+			Details: err.Error(),
+		})
+		return
+	}
+
+	plainKey, err := auth.GenerateAPIKey()
+	if err != nil {
+		requestLog(c).Error("Failed to generate API key", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to generate API key",
+		})
+		return
+	}
+
+	apiKey, err := h.db.EnrollNode(c.Request.Context(), req.Token, plainKey, req.NodeID, req.NodeName)
+	if err != nil {
+		switch {
+		case strings.HasPrefix(err.Error(), "invalid enrollment token"):
+			c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+				Error: err.Error(),
+			})
+		case strings.HasPrefix(err.Error(), "enrollment token has"):
+			requestLog(c).Warn("Enrollment refused",
+				zap.String("node_id", req.NodeID.String()),
+				zap.Error(err),
+			)
+			c.JSON(http.StatusForbidden, models.ErrorResponse{
+				Error: err.Error(),
+			})
+		default:
+			requestLog(c).Error("Failed to enroll node", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+				Error: "Failed to enroll node",
+			})
+		}
+		return
+	}
+
+	requestLog(c).Info("Node enrolled",
+		zap.String("node_id", req.NodeID.String()),
+		zap.String("node_name", req.NodeName),
+		zap.String("api_key_id", apiKey.ID.String()),
+		zap.Stringp("enrolled_by", apiKey.CreatedBy),
+	)
+
+	c.JSON(http.StatusCreated, models.EnrollResponse{
+		APIKeyID: apiKey.ID,
+		Key:      plainKey,
+		NodeID:   req.NodeID,
+		Scopes:   apiKey.Scopes,
+	})
+}
@@ -2,10 +2,11 @@ package handlers
 
 import (
 	"net/http"
-	"time"
+	"strings"
 
-	"mark7888/speedtest-data-server/internal/db"
-	"mark7888/speedtest-data-server/internal/logger"
+	"mark7888/speedtest-data-server/internal/api/middleware"
+	"mark7888/speedtest-data-server/internal/api/validators"
+	"mark7888/speedtest-data-server/internal/ingest"
 	"mark7888/speedtest-data-server/pkg/models"
 
 	"github.com/gin-gonic/gin"
@@ -14,13 +15,13 @@ import (
 
 // NodeHandler handles node-related endpoints
 type NodeHandler struct {
-	db db.Database
+	ingest *ingest.Service
 }
 
 // NewNodeHandler creates a new node handler
-func NewNodeHandler(database db.Database) *NodeHandler {
+func NewNodeHandler(ingestService *ingest.Service) *NodeHandler {
 	return &NodeHandler{
-		db: database,
+		ingest: ingestService,
 	}
 }
 
@@ -29,7 +30,7 @@ func NewNodeHandler(database db.Database) *NodeHandler {
 func (h *NodeHandler) HandleAlive(c *gin.Context) {
 	var req models.AliveRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		logger.Log.Warn("Invalid alive request", zap.Error(err))
+		requestLog(c).Warn("Invalid alive request", zap.Error(err))
 		c.JSON(http.StatusBadRequest, models.ErrorResponse{
 			Error:   "Invalid request body",
 			Details: err.Error(),
@@ -37,24 +38,54 @@ func (h *NodeHandler) HandleAlive(c *gin.Context) {
 		return
 	}
 
-	// Upsert node (create if doesn't exist, update if it does)
-	err := h.db.UpsertNode(req.NodeID, req.NodeName, req.Location)
+	c.Set("node_id", req.NodeID.String())
+
+	response, err := h.ingest.Alive(c.Request.Context(), &req)
 	if err != nil {
-		logger.Log.Error("Failed to upsert node", zap.Error(err))
+		if forbidden(c, err) {
+			return
+		}
+		requestLog(c).Error("Failed to upsert node", zap.Error(err))
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 			Error: "Failed to register node",
 		})
 		return
 	}
 
-	logger.Log.Info("Node alive signal received",
-		zap.String("node_id", req.NodeID.String()),
-		zap.String("node_name", req.NodeName),
-	)
+	response.AcceptEncoding = middleware.SupportedContentEncodings
+	c.JSON(http.StatusOK, response)
+}
+
+// HandleGetStats returns a node's own statistics to the node
+// GET /api/v1/node/stats?node_id=...
+func (h *NodeHandler) HandleGetStats(c *gin.Context) {
+	nodeID, err := validators.ValidateUUID(c.Query("node_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Invalid node ID",
+		})
+		return
+	}
+
+	c.Set("node_id", nodeID.String())
+
+	stats, err := h.ingest.NodeStats(c.Request.Context(), nodeID)
+	if err != nil {
+		if forbidden(c, err) {
+			return
+		}
+		if strings.Contains(err.Error(), "not found") {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{
+				Error: "Node not found",
+			})
+			return
+		}
+		requestLog(c).Error("Failed to get node stats", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to retrieve node stats",
+		})
+		return
+	}
 
-	c.JSON(http.StatusOK, models.AliveResponse{
-		Status:         "ok",
-		ServerTime:     time.Now(),
-		NodeRegistered: true,
-	})
+	c.JSON(http.StatusOK, stats)
 }
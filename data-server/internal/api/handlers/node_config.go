@@ -0,0 +1,225 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"mark7888/speedtest-data-server/internal/api/validators"
+	"mark7888/speedtest-data-server/internal/db"
+	"mark7888/speedtest-data-server/internal/ingest"
+	"mark7888/speedtest-data-server/pkg/models"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// NodeConfigHandler handles server-managed node settings. Nodes pick up
+// changes with their next alive response and apply them without a restart.
+type NodeConfigHandler struct {
+	db     db.Database
+	ingest *ingest.Service
+}
+
+// NewNodeConfigHandler creates a new node config handler
+func NewNodeConfigHandler(database db.Database, ingestService *ingest.Service) *NodeConfigHandler {
+	return &NodeConfigHandler{
+		db:     database,
+		ingest: ingestService,
+	}
+}
+
+// HandleGetDefaultConfig returns the fleet-wide node settings
+// GET /api/v1/admin/node-config
+func (h *NodeConfigHandler) HandleGetDefaultConfig(c *gin.Context) {
+	config, err := h.db.GetNodeConfig(c.Request.Context(), models.NodeConfigScopeDefault)
+	if err != nil {
+		requestLog(c).Error("Failed to get default node config", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to retrieve node config",
+		})
+		return
+	}
+
+	if config == nil {
+		config = &models.NodeConfig{Scope: models.NodeConfigScopeDefault}
+	}
+
+	c.JSON(http.StatusOK, config)
+}
+
+// HandleSetDefaultConfig replaces the fleet-wide node settings
+// PUT /api/v1/admin/node-config
+func (h *NodeConfigHandler) HandleSetDefaultConfig(c *gin.Context) {
+	settings, ok := bindNodeSettings(c)
+	if !ok {
+		return
+	}
+
+	config, err := h.db.SetNodeConfig(c.Request.Context(), models.NodeConfigScopeDefault, settings, currentUsername(c))
+	if err != nil {
+		requestLog(c).Error("Failed to set default node config", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to update node config",
+		})
+		return
+	}
+
+	requestLog(c).Info("Default node config updated",
+		zap.String("version", settings.Version()),
+	)
+
+	c.JSON(http.StatusOK, config)
+}
+
+// HandleGetNodeConfig returns how a node's settings resolve and which version it runs
+// GET /api/v1/admin/nodes/:id/config
+func (h *NodeConfigHandler) HandleGetNodeConfig(c *gin.Context) {
+	nodeID, err := validators.ValidateUUID(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Invalid node ID",
+		})
+		return
+	}
+
+	node, err := h.db.GetNodeByID(c.Request.Context(), nodeID)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{
+				Error: "Node not found",
+			})
+			return
+		}
+		requestLog(c).Error("Failed to get node", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to retrieve node config",
+		})
+		return
+	}
+
+	config, err := h.ingest.ResolveNodeConfig(c.Request.Context(), nodeID)
+	if err != nil {
+		requestLog(c).Error("Failed to resolve node config", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to retrieve node config",
+		})
+		return
+	}
+
+	config.AppliedVersion = node.ConfigVersion
+	config.InSync = node.ConfigVersion != nil && *node.ConfigVersion == config.Version
+
+	c.JSON(http.StatusOK, config)
+}
+
+// HandleSetNodeConfig replaces a node's setting overrides
+// PUT /api/v1/admin/nodes/:id/config
+func (h *NodeConfigHandler) HandleSetNodeConfig(c *gin.Context) {
+	nodeID, err := validators.ValidateUUID(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Invalid node ID",
+		})
+		return
+	}
+
+	settings, ok := bindNodeSettings(c)
+	if !ok {
+		return
+	}
+
+	if _, err := h.db.GetNodeByID(c.Request.Context(), nodeID); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{
+				Error: "Node not found",
+			})
+			return
+		}
+		requestLog(c).Error("Failed to get node", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to update node config",
+		})
+		return
+	}
+
+	config, err := h.db.SetNodeConfig(c.Request.Context(), nodeID.String(), settings, currentUsername(c))
+	if err != nil {
+		requestLog(c).Error("Failed to set node config", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to update node config",
+		})
+		return
+	}
+
+	requestLog(c).Info("Node config updated",
+		zap.String("node_id", nodeID.String()),
+	)
+
+	c.JSON(http.StatusOK, config)
+}
+
+// HandleDeleteNodeConfig removes a node's setting overrides so it follows the fleet default
+// DELETE /api/v1/admin/nodes/:id/config
+func (h *NodeConfigHandler) HandleDeleteNodeConfig(c *gin.Context) {
+	nodeID, err := validators.ValidateUUID(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Invalid node ID",
+		})
+		return
+	}
+
+	if err := h.db.DeleteNodeConfig(c.Request.Context(), nodeID.String()); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{
+				Error: "Node has no config overrides",
+			})
+			return
+		}
+		requestLog(c).Error("Failed to delete node config", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to delete node config",
+		})
+		return
+	}
+
+	requestLog(c).Info("Node config overrides removed",
+		zap.String("node_id", nodeID.String()),
+	)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Node config overrides removed",
+	})
+}
+
+// bindNodeSettings parses and validates node settings from the request body,
+// writing the error response itself on failure
+func bindNodeSettings(c *gin.Context) (models.NodeSettings, bool) {
+	var settings models.NodeSettings
+	if err := c.ShouldBindJSON(&settings); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "Invalid request body",
+			Details: err.Error(),
+		})
+		return settings, false
+	}
+
+	if err := validators.ValidateNodeSettings(settings); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "Invalid node settings",
+			Details: err.Error(),
+		})
+		return settings, false
+	}
+
+	return settings, true
+}
+
+// currentUsername returns the authenticated admin's username, if any
+func currentUsername(c *gin.Context) string {
+	username, _ := c.Get("username")
+	if u, ok := username.(string); ok {
+		return u
+	}
+	return ""
+}
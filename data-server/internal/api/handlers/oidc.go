@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"mark7888/speedtest-data-server/internal/auth"
+	"mark7888/speedtest-data-server/internal/config"
+	"mark7888/speedtest-data-server/internal/db"
+	"mark7888/speedtest-data-server/pkg/models"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const (
+	// oidcLoginTTL is how long a user has to sign in at the identity provider
+	oidcLoginTTL = 10 * time.Minute
+
+	// oidcMaxPendingLogins bounds the logins in progress kept in memory
+	oidcMaxPendingLogins = 1000
+
+	// oidcStateCookie ties the callback to the browser that started the
+	// login, so nobody can be signed in to someone else's account with a
+	// forwarded callback URL
+	oidcStateCookie = "oidc_state"
+	oidcCookiePath  = "/api/v1/admin/oidc"
+)
+
+// OIDCHandler handles admin login through an OpenID Connect identity
+// provider. After the provider signs a user in, the server issues its own
+// token with the role the user's groups map to; the provider's tokens are
+// not used beyond the callback.
+type OIDCHandler struct {
+	db         db.Database
+	jwtManager *auth.JWTManager
+	config     *config.Config
+	provider   *auth.OIDCProvider
+	mapping    auth.OIDCRoleMapping
+	logins     *auth.OIDCLoginStore
+}
+
+// NewOIDCHandler creates a new OIDC handler from the single sign-on
+// configuration
+func NewOIDCHandler(database db.Database, jwtManager *auth.JWTManager, cfg *config.Config) *OIDCHandler {
+	return &OIDCHandler{
+		db:         database,
+		jwtManager: jwtManager,
+		config:     cfg,
+		provider: auth.NewOIDCProvider(cfg.OIDC.IssuerURL, cfg.OIDC.ClientID, cfg.OIDC.ClientSecret,
+			cfg.OIDC.RedirectURL, cfg.OIDC.Scopes),
+		mapping: auth.OIDCRoleMapping{
+			UsernameClaim: cfg.OIDC.UsernameClaim,
+			GroupsClaim:   cfg.OIDC.GroupsClaim,
+			Roles:         cfg.OIDC.RoleMapping,
+			DefaultRole:   cfg.OIDC.DefaultRole,
+		},
+		logins: auth.NewOIDCLoginStore(oidcLoginTTL, oidcMaxPendingLogins),
+	}
+}
+
+// HandleLogin starts a login by redirecting to the identity provider
+// GET /api/v1/admin/oidc/login
+func (h *OIDCHandler) HandleLogin(c *gin.Context) {
+	login, err := auth.NewOIDCLogin()
+	if err != nil {
+		requestLog(c).Error("Failed to start single sign-on", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to start single sign-on",
+		})
+		return
+	}
+
+	authURL, err := h.provider.AuthCodeURL(c.Request.Context(), login)
+	if err != nil {
+		requestLog(c).Error("Identity provider unavailable", zap.Error(err))
+		c.JSON(http.StatusBadGateway, models.ErrorResponse{
+			Error: "Identity provider is unavailable",
+		})
+		return
+	}
+
+	if err := h.logins.Put(login, time.Now()); err != nil {
+		requestLog(c).Warn("Rejected single sign-on", zap.Error(err))
+		c.JSON(http.StatusServiceUnavailable, models.ErrorResponse{
+			Error: "Too many logins in progress, try again later",
+		})
+		return
+	}
+
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, login.State, int(oidcLoginTTL.Seconds()), oidcCookiePath, "",
+		strings.HasPrefix(h.config.OIDC.RedirectURL, "https://"), true)
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// HandleCallback completes a login when the identity provider redirects
+// back, and issues a token for the user. With a post-login redirect
+// configured, the browser is sent there with the token or the error in the
+// URL fragment; otherwise the token is returned like from a password login.
+// GET /api/v1/admin/oidc/callback
+func (h *OIDCHandler) HandleCallback(c *gin.Context) {
+	cookieState, _ := c.Cookie(oidcStateCookie)
+	c.SetCookie(oidcStateCookie, "", -1, oidcCookiePath, "",
+		strings.HasPrefix(h.config.OIDC.RedirectURL, "https://"), true)
+
+	state := c.Query("state")
+	login, ok := h.logins.Take(state, time.Now())
+	if !ok || subtle.ConstantTimeCompare([]byte(cookieState), []byte(state)) != 1 {
+		h.fail(c, http.StatusBadRequest, "Unknown or expired login, start again", "")
+		return
+	}
+
+	if providerErr := c.Query("error"); providerErr != "" {
+		requestLog(c).Warn("Identity provider denied login",
+			zap.String("error", providerErr),
+			zap.String("description", c.Query("error_description")),
+		)
+		h.fail(c, http.StatusUnauthorized, "Single sign-on failed", providerErr)
+		return
+	}
+
+	code := c.Query("code")
+	if code == "" {
+		h.fail(c, http.StatusBadRequest, "Missing authorization code", "")
+		return
+	}
+
+	claims, err := h.provider.Exchange(c.Request.Context(), code, login)
+	if err != nil {
+		requestLog(c).Warn("Single sign-on failed", zap.Error(err))
+		h.fail(c, http.StatusUnauthorized, "Single sign-on failed", "")
+		return
+	}
+
+	username := h.mapping.Username(claims)
+	role, ok := h.mapping.Role(claims)
+	if !ok {
+		requestLog(c).Warn("Single sign-on user has no role", zap.String("username", username))
+		h.fail(c, http.StatusForbidden, "Your account has no access to this server", "")
+		return
+	}
+
+	// Permissions follow the username, so an identity provider account must
+	// not take over a local account with the same name
+	if h.isLocalUser(c, username) {
+		requestLog(c).Warn("Single sign-on user collides with a local account", zap.String("username", username))
+		h.fail(c, http.StatusConflict, "A local account with this username exists, sign in with its password", "")
+		return
+	}
+
+	response, err := startSession(c, h.db, h.jwtManager, h.config, username, role, auth.SourceOIDC)
+	if err != nil {
+		requestLog(c).Error("Failed to start session", zap.Error(err))
+		h.fail(c, http.StatusInternalServerError, "Failed to generate token", "")
+		return
+	}
+
+	requestLog(c).Info("Single sign-on login successful",
+		zap.String("username", username),
+		zap.String("role", role),
+		zap.Any("subject", claims["sub"]),
+	)
+
+	if h.config.OIDC.PostLoginRedirect == "" {
+		c.JSON(http.StatusOK, response)
+		return
+	}
+	h.redirect(c, url.Values{
+		"token":              {response.Token},
+		"expires_at":         {response.ExpiresAt.Format(time.RFC3339)},
+		"refresh_token":      {response.RefreshToken},
+		"session_expires_at": {response.SessionExpiresAt.Format(time.RFC3339)},
+		"username":           {response.Username},
+		"role":               {response.Role},
+	})
+}
+
+// isLocalUser reports whether username belongs to the admin account from
+// the configuration or a user in the database. Lookup errors count as a
+// collision, so a database outage cannot let a login through.
+func (h *OIDCHandler) isLocalUser(c *gin.Context, username string) bool {
+	if username == h.config.Admin.Username {
+		return true
+	}
+
+	_, err := h.db.GetUserByUsername(c.Request.Context(), username)
+	if err != nil && strings.Contains(err.Error(), "not found") {
+		return false
+	}
+	if err != nil {
+		requestLog(c).Error("Failed to get user", zap.Error(err))
+	}
+	return true
+}
+
+// fail reports a failed login to the dashboard, or as JSON without one
+func (h *OIDCHandler) fail(c *gin.Context, status int, message, details string) {
+	if h.config.OIDC.PostLoginRedirect == "" {
+		c.JSON(status, models.ErrorResponse{
+			Error:   message,
+			Details: details,
+		})
+		return
+	}
+	h.redirect(c, url.Values{"error": {message}})
+}
+
+// redirect sends the browser to the dashboard with values in the URL
+// fragment, which browsers do not send to servers or in Referer headers
+func (h *OIDCHandler) redirect(c *gin.Context, values url.Values) {
+	c.Header("Cache-Control", "no-store")
+	c.Redirect(http.StatusFound, h.config.OIDC.PostLoginRedirect+"#"+values.Encode())
+}
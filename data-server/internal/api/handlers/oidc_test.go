@@ -0,0 +1,268 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"mark7888/speedtest-data-server/internal/api/middleware"
+	"mark7888/speedtest-data-server/internal/auth"
+	"mark7888/speedtest-data-server/internal/auth/oidctest"
+	"mark7888/speedtest-data-server/internal/config"
+	"mark7888/speedtest-data-server/internal/db/sqlite"
+	"mark7888/speedtest-data-server/internal/logger"
+	"mark7888/speedtest-data-server/pkg/models"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// oidcTestServer is a server with single sign-on through a mock provider
+type oidcTestServer struct {
+	router     *gin.Engine
+	idp        *oidctest.Provider
+	jwtManager *auth.JWTManager
+}
+
+func newOIDCTestServer(t *testing.T, postLoginRedirect string) *oidcTestServer {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	logger.Log = zap.NewNop()
+
+	idp := oidctest.NewProvider(t, "dashboard", "client-secret")
+
+	cfg := &config.Config{}
+	cfg.Database.Path = filepath.Join(t.TempDir(), "test.db")
+	cfg.APIKeys.Secret = "test-secret"
+	cfg.Admin.Username = "admin"
+	cfg.JWT.SessionLifetime = time.Hour
+	cfg.OIDC = config.OIDCConfig{
+		IssuerURL:         idp.Issuer(),
+		ClientID:          "dashboard",
+		ClientSecret:      "client-secret",
+		RedirectURL:       "https://monitor.example.com/api/v1/admin/oidc/callback",
+		Scopes:            []string{"openid", "profile"},
+		UsernameClaim:     "preferred_username",
+		GroupsClaim:       "groups",
+		RoleMapping:       map[string]string{"net-ops": models.UserRoleOperator, "net-admins": models.UserRoleAdmin},
+		PostLoginRedirect: postLoginRedirect,
+	}
+
+	database, err := sqlite.New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close() })
+	if err := database.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := database.CreateUser(context.Background(), models.NewUser{Username: "bob", PasswordHash: "x", Role: models.UserRoleViewer}); err != nil {
+		t.Fatal(err)
+	}
+
+	jwtManager := auth.NewJWTManager("test-secret", time.Hour)
+	oidcHandler := NewOIDCHandler(database, jwtManager, cfg)
+	adminHandler := NewAdminHandler(database, jwtManager, cfg, nil)
+	userHandler := NewUserHandler(database, cfg)
+
+	router := gin.New()
+	router.GET("/api/v1/admin/oidc/login", oidcHandler.HandleLogin)
+	router.GET("/api/v1/admin/oidc/callback", oidcHandler.HandleCallback)
+	router.POST("/api/v1/admin/refresh", adminHandler.HandleRefreshToken)
+	protected := router.Group("/api/v1/admin", middleware.JWTAuth(jwtManager, database))
+	protected.GET("/me", userHandler.HandleGetCurrentUser)
+
+	return &oidcTestServer{router: router, idp: idp, jwtManager: jwtManager}
+}
+
+// serve sends a request to the server under test
+func (s *oidcTestServer) serve(req *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	return w
+}
+
+// startLogin starts a login and returns the callback the provider
+// redirects the browser to, and the state cookie the browser holds
+func (s *oidcTestServer) startLogin(t *testing.T) (*url.URL, *http.Cookie) {
+	t.Helper()
+
+	w := s.serve(httptest.NewRequest(http.MethodGet, "/api/v1/admin/oidc/login", nil))
+	if w.Code != http.StatusFound {
+		t.Fatalf("login returned %d: %s", w.Code, w.Body.String())
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != oidcStateCookie || !cookies[0].HttpOnly || !cookies[0].Secure {
+		t.Fatalf("login set cookies %v, want a secure HttpOnly state cookie", cookies)
+	}
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	callback, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return callback, cookies[0]
+}
+
+// callback delivers the provider's redirect to the server under test
+func (s *oidcTestServer) callback(callback *url.URL, cookie *http.Cookie) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, callback.RequestURI(), nil)
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	return s.serve(req)
+}
+
+func TestOIDCCallback(t *testing.T) {
+	tests := []struct {
+		name     string
+		claims   map[string]interface{}
+		wantCode int
+		wantRole string
+	}{
+		{name: "mapped group", claims: map[string]interface{}{"sub": "u1", "preferred_username": "alice", "groups": []string{"staff", "net-ops"}}, wantCode: http.StatusOK, wantRole: models.UserRoleOperator},
+		{name: "highest role wins", claims: map[string]interface{}{"sub": "u1", "preferred_username": "alice", "groups": []string{"net-ops", "net-admins"}}, wantCode: http.StatusOK, wantRole: models.UserRoleAdmin},
+		{name: "no mapped group", claims: map[string]interface{}{"sub": "u1", "preferred_username": "alice", "groups": []string{"staff"}}, wantCode: http.StatusForbidden},
+		{name: "configured admin's username", claims: map[string]interface{}{"sub": "u1", "preferred_username": "admin", "groups": []string{"net-admins"}}, wantCode: http.StatusConflict},
+		{name: "local user's username", claims: map[string]interface{}{"sub": "u1", "preferred_username": "bob", "groups": []string{"net-admins"}}, wantCode: http.StatusConflict},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newOIDCTestServer(t, "")
+			s.idp.SetClaims(tt.claims)
+
+			callback, cookie := s.startLogin(t)
+			w := s.callback(callback, cookie)
+			if w.Code != tt.wantCode {
+				t.Fatalf("callback returned %d, want %d: %s", w.Code, tt.wantCode, w.Body.String())
+			}
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+
+			var resp models.LoginResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			claims, err := s.jwtManager.Validate(resp.Token)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if claims.Username != "alice" || claims.Role != tt.wantRole || claims.Source != auth.SourceOIDC {
+				t.Errorf("token claims = %+v, want alice as %s from single sign-on", claims, tt.wantRole)
+			}
+
+			// The state is single use
+			if w := s.callback(callback, cookie); w.Code != http.StatusBadRequest {
+				t.Errorf("replayed callback returned %d, want 400", w.Code)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/admin/me", nil)
+			req.Header.Set("Authorization", "Bearer "+resp.Token)
+			if w := s.serve(req); !strings.Contains(w.Body.String(), `"single_sign_on":true`) {
+				t.Errorf("/me returned %s, want a single sign-on user", w.Body.String())
+			}
+
+			// Refreshing keeps the role from the identity provider
+			body := strings.NewReader(`{"refresh_token":"` + resp.RefreshToken + `"}`)
+			req = httptest.NewRequest(http.MethodPost, "/api/v1/admin/refresh", body)
+			req.Header.Set("Content-Type", "application/json")
+			w = s.serve(req)
+			var refreshed models.RefreshTokenResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &refreshed); w.Code != http.StatusOK || err != nil {
+				t.Fatalf("refresh returned %d: %s", w.Code, w.Body.String())
+			}
+			claims, err = s.jwtManager.Validate(refreshed.Token)
+			if err != nil || claims.Role != tt.wantRole || claims.Source != auth.SourceOIDC {
+				t.Errorf("refreshed token claims = %+v, %v; want %s from single sign-on", claims, err, tt.wantRole)
+			}
+		})
+	}
+}
+
+func TestOIDCCallbackRejected(t *testing.T) {
+	s := newOIDCTestServer(t, "")
+	s.idp.SetClaims(map[string]interface{}{"sub": "u1", "preferred_username": "alice", "groups": []string{"net-ops"}})
+
+	t.Run("without the state cookie", func(t *testing.T) {
+		callback, _ := s.startLogin(t)
+		if w := s.callback(callback, nil); w.Code != http.StatusBadRequest {
+			t.Errorf("callback returned %d, want 400", w.Code)
+		}
+	})
+
+	t.Run("another browser's state cookie", func(t *testing.T) {
+		callback, _ := s.startLogin(t)
+		_, otherCookie := s.startLogin(t)
+		if w := s.callback(callback, otherCookie); w.Code != http.StatusBadRequest {
+			t.Errorf("callback returned %d, want 400", w.Code)
+		}
+	})
+
+	t.Run("provider error", func(t *testing.T) {
+		callback, cookie := s.startLogin(t)
+		query := url.Values{"state": {callback.Query().Get("state")}, "error": {"access_denied"}}
+		callback.RawQuery = query.Encode()
+		if w := s.callback(callback, cookie); w.Code != http.StatusUnauthorized {
+			t.Errorf("callback returned %d, want 401", w.Code)
+		}
+	})
+
+	t.Run("invalid code", func(t *testing.T) {
+		callback, cookie := s.startLogin(t)
+		query := callback.Query()
+		query.Set("code", "made-up")
+		callback.RawQuery = query.Encode()
+		if w := s.callback(callback, cookie); w.Code != http.StatusUnauthorized {
+			t.Errorf("callback returned %d, want 401", w.Code)
+		}
+	})
+}
+
+func TestOIDCCallbackRedirect(t *testing.T) {
+	s := newOIDCTestServer(t, "https://dashboard.example.com/login")
+	s.idp.SetClaims(map[string]interface{}{"sub": "u1", "preferred_username": "alice", "groups": []string{"net-ops"}})
+
+	callback, cookie := s.startLogin(t)
+	w := s.callback(callback, cookie)
+	if w.Code != http.StatusFound {
+		t.Fatalf("callback returned %d, want a redirect", w.Code)
+	}
+	location, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fragment, err := url.ParseQuery(location.Fragment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if location.Host != "dashboard.example.com" || location.RawQuery != "" || fragment.Get("role") != models.UserRoleOperator {
+		t.Errorf("redirected to %s, want the dashboard with the token in the fragment", location)
+	}
+	if _, err := s.jwtManager.Validate(fragment.Get("token")); err != nil {
+		t.Errorf("token in the fragment: %v", err)
+	}
+	if auth.RefreshTokenID(fragment.Get("refresh_token")) == "" {
+		t.Errorf("fragment has no refresh token: %s", location.Fragment)
+	}
+
+	// Failures go to the dashboard too
+	s.idp.SetClaims(map[string]interface{}{"sub": "u2", "preferred_username": "carol"})
+	callback, cookie = s.startLogin(t)
+	w = s.callback(callback, cookie)
+	if location := w.Header().Get("Location"); w.Code != http.StatusFound || !strings.Contains(location, "#error=") {
+		t.Errorf("failed callback returned %d to %q, want a redirect with the error", w.Code, location)
+	}
+}
@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"mark7888/speedtest-data-server/internal/api/validators"
+	"mark7888/speedtest-data-server/internal/db"
+	"mark7888/speedtest-data-server/pkg/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// QuarantineHandler handles measurements held back by the plausibility
+// checks. Approving one stores it as a regular measurement.
+type QuarantineHandler struct {
+	db db.Database
+}
+
+// NewQuarantineHandler creates a new quarantine handler
+func NewQuarantineHandler(database db.Database) *QuarantineHandler {
+	return &QuarantineHandler{
+		db: database,
+	}
+}
+
+// HandleListQuarantined lists measurements awaiting review
+// GET /api/v1/admin/measurements/quarantine
+func (h *QuarantineHandler) HandleListQuarantined(c *gin.Context) {
+	var nodeID *uuid.UUID
+	if nodeIDStr := c.Query("node_id"); nodeIDStr != "" {
+		id, err := validators.ValidateUUID(nodeIDStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Error: "Invalid node ID",
+			})
+			return
+		}
+		nodeID = &id
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	page, limit, _ = validators.ValidatePagination(page, limit)
+
+	measurements, total, err := h.db.GetQuarantinedMeasurements(c.Request.Context(), nodeID, page, limit)
+	if err != nil {
+		requestLog(c).Error("Failed to get quarantined measurements", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to retrieve quarantined measurements",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.QuarantinedMeasurementsResponse{
+		Measurements: measurements,
+		Total:        total,
+		Page:         page,
+		Limit:        limit,
+	})
+}
+
+// HandleApproveQuarantined stores a quarantined measurement and removes it from quarantine
+// POST /api/v1/admin/measurements/quarantine/:id/approve
+func (h *QuarantineHandler) HandleApproveQuarantined(c *gin.Context) {
+	id, err := validators.ValidateUUID(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Invalid quarantined measurement ID",
+		})
+		return
+	}
+
+	quarantined, err := h.db.GetQuarantinedMeasurement(c.Request.Context(), id)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{
+				Error: "Quarantined measurement not found",
+			})
+			return
+		}
+		requestLog(c).Error("Failed to get quarantined measurement", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to approve measurement",
+		})
+		return
+	}
+
+	// Inserting is an upsert, so approving again after a failed delete is harmless
+	if err := h.db.InsertMeasurement(c.Request.Context(), &quarantined.Measurement); err != nil {
+		requestLog(c).Error("Failed to insert approved measurement", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to approve measurement",
+		})
+		return
+	}
+
+	if err := h.db.DeleteQuarantinedMeasurement(c.Request.Context(), id); err != nil && !strings.Contains(err.Error(), "not found") {
+		requestLog(c).Error("Failed to delete quarantined measurement", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to approve measurement",
+		})
+		return
+	}
+
+	requestLog(c).Info("Quarantined measurement approved",
+		zap.String("id", id.String()),
+		zap.String("node_id", quarantined.NodeID.String()),
+		zap.Time("timestamp", quarantined.Timestamp),
+		zap.String("approved_by", currentUsername(c)),
+	)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Measurement approved",
+	})
+}
+
+// HandleDiscardQuarantined deletes a quarantined measurement without storing it
+// DELETE /api/v1/admin/measurements/quarantine/:id
+func (h *QuarantineHandler) HandleDiscardQuarantined(c *gin.Context) {
+	id, err := validators.ValidateUUID(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Invalid quarantined measurement ID",
+		})
+		return
+	}
+
+	if err := h.db.DeleteQuarantinedMeasurement(c.Request.Context(), id); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{
+				Error: "Quarantined measurement not found",
+			})
+			return
+		}
+		requestLog(c).Error("Failed to delete quarantined measurement", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to discard measurement",
+		})
+		return
+	}
+
+	requestLog(c).Info("Quarantined measurement discarded",
+		zap.String("id", id.String()),
+		zap.String("discarded_by", currentUsername(c)),
+	)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Measurement discarded",
+	})
+}
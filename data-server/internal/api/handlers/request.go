@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"net/http"
+
+	"mark7888/speedtest-data-server/internal/ingest"
+	"mark7888/speedtest-data-server/internal/logger"
+	"mark7888/speedtest-data-server/pkg/models"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// requestLog returns the logger for the request, tagged with its request ID
+func requestLog(c *gin.Context) *zap.Logger {
+	return logger.FromContext(c.Request.Context())
+}
+
+// forbidden responds with 403 Forbidden when err means the API key may not
+// make the request, and reports whether it did
+func forbidden(c *gin.Context, err error) bool {
+	if !ingest.IsDenied(err) {
+		return false
+	}
+
+	c.JSON(http.StatusForbidden, models.ErrorResponse{
+		Error: err.Error(),
+	})
+	return true
+}
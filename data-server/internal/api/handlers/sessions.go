@@ -0,0 +1,210 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"mark7888/speedtest-data-server/internal/api/validators"
+	"mark7888/speedtest-data-server/internal/auth"
+	"mark7888/speedtest-data-server/internal/config"
+	"mark7888/speedtest-data-server/internal/db"
+	"mark7888/speedtest-data-server/pkg/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// maxSessionUserAgent bounds how much of the User-Agent header is kept to
+// tell sessions apart
+const maxSessionUserAgent = 256
+
+// SessionHandler handles logging out and reviewing admin sessions
+type SessionHandler struct {
+	db db.Database
+}
+
+// NewSessionHandler creates a new session handler
+func NewSessionHandler(database db.Database) *SessionHandler {
+	return &SessionHandler{
+		db: database,
+	}
+}
+
+// startSession starts a session for an account that passed every login
+// check and returns its first access token and refresh token
+func startSession(c *gin.Context, database db.Database, jwtManager *auth.JWTManager, cfg *config.Config, username, role, source string) (*models.LoginResponse, error) {
+	refreshToken, err := auth.GenerateRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+
+	userAgent := c.Request.UserAgent()
+	if len(userAgent) > maxSessionUserAgent {
+		userAgent = userAgent[:maxSessionUserAgent]
+	}
+	session, err := database.CreateSession(c.Request.Context(), refreshToken, models.NewSession{
+		Username:  username,
+		Role:      role,
+		Source:    source,
+		UserAgent: userAgent,
+		ClientIP:  c.ClientIP(),
+		ExpiresAt: time.Now().Add(cfg.JWT.SessionLifetime),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	token, expiresAt, err := jwtManager.Generate(username, role, source, session.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.LoginResponse{
+		Token:            token,
+		ExpiresAt:        expiresAt,
+		RefreshToken:     refreshToken,
+		SessionExpiresAt: session.ExpiresAt,
+		Username:         username,
+		Role:             role,
+	}, nil
+}
+
+// currentSessionID returns the session of the authenticated request
+func currentSessionID(c *gin.Context) uuid.UUID {
+	sessionID, _ := c.Get("session_id")
+	id, _ := sessionID.(uuid.UUID)
+	return id
+}
+
+// HandleLogout ends the session of the request's token. Its access tokens
+// and refresh token stop working at once.
+// POST /api/v1/admin/logout
+func (h *SessionHandler) HandleLogout(c *gin.Context) {
+	if err := h.db.RevokeSession(c.Request.Context(), currentSessionID(c)); err != nil {
+		requestLog(c).Error("Failed to revoke session", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to log out",
+		})
+		return
+	}
+
+	requestLog(c).Info("Admin logout", zap.String("username", currentUsername(c)))
+
+	c.Status(http.StatusNoContent)
+}
+
+// HandleLogoutAll ends every session of the authenticated user, this one
+// included
+// POST /api/v1/admin/logout-all
+func (h *SessionHandler) HandleLogoutAll(c *gin.Context) {
+	username := currentUsername(c)
+	revoked, err := h.db.RevokeUserSessions(c.Request.Context(), username)
+	if err != nil {
+		requestLog(c).Error("Failed to revoke sessions", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to log out",
+		})
+		return
+	}
+
+	requestLog(c).Info("Admin logged out of all sessions",
+		zap.String("username", username),
+		zap.Int64("sessions", revoked),
+	)
+
+	c.Status(http.StatusNoContent)
+}
+
+// HandleListMySessions lists the authenticated user's active sessions
+// GET /api/v1/admin/me/sessions
+func (h *SessionHandler) HandleListMySessions(c *gin.Context) {
+	h.listSessions(c, currentUsername(c))
+}
+
+// HandleListSessions lists the active sessions of all users, or of the user
+// in the username query parameter
+// GET /api/v1/admin/sessions
+func (h *SessionHandler) HandleListSessions(c *gin.Context) {
+	h.listSessions(c, c.Query("username"))
+}
+
+// listSessions responds with the active sessions of username, or of all
+// users if it is empty
+func (h *SessionHandler) listSessions(c *gin.Context, username string) {
+	sessions, err := h.db.GetActiveSessions(c.Request.Context(), username)
+	if err != nil {
+		requestLog(c).Error("Failed to get sessions", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to retrieve sessions",
+		})
+		return
+	}
+
+	current := currentSessionID(c)
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == current
+	}
+
+	c.JSON(http.StatusOK, models.ListSessionsResponse{
+		Sessions: sessions,
+		Total:    len(sessions),
+	})
+}
+
+// HandleRevokeMySession ends one of the authenticated user's sessions, such
+// as one on a lost device
+// DELETE /api/v1/admin/me/sessions/:id
+func (h *SessionHandler) HandleRevokeMySession(c *gin.Context) {
+	h.revokeSession(c, true)
+}
+
+// HandleRevokeSession ends any user's session
+// DELETE /api/v1/admin/sessions/:id
+func (h *SessionHandler) HandleRevokeSession(c *gin.Context) {
+	h.revokeSession(c, false)
+}
+
+// revokeSession ends the session in the id parameter. With ownOnly,
+// sessions of other users are not found.
+func (h *SessionHandler) revokeSession(c *gin.Context, ownOnly bool) {
+	sessionID, err := validators.ValidateUUID(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Invalid session ID",
+		})
+		return
+	}
+
+	session, err := h.db.GetSession(c.Request.Context(), sessionID)
+	if err == nil && ownOnly && session.Username != currentUsername(c) {
+		err = fmt.Errorf("session not found")
+	}
+	if err == nil {
+		err = h.db.RevokeSession(c.Request.Context(), sessionID)
+	}
+	if err != nil {
+		// Sessions that already ended count as not found
+		if strings.Contains(err.Error(), "not found") {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{
+				Error: "Session not found",
+			})
+			return
+		}
+		requestLog(c).Error("Failed to revoke session", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to revoke session",
+		})
+		return
+	}
+
+	requestLog(c).Info("Session revoked",
+		zap.String("id", sessionID.String()),
+		zap.String("username", session.Username),
+		zap.String("revoked_by", currentUsername(c)),
+	)
+
+	c.Status(http.StatusNoContent)
+}
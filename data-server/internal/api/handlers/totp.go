@@ -0,0 +1,306 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"mark7888/speedtest-data-server/internal/api/validators"
+	"mark7888/speedtest-data-server/internal/auth"
+	"mark7888/speedtest-data-server/internal/db"
+	"mark7888/speedtest-data-server/pkg/models"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// HandleStartTOTP starts setting up two-factor authentication for the
+// authenticated user. The new secret is used once HandleConfirmTOTP
+// verifies a code from it; until then logins need the password only.
+// POST /api/v1/admin/me/totp
+func (h *UserHandler) HandleStartTOTP(c *gin.Context) {
+	user, ok := h.localUser(c, "sets its TOTP secret with ADMIN_TOTP_SECRET")
+	if !ok {
+		return
+	}
+	if user.TOTPEnabled {
+		c.JSON(http.StatusConflict, models.ErrorResponse{
+			Error: "Two-factor authentication is already enabled",
+		})
+		return
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		requestLog(c).Error("Failed to generate TOTP secret", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to set up two-factor authentication",
+		})
+		return
+	}
+	if err := h.db.SetUserTOTPSecret(c.Request.Context(), user.ID, secret); err != nil {
+		requestLog(c).Error("Failed to store TOTP secret", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to set up two-factor authentication",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.TOTPEnrollmentResponse{
+		Secret: secret,
+		URI:    auth.TOTPURI(h.config.Admin.TOTPIssuer, user.Username, secret),
+	})
+}
+
+// HandleConfirmTOTP enables two-factor authentication once the user proves
+// their authenticator has the secret, and returns their recovery codes
+// POST /api/v1/admin/me/totp/confirm
+func (h *UserHandler) HandleConfirmTOTP(c *gin.Context) {
+	var req models.TOTPCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "Invalid request body",
+			Details: err.Error(),
+		})
+		return
+	}
+
+	user, ok := h.localUser(c, "sets its TOTP secret with ADMIN_TOTP_SECRET")
+	if !ok {
+		return
+	}
+	if user.TOTPEnabled {
+		c.JSON(http.StatusConflict, models.ErrorResponse{
+			Error: "Two-factor authentication is already enabled",
+		})
+		return
+	}
+
+	secret, err := h.db.GetUserTOTPSecret(c.Request.Context(), user.ID)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Error: "Start setting up two-factor authentication first",
+			})
+			return
+		}
+		requestLog(c).Error("Failed to get TOTP secret", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to enable two-factor authentication",
+		})
+		return
+	}
+
+	step, ok := auth.VerifyTOTP(secret, strings.TrimSpace(req.Code), time.Now())
+	if !ok {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Invalid code, check that the authenticator's clock is correct",
+		})
+		return
+	}
+
+	recoveryCodes, err := auth.GenerateRecoveryCodes()
+	if err != nil {
+		requestLog(c).Error("Failed to generate recovery codes", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to enable two-factor authentication",
+		})
+		return
+	}
+	if err := h.db.EnableUserTOTP(c.Request.Context(), user.ID, step, recoveryCodes); err != nil {
+		requestLog(c).Error("Failed to enable TOTP", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to enable two-factor authentication",
+		})
+		return
+	}
+
+	requestLog(c).Info("Two-factor authentication enabled", zap.String("username", user.Username))
+
+	c.JSON(http.StatusOK, models.RecoveryCodesResponse{
+		RecoveryCodes: recoveryCodes,
+	})
+}
+
+// HandleDisableTOTP turns off two-factor authentication for the
+// authenticated user, who confirms with a TOTP code or a recovery code
+// POST /api/v1/admin/me/totp/disable
+func (h *UserHandler) HandleDisableTOTP(c *gin.Context) {
+	var req models.TOTPCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "Invalid request body",
+			Details: err.Error(),
+		})
+		return
+	}
+
+	user, ok := h.localUser(c, "sets its TOTP secret with ADMIN_TOTP_SECRET")
+	if !ok {
+		return
+	}
+	if !user.TOTPEnabled {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Two-factor authentication is not enabled",
+		})
+		return
+	}
+
+	if _, ok := verifyUserCode(c, h.db, user, req.Code, true, time.Now()); !ok {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Error: "Invalid code",
+		})
+		return
+	}
+
+	if err := h.db.DisableUserTOTP(c.Request.Context(), user.ID); err != nil {
+		requestLog(c).Error("Failed to disable TOTP", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to disable two-factor authentication",
+		})
+		return
+	}
+
+	requestLog(c).Info("Two-factor authentication disabled", zap.String("username", user.Username))
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Two-factor authentication disabled",
+	})
+}
+
+// HandleRegenerateRecoveryCodes replaces the authenticated user's recovery
+// codes, confirmed with a TOTP code
+// POST /api/v1/admin/me/recovery-codes
+func (h *UserHandler) HandleRegenerateRecoveryCodes(c *gin.Context) {
+	var req models.TOTPCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "Invalid request body",
+			Details: err.Error(),
+		})
+		return
+	}
+
+	user, ok := h.localUser(c, "has no recovery codes")
+	if !ok {
+		return
+	}
+	if !user.TOTPEnabled {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Two-factor authentication is not enabled",
+		})
+		return
+	}
+
+	if _, ok := verifyUserCode(c, h.db, user, req.Code, false, time.Now()); !ok {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Error: "Invalid code",
+		})
+		return
+	}
+
+	recoveryCodes, err := auth.GenerateRecoveryCodes()
+	if err != nil {
+		requestLog(c).Error("Failed to generate recovery codes", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to replace recovery codes",
+		})
+		return
+	}
+	if err := h.db.ReplaceRecoveryCodes(c.Request.Context(), user.ID, recoveryCodes); err != nil {
+		requestLog(c).Error("Failed to replace recovery codes", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to replace recovery codes",
+		})
+		return
+	}
+
+	requestLog(c).Info("Recovery codes replaced", zap.String("username", user.Username))
+
+	c.JSON(http.StatusOK, models.RecoveryCodesResponse{
+		RecoveryCodes: recoveryCodes,
+	})
+}
+
+// HandleResetUserTOTP turns off two-factor authentication for a user who
+// lost their authenticator and recovery codes
+// DELETE /api/v1/admin/users/:id/totp
+func (h *UserHandler) HandleResetUserTOTP(c *gin.Context) {
+	userID, err := validators.ValidateUUID(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Invalid user ID",
+		})
+		return
+	}
+
+	if err := h.db.DisableUserTOTP(c.Request.Context(), userID); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{
+				Error: "User not found",
+			})
+			return
+		}
+		requestLog(c).Error("Failed to reset TOTP", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to reset two-factor authentication",
+		})
+		return
+	}
+
+	requestLog(c).Info("Two-factor authentication reset",
+		zap.String("id", userID.String()),
+		zap.String("reset_by", currentUsername(c)),
+	)
+
+	c.Status(http.StatusNoContent)
+}
+
+// verifyUserCode checks a TOTP code, or if allowRecovery a recovery code,
+// for a user with two-factor authentication. Each code is accepted once. It
+// returns how many recovery codes are left if one was used.
+func verifyUserCode(c *gin.Context, database db.Database, user *models.User, code string, allowRecovery bool, now time.Time) (*int, bool) {
+	if !user.TOTPEnabled {
+		return nil, false
+	}
+	ctx := c.Request.Context()
+	code = strings.TrimSpace(code)
+
+	if auth.IsTOTPCode(code) {
+		secret, err := database.GetUserTOTPSecret(ctx, user.ID)
+		if err != nil {
+			requestLog(c).Error("Failed to get TOTP secret", zap.Error(err))
+			return nil, false
+		}
+		step, ok := auth.VerifyTOTP(secret, code, now)
+		if !ok {
+			return nil, false
+		}
+		if err := database.UseUserTOTPStep(ctx, user.ID, step); err != nil {
+			if !strings.Contains(err.Error(), "already used") {
+				requestLog(c).Error("Failed to record TOTP code", zap.Error(err))
+			}
+			return nil, false
+		}
+		return nil, true
+	}
+
+	if !allowRecovery {
+		return nil, false
+	}
+	if err := database.UseRecoveryCode(ctx, user.ID, code); err != nil {
+		if !strings.Contains(err.Error(), "not found") {
+			requestLog(c).Error("Failed to use recovery code", zap.Error(err))
+		}
+		return nil, false
+	}
+
+	requestLog(c).Warn("Recovery code used", zap.String("username", user.Username))
+
+	remaining, err := database.CountRecoveryCodes(ctx, user.ID)
+	if err != nil {
+		requestLog(c).Warn("Failed to count recovery codes", zap.Error(err))
+		return nil, true
+	}
+	return &remaining, true
+}
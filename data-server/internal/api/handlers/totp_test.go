@@ -0,0 +1,284 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"mark7888/speedtest-data-server/internal/api/middleware"
+	"mark7888/speedtest-data-server/internal/auth"
+	"mark7888/speedtest-data-server/internal/config"
+	"mark7888/speedtest-data-server/internal/db/sqlite"
+	"mark7888/speedtest-data-server/internal/logger"
+	"mark7888/speedtest-data-server/pkg/models"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// newTOTPTestRouter serves the login, account and user management routes,
+// with an admin account "admin" from the configuration and a stored
+// operator "alice"
+func newTOTPTestRouter(t *testing.T, adminTOTPSecret string) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	logger.Log = zap.NewNop()
+
+	cfg := &config.Config{}
+	cfg.Database.Path = filepath.Join(t.TempDir(), "test.db")
+	cfg.APIKeys.Secret = "test-secret"
+	cfg.Admin.Username = "admin"
+	cfg.Admin.Password = "admin-password"
+	cfg.Admin.TOTPSecret = adminTOTPSecret
+	cfg.Admin.TOTPIssuer = "Speedtest Monitor"
+	cfg.JWT.SessionLifetime = time.Hour
+
+	database, err := sqlite.New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close() })
+	if err := database.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	passwordHash, err := auth.HashPassword("alice-password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := database.CreateUser(context.Background(), models.NewUser{Username: "alice", PasswordHash: passwordHash, Role: models.UserRoleOperator}); err != nil {
+		t.Fatal(err)
+	}
+
+	jwtManager := auth.NewJWTManager("test-secret", time.Hour)
+	adminHandler := NewAdminHandler(database, jwtManager, cfg, nil)
+	userHandler := NewUserHandler(database, cfg)
+
+	router := gin.New()
+	router.POST("/api/v1/admin/login", adminHandler.HandleLogin)
+	router.POST("/api/v1/admin/login/mfa", adminHandler.HandleLoginMFA)
+	protected := router.Group("/api/v1/admin", middleware.JWTAuth(jwtManager, database))
+	protected.GET("/me", userHandler.HandleGetCurrentUser)
+	protected.POST("/me/totp", userHandler.HandleStartTOTP)
+	protected.POST("/me/totp/confirm", userHandler.HandleConfirmTOTP)
+	protected.POST("/me/totp/disable", userHandler.HandleDisableTOTP)
+	protected.POST("/me/recovery-codes", userHandler.HandleRegenerateRecoveryCodes)
+	protected.GET("/users", userHandler.HandleListUsers)
+	protected.PATCH("/users/:id", userHandler.HandleUpdateUser)
+
+	return router
+}
+
+// request sends a JSON request and decodes the response into out, if set
+func request(t *testing.T, router *gin.Engine, method, path, token string, body, out interface{}) int {
+	t.Helper()
+
+	var reader *bytes.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = bytes.NewReader(data)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if out != nil && w.Code < 300 {
+		if err := json.Unmarshal(w.Body.Bytes(), out); err != nil {
+			t.Fatalf("%s %s: %v: %s", method, path, err, w.Body.String())
+		}
+	}
+	return w.Code
+}
+
+// totpCode returns the code of secret for a time step
+func totpCode(t *testing.T, secret string, step int64) string {
+	t.Helper()
+	code, err := auth.TOTPCode(secret, step)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+// login starts a login and returns the MFA token, or "" if the password
+// alone was enough
+func login(t *testing.T, router *gin.Engine, username, password string) string {
+	t.Helper()
+
+	var resp struct {
+		Token       string `json:"token"`
+		MFARequired bool   `json:"mfa_required"`
+		MFAToken    string `json:"mfa_token"`
+	}
+	if code := request(t, router, http.MethodPost, "/api/v1/admin/login", "", models.LoginRequest{Username: username, Password: password}, &resp); code != http.StatusOK {
+		t.Fatalf("login returned %d", code)
+	}
+	if resp.MFARequired {
+		if resp.Token != "" {
+			t.Fatal("login returned a session token with the MFA challenge")
+		}
+		return resp.MFAToken
+	}
+	if resp.Token == "" {
+		t.Fatal("login returned neither a token nor an MFA challenge")
+	}
+	return ""
+}
+
+func TestTOTPLogin(t *testing.T) {
+	router := newTOTPTestRouter(t, "")
+
+	var session models.LoginResponse
+	request(t, router, http.MethodPost, "/api/v1/admin/login", "", models.LoginRequest{Username: "alice", Password: "alice-password"}, &session)
+	token := session.Token
+
+	// Enrollment takes effect once a code is confirmed
+	var enrollment models.TOTPEnrollmentResponse
+	if code := request(t, router, http.MethodPost, "/api/v1/admin/me/totp", token, nil, &enrollment); code != http.StatusOK {
+		t.Fatalf("start enrollment returned %d", code)
+	}
+	if !strings.HasPrefix(enrollment.URI, "otpauth://totp/Speedtest%20Monitor:alice?") {
+		t.Errorf("URI = %s", enrollment.URI)
+	}
+	if mfaToken := login(t, router, "alice", "alice-password"); mfaToken != "" {
+		t.Error("unconfirmed TOTP required at login")
+	}
+	if code := request(t, router, http.MethodPost, "/api/v1/admin/me/totp/confirm", token, models.TOTPCodeRequest{Code: "000000"}, nil); code != http.StatusBadRequest {
+		t.Errorf("confirm with a wrong code returned %d, want 400", code)
+	}
+
+	// Codes are picked by step rather than time, so the test passes however
+	// the periods fall
+	step := auth.TOTPStep(time.Now())
+	var recovery models.RecoveryCodesResponse
+	if code := request(t, router, http.MethodPost, "/api/v1/admin/me/totp/confirm", token, models.TOTPCodeRequest{Code: totpCode(t, enrollment.Secret, step)}, &recovery); code != http.StatusOK {
+		t.Fatalf("confirm returned %d", code)
+	}
+	if len(recovery.RecoveryCodes) != auth.RecoveryCodeCount {
+		t.Fatalf("got %d recovery codes", len(recovery.RecoveryCodes))
+	}
+	if code := request(t, router, http.MethodPost, "/api/v1/admin/me/totp", token, nil, nil); code != http.StatusConflict {
+		t.Errorf("enrolling again returned %d, want 409", code)
+	}
+
+	t.Run("pre-authentication token", func(t *testing.T) {
+		mfaToken := login(t, router, "alice", "alice-password")
+		if mfaToken == "" {
+			t.Fatal("login did not ask for a code")
+		}
+		if code := request(t, router, http.MethodGet, "/api/v1/admin/me", mfaToken, nil, nil); code != http.StatusUnauthorized {
+			t.Errorf("pre-authentication token opened /me with %d", code)
+		}
+	})
+
+	t.Run("TOTP code", func(t *testing.T) {
+		// The code confirming enrollment was used already
+		mfaToken := login(t, router, "alice", "alice-password")
+		if code := request(t, router, http.MethodPost, "/api/v1/admin/login/mfa", "", models.MFALoginRequest{MFAToken: mfaToken, Code: totpCode(t, enrollment.Secret, step)}, nil); code != http.StatusUnauthorized {
+			t.Errorf("reused code returned %d, want 401", code)
+		}
+
+		var resp models.LoginResponse
+		next := totpCode(t, enrollment.Secret, step+1)
+		if code := request(t, router, http.MethodPost, "/api/v1/admin/login/mfa", "", models.MFALoginRequest{MFAToken: mfaToken, Code: next}, &resp); code != http.StatusOK {
+			t.Fatalf("login with a code returned %d", code)
+		}
+		if resp.Role != models.UserRoleOperator || resp.RecoveryCodesRemaining != nil {
+			t.Errorf("login response = %+v", resp)
+		}
+
+		// Neither the code nor the pre-authentication token works twice
+		if code := request(t, router, http.MethodPost, "/api/v1/admin/login/mfa", "", models.MFALoginRequest{MFAToken: mfaToken, Code: next}, nil); code != http.StatusUnauthorized {
+			t.Errorf("second use returned %d, want 401", code)
+		}
+		mfaToken = login(t, router, "alice", "alice-password")
+		if code := request(t, router, http.MethodPost, "/api/v1/admin/login/mfa", "", models.MFALoginRequest{MFAToken: mfaToken, Code: next}, nil); code != http.StatusUnauthorized {
+			t.Errorf("reused code returned %d, want 401", code)
+		}
+	})
+
+	t.Run("recovery code", func(t *testing.T) {
+		mfaToken := login(t, router, "alice", "alice-password")
+		var resp models.LoginResponse
+		if code := request(t, router, http.MethodPost, "/api/v1/admin/login/mfa", "", models.MFALoginRequest{MFAToken: mfaToken, Code: strings.ToUpper(recovery.RecoveryCodes[0])}, &resp); code != http.StatusOK {
+			t.Fatalf("login with a recovery code returned %d", code)
+		}
+		if resp.RecoveryCodesRemaining == nil || *resp.RecoveryCodesRemaining != auth.RecoveryCodeCount-1 {
+			t.Errorf("recovery codes remaining = %v, want %d", resp.RecoveryCodesRemaining, auth.RecoveryCodeCount-1)
+		}
+
+		mfaToken = login(t, router, "alice", "alice-password")
+		if code := request(t, router, http.MethodPost, "/api/v1/admin/login/mfa", "", models.MFALoginRequest{MFAToken: mfaToken, Code: recovery.RecoveryCodes[0]}, nil); code != http.StatusUnauthorized {
+			t.Errorf("reused recovery code returned %d, want 401", code)
+		}
+	})
+
+	t.Run("attempts are limited", func(t *testing.T) {
+		mfaToken := login(t, router, "alice", "alice-password")
+		for i := 0; i < maxMFAAttempts; i++ {
+			request(t, router, http.MethodPost, "/api/v1/admin/login/mfa", "", models.MFALoginRequest{MFAToken: mfaToken, Code: "000000"}, nil)
+		}
+		if code := request(t, router, http.MethodPost, "/api/v1/admin/login/mfa", "", models.MFALoginRequest{MFAToken: mfaToken, Code: recovery.RecoveryCodes[1]}, nil); code != http.StatusUnauthorized {
+			t.Errorf("valid code after too many attempts returned %d, want 401", code)
+		}
+	})
+
+	var me models.CurrentUserResponse
+	request(t, router, http.MethodGet, "/api/v1/admin/me", token, nil, &me)
+	if !me.TOTPEnabled || me.RecoveryCodesRemaining != auth.RecoveryCodeCount-1 {
+		t.Errorf("/me = %+v, want TOTP enabled with %d recovery codes", me, auth.RecoveryCodeCount-1)
+	}
+
+	if code := request(t, router, http.MethodPost, "/api/v1/admin/me/recovery-codes", token, models.TOTPCodeRequest{Code: recovery.RecoveryCodes[1]}, nil); code != http.StatusUnauthorized {
+		t.Errorf("replacing recovery codes with a recovery code returned %d, want 401", code)
+	}
+	if code := request(t, router, http.MethodPost, "/api/v1/admin/me/totp/disable", token, models.TOTPCodeRequest{Code: recovery.RecoveryCodes[1]}, nil); code != http.StatusOK {
+		t.Fatalf("disable returned %d", code)
+	}
+	if mfaToken := login(t, router, "alice", "alice-password"); mfaToken != "" {
+		t.Error("login still asks for a code after disabling")
+	}
+}
+
+func TestTOTPLoginConfiguredAdmin(t *testing.T) {
+	const secret = "JBSWY3DPEHPK3PXP"
+	router := newTOTPTestRouter(t, secret)
+
+	mfaToken := login(t, router, "admin", "admin-password")
+	if mfaToken == "" {
+		t.Fatal("login did not ask for a code")
+	}
+
+	code := totpCode(t, secret, auth.TOTPStep(time.Now()))
+	var resp models.LoginResponse
+	if status := request(t, router, http.MethodPost, "/api/v1/admin/login/mfa", "", models.MFALoginRequest{MFAToken: mfaToken, Code: code}, &resp); status != http.StatusOK {
+		t.Fatalf("login with a code returned %d", status)
+	}
+	if resp.Role != models.UserRoleAdmin {
+		t.Errorf("role = %s, want admin", resp.Role)
+	}
+
+	mfaToken = login(t, router, "admin", "admin-password")
+	if status := request(t, router, http.MethodPost, "/api/v1/admin/login/mfa", "", models.MFALoginRequest{MFAToken: mfaToken, Code: code}, nil); status != http.StatusUnauthorized {
+		t.Errorf("reused code returned %d, want 401", status)
+	}
+
+	// Its secret is managed in the configuration
+	if status := request(t, router, http.MethodPost, "/api/v1/admin/me/totp", resp.Token, nil, nil); status != http.StatusBadRequest {
+		t.Errorf("enrollment returned %d, want 400", status)
+	}
+}
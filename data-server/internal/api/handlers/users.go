@@ -0,0 +1,368 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"mark7888/speedtest-data-server/internal/api/validators"
+	"mark7888/speedtest-data-server/internal/auth"
+	"mark7888/speedtest-data-server/internal/config"
+	"mark7888/speedtest-data-server/internal/db"
+	"mark7888/speedtest-data-server/pkg/models"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// UserHandler handles admin API user accounts
+type UserHandler struct {
+	db     db.Database
+	config *config.Config
+}
+
+// NewUserHandler creates a new user handler
+func NewUserHandler(database db.Database, cfg *config.Config) *UserHandler {
+	return &UserHandler{
+		db:     database,
+		config: cfg,
+	}
+}
+
+// HandleListUsers lists all users. The admin account from the
+// configuration is not among them.
+// GET /api/v1/admin/users
+func (h *UserHandler) HandleListUsers(c *gin.Context) {
+	users, err := h.db.GetAllUsers(c.Request.Context())
+	if err != nil {
+		requestLog(c).Error("Failed to get users", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to retrieve users",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.ListUsersResponse{
+		Users: users,
+		Total: len(users),
+	})
+}
+
+// HandleCreateUser creates a new user
+// POST /api/v1/admin/users
+func (h *UserHandler) HandleCreateUser(c *gin.Context) {
+	var req models.CreateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "Invalid request body",
+			Details: err.Error(),
+		})
+		return
+	}
+
+	// The configured admin logs in before any user with the same name could
+	if req.Username == h.config.Admin.Username {
+		c.JSON(http.StatusConflict, models.ErrorResponse{
+			Error: "Username is reserved for the admin account from the server configuration",
+		})
+		return
+	}
+
+	passwordHash, err := auth.HashPassword(req.Password)
+	if err != nil {
+		requestLog(c).Error("Failed to hash password", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to create user",
+		})
+		return
+	}
+
+	createdBy := currentUsername(c)
+	user, err := h.db.CreateUser(c.Request.Context(), models.NewUser{
+		Username:     req.Username,
+		PasswordHash: passwordHash,
+		Role:         req.Role,
+		CreatedBy:    createdBy,
+	})
+	if err != nil {
+		if strings.Contains(err.Error(), "already exists") {
+			c.JSON(http.StatusConflict, models.ErrorResponse{
+				Error: "Username already exists",
+			})
+			return
+		}
+		requestLog(c).Error("Failed to create user", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to create user",
+		})
+		return
+	}
+
+	requestLog(c).Info("User created",
+		zap.String("id", user.ID.String()),
+		zap.String("username", user.Username),
+		zap.String("role", user.Role),
+		zap.String("created_by", createdBy),
+	)
+
+	c.JSON(http.StatusCreated, user)
+}
+
+// HandleUpdateUser changes a user's role, password or enabled status.
+// Changing the role, disabling the user or setting their password ends
+// their sessions, so that no token keeps the old access until it expires.
+// PATCH /api/v1/admin/users/:id
+func (h *UserHandler) HandleUpdateUser(c *gin.Context) {
+	userID, err := validators.ValidateUUID(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Invalid user ID",
+		})
+		return
+	}
+
+	var req models.UpdateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "Invalid request body",
+			Details: err.Error(),
+		})
+		return
+	}
+	if req.Role == nil && req.Password == nil && req.Enabled == nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Nothing to update: set role, password or enabled",
+		})
+		return
+	}
+
+	// The role being replaced decides whether sessions must end
+	var previousRole string
+	if req.Role != nil {
+		previous, err := h.db.GetUserByID(c.Request.Context(), userID)
+		if err != nil {
+			if strings.Contains(err.Error(), "not found") {
+				c.JSON(http.StatusNotFound, models.ErrorResponse{
+					Error: "User not found",
+				})
+				return
+			}
+			requestLog(c).Error("Failed to get user", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+				Error: "Failed to update user",
+			})
+			return
+		}
+		previousRole = previous.Role
+	}
+
+	update := models.UserUpdate{
+		Role:    req.Role,
+		Enabled: req.Enabled,
+	}
+	if req.Password != nil {
+		passwordHash, err := auth.HashPassword(*req.Password)
+		if err != nil {
+			requestLog(c).Error("Failed to hash password", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+				Error: "Failed to update user",
+			})
+			return
+		}
+		update.PasswordHash = &passwordHash
+	}
+
+	user, err := h.db.UpdateUser(c.Request.Context(), userID, update)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{
+				Error: "User not found",
+			})
+			return
+		}
+		requestLog(c).Error("Failed to update user", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to update user",
+		})
+		return
+	}
+
+	if req.Password != nil || !user.Enabled || (req.Role != nil && user.Role != previousRole) {
+		h.endSessions(c, user.Username)
+	}
+
+	requestLog(c).Info("User updated",
+		zap.String("id", user.ID.String()),
+		zap.String("username", user.Username),
+		zap.String("role", user.Role),
+		zap.Bool("enabled", user.Enabled),
+		zap.Bool("password_changed", req.Password != nil),
+		zap.String("updated_by", currentUsername(c)),
+	)
+
+	c.JSON(http.StatusOK, user)
+}
+
+// HandleDeleteUser deletes a user and ends their sessions
+// DELETE /api/v1/admin/users/:id
+func (h *UserHandler) HandleDeleteUser(c *gin.Context) {
+	userID, err := validators.ValidateUUID(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Invalid user ID",
+		})
+		return
+	}
+
+	user, err := h.db.GetUserByID(c.Request.Context(), userID)
+	if err == nil {
+		err = h.db.DeleteUser(c.Request.Context(), userID)
+	}
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{
+				Error: "User not found",
+			})
+			return
+		}
+		requestLog(c).Error("Failed to delete user", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to delete user",
+		})
+		return
+	}
+
+	h.endSessions(c, user.Username)
+
+	requestLog(c).Info("User deleted",
+		zap.String("id", userID.String()),
+		zap.String("username", user.Username),
+		zap.String("deleted_by", currentUsername(c)),
+	)
+
+	c.Status(http.StatusNoContent)
+}
+
+// HandleGetCurrentUser describes the authenticated user
+// GET /api/v1/admin/me
+func (h *UserHandler) HandleGetCurrentUser(c *gin.Context) {
+	username := currentUsername(c)
+	singleSignOn := c.GetString("auth_source") == auth.SourceOIDC
+	resp := models.CurrentUserResponse{
+		Username:     username,
+		Role:         c.GetString("role"),
+		Bootstrap:    username == h.config.Admin.Username && !singleSignOn,
+		SingleSignOn: singleSignOn,
+	}
+
+	switch {
+	case resp.Bootstrap:
+		resp.TOTPEnabled = h.config.Admin.TOTPSecret != ""
+	case !singleSignOn:
+		user, err := h.db.GetUserByUsername(c.Request.Context(), username)
+		if err != nil {
+			requestLog(c).Error("Failed to get user", zap.Error(err))
+			break
+		}
+		resp.TOTPEnabled = user.TOTPEnabled
+		if user.TOTPEnabled {
+			if resp.RecoveryCodesRemaining, err = h.db.CountRecoveryCodes(c.Request.Context(), user.ID); err != nil {
+				requestLog(c).Error("Failed to count recovery codes", zap.Error(err))
+			}
+		}
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// HandleChangePassword lets a user change their own password. The admin
+// account from the configuration has its password set there instead, and
+// single sign-on users at their identity provider.
+// PUT /api/v1/admin/me/password
+func (h *UserHandler) HandleChangePassword(c *gin.Context) {
+	var req models.ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "Invalid request body",
+			Details: err.Error(),
+		})
+		return
+	}
+
+	user, ok := h.localUser(c, "sets its password with ADMIN_PASSWORD")
+	if !ok {
+		return
+	}
+	if !auth.VerifyPassword(req.CurrentPassword, user.PasswordHash) {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Error: "Current password is incorrect",
+		})
+		return
+	}
+
+	passwordHash, err := auth.HashPassword(req.NewPassword)
+	if err != nil {
+		requestLog(c).Error("Failed to hash password", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to change password",
+		})
+		return
+	}
+	if _, err := h.db.UpdateUser(c.Request.Context(), user.ID, models.UserUpdate{PasswordHash: &passwordHash}); err != nil {
+		requestLog(c).Error("Failed to change password", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to change password",
+		})
+		return
+	}
+
+	requestLog(c).Info("Password changed", zap.String("username", user.Username))
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Password changed successfully",
+	})
+}
+
+// endSessions signs a user out everywhere after an admin changed their
+// access. A failure is logged and does not undo the change.
+func (h *UserHandler) endSessions(c *gin.Context, username string) {
+	if _, err := h.db.RevokeUserSessions(c.Request.Context(), username); err != nil {
+		requestLog(c).Error("Failed to revoke sessions", zap.String("username", username), zap.Error(err))
+	}
+}
+
+// localUser looks up the authenticated user for a change to their own
+// account, which only users stored here can make. Otherwise it responds
+// with why not; bootstrapHint tells what the admin account from the
+// configuration does instead.
+func (h *UserHandler) localUser(c *gin.Context, bootstrapHint string) (*models.User, bool) {
+	if c.GetString("auth_source") == auth.SourceOIDC {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Single sign-on accounts are managed at the identity provider",
+		})
+		return nil, false
+	}
+
+	username := currentUsername(c)
+	if username == h.config.Admin.Username {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "The admin account from the server configuration " + bootstrapHint,
+		})
+		return nil, false
+	}
+
+	user, err := h.db.GetUserByUsername(c.Request.Context(), username)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+				Error: "Account no longer exists",
+			})
+			return nil, false
+		}
+		requestLog(c).Error("Failed to get user", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to get account",
+		})
+		return nil, false
+	}
+	return user, true
+}
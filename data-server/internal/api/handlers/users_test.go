@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"mark7888/speedtest-data-server/pkg/models"
+)
+
+func TestUpdateUserRoleEndsSessions(t *testing.T) {
+	router := newTOTPTestRouter(t, "")
+
+	session := func(username, password string) string {
+		t.Helper()
+		var resp models.LoginResponse
+		if code := request(t, router, http.MethodPost, "/api/v1/admin/login", "", models.LoginRequest{Username: username, Password: password}, &resp); code != http.StatusOK {
+			t.Fatalf("login as %s returned %d", username, code)
+		}
+		return resp.Token
+	}
+	adminToken := session("admin", "admin-password")
+	aliceToken := session("alice", "alice-password")
+
+	var users models.ListUsersResponse
+	if code := request(t, router, http.MethodGet, "/api/v1/admin/users", adminToken, nil, &users); code != http.StatusOK || len(users.Users) != 1 {
+		t.Fatalf("list users returned %d, %+v", code, users)
+	}
+	path := "/api/v1/admin/users/" + users.Users[0].ID.String()
+
+	// Setting the role alice already has changes nothing
+	operator := models.UserRoleOperator
+	if code := request(t, router, http.MethodPatch, path, adminToken, models.UpdateUserRequest{Role: &operator}, nil); code != http.StatusOK {
+		t.Fatalf("update returned %d", code)
+	}
+	if code := request(t, router, http.MethodGet, "/api/v1/admin/me", aliceToken, nil, nil); code != http.StatusOK {
+		t.Fatalf("session after setting the same role returned %d, want 200", code)
+	}
+
+	viewer := models.UserRoleViewer
+	var updated models.User
+	if code := request(t, router, http.MethodPatch, path, adminToken, models.UpdateUserRequest{Role: &viewer}, &updated); code != http.StatusOK || updated.Role != viewer {
+		t.Fatalf("downgrade returned %d, role %q", code, updated.Role)
+	}
+	if code := request(t, router, http.MethodGet, "/api/v1/admin/me", aliceToken, nil, nil); code != http.StatusUnauthorized {
+		t.Errorf("session after the role changed returned %d, want 401", code)
+	}
+
+	// A new session carries the new role
+	var me models.CurrentUserResponse
+	request(t, router, http.MethodGet, "/api/v1/admin/me", session("alice", "alice-password"), nil, &me)
+	if me.Role != viewer {
+		t.Errorf("role after logging in again = %q, want %q", me.Role, viewer)
+	}
+}
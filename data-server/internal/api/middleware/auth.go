@@ -3,6 +3,7 @@ package middleware
 import (
 	"net/http"
 	"strings"
+	"time"
 
 	"mark7888/speedtest-data-server/internal/auth"
 	"mark7888/speedtest-data-server/internal/db"
@@ -10,12 +11,37 @@ import (
 	"mark7888/speedtest-data-server/pkg/models"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"go.uber.org/zap"
 )
 
-// APIKeyAuth middleware validates API keys for node endpoints
+// APIKeyAuth middleware validates API keys for node endpoints. A node that
+// presented a client certificate verified by the TLS handshake is
+// authenticated by it instead and needs no key, as is a request that
+// SignedRequestAuth already verified.
 func APIKeyAuth(database db.Database) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if _, signed := c.Get("api_key"); signed {
+			c.Next()
+			return
+		}
+
+		cert, err := auth.NodeCertificateFromTLS(c.Request.TLS)
+		if err != nil {
+			logger.FromContext(c.Request.Context()).Warn("Invalid client certificate", zap.Error(err))
+			c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+				Error: "Invalid client certificate",
+			})
+			c.Abort()
+			return
+		}
+		if cert != nil {
+			c.Set("node_certificate", cert)
+			c.Request = c.Request.WithContext(auth.WithNodeCertificate(c.Request.Context(), cert))
+			c.Next()
+			return
+		}
+
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
 			c.JSON(http.StatusUnauthorized, models.ErrorResponse{
@@ -38,9 +64,9 @@ func APIKeyAuth(database db.Database) gin.HandlerFunc {
 		token := parts[1]
 
 		// Verify API key
-		apiKey, err := database.VerifyAPIKey(token)
+		apiKey, err := database.VerifyAPIKey(c.Request.Context(), token)
 		if err != nil {
-			logger.Log.Warn("Invalid API key attempt", zap.Error(err))
+			logger.FromContext(c.Request.Context()).Warn("Invalid API key attempt", zap.Error(err))
 			c.JSON(http.StatusUnauthorized, models.ErrorResponse{
 				Error: "Invalid API key",
 			})
@@ -50,12 +76,15 @@ func APIKeyAuth(database db.Database) gin.HandlerFunc {
 
 		// Store API key in context for later use
 		c.Set("api_key", apiKey)
+		c.Request = c.Request.WithContext(auth.WithAPIKey(c.Request.Context(), apiKey))
 		c.Next()
 	}
 }
 
-// JWTAuth middleware validates JWT tokens for admin endpoints
-func JWTAuth(jwtManager *auth.JWTManager) gin.HandlerFunc {
+// JWTAuth middleware validates JWT tokens for admin endpoints, and that the
+// session a token belongs to has not been revoked. Tokens issued before
+// sessions carry none and have to be replaced by logging in again.
+func JWTAuth(jwtManager *auth.JWTManager, database db.Database) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
@@ -81,16 +110,69 @@ func JWTAuth(jwtManager *auth.JWTManager) gin.HandlerFunc {
 		// Validate JWT
 		claims, err := jwtManager.Validate(token)
 		if err != nil {
-			logger.Log.Warn("Invalid JWT attempt", zap.Error(err))
+			logger.FromContext(c.Request.Context()).Warn("Invalid JWT attempt", zap.Error(err))
+			c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+				Error: "Invalid or expired token",
+			})
+			c.Abort()
+			return
+		}
+
+		if !models.ValidUserRole(claims.Role) {
+			c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+				Error: "Invalid or expired token",
+			})
+			c.Abort()
+			return
+		}
+
+		// Check the session is still active, so logging out takes effect
+		// before the token expires
+		sessionID, err := uuid.Parse(claims.SessionID)
+		if err != nil {
 			c.JSON(http.StatusUnauthorized, models.ErrorResponse{
 				Error: "Invalid or expired token",
 			})
 			c.Abort()
 			return
 		}
+		session, err := database.GetSession(c.Request.Context(), sessionID)
+		if err != nil && !strings.Contains(err.Error(), "not found") {
+			logger.FromContext(c.Request.Context()).Error("Failed to get session", zap.Error(err))
+		}
+		if err != nil || !session.Active(time.Now()) || session.Username != claims.Username {
+			c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+				Error: "Session has ended, sign in again",
+			})
+			c.Abort()
+			return
+		}
 
 		// Store claims in context
 		c.Set("username", claims.Username)
+		c.Set("role", claims.Role)
+		c.Set("auth_source", claims.Source)
+		c.Set("session_id", session.ID)
+		c.Next()
+	}
+}
+
+// RequireRole middleware lets a request through only if the authenticated
+// user's role grants role. It must come after JWTAuth.
+func RequireRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !models.RoleAllows(c.GetString("role"), role) {
+			logger.FromContext(c.Request.Context()).Warn("Insufficient role",
+				zap.String("user", c.GetString("username")),
+				zap.String("role", c.GetString("role")),
+				zap.String("required_role", role),
+			)
+			c.JSON(http.StatusForbidden, models.ErrorResponse{
+				Error: "Insufficient permissions",
+			})
+			c.Abort()
+			return
+		}
 		c.Next()
 	}
 }
@@ -0,0 +1,163 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"mark7888/speedtest-data-server/internal/auth"
+	"mark7888/speedtest-data-server/internal/config"
+	"mark7888/speedtest-data-server/internal/db/sqlite"
+	"mark7888/speedtest-data-server/internal/logger"
+	"mark7888/speedtest-data-server/pkg/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// newSessionTestDB returns a migrated database for checking sessions
+func newSessionTestDB(t *testing.T) *sqlite.SQLiteDB {
+	t.Helper()
+
+	cfg := &config.Config{}
+	cfg.Database.Path = filepath.Join(t.TempDir(), "test.db")
+	cfg.APIKeys.Secret = "test-secret"
+
+	database, err := sqlite.New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close() })
+	if err := database.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	return database
+}
+
+// startSession stores a session for username that expires in an hour
+func startSession(t *testing.T, database *sqlite.SQLiteDB, username string) *models.Session {
+	t.Helper()
+
+	refreshToken, err := auth.GenerateRefreshToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, err := database.CreateSession(context.Background(), refreshToken, models.NewSession{
+		Username:  username,
+		Role:      models.UserRoleAdmin,
+		ExpiresAt: time.Now().Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return session
+}
+
+func TestRequireRole(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logger.Log = zap.NewNop()
+
+	database := newSessionTestDB(t)
+	session := startSession(t, database, "user")
+	jwtManager := auth.NewJWTManager("test-secret", time.Hour)
+	router := gin.New()
+	router.Use(JWTAuth(jwtManager, database))
+	router.GET("/dashboard", RequireRole(models.UserRoleViewer), func(c *gin.Context) { c.Status(http.StatusOK) })
+	router.POST("/run-test", RequireRole(models.UserRoleOperator), func(c *gin.Context) { c.Status(http.StatusOK) })
+	router.POST("/api-keys", RequireRole(models.UserRoleAdmin), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	tests := []struct {
+		role string
+		want map[string]int
+	}{
+		{role: models.UserRoleViewer, want: map[string]int{"/dashboard": http.StatusOK, "/run-test": http.StatusForbidden, "/api-keys": http.StatusForbidden}},
+		{role: models.UserRoleOperator, want: map[string]int{"/dashboard": http.StatusOK, "/run-test": http.StatusOK, "/api-keys": http.StatusForbidden}},
+		{role: models.UserRoleAdmin, want: map[string]int{"/dashboard": http.StatusOK, "/run-test": http.StatusOK, "/api-keys": http.StatusOK}},
+		// Tokens from before roles existed have to be replaced
+		{role: "", want: map[string]int{"/dashboard": http.StatusUnauthorized, "/run-test": http.StatusUnauthorized, "/api-keys": http.StatusUnauthorized}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.role, func(t *testing.T) {
+			token, _, err := jwtManager.Generate("user", tt.role, "", session.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for path, want := range tt.want {
+				method := http.MethodPost
+				if path == "/dashboard" {
+					method = http.MethodGet
+				}
+				req := httptest.NewRequest(method, path, nil)
+				req.Header.Set("Authorization", "Bearer "+token)
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, req)
+				if w.Code != want {
+					t.Errorf("%s %s = %d, want %d", method, path, w.Code, want)
+				}
+			}
+		})
+	}
+}
+
+func TestJWTAuthSessions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logger.Log = zap.NewNop()
+
+	database := newSessionTestDB(t)
+	oldManager := auth.NewJWTManager("old-secret", time.Hour)
+	jwtManager := auth.NewJWTManager("new-secret", time.Hour)
+	jwtManager.AcceptPreviousSecrets([]string{"old-secret"})
+
+	router := gin.New()
+	router.GET("/me", JWTAuth(jwtManager, database), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	get := func(token string) int {
+		req := httptest.NewRequest(http.MethodGet, "/me", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+	token := func(manager *auth.JWTManager, username string, sessionID uuid.UUID) string {
+		t.Helper()
+		token, _, err := manager.Generate(username, models.UserRoleAdmin, "", sessionID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+
+	alice := startSession(t, database, "alice")
+	bob := startSession(t, database, "bob")
+
+	if code := get(token(jwtManager, "alice", alice.ID)); code != http.StatusOK {
+		t.Errorf("active session = %d, want 200", code)
+	}
+	if code := get(token(oldManager, "alice", alice.ID)); code != http.StatusOK {
+		t.Errorf("token signed with the previous secret = %d, want 200", code)
+	}
+	if code := get(token(auth.NewJWTManager("other-secret", time.Hour), "alice", alice.ID)); code != http.StatusUnauthorized {
+		t.Errorf("token signed with an unknown secret = %d, want 401", code)
+	}
+	if code := get(token(jwtManager, "alice", bob.ID)); code != http.StatusUnauthorized {
+		t.Errorf("token naming another user's session = %d, want 401", code)
+	}
+	if code := get(token(jwtManager, "alice", uuid.New())); code != http.StatusUnauthorized {
+		t.Errorf("unknown session = %d, want 401", code)
+	}
+
+	if err := database.RevokeSession(context.Background(), alice.ID); err != nil {
+		t.Fatal(err)
+	}
+	if code := get(token(jwtManager, "alice", alice.ID)); code != http.StatusUnauthorized {
+		t.Errorf("revoked session = %d, want 401", code)
+	}
+	if code := get(token(jwtManager, "bob", bob.ID)); code != http.StatusOK {
+		t.Errorf("other session after revoking = %d, want 200", code)
+	}
+}
@@ -0,0 +1,147 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"mark7888/speedtest-data-server/pkg/models"
+
+	ginGzip "github.com/gin-contrib/gzip"
+	"github.com/gin-gonic/gin"
+	"github.com/klauspost/compress/zstd"
+)
+
+// SupportedContentEncodings lists the request body encodings the server can
+// decode, in order of preference. It is advertised to nodes in the alive
+// response so they can compress their sync payloads.
+var SupportedContentEncodings = []string{"zstd", "gzip"}
+
+// zstdMaxWindow is the largest zstd window accepted, the size the zstd
+// format recommends every decoder to support. It bounds the decoder's memory;
+// the decoded body itself is capped by Decompress.
+const zstdMaxWindow = 8 << 20
+
+// errBodyTooLarge is returned when a (decompressed) request body exceeds the limit
+var errBodyTooLarge = errors.New("request body too large")
+
+// LimitBody caps request bodies at maxBytes while they are read. Unlike
+// Decompress it does not buffer anything, so it is cheap enough to run in
+// front of every route.
+func LimitBody(maxBytes int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Body != nil && c.Request.Body != http.NoBody {
+			c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes)
+		}
+		c.Next()
+	}
+}
+
+// Decompress decodes gzip and zstd encoded request bodies.
+// maxBytes caps the size of the body after decompression so that a small
+// compressed payload cannot expand into an arbitrarily large one (zip bomb).
+// The limit also applies to uncompressed bodies. The body is buffered in
+// full, so only mount it on authenticated node routes.
+func Decompress(maxBytes int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Body == nil || c.Request.Body == http.NoBody {
+			c.Next()
+			return
+		}
+
+		encoding := strings.ToLower(strings.TrimSpace(c.GetHeader("Content-Encoding")))
+
+		var reader io.Reader
+		switch encoding {
+		case "", "identity":
+			reader = c.Request.Body
+		case "gzip":
+			gz, err := gzip.NewReader(c.Request.Body)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, models.ErrorResponse{
+					Error:   "Invalid gzip request body",
+					Details: err.Error(),
+				})
+				c.Abort()
+				return
+			}
+			defer gz.Close()
+			reader = gz
+		case "zstd":
+			zr, err := zstd.NewReader(c.Request.Body,
+				zstd.WithDecoderConcurrency(1),
+				zstd.WithDecoderMaxMemory(zstdMaxWindow),
+			)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, models.ErrorResponse{
+					Error:   "Invalid zstd request body",
+					Details: err.Error(),
+				})
+				c.Abort()
+				return
+			}
+			defer zr.Close()
+			reader = zr
+		default:
+			c.JSON(http.StatusUnsupportedMediaType, models.ErrorResponse{
+				Error:   "Unsupported Content-Encoding",
+				Details: "supported encodings: " + strings.Join(SupportedContentEncodings, ", "),
+			})
+			c.Abort()
+			return
+		}
+
+		body, err := readLimited(reader, maxBytes)
+		if errors.Is(err, errBodyTooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, models.ErrorResponse{
+				Error: "Request body too large",
+			})
+			c.Abort()
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Error:   "Failed to read request body",
+				Details: err.Error(),
+			})
+			c.Abort()
+			return
+		}
+
+		// Hand the decoded body to the handlers as if it had been sent uncompressed
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		c.Request.ContentLength = int64(len(body))
+		c.Request.Header.Del("Content-Encoding")
+		c.Next()
+	}
+}
+
+// readLimited reads at most maxBytes from r and fails if more data is available
+func readLimited(r io.Reader, maxBytes int64) ([]byte, error) {
+	body, err := io.ReadAll(io.LimitReader(r, maxBytes+1))
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		// The raw body already hit the LimitBody cap
+		return nil, errBodyTooLarge
+	}
+	if errors.Is(err, zstd.ErrDecoderSizeExceeded) {
+		// The zstd frame declares a size beyond what the decoder accepts
+		return nil, errBodyTooLarge
+	}
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > maxBytes {
+		return nil, errBodyTooLarge
+	}
+	return body, nil
+}
+
+// CompressResponses gzips responses for clients that send Accept-Encoding: gzip.
+// Intended for the admin API, where measurement listings can be large.
+func CompressResponses() gin.HandlerFunc {
+	return ginGzip.Gzip(ginGzip.DefaultCompression)
+}
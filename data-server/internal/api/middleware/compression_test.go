@@ -0,0 +1,146 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/klauspost/compress/zstd"
+)
+
+func gzipBytes(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func zstdBytes(t *testing.T, data []byte) []byte {
+	t.Helper()
+	enc, err := zstd.NewWriter(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer enc.Close()
+	return enc.EncodeAll(data, nil)
+}
+
+// zstdStream encodes like the node does, with a streaming writer whose
+// frames declare the encoder's full window rather than the content size
+func zstdStream(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := zstd.NewWriter(&buf, zstd.WithEncoderLevel(zstd.SpeedBetterCompression))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDecompress(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	const limit = 1024
+	small := bytes.Repeat([]byte("a"), limit)
+	large := bytes.Repeat([]byte("a"), limit+1)
+	// Compresses to a few hundred bytes, well under the raw body cap
+	bomb := bytes.Repeat([]byte("a"), 64*limit)
+
+	tests := []struct {
+		name     string
+		encoding string
+		body     []byte
+		rawLimit int64 // LimitBody cap, 0 for none
+		status   int
+		want     []byte
+	}{
+		{name: "identity", body: small, status: http.StatusOK, want: small},
+		{name: "explicit identity", encoding: "identity", body: small, status: http.StatusOK, want: small},
+		{name: "identity over limit", body: large, status: http.StatusRequestEntityTooLarge},
+		{name: "gzip", encoding: "gzip", body: gzipBytes(t, small), status: http.StatusOK, want: small},
+		{name: "gzip upper case", encoding: "GZIP", body: gzipBytes(t, small), status: http.StatusOK, want: small},
+		{name: "gzip over limit after decoding", encoding: "gzip", body: gzipBytes(t, large), status: http.StatusRequestEntityTooLarge},
+		{name: "gzip bomb", encoding: "gzip", body: gzipBytes(t, bomb), rawLimit: limit, status: http.StatusRequestEntityTooLarge},
+		{name: "zstd", encoding: "zstd", body: zstdBytes(t, small), status: http.StatusOK, want: small},
+		{name: "zstd stream with window over limit", encoding: "zstd", body: zstdStream(t, small), status: http.StatusOK, want: small},
+		{name: "zstd bomb", encoding: "zstd", body: zstdBytes(t, bomb), rawLimit: limit, status: http.StatusRequestEntityTooLarge},
+		{name: "invalid gzip", encoding: "gzip", body: []byte("not gzip"), status: http.StatusBadRequest},
+		{name: "unsupported encoding", encoding: "br", body: small, status: http.StatusUnsupportedMediaType},
+		{name: "raw body over cap", body: large, rawLimit: limit, status: http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			if tt.rawLimit > 0 {
+				router.Use(LimitBody(tt.rawLimit))
+			}
+			router.Use(Decompress(limit))
+
+			var got []byte
+			router.POST("/", func(c *gin.Context) {
+				if c.GetHeader("Content-Encoding") != "" {
+					t.Error("Content-Encoding header was not removed")
+				}
+				got, _ = io.ReadAll(c.Request.Body)
+				c.Status(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(tt.body))
+			if tt.encoding != "" {
+				req.Header.Set("Content-Encoding", tt.encoding)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d (%s)", w.Code, tt.status, w.Body.String())
+			}
+			if tt.want != nil && !bytes.Equal(got, tt.want) {
+				t.Errorf("handler read %d bytes, want %d", len(got), len(tt.want))
+			}
+		})
+	}
+}
+
+func TestReadLimited(t *testing.T) {
+	tests := []struct {
+		name    string
+		size    int
+		max     int64
+		wantErr error
+	}{
+		{name: "empty", size: 0, max: 10},
+		{name: "under limit", size: 9, max: 10},
+		{name: "at limit", size: 10, max: 10},
+		{name: "over limit", size: 11, max: 10, wantErr: errBodyTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, err := readLimited(bytes.NewReader(make([]byte, tt.size)), tt.max)
+			if err != tt.wantErr {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && len(body) != tt.size {
+				t.Errorf("read %d bytes, want %d", len(body), tt.size)
+			}
+		})
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"sync"
 	"time"
 
+	"mark7888/speedtest-data-server/internal/auth"
+	"mark7888/speedtest-data-server/internal/metrics"
 	"mark7888/speedtest-data-server/pkg/models"
 
 	"github.com/gin-gonic/gin"
@@ -42,6 +44,18 @@ func (rl *RateLimiter) getLimiter(key string) *rate.Limiter {
 	return limiter
 }
 
+// Allow reports whether a request for the given key is within the rate limit.
+// Used by transports outside of gin, such as the gRPC server.
+func (rl *RateLimiter) Allow(key string) bool {
+	return rl.getLimiter(key).Allow()
+}
+
+// Exhausted reports whether the given key has no requests left, without
+// using one up
+func (rl *RateLimiter) Exhausted(key string) bool {
+	return rl.getLimiter(key).Tokens() < 1
+}
+
 // Cleanup removes old limiters periodically
 func (rl *RateLimiter) Cleanup() {
 	ticker := time.NewTicker(10 * time.Minute)
@@ -68,6 +82,13 @@ func RateLimit(limiter *RateLimiter) gin.HandlerFunc {
 			}
 		}
 
+		// Nodes with a client certificate are limited per node
+		if cert, exists := c.Get("node_certificate"); exists {
+			if nc, ok := cert.(*auth.NodeCertificate); ok {
+				key = "cert:" + nc.NodeID.String()
+			}
+		}
+
 		// If username is present (admin), use it
 		if username, exists := c.Get("username"); exists {
 			if u, ok := username.(string); ok {
@@ -77,6 +98,7 @@ func RateLimit(limiter *RateLimiter) gin.HandlerFunc {
 
 		limiter := limiter.getLimiter(key)
 		if !limiter.Allow() {
+			metrics.RateLimitRejections.WithLabelValues("http").Inc()
 			c.JSON(http.StatusTooManyRequests, models.ErrorResponse{
 				Error: "Rate limit exceeded",
 			})
@@ -87,3 +109,28 @@ func RateLimit(limiter *RateLimiter) gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// LimitFailedAuth throttles clients whose requests keep failing
+// authentication. It runs before the credentials are checked and counts only
+// rejected requests against the client's IP, so that guessing keys (each
+// guess at a key issued before key IDs costs bcrypt comparisons) is limited
+// while nodes sharing an address are not.
+func LimitFailedAuth(limiter *RateLimiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := "auth:" + c.ClientIP()
+		if limiter.Exhausted(key) {
+			metrics.RateLimitRejections.WithLabelValues("http").Inc()
+			c.JSON(http.StatusTooManyRequests, models.ErrorResponse{
+				Error: "Too many failed authentication attempts",
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+
+		if c.Writer.Status() == http.StatusUnauthorized {
+			limiter.Allow(key)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestLimitFailedAuth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(LimitFailedAuth(NewRateLimiter(3)))
+	router.POST("/api/v1/measurements", func(c *gin.Context) {
+		if c.GetHeader("Authorization") != "Bearer valid" {
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		c.Status(http.StatusOK)
+	})
+
+	send := func(ip, token string) int {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/measurements", nil)
+		req.RemoteAddr = ip + ":1234"
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// Accepted requests are not counted
+	for range 10 {
+		if code := send("192.0.2.1", "valid"); code != http.StatusOK {
+			t.Fatalf("valid key = %d, want 200", code)
+		}
+	}
+
+	for i := range 3 {
+		if code := send("192.0.2.1", "guess"); code != http.StatusUnauthorized {
+			t.Fatalf("guess %d = %d, want 401", i, code)
+		}
+	}
+	if code := send("192.0.2.1", "guess"); code != http.StatusTooManyRequests {
+		t.Errorf("guess after the budget is spent = %d, want 429", code)
+	}
+
+	// Other clients are not affected
+	if code := send("192.0.2.2", "guess"); code != http.StatusUnauthorized {
+		t.Errorf("guess from another address = %d, want 401", code)
+	}
+}
@@ -0,0 +1,118 @@
+package middleware
+
+import (
+	"time"
+
+	"mark7888/speedtest-data-server/internal/logger"
+	"mark7888/speedtest-data-server/pkg/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// RequestIDHeader carries the request ID in both directions
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds request IDs supplied by clients
+const maxRequestIDLength = 128
+
+// RequestID assigns each request an ID, reusing a well-formed one sent by
+// the client so that node and server logs can be matched. The ID is echoed
+// in the response and attached to the request context for logging.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader(RequestIDHeader)
+		if !validRequestID(requestID) {
+			requestID = uuid.New().String()
+		}
+
+		c.Set("request_id", requestID)
+		c.Header(RequestIDHeader, requestID)
+		c.Request = c.Request.WithContext(logger.WithRequestID(c.Request.Context(), requestID))
+
+		c.Next()
+	}
+}
+
+// validRequestID only accepts short IDs made of characters that are safe
+// to put into logs
+func validRequestID(requestID string) bool {
+	if requestID == "" || len(requestID) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range requestID {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '-' || r == '_' || r == '.' || r == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// AccessLog writes one structured log line per request once it has been
+// handled. Health checks and metric scrapes are logged at debug level.
+func AccessLog() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		status := c.Writer.Status()
+
+		fields := []zap.Field{
+			zap.String("method", c.Request.Method),
+			zap.String("route", route),
+			zap.String("path", c.Request.URL.Path),
+			zap.Int("status", status),
+			zap.Duration("latency", time.Since(start)),
+			zap.Int64("bytes_in", c.Request.ContentLength),
+			zap.Int("bytes_out", max(c.Writer.Size(), 0)),
+			zap.String("client_ip", c.ClientIP()),
+		}
+
+		// Who made the request: a node (identified by its API key and the
+		// node ID in the body) or an admin user
+		if nodeID := c.GetString("node_id"); nodeID != "" {
+			fields = append(fields, zap.String("node_id", nodeID))
+		}
+		if apiKey, exists := c.Get("api_key"); exists {
+			if ak, ok := apiKey.(*models.APIKey); ok {
+				fields = append(fields, zap.String("api_key_id", ak.ID.String()))
+			}
+		}
+		if username := c.GetString("username"); username != "" {
+			fields = append(fields, zap.String("user", username))
+		}
+
+		if spanContext := trace.SpanContextFromContext(c.Request.Context()); spanContext.IsValid() {
+			fields = append(fields, zap.String("trace_id", spanContext.TraceID().String()))
+		}
+		if len(c.Errors) > 0 {
+			fields = append(fields, zap.String("errors", c.Errors.String()))
+		}
+
+		level := zapcore.InfoLevel
+		switch {
+		case status >= 500:
+			level = zapcore.ErrorLevel
+		case status >= 400:
+			level = zapcore.WarnLevel
+		case route == "/health" || route == "/metrics":
+			level = zapcore.DebugLevel
+		}
+
+		// The stack of a finished request says nothing useful
+		logger.FromContext(c.Request.Context()).
+			WithOptions(zap.AddStacktrace(zapcore.FatalLevel)).
+			Log(level, "HTTP request", fields...)
+	}
+}
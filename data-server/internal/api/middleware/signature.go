@@ -0,0 +1,112 @@
+package middleware
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"mark7888/speedtest-data-server/internal/auth"
+	"mark7888/speedtest-data-server/internal/db"
+	"mark7888/speedtest-data-server/internal/logger"
+	"mark7888/speedtest-data-server/pkg/models"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// SignedRequestAuth authenticates node requests signed with the signing key
+// of an API key (see auth.RequestSignature). Unlike a bearer token, the
+// signature proves the request was not changed on the way, and its
+// timestamp and nonce keep it from being replayed: requests outside
+// tolerance of the server's clock are refused, and nonces are remembered
+// for as long. Requests without a signature are left to APIKeyAuth, which
+// must come after this.
+func SignedRequestAuth(database db.Database, tolerance time.Duration) gin.HandlerFunc {
+	nonces := auth.NewNonceCache(tolerance)
+
+	return func(c *gin.Context) {
+		signature := c.GetHeader(auth.SignatureHeader)
+		if signature == "" {
+			c.Next()
+			return
+		}
+
+		keyID := c.GetHeader(auth.SignatureKeyIDHeader)
+		timestamp := c.GetHeader(auth.SignatureTimestampHeader)
+		nonce := c.GetHeader(auth.SignatureNonceHeader)
+		if keyID == "" || timestamp == "" || nonce == "" {
+			rejectSignature(c, "Signed requests need key ID, timestamp and nonce headers")
+			return
+		}
+
+		signedAt, err := auth.CheckSignatureTimestamp(timestamp, time.Now(), tolerance)
+		if err != nil {
+			logger.FromContext(c.Request.Context()).Warn("Rejected signed request",
+				zap.String("key_id", keyID),
+				zap.String("timestamp", timestamp),
+				zap.Error(err),
+			)
+			rejectSignature(c, "Request timestamp is outside the allowed window; check the node's clock")
+			return
+		}
+		if err := auth.CheckSignatureNonce(nonce); err != nil {
+			rejectSignature(c, err.Error())
+			return
+		}
+
+		// The signature covers the body exactly as sent, before decompression
+		var body []byte
+		if c.Request.Body != nil {
+			body, err = io.ReadAll(c.Request.Body)
+			if err != nil {
+				var maxBytesErr *http.MaxBytesError
+				if errors.As(err, &maxBytesErr) {
+					c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, models.ErrorResponse{
+						Error: errBodyTooLarge.Error(),
+					})
+					return
+				}
+				c.AbortWithStatusJSON(http.StatusBadRequest, models.ErrorResponse{
+					Error: "Failed to read request body",
+				})
+				return
+			}
+			c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		}
+
+		requestURI := c.Request.URL.RequestURI()
+		apiKey, err := database.VerifySignedRequest(c.Request.Context(), keyID, signature, func(signingKey []byte) string {
+			return auth.RequestSignature(signingKey, c.Request.Method, requestURI, timestamp, nonce, body)
+		})
+		if err != nil {
+			logger.FromContext(c.Request.Context()).Warn("Invalid signed request", zap.String("key_id", keyID), zap.Error(err))
+			rejectSignature(c, "Invalid request signature")
+			return
+		}
+
+		// Only remembered once the signature holds, so forged requests
+		// cannot use up nonces
+		if !nonces.Use(keyID, nonce, signedAt, time.Now()) {
+			logger.FromContext(c.Request.Context()).Warn("Rejected replayed request",
+				zap.String("api_key_id", apiKey.ID.String()),
+				zap.String("nonce", nonce),
+			)
+			rejectSignature(c, "Request nonce has already been used")
+			return
+		}
+
+		c.Set("api_key", apiKey)
+		c.Request = c.Request.WithContext(auth.WithAPIKey(c.Request.Context(), apiKey))
+		c.Next()
+	}
+}
+
+// rejectSignature aborts a signed request that cannot be accepted
+func rejectSignature(c *gin.Context, message string) {
+	c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+		Error: message,
+	})
+	c.Abort()
+}
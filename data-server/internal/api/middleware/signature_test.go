@@ -0,0 +1,121 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"mark7888/speedtest-data-server/internal/auth"
+	"mark7888/speedtest-data-server/internal/config"
+	"mark7888/speedtest-data-server/internal/db/sqlite"
+	"mark7888/speedtest-data-server/internal/logger"
+	"mark7888/speedtest-data-server/pkg/models"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+func TestSignedRequestAuth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logger.Log = zap.NewNop()
+
+	cfg := &config.Config{}
+	cfg.Database.Path = filepath.Join(t.TempDir(), "test.db")
+	cfg.APIKeys.Secret = "test-secret"
+	database, err := sqlite.New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close() })
+	if err := database.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	plainKey, err := auth.GenerateAPIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	apiKey, err := database.CreateAPIKey(context.Background(), plainKey, models.NewAPIKey{Name: "node"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	router := gin.New()
+	router.Use(SignedRequestAuth(database, 5*time.Minute), APIKeyAuth(database))
+	router.POST("/api/v1/node/alive", func(c *gin.Context) {
+		body, _ := io.ReadAll(c.Request.Body)
+		c.String(http.StatusOK, string(body))
+	})
+
+	// signed builds a request signed at signedAt; tamper changes it afterwards
+	signed := func(nonce string, signedAt time.Time, body string, tamper func(*http.Request)) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/node/alive", bytes.NewBufferString(body))
+		timestamp := strconv.FormatInt(signedAt.Unix(), 10)
+		req.Header.Set(auth.SignatureKeyIDHeader, *apiKey.KeyID)
+		req.Header.Set(auth.SignatureTimestampHeader, timestamp)
+		req.Header.Set(auth.SignatureNonceHeader, nonce)
+		req.Header.Set(auth.SignatureHeader, auth.RequestSignature(auth.DeriveSigningKey(plainKey),
+			http.MethodPost, "/api/v1/node/alive", timestamp, nonce, []byte(body)))
+		if tamper != nil {
+			tamper(req)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	now := time.Now()
+	tests := []struct {
+		name     string
+		nonce    string
+		signedAt time.Time
+		tamper   func(*http.Request)
+		want     int
+	}{
+		{name: "valid", nonce: "nonce-0000000001", signedAt: now, want: http.StatusOK},
+		{name: "replayed", nonce: "nonce-0000000001", signedAt: now, want: http.StatusUnauthorized},
+		{name: "clock slightly off", nonce: "nonce-0000000002", signedAt: now.Add(-2 * time.Minute), want: http.StatusOK},
+		{name: "stale", nonce: "nonce-0000000003", signedAt: now.Add(-10 * time.Minute), want: http.StatusUnauthorized},
+		{name: "short nonce", nonce: "nonce", signedAt: now, want: http.StatusUnauthorized},
+		{
+			name: "body changed", nonce: "nonce-0000000004", signedAt: now, want: http.StatusUnauthorized,
+			tamper: func(r *http.Request) { r.Body = io.NopCloser(bytes.NewBufferString(`{"node":"other"}`)) },
+		},
+		{
+			name: "query added", nonce: "nonce-0000000005", signedAt: now, want: http.StatusUnauthorized,
+			tamper: func(r *http.Request) { r.URL.RawQuery = "debug=1" },
+		},
+		{
+			name: "missing key ID", nonce: "nonce-0000000006", signedAt: now, want: http.StatusUnauthorized,
+			tamper: func(r *http.Request) { r.Header.Del(auth.SignatureKeyIDHeader) },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := signed(tt.nonce, tt.signedAt, `{"node":"mine"}`, tt.tamper)
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body.String())
+			}
+			if tt.want == http.StatusOK && w.Body.String() != `{"node":"mine"}` {
+				t.Errorf("handler read body %q", w.Body.String())
+			}
+		})
+	}
+
+	t.Run("unsigned falls back to bearer", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/node/alive", bytes.NewBufferString("{}"))
+		req.Header.Set("Authorization", "Bearer "+plainKey)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Errorf("status = %d, want %d", w.Code, http.StatusOK)
+		}
+	})
+}
@@ -8,17 +8,23 @@ import (
 	"mark7888/speedtest-data-server/internal/api/middleware"
 	"mark7888/speedtest-data-server/internal/auth"
 	"mark7888/speedtest-data-server/internal/config"
+	"mark7888/speedtest-data-server/internal/control"
 	"mark7888/speedtest-data-server/internal/db"
+	"mark7888/speedtest-data-server/internal/ingest"
+	"mark7888/speedtest-data-server/internal/metrics"
 	"mark7888/speedtest-data-server/internal/version"
 	"mark7888/speedtest-data-server/pkg/models"
 
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 var startTime = time.Now()
 
-// SetupRouter configures and returns the Gin router
-func SetupRouter(cfg *config.Config, database db.Database, jwtManager *auth.JWTManager) *gin.Engine {
+// SetupRouter configures and returns the Gin router. nodeCA enables signing
+// node client certificates; it may be nil. rateLimiter is shared with the
+// gRPC server.
+func SetupRouter(cfg *config.Config, database db.Database, jwtManager *auth.JWTManager, ingestService *ingest.Service, hub *control.Hub, nodeCA *auth.CertificateAuthority, rateLimiter *middleware.RateLimiter) *gin.Engine {
 	// Set Gin mode
 	if cfg.Server.Mode == "release" {
 		gin.SetMode(gin.ReleaseMode)
@@ -29,18 +35,28 @@ func SetupRouter(cfg *config.Config, database db.Database, jwtManager *auth.JWTM
 	router := gin.New()
 
 	// Global middleware
+	router.Use(middleware.RequestID())
+	router.Use(middleware.Tracing())
+	router.Use(middleware.AccessLog())
 	router.Use(gin.Recovery())
+	if cfg.Metrics.Enabled {
+		router.Use(middleware.Metrics())
+	}
 	router.Use(middleware.CORS(cfg.API.AllowedOrigins))
+	router.Use(middleware.LimitBody(int64(cfg.API.MaxBodySize)))
+
+	// Signed node requests share one nonce cache across node routes
+	signedRequestAuth := middleware.SignedRequestAuth(database, cfg.APIKeys.SignatureTolerance)
 
-	// Rate limiter
-	rateLimiter := middleware.NewRateLimiter(cfg.API.RateLimit)
-	rateLimiter.Cleanup()
+	// Rejected node credentials are limited per IP before they are checked;
+	// RateLimit only applies once the key is known
+	limitFailedAuth := middleware.LimitFailedAuth(middleware.NewRateLimiter(cfg.API.RateLimit))
 
 	// Health check endpoint (no auth required)
 	// Uses SafePing to prevent DDoS attacks by caching ping results
 	router.GET("/health", func(c *gin.Context) {
 		dbStatus := "connected"
-		if err := database.SafePing(); err != nil {
+		if err := database.SafePing(c.Request.Context()); err != nil {
 			dbStatus = "disconnected"
 		}
 
@@ -52,71 +68,171 @@ func SetupRouter(cfg *config.Config, database db.Database, jwtManager *auth.JWTM
 		})
 	})
 
+	// Prometheus metrics behind a bearer token (required by Config.Validate)
+	if cfg.Metrics.Enabled {
+		metrics.RegisterNodeCounts(database.GetNodeCounts)
+
+		metricsHandler := gin.WrapH(promhttp.HandlerFor(metrics.Registry, promhttp.HandlerOpts{}))
+		router.GET("/metrics", middleware.MetricsAuth(cfg.Metrics.Token), metricsHandler)
+	}
+
 	// Create handlers
-	nodeHandler := handlers.NewNodeHandler(database)
-	measurementHandler := handlers.NewMeasurementHandler(database)
-	adminHandler := handlers.NewAdminHandler(database, jwtManager, cfg)
+	nodeHandler := handlers.NewNodeHandler(ingestService)
+	measurementHandler := handlers.NewMeasurementHandler(ingestService)
+	adminHandler := handlers.NewAdminHandler(database, jwtManager, cfg, hub)
 	apiKeyHandler := handlers.NewAPIKeyHandler(database)
+	controlHandler := handlers.NewControlHandler(hub)
+	commandHandler := handlers.NewCommandHandler(database, ingestService)
+	nodeConfigHandler := handlers.NewNodeConfigHandler(database, ingestService)
+	quarantineHandler := handlers.NewQuarantineHandler(database)
+	enrollmentHandler := handlers.NewEnrollmentHandler(database)
+	certificateHandler := handlers.NewCertificateHandler(nodeCA, cfg.Server.NodeCertValidity)
+	userHandler := handlers.NewUserHandler(database, cfg)
+	sessionHandler := handlers.NewSessionHandler(database)
+
+	// Roles required by admin routes; each role includes the ones below it
+	viewer := middleware.RequireRole(models.UserRoleViewer)
+	operator := middleware.RequireRole(models.UserRoleOperator)
+	admin := middleware.RequireRole(models.UserRoleAdmin)
 
 	// API v1 routes
 	v1 := router.Group("/api/v1")
 	{
 		// Node API (requires API key authentication)
 		nodeAPI := v1.Group("/node")
+		nodeAPI.Use(limitFailedAuth)
+		nodeAPI.Use(signedRequestAuth)
 		nodeAPI.Use(middleware.APIKeyAuth(database))
 		nodeAPI.Use(middleware.RateLimit(rateLimiter))
+		nodeAPI.Use(middleware.Decompress(int64(cfg.API.MaxBodySize)))
 		{
 			nodeAPI.POST("/alive", nodeHandler.HandleAlive)
+			nodeAPI.GET("/stats", nodeHandler.HandleGetStats)
+			nodeAPI.POST("/commands/:id/result", commandHandler.HandleCommandResult)
+			if cfg.Node.ControlChannel {
+				nodeAPI.GET("/ws", controlHandler.HandleConnect)
+			}
 		}
 
 		// Measurements API (requires API key authentication)
 		measurementsAPI := v1.Group("/measurements")
+		measurementsAPI.Use(limitFailedAuth)
+		measurementsAPI.Use(signedRequestAuth)
 		measurementsAPI.Use(middleware.APIKeyAuth(database))
 		measurementsAPI.Use(middleware.RateLimit(rateLimiter))
+		measurementsAPI.Use(middleware.Decompress(int64(cfg.API.MaxBodySize)))
 		{
 			measurementsAPI.POST("", measurementHandler.HandleSubmitMeasurements)
 			measurementsAPI.POST("/failed", measurementHandler.HandleSubmitFailedMeasurements)
 		}
 
+		// Node enrollment (authenticated by the enrollment token in the body)
+		v1.POST("/enroll", middleware.RateLimit(rateLimiter), enrollmentHandler.HandleEnroll)
+
 		// Admin API
 		adminAPI := v1.Group("/admin")
+		if cfg.API.ResponseCompression {
+			adminAPI.Use(middleware.CompressResponses())
+		}
 		{
 			// Login endpoint (no auth required)
 			adminAPI.POST("/login", adminHandler.HandleLogin)
+			adminAPI.POST("/login/mfa", middleware.RateLimit(rateLimiter), adminHandler.HandleLoginMFA)
+
+			// Token refresh (the refresh token authenticates)
+			adminAPI.POST("/refresh", middleware.RateLimit(rateLimiter), adminHandler.HandleRefreshToken)
+
+			// Single sign-on through the identity provider (no auth required)
+			if cfg.OIDC.Enabled() {
+				oidcHandler := handlers.NewOIDCHandler(database, jwtManager, cfg)
+				adminAPI.GET("/oidc/login", middleware.RateLimit(rateLimiter), oidcHandler.HandleLogin)
+				adminAPI.GET("/oidc/callback", middleware.RateLimit(rateLimiter), oidcHandler.HandleCallback)
+			}
 
-			// Protected admin endpoints (require JWT)
+			// Protected admin endpoints (require JWT and a role per route)
 			protected := adminAPI.Group("")
-			protected.Use(middleware.JWTAuth(jwtManager))
+			protected.Use(middleware.JWTAuth(jwtManager, database))
 			protected.Use(middleware.RateLimit(rateLimiter))
 			{
-				// Token refresh
-				protected.POST("/refresh", adminHandler.HandleRefreshToken)
+				// Sessions
+				protected.POST("/logout", viewer, sessionHandler.HandleLogout)
+				protected.POST("/logout-all", viewer, sessionHandler.HandleLogoutAll)
+				protected.GET("/me/sessions", viewer, sessionHandler.HandleListMySessions)
+				protected.DELETE("/me/sessions/:id", viewer, sessionHandler.HandleRevokeMySession)
+				protected.GET("/sessions", admin, sessionHandler.HandleListSessions)
+				protected.DELETE("/sessions/:id", admin, sessionHandler.HandleRevokeSession)
 
 				// Dashboard
-				protected.GET("/dashboard", adminHandler.HandleGetDashboard)
+				protected.GET("/dashboard", viewer, adminHandler.HandleGetDashboard)
 
 				// Nodes
-				protected.GET("/nodes", adminHandler.HandleListNodes)
-				protected.GET("/nodes/:id", adminHandler.HandleGetNodeDetails)
-				protected.GET("/nodes/:id/measurements", adminHandler.HandleGetNodeMeasurements)
-				protected.PATCH("/nodes/:id/archive", adminHandler.HandleArchiveNode)
-				protected.PATCH("/nodes/:id/favorite", adminHandler.HandleSetNodeFavorite)
-				protected.DELETE("/nodes/:id", adminHandler.HandleDeleteNode)
+				protected.GET("/nodes", viewer, adminHandler.HandleListNodes)
+				protected.GET("/nodes/connected", viewer, controlHandler.HandleListConnectedNodes)
+				protected.GET("/nodes/:id", viewer, adminHandler.HandleGetNodeDetails)
+				protected.GET("/nodes/:id/measurements", viewer, adminHandler.HandleGetNodeMeasurements)
+				protected.PATCH("/nodes/:id/archive", operator, adminHandler.HandleArchiveNode)
+				protected.PATCH("/nodes/:id/favorite", operator, adminHandler.HandleSetNodeFavorite)
+				protected.DELETE("/nodes/:id", admin, adminHandler.HandleDeleteNode)
+				protected.POST("/nodes/:id/commands", operator, controlHandler.HandleSendCommand)
+				protected.GET("/nodes/:id/commands", viewer, commandHandler.HandleListNodeCommands)
+				protected.GET("/nodes/:id/commands/:commandId", viewer, commandHandler.HandleGetNodeCommand)
+				protected.POST("/nodes/:id/run-test", operator, commandHandler.HandleRunTest)
+				protected.GET("/nodes/:id/config", viewer, nodeConfigHandler.HandleGetNodeConfig)
+				protected.PUT("/nodes/:id/config", operator, nodeConfigHandler.HandleSetNodeConfig)
+				protected.DELETE("/nodes/:id/config", operator, nodeConfigHandler.HandleDeleteNodeConfig)
+
+				// Fleet-wide node settings
+				protected.GET("/node-config", viewer, nodeConfigHandler.HandleGetDefaultConfig)
+				protected.PUT("/node-config", operator, nodeConfigHandler.HandleSetDefaultConfig)
 
 				// API Keys
-				protected.GET("/api-keys", apiKeyHandler.HandleListAPIKeys)
-				protected.POST("/api-keys", apiKeyHandler.HandleCreateAPIKey)
-				protected.PATCH("/api-keys/:id", apiKeyHandler.HandleUpdateAPIKey)
-				protected.DELETE("/api-keys/:id", apiKeyHandler.HandleDeleteAPIKey)
+				protected.GET("/api-keys", admin, apiKeyHandler.HandleListAPIKeys)
+				protected.POST("/api-keys", admin, apiKeyHandler.HandleCreateAPIKey)
+				protected.PATCH("/api-keys/:id", admin, apiKeyHandler.HandleUpdateAPIKey)
+				protected.DELETE("/api-keys/:id", admin, apiKeyHandler.HandleDeleteAPIKey)
+				protected.GET("/api-keys/:id/binding", admin, apiKeyHandler.HandleGetAPIKeyBinding)
+				protected.PUT("/api-keys/:id/binding", admin, apiKeyHandler.HandleBindAPIKey)
+				protected.DELETE("/api-keys/:id/binding", admin, apiKeyHandler.HandleResetAPIKeyBinding)
+
+				// Enrollment tokens
+				protected.GET("/enrollment-tokens", admin, enrollmentHandler.HandleListEnrollmentTokens)
+				protected.POST("/enrollment-tokens", admin, enrollmentHandler.HandleCreateEnrollmentToken)
+				protected.DELETE("/enrollment-tokens/:id", admin, enrollmentHandler.HandleDeleteEnrollmentToken)
+
+				// Node client certificates
+				if nodeCA != nil {
+					protected.POST("/certificates", admin, certificateHandler.HandleSignCertificate)
+				}
+
+				// Users
+				protected.GET("/me", viewer, userHandler.HandleGetCurrentUser)
+				protected.PUT("/me/password", viewer, userHandler.HandleChangePassword)
+				protected.POST("/me/totp", viewer, userHandler.HandleStartTOTP)
+				protected.POST("/me/totp/confirm", viewer, userHandler.HandleConfirmTOTP)
+				protected.POST("/me/totp/disable", viewer, userHandler.HandleDisableTOTP)
+				protected.POST("/me/recovery-codes", viewer, userHandler.HandleRegenerateRecoveryCodes)
+				protected.GET("/users", admin, userHandler.HandleListUsers)
+				protected.POST("/users", admin, userHandler.HandleCreateUser)
+				protected.PATCH("/users/:id", admin, userHandler.HandleUpdateUser)
+				protected.DELETE("/users/:id", admin, userHandler.HandleDeleteUser)
+				protected.DELETE("/users/:id/totp", admin, userHandler.HandleResetUserTOTP)
 			}
 		}
 
-		// Measurements aggregation (admin only)
+		// Measurements aggregation and review (admin API)
 		measurementsAdminAPI := v1.Group("/admin/measurements")
-		measurementsAdminAPI.Use(middleware.JWTAuth(jwtManager))
+		if cfg.API.ResponseCompression {
+			measurementsAdminAPI.Use(middleware.CompressResponses())
+		}
+		measurementsAdminAPI.Use(middleware.JWTAuth(jwtManager, database))
 		measurementsAdminAPI.Use(middleware.RateLimit(rateLimiter))
 		{
-			measurementsAdminAPI.GET("/aggregate", adminHandler.HandleGetAggregatedMeasurements)
+			measurementsAdminAPI.GET("/aggregate", viewer, adminHandler.HandleGetAggregatedMeasurements)
+
+			// Implausible measurements awaiting review
+			measurementsAdminAPI.GET("/quarantine", viewer, quarantineHandler.HandleListQuarantined)
+			measurementsAdminAPI.POST("/quarantine/:id/approve", operator, quarantineHandler.HandleApproveQuarantined)
+			measurementsAdminAPI.DELETE("/quarantine/:id", operator, quarantineHandler.HandleDiscardQuarantined)
 		}
 	}
 
@@ -0,0 +1,156 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"mark7888/speedtest-data-server/internal/api/middleware"
+	"mark7888/speedtest-data-server/internal/auth"
+	"mark7888/speedtest-data-server/internal/config"
+	"mark7888/speedtest-data-server/internal/control"
+	"mark7888/speedtest-data-server/internal/db/sqlite"
+	"mark7888/speedtest-data-server/internal/ingest"
+	"mark7888/speedtest-data-server/internal/logger"
+	"mark7888/speedtest-data-server/internal/tracing"
+	"mark7888/speedtest-data-server/pkg/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// recordSpans installs a tracer provider that keeps every span in memory
+// for the rest of the test
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	if _, err := tracing.Init(config.TracingConfig{}); err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() {
+		provider.Shutdown(context.Background())
+		otel.SetTracerProvider(previous)
+	})
+	return recorder
+}
+
+func TestIngestRequestTracing(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logger.Log = zap.NewNop()
+
+	cfg := &config.Config{}
+	cfg.Server.Mode = "release"
+	cfg.Database.Path = filepath.Join(t.TempDir(), "test.db")
+	cfg.API.MaxBodySize = 1 << 20
+	cfg.API.RateLimit = 60
+	cfg.API.AllowedOrigins = []string{"http://localhost:3000"}
+	cfg.Node.MaxFutureSkew = 5 * time.Minute
+	cfg.Quality.Action = "quarantine"
+	cfg.Quality.MaxBandwidthMbps = 1000
+	cfg.Quality.MaxLatencyMs = 1000
+
+	database, err := sqlite.New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close() })
+	if err := database.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	plainKey, err := auth.GenerateAPIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := database.CreateAPIKey(context.Background(), plainKey, models.NewAPIKey{Name: "node key", CreatedBy: "admin"}); err != nil {
+		t.Fatal(err)
+	}
+
+	ingestService := ingest.NewService(database, cfg)
+	hub := control.NewHub(database, ingestService, time.Minute)
+	t.Cleanup(hub.Close)
+	router := SetupRouter(cfg, database, auth.NewJWTManager("test-secret", time.Hour), ingestService, hub, nil, middleware.NewRateLimiter(cfg.API.RateLimit))
+
+	loss := 0.5
+	body, _ := json.Marshal(models.MeasurementRequest{
+		NodeID:   uuid.New(),
+		NodeName: "node",
+		Measurements: []models.MeasurementDetail{{
+			Timestamp:  time.Now().Add(-time.Minute).Truncate(time.Second),
+			Ping:       &models.PingMetrics{Jitter: 1, Latency: 10, Low: 9, High: 12},
+			Download:   &models.TransferMetrics{Bandwidth: 12500000, Bytes: 100000000, Elapsed: 8000},
+			Upload:     &models.TransferMetrics{Bandwidth: 2500000, Bytes: 20000000, Elapsed: 8000},
+			PacketLoss: &loss,
+		}},
+	})
+
+	// The trace the node started before sending its batch
+	const (
+		nodeTraceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+		nodeSpanID  = "00f067aa0ba902b7"
+	)
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/measurements", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+plainKey)
+	req.Header.Set("traceparent", "00-"+nodeTraceID+"-"+nodeSpanID+"-01")
+	w := httptest.NewRecorder()
+	recorder := recordSpans(t)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", w.Code, w.Body)
+	}
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	var queries []sdktrace.ReadOnlySpan
+	for _, span := range recorder.Ended() {
+		if span.SpanContext().TraceID().String() != nodeTraceID {
+			t.Errorf("span %s in trace %s, want the node's trace", span.Name(), span.SpanContext().TraceID())
+		}
+		spans[span.Name()] = span
+		if strings.HasPrefix(span.Name(), "sqlite.") {
+			queries = append(queries, span)
+		}
+	}
+
+	server, ok := spans["POST /api/v1/measurements"]
+	if !ok {
+		t.Fatalf("no server span among %d spans", len(spans))
+	}
+	if server.SpanKind() != trace.SpanKindServer || !server.Parent().IsRemote() || server.Parent().SpanID().String() != nodeSpanID {
+		t.Errorf("server span kind %s, parent %s (remote %t); want a server span under the node's span",
+			server.SpanKind(), server.Parent().SpanID(), server.Parent().IsRemote())
+	}
+
+	submit, ok := spans["ingest.SubmitMeasurements"]
+	if !ok {
+		t.Fatal("no ingest span")
+	}
+	if submit.Parent().SpanID() != server.SpanContext().SpanID() {
+		t.Errorf("ingest span parent = %s, want the server span", submit.Parent().SpanID())
+	}
+
+	var underIngest bool
+	for _, query := range queries {
+		if query.Parent().SpanID() == submit.SpanContext().SpanID() {
+			underIngest = true
+		}
+	}
+	if !underIngest {
+		t.Errorf("none of the %d database spans belong to the ingest span", len(queries))
+	}
+}
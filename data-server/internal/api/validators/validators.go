@@ -4,7 +4,10 @@ import (
 	"fmt"
 	"time"
 
+	"mark7888/speedtest-data-server/pkg/models"
+
 	"github.com/google/uuid"
+	"github.com/robfig/cron/v3"
 )
 
 // ValidateUUID checks if a string is a valid UUID
@@ -52,3 +55,44 @@ func ValidateInterval(interval string) error {
 	}
 	return nil
 }
+
+// ValidateNodeSettings checks server-managed node settings before they are
+// stored, so nodes never receive a config they cannot apply
+func ValidateNodeSettings(settings models.NodeSettings) error {
+	if settings.SpeedtestCron != nil {
+		if _, err := cron.ParseStandard(*settings.SpeedtestCron); err != nil {
+			return fmt.Errorf("invalid speedtest_cron: %w", err)
+		}
+	}
+
+	durations := []struct {
+		name  string
+		value *string
+		min   time.Duration
+	}{
+		{"speedtest_timeout", settings.SpeedtestTimeout, 10 * time.Second},
+		{"sync_interval", settings.SyncInterval, 5 * time.Second},
+		{"alive_interval", settings.AliveInterval, 5 * time.Second},
+	}
+	for _, d := range durations {
+		if d.value == nil {
+			continue
+		}
+		parsed, err := time.ParseDuration(*d.value)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", d.name, err)
+		}
+		if parsed < d.min {
+			return fmt.Errorf("%s must be at least %s", d.name, d.min)
+		}
+	}
+
+	if settings.BatchSize != nil && (*settings.BatchSize < 1 || *settings.BatchSize > 1000) {
+		return fmt.Errorf("batch_size must be between 1 and 1000")
+	}
+	if settings.RetentionDays != nil && *settings.RetentionDays < 1 {
+		return fmt.Errorf("retention_days must be at least 1")
+	}
+
+	return nil
+}
@@ -0,0 +1,186 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"mark7888/speedtest-data-server/pkg/models"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// APIKeyLength is the length of the secret part of generated API keys in bytes
+	APIKeyLength = 32
+	// APIKeyPrefix is the prefix for API keys
+	APIKeyPrefix = "sk_live_"
+
+	// apiKeyIDLength is the length of the public key ID in bytes
+	apiKeyIDLength = 8
+	// apiKeyIDSeparator ends the key ID. Keys from before key IDs never
+	// contain it since their secret is base64url encoded.
+	apiKeyIDSeparator = "."
+	// legacyKeyIDPrefix marks key IDs derived for keys issued without one
+	legacyKeyIDPrefix = "legacy_"
+)
+
+// GenerateAPIKey generates a new random API key of the form
+// sk_live_<key ID>.<secret>. The key ID is not secret; the server uses it to
+// find the key without comparing against every stored one.
+func GenerateAPIKey() (string, error) {
+	return generateToken(APIKeyPrefix)
+}
+
+// generateToken generates a random secret of the form <prefix><ID>.<secret>
+func generateToken(prefix string) (string, error) {
+	id := make([]byte, apiKeyIDLength)
+	secret := make([]byte, APIKeyLength)
+	if _, err := rand.Read(id); err != nil {
+		return "", fmt.Errorf("failed to generate key ID: %w", err)
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("failed to generate random key: %w", err)
+	}
+
+	return prefix + hex.EncodeToString(id) + apiKeyIDSeparator + base64.RawURLEncoding.EncodeToString(secret), nil
+}
+
+// APIKeyHasher derives what is stored for an API key: the key ID it is
+// looked up by and an HMAC-SHA256 digest of the whole key. The HMAC secret
+// must stay the same for the life of the keys.
+type APIKeyHasher struct {
+	secret []byte
+}
+
+// NewAPIKeyHasher creates a hasher keyed with secret
+func NewAPIKeyHasher(secret string) *APIKeyHasher {
+	return &APIKeyHasher{secret: []byte(secret)}
+}
+
+// Digest returns the hex encoded HMAC-SHA256 of the key
+func (h *APIKeyHasher) Digest(key string) string {
+	mac := hmac.New(sha256.New, h.secret)
+	mac.Write([]byte(key))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// KeyID returns the ID to look the key up by, or "" if the key is malformed.
+// Keys issued before key IDs existed get an ID derived from their digest,
+// which is stored the first time such a key is verified; legacy reports this.
+func (h *APIKeyHasher) KeyID(key string) (id string, legacy bool) {
+	rest, ok := strings.CutPrefix(key, APIKeyPrefix)
+	if !ok || rest == "" {
+		return "", false
+	}
+
+	if !strings.Contains(rest, apiKeyIDSeparator) {
+		return legacyKeyIDPrefix + h.Digest(key)[:2*apiKeyIDLength], true
+	}
+	return parseTokenID(rest), false
+}
+
+// parseTokenID returns the ID from <ID>.<secret>, or "" if it is malformed
+func parseTokenID(token string) string {
+	id, secret, found := strings.Cut(token, apiKeyIDSeparator)
+	if !found || len(id) != 2*apiKeyIDLength || secret == "" {
+		return ""
+	}
+	if _, err := hex.DecodeString(id); err != nil {
+		return ""
+	}
+	return id
+}
+
+// VerifyAPIKeyDigest compares a key's digest with the stored one in constant time
+func VerifyAPIKeyDigest(digest, stored string) bool {
+	return hmac.Equal([]byte(digest), []byte(stored))
+}
+
+// VerifyLegacyAPIKey checks a key against the bcrypt hash stored for keys
+// issued before key IDs existed
+func VerifyLegacyAPIKey(key, hash string) bool {
+	return VerifyPassword(key, hash)
+}
+
+// CheckAPIKeyUsable returns an error if a key with a valid secret must still
+// be refused, because it is disabled or has expired at now
+func CheckAPIKeyUsable(apiKey *models.APIKey, now time.Time) error {
+	if !apiKey.Enabled || apiKey.RevokedAt != nil {
+		return fmt.Errorf("API key is disabled")
+	}
+	if apiKey.Expired(now) {
+		return fmt.Errorf("API key has expired")
+	}
+	return nil
+}
+
+// APIKeyCache remembers recently verified API keys by digest, or by key ID
+// for signed requests, so that busy nodes do not cost a database lookup per
+// request. Entries expire after the
+// TTL; changes made through this server drop them immediately.
+type APIKeyCache struct {
+	ttl     time.Duration
+	mu      sync.Mutex
+	entries map[string]cachedAPIKey
+}
+
+// cachedAPIKey is a verified key and when it must be checked again
+type cachedAPIKey struct {
+	key     models.APIKey
+	expires time.Time
+}
+
+// NewAPIKeyCache creates a cache keeping keys for ttl; zero disables it
+func NewAPIKeyCache(ttl time.Duration) *APIKeyCache {
+	return &APIKeyCache{
+		ttl:     ttl,
+		entries: make(map[string]cachedAPIKey),
+	}
+}
+
+// Get returns a copy of the key verified with digest, if still fresh
+func (c *APIKeyCache) Get(digest string) (*models.APIKey, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[digest]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(entry.expires) {
+		delete(c.entries, digest)
+		return nil, false
+	}
+	key := entry.key
+	return &key, true
+}
+
+// Put remembers a key verified with digest
+func (c *APIKeyCache) Put(digest string, key *models.APIKey) {
+	if c.ttl <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[digest] = cachedAPIKey{key: *key, expires: time.Now().Add(c.ttl)}
+}
+
+// Invalidate drops the key with the given ID
+func (c *APIKeyCache) Invalidate(id uuid.UUID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for digest, entry := range c.entries {
+		if entry.key.ID == id {
+			delete(c.entries, digest)
+		}
+	}
+}
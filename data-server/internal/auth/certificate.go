@@ -0,0 +1,208 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// nodeIDURIPrefix starts the URI SAN that carries the node ID in
+// certificates issued to nodes
+const nodeIDURIPrefix = "urn:uuid:"
+
+// certificateBackdate allows for clocks running slightly behind the server's
+const certificateBackdate = 5 * time.Minute
+
+// NodeCertificate identifies a node by a verified client certificate
+type NodeCertificate struct {
+	NodeID       uuid.UUID
+	SerialNumber string
+	NotAfter     time.Time // Long-lived connections must stop using it after this
+}
+
+// NodeCertificateFromTLS returns the node identified by the verified client
+// certificate of a connection, or nil if the client sent none
+func NodeCertificateFromTLS(state *tls.ConnectionState) (*NodeCertificate, error) {
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return nil, nil
+	}
+
+	cert := state.VerifiedChains[0][0]
+	nodeID, err := NodeIDFromCertificate(cert)
+	if err != nil {
+		return nil, err
+	}
+	return &NodeCertificate{
+		NodeID:       nodeID,
+		SerialNumber: cert.SerialNumber.Text(16),
+		NotAfter:     cert.NotAfter,
+	}, nil
+}
+
+// NodeIDFromCertificate returns the node ID a certificate is issued to: a
+// urn:uuid: URI SAN if it has one, otherwise its subject common name
+func NodeIDFromCertificate(cert *x509.Certificate) (uuid.UUID, error) {
+	for _, uri := range cert.URIs {
+		if value, ok := strings.CutPrefix(uri.String(), nodeIDURIPrefix); ok {
+			return uuid.Parse(value)
+		}
+	}
+
+	nodeID, err := uuid.Parse(cert.Subject.CommonName)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("certificate names no node ID")
+	}
+	return nodeID, nil
+}
+
+// LoadCertPool reads the PEM certificates in files into a pool. Empty paths
+// are skipped; the pool is nil when there are none.
+func LoadCertPool(files ...string) (*x509.CertPool, error) {
+	var pool *x509.CertPool
+	for _, file := range files {
+		if file == "" {
+			continue
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+		}
+		if pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificates found in %s", file)
+		}
+	}
+	return pool, nil
+}
+
+// ServerTLSConfig loads the server certificate. With clientCAs it also asks
+// clients for a certificate signed by one of them; clients without one are
+// still served and authenticate with an API key instead.
+func ServerTLSConfig(certFile, keyFile string, clientCAs *x509.CertPool) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if clientCAs != nil {
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+		config.ClientCAs = clientCAs
+	}
+	return config, nil
+}
+
+// CertificateAuthority signs client certificates for nodes
+type CertificateAuthority struct {
+	cert    *x509.Certificate
+	certPEM []byte
+	key     crypto.Signer
+}
+
+// LoadCertificateAuthority loads a CA certificate and its private key from
+// PEM files
+func LoadCertificateAuthority(certFile, keyFile string) (*CertificateAuthority, error) {
+	pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load node CA: %w", err)
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse node CA certificate: %w", err)
+	}
+	if !cert.IsCA || cert.KeyUsage&x509.KeyUsageCertSign == 0 {
+		return nil, fmt.Errorf("node CA certificate may not sign certificates")
+	}
+	key, ok := pair.PrivateKey.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("node CA key cannot sign")
+	}
+
+	return &CertificateAuthority{
+		cert:    cert,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}),
+		key:     key,
+	}, nil
+}
+
+// CertificatePEM returns the CA certificate in PEM form
+func (ca *CertificateAuthority) CertificatePEM() []byte {
+	return ca.certPEM
+}
+
+// Pool returns a pool trusting this CA, for verifying the certificates it issued
+func (ca *CertificateAuthority) Pool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	return pool
+}
+
+// SignNodeCSR issues a client certificate for nodeID with the public key of
+// a PEM encoded certificate signing request. The node ID is taken from the
+// caller, not the request, and is set as both the common name and a
+// urn:uuid: URI SAN. The certificate never outlives the CA.
+func (ca *CertificateAuthority) SignNodeCSR(csrPEM []byte, nodeID uuid.UUID, validity time.Duration) (*x509.Certificate, []byte, error) {
+	block, _ := pem.Decode(csrPEM)
+	if block == nil || block.Type != "CERTIFICATE REQUEST" {
+		return nil, nil, fmt.Errorf("invalid CSR: no PEM certificate request found")
+	}
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid CSR: %w", err)
+	}
+	if err := csr.CheckSignature(); err != nil {
+		return nil, nil, fmt.Errorf("invalid CSR: %w", err)
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate serial number: %w", err)
+	}
+	uri, err := url.Parse(nodeIDURIPrefix + nodeID.String())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	notAfter := now.Add(validity)
+	if notAfter.After(ca.cert.NotAfter) {
+		notAfter = ca.cert.NotAfter
+	}
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: nodeID.String()},
+		URIs:                  []*url.URL{uri},
+		NotBefore:             now.Add(-certificateBackdate),
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, csr.PublicKey, ca.key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to sign certificate: %w", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse signed certificate: %w", err)
+	}
+
+	return cert, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), nil
+}
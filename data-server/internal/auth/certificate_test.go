@@ -0,0 +1,217 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// writeTestCA writes a self-signed CA valid for validity to a temp dir and
+// returns the certificate and key paths
+func writeTestCA(t *testing.T, validity time.Duration, isCA bool) (string, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test node CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(validity),
+		IsCA:                  isCA,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+	}
+	if !isCA {
+		template.KeyUsage = x509.KeyUsageDigitalSignature
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "ca.crt"), filepath.Join(dir, "ca.key")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+// testCSR returns a PEM certificate request with the given common name
+func testCSR(t *testing.T, commonName string) []byte {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: commonName},
+	}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der})
+}
+
+func TestLoadCertificateAuthority(t *testing.T) {
+	t.Run("CA", func(t *testing.T) {
+		certFile, keyFile := writeTestCA(t, 24*time.Hour, true)
+		ca, err := LoadCertificateAuthority(certFile, keyFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if block, _ := pem.Decode(ca.CertificatePEM()); block == nil || block.Type != "CERTIFICATE" {
+			t.Error("CertificatePEM is not a PEM certificate")
+		}
+	})
+
+	t.Run("not a CA", func(t *testing.T) {
+		certFile, keyFile := writeTestCA(t, 24*time.Hour, false)
+		if _, err := LoadCertificateAuthority(certFile, keyFile); err == nil {
+			t.Error("loaded a certificate that may not sign certificates")
+		}
+	})
+
+	t.Run("missing files", func(t *testing.T) {
+		if _, err := LoadCertificateAuthority(filepath.Join(t.TempDir(), "ca.crt"), filepath.Join(t.TempDir(), "ca.key")); err == nil {
+			t.Error("loaded a CA from missing files")
+		}
+	})
+}
+
+func TestSignNodeCSR(t *testing.T) {
+	certFile, keyFile := writeTestCA(t, 30*24*time.Hour, true)
+	ca, err := LoadCertificateAuthority(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodeID := uuid.New()
+
+	t.Run("issues a client certificate", func(t *testing.T) {
+		// The common name in the request is ignored
+		cert, certPEM, err := ca.SignNodeCSR(testCSR(t, "someone else"), nodeID, 24*time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if block, _ := pem.Decode(certPEM); block == nil || block.Type != "CERTIFICATE" {
+			t.Error("signed certificate is not PEM encoded")
+		}
+		if cert.Subject.CommonName != nodeID.String() {
+			t.Errorf("CommonName = %q, want %q", cert.Subject.CommonName, nodeID)
+		}
+		if len(cert.URIs) != 1 || cert.URIs[0].String() != "urn:uuid:"+nodeID.String() {
+			t.Errorf("URIs = %v, want urn:uuid:%s", cert.URIs, nodeID)
+		}
+		if got := cert.NotAfter.Sub(cert.NotBefore); got < 24*time.Hour || got > 24*time.Hour+2*certificateBackdate {
+			t.Errorf("validity = %v, want about 24h", got)
+		}
+
+		_, err = cert.Verify(x509.VerifyOptions{
+			Roots:     ca.Pool(),
+			KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		})
+		if err != nil {
+			t.Errorf("certificate does not verify for client auth: %v", err)
+		}
+	})
+
+	t.Run("capped at CA expiry", func(t *testing.T) {
+		cert, _, err := ca.SignNodeCSR(testCSR(t, ""), nodeID, 365*24*time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cert.NotAfter.After(ca.cert.NotAfter) {
+			t.Errorf("NotAfter = %v, after the CA's %v", cert.NotAfter, ca.cert.NotAfter)
+		}
+	})
+
+	t.Run("invalid CSR", func(t *testing.T) {
+		for name, csr := range map[string][]byte{
+			"empty":     nil,
+			"not PEM":   []byte("not a csr"),
+			"wrong PEM": pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte("x")}),
+			"garbage":   pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: []byte("x")}),
+		} {
+			if _, _, err := ca.SignNodeCSR(csr, nodeID, time.Hour); err == nil {
+				t.Errorf("%s: signed an invalid CSR", name)
+			}
+		}
+	})
+}
+
+func TestNodeIDFromCertificate(t *testing.T) {
+	nodeID, other := uuid.New(), uuid.New()
+	nodeURI, _ := url.Parse("urn:uuid:" + nodeID.String())
+	webURI, _ := url.Parse("https://example.com")
+
+	tests := []struct {
+		name    string
+		cert    *x509.Certificate
+		want    uuid.UUID
+		wantErr bool
+	}{
+		{name: "URI SAN", cert: &x509.Certificate{URIs: []*url.URL{webURI, nodeURI}}, want: nodeID},
+		{name: "URI SAN before CN", cert: &x509.Certificate{URIs: []*url.URL{nodeURI}, Subject: pkix.Name{CommonName: other.String()}}, want: nodeID},
+		{name: "common name", cert: &x509.Certificate{Subject: pkix.Name{CommonName: nodeID.String()}}, want: nodeID},
+		{name: "no node ID", cert: &x509.Certificate{URIs: []*url.URL{webURI}, Subject: pkix.Name{CommonName: "node"}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NodeIDFromCertificate(tt.cert)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("NodeIDFromCertificate = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNodeCertificateFromTLS(t *testing.T) {
+	nodeID := uuid.New()
+	cert := &x509.Certificate{SerialNumber: big.NewInt(255), Subject: pkix.Name{CommonName: nodeID.String()}}
+
+	for name, state := range map[string]*tls.ConnectionState{
+		"no TLS":         nil,
+		"no certificate": {},
+		"unverified":     {PeerCertificates: []*x509.Certificate{cert}},
+	} {
+		got, err := NodeCertificateFromTLS(state)
+		if got != nil || err != nil {
+			t.Errorf("%s: NodeCertificateFromTLS = %v, %v; want nil, nil", name, got, err)
+		}
+	}
+
+	got, err := NodeCertificateFromTLS(&tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.NodeID != nodeID || got.SerialNumber != "ff" {
+		t.Errorf("NodeCertificateFromTLS = %+v, want node %v serial ff", got, nodeID)
+	}
+}
@@ -0,0 +1,50 @@
+package auth
+
+import (
+	"context"
+
+	"mark7888/speedtest-data-server/pkg/models"
+)
+
+// apiKeyContextKey is the context key under which the verified API key is stored
+type apiKeyContextKey struct{}
+
+// WithAPIKey returns a copy of ctx carrying the API key that authenticated
+// the request, whatever transport it came in on
+func WithAPIKey(ctx context.Context, apiKey *models.APIKey) context.Context {
+	return context.WithValue(ctx, apiKeyContextKey{}, apiKey)
+}
+
+// APIKeyFromContext returns the API key carried by ctx
+func APIKeyFromContext(ctx context.Context) (*models.APIKey, bool) {
+	apiKey, _ := ctx.Value(apiKeyContextKey{}).(*models.APIKey)
+	return apiKey, apiKey != nil
+}
+
+// nodeCertificateContextKey is the context key under which the verified
+// client certificate is stored
+type nodeCertificateContextKey struct{}
+
+// WithNodeCertificate returns a copy of ctx carrying the client certificate
+// that authenticated the request instead of an API key
+func WithNodeCertificate(ctx context.Context, cert *NodeCertificate) context.Context {
+	return context.WithValue(ctx, nodeCertificateContextKey{}, cert)
+}
+
+// NodeCertificateFromContext returns the client certificate carried by ctx
+func NodeCertificateFromContext(ctx context.Context) (*NodeCertificate, bool) {
+	cert, _ := ctx.Value(nodeCertificateContextKey{}).(*NodeCertificate)
+	return cert, cert != nil
+}
+
+// WithNodeCredentials returns a copy of ctx carrying whichever of apiKey and
+// cert is set, for work that outlives the request that authenticated them
+func WithNodeCredentials(ctx context.Context, apiKey *models.APIKey, cert *NodeCertificate) context.Context {
+	if apiKey != nil {
+		ctx = WithAPIKey(ctx, apiKey)
+	}
+	if cert != nil {
+		ctx = WithNodeCertificate(ctx, cert)
+	}
+	return ctx
+}
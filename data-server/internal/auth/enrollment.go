@@ -0,0 +1,42 @@
+package auth
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"mark7888/speedtest-data-server/pkg/models"
+)
+
+// EnrollmentTokenPrefix is the prefix for enrollment tokens. They are built
+// like API keys, with a public token ID and a secret, but cannot be used as
+// one.
+const EnrollmentTokenPrefix = "et_"
+
+// GenerateEnrollmentToken generates a new random enrollment token of the form
+// et_<token ID>.<secret>
+func GenerateEnrollmentToken() (string, error) {
+	return generateToken(EnrollmentTokenPrefix)
+}
+
+// EnrollmentTokenID returns the ID to look the token up by, or "" if the
+// token is malformed
+func EnrollmentTokenID(token string) string {
+	rest, ok := strings.CutPrefix(token, EnrollmentTokenPrefix)
+	if !ok {
+		return ""
+	}
+	return parseTokenID(rest)
+}
+
+// CheckEnrollmentTokenUsable returns an error if a token with a valid secret
+// must still be refused, because it has expired at now or has no uses left
+func CheckEnrollmentTokenUsable(token *models.EnrollmentToken, now time.Time) error {
+	if token.Expired(now) {
+		return fmt.Errorf("enrollment token has expired")
+	}
+	if token.Uses >= token.MaxUses {
+		return fmt.Errorf("enrollment token has been used up")
+	}
+	return nil
+}
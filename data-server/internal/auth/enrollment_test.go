@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"mark7888/speedtest-data-server/pkg/models"
+)
+
+func TestEnrollmentTokenID(t *testing.T) {
+	token, err := GenerateEnrollmentToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := EnrollmentTokenID(token)
+	if id == "" || !strings.HasPrefix(token, EnrollmentTokenPrefix+id+apiKeyIDSeparator) {
+		t.Fatalf("EnrollmentTokenID(%q) = %q", token, id)
+	}
+
+	tests := []struct {
+		name   string
+		token  string
+		wantID string
+	}{
+		{name: "valid", token: "et_0123456789abcdef.c2VjcmV0", wantID: "0123456789abcdef"},
+		{name: "API key", token: "sk_live_0123456789abcdef.c2VjcmV0"},
+		{name: "no separator", token: "et_0123456789abcdef"},
+		{name: "short ID", token: "et_0123.c2VjcmV0"},
+		{name: "no secret", token: "et_0123456789abcdef."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if id := EnrollmentTokenID(tt.token); id != tt.wantID {
+				t.Errorf("EnrollmentTokenID(%q) = %q, want %q", tt.token, id, tt.wantID)
+			}
+		})
+	}
+
+	// Enrollment tokens must never pass as API keys
+	if id, _ := NewAPIKeyHasher("secret").KeyID(token); id != "" {
+		t.Errorf("enrollment token has API key ID %q", id)
+	}
+}
+
+func TestCheckEnrollmentTokenUsable(t *testing.T) {
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		token   models.EnrollmentToken
+		wantErr string
+	}{
+		{name: "unused", token: models.EnrollmentToken{MaxUses: 1, ExpiresAt: now.Add(time.Second)}},
+		{name: "uses left", token: models.EnrollmentToken{MaxUses: 3, Uses: 2, ExpiresAt: now.Add(time.Second)}},
+		{name: "used up", token: models.EnrollmentToken{MaxUses: 3, Uses: 3, ExpiresAt: now.Add(time.Second)}, wantErr: "enrollment token has been used up"},
+		{name: "expired", token: models.EnrollmentToken{MaxUses: 1, ExpiresAt: now}, wantErr: "enrollment token has expired"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckEnrollmentTokenUsable(&tt.token, now)
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("err = %v, want nil", err)
+			}
+			if tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr) {
+				t.Errorf("err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -1,63 +1,185 @@
 package auth
 
 import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 )
 
+// SourceOIDC marks tokens issued after single sign-on. Tokens issued for a
+// password login have no source.
+const SourceOIDC = "oidc"
+
+const (
+	// purposeMFA marks pre-authentication tokens, issued for a correct
+	// password while the second factor is outstanding. They only grant
+	// completing the login.
+	purposeMFA = "mfa"
+
+	// MFATokenExpiry is how long a user has to enter the second factor
+	MFATokenExpiry = 5 * time.Minute
+)
+
+// jwtKeyIDLength is the length of signing key IDs in bytes
+const jwtKeyIDLength = 8
+
 // JWTClaims represents the claims in a JWT token
 type JWTClaims struct {
-	Username string `json:"username"`
+	Username  string `json:"username"`
+	Role      string `json:"role"`
+	Source    string `json:"source,omitempty"`
+	SessionID string `json:"sid,omitempty"`
+	Purpose   string `json:"purpose,omitempty"`
 	jwt.RegisteredClaims
 }
 
-// JWTManager handles JWT token generation and validation
+// JWTManager handles JWT token generation and validation. Tokens are signed
+// with the current secret and name it by key ID in their header, so tokens
+// signed with a previous secret still validate while the secret is rotated.
 type JWTManager struct {
-	secret []byte
-	expiry time.Duration
+	keys         map[string][]byte // By key ID
+	currentKeyID string
+	expiry       time.Duration
 }
 
-// NewJWTManager creates a new JWT manager
+// NewJWTManager creates a new JWT manager signing with secret
 func NewJWTManager(secret string, expiry time.Duration) *JWTManager {
+	keyID := JWTKeyID(secret)
 	return &JWTManager{
-		secret: []byte(secret),
-		expiry: expiry,
+		keys:         map[string][]byte{keyID: []byte(secret)},
+		currentKeyID: keyID,
+		expiry:       expiry,
 	}
 }
 
-// Generate creates a new JWT token for a username
-func (m *JWTManager) Generate(username string) (string, time.Time, error) {
+// AcceptPreviousSecrets lets tokens signed with secrets the server used
+// before keep validating until they expire. New tokens are signed with the
+// current secret only.
+func (m *JWTManager) AcceptPreviousSecrets(secrets []string) {
+	for _, secret := range secrets {
+		m.keys[JWTKeyID(secret)] = []byte(secret)
+	}
+}
+
+// JWTKeyID derives the key ID tokens signed with secret carry. It does not
+// reveal the secret.
+func JWTKeyID(secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("jwt key id"))
+	return hex.EncodeToString(mac.Sum(nil)[:jwtKeyIDLength])
+}
+
+// Generate creates a new access token for a username with a user role in a
+// session. source records how the user logged in.
+func (m *JWTManager) Generate(username, role, source string, sessionID uuid.UUID) (string, time.Time, error) {
 	now := time.Now()
 	expiresAt := now.Add(m.expiry)
 
+	claims := JWTClaims{
+		Username:  username,
+		Role:      role,
+		Source:    source,
+		SessionID: sessionID.String(),
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+		},
+	}
+
+	tokenString, err := m.sign(claims)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	return tokenString, expiresAt, nil
+}
+
+// GenerateMFAToken creates a short-lived pre-authentication token for a
+// user who still has to enter their second factor. Its ID lets the server
+// count the attempts made with it.
+func (m *JWTManager) GenerateMFAToken(username string) (string, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(MFATokenExpiry)
+
 	claims := JWTClaims{
 		Username: username,
+		Purpose:  purposeMFA,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        rand.Text(),
 			ExpiresAt: jwt.NewNumericDate(expiresAt),
 			IssuedAt:  jwt.NewNumericDate(now),
 			NotBefore: jwt.NewNumericDate(now),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(m.secret)
+	tokenString, err := m.sign(claims)
 	if err != nil {
-		return "", time.Time{}, fmt.Errorf("failed to sign token: %w", err)
+		return "", time.Time{}, err
 	}
 
 	return tokenString, expiresAt, nil
 }
 
-// Validate validates a JWT token and returns the claims
+// sign signs claims with the current secret
+func (m *JWTManager) sign(claims JWTClaims) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["kid"] = m.currentKeyID
+	tokenString, err := token.SignedString(m.keys[m.currentKeyID])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign token: %w", err)
+	}
+	return tokenString, nil
+}
+
+// Validate validates an access token and returns the claims. Whether its
+// session is still active is up to the caller. Pre-authentication tokens and
+// tokens from before sessions are not valid here.
 func (m *JWTManager) Validate(tokenString string) (*JWTClaims, error) {
+	claims, err := m.parse(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Purpose != "" {
+		return nil, fmt.Errorf("token is for %s only", claims.Purpose)
+	}
+	if claims.SessionID == "" {
+		return nil, fmt.Errorf("token belongs to no session")
+	}
+	return claims, nil
+}
+
+// ValidateMFAToken validates a pre-authentication token and returns its claims
+func (m *JWTManager) ValidateMFAToken(tokenString string) (*JWTClaims, error) {
+	claims, err := m.parse(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Purpose != purposeMFA || claims.ID == "" {
+		return nil, fmt.Errorf("not a pre-authentication token")
+	}
+	return claims, nil
+}
+
+// parse checks a token's signature and expiry and returns its claims
+func (m *JWTManager) parse(tokenString string) (*JWTClaims, error) {
 	token, err := jwt.ParseWithClaims(tokenString, &JWTClaims{}, func(token *jwt.Token) (interface{}, error) {
 		// Verify signing method
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
-		return m.secret, nil
+		keyID, _ := token.Header["kid"].(string)
+		key, ok := m.keys[keyID]
+		if !ok {
+			return nil, fmt.Errorf("unknown signing key %q", keyID)
+		}
+		return key, nil
 	})
 
 	if err != nil {
@@ -70,13 +192,3 @@ func (m *JWTManager) Validate(tokenString string) (*JWTClaims, error) {
 
 	return nil, fmt.Errorf("invalid token")
 }
-
-// Refresh generates a new token for an existing valid token
-func (m *JWTManager) Refresh(tokenString string) (string, time.Time, error) {
-	claims, err := m.Validate(tokenString)
-	if err != nil {
-		return "", time.Time{}, err
-	}
-
-	return m.Generate(claims.Username)
-}
@@ -0,0 +1,87 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+func TestJWTKeyRotation(t *testing.T) {
+	sessionID := uuid.New()
+	oldManager := NewJWTManager("old-secret", time.Hour)
+	oldToken, _, err := oldManager.Generate("alice", "admin", "", sessionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	manager := NewJWTManager("new-secret", time.Hour)
+	if _, err := manager.Validate(oldToken); err == nil {
+		t.Fatal("token signed with an unknown secret accepted")
+	}
+
+	manager.AcceptPreviousSecrets([]string{"old-secret"})
+	claims, err := manager.Validate(oldToken)
+	if err != nil || claims.SessionID != sessionID.String() {
+		t.Fatalf("token signed with the previous secret: %+v, %v", claims, err)
+	}
+
+	// New tokens are signed with the current secret only
+	newToken, _, err := manager.Generate("alice", "admin", "", sessionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, _, err := jwt.NewParser().ParseUnverified(newToken, &JWTClaims{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kid := token.Header["kid"]; kid != JWTKeyID("new-secret") {
+		t.Errorf("kid = %v, want the key ID of the current secret", kid)
+	}
+	if _, err := oldManager.Validate(newToken); err == nil {
+		t.Error("token signed with the new secret validated with the old one")
+	}
+	if JWTKeyID("new-secret") == JWTKeyID("old-secret") {
+		t.Error("different secrets have the same key ID")
+	}
+}
+
+func TestJWTRequiresSession(t *testing.T) {
+	manager := NewJWTManager("test-secret", time.Hour)
+
+	// Tokens from before sessions name none and cannot be revoked
+	legacy := jwt.NewWithClaims(jwt.SigningMethodHS256, JWTClaims{
+		Username: "alice",
+		Role:     "admin",
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	})
+	legacy.Header["kid"] = JWTKeyID("test-secret")
+	tokenString, err := legacy.SignedString([]byte("test-secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := manager.Validate(tokenString); err == nil {
+		t.Error("token without a session accepted")
+	}
+}
+
+func TestRefreshTokenID(t *testing.T) {
+	token, err := GenerateRefreshToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id := RefreshTokenID(token); len(id) != 2*apiKeyIDLength {
+		t.Errorf("RefreshTokenID(%q) = %q", token, id)
+	}
+
+	enrollmentToken, err := GenerateEnrollmentToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id := RefreshTokenID(enrollmentToken); id != "" {
+		t.Errorf("enrollment token taken as a refresh token with ID %q", id)
+	}
+}
@@ -0,0 +1,537 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"mark7888/speedtest-data-server/pkg/models"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// oidcHTTPTimeout bounds each request to the identity provider
+	oidcHTTPTimeout = 10 * time.Second
+
+	// oidcKeyRefreshInterval is how often an unknown key ID may trigger
+	// fetching the provider's keys again, so tokens with made-up key IDs
+	// cannot make the server hammer the provider
+	oidcKeyRefreshInterval = time.Minute
+
+	// oidcClockLeeway allows for clock differences with the provider
+	oidcClockLeeway = time.Minute
+
+	// oidcMaxResponseSize bounds what is read from the provider
+	oidcMaxResponseSize = 1 << 20
+)
+
+// oidcSigningMethods are the ID token algorithms accepted. Symmetric
+// algorithms are not: the client secret is not meant to sign tokens.
+var oidcSigningMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}
+
+// OIDCProvider logs admin users in through an OpenID Connect identity
+// provider, with the authorization code flow and PKCE. The provider's
+// endpoints are discovered on first use, so the server starts even while
+// the provider is unreachable.
+type OIDCProvider struct {
+	issuer       string
+	clientID     string
+	clientSecret string
+	redirectURL  string
+	scopes       []string
+	client       *http.Client
+
+	mu          sync.Mutex
+	metadata    *oidcMetadata
+	keys        map[string]crypto.PublicKey
+	keysFetched time.Time
+}
+
+// oidcMetadata is the part of the provider's discovery document in use
+type oidcMetadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// NewOIDCProvider creates a provider for the issuer at issuerURL.
+// clientSecret may be empty for public clients, which rely on PKCE alone.
+func NewOIDCProvider(issuerURL, clientID, clientSecret, redirectURL string, scopes []string) *OIDCProvider {
+	return &OIDCProvider{
+		issuer:       strings.TrimSuffix(issuerURL, "/"),
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		redirectURL:  redirectURL,
+		scopes:       scopes,
+		client:       &http.Client{Timeout: oidcHTTPTimeout},
+	}
+}
+
+// OIDCLogin holds the secrets of one login attempt, kept by the server from
+// sending the user to the provider until the provider sends them back
+type OIDCLogin struct {
+	State        string
+	Nonce        string
+	CodeVerifier string
+}
+
+// NewOIDCLogin generates the state, nonce and PKCE code verifier of a login
+func NewOIDCLogin() (*OIDCLogin, error) {
+	values := make([]string, 3)
+	for i := range values {
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			return nil, fmt.Errorf("failed to generate login secrets: %w", err)
+		}
+		values[i] = base64.RawURLEncoding.EncodeToString(b)
+	}
+	return &OIDCLogin{State: values[0], Nonce: values[1], CodeVerifier: values[2]}, nil
+}
+
+// codeChallenge returns the S256 PKCE challenge for the login's verifier
+func (l *OIDCLogin) codeChallenge() string {
+	sum := sha256.Sum256([]byte(l.CodeVerifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// AuthCodeURL returns the provider URL to send the user to for login
+func (p *OIDCProvider) AuthCodeURL(ctx context.Context, login *OIDCLogin) (string, error) {
+	metadata, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	authURL, err := url.Parse(metadata.AuthorizationEndpoint)
+	if err != nil {
+		return "", fmt.Errorf("invalid authorization endpoint: %w", err)
+	}
+	query := authURL.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", p.clientID)
+	query.Set("redirect_uri", p.redirectURL)
+	query.Set("scope", strings.Join(p.scopes, " "))
+	query.Set("state", login.State)
+	query.Set("nonce", login.Nonce)
+	query.Set("code_challenge", login.codeChallenge())
+	query.Set("code_challenge_method", "S256")
+	authURL.RawQuery = query.Encode()
+
+	return authURL.String(), nil
+}
+
+// Exchange redeems an authorization code at the provider's token endpoint
+// and returns the claims of the verified ID token
+func (p *OIDCProvider) Exchange(ctx context.Context, code string, login *OIDCLogin) (jwt.MapClaims, error) {
+	metadata, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.redirectURL)
+	form.Set("code_verifier", login.CodeVerifier)
+	form.Set("client_id", p.clientID)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, metadata.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.clientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.clientID), url.QueryEscape(p.clientSecret))
+	}
+
+	var token struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	status, err := p.doJSON(req, &token)
+	if err != nil {
+		return nil, fmt.Errorf("token request failed: %w", err)
+	}
+	if token.Error != "" {
+		return nil, fmt.Errorf("token request failed: %s: %s", token.Error, token.ErrorDescription)
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("token request failed with status %d", status)
+	}
+	if token.IDToken == "" {
+		return nil, fmt.Errorf("token response has no ID token")
+	}
+
+	return p.VerifyIDToken(ctx, token.IDToken, login.Nonce)
+}
+
+// VerifyIDToken checks an ID token's signature against the provider's keys,
+// its issuer, audience and lifetime, and that it carries nonce
+func (p *OIDCProvider) VerifyIDToken(ctx context.Context, rawIDToken, nonce string) (jwt.MapClaims, error) {
+	metadata, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(rawIDToken, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.publicKey(ctx, metadata, kid)
+	},
+		jwt.WithValidMethods(oidcSigningMethods),
+		jwt.WithIssuer(metadata.Issuer),
+		jwt.WithAudience(p.clientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(oidcClockLeeway),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ID token: %w", err)
+	}
+
+	tokenNonce, _ := claims["nonce"].(string)
+	if subtle.ConstantTimeCompare([]byte(tokenNonce), []byte(nonce)) != 1 {
+		return nil, fmt.Errorf("invalid ID token: nonce does not match")
+	}
+	if audience, _ := claims.GetAudience(); len(audience) > 1 {
+		if azp, _ := claims["azp"].(string); azp != p.clientID {
+			return nil, fmt.Errorf("invalid ID token: issued to another client")
+		}
+	}
+	if subject, _ := claims.GetSubject(); subject == "" {
+		return nil, fmt.Errorf("invalid ID token: no subject")
+	}
+
+	return claims, nil
+}
+
+// discover fetches the provider's discovery document, once it succeeds
+func (p *OIDCProvider) discover(ctx context.Context) (*oidcMetadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.metadata != nil {
+		return p.metadata, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create discovery request: %w", err)
+	}
+	var metadata oidcMetadata
+	status, err := p.doJSON(req, &metadata)
+	if err != nil {
+		return nil, fmt.Errorf("OIDC discovery failed: %w", err)
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("OIDC discovery failed with status %d", status)
+	}
+
+	// The issuer must be exactly the one configured, or tokens from another
+	// issuer serving the same document could be accepted
+	if strings.TrimSuffix(metadata.Issuer, "/") != p.issuer {
+		return nil, fmt.Errorf("OIDC discovery returned issuer %q, want %q", metadata.Issuer, p.issuer)
+	}
+	if metadata.AuthorizationEndpoint == "" || metadata.TokenEndpoint == "" || metadata.JWKSURI == "" {
+		return nil, fmt.Errorf("OIDC discovery document is missing endpoints")
+	}
+
+	p.metadata = &metadata
+	return p.metadata, nil
+}
+
+// publicKey returns the provider key with ID kid, fetching the provider's
+// keys again if it is unknown, as after the provider rotated its keys
+func (p *OIDCProvider) publicKey(ctx context.Context, metadata *oidcMetadata, kid string) (crypto.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key, ok := p.lookupKey(kid); ok {
+		return key, nil
+	}
+	if time.Since(p.keysFetched) < oidcKeyRefreshInterval {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	keys, err := p.fetchKeys(ctx, metadata.JWKSURI)
+	if err != nil {
+		return nil, err
+	}
+	p.keys = keys
+	p.keysFetched = time.Now()
+
+	if key, ok := p.lookupKey(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// lookupKey finds a cached key by ID. Tokens without a key ID are accepted
+// only while the provider publishes a single key.
+func (p *OIDCProvider) lookupKey(kid string) (crypto.PublicKey, bool) {
+	if kid == "" {
+		if len(p.keys) != 1 {
+			return nil, false
+		}
+		for _, key := range p.keys {
+			return key, true
+		}
+	}
+	key, ok := p.keys[kid]
+	return key, ok
+}
+
+// fetchKeys fetches and parses the provider's JSON Web Key Set
+func (p *OIDCProvider) fetchKeys(ctx context.Context, jwksURI string) (map[string]crypto.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, jwksURI, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create key set request: %w", err)
+	}
+	var keySet struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	status, err := p.doJSON(req, &keySet)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch provider keys: %w", err)
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch provider keys: status %d", status)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(keySet.Keys))
+	for _, jwk := range keySet.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			// Keys of unsupported types do not make the others unusable
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+	return keys, nil
+}
+
+// doJSON sends req and decodes a JSON response body into out, whatever the
+// status, since OAuth errors come as JSON too
+func (p *OIDCProvider) doJSON(req *http.Request, out interface{}) (int, error) {
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, oidcMaxResponseSize))
+	if err != nil {
+		return 0, fmt.Errorf("failed to read response: %w", err)
+	}
+	if err := json.Unmarshal(body, out); err != nil && resp.StatusCode == http.StatusOK {
+		return 0, fmt.Errorf("invalid response: %w", err)
+	}
+	return resp.StatusCode, nil
+}
+
+// jsonWebKey is a public key in a JSON Web Key Set
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// publicKey converts an RSA or EC key to its Go form
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	decodeInt := func(s string) (*big.Int, error) {
+		b, err := base64.RawURLEncoding.DecodeString(s)
+		if err != nil || len(b) == 0 {
+			return nil, fmt.Errorf("invalid key parameter")
+		}
+		return new(big.Int).SetBytes(b), nil
+	}
+
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeInt(k.E)
+		if err != nil || !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key parameter")
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key parameter")
+		}
+		// Also checks that the point is on the curve
+		return ecdsa.ParseUncompressedPublicKey(curve, append(append([]byte{4}, x...), y...))
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+// OIDCRoleMapping turns the claims of a verified ID token into a username
+// and a user role
+type OIDCRoleMapping struct {
+	UsernameClaim string            // Claim holding the username; the subject if missing
+	GroupsClaim   string            // Claim listing the user's groups; dots reach into nested claims
+	Roles         map[string]string // Group to role
+	DefaultRole   string            // Role of users in none of the mapped groups; empty denies them
+}
+
+// Username returns the user's name from the username claim, or the subject
+// if the provider did not send it
+func (m OIDCRoleMapping) Username(claims jwt.MapClaims) string {
+	if username, ok := claimValue(claims, m.UsernameClaim).(string); ok && username != "" {
+		return username
+	}
+	subject, _ := claims.GetSubject()
+	return subject
+}
+
+// Role returns the most privileged role any of the user's groups maps to,
+// or the default role. It returns false if the user gets no role.
+func (m OIDCRoleMapping) Role(claims jwt.MapClaims) (string, bool) {
+	var groups []string
+	switch value := claimValue(claims, m.GroupsClaim).(type) {
+	case string:
+		groups = []string{value}
+	case []interface{}:
+		for _, group := range value {
+			if s, ok := group.(string); ok {
+				groups = append(groups, s)
+			}
+		}
+	}
+
+	role := ""
+	for _, group := range groups {
+		mapped, ok := m.Roles[group]
+		if ok && (role == "" || !models.RoleAllows(role, mapped)) {
+			role = mapped
+		}
+	}
+	if role == "" {
+		role = m.DefaultRole
+	}
+	return role, models.ValidUserRole(role)
+}
+
+// claimValue returns the claim at a dot separated path, such as
+// realm_access.roles
+func claimValue(claims jwt.MapClaims, path string) interface{} {
+	if path == "" {
+		return nil
+	}
+	var value interface{} = map[string]interface{}(claims)
+	for _, name := range strings.Split(path, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = object[name]
+	}
+	return value
+}
+
+// OIDCLoginStore keeps logins in progress between sending the user to the
+// provider and the callback. Each login can be taken once, within ttl.
+type OIDCLoginStore struct {
+	ttl        time.Duration
+	maxPending int
+	mu         sync.Mutex
+	logins     map[string]pendingOIDCLogin
+}
+
+// pendingOIDCLogin is a login in progress and when it expires
+type pendingOIDCLogin struct {
+	login     *OIDCLogin
+	expiresAt time.Time
+}
+
+// NewOIDCLoginStore creates a store for at most maxPending logins at once,
+// each valid for ttl
+func NewOIDCLoginStore(ttl time.Duration, maxPending int) *OIDCLoginStore {
+	return &OIDCLoginStore{
+		ttl:        ttl,
+		maxPending: maxPending,
+		logins:     make(map[string]pendingOIDCLogin),
+	}
+}
+
+// Put stores a login under its state. It fails when too many logins are
+// in progress, which bounds what unauthenticated requests can allocate.
+func (s *OIDCLoginStore) Put(login *OIDCLogin, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.logins) >= s.maxPending {
+		for state, pending := range s.logins {
+			if now.After(pending.expiresAt) {
+				delete(s.logins, state)
+			}
+		}
+		if len(s.logins) >= s.maxPending {
+			return fmt.Errorf("too many logins in progress")
+		}
+	}
+	s.logins[login.State] = pendingOIDCLogin{login: login, expiresAt: now.Add(s.ttl)}
+	return nil
+}
+
+// Take removes and returns the login with the given state, if it has not
+// expired
+func (s *OIDCLoginStore) Take(state string, now time.Time) (*OIDCLogin, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pending, ok := s.logins[state]
+	if !ok {
+		return nil, false
+	}
+	delete(s.logins, state)
+	if now.After(pending.expiresAt) {
+		return nil, false
+	}
+	return pending.login, true
+}
@@ -0,0 +1,307 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"mark7888/speedtest-data-server/internal/auth/oidctest"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testRedirectURL = "https://monitor.example.com/api/v1/admin/oidc/callback"
+
+// authorize follows authURL at the provider and returns the code and state
+// it redirects back with
+func authorize(t *testing.T, authURL string) (string, string) {
+	t.Helper()
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("authorization returned %d, want a redirect", resp.StatusCode)
+	}
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(location.String(), testRedirectURL) {
+		t.Fatalf("redirected to %s, want the callback", location)
+	}
+	return location.Query().Get("code"), location.Query().Get("state")
+}
+
+func TestOIDCLogin(t *testing.T) {
+	ctx := context.Background()
+	idp := oidctest.NewProvider(t, "dashboard", "client-secret")
+	idp.SetClaims(map[string]interface{}{"sub": "user-1", "preferred_username": "alice", "groups": []string{"net-ops"}})
+
+	provider := NewOIDCProvider(idp.Issuer(), "dashboard", "client-secret", testRedirectURL, []string{"openid", "profile"})
+
+	t.Run("code flow", func(t *testing.T) {
+		login, err := NewOIDCLogin()
+		if err != nil {
+			t.Fatal(err)
+		}
+		authURL, err := provider.AuthCodeURL(ctx, login)
+		if err != nil {
+			t.Fatal(err)
+		}
+		code, state := authorize(t, authURL)
+		if state != login.State {
+			t.Errorf("state = %q, want %q", state, login.State)
+		}
+
+		claims, err := provider.Exchange(ctx, code, login)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if claims["preferred_username"] != "alice" || claims["nonce"] != login.Nonce {
+			t.Errorf("claims = %v, want alice with the login's nonce", claims)
+		}
+
+		// Codes are single use
+		if _, err := provider.Exchange(ctx, code, login); err == nil {
+			t.Error("redeemed a code twice")
+		}
+	})
+
+	t.Run("wrong code verifier", func(t *testing.T) {
+		login, _ := NewOIDCLogin()
+		authURL, err := provider.AuthCodeURL(ctx, login)
+		if err != nil {
+			t.Fatal(err)
+		}
+		code, _ := authorize(t, authURL)
+
+		other, _ := NewOIDCLogin()
+		login.CodeVerifier = other.CodeVerifier
+		if _, err := provider.Exchange(ctx, code, login); err == nil || !strings.Contains(err.Error(), "invalid_grant") {
+			t.Errorf("err = %v, want invalid_grant", err)
+		}
+	})
+
+	t.Run("wrong client secret", func(t *testing.T) {
+		wrong := NewOIDCProvider(idp.Issuer(), "dashboard", "wrong", testRedirectURL, []string{"openid"})
+		login, _ := NewOIDCLogin()
+		authURL, err := wrong.AuthCodeURL(ctx, login)
+		if err != nil {
+			t.Fatal(err)
+		}
+		code, _ := authorize(t, authURL)
+		if _, err := wrong.Exchange(ctx, code, login); err == nil || !strings.Contains(err.Error(), "invalid_client") {
+			t.Errorf("err = %v, want invalid_client", err)
+		}
+	})
+
+	t.Run("issuer mismatch", func(t *testing.T) {
+		wrong := NewOIDCProvider(idp.Issuer()+"/realms/other", "dashboard", "client-secret", testRedirectURL, []string{"openid"})
+		login, _ := NewOIDCLogin()
+		if _, err := wrong.AuthCodeURL(ctx, login); err == nil {
+			t.Error("discovery accepted a provider with another issuer")
+		}
+	})
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	ctx := context.Background()
+	idp := oidctest.NewProvider(t, "dashboard", "")
+	provider := NewOIDCProvider(idp.Issuer(), "dashboard", "", testRedirectURL, []string{"openid"})
+
+	now := time.Now()
+	valid := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"iss":   idp.Issuer(),
+			"aud":   "dashboard",
+			"sub":   "user-1",
+			"iat":   now.Unix(),
+			"exp":   now.Add(5 * time.Minute).Unix(),
+			"nonce": "nonce-1",
+		}
+	}
+	signed := func(change func(jwt.MapClaims)) string {
+		claims := valid()
+		change(claims)
+		token, err := idp.SignIDToken(claims)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherSigned := jwt.NewWithClaims(jwt.SigningMethodRS256, valid())
+	otherSigned.Header["kid"] = "test-key"
+	forged, err := otherSigned.SignedString(otherKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A token signed with the client secret, as if it were an HMAC key
+	symmetric, err := jwt.NewWithClaims(jwt.SigningMethodHS256, valid()).SignedString([]byte("client-secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{name: "valid", token: signed(func(jwt.MapClaims) {})},
+		{name: "several audiences with azp", token: signed(func(c jwt.MapClaims) { c["aud"] = []string{"dashboard", "api"}; c["azp"] = "dashboard" })},
+		{name: "several audiences without azp", token: signed(func(c jwt.MapClaims) { c["aud"] = []string{"dashboard", "api"} }), wantErr: true},
+		{name: "wrong nonce", token: signed(func(c jwt.MapClaims) { c["nonce"] = "nonce-2" }), wantErr: true},
+		{name: "no nonce", token: signed(func(c jwt.MapClaims) { delete(c, "nonce") }), wantErr: true},
+		{name: "wrong audience", token: signed(func(c jwt.MapClaims) { c["aud"] = "other-app" }), wantErr: true},
+		{name: "wrong issuer", token: signed(func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" }), wantErr: true},
+		{name: "expired", token: signed(func(c jwt.MapClaims) { c["exp"] = now.Add(-time.Hour).Unix() }), wantErr: true},
+		{name: "no expiry", token: signed(func(c jwt.MapClaims) { delete(c, "exp") }), wantErr: true},
+		{name: "no subject", token: signed(func(c jwt.MapClaims) { delete(c, "sub") }), wantErr: true},
+		{name: "signed with another key", token: forged, wantErr: true},
+		{name: "signed with HMAC", token: symmetric, wantErr: true},
+		{name: "not a token", token: "not.a.token", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := provider.VerifyIDToken(ctx, tt.token, "nonce-1")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestJSONWebKeyPublicKey(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	point, err := ecKey.PublicKey.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	x := base64.RawURLEncoding.EncodeToString(point[1:33])
+	y := base64.RawURLEncoding.EncodeToString(point[33:])
+
+	tests := []struct {
+		name    string
+		key     jsonWebKey
+		wantErr bool
+	}{
+		{name: "EC", key: jsonWebKey{Kty: "EC", Crv: "P-256", X: x, Y: y}},
+		{name: "EC point not on curve", key: jsonWebKey{Kty: "EC", Crv: "P-256", X: x, Y: x}, wantErr: true},
+		{name: "unknown curve", key: jsonWebKey{Kty: "EC", Crv: "secp256k1", X: x, Y: y}, wantErr: true},
+		{name: "RSA without modulus", key: jsonWebKey{Kty: "RSA", E: "AQAB"}, wantErr: true},
+		{name: "symmetric", key: jsonWebKey{Kty: "oct"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := tt.key.publicKey()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && !ecKey.PublicKey.Equal(key) {
+				t.Error("parsed key differs from the original")
+			}
+		})
+	}
+}
+
+func TestOIDCRoleMapping(t *testing.T) {
+	mapping := OIDCRoleMapping{
+		UsernameClaim: "preferred_username",
+		GroupsClaim:   "realm_access.roles",
+		Roles:         map[string]string{"net-viewers": "viewer", "net-ops": "operator", "net-admins": "admin"},
+	}
+	groups := func(names ...interface{}) jwt.MapClaims {
+		return jwt.MapClaims{"sub": "user-1", "realm_access": map[string]interface{}{"roles": names}}
+	}
+
+	tests := []struct {
+		name        string
+		claims      jwt.MapClaims
+		defaultRole string
+		wantRole    string
+		wantOK      bool
+	}{
+		{name: "one group", claims: groups("net-ops"), wantRole: "operator", wantOK: true},
+		{name: "highest role wins", claims: groups("net-admins", "net-viewers", "net-ops"), wantRole: "admin", wantOK: true},
+		{name: "unmapped groups", claims: groups("sales", 42), wantOK: false},
+		{name: "unmapped groups with default", claims: groups("sales"), defaultRole: "viewer", wantRole: "viewer", wantOK: true},
+		{name: "mapped group beats default", claims: groups("net-ops"), defaultRole: "viewer", wantRole: "operator", wantOK: true},
+		{name: "single group as string", claims: jwt.MapClaims{"realm_access": map[string]interface{}{"roles": "net-admins"}}, wantRole: "admin", wantOK: true},
+		{name: "no groups claim", claims: jwt.MapClaims{"sub": "user-1"}, wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := mapping
+			m.DefaultRole = tt.defaultRole
+			role, ok := m.Role(tt.claims)
+			if role != tt.wantRole && tt.wantOK || ok != tt.wantOK {
+				t.Errorf("Role = %q, %v; want %q, %v", role, ok, tt.wantRole, tt.wantOK)
+			}
+		})
+	}
+
+	if got := mapping.Username(jwt.MapClaims{"sub": "user-1", "preferred_username": "alice"}); got != "alice" {
+		t.Errorf("Username = %q, want alice", got)
+	}
+	if got := mapping.Username(jwt.MapClaims{"sub": "user-1"}); got != "user-1" {
+		t.Errorf("Username without the claim = %q, want the subject", got)
+	}
+}
+
+func TestOIDCLoginStore(t *testing.T) {
+	now := time.Now()
+	store := NewOIDCLoginStore(10*time.Minute, 2)
+
+	first, _ := NewOIDCLogin()
+	second, _ := NewOIDCLogin()
+	third, _ := NewOIDCLogin()
+	if err := store.Put(first, now); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Put(second, now.Add(5*time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Put(third, now.Add(5*time.Minute)); err == nil {
+		t.Error("stored more logins than allowed")
+	}
+
+	if login, ok := store.Take(first.State, now.Add(time.Minute)); !ok || login != first {
+		t.Errorf("Take = %v, %v; want the first login", login, ok)
+	}
+	if _, ok := store.Take(first.State, now.Add(time.Minute)); ok {
+		t.Error("took a login twice")
+	}
+	if _, ok := store.Take(second.State, now.Add(16*time.Minute)); ok {
+		t.Error("took an expired login")
+	}
+
+	// Expired logins make room for new ones
+	if err := store.Put(first, now); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Put(third, now.Add(20*time.Minute)); err != nil {
+		t.Errorf("Put after expiry: %v", err)
+	}
+}
@@ -0,0 +1,24 @@
+package auth
+
+import "strings"
+
+// RefreshTokenPrefix is the prefix for refresh tokens. They are built like
+// API keys, with a public token ID and a secret, but cannot be used as one.
+const RefreshTokenPrefix = "rt_"
+
+// GenerateRefreshToken generates a new random refresh token of the form
+// rt_<token ID>.<secret>. A session's refresh token is replaced every time
+// it is used.
+func GenerateRefreshToken() (string, error) {
+	return generateToken(RefreshTokenPrefix)
+}
+
+// RefreshTokenID returns the ID to look the token up by, or "" if the token
+// is malformed
+func RefreshTokenID(token string) string {
+	rest, ok := strings.CutPrefix(token, RefreshTokenPrefix)
+	if !ok {
+		return ""
+	}
+	return parseTokenID(rest)
+}
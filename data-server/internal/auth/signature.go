@@ -0,0 +1,188 @@
+package auth
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Headers of a signed node request. A signed request carries no API key,
+// only its key ID, so a proxy that can read the traffic learns nothing it
+// could sign other requests with.
+const (
+	SignatureKeyIDHeader     = "X-Signature-Key-ID"
+	SignatureTimestampHeader = "X-Signature-Timestamp"
+	SignatureNonceHeader     = "X-Signature-Nonce"
+	SignatureHeader          = "X-Signature"
+)
+
+// MessageSignatureMethod takes the place of the HTTP method when signing an
+// MQTT message, whose topic takes the place of the request URI
+const MessageSignatureMethod = "PUBLISH"
+
+const (
+	// signingKeyLabel is the message a key's signing key is derived with.
+	// Nodes derive the same key from their API key.
+	signingKeyLabel = "speedtest-node request signing v1"
+
+	// signingKeyEncryptionLabel derives the key that encrypts stored signing keys
+	signingKeyEncryptionLabel = "api key signing key encryption"
+
+	// Nonces are random; the bounds only keep the nonce cache small
+	minNonceLength = 16
+	maxNonceLength = 64
+)
+
+// DeriveSigningKey returns the key requests signed with an API key are
+// signed with: HMAC-SHA256 of a fixed label keyed with the API key
+func DeriveSigningKey(plainKey string) []byte {
+	mac := hmac.New(sha256.New, []byte(plainKey))
+	mac.Write([]byte(signingKeyLabel))
+	return mac.Sum(nil)
+}
+
+// RequestSignature returns the hex encoded HMAC-SHA256 of a request under
+// signingKey. It covers the method, the request URI (path and query), the
+// timestamp, the nonce and the SHA-256 of the body exactly as sent, one per
+// line.
+func RequestSignature(signingKey []byte, method, requestURI, timestamp, nonce string, body []byte) string {
+	bodyHash := sha256.Sum256(body)
+	mac := hmac.New(sha256.New, signingKey)
+	mac.Write([]byte(strings.Join([]string{method, requestURI, timestamp, nonce, hex.EncodeToString(bodyHash[:])}, "\n")))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyRequestSignature compares a request signature with the expected one
+// in constant time
+func VerifyRequestSignature(signature, expected string) bool {
+	return hmac.Equal([]byte(signature), []byte(expected))
+}
+
+// CheckSignatureTimestamp parses a signed request's Unix timestamp and
+// checks that it is within tolerance of now either way
+func CheckSignatureTimestamp(timestamp string, now time.Time, tolerance time.Duration) (time.Time, error) {
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid signature timestamp")
+	}
+	signedAt := time.Unix(seconds, 0)
+	if now.Sub(signedAt).Abs() > tolerance {
+		return time.Time{}, fmt.Errorf("signature timestamp is outside the allowed window")
+	}
+	return signedAt, nil
+}
+
+// CheckSignatureNonce checks that a nonce has a usable length
+func CheckSignatureNonce(nonce string) error {
+	if len(nonce) < minNonceLength || len(nonce) > maxNonceLength {
+		return fmt.Errorf("signature nonce must be %d to %d characters", minNonceLength, maxNonceLength)
+	}
+	return nil
+}
+
+// SealSigningKey derives the signing key of an API key and encrypts it for
+// storage. Unlike the key's digest the signing key must be recoverable, so
+// it is encrypted with a key derived from the hasher's secret rather than
+// stored as is.
+func (h *APIKeyHasher) SealSigningKey(plainKey string) (string, error) {
+	return h.seal(signingKeyEncryptionLabel, DeriveSigningKey(plainKey))
+}
+
+// OpenSigningKey decrypts a signing key sealed by SealSigningKey
+func (h *APIKeyHasher) OpenSigningKey(sealed string) ([]byte, error) {
+	key, err := h.open(signingKeyEncryptionLabel, sealed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt signing key: %w", err)
+	}
+	return key, nil
+}
+
+// seal encrypts a secret for storage with AES-256-GCM, keyed with the
+// HMAC-SHA256 of label under the hasher's secret, so each kind of stored
+// secret has its own key
+func (h *APIKeyHasher) seal(label string, plaintext []byte) (string, error) {
+	aead, err := h.cipher(label)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	sealed := aead.Seal(nonce, nonce, plaintext, nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// open decrypts a secret sealed with the same label
+func (h *APIKeyHasher) open(label, sealed string) ([]byte, error) {
+	aead, err := h.cipher(label)
+	if err != nil {
+		return nil, err
+	}
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil || len(data) < aead.NonceSize() {
+		return nil, fmt.Errorf("invalid sealed secret")
+	}
+	return aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+}
+
+// cipher returns the AES-256-GCM cipher for secrets sealed with label
+func (h *APIKeyHasher) cipher(label string) (cipher.AEAD, error) {
+	mac := hmac.New(sha256.New, h.secret)
+	mac.Write([]byte(label))
+	block, err := aes.NewCipher(mac.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// NonceCache remembers the nonces of signed requests until their timestamp
+// falls out of the allowed window, after which a replay is refused for
+// being stale anyway
+type NonceCache struct {
+	tolerance time.Duration
+	mu        sync.Mutex
+	entries   map[string]time.Time
+	lastSweep time.Time
+}
+
+// NewNonceCache creates a cache for requests signed within tolerance of now
+func NewNonceCache(tolerance time.Duration) *NonceCache {
+	return &NonceCache{
+		tolerance: tolerance,
+		entries:   make(map[string]time.Time),
+	}
+}
+
+// Use records the nonce of a request signed at signedAt with keyID. It
+// returns false if the nonce was already used with the same key.
+func (c *NonceCache) Use(keyID, nonce string, signedAt, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if now.Sub(c.lastSweep) > c.tolerance {
+		for entry, expires := range c.entries {
+			if now.After(expires) {
+				delete(c.entries, entry)
+			}
+		}
+		c.lastSweep = now
+	}
+
+	entry := keyID + ":" + nonce
+	if expires, ok := c.entries[entry]; ok && !now.After(expires) {
+		return false
+	}
+	c.entries[entry] = signedAt.Add(c.tolerance)
+	return true
+}
@@ -0,0 +1,106 @@
+package auth
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestRequestSignature(t *testing.T) {
+	key := DeriveSigningKey("sk_live_0123456789abcdef.c2VjcmV0")
+	base := RequestSignature(key, "POST", "/api/v1/node/alive", "1760000000", "0123456789abcdef", []byte(`{"a":1}`))
+
+	if again := RequestSignature(key, "POST", "/api/v1/node/alive", "1760000000", "0123456789abcdef", []byte(`{"a":1}`)); again != base {
+		t.Fatal("signature is not deterministic")
+	}
+	if !VerifyRequestSignature(base, base) {
+		t.Error("matching signatures do not verify")
+	}
+
+	// Changing any signed part changes the signature
+	tests := map[string]string{
+		"key":       RequestSignature(DeriveSigningKey("sk_live_0123456789abcdef.b3RoZXI"), "POST", "/api/v1/node/alive", "1760000000", "0123456789abcdef", []byte(`{"a":1}`)),
+		"method":    RequestSignature(key, "PUT", "/api/v1/node/alive", "1760000000", "0123456789abcdef", []byte(`{"a":1}`)),
+		"path":      RequestSignature(key, "POST", "/api/v1/measurements", "1760000000", "0123456789abcdef", []byte(`{"a":1}`)),
+		"query":     RequestSignature(key, "POST", "/api/v1/node/alive?x=1", "1760000000", "0123456789abcdef", []byte(`{"a":1}`)),
+		"timestamp": RequestSignature(key, "POST", "/api/v1/node/alive", "1760000001", "0123456789abcdef", []byte(`{"a":1}`)),
+		"nonce":     RequestSignature(key, "POST", "/api/v1/node/alive", "1760000000", "0123456789abcdeg", []byte(`{"a":1}`)),
+		"body":      RequestSignature(key, "POST", "/api/v1/node/alive", "1760000000", "0123456789abcdef", []byte(`{"a":2}`)),
+	}
+	for part, signature := range tests {
+		if VerifyRequestSignature(signature, base) {
+			t.Errorf("changing the %s does not change the signature", part)
+		}
+	}
+}
+
+func TestCheckSignatureTimestamp(t *testing.T) {
+	now := time.Unix(1760000000, 0)
+	unix := func(d time.Duration) string { return strconv.FormatInt(now.Add(d).Unix(), 10) }
+
+	tests := []struct {
+		name      string
+		timestamp string
+		wantErr   bool
+	}{
+		{name: "now", timestamp: unix(0)},
+		{name: "recent", timestamp: unix(-4 * time.Minute)},
+		{name: "slightly ahead", timestamp: unix(4 * time.Minute)},
+		{name: "stale", timestamp: unix(-6 * time.Minute), wantErr: true},
+		{name: "too far ahead", timestamp: unix(6 * time.Minute), wantErr: true},
+		{name: "not a number", timestamp: "yesterday", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := CheckSignatureTimestamp(tt.timestamp, now, 5*time.Minute)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSealSigningKey(t *testing.T) {
+	key := "sk_live_0123456789abcdef.c2VjcmV0"
+	hasher := NewAPIKeyHasher("secret")
+
+	sealed, err := hasher.SealSigningKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opened, err := hasher.OpenSigningKey(sealed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(opened) != string(DeriveSigningKey(key)) {
+		t.Error("opened signing key differs from the derived one")
+	}
+
+	if _, err := NewAPIKeyHasher("other").OpenSigningKey(sealed); err == nil {
+		t.Error("signing key opened with another secret")
+	}
+	if _, err := hasher.OpenSigningKey("not sealed"); err == nil {
+		t.Error("garbage opened as a signing key")
+	}
+}
+
+func TestNonceCache(t *testing.T) {
+	now := time.Unix(1760000000, 0)
+	cache := NewNonceCache(time.Minute)
+
+	if !cache.Use("key", "nonce", now, now) {
+		t.Fatal("first use refused")
+	}
+	if cache.Use("key", "nonce", now, now.Add(30*time.Second)) {
+		t.Error("nonce reused within the window")
+	}
+	if !cache.Use("other", "nonce", now, now) {
+		t.Error("same nonce refused for another key")
+	}
+	// A replay after the window fails its timestamp check; the cache need
+	// not remember the nonce any longer
+	if !cache.Use("key", "nonce", now, now.Add(2*time.Minute)) {
+		t.Error("nonce still remembered after the window")
+	}
+}
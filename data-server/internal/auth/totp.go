@@ -0,0 +1,256 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// TOTPDigits is the length of TOTP codes
+	TOTPDigits = 6
+	// TOTPPeriod is how long each TOTP code is valid
+	TOTPPeriod = 30 * time.Second
+	// TOTPSkew is how many periods before and after the current one are
+	// accepted, for clocks and users that are a little slow
+	TOTPSkew = 1
+
+	// RecoveryCodeCount is how many recovery codes an account gets at a time
+	RecoveryCodeCount = 10
+
+	// totpSecretLength is the size of generated TOTP secrets in bytes, the
+	// HMAC-SHA1 key size RFC 4226 recommends
+	totpSecretLength = 20
+	// recoveryCodeLength is the size of recovery codes in bytes
+	recoveryCodeLength = 10
+
+	// totpSecretEncryptionLabel derives the key that encrypts stored TOTP secrets
+	totpSecretEncryptionLabel = "user totp secret encryption"
+)
+
+// totpEncoding is the base32 alphabet authenticator apps expect, unpadded
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateTOTPSecret generates a random base32 encoded TOTP secret
+func GenerateTOTPSecret() (string, error) {
+	secret := make([]byte, totpSecretLength)
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("failed to generate TOTP secret: %w", err)
+	}
+	return totpEncoding.EncodeToString(secret), nil
+}
+
+// ValidateTOTPSecret checks that a secret is base32 encoded, as entered
+// into an authenticator app
+func ValidateTOTPSecret(secret string) error {
+	key, err := decodeTOTPSecret(secret)
+	if err != nil || len(key) < 10 {
+		return fmt.Errorf("TOTP secret must be base32 encoded and at least 16 characters long")
+	}
+	return nil
+}
+
+// decodeTOTPSecret decodes a base32 secret, ignoring case, spaces and padding
+func decodeTOTPSecret(secret string) ([]byte, error) {
+	secret = strings.ToUpper(strings.ReplaceAll(secret, " ", ""))
+	return totpEncoding.DecodeString(strings.TrimRight(secret, "="))
+}
+
+// TOTPURI returns the otpauth:// URI that authenticator apps enroll a
+// secret from, usually shown as a QR code
+func TOTPURI(issuer, account, secret string) string {
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprint(TOTPDigits))
+	query.Set("period", fmt.Sprint(int(TOTPPeriod.Seconds())))
+
+	return (&url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + issuer + ":" + account,
+		RawQuery: query.Encode(),
+	}).String()
+}
+
+// TOTPStep returns the time step a moment falls into
+func TOTPStep(at time.Time) int64 {
+	return at.Unix() / int64(TOTPPeriod.Seconds())
+}
+
+// TOTPCode returns the code of a secret for a time step (RFC 6238 with
+// HMAC-SHA1, the algorithm all authenticator apps support)
+func TOTPCode(secret string, step int64) (string, error) {
+	key, err := decodeTOTPSecret(secret)
+	if err != nil {
+		return "", fmt.Errorf("invalid TOTP secret: %w", err)
+	}
+
+	var message [8]byte
+	binary.BigEndian.PutUint64(message[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(message[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", TOTPDigits, value%1000000), nil
+}
+
+// VerifyTOTP checks a code against a secret within TOTPSkew periods of now.
+// It returns the time step the code belongs to, which callers must record
+// and refuse codes at or before next time, so a code works only once.
+func VerifyTOTP(secret, code string, now time.Time) (int64, bool) {
+	if !IsTOTPCode(code) {
+		return 0, false
+	}
+
+	current := TOTPStep(now)
+	for step := current - TOTPSkew; step <= current+TOTPSkew; step++ {
+		expected, err := TOTPCode(secret, step)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// IsTOTPCode reports whether code looks like a TOTP code rather than a
+// recovery code
+func IsTOTPCode(code string) bool {
+	if len(code) != TOTPDigits {
+		return false
+	}
+	for _, r := range code {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// GenerateRecoveryCodes generates a set of one-time recovery codes, grouped
+// for reading as xxxx-xxxx-xxxx-xxxx
+func GenerateRecoveryCodes() ([]string, error) {
+	codes := make([]string, RecoveryCodeCount)
+	for i := range codes {
+		raw := make([]byte, recoveryCodeLength)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, fmt.Errorf("failed to generate recovery code: %w", err)
+		}
+		encoded := strings.ToLower(totpEncoding.EncodeToString(raw))
+		groups := make([]string, 0, len(encoded)/4)
+		for j := 0; j < len(encoded); j += 4 {
+			groups = append(groups, encoded[j:min(j+4, len(encoded))])
+		}
+		codes[i] = strings.Join(groups, "-")
+	}
+	return codes, nil
+}
+
+// NormalizeRecoveryCode removes what users may type differently, so a code
+// matches however it was entered
+func NormalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, code)
+}
+
+// RecoveryCodeDigest returns what is stored for a recovery code
+func (h *APIKeyHasher) RecoveryCodeDigest(code string) string {
+	return h.Digest("recovery:" + NormalizeRecoveryCode(code))
+}
+
+// SealTOTPSecret encrypts a TOTP secret for storage. Codes are computed from
+// the secret itself, so it has to be recoverable.
+func (h *APIKeyHasher) SealTOTPSecret(secret string) (string, error) {
+	return h.seal(totpSecretEncryptionLabel, []byte(secret))
+}
+
+// OpenTOTPSecret decrypts a TOTP secret sealed by SealTOTPSecret
+func (h *APIKeyHasher) OpenTOTPSecret(sealed string) (string, error) {
+	secret, err := h.open(totpSecretEncryptionLabel, sealed)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt TOTP secret: %w", err)
+	}
+	return string(secret), nil
+}
+
+// AttemptLimiter counts failed attempts at something that expires, such as
+// a pre-authentication token, and refuses further attempts once a limit is
+// reached or the thing was used
+type AttemptLimiter struct {
+	max       int
+	mu        sync.Mutex
+	entries   map[string]attempts
+	lastSweep time.Time
+}
+
+// attempts is what an AttemptLimiter knows of one ID
+type attempts struct {
+	failures  int
+	done      bool
+	expiresAt time.Time
+}
+
+// NewAttemptLimiter creates a limiter allowing max failed attempts per ID
+func NewAttemptLimiter(max int) *AttemptLimiter {
+	return &AttemptLimiter{
+		max:     max,
+		entries: make(map[string]attempts),
+	}
+}
+
+// Allow reports whether another attempt for id may be made
+func (l *AttemptLimiter) Allow(id string, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entry, ok := l.entries[id]
+	return !ok || now.After(entry.expiresAt) || !entry.done && entry.failures < l.max
+}
+
+// Fail records a failed attempt for id, which expires at expiresAt
+func (l *AttemptLimiter) Fail(id string, expiresAt, now time.Time) {
+	l.update(id, expiresAt, now, func(entry *attempts) { entry.failures++ })
+}
+
+// Done records that id was used successfully, so it allows no more attempts
+func (l *AttemptLimiter) Done(id string, expiresAt, now time.Time) {
+	l.update(id, expiresAt, now, func(entry *attempts) { entry.done = true })
+}
+
+func (l *AttemptLimiter) update(id string, expiresAt, now time.Time, change func(*attempts)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) > time.Minute {
+		for entryID, entry := range l.entries {
+			if now.After(entry.expiresAt) {
+				delete(l.entries, entryID)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	entry := l.entries[id]
+	entry.expiresAt = expiresAt
+	change(&entry)
+	l.entries[id] = entry
+}
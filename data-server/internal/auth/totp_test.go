@@ -0,0 +1,209 @@
+package auth
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// rfc6238Secret is the SHA-1 key of the RFC 6238 test vectors, base32 encoded
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCode(t *testing.T) {
+	// RFC 6238 appendix B, truncated to six digits
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{unix: 59, want: "287082"},
+		{unix: 1111111109, want: "081804"},
+		{unix: 1111111111, want: "050471"},
+		{unix: 1234567890, want: "005924"},
+		{unix: 2000000000, want: "279037"},
+	}
+
+	for _, tt := range tests {
+		got, err := TOTPCode(rfc6238Secret, TOTPStep(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("code at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestVerifyTOTP(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	step := TOTPStep(now)
+	code := func(step int64) string {
+		c, err := TOTPCode(rfc6238Secret, step)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	tests := []struct {
+		name     string
+		code     string
+		wantStep int64
+		wantOK   bool
+	}{
+		{name: "current", code: code(step), wantStep: step, wantOK: true},
+		{name: "previous period", code: code(step - 1), wantStep: step - 1, wantOK: true},
+		{name: "next period", code: code(step + 1), wantStep: step + 1, wantOK: true},
+		{name: "outside the skew window", code: code(step - 2), wantOK: false},
+		{name: "wrong code", code: "000000", wantOK: false},
+		{name: "not a code", code: "abcdef", wantOK: false},
+		{name: "too long", code: code(step) + "0", wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotStep, ok := VerifyTOTP(rfc6238Secret, tt.code, now)
+			if ok != tt.wantOK || ok && gotStep != tt.wantStep {
+				t.Errorf("VerifyTOTP = %d, %v; want %d, %v", gotStep, ok, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestGenerateTOTPSecret(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(secret) != 32 || ValidateTOTPSecret(secret) != nil {
+		t.Errorf("secret %q is not 160 bits of base32", secret)
+	}
+	// Authenticator apps show secrets in groups and lower case
+	if err := ValidateTOTPSecret(strings.ToLower("JBSW Y3DP EHPK 3PXP")); err != nil {
+		t.Errorf("spaced lower case secret: %v", err)
+	}
+	if err := ValidateTOTPSecret("not base32!"); err == nil {
+		t.Error("accepted a secret that is not base32")
+	}
+
+	uri, err := url.Parse(TOTPURI("Speedtest Monitor", "alice", secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uri.Scheme != "otpauth" || uri.Host != "totp" || uri.Path != "/Speedtest Monitor:alice" {
+		t.Errorf("URI = %s, want otpauth://totp/Speedtest Monitor:alice", uri)
+	}
+	if q := uri.Query(); q.Get("secret") != secret || q.Get("issuer") != "Speedtest Monitor" || q.Get("digits") != "6" || q.Get("period") != "30" {
+		t.Errorf("URI parameters = %v", q)
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != RecoveryCodeCount {
+		t.Fatalf("got %d codes, want %d", len(codes), RecoveryCodeCount)
+	}
+
+	seen := make(map[string]bool)
+	for _, code := range codes {
+		if len(code) != 19 || strings.Count(code, "-") != 3 || IsTOTPCode(code) {
+			t.Errorf("code %q is not of the form xxxx-xxxx-xxxx-xxxx", code)
+		}
+		if seen[code] {
+			t.Errorf("code %q generated twice", code)
+		}
+		seen[code] = true
+	}
+
+	hasher := NewAPIKeyHasher("test-secret")
+	typed := strings.ToUpper(strings.ReplaceAll(codes[0], "-", " "))
+	if hasher.RecoveryCodeDigest(typed) != hasher.RecoveryCodeDigest(codes[0]) {
+		t.Error("recovery code typed in upper case with spaces does not match")
+	}
+	if hasher.RecoveryCodeDigest(codes[0]) == hasher.RecoveryCodeDigest(codes[1]) {
+		t.Error("different recovery codes have the same digest")
+	}
+}
+
+func TestSealTOTPSecret(t *testing.T) {
+	hasher := NewAPIKeyHasher("test-secret")
+	sealed, err := hasher.SealTOTPSecret(rfc6238Secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(sealed, rfc6238Secret) {
+		t.Error("sealed secret contains the secret")
+	}
+	if secret, err := hasher.OpenTOTPSecret(sealed); err != nil || secret != rfc6238Secret {
+		t.Errorf("OpenTOTPSecret = %q, %v", secret, err)
+	}
+
+	// Signing keys and TOTP secrets are sealed with different keys
+	if _, err := hasher.OpenSigningKey(sealed); err == nil {
+		t.Error("opened a TOTP secret as a signing key")
+	}
+	if _, err := NewAPIKeyHasher("other-secret").OpenTOTPSecret(sealed); err == nil {
+		t.Error("opened a TOTP secret with another server secret")
+	}
+}
+
+func TestMFAToken(t *testing.T) {
+	manager := NewJWTManager("test-secret", time.Hour)
+
+	mfaToken, expiresAt, err := manager.GenerateMFAToken("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if time.Until(expiresAt) > MFATokenExpiry {
+		t.Errorf("pre-authentication token expires at %v, want within %v", expiresAt, MFATokenExpiry)
+	}
+	claims, err := manager.ValidateMFAToken(mfaToken)
+	if err != nil || claims.Username != "alice" || claims.ID == "" {
+		t.Fatalf("ValidateMFAToken = %+v, %v", claims, err)
+	}
+	if _, err := manager.Validate(mfaToken); err == nil {
+		t.Error("pre-authentication token accepted as a session token")
+	}
+
+	session, _, err := manager.Generate("alice", "admin", "", uuid.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := manager.ValidateMFAToken(session); err == nil {
+		t.Error("session token accepted as a pre-authentication token")
+	}
+}
+
+func TestAttemptLimiter(t *testing.T) {
+	now := time.Now()
+	expiresAt := now.Add(5 * time.Minute)
+	limiter := NewAttemptLimiter(2)
+
+	for i := 0; i < 2; i++ {
+		if !limiter.Allow("a", now) {
+			t.Fatalf("attempt %d refused", i+1)
+		}
+		limiter.Fail("a", expiresAt, now)
+	}
+	if limiter.Allow("a", now) {
+		t.Error("allowed a third attempt")
+	}
+	if !limiter.Allow("b", now) {
+		t.Error("failures of one ID limited another")
+	}
+
+	limiter.Done("b", expiresAt, now)
+	if limiter.Allow("b", now) {
+		t.Error("allowed an attempt after success")
+	}
+
+	// Entries are forgotten once what they count expires
+	if !limiter.Allow("a", expiresAt.Add(time.Second)) {
+		t.Error("still limited after expiry")
+	}
+}
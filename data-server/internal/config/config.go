@@ -4,9 +4,13 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
+
+	"mark7888/speedtest-data-server/internal/auth"
+	"mark7888/speedtest-data-server/pkg/models"
 )
 
 // Config holds all application configuration
@@ -15,9 +19,16 @@ type Config struct {
 	Database  DatabaseConfig
 	Admin     AdminConfig
 	JWT       JWTConfig
+	OIDC      OIDCConfig
+	APIKeys   APIKeyConfig
 	Node      NodeConfig
 	Retention RetentionConfig
+	Quality   QualityConfig
 	API       APIConfig
+	GRPC      GRPCConfig
+	MQTT      MQTTConfig
+	Metrics   MetricsConfig
+	Tracing   TracingConfig
 	Logging   LoggingConfig
 }
 
@@ -29,6 +40,12 @@ type ServerConfig struct {
 	TLSEnabled bool
 	TLSCert    string
 	TLSKey     string
+
+	// Client certificate authentication for nodes
+	TLSClientCA      string        // CA bundle trusted for node client certificates
+	NodeCACert       string        // CA that signs node CSRs; also trusted for client certificates
+	NodeCAKey        string        // Private key of NodeCACert
+	NodeCertValidity time.Duration // Lifetime of certificates signed by NodeCACert
 }
 
 // DatabaseConfig holds PostgreSQL configuration
@@ -48,14 +65,50 @@ type DatabaseConfig struct {
 
 // AdminConfig holds admin user configuration
 type AdminConfig struct {
-	Username string
-	Password string
+	Username   string
+	Password   string
+	TOTPSecret string // Base32 TOTP secret; when set the admin account needs a code to log in
+	TOTPIssuer string // Name authenticator apps show for this server
 }
 
 // JWTConfig holds JWT token configuration
 type JWTConfig struct {
-	Secret string
-	Expiry time.Duration
+	Secret          string
+	PreviousSecrets []string      // Earlier secrets whose tokens still validate while the secret is rotated
+	Expiry          time.Duration // Lifetime of access tokens
+	SessionLifetime time.Duration // How long refresh tokens renew a login before the password is needed again
+}
+
+// OIDCConfig holds single sign-on configuration for the admin API
+type OIDCConfig struct {
+	IssuerURL    string // OpenID Connect provider; empty disables single sign-on
+	ClientID     string
+	ClientSecret string // Empty for public clients, which rely on PKCE alone
+	RedirectURL  string // This server's /api/v1/admin/oidc/callback URL as registered at the provider
+	Scopes       []string
+
+	UsernameClaim string            // ID token claim used as the username; falls back to sub
+	GroupsClaim   string            // ID token claim listing the user's groups; dots reach into nested claims
+	RoleMapping   map[string]string // Group to role; the highest role among the user's groups wins
+	DefaultRole   string            // Role for users in no mapped group; empty denies them
+
+	// Where the dashboard receives the token after login, in the URL
+	// fragment; empty returns it as JSON from the callback
+	PostLoginRedirect string
+}
+
+// Enabled reports whether single sign-on is configured
+func (c OIDCConfig) Enabled() bool {
+	return c.IssuerURL != ""
+}
+
+// APIKeyConfig holds node API key verification configuration
+type APIKeyConfig struct {
+	Secret   string        // HMAC key for stored API key digests; defaults to the JWT secret
+	CacheTTL time.Duration // How long a verified key is trusted without a database lookup
+	// How far the timestamp of a signed request may be from the server's
+	// clock; nonces are remembered for as long
+	SignatureTolerance time.Duration
 }
 
 // NodeConfig holds node monitoring configuration
@@ -63,6 +116,11 @@ type NodeConfig struct {
 	AliveTimeout        time.Duration
 	InactiveTimeout     time.Duration
 	StatusCheckInterval time.Duration
+	ControlChannel      bool          // Accept WebSocket control channels from nodes
+	CommandTTL          time.Duration // How long a queued node command may take before it expires
+	ClockSkewThreshold  time.Duration // Node clock offsets beyond this are flagged on stored results
+	ClockSkewCorrection bool          // Shift timestamps of flagged results by the node's clock offset
+	MaxFutureSkew       time.Duration // Results timestamped further ahead of server time are rejected
 }
 
 // RetentionConfig holds data retention configuration
@@ -72,11 +130,51 @@ type RetentionConfig struct {
 	CleanupInterval  time.Duration
 }
 
+// QualityConfig holds the plausibility rules applied to incoming measurements
+type QualityConfig struct {
+	Action           string // What to do with implausible measurements: quarantine, reject or accept
+	MaxBandwidthMbps int    // Download and upload bandwidth above this is implausible
+	MaxLatencyMs     int    // Ping and transfer latencies above this are implausible
+}
+
 // APIConfig holds API-related configuration
 type APIConfig struct {
-	RateLimit      int
-	Timeout        time.Duration
-	AllowedOrigins []string
+	RateLimit           int
+	Timeout             time.Duration
+	AllowedOrigins      []string
+	MaxBodySize         int
+	ResponseCompression bool
+}
+
+// GRPCConfig holds gRPC ingestion server configuration
+type GRPCConfig struct {
+	Enabled bool
+	Port    int
+}
+
+// MQTTConfig holds MQTT ingest bridge configuration
+type MQTTConfig struct {
+	Enabled     bool
+	BrokerURL   string // e.g. tcp://broker:1883 or ssl://broker:8883
+	ClientID    string
+	Username    string
+	Password    string
+	TopicPrefix string
+	// How old a signed message may be. Messages wait at the broker while
+	// the server is down, so this is longer than for HTTP requests.
+	SignatureTolerance time.Duration
+}
+
+// MetricsConfig holds Prometheus metrics configuration
+type MetricsConfig struct {
+	Enabled bool
+	Token   string // /metrics requires "Authorization: Bearer <token>"
+}
+
+// TracingConfig holds OpenTelemetry tracing configuration
+type TracingConfig struct {
+	Endpoint    string  // OTLP/HTTP collector URL, e.g. http://localhost:4318; empty disables tracing
+	SampleRatio float64 // fraction of new traces to record; traces started by nodes follow their decision
 }
 
 // LoggingConfig holds logging configuration
@@ -99,6 +197,10 @@ func Load() (*Config, error) {
 	flag.BoolVar(&cfg.Server.TLSEnabled, "tls-enabled", getEnvBool("TLS_ENABLED", false), "Enable HTTPS/TLS")
 	flag.StringVar(&cfg.Server.TLSCert, "tls-cert", getEnv("TLS_CERT", ""), "Path to TLS certificate file")
 	flag.StringVar(&cfg.Server.TLSKey, "tls-key", getEnv("TLS_KEY", ""), "Path to TLS key file")
+	flag.StringVar(&cfg.Server.TLSClientCA, "tls-client-ca", getEnv("TLS_CLIENT_CA", ""), "Path to a CA bundle trusted for node client certificates")
+	flag.StringVar(&cfg.Server.NodeCACert, "node-ca-cert", getEnv("NODE_CA_CERT", ""), "Path to the CA certificate that signs node CSRs")
+	flag.StringVar(&cfg.Server.NodeCAKey, "node-ca-key", getEnv("NODE_CA_KEY", ""), "Path to the private key of the node CA")
+	flag.DurationVar(&cfg.Server.NodeCertValidity, "node-cert-validity", getEnvDuration("NODE_CERT_VALIDITY", 90*24*time.Hour), "Lifetime of node certificates signed by the node CA")
 
 	// Database
 	flag.StringVar(&cfg.Database.Type, "db-type", getEnv("DB_TYPE", "postgres"), "Database type: postgres, sqlite")
@@ -116,27 +218,83 @@ func Load() (*Config, error) {
 	// Admin
 	flag.StringVar(&cfg.Admin.Username, "admin-username", getEnv("ADMIN_USERNAME", "admin"), "Admin username")
 	flag.StringVar(&cfg.Admin.Password, "admin-password", getEnv("ADMIN_PASSWORD", ""), "Admin password")
+	flag.StringVar(&cfg.Admin.TOTPSecret, "admin-totp-secret", getEnv("ADMIN_TOTP_SECRET", ""), "Base32 TOTP secret required as a second factor for the admin account (empty = password only)")
+	flag.StringVar(&cfg.Admin.TOTPIssuer, "totp-issuer", getEnv("TOTP_ISSUER", "Speedtest Monitor"), "Name authenticator apps show for this server")
 
 	// JWT
 	flag.StringVar(&cfg.JWT.Secret, "jwt-secret", getEnv("JWT_SECRET", ""), "JWT secret key")
-	flag.DurationVar(&cfg.JWT.Expiry, "jwt-expiry", getEnvDuration("JWT_EXPIRY", 24*time.Hour), "JWT token expiration")
+	var jwtPreviousSecrets string
+	flag.StringVar(&jwtPreviousSecrets, "jwt-previous-secrets", getEnv("JWT_PREVIOUS_SECRETS", ""), "Comma-separated earlier JWT secrets whose tokens are still accepted, for rotating the secret")
+	flag.DurationVar(&cfg.JWT.Expiry, "jwt-expiry", getEnvDuration("JWT_EXPIRY", 15*time.Minute), "Access token expiration")
+	flag.DurationVar(&cfg.JWT.SessionLifetime, "session-lifetime", getEnvDuration("SESSION_LIFETIME", 7*24*time.Hour), "How long a login can be renewed with refresh tokens")
+
+	// OIDC
+	flag.StringVar(&cfg.OIDC.IssuerURL, "oidc-issuer-url", getEnv("OIDC_ISSUER_URL", ""), "OpenID Connect issuer URL for admin single sign-on (empty = disabled)")
+	flag.StringVar(&cfg.OIDC.ClientID, "oidc-client-id", getEnv("OIDC_CLIENT_ID", ""), "OpenID Connect client ID")
+	flag.StringVar(&cfg.OIDC.ClientSecret, "oidc-client-secret", getEnv("OIDC_CLIENT_SECRET", ""), "OpenID Connect client secret (empty for public clients)")
+	flag.StringVar(&cfg.OIDC.RedirectURL, "oidc-redirect-url", getEnv("OIDC_REDIRECT_URL", ""), "Callback URL registered at the provider, ending in /api/v1/admin/oidc/callback")
+	var oidcScopes, oidcRoleMapping string
+	flag.StringVar(&oidcScopes, "oidc-scopes", getEnv("OIDC_SCOPES", "openid profile email"), "Space-separated scopes to request")
+	flag.StringVar(&cfg.OIDC.UsernameClaim, "oidc-username-claim", getEnv("OIDC_USERNAME_CLAIM", "preferred_username"), "ID token claim used as the username")
+	flag.StringVar(&cfg.OIDC.GroupsClaim, "oidc-groups-claim", getEnv("OIDC_GROUPS_CLAIM", "groups"), "ID token claim listing the user's groups")
+	flag.StringVar(&oidcRoleMapping, "oidc-role-mapping", getEnv("OIDC_ROLE_MAPPING", ""), "Comma-separated group=role pairs, e.g. net-admins=admin,net-ops=operator")
+	flag.StringVar(&cfg.OIDC.DefaultRole, "oidc-default-role", getEnv("OIDC_DEFAULT_ROLE", ""), "Role for users in no mapped group (empty = deny)")
+	flag.StringVar(&cfg.OIDC.PostLoginRedirect, "oidc-post-login-redirect", getEnv("OIDC_POST_LOGIN_REDIRECT", ""), "Dashboard URL that receives the token after single sign-on (empty = JSON response)")
+
+	// API keys
+	flag.StringVar(&cfg.APIKeys.Secret, "api-key-secret", getEnv("API_KEY_SECRET", ""), "HMAC secret for API key digests (default: the JWT secret; changing it invalidates existing keys)")
+	flag.DurationVar(&cfg.APIKeys.CacheTTL, "api-key-cache-ttl", getEnvDuration("API_KEY_CACHE_TTL", 30*time.Second), "How long a verified API key is cached (0 disables the cache)")
+	flag.DurationVar(&cfg.APIKeys.SignatureTolerance, "signature-tolerance", getEnvDuration("SIGNATURE_TOLERANCE", 5*time.Minute), "How far the timestamp of a signed node request may be from server time")
 
 	// Node
 	flag.DurationVar(&cfg.Node.AliveTimeout, "alive-timeout", getEnvDuration("ALIVE_TIMEOUT", 2*time.Minute), "Node alive signal timeout")
 	flag.DurationVar(&cfg.Node.InactiveTimeout, "inactive-timeout", getEnvDuration("INACTIVE_TIMEOUT", 1*time.Hour), "Node inactive timeout")
 	flag.DurationVar(&cfg.Node.StatusCheckInterval, "status-check-interval", getEnvDuration("STATUS_CHECK_INTERVAL", 30*time.Second), "Node status check interval")
+	flag.BoolVar(&cfg.Node.ControlChannel, "control-channel", getEnvBool("CONTROL_CHANNEL_ENABLED", true), "Accept WebSocket control channels from nodes")
+	flag.DurationVar(&cfg.Node.CommandTTL, "command-ttl", getEnvDuration("COMMAND_TTL", 1*time.Hour), "Time after which unfinished node commands expire")
+	flag.DurationVar(&cfg.Node.ClockSkewThreshold, "clock-skew-threshold", getEnvDuration("CLOCK_SKEW_THRESHOLD", 1*time.Minute), "Node clock offset beyond which results are flagged")
+	flag.BoolVar(&cfg.Node.ClockSkewCorrection, "clock-skew-correction", getEnvBool("CLOCK_SKEW_CORRECTION", true), "Correct timestamps of flagged results by the node's clock offset")
+	flag.DurationVar(&cfg.Node.MaxFutureSkew, "max-future-skew", getEnvDuration("MAX_FUTURE_SKEW", 5*time.Minute), "Reject results timestamped further than this ahead of server time")
 
 	// Retention
 	flag.IntVar(&cfg.Retention.MeasurementsDays, "retention-measurements", getEnvInt("RETENTION_MEASUREMENTS", 365), "Keep measurements for N days")
 	flag.IntVar(&cfg.Retention.FailedDays, "retention-failed", getEnvInt("RETENTION_FAILED", 90), "Keep failed measurements for N days")
 	flag.DurationVar(&cfg.Retention.CleanupInterval, "cleanup-interval", getEnvDuration("CLEANUP_INTERVAL", 24*time.Hour), "Data cleanup interval")
 
+	// Data quality
+	flag.StringVar(&cfg.Quality.Action, "quality-action", getEnv("QUALITY_ACTION", "quarantine"), "Implausible measurements: quarantine, reject or accept")
+	flag.IntVar(&cfg.Quality.MaxBandwidthMbps, "quality-max-bandwidth", getEnvInt("QUALITY_MAX_BANDWIDTH_MBPS", 100000), "Maximum plausible bandwidth in Mbps")
+	flag.IntVar(&cfg.Quality.MaxLatencyMs, "quality-max-latency", getEnvInt("QUALITY_MAX_LATENCY_MS", 10000), "Maximum plausible latency in milliseconds")
+
 	// API
 	flag.IntVar(&cfg.API.RateLimit, "rate-limit", getEnvInt("RATE_LIMIT", 100), "Requests per minute per API key")
 	flag.DurationVar(&cfg.API.Timeout, "timeout", getEnvDuration("API_TIMEOUT", 30*time.Second), "API request timeout")
+	flag.IntVar(&cfg.API.MaxBodySize, "max-body-size", getEnvInt("MAX_BODY_SIZE", 10*1024*1024), "Max request body size in bytes, after decompression")
+	flag.BoolVar(&cfg.API.ResponseCompression, "response-compression", getEnvBool("RESPONSE_COMPRESSION", true), "Gzip admin API responses")
 	var allowedUIDomains string
 	flag.StringVar(&allowedUIDomains, "allowed-ui-domains", getEnv("ALLOWED_UI_DOMAINS", ""), "Comma-separated list of allowed UI origins for CORS (empty = allow all)")
 
+	// gRPC
+	flag.BoolVar(&cfg.GRPC.Enabled, "grpc-enabled", getEnvBool("GRPC_ENABLED", false), "Enable the gRPC ingestion server")
+	flag.IntVar(&cfg.GRPC.Port, "grpc-port", getEnvInt("GRPC_PORT", 9090), "gRPC ingestion server port")
+
+	// MQTT
+	flag.BoolVar(&cfg.MQTT.Enabled, "mqtt-enabled", getEnvBool("MQTT_ENABLED", false), "Enable the MQTT ingest bridge")
+	flag.StringVar(&cfg.MQTT.BrokerURL, "mqtt-broker-url", getEnv("MQTT_BROKER_URL", ""), "MQTT broker URL (tcp://, ssl:// or ws://)")
+	flag.StringVar(&cfg.MQTT.ClientID, "mqtt-client-id", getEnv("MQTT_CLIENT_ID", "speedtest-data-server"), "MQTT client ID (must be stable for the persistent session)")
+	flag.StringVar(&cfg.MQTT.Username, "mqtt-username", getEnv("MQTT_USERNAME", ""), "MQTT username")
+	flag.StringVar(&cfg.MQTT.Password, "mqtt-password", getEnv("MQTT_PASSWORD", ""), "MQTT password")
+	flag.StringVar(&cfg.MQTT.TopicPrefix, "mqtt-topic-prefix", getEnv("MQTT_TOPIC_PREFIX", "speedtest"), "MQTT topic prefix")
+	flag.DurationVar(&cfg.MQTT.SignatureTolerance, "mqtt-signature-tolerance", getEnvDuration("MQTT_SIGNATURE_TOLERANCE", 24*time.Hour), "How old a signed MQTT message may be")
+
+	// Metrics
+	flag.BoolVar(&cfg.Metrics.Enabled, "metrics-enabled", getEnvBool("METRICS_ENABLED", false), "Expose Prometheus metrics on /metrics (requires a token)")
+	flag.StringVar(&cfg.Metrics.Token, "metrics-token", getEnv("METRICS_TOKEN", ""), "Bearer token required to scrape /metrics")
+
+	// Tracing
+	flag.StringVar(&cfg.Tracing.Endpoint, "tracing-endpoint", getEnv("TRACING_ENDPOINT", ""), "OTLP/HTTP collector URL for traces (empty = tracing disabled)")
+	flag.Float64Var(&cfg.Tracing.SampleRatio, "tracing-sample-ratio", getEnvFloat("TRACING_SAMPLE_RATIO", 1), "Fraction of traces to record, from 0 to 1")
+
 	// Logging
 	flag.StringVar(&cfg.Logging.Level, "log-level", getEnv("LOG_LEVEL", "info"), "Log level: debug, info, warn, error")
 	flag.StringVar(&cfg.Logging.Format, "log-format", getEnv("LOG_FORMAT", "json"), "Log format: json or console")
@@ -145,6 +303,21 @@ func Load() (*Config, error) {
 
 	flag.Parse()
 
+	for _, secret := range strings.Split(jwtPreviousSecrets, ",") {
+		if secret = strings.TrimSpace(secret); secret != "" {
+			cfg.JWT.PreviousSecrets = append(cfg.JWT.PreviousSecrets, secret)
+		}
+	}
+
+	if cfg.APIKeys.Secret == "" {
+		// API keys, recovery codes and TOTP secrets are stored with the key
+		// they were issued under, which rotating the JWT secret must not change
+		if len(cfg.JWT.PreviousSecrets) > 0 {
+			return nil, fmt.Errorf("API key secret is required when rotating the JWT secret; set API_KEY_SECRET to the JWT secret API keys were issued with")
+		}
+		cfg.APIKeys.Secret = cfg.JWT.Secret
+	}
+
 	// Parse allowed UI domains for CORS
 	if allowedUIDomains != "" {
 		parts := strings.Split(allowedUIDomains, ",")
@@ -156,6 +329,19 @@ func Load() (*Config, error) {
 		cfg.API.AllowedOrigins = []string{"*"}
 	}
 
+	// Parse OIDC scopes and group to role mapping
+	cfg.OIDC.Scopes = strings.Fields(oidcScopes)
+	if oidcRoleMapping != "" {
+		cfg.OIDC.RoleMapping = make(map[string]string)
+		for _, pair := range strings.Split(oidcRoleMapping, ",") {
+			group, role, found := strings.Cut(pair, "=")
+			if !found {
+				return nil, fmt.Errorf("OIDC role mapping entry %q must be group=role", strings.TrimSpace(pair))
+			}
+			cfg.OIDC.RoleMapping[strings.TrimSpace(group)] = strings.TrimSpace(role)
+		}
+	}
+
 	// Validate required fields
 	if err := cfg.Validate(); err != nil {
 		return nil, err
@@ -179,12 +365,107 @@ func (c *Config) Validate() error {
 	if c.Admin.Password == "" {
 		return fmt.Errorf("admin password is required (--admin-password or ADMIN_PASSWORD)")
 	}
+	if c.Admin.TOTPSecret != "" {
+		if err := auth.ValidateTOTPSecret(c.Admin.TOTPSecret); err != nil {
+			return fmt.Errorf("admin %w", err)
+		}
+	}
 	if c.JWT.Secret == "" {
 		return fmt.Errorf("JWT secret is required (--jwt-secret or JWT_SECRET)")
 	}
+	if c.JWT.Expiry <= 0 {
+		return fmt.Errorf("JWT expiry must be positive")
+	}
+	if c.JWT.SessionLifetime < c.JWT.Expiry {
+		return fmt.Errorf("session lifetime must be at least the JWT expiry")
+	}
+	if err := c.OIDC.validate(); err != nil {
+		return err
+	}
+	if c.APIKeys.CacheTTL < 0 {
+		return fmt.Errorf("API key cache TTL must not be negative")
+	}
+	if c.APIKeys.SignatureTolerance <= 0 {
+		return fmt.Errorf("signature tolerance must be positive")
+	}
 	if c.Server.TLSEnabled && (c.Server.TLSCert == "" || c.Server.TLSKey == "") {
 		return fmt.Errorf("TLS certificate and key are required when TLS is enabled")
 	}
+	if (c.Server.TLSClientCA != "" || c.Server.NodeCACert != "") && !c.Server.TLSEnabled {
+		return fmt.Errorf("client certificates require TLS to be enabled")
+	}
+	if (c.Server.NodeCACert == "") != (c.Server.NodeCAKey == "") {
+		return fmt.Errorf("node CA certificate and key must be set together")
+	}
+	if c.Server.NodeCertValidity <= 0 {
+		return fmt.Errorf("node certificate validity must be positive")
+	}
+	if c.API.MaxBodySize <= 0 {
+		return fmt.Errorf("max body size must be positive")
+	}
+	if c.GRPC.Enabled && c.GRPC.Port == c.Server.Port {
+		return fmt.Errorf("gRPC port must differ from the HTTP server port")
+	}
+	if c.MQTT.Enabled && c.MQTT.BrokerURL == "" {
+		return fmt.Errorf("MQTT broker URL is required when MQTT is enabled (--mqtt-broker-url or MQTT_BROKER_URL)")
+	}
+	if c.MQTT.Enabled && c.MQTT.SignatureTolerance <= 0 {
+		return fmt.Errorf("MQTT signature tolerance must be positive")
+	}
+	if c.MQTT.Enabled && (c.MQTT.TopicPrefix == "" || strings.ContainsAny(c.MQTT.TopicPrefix, "+#")) {
+		return fmt.Errorf("MQTT topic prefix must be non-empty and must not contain wildcards")
+	}
+	if c.Node.CommandTTL <= 0 {
+		return fmt.Errorf("command TTL must be positive")
+	}
+	if c.Node.ClockSkewThreshold <= 0 || c.Node.MaxFutureSkew <= 0 {
+		return fmt.Errorf("clock skew threshold and max future skew must be positive")
+	}
+	if c.Quality.Action != "quarantine" && c.Quality.Action != "reject" && c.Quality.Action != "accept" {
+		return fmt.Errorf("quality action must be 'quarantine', 'reject' or 'accept'")
+	}
+	if c.Quality.MaxBandwidthMbps <= 0 || c.Quality.MaxLatencyMs <= 0 {
+		return fmt.Errorf("quality max bandwidth and max latency must be positive")
+	}
+	if c.Metrics.Enabled && c.Metrics.Token == "" {
+		return fmt.Errorf("metrics token is required when metrics are enabled (--metrics-token or METRICS_TOKEN)")
+	}
+	if c.Tracing.Endpoint != "" && !strings.HasPrefix(c.Tracing.Endpoint, "http://") && !strings.HasPrefix(c.Tracing.Endpoint, "https://") {
+		return fmt.Errorf("tracing endpoint must be an http:// or https:// URL")
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		return fmt.Errorf("tracing sample ratio must be between 0 and 1")
+	}
+	return nil
+}
+
+// validate checks the single sign-on settings when it is enabled
+func (c OIDCConfig) validate() error {
+	if !c.Enabled() {
+		return nil
+	}
+	if c.ClientID == "" || c.RedirectURL == "" {
+		return fmt.Errorf("OIDC client ID and redirect URL are required when single sign-on is enabled (OIDC_CLIENT_ID, OIDC_REDIRECT_URL)")
+	}
+	for name, value := range map[string]string{"issuer URL": c.IssuerURL, "redirect URL": c.RedirectURL, "post-login redirect": c.PostLoginRedirect} {
+		if value != "" && !strings.HasPrefix(value, "http://") && !strings.HasPrefix(value, "https://") {
+			return fmt.Errorf("OIDC %s must be an http:// or https:// URL", name)
+		}
+	}
+	if !slices.Contains(c.Scopes, "openid") {
+		return fmt.Errorf("OIDC scopes must include openid")
+	}
+	for group, role := range c.RoleMapping {
+		if group == "" || !models.ValidUserRole(role) {
+			return fmt.Errorf("OIDC role mapping %q=%q must name a group and one of the roles admin, operator or viewer", group, role)
+		}
+	}
+	if c.DefaultRole != "" && !models.ValidUserRole(c.DefaultRole) {
+		return fmt.Errorf("OIDC default role must be admin, operator or viewer")
+	}
+	if len(c.RoleMapping) == 0 && c.DefaultRole == "" {
+		return fmt.Errorf("OIDC role mapping or default role is required, otherwise no one can sign in")
+	}
 	return nil
 }
 
@@ -223,6 +504,15 @@ func getEnvInt(key string, defaultValue int) int {
 	return defaultValue
 }
 
+func getEnvFloat(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if floatVal, err := strconv.ParseFloat(value, 64); err == nil {
+			return floatVal
+		}
+	}
+	return defaultValue
+}
+
 func getEnvBool(key string, defaultValue bool) bool {
 	if value := os.Getenv(key); value != "" {
 		if boolVal, err := strconv.ParseBool(value); err == nil {
@@ -0,0 +1,473 @@
+package control
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"mark7888/speedtest-data-server/internal/auth"
+	"mark7888/speedtest-data-server/internal/db"
+	"mark7888/speedtest-data-server/internal/ingest"
+	"mark7888/speedtest-data-server/internal/logger"
+	"mark7888/speedtest-data-server/pkg/models"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+)
+
+const (
+	// handshakeTimeout is how long a new connection has to send its first heartbeat
+	handshakeTimeout = 10 * time.Second
+
+	// writeTimeout bounds a single write to the node
+	writeTimeout = 10 * time.Second
+
+	// sendBuffer is the number of outgoing messages queued per connection
+	sendBuffer = 16
+)
+
+// ErrNodeNotConnected is returned when a command targets a node without a control channel
+var ErrNodeNotConnected = errors.New("node is not connected")
+
+// errCredentialsEnded is returned when the API key or client certificate a
+// channel was opened with can no longer be used
+var errCredentialsEnded = errors.New("node credentials are no longer valid")
+
+// Hub tracks the nodes that hold an open control channel and routes
+// commands to them. It is the real-time source of truth for connectivity.
+type Hub struct {
+	db          db.Database
+	ingest      *ingest.Service
+	readTimeout time.Duration
+
+	mu    sync.RWMutex
+	conns map[uuid.UUID]*conn
+}
+
+// conn is a single node's control channel
+type conn struct {
+	nodeID      uuid.UUID
+	apiKey      *models.APIKey
+	cert        *auth.NodeCertificate // Set instead of apiKey for nodes with a client certificate
+	ws          *websocket.Conn
+	send        chan models.ControlMessage
+	done        chan struct{}
+	closeOnce   sync.Once
+	connectedAt time.Time
+
+	mu            sync.Mutex
+	lastHeartbeat time.Time
+	pending       map[string]chan *models.CommandResult
+}
+
+// NewHub creates a new control channel hub.
+// readTimeout is the longest a connection may stay silent (no heartbeat or
+// pong) before it is considered dead.
+func NewHub(database db.Database, ingestService *ingest.Service, readTimeout time.Duration) *Hub {
+	return &Hub{
+		db:          database,
+		ingest:      ingestService,
+		readTimeout: readTimeout,
+		conns:       make(map[uuid.UUID]*conn),
+	}
+}
+
+// Serve runs the control channel on an upgraded WebSocket until it closes.
+// The first message must be an alive heartbeat identifying the node, which
+// apiKey or cert, whichever authenticated the node, must be allowed to act
+// for. Every later heartbeat checks that again.
+func (h *Hub) Serve(ws *websocket.Conn, apiKey *models.APIKey, cert *auth.NodeCertificate) {
+	defer ws.Close()
+
+	// Handshake: wait for the first heartbeat
+	ws.SetReadDeadline(time.Now().Add(handshakeTimeout))
+	var first models.ControlMessage
+	if err := ws.ReadJSON(&first); err != nil {
+		logger.Log.Warn("Control channel handshake failed", zap.Error(err))
+		return
+	}
+	if first.Type != models.ControlTypeAlive {
+		writeError(ws, "first message must be an alive heartbeat")
+		return
+	}
+
+	aliveReq, err := decodeAlive(first.Payload)
+	if err != nil {
+		writeError(ws, err.Error())
+		return
+	}
+
+	// Checked before registering, or a key bound to another node could
+	// replace that node's channel
+	if err := h.ingest.Authorize(auth.WithNodeCredentials(context.Background(), apiKey, cert), models.APIKeyScopeAlive, aliveReq.NodeID); err != nil {
+		if ingest.IsDenied(err) {
+			writeError(ws, err.Error())
+			return
+		}
+		logger.Log.Error("Failed to authorize control channel", zap.Error(err))
+		writeError(ws, "failed to register node")
+		return
+	}
+
+	c := &conn{
+		nodeID:      aliveReq.NodeID,
+		apiKey:      apiKey,
+		cert:        cert,
+		ws:          ws,
+		send:        make(chan models.ControlMessage, sendBuffer),
+		done:        make(chan struct{}),
+		connectedAt: time.Now(),
+		pending:     make(map[string]chan *models.CommandResult),
+	}
+
+	h.register(c)
+	defer h.unregister(c)
+
+	go h.writePump(c)
+
+	h.handleAlive(c, aliveReq)
+	h.readPump(c)
+}
+
+// SendCommand sends a command to a connected node and waits for its result
+func (h *Hub) SendCommand(ctx context.Context, nodeID uuid.UUID, name string, args json.RawMessage) (*models.CommandResult, error) {
+	h.mu.RLock()
+	c, ok := h.conns[nodeID]
+	h.mu.RUnlock()
+	if !ok {
+		return nil, ErrNodeNotConnected
+	}
+
+	cmd := models.Command{
+		ID:   uuid.New().String(),
+		Name: name,
+		Args: args,
+	}
+
+	resultChan := make(chan *models.CommandResult, 1)
+	c.mu.Lock()
+	c.pending[cmd.ID] = resultChan
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, cmd.ID)
+		c.mu.Unlock()
+	}()
+
+	payload, err := json.Marshal(cmd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal command: %w", err)
+	}
+	if !c.enqueue(models.ControlMessage{Type: models.ControlTypeCommand, Payload: payload}) {
+		return nil, ErrNodeNotConnected
+	}
+
+	logger.Log.Info("Command sent to node",
+		zap.String("node_id", nodeID.String()),
+		zap.String("command_id", cmd.ID),
+		zap.String("command", name),
+	)
+
+	select {
+	case result := <-resultChan:
+		return result, nil
+	case <-c.done:
+		return nil, fmt.Errorf("control channel closed before the node replied")
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// IsConnected reports whether a node holds an open control channel and since when
+func (h *Hub) IsConnected(nodeID uuid.UUID) (time.Time, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	c, ok := h.conns[nodeID]
+	if !ok {
+		return time.Time{}, false
+	}
+	return c.connectedAt, true
+}
+
+// ConnectedNodeIDs returns the IDs of all connected nodes
+func (h *Hub) ConnectedNodeIDs() []uuid.UUID {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	ids := make([]uuid.UUID, 0, len(h.conns))
+	for id := range h.conns {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// ConnectedNodes returns details for all connected nodes, oldest connection first
+func (h *Hub) ConnectedNodes() []models.ConnectedNode {
+	h.mu.RLock()
+	nodes := make([]models.ConnectedNode, 0, len(h.conns))
+	for _, c := range h.conns {
+		c.mu.Lock()
+		nodes = append(nodes, models.ConnectedNode{
+			NodeID:         c.nodeID.String(),
+			ConnectedSince: c.connectedAt,
+			LastHeartbeat:  c.lastHeartbeat,
+			RemoteAddr:     c.ws.RemoteAddr().String(),
+		})
+		c.mu.Unlock()
+	}
+	h.mu.RUnlock()
+
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].ConnectedSince.Before(nodes[j].ConnectedSince)
+	})
+	return nodes
+}
+
+// AnnotateNode fills in the in-memory connection state of a node
+func (h *Hub) AnnotateNode(node *models.Node) {
+	if since, ok := h.IsConnected(node.ID); ok {
+		node.Connected = true
+		node.ConnectedSince = &since
+	}
+}
+
+// Close closes all control channels, e.g. on server shutdown
+func (h *Hub) Close() {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for _, c := range h.conns {
+		c.ws.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down"),
+			time.Now().Add(time.Second))
+		c.close()
+	}
+}
+
+// register adds a connection, replacing any older one from the same node
+func (h *Hub) register(c *conn) {
+	h.mu.Lock()
+	old, exists := h.conns[c.nodeID]
+	h.conns[c.nodeID] = c
+	h.mu.Unlock()
+
+	if exists {
+		logger.Log.Info("Replacing existing control channel", zap.String("node_id", c.nodeID.String()))
+		old.close()
+	}
+
+	logger.Log.Info("Node control channel connected",
+		zap.String("node_id", c.nodeID.String()),
+		zap.String("remote_addr", c.ws.RemoteAddr().String()),
+	)
+}
+
+// unregister removes a connection and marks the node unreachable right away,
+// unless a newer connection from the same node has already replaced it
+func (h *Hub) unregister(c *conn) {
+	c.close()
+
+	h.mu.Lock()
+	current, ok := h.conns[c.nodeID]
+	replaced := ok && current != c
+	if !replaced {
+		delete(h.conns, c.nodeID)
+	}
+	h.mu.Unlock()
+
+	if replaced {
+		return
+	}
+
+	logger.Log.Info("Node control channel disconnected", zap.String("node_id", c.nodeID.String()))
+
+	if err := h.db.SetNodeStatus(context.Background(), c.nodeID, models.NodeStatusUnreachable); err != nil {
+		logger.Log.Error("Failed to mark node unreachable", zap.Error(err), zap.String("node_id", c.nodeID.String()))
+	}
+}
+
+// readPump processes messages from the node until the connection fails
+func (h *Hub) readPump(c *conn) {
+	c.ws.SetReadDeadline(time.Now().Add(h.readTimeout))
+	c.ws.SetPongHandler(func(string) error {
+		return c.ws.SetReadDeadline(time.Now().Add(h.readTimeout))
+	})
+
+	for {
+		var msg models.ControlMessage
+		if err := c.ws.ReadJSON(&msg); err != nil {
+			if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				logger.Log.Debug("Control channel read failed", zap.Error(err), zap.String("node_id", c.nodeID.String()))
+			}
+			return
+		}
+		c.ws.SetReadDeadline(time.Now().Add(h.readTimeout))
+
+		switch msg.Type {
+		case models.ControlTypeAlive:
+			aliveReq, err := decodeAlive(msg.Payload)
+			if err != nil {
+				c.enqueueError(err.Error())
+				continue
+			}
+			if aliveReq.NodeID != c.nodeID {
+				c.enqueueError("node ID cannot change on an open control channel")
+				continue
+			}
+			if err := h.reauthorize(c); err != nil {
+				if errors.Is(err, errCredentialsEnded) || ingest.IsDenied(err) {
+					logger.Log.Warn("Closing control channel of a node that may no longer connect",
+						zap.String("node_id", c.nodeID.String()),
+						zap.Error(err),
+					)
+					c.ws.WriteControl(websocket.CloseMessage,
+						websocket.FormatCloseMessage(websocket.ClosePolicyViolation, err.Error()),
+						time.Now().Add(time.Second))
+					return
+				}
+				logger.Log.Error("Failed to check control channel credentials", zap.Error(err))
+				c.enqueueError("failed to register node")
+				continue
+			}
+			h.handleAlive(c, aliveReq)
+		case models.ControlTypeCommandResult:
+			var result models.CommandResult
+			if err := json.Unmarshal(msg.Payload, &result); err != nil {
+				c.enqueueError("invalid command result")
+				continue
+			}
+			c.mu.Lock()
+			resultChan, ok := c.pending[result.ID]
+			c.mu.Unlock()
+			if ok {
+				select {
+				case resultChan <- &result:
+				default: // duplicate result, already delivered
+				}
+			}
+		default:
+			c.enqueueError(fmt.Sprintf("unknown message type %q", msg.Type))
+		}
+	}
+}
+
+// writePump is the only writer on the connection; it also sends keepalive pings
+func (h *Hub) writePump(c *conn) {
+	ticker := time.NewTicker(h.readTimeout / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case msg := <-c.send:
+			c.ws.SetWriteDeadline(time.Now().Add(writeTimeout))
+			if err := c.ws.WriteJSON(msg); err != nil {
+				c.close()
+				return
+			}
+		case <-ticker.C:
+			if err := c.ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeTimeout)); err != nil {
+				c.close()
+				return
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// reauthorize checks on each heartbeat that the channel's credentials are
+// still good, since they were only verified at the handshake: a key that
+// was disabled, revoked, deleted, rotated out or expired, or a certificate
+// that expired, loses the channel. The key is reloaded so that changes to
+// its scopes and node binding apply as well.
+func (h *Hub) reauthorize(c *conn) error {
+	ctx := context.Background()
+	if c.cert != nil && !time.Now().Before(c.cert.NotAfter) {
+		return fmt.Errorf("%w: client certificate has expired", errCredentialsEnded)
+	}
+	if c.apiKey != nil {
+		apiKey, err := h.db.GetAPIKeyByID(ctx, c.apiKey.ID)
+		if err != nil {
+			if strings.Contains(err.Error(), "not found") {
+				return fmt.Errorf("%w: API key was deleted", errCredentialsEnded)
+			}
+			return err
+		}
+		if err := auth.CheckAPIKeyUsable(apiKey, time.Now()); err != nil {
+			return fmt.Errorf("%w: %v", errCredentialsEnded, err)
+		}
+		c.apiKey = apiKey
+	}
+	return h.ingest.Authorize(auth.WithNodeCredentials(ctx, c.apiKey, c.cert), models.APIKeyScopeAlive, c.nodeID)
+}
+
+// handleAlive records a heartbeat and acknowledges it
+func (h *Hub) handleAlive(c *conn, req *models.AliveRequest) {
+	response, err := h.ingest.Alive(auth.WithNodeCredentials(context.Background(), c.apiKey, c.cert), req)
+	if err != nil {
+		logger.Log.Error("Failed to upsert node", zap.Error(err))
+		c.enqueueError("failed to register node")
+		return
+	}
+
+	c.mu.Lock()
+	c.lastHeartbeat = time.Now()
+	c.mu.Unlock()
+
+	payload, err := json.Marshal(response)
+	if err != nil {
+		return
+	}
+	c.enqueue(models.ControlMessage{Type: models.ControlTypeAliveAck, Payload: payload})
+}
+
+// enqueue queues a message for the writer; it fails if the connection is closed
+func (c *conn) enqueue(msg models.ControlMessage) bool {
+	select {
+	case c.send <- msg:
+		return true
+	case <-c.done:
+		return false
+	}
+}
+
+// enqueueError queues an error message for the node
+func (c *conn) enqueueError(message string) {
+	payload, _ := json.Marshal(models.ErrorResponse{Error: message})
+	c.enqueue(models.ControlMessage{Type: models.ControlTypeError, Payload: payload})
+}
+
+// close terminates the connection; safe to call more than once
+func (c *conn) close() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		c.ws.Close()
+	})
+}
+
+// decodeAlive parses and validates an alive payload using the REST binding rules
+func decodeAlive(payload json.RawMessage) (*models.AliveRequest, error) {
+	var req models.AliveRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return nil, fmt.Errorf("invalid alive payload: %w", err)
+	}
+	if err := binding.Validator.ValidateStruct(&req); err != nil {
+		return nil, fmt.Errorf("invalid alive payload: %w", err)
+	}
+	return &req, nil
+}
+
+// writeError sends an error directly during the handshake, before the writer starts
+func writeError(ws *websocket.Conn, message string) {
+	payload, _ := json.Marshal(models.ErrorResponse{Error: message})
+	ws.SetWriteDeadline(time.Now().Add(writeTimeout))
+	ws.WriteJSON(models.ControlMessage{Type: models.ControlTypeError, Payload: payload})
+}
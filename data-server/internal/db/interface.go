@@ -1,6 +1,7 @@
 package db
 
 import (
+	"context"
 	"time"
 
 	"mark7888/speedtest-data-server/pkg/models"
@@ -12,38 +13,103 @@ import (
 type Database interface {
 	// Connection management
 	Close() error
-	Ping() error
-	SafePing() error
+	Ping(ctx context.Context) error
+	SafePing(ctx context.Context) error
 	Migrate() error
 
 	// API Keys
-	CreateAPIKey(name, plainKey, createdBy string) (*models.APIKey, error)
-	GetAPIKeyByID(id uuid.UUID) (*models.APIKey, error)
-	GetAllAPIKeys() ([]models.APIKey, error)
-	GetEnabledAPIKeys() ([]models.APIKey, error)
-	UpdateAPIKeyEnabled(id uuid.UUID, enabled bool) error
-	DeleteAPIKey(id uuid.UUID) error
-	UpdateAPIKeyLastUsed(id uuid.UUID) error
-	VerifyAPIKey(plainKey string) (*models.APIKey, error)
+	CreateAPIKey(ctx context.Context, plainKey string, key models.NewAPIKey) (*models.APIKey, error)
+	RotateAPIKey(ctx context.Context, oldID uuid.UUID, oldExpiresAt time.Time, plainKey string, key models.NewAPIKey) (*models.APIKey, error)
+	GetAPIKeyByID(ctx context.Context, id uuid.UUID) (*models.APIKey, error)
+	GetAllAPIKeys(ctx context.Context) ([]models.APIKey, error)
+	GetEnabledAPIKeys(ctx context.Context) ([]models.APIKey, error)
+	UpdateAPIKeyEnabled(ctx context.Context, id uuid.UUID, enabled bool) error
+	UpdateAPIKeyScopes(ctx context.Context, id uuid.UUID, scopes []string) error
+	UpdateAPIKeyExpiry(ctx context.Context, id uuid.UUID, expiresAt *time.Time) error
+	DeleteAPIKey(ctx context.Context, id uuid.UUID) error
+	UpdateAPIKeyLastUsed(ctx context.Context, id uuid.UUID) error
+	VerifyAPIKey(ctx context.Context, plainKey string) (*models.APIKey, error)
+	VerifySignedRequest(ctx context.Context, keyID, signature string, expected func(signingKey []byte) string) (*models.APIKey, error)
+	BindAPIKeyNode(ctx context.Context, id, nodeID uuid.UUID) (uuid.UUID, error)
+	SetAPIKeyNode(ctx context.Context, id uuid.UUID, nodeID *uuid.UUID) error
+
+	// Enrollment tokens
+	CreateEnrollmentToken(ctx context.Context, plainToken string, token models.NewEnrollmentToken) (*models.EnrollmentToken, error)
+	GetAllEnrollmentTokens(ctx context.Context) ([]models.EnrollmentToken, error)
+	DeleteEnrollmentToken(ctx context.Context, id uuid.UUID) error
+	EnrollNode(ctx context.Context, plainToken, plainKey string, nodeID uuid.UUID, nodeName string) (*models.APIKey, error)
+
+	// Users
+	CreateUser(ctx context.Context, user models.NewUser) (*models.User, error)
+	GetUserByID(ctx context.Context, id uuid.UUID) (*models.User, error)
+	GetUserByUsername(ctx context.Context, username string) (*models.User, error)
+	GetAllUsers(ctx context.Context) ([]models.User, error)
+	UpdateUser(ctx context.Context, id uuid.UUID, update models.UserUpdate) (*models.User, error)
+	DeleteUser(ctx context.Context, id uuid.UUID) error
+	UpdateUserLastLogin(ctx context.Context, id uuid.UUID) error
+
+	// Two-factor authentication
+	SetUserTOTPSecret(ctx context.Context, id uuid.UUID, secret string) error
+	GetUserTOTPSecret(ctx context.Context, id uuid.UUID) (string, error)
+	EnableUserTOTP(ctx context.Context, id uuid.UUID, step int64, recoveryCodes []string) error
+	DisableUserTOTP(ctx context.Context, id uuid.UUID) error
+	UseUserTOTPStep(ctx context.Context, id uuid.UUID, step int64) error
+	ReplaceRecoveryCodes(ctx context.Context, userID uuid.UUID, recoveryCodes []string) error
+	UseRecoveryCode(ctx context.Context, userID uuid.UUID, code string) error
+	CountRecoveryCodes(ctx context.Context, userID uuid.UUID) (int, error)
+
+	// Admin sessions
+	CreateSession(ctx context.Context, plainRefreshToken string, session models.NewSession) (*models.Session, error)
+	GetSession(ctx context.Context, id uuid.UUID) (*models.Session, error)
+	GetActiveSessions(ctx context.Context, username string) ([]models.Session, error)
+	RotateRefreshToken(ctx context.Context, plainToken, newPlainToken string) (*models.Session, error)
+	RevokeSession(ctx context.Context, id uuid.UUID) error
+	RevokeUserSessions(ctx context.Context, username string) (int64, error)
+	CleanupExpiredSessions(ctx context.Context) (int64, error)
 
 	// Nodes
-	UpsertNode(nodeID uuid.UUID, nodeName string, nodeLocation *string) error
-	GetNodeByID(nodeID uuid.UUID) (*models.Node, error)
-	GetAllNodes(status string, page, limit int) ([]models.Node, int, error)
-	GetNodeWithStats(nodeID uuid.UUID) (*models.NodeWithStats, error)
-	UpdateNodeStatus(aliveTimeout, inactiveTimeout time.Duration) error
-	GetNodeCounts() (total, active, unreachable, inactive int, err error)
-	ArchiveNode(nodeID uuid.UUID, archived bool) error
-	SetNodeFavorite(nodeID uuid.UUID, favorite bool) error
-	DeleteNode(nodeID uuid.UUID) error
+	UpsertNode(ctx context.Context, nodeID uuid.UUID, nodeName string, nodeLocation *string) error
+	GetNodeByID(ctx context.Context, nodeID uuid.UUID) (*models.Node, error)
+	GetAllNodes(ctx context.Context, status string, page, limit int) ([]models.Node, int, error)
+	GetNodeWithStats(ctx context.Context, nodeID uuid.UUID) (*models.NodeWithStats, error)
+	UpdateNodeStatus(ctx context.Context, aliveTimeout, inactiveTimeout time.Duration, connected []uuid.UUID) error
+	SetNodeStatus(ctx context.Context, nodeID uuid.UUID, status models.NodeStatus) error
+	GetNodeCounts(ctx context.Context) (total, active, unreachable, inactive int, err error)
+	ArchiveNode(ctx context.Context, nodeID uuid.UUID, archived bool) error
+	SetNodeFavorite(ctx context.Context, nodeID uuid.UUID, favorite bool) error
+	DeleteNode(ctx context.Context, nodeID uuid.UUID) error
+	UpdateNodeClockOffset(ctx context.Context, nodeID uuid.UUID, offsetMs int64) error
+
+	// Node configuration
+	GetNodeConfig(ctx context.Context, scope string) (*models.NodeConfig, error)
+	SetNodeConfig(ctx context.Context, scope string, settings models.NodeSettings, updatedBy string) (*models.NodeConfig, error)
+	DeleteNodeConfig(ctx context.Context, scope string) error
+	UpdateNodeConfigVersion(ctx context.Context, nodeID uuid.UUID, version string) error
+
+	// Node inventory
+	UpsertNodeInventory(ctx context.Context, nodeID uuid.UUID, inventory *models.NodeInventory) error
+
+	// Node commands
+	CreateNodeCommand(ctx context.Context, nodeID uuid.UUID, command, createdBy string) (*models.NodeCommand, error)
+	GetNodeCommand(ctx context.Context, id uuid.UUID) (*models.NodeCommand, error)
+	GetNodeCommands(ctx context.Context, nodeID uuid.UUID, activeOnly bool, limit int) ([]models.NodeCommand, error)
+	ClaimPendingCommands(ctx context.Context, nodeID uuid.UUID) ([]models.NodeCommand, error)
+	UpdateNodeCommandStatus(ctx context.Context, id, nodeID uuid.UUID, status models.NodeCommandStatus, errorMessage *string, measurementTimestamp *time.Time) error
+	ExpireNodeCommands(ctx context.Context, maxAge time.Duration) (int64, error)
 
 	// Measurements
-	InsertMeasurement(m *models.Measurement) error
-	GetMeasurementsByNode(nodeID uuid.UUID, from, to *time.Time, page, limit int, status string) ([]models.Measurement, int, error)
-	InsertFailedMeasurement(nodeID uuid.UUID, timestamp time.Time, errorMessage string, retryCount int) error
-	GetAggregatedMeasurements(nodeIDs []uuid.UUID, from, to time.Time, interval string, hideArchived bool) ([]models.AggregatedMeasurement, error)
-	GetMeasurementCounts() (total int64, last24h int64, lastTimestamp *time.Time, err error)
-	GetLast24hStats() (*models.DashboardStats24h, error)
-	CleanupOldMeasurements(retentionDays int) (int64, error)
-	CleanupOldFailedMeasurements(retentionDays int) (int64, error)
+	InsertMeasurement(ctx context.Context, m *models.Measurement) error
+	GetMeasurementsByNode(ctx context.Context, nodeID uuid.UUID, from, to *time.Time, page, limit int, status string) ([]models.Measurement, int, error)
+	InsertFailedMeasurement(ctx context.Context, f *models.FailedMeasurement) error
+	GetAggregatedMeasurements(ctx context.Context, nodeIDs []uuid.UUID, from, to time.Time, interval string, hideArchived bool) ([]models.AggregatedMeasurement, error)
+	GetMeasurementCounts(ctx context.Context) (total int64, last24h int64, lastTimestamp *time.Time, err error)
+	GetLast24hStats(ctx context.Context) (*models.DashboardStats24h, error)
+	CleanupOldMeasurements(ctx context.Context, retentionDays int) (int64, error)
+	CleanupOldFailedMeasurements(ctx context.Context, retentionDays int) (int64, error)
+
+	// Quarantined measurements
+	QuarantineMeasurement(ctx context.Context, m *models.Measurement, reasons []string) error
+	GetQuarantinedMeasurements(ctx context.Context, nodeID *uuid.UUID, page, limit int) ([]models.QuarantinedMeasurement, int, error)
+	GetQuarantinedMeasurement(ctx context.Context, id uuid.UUID) (*models.QuarantinedMeasurement, error)
+	DeleteQuarantinedMeasurement(ctx context.Context, id uuid.UUID) error
 }
@@ -1,64 +1,148 @@
 package postgres
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"time"
 
 	"mark7888/speedtest-data-server/internal/auth"
+	"mark7888/speedtest-data-server/internal/logger"
 	"mark7888/speedtest-data-server/pkg/models"
 
 	sq "github.com/Masterminds/squirrel"
 	"github.com/google/uuid"
+	"go.uber.org/zap"
 )
 
+// signedKeyCachePrefix sets apart keys cached by key ID for signed requests
+// from keys cached by digest
+const signedKeyCachePrefix = "key_id:"
+
+// apiKeyColumns are the columns scanned by scanAPIKey
+var apiKeyColumns = []string{"id", "name", "key_id", "key_hash", "enabled", "created_at", "created_by", "last_used", "revoked_at", "node_id", "bound_at", "scopes", "expires_at", "replaced_by", "signing_key"}
+
 // CreateAPIKey creates a new API key
-func (p *PostgresDB) CreateAPIKey(name, plainKey, createdBy string) (*models.APIKey, error) {
-	ctx, cancel := withTimeout()
+func (p *PostgresDB) CreateAPIKey(ctx context.Context, plainKey string, key models.NewAPIKey) (*models.APIKey, error) {
+	ctx, cancel := p.withTimeout(ctx, "CreateAPIKey")
 	defer cancel()
 
-	// Hash the key
-	keyHash, err := auth.HashAPIKey(plainKey)
+	apiKey, query, args, err := p.insertAPIKey(plainKey, key)
 	if err != nil {
-		return nil, fmt.Errorf("failed to hash API key: %w", err)
+		return nil, err
 	}
 
-	apiKey := &models.APIKey{
-		ID:        uuid.New(),
-		Name:      name,
-		KeyHash:   keyHash,
-		Enabled:   true,
-		CreatedAt: time.Now().UTC(),
+	_, err = p.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create API key: %w", err)
 	}
 
-	if createdBy != "" {
-		apiKey.CreatedBy = &createdBy
+	return apiKey, nil
+}
+
+// RotateAPIKey creates the successor of an API key and lets the old key
+// expire at oldExpiresAt. A key can only be replaced once.
+func (p *PostgresDB) RotateAPIKey(ctx context.Context, oldID uuid.UUID, oldExpiresAt time.Time, plainKey string, key models.NewAPIKey) (*models.APIKey, error) {
+	ctx, cancel := p.withTimeout(ctx, "RotateAPIKey")
+	defer cancel()
+
+	apiKey, query, args, err := p.insertAPIKey(plainKey, key)
+	if err != nil {
+		return nil, err
 	}
 
-	query, args, err := p.builder.
-		Insert("api_keys").
-		Columns("id", "name", "key_hash", "enabled", "created_at", "created_by").
-		Values(apiKey.ID, apiKey.Name, apiKey.KeyHash, apiKey.Enabled, apiKey.CreatedAt, apiKey.CreatedBy).
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		return nil, fmt.Errorf("failed to create API key: %w", err)
+	}
+
+	query, args, err = p.builder.
+		Update("api_keys").
+		Set("expires_at", oldExpiresAt.UTC()).
+		Set("replaced_by", apiKey.ID).
+		Where(sq.Eq{"id": oldID}).
+		Where("replaced_by IS NULL").
 		ToSql()
 	if err != nil {
-		return nil, fmt.Errorf("failed to build insert query: %w", err)
+		return nil, fmt.Errorf("failed to build update query: %w", err)
 	}
 
-	_, err = p.db.ExecContext(ctx, query, args...)
+	result, err := tx.ExecContext(ctx, query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create API key: %w", err)
+		return nil, fmt.Errorf("failed to update replaced API key: %w", err)
 	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return nil, fmt.Errorf("API key not found or already replaced")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	p.keyCache.Invalidate(oldID)
 
 	return apiKey, nil
 }
 
+// insertAPIKey builds a new API key and the query inserting it
+func (p *PostgresDB) insertAPIKey(plainKey string, key models.NewAPIKey) (*models.APIKey, string, []interface{}, error) {
+	keyID, legacy := p.keyHasher.KeyID(plainKey)
+	if keyID == "" || legacy {
+		return nil, "", nil, fmt.Errorf("API key has no key ID")
+	}
+
+	signingKey, err := p.keyHasher.SealSigningKey(plainKey)
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("failed to seal signing key: %w", err)
+	}
+
+	now := time.Now().UTC()
+	apiKey := &models.APIKey{
+		ID:         uuid.New(),
+		Name:       key.Name,
+		KeyID:      &keyID,
+		KeyHash:    p.keyHasher.Digest(plainKey),
+		Enabled:    true,
+		CreatedAt:  now,
+		NodeID:     key.NodeID,
+		Scopes:     key.Scopes,
+		ExpiresAt:  key.ExpiresAt,
+		SigningKey: &signingKey,
+	}
+	if len(apiKey.Scopes) == 0 {
+		apiKey.Scopes = models.DefaultAPIKeyScopes
+	}
+	if key.NodeID != nil {
+		apiKey.BoundAt = &now
+	}
+	if key.CreatedBy != "" {
+		apiKey.CreatedBy = &key.CreatedBy
+	}
+
+	query, args, err := p.builder.
+		Insert("api_keys").
+		Columns("id", "name", "key_id", "key_hash", "enabled", "created_at", "created_by", "node_id", "bound_at", "scopes", "expires_at", "signing_key").
+		Values(apiKey.ID, apiKey.Name, apiKey.KeyID, apiKey.KeyHash, apiKey.Enabled, apiKey.CreatedAt, apiKey.CreatedBy,
+			apiKey.NodeID, apiKey.BoundAt, models.FormatAPIKeyScopes(apiKey.Scopes), apiKey.ExpiresAt, apiKey.SigningKey).
+		ToSql()
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("failed to build insert query: %w", err)
+	}
+
+	return apiKey, query, args, nil
+}
+
 // GetAPIKeyByID retrieves an API key by ID
-func (p *PostgresDB) GetAPIKeyByID(id uuid.UUID) (*models.APIKey, error) {
-	ctx, cancel := withTimeout()
+func (p *PostgresDB) GetAPIKeyByID(ctx context.Context, id uuid.UUID) (*models.APIKey, error) {
+	ctx, cancel := p.withTimeout(ctx, "GetAPIKeyByID")
 	defer cancel()
 
 	query, args, err := p.builder.
-		Select("id", "name", "key_hash", "enabled", "created_at", "created_by", "last_used", "revoked_at").
+		Select(apiKeyColumns...).
 		From("api_keys").
 		Where(sq.Eq{"id": id}).
 		ToSql()
@@ -66,18 +150,7 @@ func (p *PostgresDB) GetAPIKeyByID(id uuid.UUID) (*models.APIKey, error) {
 		return nil, fmt.Errorf("failed to build select query: %w", err)
 	}
 
-	var apiKey models.APIKey
-	err = p.db.QueryRowContext(ctx, query, args...).Scan(
-		&apiKey.ID,
-		&apiKey.Name,
-		&apiKey.KeyHash,
-		&apiKey.Enabled,
-		&apiKey.CreatedAt,
-		&apiKey.CreatedBy,
-		&apiKey.LastUsed,
-		&apiKey.RevokedAt,
-	)
-
+	apiKey, err := scanAPIKey(p.db.QueryRowContext(ctx, query, args...))
 	if err == sql.ErrNoRows {
 		return nil, fmt.Errorf("API key not found")
 	}
@@ -85,16 +158,16 @@ func (p *PostgresDB) GetAPIKeyByID(id uuid.UUID) (*models.APIKey, error) {
 		return nil, fmt.Errorf("failed to get API key: %w", err)
 	}
 
-	return &apiKey, nil
+	return apiKey, nil
 }
 
 // GetAllAPIKeys retrieves all API keys
-func (p *PostgresDB) GetAllAPIKeys() ([]models.APIKey, error) {
-	ctx, cancel := withTimeout()
+func (p *PostgresDB) GetAllAPIKeys(ctx context.Context) ([]models.APIKey, error) {
+	ctx, cancel := p.withTimeout(ctx, "GetAllAPIKeys")
 	defer cancel()
 
 	query, args, err := p.builder.
-		Select("id", "name", "key_hash", "enabled", "created_at", "created_by", "last_used", "revoked_at").
+		Select(apiKeyColumns...).
 		From("api_keys").
 		OrderBy("created_at DESC").
 		ToSql()
@@ -102,41 +175,16 @@ func (p *PostgresDB) GetAllAPIKeys() ([]models.APIKey, error) {
 		return nil, fmt.Errorf("failed to build select query: %w", err)
 	}
 
-	rows, err := p.db.QueryContext(ctx, query, args...)
-	if err != nil {
-		return nil, fmt.Errorf("failed to query API keys: %w", err)
-	}
-	defer rows.Close()
-
-	var apiKeys []models.APIKey
-	for rows.Next() {
-		var apiKey models.APIKey
-		err := rows.Scan(
-			&apiKey.ID,
-			&apiKey.Name,
-			&apiKey.KeyHash,
-			&apiKey.Enabled,
-			&apiKey.CreatedAt,
-			&apiKey.CreatedBy,
-			&apiKey.LastUsed,
-			&apiKey.RevokedAt,
-		)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan API key: %w", err)
-		}
-		apiKeys = append(apiKeys, apiKey)
-	}
-
-	return apiKeys, nil
+	return p.queryAPIKeys(ctx, query, args...)
 }
 
 // GetEnabledAPIKeys retrieves all enabled API keys
-func (p *PostgresDB) GetEnabledAPIKeys() ([]models.APIKey, error) {
-	ctx, cancel := withTimeout()
+func (p *PostgresDB) GetEnabledAPIKeys(ctx context.Context) ([]models.APIKey, error) {
+	ctx, cancel := p.withTimeout(ctx, "GetEnabledAPIKeys")
 	defer cancel()
 
 	query, args, err := p.builder.
-		Select("id", "name", "key_hash", "enabled", "created_at", "created_by", "last_used", "revoked_at").
+		Select(apiKeyColumns...).
 		From("api_keys").
 		Where(sq.Eq{"enabled": true}).
 		Where("revoked_at IS NULL").
@@ -146,37 +194,32 @@ func (p *PostgresDB) GetEnabledAPIKeys() ([]models.APIKey, error) {
 		return nil, fmt.Errorf("failed to build select query: %w", err)
 	}
 
+	return p.queryAPIKeys(ctx, query, args...)
+}
+
+// queryAPIKeys runs a query selecting apiKeyColumns
+func (p *PostgresDB) queryAPIKeys(ctx context.Context, query string, args ...interface{}) ([]models.APIKey, error) {
 	rows, err := p.db.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query enabled API keys: %w", err)
+		return nil, fmt.Errorf("failed to query API keys: %w", err)
 	}
 	defer rows.Close()
 
 	var apiKeys []models.APIKey
 	for rows.Next() {
-		var apiKey models.APIKey
-		err := rows.Scan(
-			&apiKey.ID,
-			&apiKey.Name,
-			&apiKey.KeyHash,
-			&apiKey.Enabled,
-			&apiKey.CreatedAt,
-			&apiKey.CreatedBy,
-			&apiKey.LastUsed,
-			&apiKey.RevokedAt,
-		)
+		apiKey, err := scanAPIKey(rows)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan API key: %w", err)
 		}
-		apiKeys = append(apiKeys, apiKey)
+		apiKeys = append(apiKeys, *apiKey)
 	}
 
-	return apiKeys, nil
+	return apiKeys, rows.Err()
 }
 
 // UpdateAPIKeyEnabled updates the enabled status of an API key
-func (p *PostgresDB) UpdateAPIKeyEnabled(id uuid.UUID, enabled bool) error {
-	ctx, cancel := withTimeout()
+func (p *PostgresDB) UpdateAPIKeyEnabled(ctx context.Context, id uuid.UUID, enabled bool) error {
+	ctx, cancel := p.withTimeout(ctx, "UpdateAPIKeyEnabled")
 	defer cancel()
 
 	query, args, err := p.builder.
@@ -192,6 +235,45 @@ func (p *PostgresDB) UpdateAPIKeyEnabled(id uuid.UUID, enabled bool) error {
 	if err != nil {
 		return fmt.Errorf("failed to update API key: %w", err)
 	}
+	p.keyCache.Invalidate(id)
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return fmt.Errorf("API key not found")
+	}
+
+	return nil
+}
+
+// UpdateAPIKeyScopes replaces the scopes of an API key
+func (p *PostgresDB) UpdateAPIKeyScopes(ctx context.Context, id uuid.UUID, scopes []string) error {
+	return p.updateAPIKey(ctx, "UpdateAPIKeyScopes", id, "scopes", models.FormatAPIKeyScopes(scopes))
+}
+
+// UpdateAPIKeyExpiry sets when an API key expires; nil means never
+func (p *PostgresDB) UpdateAPIKeyExpiry(ctx context.Context, id uuid.UUID, expiresAt *time.Time) error {
+	return p.updateAPIKey(ctx, "UpdateAPIKeyExpiry", id, "expires_at", expiresAt)
+}
+
+// updateAPIKey sets a single column of an API key
+func (p *PostgresDB) updateAPIKey(ctx context.Context, op string, id uuid.UUID, column string, value interface{}) error {
+	ctx, cancel := p.withTimeout(ctx, op)
+	defer cancel()
+
+	query, args, err := p.builder.
+		Update("api_keys").
+		Set(column, value).
+		Where(sq.Eq{"id": id}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build update query: %w", err)
+	}
+
+	result, err := p.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to update API key: %w", err)
+	}
+	p.keyCache.Invalidate(id)
 
 	rowsAffected, _ := result.RowsAffected()
 	if rowsAffected == 0 {
@@ -202,8 +284,8 @@ func (p *PostgresDB) UpdateAPIKeyEnabled(id uuid.UUID, enabled bool) error {
 }
 
 // DeleteAPIKey deletes an API key
-func (p *PostgresDB) DeleteAPIKey(id uuid.UUID) error {
-	ctx, cancel := withTimeout()
+func (p *PostgresDB) DeleteAPIKey(ctx context.Context, id uuid.UUID) error {
+	ctx, cancel := p.withTimeout(ctx, "DeleteAPIKey")
 	defer cancel()
 
 	query, args, err := p.builder.
@@ -218,6 +300,7 @@ func (p *PostgresDB) DeleteAPIKey(id uuid.UUID) error {
 	if err != nil {
 		return fmt.Errorf("failed to delete API key: %w", err)
 	}
+	p.keyCache.Invalidate(id)
 
 	rowsAffected, _ := result.RowsAffected()
 	if rowsAffected == 0 {
@@ -228,8 +311,8 @@ func (p *PostgresDB) DeleteAPIKey(id uuid.UUID) error {
 }
 
 // UpdateAPIKeyLastUsed updates the last_used timestamp of an API key
-func (p *PostgresDB) UpdateAPIKeyLastUsed(id uuid.UUID) error {
-	ctx, cancel := withTimeout()
+func (p *PostgresDB) UpdateAPIKeyLastUsed(ctx context.Context, id uuid.UUID) error {
+	ctx, cancel := p.withTimeout(ctx, "UpdateAPIKeyLastUsed")
 	defer cancel()
 
 	query, args, err := p.builder.
@@ -249,22 +332,313 @@ func (p *PostgresDB) UpdateAPIKeyLastUsed(id uuid.UUID) error {
 	return nil
 }
 
-// VerifyAPIKey verifies an API key and returns the key details if valid
-func (p *PostgresDB) VerifyAPIKey(plainKey string) (*models.APIKey, error) {
-	// Get all enabled keys
-	apiKeys, err := p.GetEnabledAPIKeys()
+// VerifyAPIKey verifies an API key and returns the key details if valid.
+// The key is looked up by its key ID and its digest compared in constant
+// time. Verified keys are cached briefly, so last_used is only updated once
+// per cache period.
+func (p *PostgresDB) VerifyAPIKey(ctx context.Context, plainKey string) (*models.APIKey, error) {
+	digest := p.keyHasher.Digest(plainKey)
+	if apiKey, ok := p.keyCache.Get(digest); ok {
+		// Cached keys may have expired since
+		if err := auth.CheckAPIKeyUsable(apiKey, time.Now()); err != nil {
+			return nil, err
+		}
+		return apiKey, nil
+	}
+
+	keyID, legacy := p.keyHasher.KeyID(plainKey)
+	if keyID == "" {
+		return nil, fmt.Errorf("invalid API key")
+	}
+
+	apiKey, err := p.getAPIKeyByKeyID(ctx, keyID)
 	if err != nil {
 		return nil, err
 	}
+	if apiKey == nil && legacy {
+		if apiKey, err = p.upgradeLegacyAPIKey(ctx, plainKey, keyID, digest); err != nil {
+			return nil, err
+		}
+	}
+	if apiKey == nil || !auth.VerifyAPIKeyDigest(digest, apiKey.KeyHash) {
+		return nil, fmt.Errorf("invalid API key")
+	}
+	if err := auth.CheckAPIKeyUsable(apiKey, time.Now()); err != nil {
+		return nil, err
+	}
+	// Keys from before request signing get their signing key now; keys
+	// without a real key ID cannot sign, as nodes do not know their ID
+	if apiKey.SigningKey == nil && !legacy {
+		if err := p.storeSigningKey(ctx, apiKey, plainKey); err != nil {
+			logger.FromContext(ctx).Warn("Failed to store API key signing key",
+				zap.String("id", apiKey.ID.String()),
+				zap.Error(err),
+			)
+		}
+	}
+
+	_ = p.UpdateAPIKeyLastUsed(ctx, apiKey.ID)
+	p.keyCache.Put(digest, apiKey)
+	return apiKey, nil
+}
 
-	// Check each key
-	for _, apiKey := range apiKeys {
-		if auth.VerifyAPIKey(plainKey, apiKey.KeyHash) {
-			// Update last used timestamp
-			_ = p.UpdateAPIKeyLastUsed(apiKey.ID)
-			return &apiKey, nil
+// VerifySignedRequest finds the API key with keyID and checks that
+// signature is what expected computes with the key's signing key. Verified
+// keys are cached by key ID like VerifyAPIKey caches them by digest.
+func (p *PostgresDB) VerifySignedRequest(ctx context.Context, keyID, signature string, expected func(signingKey []byte) string) (*models.APIKey, error) {
+	cacheKey := signedKeyCachePrefix + keyID
+	apiKey, cached := p.keyCache.Get(cacheKey)
+	if !cached {
+		var err error
+		if apiKey, err = p.getAPIKeyByKeyID(ctx, keyID); err != nil {
+			return nil, err
+		}
+		if apiKey == nil {
+			return nil, fmt.Errorf("invalid API key")
 		}
 	}
+	if err := auth.CheckAPIKeyUsable(apiKey, time.Now()); err != nil {
+		return nil, err
+	}
+	if apiKey.SigningKey == nil {
+		return nil, fmt.Errorf("API key has no signing key")
+	}
+
+	signingKey, err := p.keyHasher.OpenSigningKey(*apiKey.SigningKey)
+	if err != nil {
+		return nil, err
+	}
+	if !auth.VerifyRequestSignature(signature, expected(signingKey)) {
+		return nil, fmt.Errorf("invalid request signature")
+	}
 
-	return nil, fmt.Errorf("invalid API key")
+	if !cached {
+		_ = p.UpdateAPIKeyLastUsed(ctx, apiKey.ID)
+		p.keyCache.Put(cacheKey, apiKey)
+	}
+	return apiKey, nil
+}
+
+// storeSigningKey stores the signing key of a key created before request
+// signing
+func (p *PostgresDB) storeSigningKey(ctx context.Context, apiKey *models.APIKey, plainKey string) error {
+	ctx, cancel := p.withTimeout(ctx, "StoreSigningKey")
+	defer cancel()
+
+	signingKey, err := p.keyHasher.SealSigningKey(plainKey)
+	if err != nil {
+		return fmt.Errorf("failed to seal signing key: %w", err)
+	}
+
+	query, args, err := p.builder.
+		Update("api_keys").
+		Set("signing_key", signingKey).
+		Where(sq.Eq{"id": apiKey.ID}).
+		Where("signing_key IS NULL").
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build update query: %w", err)
+	}
+
+	if _, err := p.db.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("failed to store signing key: %w", err)
+	}
+
+	apiKey.SigningKey = &signingKey
+	return nil
+}
+
+// getAPIKeyByKeyID returns the key with the given key ID, nil if there is none
+func (p *PostgresDB) getAPIKeyByKeyID(ctx context.Context, keyID string) (*models.APIKey, error) {
+	ctx, cancel := p.withTimeout(ctx, "GetAPIKeyByKeyID")
+	defer cancel()
+
+	query, args, err := p.builder.
+		Select(apiKeyColumns...).
+		From("api_keys").
+		Where(sq.Eq{"key_id": keyID}).
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build select query: %w", err)
+	}
+
+	apiKey, err := scanAPIKey(p.db.QueryRowContext(ctx, query, args...))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get API key: %w", err)
+	}
+	return apiKey, nil
+}
+
+// upgradeLegacyAPIKey checks a key issued before key IDs against the bcrypt
+// hashes of keys not upgraded yet. On a match it stores the key's derived
+// key ID and digest, so later requests take the indexed path. It returns nil
+// if no key matches. Only keys that could still authenticate are compared,
+// as every comparison costs a bcrypt run that anyone can trigger.
+func (p *PostgresDB) upgradeLegacyAPIKey(ctx context.Context, plainKey, keyID, digest string) (*models.APIKey, error) {
+	ctx, cancel := p.withTimeout(ctx, "UpgradeLegacyAPIKey")
+	defer cancel()
+
+	query, args, err := p.builder.
+		Select(apiKeyColumns...).
+		From("api_keys").
+		Where("key_id IS NULL").
+		Where(sq.Eq{"enabled": true}).
+		Where("revoked_at IS NULL").
+		Where(sq.Or{sq.Eq{"expires_at": nil}, sq.Gt{"expires_at": time.Now().UTC()}}).
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build select query: %w", err)
+	}
+
+	legacyKeys, err := p.queryAPIKeys(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, apiKey := range legacyKeys {
+		if !auth.VerifyLegacyAPIKey(plainKey, apiKey.KeyHash) {
+			continue
+		}
+
+		query, args, err := p.builder.
+			Update("api_keys").
+			Set("key_id", keyID).
+			Set("key_hash", digest).
+			Where(sq.Eq{"id": apiKey.ID}).
+			ToSql()
+		if err != nil {
+			return nil, fmt.Errorf("failed to build update query: %w", err)
+		}
+		if _, err := p.db.ExecContext(ctx, query, args...); err != nil {
+			return nil, fmt.Errorf("failed to upgrade API key: %w", err)
+		}
+
+		logger.FromContext(ctx).Info("Upgraded API key to indexed lookup",
+			zap.String("id", apiKey.ID.String()),
+			zap.String("key_id", keyID),
+		)
+		apiKey.KeyID = &keyID
+		apiKey.KeyHash = digest
+		return &apiKey, nil
+	}
+
+	return nil, nil
+}
+
+// BindAPIKeyNode binds an unbound API key to nodeID and returns the node the
+// key is bound to afterwards. A key that is already bound keeps its node, so
+// of two nodes racing to use a new key only the first one wins.
+func (p *PostgresDB) BindAPIKeyNode(ctx context.Context, id, nodeID uuid.UUID) (uuid.UUID, error) {
+	ctx, cancel := p.withTimeout(ctx, "BindAPIKeyNode")
+	defer cancel()
+
+	query, args, err := p.builder.
+		Update("api_keys").
+		Set("node_id", nodeID).
+		Set("bound_at", time.Now().UTC()).
+		Where(sq.Eq{"id": id}).
+		Where("node_id IS NULL").
+		ToSql()
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to build update query: %w", err)
+	}
+
+	result, err := p.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to bind API key: %w", err)
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected > 0 {
+		p.keyCache.Invalidate(id)
+		return nodeID, nil
+	}
+
+	query, args, err = p.builder.
+		Select("node_id").
+		From("api_keys").
+		Where(sq.Eq{"id": id}).
+		ToSql()
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to build select query: %w", err)
+	}
+
+	var bound uuid.UUID
+	err = p.db.QueryRowContext(ctx, query, args...).Scan(&bound)
+	if err == sql.ErrNoRows {
+		return uuid.Nil, fmt.Errorf("API key not found")
+	}
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to get API key binding: %w", err)
+	}
+
+	return bound, nil
+}
+
+// SetAPIKeyNode binds an API key to nodeID, replacing any binding, or unbinds
+// it when nodeID is nil so that it is bound to the next node using it
+func (p *PostgresDB) SetAPIKeyNode(ctx context.Context, id uuid.UUID, nodeID *uuid.UUID) error {
+	ctx, cancel := p.withTimeout(ctx, "SetAPIKeyNode")
+	defer cancel()
+
+	var boundAt *time.Time
+	if nodeID != nil {
+		now := time.Now().UTC()
+		boundAt = &now
+	}
+
+	query, args, err := p.builder.
+		Update("api_keys").
+		Set("node_id", nodeID).
+		Set("bound_at", boundAt).
+		Where(sq.Eq{"id": id}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build update query: %w", err)
+	}
+
+	result, err := p.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to update API key binding: %w", err)
+	}
+	p.keyCache.Invalidate(id)
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return fmt.Errorf("API key not found")
+	}
+
+	return nil
+}
+
+// scanAPIKey scans a row selected with apiKeyColumns
+func scanAPIKey(row interface{ Scan(...interface{}) error }) (*models.APIKey, error) {
+	var apiKey models.APIKey
+	var scopes string
+
+	err := row.Scan(
+		&apiKey.ID,
+		&apiKey.Name,
+		&apiKey.KeyID,
+		&apiKey.KeyHash,
+		&apiKey.Enabled,
+		&apiKey.CreatedAt,
+		&apiKey.CreatedBy,
+		&apiKey.LastUsed,
+		&apiKey.RevokedAt,
+		&apiKey.NodeID,
+		&apiKey.BoundAt,
+		&scopes,
+		&apiKey.ExpiresAt,
+		&apiKey.ReplacedBy,
+		&apiKey.SigningKey,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	apiKey.Scopes = models.ParseAPIKeyScopes(scopes)
+
+	return &apiKey, nil
 }
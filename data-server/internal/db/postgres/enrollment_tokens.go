@@ -0,0 +1,227 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"mark7888/speedtest-data-server/internal/auth"
+	"mark7888/speedtest-data-server/pkg/models"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/google/uuid"
+)
+
+// enrollmentTokenColumns are the columns scanned by scanEnrollmentToken
+var enrollmentTokenColumns = []string{"id", "name", "token_id", "token_hash", "scopes", "max_uses", "uses", "expires_at", "created_at", "created_by"}
+
+// CreateEnrollmentToken stores a new enrollment token
+func (p *PostgresDB) CreateEnrollmentToken(ctx context.Context, plainToken string, token models.NewEnrollmentToken) (*models.EnrollmentToken, error) {
+	ctx, cancel := p.withTimeout(ctx, "CreateEnrollmentToken")
+	defer cancel()
+
+	tokenID := auth.EnrollmentTokenID(plainToken)
+	if tokenID == "" {
+		return nil, fmt.Errorf("enrollment token has no token ID")
+	}
+
+	enrollmentToken := &models.EnrollmentToken{
+		ID:        uuid.New(),
+		Name:      token.Name,
+		TokenID:   tokenID,
+		TokenHash: p.keyHasher.Digest(plainToken),
+		Scopes:    token.Scopes,
+		MaxUses:   token.MaxUses,
+		ExpiresAt: token.ExpiresAt.UTC(),
+		CreatedAt: time.Now().UTC(),
+	}
+	if len(enrollmentToken.Scopes) == 0 {
+		enrollmentToken.Scopes = models.DefaultAPIKeyScopes
+	}
+	if token.CreatedBy != "" {
+		enrollmentToken.CreatedBy = &token.CreatedBy
+	}
+
+	query, args, err := p.builder.
+		Insert("enrollment_tokens").
+		Columns(enrollmentTokenColumns...).
+		Values(enrollmentToken.ID, enrollmentToken.Name, enrollmentToken.TokenID, enrollmentToken.TokenHash,
+			models.FormatAPIKeyScopes(enrollmentToken.Scopes), enrollmentToken.MaxUses, 0,
+			enrollmentToken.ExpiresAt, enrollmentToken.CreatedAt, enrollmentToken.CreatedBy).
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build insert query: %w", err)
+	}
+
+	if _, err := p.db.ExecContext(ctx, query, args...); err != nil {
+		return nil, fmt.Errorf("failed to create enrollment token: %w", err)
+	}
+
+	return enrollmentToken, nil
+}
+
+// GetAllEnrollmentTokens retrieves all enrollment tokens, newest first
+func (p *PostgresDB) GetAllEnrollmentTokens(ctx context.Context) ([]models.EnrollmentToken, error) {
+	ctx, cancel := p.withTimeout(ctx, "GetAllEnrollmentTokens")
+	defer cancel()
+
+	query, args, err := p.builder.
+		Select(enrollmentTokenColumns...).
+		From("enrollment_tokens").
+		OrderBy("created_at DESC").
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build select query: %w", err)
+	}
+
+	rows, err := p.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query enrollment tokens: %w", err)
+	}
+	defer rows.Close()
+
+	tokens := []models.EnrollmentToken{}
+	for rows.Next() {
+		token, err := scanEnrollmentToken(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan enrollment token: %w", err)
+		}
+		tokens = append(tokens, *token)
+	}
+
+	return tokens, rows.Err()
+}
+
+// DeleteEnrollmentToken deletes an enrollment token. Keys already issued
+// with it keep working.
+func (p *PostgresDB) DeleteEnrollmentToken(ctx context.Context, id uuid.UUID) error {
+	ctx, cancel := p.withTimeout(ctx, "DeleteEnrollmentToken")
+	defer cancel()
+
+	query, args, err := p.builder.
+		Delete("enrollment_tokens").
+		Where(sq.Eq{"id": id}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build delete query: %w", err)
+	}
+
+	result, err := p.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to delete enrollment token: %w", err)
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return fmt.Errorf("enrollment token not found")
+	}
+
+	return nil
+}
+
+// EnrollNode uses up one use of an enrollment token and issues plainKey as
+// an API key bound to nodeID, with the token's scopes. Both happen in one
+// transaction, so a token never issues more keys than it has uses.
+func (p *PostgresDB) EnrollNode(ctx context.Context, plainToken, plainKey string, nodeID uuid.UUID, nodeName string) (*models.APIKey, error) {
+	ctx, cancel := p.withTimeout(ctx, "EnrollNode")
+	defer cancel()
+
+	tokenID := auth.EnrollmentTokenID(plainToken)
+	if tokenID == "" {
+		return nil, fmt.Errorf("invalid enrollment token")
+	}
+
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query, args, err := p.builder.
+		Select(enrollmentTokenColumns...).
+		From("enrollment_tokens").
+		Where(sq.Eq{"token_id": tokenID}).
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build select query: %w", err)
+	}
+
+	token, err := scanEnrollmentToken(tx.QueryRowContext(ctx, query, args...))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("invalid enrollment token")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get enrollment token: %w", err)
+	}
+	if !auth.VerifyAPIKeyDigest(p.keyHasher.Digest(plainToken), token.TokenHash) {
+		return nil, fmt.Errorf("invalid enrollment token")
+	}
+	if err := auth.CheckEnrollmentTokenUsable(token, time.Now()); err != nil {
+		return nil, err
+	}
+
+	// Guards against concurrent enrollments taking the last use twice
+	query, args, err = p.builder.
+		Update("enrollment_tokens").
+		Set("uses", sq.Expr("uses + 1")).
+		Where(sq.Eq{"id": token.ID}).
+		Where("uses < max_uses").
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build update query: %w", err)
+	}
+
+	result, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to use enrollment token: %w", err)
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return nil, fmt.Errorf("enrollment token has been used up")
+	}
+
+	apiKey, query, args, err := p.insertAPIKey(plainKey, models.NewAPIKey{
+		Name:      nodeName,
+		CreatedBy: models.EnrolledBy(token),
+		Scopes:    token.Scopes,
+		NodeID:    &nodeID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		return nil, fmt.Errorf("failed to create API key: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return apiKey, nil
+}
+
+// scanEnrollmentToken scans a row selected with enrollmentTokenColumns
+func scanEnrollmentToken(row interface{ Scan(...interface{}) error }) (*models.EnrollmentToken, error) {
+	var token models.EnrollmentToken
+	var scopes string
+
+	err := row.Scan(
+		&token.ID,
+		&token.Name,
+		&token.TokenID,
+		&token.TokenHash,
+		&scopes,
+		&token.MaxUses,
+		&token.Uses,
+		&token.ExpiresAt,
+		&token.CreatedAt,
+		&token.CreatedBy,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	token.Scopes = models.ParseAPIKeyScopes(scopes)
+
+	return &token, nil
+}
@@ -1,12 +1,13 @@
 package postgres
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"mark7888/speedtest-data-server/internal/logger"
 	"strings"
 	"time"
 
-	"mark7888/speedtest-data-server/internal/logger"
 	"mark7888/speedtest-data-server/pkg/models"
 
 	sq "github.com/Masterminds/squirrel"
@@ -15,8 +16,8 @@ import (
 )
 
 // InsertMeasurement inserts or updates a measurement
-func (p *PostgresDB) InsertMeasurement(m *models.Measurement) error {
-	ctx, cancel := withTimeout()
+func (p *PostgresDB) InsertMeasurement(ctx context.Context, m *models.Measurement) error {
+	ctx, cancel := p.withTimeout(ctx, "InsertMeasurement")
 	defer cancel()
 
 	query := `
@@ -30,7 +31,8 @@ func (p *PostgresDB) InsertMeasurement(m *models.Measurement) error {
 			packet_loss, isp,
 			interface_internal_ip, interface_name, interface_mac, interface_is_vpn, interface_external_ip,
 			server_id, server_host, server_port, server_name, server_location, server_country, server_ip,
-			result_id, result_url
+			result_id, result_url,
+			clock_skew_ms, original_timestamp
 		) VALUES (
 			$1, $2, NOW(),
 			$3, $4, $5, $6,
@@ -41,7 +43,8 @@ func (p *PostgresDB) InsertMeasurement(m *models.Measurement) error {
 			$21, $22,
 			$23, $24, $25, $26, $27,
 			$28, $29, $30, $31, $32, $33, $34,
-			$35, $36
+			$35, $36,
+			$37, $38
 		)
 		ON CONFLICT (node_id, timestamp) DO UPDATE SET
 			ping_jitter = EXCLUDED.ping_jitter,
@@ -77,7 +80,9 @@ func (p *PostgresDB) InsertMeasurement(m *models.Measurement) error {
 			server_country = EXCLUDED.server_country,
 			server_ip = EXCLUDED.server_ip,
 			result_id = EXCLUDED.result_id,
-			result_url = EXCLUDED.result_url
+			result_url = EXCLUDED.result_url,
+			clock_skew_ms = EXCLUDED.clock_skew_ms,
+			original_timestamp = EXCLUDED.original_timestamp
 	`
 
 	_, err := p.db.ExecContext(ctx, query,
@@ -91,6 +96,7 @@ func (p *PostgresDB) InsertMeasurement(m *models.Measurement) error {
 		m.InterfaceInternalIP, m.InterfaceName, m.InterfaceMacAddr, m.InterfaceIsVPN, m.InterfaceExternalIP,
 		m.ServerID, m.ServerHost, m.ServerPort, m.ServerName, m.ServerLocation, m.ServerCountry, m.ServerIP,
 		m.ResultID, m.ResultURL,
+		m.ClockSkewMs, m.OriginalTimestamp,
 	)
 
 	if err != nil {
@@ -101,14 +107,14 @@ func (p *PostgresDB) InsertMeasurement(m *models.Measurement) error {
 }
 
 // InsertFailedMeasurement inserts a failed measurement record
-func (p *PostgresDB) InsertFailedMeasurement(nodeID uuid.UUID, timestamp time.Time, errorMessage string, retryCount int) error {
-	ctx, cancel := withTimeout()
+func (p *PostgresDB) InsertFailedMeasurement(ctx context.Context, f *models.FailedMeasurement) error {
+	ctx, cancel := p.withTimeout(ctx, "InsertFailedMeasurement")
 	defer cancel()
 
 	query, args, err := p.builder.
 		Insert("failed_measurements").
-		Columns("node_id", "timestamp", "error_message", "retry_count", "created_at").
-		Values(nodeID, timestamp, errorMessage, retryCount, sq.Expr("NOW()")).
+		Columns("node_id", "timestamp", "error_message", "retry_count", "created_at", "clock_skew_ms", "original_timestamp").
+		Values(f.NodeID, f.Timestamp, f.ErrorMessage, f.RetryCount, sq.Expr("NOW()"), f.ClockSkewMs, f.OriginalTimestamp).
 		ToSql()
 	if err != nil {
 		return fmt.Errorf("failed to build insert query: %w", err)
@@ -123,8 +129,8 @@ func (p *PostgresDB) InsertFailedMeasurement(nodeID uuid.UUID, timestamp time.Ti
 }
 
 // GetMeasurementsByNode retrieves measurements for a specific node
-func (p *PostgresDB) GetMeasurementsByNode(nodeID uuid.UUID, from, to *time.Time, page, limit int, status string) ([]models.Measurement, int, error) {
-	ctx, cancel := withTimeout()
+func (p *PostgresDB) GetMeasurementsByNode(ctx context.Context, nodeID uuid.UUID, from, to *time.Time, page, limit int, status string) ([]models.Measurement, int, error) {
+	ctx, cancel := p.withTimeout(ctx, "GetMeasurementsByNode")
 	defer cancel()
 
 	// Default to "all" if status is empty
@@ -197,6 +203,7 @@ func (p *PostgresDB) GetMeasurementsByNode(nodeID uuid.UUID, from, to *time.Time
 				NULL, NULL, NULL, NULL, NULL,
 				NULL, NULL, NULL, NULL, NULL, NULL, NULL,
 				NULL, NULL,
+				clock_skew_ms, original_timestamp,
 				true as is_failed,
 				error_message
 			FROM failed_measurements
@@ -220,6 +227,7 @@ func (p *PostgresDB) GetMeasurementsByNode(nodeID uuid.UUID, from, to *time.Time
 				interface_internal_ip, interface_name, interface_mac, interface_is_vpn, interface_external_ip,
 				server_id, server_host, server_port, server_name, server_location, server_country, server_ip,
 				result_id, result_url,
+				clock_skew_ms, original_timestamp,
 				false as is_failed,
 				NULL as error_message
 			FROM measurements
@@ -246,6 +254,7 @@ func (p *PostgresDB) GetMeasurementsByNode(nodeID uuid.UUID, from, to *time.Time
 					interface_internal_ip, interface_name, interface_mac, interface_is_vpn, interface_external_ip,
 					server_id, server_host, server_port, server_name, server_location, server_country, server_ip,
 					result_id, result_url,
+					clock_skew_ms, original_timestamp,
 					false as is_failed,
 					NULL as error_message
 				FROM measurements
@@ -262,6 +271,7 @@ func (p *PostgresDB) GetMeasurementsByNode(nodeID uuid.UUID, from, to *time.Time
 					NULL, NULL, NULL, NULL, NULL,
 					NULL, NULL, NULL, NULL, NULL, NULL, NULL,
 					NULL, NULL,
+					clock_skew_ms, original_timestamp,
 					true as is_failed,
 					error_message
 				FROM failed_measurements
@@ -294,6 +304,7 @@ func (p *PostgresDB) GetMeasurementsByNode(nodeID uuid.UUID, from, to *time.Time
 			&m.InterfaceInternalIP, &m.InterfaceName, &m.InterfaceMacAddr, &m.InterfaceIsVPN, &m.InterfaceExternalIP,
 			&m.ServerID, &m.ServerHost, &m.ServerPort, &m.ServerName, &m.ServerLocation, &m.ServerCountry, &m.ServerIP,
 			&m.ResultID, &m.ResultURL,
+			&m.ClockSkewMs, &m.OriginalTimestamp,
 			&m.IsFailed, &m.ErrorMessage,
 		)
 		if err != nil {
@@ -357,8 +368,8 @@ func (p *PostgresDB) extractArgs(conditions sq.And) []interface{} {
 }
 
 // GetAggregatedMeasurements retrieves aggregated measurements for charting
-func (p *PostgresDB) GetAggregatedMeasurements(nodeIDs []uuid.UUID, from, to time.Time, interval string, hideArchived bool) ([]models.AggregatedMeasurement, error) {
-	ctx, cancel := withTimeout()
+func (p *PostgresDB) GetAggregatedMeasurements(ctx context.Context, nodeIDs []uuid.UUID, from, to time.Time, interval string, hideArchived bool) ([]models.AggregatedMeasurement, error) {
+	ctx, cancel := p.withTimeout(ctx, "GetAggregatedMeasurements")
 	defer cancel()
 
 	// Get database-specific date truncation function
@@ -476,8 +487,8 @@ func getDateTruncSQL(interval string) (string, error) {
 }
 
 // GetMeasurementCounts retrieves measurement counts
-func (p *PostgresDB) GetMeasurementCounts() (total int64, last24h int64, lastTimestamp *time.Time, err error) {
-	ctx, cancel := withTimeout()
+func (p *PostgresDB) GetMeasurementCounts(ctx context.Context) (total int64, last24h int64, lastTimestamp *time.Time, err error) {
+	ctx, cancel := p.withTimeout(ctx, "GetMeasurementCounts")
 	defer cancel()
 
 	// Get total count
@@ -522,8 +533,8 @@ func (p *PostgresDB) GetMeasurementCounts() (total int64, last24h int64, lastTim
 }
 
 // GetLast24hStats retrieves average statistics for the last 24 hours
-func (p *PostgresDB) GetLast24hStats() (*models.DashboardStats24h, error) {
-	ctx, cancel := withTimeout()
+func (p *PostgresDB) GetLast24hStats(ctx context.Context) (*models.DashboardStats24h, error) {
+	ctx, cancel := p.withTimeout(ctx, "GetLast24hStats")
 	defer cancel()
 
 	past24h := time.Now().UTC().Add(-24 * time.Hour)
@@ -558,8 +569,8 @@ func (p *PostgresDB) GetLast24hStats() (*models.DashboardStats24h, error) {
 }
 
 // CleanupOldMeasurements removes measurements older than the retention period
-func (p *PostgresDB) CleanupOldMeasurements(retentionDays int) (int64, error) {
-	ctx, cancel := withTimeout()
+func (p *PostgresDB) CleanupOldMeasurements(ctx context.Context, retentionDays int) (int64, error) {
+	ctx, cancel := p.withTimeout(ctx, "CleanupOldMeasurements")
 	defer cancel()
 
 	cutoffDate := time.Now().UTC().AddDate(0, 0, -retentionDays)
@@ -579,7 +590,7 @@ func (p *PostgresDB) CleanupOldMeasurements(retentionDays int) (int64, error) {
 
 	deleted, _ := result.RowsAffected()
 	if deleted > 0 {
-		logger.Log.Info("Cleaned up old measurements",
+		logger.FromContext(ctx).Info("Cleaned up old measurements",
 			zap.Int64("deleted", deleted),
 			zap.Time("cutoff_date", cutoffDate),
 		)
@@ -589,8 +600,8 @@ func (p *PostgresDB) CleanupOldMeasurements(retentionDays int) (int64, error) {
 }
 
 // CleanupOldFailedMeasurements removes failed measurements older than the retention period
-func (p *PostgresDB) CleanupOldFailedMeasurements(retentionDays int) (int64, error) {
-	ctx, cancel := withTimeout()
+func (p *PostgresDB) CleanupOldFailedMeasurements(ctx context.Context, retentionDays int) (int64, error) {
+	ctx, cancel := p.withTimeout(ctx, "CleanupOldFailedMeasurements")
 	defer cancel()
 
 	cutoffDate := time.Now().UTC().AddDate(0, 0, -retentionDays)
@@ -610,7 +621,7 @@ func (p *PostgresDB) CleanupOldFailedMeasurements(retentionDays int) (int64, err
 
 	deleted, _ := result.RowsAffected()
 	if deleted > 0 {
-		logger.Log.Info("Cleaned up old failed measurements",
+		logger.FromContext(ctx).Info("Cleaned up old failed measurements",
 			zap.Int64("deleted", deleted),
 			zap.Time("cutoff_date", cutoffDate),
 		)
@@ -0,0 +1,21 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS node_commands (
+	id UUID PRIMARY KEY,
+	node_id UUID NOT NULL REFERENCES nodes(id) ON DELETE CASCADE,
+	command VARCHAR(50) NOT NULL,
+	status VARCHAR(20) NOT NULL DEFAULT 'pending',
+	created_by VARCHAR(100),
+	created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+	delivered_at TIMESTAMP,
+	completed_at TIMESTAMP,
+	error_message TEXT,
+	measurement_timestamp TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_node_commands_node_status ON node_commands(node_id, status);
+CREATE INDEX IF NOT EXISTS idx_node_commands_created_at ON node_commands(created_at);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_node_commands_created_at;
+DROP INDEX IF EXISTS idx_node_commands_node_status;
+DROP TABLE IF EXISTS node_commands;
@@ -0,0 +1,15 @@
+-- +goose Up
+-- scope is either 'default' (fleet-wide settings) or a node ID (per-node overrides)
+CREATE TABLE IF NOT EXISTS node_configs (
+	scope VARCHAR(36) PRIMARY KEY,
+	settings TEXT NOT NULL,
+	updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+	updated_by VARCHAR(100)
+);
+
+-- Config version the node reports it is running
+ALTER TABLE nodes ADD COLUMN IF NOT EXISTS config_version VARCHAR(64);
+
+-- +goose Down
+ALTER TABLE nodes DROP COLUMN IF EXISTS config_version;
+DROP TABLE IF EXISTS node_configs;
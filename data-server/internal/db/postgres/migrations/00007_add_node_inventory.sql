@@ -0,0 +1,10 @@
+-- +goose Up
+-- Latest inventory snapshot each node sent with its alive signal
+CREATE TABLE IF NOT EXISTS node_inventory (
+	node_id UUID PRIMARY KEY REFERENCES nodes(id) ON DELETE CASCADE,
+	inventory TEXT NOT NULL,
+	reported_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS node_inventory;
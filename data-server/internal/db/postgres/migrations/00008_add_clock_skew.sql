@@ -0,0 +1,17 @@
+-- +goose Up
+-- Offset of the node's clock from server time as last estimated by the node (server - node)
+ALTER TABLE nodes ADD COLUMN IF NOT EXISTS clock_offset_ms BIGINT;
+
+-- Set on results from nodes whose clock was off by more than the skew threshold.
+-- original_timestamp keeps the node's own timestamp when it was corrected.
+ALTER TABLE measurements ADD COLUMN IF NOT EXISTS clock_skew_ms BIGINT;
+ALTER TABLE measurements ADD COLUMN IF NOT EXISTS original_timestamp TIMESTAMP;
+ALTER TABLE failed_measurements ADD COLUMN IF NOT EXISTS clock_skew_ms BIGINT;
+ALTER TABLE failed_measurements ADD COLUMN IF NOT EXISTS original_timestamp TIMESTAMP;
+
+-- +goose Down
+ALTER TABLE failed_measurements DROP COLUMN IF EXISTS original_timestamp;
+ALTER TABLE failed_measurements DROP COLUMN IF EXISTS clock_skew_ms;
+ALTER TABLE measurements DROP COLUMN IF EXISTS original_timestamp;
+ALTER TABLE measurements DROP COLUMN IF EXISTS clock_skew_ms;
+ALTER TABLE nodes DROP COLUMN IF EXISTS clock_offset_ms;
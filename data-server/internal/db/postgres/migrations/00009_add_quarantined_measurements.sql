@@ -0,0 +1,18 @@
+-- +goose Up
+-- Measurements held back by the plausibility checks until an admin reviews them
+CREATE TABLE IF NOT EXISTS quarantined_measurements (
+	id UUID PRIMARY KEY,
+	node_id UUID NOT NULL REFERENCES nodes(id) ON DELETE CASCADE,
+	timestamp TIMESTAMP NOT NULL,
+	measurement TEXT NOT NULL,
+	reasons TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_quarantined_measurements_node_timestamp ON quarantined_measurements(node_id, timestamp);
+CREATE INDEX IF NOT EXISTS idx_quarantined_measurements_created_at ON quarantined_measurements(created_at);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_quarantined_measurements_created_at;
+DROP INDEX IF EXISTS idx_quarantined_measurements_node_timestamp;
+DROP TABLE IF EXISTS quarantined_measurements;
@@ -0,0 +1,10 @@
+-- +goose Up
+-- Public key IDs let API keys be found by index instead of checking every
+-- stored hash. Keys issued before this have none until first verified.
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS key_id VARCHAR(64);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_api_keys_key_id ON api_keys(key_id);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_api_keys_key_id;
+ALTER TABLE api_keys DROP COLUMN IF EXISTS key_id;
@@ -0,0 +1,9 @@
+-- +goose Up
+-- An API key may only submit data for the node it is bound to. Keys are
+-- bound by an admin or to the first node that uses them.
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS node_id UUID;
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS bound_at TIMESTAMP;
+
+-- +goose Down
+ALTER TABLE api_keys DROP COLUMN IF EXISTS bound_at;
+ALTER TABLE api_keys DROP COLUMN IF EXISTS node_id;
@@ -0,0 +1,12 @@
+-- +goose Up
+-- Scopes limit what a key may do; existing keys keep what they could do
+-- before. Keys may expire, and a rotated key expires after a grace period
+-- once its successor is issued.
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS scopes TEXT NOT NULL DEFAULT 'ingest,alive';
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS expires_at TIMESTAMP;
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS replaced_by UUID;
+
+-- +goose Down
+ALTER TABLE api_keys DROP COLUMN IF EXISTS replaced_by;
+ALTER TABLE api_keys DROP COLUMN IF EXISTS expires_at;
+ALTER TABLE api_keys DROP COLUMN IF EXISTS scopes;
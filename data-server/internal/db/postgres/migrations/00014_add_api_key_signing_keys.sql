@@ -0,0 +1,7 @@
+-- +goose Up
+-- Nodes can sign requests with a key derived from their API key. The server
+-- keeps it encrypted; keys from before get it the next time they are used.
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS signing_key TEXT;
+
+-- +goose Down
+ALTER TABLE api_keys DROP COLUMN IF EXISTS signing_key;
@@ -0,0 +1,16 @@
+-- +goose Up
+-- Admin API accounts, next to the admin account from the server configuration
+CREATE TABLE IF NOT EXISTS users (
+	id UUID PRIMARY KEY,
+	username VARCHAR(64) NOT NULL UNIQUE,
+	password_hash VARCHAR(255) NOT NULL,
+	role VARCHAR(20) NOT NULL,
+	enabled BOOLEAN NOT NULL DEFAULT TRUE,
+	created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+	created_by VARCHAR(100),
+	updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+	last_login_at TIMESTAMP
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,27 @@
+-- +goose Up
+-- Optional second factor for admin API accounts. The TOTP secret is kept
+-- encrypted; it is set when enrollment starts and enabled once a code from
+-- it has been verified. totp_last_step is the time step of the last code
+-- accepted, so a code cannot be used twice.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_secret TEXT;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_enabled BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_last_step BIGINT NOT NULL DEFAULT 0;
+
+-- One-time codes for signing in without the authenticator; only their
+-- digests are stored
+CREATE TABLE IF NOT EXISTS user_recovery_codes (
+	id UUID PRIMARY KEY,
+	user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	code_digest VARCHAR(64) NOT NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+	used_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_recovery_codes_user_id ON user_recovery_codes(user_id);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_user_recovery_codes_user_id;
+DROP TABLE IF EXISTS user_recovery_codes;
+ALTER TABLE users DROP COLUMN IF EXISTS totp_last_step;
+ALTER TABLE users DROP COLUMN IF EXISTS totp_enabled;
+ALTER TABLE users DROP COLUMN IF EXISTS totp_secret;
@@ -0,0 +1,38 @@
+-- +goose Up
+-- Admin API logins. Access tokens name their session, so revoking it signs
+-- them out before they expire.
+CREATE TABLE IF NOT EXISTS sessions (
+	id UUID PRIMARY KEY,
+	username VARCHAR(255) NOT NULL,
+	role VARCHAR(20) NOT NULL,
+	source VARCHAR(32) NOT NULL DEFAULT '',
+	user_agent TEXT NOT NULL DEFAULT '',
+	client_ip VARCHAR(64) NOT NULL DEFAULT '',
+	created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+	last_used_at TIMESTAMP NOT NULL DEFAULT NOW(),
+	expires_at TIMESTAMP NOT NULL,
+	revoked_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_sessions_username ON sessions(username);
+CREATE INDEX IF NOT EXISTS idx_sessions_expires_at ON sessions(expires_at);
+
+-- Refresh tokens, replaced every time one is used. Used tokens are kept
+-- with their session: presenting one again means it was stolen, and the
+-- session is revoked. Only digests of the secrets are stored.
+CREATE TABLE IF NOT EXISTS session_refresh_tokens (
+	token_id VARCHAR(32) PRIMARY KEY,
+	session_id UUID NOT NULL REFERENCES sessions(id) ON DELETE CASCADE,
+	token_digest VARCHAR(64) NOT NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+	used_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_session_refresh_tokens_session_id ON session_refresh_tokens(session_id);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_session_refresh_tokens_session_id;
+DROP TABLE IF EXISTS session_refresh_tokens;
+DROP INDEX IF EXISTS idx_sessions_expires_at;
+DROP INDEX IF EXISTS idx_sessions_username;
+DROP TABLE IF EXISTS sessions;
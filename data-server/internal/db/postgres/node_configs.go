@@ -0,0 +1,134 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"mark7888/speedtest-data-server/pkg/models"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/google/uuid"
+)
+
+// GetNodeConfig retrieves the settings stored for a scope, or nil if none have been set
+func (p *PostgresDB) GetNodeConfig(ctx context.Context, scope string) (*models.NodeConfig, error) {
+	ctx, cancel := p.withTimeout(ctx, "GetNodeConfig")
+	defer cancel()
+
+	query, args, err := p.builder.
+		Select("scope", "settings", "updated_at", "updated_by").
+		From("node_configs").
+		Where(sq.Eq{"scope": scope}).
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build select query: %w", err)
+	}
+
+	var config models.NodeConfig
+	var settings string
+
+	err = p.db.QueryRowContext(ctx, query, args...).Scan(
+		&config.Scope,
+		&settings,
+		&config.UpdatedAt,
+		&config.UpdatedBy,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get node config: %w", err)
+	}
+
+	if err := json.Unmarshal([]byte(settings), &config.Settings); err != nil {
+		return nil, fmt.Errorf("failed to decode node config: %w", err)
+	}
+
+	return &config, nil
+}
+
+// SetNodeConfig creates or replaces the settings stored for a scope
+func (p *PostgresDB) SetNodeConfig(ctx context.Context, scope string, settings models.NodeSettings, updatedBy string) (*models.NodeConfig, error) {
+	ctx, cancel := p.withTimeout(ctx, "SetNodeConfig")
+	defer cancel()
+
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode node config: %w", err)
+	}
+
+	config := &models.NodeConfig{
+		Scope:     scope,
+		Settings:  settings,
+		UpdatedAt: time.Now().UTC(),
+	}
+	if updatedBy != "" {
+		config.UpdatedBy = &updatedBy
+	}
+
+	query, args, err := p.builder.
+		Insert("node_configs").
+		Columns("scope", "settings", "updated_at", "updated_by").
+		Values(scope, string(data), config.UpdatedAt, config.UpdatedBy).
+		Suffix("ON CONFLICT (scope) DO UPDATE SET settings = excluded.settings, updated_at = excluded.updated_at, updated_by = excluded.updated_by").
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build insert query: %w", err)
+	}
+
+	if _, err := p.db.ExecContext(ctx, query, args...); err != nil {
+		return nil, fmt.Errorf("failed to set node config: %w", err)
+	}
+
+	return config, nil
+}
+
+// DeleteNodeConfig removes the settings stored for a scope
+func (p *PostgresDB) DeleteNodeConfig(ctx context.Context, scope string) error {
+	ctx, cancel := p.withTimeout(ctx, "DeleteNodeConfig")
+	defer cancel()
+
+	query, args, err := p.builder.
+		Delete("node_configs").
+		Where(sq.Eq{"scope": scope}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build delete query: %w", err)
+	}
+
+	result, err := p.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to delete node config: %w", err)
+	}
+
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return fmt.Errorf("node config not found")
+	}
+
+	return nil
+}
+
+// UpdateNodeConfigVersion records the config version a node reports running
+func (p *PostgresDB) UpdateNodeConfigVersion(ctx context.Context, nodeID uuid.UUID, version string) error {
+	ctx, cancel := p.withTimeout(ctx, "UpdateNodeConfigVersion")
+	defer cancel()
+
+	query, args, err := p.builder.
+		Update("nodes").
+		Set("config_version", version).
+		Where(sq.Eq{"id": nodeID}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build update query: %w", err)
+	}
+
+	if _, err := p.db.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("failed to update node config version: %w", err)
+	}
+
+	return nil
+}
@@ -1,11 +1,13 @@
 package postgres
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
+	"mark7888/speedtest-data-server/internal/logger"
 	"time"
 
-	"mark7888/speedtest-data-server/internal/logger"
 	"mark7888/speedtest-data-server/pkg/models"
 
 	sq "github.com/Masterminds/squirrel"
@@ -14,8 +16,8 @@ import (
 )
 
 // UpsertNode creates or updates a node (used for alive signals and self-registration)
-func (p *PostgresDB) UpsertNode(nodeID uuid.UUID, nodeName string, nodeLocation *string) error {
-	ctx, cancel := withTimeout()
+func (p *PostgresDB) UpsertNode(ctx context.Context, nodeID uuid.UUID, nodeName string, nodeLocation *string) error {
+	ctx, cancel := p.withTimeout(ctx, "UpsertNode")
 	defer cancel()
 
 	now := time.Now().UTC()
@@ -65,12 +67,12 @@ func (p *PostgresDB) UpsertNode(nodeID uuid.UUID, nodeName string, nodeLocation
 }
 
 // GetNodeByID retrieves a node by ID
-func (p *PostgresDB) GetNodeByID(nodeID uuid.UUID) (*models.Node, error) {
-	ctx, cancel := withTimeout()
+func (p *PostgresDB) GetNodeByID(ctx context.Context, nodeID uuid.UUID) (*models.Node, error) {
+	ctx, cancel := p.withTimeout(ctx, "GetNodeByID")
 	defer cancel()
 
 	query, args, err := p.builder.
-		Select("id", "name", "location", "first_seen", "last_seen", "last_alive", "status", "archived", "favorite", "created_at", "updated_at").
+		Select("id", "name", "location", "first_seen", "last_seen", "last_alive", "status", "archived", "favorite", "config_version", "clock_offset_ms", "created_at", "updated_at").
 		From("nodes").
 		Where(sq.Eq{"id": nodeID}).
 		ToSql()
@@ -89,6 +91,8 @@ func (p *PostgresDB) GetNodeByID(nodeID uuid.UUID) (*models.Node, error) {
 		&node.Status,
 		&node.Archived,
 		&node.Favorite,
+		&node.ConfigVersion,
+		&node.ClockOffsetMs,
 		&node.CreatedAt,
 		&node.UpdatedAt,
 	)
@@ -104,8 +108,8 @@ func (p *PostgresDB) GetNodeByID(nodeID uuid.UUID) (*models.Node, error) {
 }
 
 // GetAllNodes retrieves all nodes with optional status filter
-func (p *PostgresDB) GetAllNodes(status string, page, limit int) ([]models.Node, int, error) {
-	ctx, cancel := withTimeout()
+func (p *PostgresDB) GetAllNodes(ctx context.Context, status string, page, limit int) ([]models.Node, int, error) {
+	ctx, cancel := p.withTimeout(ctx, "GetAllNodes")
 	defer cancel()
 
 	// Validate status against known values to prevent unexpected filter behaviour.
@@ -116,7 +120,7 @@ func (p *PostgresDB) GetAllNodes(status string, page, limit int) ([]models.Node,
 
 	// Build base query
 	selectQuery := p.builder.
-		Select("id", "name", "location", "first_seen", "last_seen", "last_alive", "status", "archived", "favorite", "created_at", "updated_at").
+		Select("id", "name", "location", "first_seen", "last_seen", "last_alive", "status", "archived", "favorite", "config_version", "clock_offset_ms", "created_at", "updated_at").
 		From("nodes")
 
 	countQuery := p.builder.Select("COUNT(*)").From("nodes")
@@ -168,6 +172,8 @@ func (p *PostgresDB) GetAllNodes(status string, page, limit int) ([]models.Node,
 			&node.Status,
 			&node.Archived,
 			&node.Favorite,
+			&node.ConfigVersion,
+			&node.ClockOffsetMs,
 			&node.CreatedAt,
 			&node.UpdatedAt,
 		)
@@ -181,12 +187,12 @@ func (p *PostgresDB) GetAllNodes(status string, page, limit int) ([]models.Node,
 }
 
 // GetNodeWithStats retrieves a node with statistics
-func (p *PostgresDB) GetNodeWithStats(nodeID uuid.UUID) (*models.NodeWithStats, error) {
-	ctx, cancel := withTimeout()
+func (p *PostgresDB) GetNodeWithStats(ctx context.Context, nodeID uuid.UUID) (*models.NodeWithStats, error) {
+	ctx, cancel := p.withTimeout(ctx, "GetNodeWithStats")
 	defer cancel()
 
 	// Get node
-	node, err := p.GetNodeByID(nodeID)
+	node, err := p.GetNodeByID(ctx, nodeID)
 	if err != nil {
 		return nil, err
 	}
@@ -202,11 +208,11 @@ func (p *PostgresDB) GetNodeWithStats(nodeID uuid.UUID) (*models.NodeWithStats,
 		Where(sq.Eq{"node_id": nodeID}).
 		ToSql()
 	if err != nil {
-		logger.Log.Warn("Failed to build measurement count query", zap.Error(err))
+		logger.FromContext(ctx).Warn("Failed to build measurement count query", zap.Error(err))
 	} else {
 		err = p.db.QueryRowContext(ctx, countQuery, countArgs...).Scan(&nodeWithStats.MeasurementCount)
 		if err != nil {
-			logger.Log.Warn("Failed to get measurement count", zap.Error(err))
+			logger.FromContext(ctx).Warn("Failed to get measurement count", zap.Error(err))
 		}
 	}
 
@@ -217,11 +223,11 @@ func (p *PostgresDB) GetNodeWithStats(nodeID uuid.UUID) (*models.NodeWithStats,
 		Where(sq.Eq{"node_id": nodeID}).
 		ToSql()
 	if err != nil {
-		logger.Log.Warn("Failed to build failed count query", zap.Error(err))
+		logger.FromContext(ctx).Warn("Failed to build failed count query", zap.Error(err))
 	} else {
 		err = p.db.QueryRowContext(ctx, failedCountQuery, failedCountArgs...).Scan(&nodeWithStats.FailedTestCount)
 		if err != nil {
-			logger.Log.Warn("Failed to get failed test count", zap.Error(err))
+			logger.FromContext(ctx).Warn("Failed to get failed test count", zap.Error(err))
 		}
 	}
 
@@ -245,7 +251,7 @@ func (p *PostgresDB) GetNodeWithStats(nodeID uuid.UUID) (*models.NodeWithStats,
 		&stats.AvgPacketLoss,
 	)
 	if err != nil {
-		logger.Log.Warn("Failed to get node statistics", zap.Error(err))
+		logger.FromContext(ctx).Warn("Failed to get node statistics", zap.Error(err))
 	}
 
 	// Get success rate for last 24 hours
@@ -260,7 +266,7 @@ func (p *PostgresDB) GetNodeWithStats(nodeID uuid.UUID) (*models.NodeWithStats,
 		&stats.FailedCount24h,
 	)
 	if err != nil {
-		logger.Log.Warn("Failed to get 24h measurement counts", zap.Error(err))
+		logger.FromContext(ctx).Warn("Failed to get 24h measurement counts", zap.Error(err))
 	} else {
 		// Calculate success rate
 		totalCount := stats.SuccessCount24h + stats.FailedCount24h
@@ -288,7 +294,7 @@ func (p *PostgresDB) GetNodeWithStats(nodeID uuid.UUID) (*models.NodeWithStats,
 		Limit(1).
 		ToSql()
 	if err != nil {
-		logger.Log.Warn("Failed to build latest measurement query", zap.Error(err))
+		logger.FromContext(ctx).Warn("Failed to build latest measurement query", zap.Error(err))
 	} else {
 		err = p.db.QueryRowContext(ctx, latestQuery, latestArgs...).Scan(
 			&latestMeasurement.Timestamp,
@@ -297,24 +303,59 @@ func (p *PostgresDB) GetNodeWithStats(nodeID uuid.UUID) (*models.NodeWithStats,
 			&latestMeasurement.PingMs,
 		)
 		if err != nil && err != sql.ErrNoRows {
-			logger.Log.Warn("Failed to get latest measurement", zap.Error(err))
+			logger.FromContext(ctx).Warn("Failed to get latest measurement", zap.Error(err))
 		} else if err == nil {
 			nodeWithStats.LatestMeasurement = latestMeasurement
 		}
 	}
 
+	// Get latest inventory snapshot
+	inventoryQuery, inventoryArgs, err := p.builder.
+		Select("inventory", "reported_at").
+		From("node_inventory").
+		Where(sq.Eq{"node_id": nodeID}).
+		ToSql()
+	if err != nil {
+		logger.FromContext(ctx).Warn("Failed to build node inventory query", zap.Error(err))
+	} else {
+		var inventory string
+		var reportedAt time.Time
+		err = p.db.QueryRowContext(ctx, inventoryQuery, inventoryArgs...).Scan(&inventory, &reportedAt)
+		if err != nil && err != sql.ErrNoRows {
+			logger.FromContext(ctx).Warn("Failed to get node inventory", zap.Error(err))
+		} else if err == nil {
+			nodeWithStats.Inventory = &models.NodeInventory{}
+			if err := json.Unmarshal([]byte(inventory), nodeWithStats.Inventory); err != nil {
+				logger.FromContext(ctx).Warn("Failed to decode node inventory", zap.Error(err))
+				nodeWithStats.Inventory = nil
+			} else {
+				nodeWithStats.InventoryReportedAt = &reportedAt
+			}
+		}
+	}
+
 	return nodeWithStats, nil
 }
 
-// UpdateNodeStatus updates the status of nodes based on last_alive timestamp
-func (p *PostgresDB) UpdateNodeStatus(aliveTimeout, inactiveTimeout time.Duration) error {
-	ctx, cancel := withTimeout()
+// UpdateNodeStatus updates the status of nodes based on last_alive timestamp.
+// Nodes in connected hold a live control channel and are left untouched.
+func (p *PostgresDB) UpdateNodeStatus(ctx context.Context, aliveTimeout, inactiveTimeout time.Duration, connected []uuid.UUID) error {
+	ctx, cancel := p.withTimeout(ctx, "UpdateNodeStatus")
 	defer cancel()
 
 	now := time.Now().UTC()
 	unreachableThreshold := now.Add(-aliveTimeout)
 	inactiveThreshold := now.Add(-inactiveTimeout)
 
+	notConnected := sq.And{}
+	if len(connected) > 0 {
+		ids := make([]uuid.UUID, len(connected))
+		for i, id := range connected {
+			ids[i] = id
+		}
+		notConnected = sq.And{sq.NotEq{"id": ids}}
+	}
+
 	// Update to unreachable
 	query1, args1, err := p.builder.
 		Update("nodes").
@@ -323,6 +364,7 @@ func (p *PostgresDB) UpdateNodeStatus(aliveTimeout, inactiveTimeout time.Duratio
 		Where(sq.And{
 			sq.Eq{"status": "active"},
 			sq.Lt{"last_alive": unreachableThreshold},
+			notConnected,
 		}).
 		ToSql()
 	if err != nil {
@@ -336,7 +378,7 @@ func (p *PostgresDB) UpdateNodeStatus(aliveTimeout, inactiveTimeout time.Duratio
 
 	unreachableCount, _ := result.RowsAffected()
 	if unreachableCount > 0 {
-		logger.Log.Info("Updated nodes to unreachable", zap.Int64("count", unreachableCount))
+		logger.FromContext(ctx).Info("Updated nodes to unreachable", zap.Int64("count", unreachableCount))
 	}
 
 	// Update to inactive
@@ -350,6 +392,7 @@ func (p *PostgresDB) UpdateNodeStatus(aliveTimeout, inactiveTimeout time.Duratio
 				sq.Eq{"status": "unreachable"},
 			},
 			sq.Lt{"last_alive": inactiveThreshold},
+			notConnected,
 		}).
 		ToSql()
 	if err != nil {
@@ -363,15 +406,38 @@ func (p *PostgresDB) UpdateNodeStatus(aliveTimeout, inactiveTimeout time.Duratio
 
 	inactiveCount, _ := result.RowsAffected()
 	if inactiveCount > 0 {
-		logger.Log.Info("Updated nodes to inactive", zap.Int64("count", inactiveCount))
+		logger.FromContext(ctx).Info("Updated nodes to inactive", zap.Int64("count", inactiveCount))
+	}
+
+	return nil
+}
+
+// SetNodeStatus sets the status of a single node, e.g. when its control
+// channel disconnects
+func (p *PostgresDB) SetNodeStatus(ctx context.Context, nodeID uuid.UUID, status models.NodeStatus) error {
+	ctx, cancel := p.withTimeout(ctx, "SetNodeStatus")
+	defer cancel()
+
+	query, args, err := p.builder.
+		Update("nodes").
+		Set("status", string(status)).
+		Set("updated_at", sq.Expr("NOW()")).
+		Where(sq.Eq{"id": nodeID}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build update query: %w", err)
+	}
+
+	if _, err := p.db.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("failed to set node status: %w", err)
 	}
 
 	return nil
 }
 
 // GetNodeCounts returns counts of nodes by status (excluding archived nodes)
-func (p *PostgresDB) GetNodeCounts() (total, active, unreachable, inactive int, err error) {
-	ctx, cancel := withTimeout()
+func (p *PostgresDB) GetNodeCounts(ctx context.Context) (total, active, unreachable, inactive int, err error) {
+	ctx, cancel := p.withTimeout(ctx, "GetNodeCounts")
 	defer cancel()
 
 	query := `
@@ -393,8 +459,8 @@ func (p *PostgresDB) GetNodeCounts() (total, active, unreachable, inactive int,
 }
 
 // ArchiveNode sets the archived status of a node
-func (p *PostgresDB) ArchiveNode(nodeID uuid.UUID, archived bool) error {
-	ctx, cancel := withTimeout()
+func (p *PostgresDB) ArchiveNode(ctx context.Context, nodeID uuid.UUID, archived bool) error {
+	ctx, cancel := p.withTimeout(ctx, "ArchiveNode")
 	defer cancel()
 
 	query, args, err := p.builder.
@@ -417,7 +483,7 @@ func (p *PostgresDB) ArchiveNode(nodeID uuid.UUID, archived bool) error {
 		return fmt.Errorf("node not found")
 	}
 
-	logger.Log.Info("Node archived status updated",
+	logger.FromContext(ctx).Info("Node archived status updated",
 		zap.String("node_id", nodeID.String()),
 		zap.Bool("archived", archived),
 	)
@@ -426,8 +492,8 @@ func (p *PostgresDB) ArchiveNode(nodeID uuid.UUID, archived bool) error {
 }
 
 // SetNodeFavorite sets the favorite status of a node
-func (p *PostgresDB) SetNodeFavorite(nodeID uuid.UUID, favorite bool) error {
-	ctx, cancel := withTimeout()
+func (p *PostgresDB) SetNodeFavorite(ctx context.Context, nodeID uuid.UUID, favorite bool) error {
+	ctx, cancel := p.withTimeout(ctx, "SetNodeFavorite")
 	defer cancel()
 
 	query, args, err := p.builder.
@@ -450,7 +516,7 @@ func (p *PostgresDB) SetNodeFavorite(nodeID uuid.UUID, favorite bool) error {
 		return fmt.Errorf("node not found")
 	}
 
-	logger.Log.Info("Node favorite status updated",
+	logger.FromContext(ctx).Info("Node favorite status updated",
 		zap.String("node_id", nodeID.String()),
 		zap.Bool("favorite", favorite),
 	)
@@ -459,8 +525,8 @@ func (p *PostgresDB) SetNodeFavorite(nodeID uuid.UUID, favorite bool) error {
 }
 
 // DeleteNode deletes a node and all its associated measurements
-func (p *PostgresDB) DeleteNode(nodeID uuid.UUID) error {
-	ctx, cancel := withTimeout()
+func (p *PostgresDB) DeleteNode(ctx context.Context, nodeID uuid.UUID) error {
+	ctx, cancel := p.withTimeout(ctx, "DeleteNode")
 	defer cancel()
 
 	// Start transaction
@@ -482,6 +548,30 @@ func (p *PostgresDB) DeleteNode(nodeID uuid.UUID) error {
 		return fmt.Errorf("failed to delete failed measurements: %w", err)
 	}
 
+	// Delete queued commands
+	_, err = tx.ExecContext(ctx, "DELETE FROM node_commands WHERE node_id = $1", nodeID)
+	if err != nil {
+		return fmt.Errorf("failed to delete node commands: %w", err)
+	}
+
+	// Delete inventory snapshot
+	_, err = tx.ExecContext(ctx, "DELETE FROM node_inventory WHERE node_id = $1", nodeID)
+	if err != nil {
+		return fmt.Errorf("failed to delete node inventory: %w", err)
+	}
+
+	// Delete measurements awaiting review
+	_, err = tx.ExecContext(ctx, "DELETE FROM quarantined_measurements WHERE node_id = $1", nodeID)
+	if err != nil {
+		return fmt.Errorf("failed to delete quarantined measurements: %w", err)
+	}
+
+	// Delete per-node settings
+	_, err = tx.ExecContext(ctx, "DELETE FROM node_configs WHERE scope = $1", nodeID.String())
+	if err != nil {
+		return fmt.Errorf("failed to delete node config: %w", err)
+	}
+
 	// Delete node
 	result, err := tx.ExecContext(ctx, "DELETE FROM nodes WHERE id = $1", nodeID)
 	if err != nil {
@@ -498,9 +588,30 @@ func (p *PostgresDB) DeleteNode(nodeID uuid.UUID) error {
 		return fmt.Errorf("failed to commit transaction: %w", err)
 	}
 
-	logger.Log.Info("Node deleted successfully",
+	logger.FromContext(ctx).Info("Node deleted successfully",
 		zap.String("node_id", nodeID.String()),
 	)
 
 	return nil
 }
+
+// UpdateNodeClockOffset records the clock offset a node last estimated
+func (p *PostgresDB) UpdateNodeClockOffset(ctx context.Context, nodeID uuid.UUID, offsetMs int64) error {
+	ctx, cancel := p.withTimeout(ctx, "UpdateNodeClockOffset")
+	defer cancel()
+
+	query, args, err := p.builder.
+		Update("nodes").
+		Set("clock_offset_ms", offsetMs).
+		Where(sq.Eq{"id": nodeID}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build update query: %w", err)
+	}
+
+	if _, err := p.db.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("failed to update node clock offset: %w", err)
+	}
+
+	return nil
+}
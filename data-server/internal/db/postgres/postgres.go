@@ -7,8 +7,10 @@ import (
 	"sync"
 	"time"
 
+	"mark7888/speedtest-data-server/internal/auth"
 	"mark7888/speedtest-data-server/internal/config"
 	"mark7888/speedtest-data-server/internal/logger"
+	"mark7888/speedtest-data-server/internal/tracing"
 
 	sq "github.com/Masterminds/squirrel"
 	_ "github.com/lib/pq"
@@ -24,6 +26,10 @@ type PostgresDB struct {
 	pingMutex    sync.RWMutex
 	lastPingTime time.Time
 	lastPingErr  error
+
+	// API key lookup and verified-key cache
+	keyHasher *auth.APIKeyHasher
+	keyCache  *auth.APIKeyCache
 }
 
 // New creates a new PostgreSQL database connection
@@ -57,8 +63,10 @@ func New(cfg *config.Config) (*PostgresDB, error) {
 	builder := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
 
 	return &PostgresDB{
-		db:      db,
-		builder: builder,
+		db:        db,
+		builder:   builder,
+		keyHasher: auth.NewAPIKeyHasher(cfg.APIKeys.Secret),
+		keyCache:  auth.NewAPIKeyCache(cfg.APIKeys.CacheTTL),
 	}, nil
 }
 
@@ -69,15 +77,15 @@ func (p *PostgresDB) Close() error {
 }
 
 // Ping checks if the database connection is alive
-func (p *PostgresDB) Ping() error {
-	ctx, cancel := withTimeout()
+func (p *PostgresDB) Ping(ctx context.Context) error {
+	ctx, cancel := p.withTimeout(ctx, "Ping")
 	defer cancel()
 	return p.db.PingContext(ctx)
 }
 
 // SafePing checks if the database connection is alive with caching to prevent DDoS
 // Only performs an actual ping if the last ping was more than 5 seconds ago
-func (p *PostgresDB) SafePing() error {
+func (p *PostgresDB) SafePing(ctx context.Context) error {
 	// First, try to read the cached result
 	p.pingMutex.RLock()
 	if time.Since(p.lastPingTime) < 5*time.Second {
@@ -97,7 +105,7 @@ func (p *PostgresDB) SafePing() error {
 	}
 
 	// Perform the actual ping
-	ctx, cancel := withTimeout()
+	ctx, cancel := p.withTimeout(ctx, "SafePing")
 	defer cancel()
 	err := p.db.PingContext(ctx)
 
@@ -108,7 +116,9 @@ func (p *PostgresDB) SafePing() error {
 	return err
 }
 
-// withTimeout creates a context with a default timeout
-func withTimeout() (context.Context, context.CancelFunc) {
-	return context.WithTimeout(context.Background(), 10*time.Second)
+// withTimeout derives the context for a single method from ctx, adding a
+// default timeout and a span named by operation. Cancelling it ends the
+// method's span and records its duration.
+func (p *PostgresDB) withTimeout(ctx context.Context, operation string) (context.Context, context.CancelFunc) {
+	return tracing.StartQuery(ctx, "postgres", operation, 10*time.Second)
 }
@@ -0,0 +1,180 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"mark7888/speedtest-data-server/pkg/models"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/google/uuid"
+)
+
+// quarantinedMeasurementColumns are the columns scanned by scanQuarantinedMeasurement
+var quarantinedMeasurementColumns = []string{"id", "node_id", "timestamp", "measurement", "reasons", "created_at"}
+
+// QuarantineMeasurement holds back a measurement until it has been reviewed.
+// A node resending the same measurement replaces the one awaiting review.
+func (p *PostgresDB) QuarantineMeasurement(ctx context.Context, m *models.Measurement, reasons []string) error {
+	ctx, cancel := p.withTimeout(ctx, "QuarantineMeasurement")
+	defer cancel()
+
+	measurement, err := json.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("failed to encode measurement: %w", err)
+	}
+	encodedReasons, err := json.Marshal(reasons)
+	if err != nil {
+		return fmt.Errorf("failed to encode reasons: %w", err)
+	}
+
+	query, args, err := p.builder.
+		Insert("quarantined_measurements").
+		Columns(quarantinedMeasurementColumns...).
+		Values(uuid.New(), m.NodeID, m.Timestamp, string(measurement), string(encodedReasons), time.Now().UTC()).
+		Suffix("ON CONFLICT (node_id, timestamp) DO UPDATE SET measurement = excluded.measurement, reasons = excluded.reasons, created_at = excluded.created_at").
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build insert query: %w", err)
+	}
+
+	if _, err := p.db.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("failed to quarantine measurement: %w", err)
+	}
+
+	return nil
+}
+
+// GetQuarantinedMeasurements lists measurements awaiting review, oldest first,
+// optionally limited to one node
+func (p *PostgresDB) GetQuarantinedMeasurements(ctx context.Context, nodeID *uuid.UUID, page, limit int) ([]models.QuarantinedMeasurement, int, error) {
+	ctx, cancel := p.withTimeout(ctx, "GetQuarantinedMeasurements")
+	defer cancel()
+
+	selectQuery := p.builder.
+		Select(quarantinedMeasurementColumns...).
+		From("quarantined_measurements")
+	countQuery := p.builder.Select("COUNT(*)").From("quarantined_measurements")
+
+	if nodeID != nil {
+		selectQuery = selectQuery.Where(sq.Eq{"node_id": *nodeID})
+		countQuery = countQuery.Where(sq.Eq{"node_id": *nodeID})
+	}
+
+	countSQL, countArgs, err := countQuery.ToSql()
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to build count query: %w", err)
+	}
+
+	var total int
+	if err := p.db.QueryRowContext(ctx, countSQL, countArgs...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count quarantined measurements: %w", err)
+	}
+
+	selectSQL, selectArgs, err := selectQuery.
+		OrderBy("created_at ASC").
+		Limit(uint64(limit)).
+		Offset(uint64((page - 1) * limit)).
+		ToSql()
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to build select query: %w", err)
+	}
+
+	rows, err := p.db.QueryContext(ctx, selectSQL, selectArgs...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to query quarantined measurements: %w", err)
+	}
+	defer rows.Close()
+
+	measurements := []models.QuarantinedMeasurement{}
+	for rows.Next() {
+		quarantined, err := scanQuarantinedMeasurement(rows)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to scan quarantined measurement: %w", err)
+		}
+		measurements = append(measurements, *quarantined)
+	}
+
+	return measurements, total, nil
+}
+
+// GetQuarantinedMeasurement retrieves a quarantined measurement by ID
+func (p *PostgresDB) GetQuarantinedMeasurement(ctx context.Context, id uuid.UUID) (*models.QuarantinedMeasurement, error) {
+	ctx, cancel := p.withTimeout(ctx, "GetQuarantinedMeasurement")
+	defer cancel()
+
+	query, args, err := p.builder.
+		Select(quarantinedMeasurementColumns...).
+		From("quarantined_measurements").
+		Where(sq.Eq{"id": id}).
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build select query: %w", err)
+	}
+
+	quarantined, err := scanQuarantinedMeasurement(p.db.QueryRowContext(ctx, query, args...))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("quarantined measurement not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get quarantined measurement: %w", err)
+	}
+
+	return quarantined, nil
+}
+
+// DeleteQuarantinedMeasurement removes a measurement from quarantine
+func (p *PostgresDB) DeleteQuarantinedMeasurement(ctx context.Context, id uuid.UUID) error {
+	ctx, cancel := p.withTimeout(ctx, "DeleteQuarantinedMeasurement")
+	defer cancel()
+
+	query, args, err := p.builder.
+		Delete("quarantined_measurements").
+		Where(sq.Eq{"id": id}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build delete query: %w", err)
+	}
+
+	result, err := p.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to delete quarantined measurement: %w", err)
+	}
+
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return fmt.Errorf("quarantined measurement not found")
+	}
+
+	return nil
+}
+
+// scanQuarantinedMeasurement scans a row selected with quarantinedMeasurementColumns
+func scanQuarantinedMeasurement(row interface{ Scan(...interface{}) error }) (*models.QuarantinedMeasurement, error) {
+	var quarantined models.QuarantinedMeasurement
+	var measurement, reasons string
+
+	err := row.Scan(
+		&quarantined.ID,
+		&quarantined.NodeID,
+		&quarantined.Timestamp,
+		&measurement,
+		&reasons,
+		&quarantined.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal([]byte(measurement), &quarantined.Measurement); err != nil {
+		return nil, fmt.Errorf("failed to decode measurement: %w", err)
+	}
+	if err := json.Unmarshal([]byte(reasons), &quarantined.Reasons); err != nil {
+		return nil, fmt.Errorf("failed to decode reasons: %w", err)
+	}
+
+	return &quarantined, nil
+}
@@ -0,0 +1,359 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"mark7888/speedtest-data-server/internal/auth"
+	"mark7888/speedtest-data-server/pkg/models"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/google/uuid"
+)
+
+// sessionColumns are the columns scanned by scanSession
+var sessionColumns = []string{"id", "username", "role", "source", "user_agent", "client_ip", "created_at", "last_used_at", "expires_at", "revoked_at"}
+
+// queryExecer is what *sql.DB and *sql.Tx have in common
+type queryExecer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// CreateSession starts a session with plainRefreshToken as its first
+// refresh token
+func (p *PostgresDB) CreateSession(ctx context.Context, plainRefreshToken string, session models.NewSession) (*models.Session, error) {
+	ctx, cancel := p.withTimeout(ctx, "CreateSession")
+	defer cancel()
+
+	now := time.Now().UTC()
+	created := &models.Session{
+		ID:         uuid.New(),
+		Username:   session.Username,
+		Role:       session.Role,
+		Source:     session.Source,
+		UserAgent:  session.UserAgent,
+		ClientIP:   session.ClientIP,
+		CreatedAt:  now,
+		LastUsedAt: now,
+		ExpiresAt:  session.ExpiresAt.UTC(),
+	}
+
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query, args, err := p.builder.
+		Insert("sessions").
+		Columns("id", "username", "role", "source", "user_agent", "client_ip", "created_at", "last_used_at", "expires_at").
+		Values(created.ID, created.Username, created.Role, created.Source, created.UserAgent, created.ClientIP,
+			created.CreatedAt, created.LastUsedAt, created.ExpiresAt).
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build insert query: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		return nil, fmt.Errorf("failed to create session: %w", err)
+	}
+
+	if err := p.insertRefreshToken(ctx, tx, created.ID, plainRefreshToken, now); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return created, nil
+}
+
+// GetSession retrieves a session by ID, whether active or not
+func (p *PostgresDB) GetSession(ctx context.Context, id uuid.UUID) (*models.Session, error) {
+	ctx, cancel := p.withTimeout(ctx, "GetSession")
+	defer cancel()
+
+	return p.getSession(ctx, p.db, id)
+}
+
+// getSession retrieves a session by ID within a transaction or without
+func (p *PostgresDB) getSession(ctx context.Context, q queryExecer, id uuid.UUID) (*models.Session, error) {
+	query, args, err := p.builder.
+		Select(sessionColumns...).
+		From("sessions").
+		Where(sq.Eq{"id": id}).
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build select query: %w", err)
+	}
+
+	session, err := scanSession(q.QueryRowContext(ctx, query, args...))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("session not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get session: %w", err)
+	}
+
+	return session, nil
+}
+
+// GetActiveSessions retrieves the sessions that are neither revoked nor
+// expired of a user, or of all users if username is empty, most recently
+// used first
+func (p *PostgresDB) GetActiveSessions(ctx context.Context, username string) ([]models.Session, error) {
+	ctx, cancel := p.withTimeout(ctx, "GetActiveSessions")
+	defer cancel()
+
+	builder := p.builder.
+		Select(sessionColumns...).
+		From("sessions").
+		Where(sq.Eq{"revoked_at": nil}).
+		Where(sq.Gt{"expires_at": time.Now().UTC()}).
+		OrderBy("last_used_at DESC")
+	if username != "" {
+		builder = builder.Where(sq.Eq{"username": username})
+	}
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build select query: %w", err)
+	}
+
+	rows, err := p.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sessions: %w", err)
+	}
+	defer rows.Close()
+
+	sessions := []models.Session{}
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan session: %w", err)
+		}
+		sessions = append(sessions, *session)
+	}
+
+	return sessions, rows.Err()
+}
+
+// RotateRefreshToken uses up a refresh token and stores newPlainToken as the
+// next one of its session, which it returns. A token that was used before
+// has been copied: the session is revoked and the error says so.
+func (p *PostgresDB) RotateRefreshToken(ctx context.Context, plainToken, newPlainToken string) (*models.Session, error) {
+	ctx, cancel := p.withTimeout(ctx, "RotateRefreshToken")
+	defer cancel()
+
+	tokenID := auth.RefreshTokenID(plainToken)
+	if tokenID == "" {
+		return nil, fmt.Errorf("invalid refresh token")
+	}
+
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query, args, err := p.builder.
+		Select("session_id", "token_digest", "used_at").
+		From("session_refresh_tokens").
+		Where(sq.Eq{"token_id": tokenID}).
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build select query: %w", err)
+	}
+
+	var sessionID uuid.UUID
+	var digest string
+	var usedAt *time.Time
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&sessionID, &digest, &usedAt)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("invalid refresh token")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get refresh token: %w", err)
+	}
+	if !auth.VerifyAPIKeyDigest(p.keyHasher.Digest(plainToken), digest) {
+		return nil, fmt.Errorf("invalid refresh token")
+	}
+
+	session, err := p.getSession(ctx, tx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	if !session.Active(now) {
+		return nil, fmt.Errorf("session has ended")
+	}
+
+	reused := usedAt != nil
+	if !reused {
+		// Guards against concurrent refreshes using the token twice
+		query, args, err = p.builder.
+			Update("session_refresh_tokens").
+			Set("used_at", now).
+			Where(sq.Eq{"token_id": tokenID, "used_at": nil}).
+			ToSql()
+		if err != nil {
+			return nil, fmt.Errorf("failed to build update query: %w", err)
+		}
+		result, err := tx.ExecContext(ctx, query, args...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to use refresh token: %w", err)
+		}
+		rowsAffected, _ := result.RowsAffected()
+		reused = rowsAffected == 0
+	}
+	if reused {
+		if _, err := p.revokeSessions(ctx, tx, sq.Eq{"id": sessionID}, now); err != nil {
+			return nil, err
+		}
+		if err := tx.Commit(); err != nil {
+			return nil, fmt.Errorf("failed to commit transaction: %w", err)
+		}
+		return nil, fmt.Errorf("refresh token already used, session revoked")
+	}
+
+	if err := p.insertRefreshToken(ctx, tx, sessionID, newPlainToken, now); err != nil {
+		return nil, err
+	}
+
+	query, args, err = p.builder.
+		Update("sessions").
+		Set("last_used_at", now).
+		Where(sq.Eq{"id": sessionID}).
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build update query: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		return nil, fmt.Errorf("failed to update session: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	session.LastUsedAt = now
+	return session, nil
+}
+
+// insertRefreshToken stores the digest of a new refresh token for a session
+func (p *PostgresDB) insertRefreshToken(ctx context.Context, tx *sql.Tx, sessionID uuid.UUID, plainToken string, now time.Time) error {
+	tokenID := auth.RefreshTokenID(plainToken)
+	if tokenID == "" {
+		return fmt.Errorf("invalid refresh token")
+	}
+
+	query, args, err := p.builder.
+		Insert("session_refresh_tokens").
+		Columns("token_id", "session_id", "token_digest", "created_at").
+		Values(tokenID, sessionID, p.keyHasher.Digest(plainToken), now).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build insert query: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("failed to store refresh token: %w", err)
+	}
+
+	return nil
+}
+
+// RevokeSession ends a session. Its access tokens stop working at once and
+// its refresh token can no longer be used.
+func (p *PostgresDB) RevokeSession(ctx context.Context, id uuid.UUID) error {
+	ctx, cancel := p.withTimeout(ctx, "RevokeSession")
+	defer cancel()
+
+	revoked, err := p.revokeSessions(ctx, p.db, sq.Eq{"id": id}, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	if revoked == 0 {
+		return fmt.Errorf("session not found")
+	}
+
+	return nil
+}
+
+// RevokeUserSessions ends all sessions of a user and returns how many were
+// active
+func (p *PostgresDB) RevokeUserSessions(ctx context.Context, username string) (int64, error) {
+	ctx, cancel := p.withTimeout(ctx, "RevokeUserSessions")
+	defer cancel()
+
+	return p.revokeSessions(ctx, p.db, sq.Eq{"username": username}, time.Now().UTC())
+}
+
+// revokeSessions ends the unrevoked sessions matching where
+func (p *PostgresDB) revokeSessions(ctx context.Context, e queryExecer, where sq.Eq, now time.Time) (int64, error) {
+	query, args, err := p.builder.
+		Update("sessions").
+		Set("revoked_at", now).
+		Where(where).
+		Where(sq.Eq{"revoked_at": nil}).
+		ToSql()
+	if err != nil {
+		return 0, fmt.Errorf("failed to build update query: %w", err)
+	}
+
+	result, err := e.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+
+	revoked, _ := result.RowsAffected()
+	return revoked, nil
+}
+
+// CleanupExpiredSessions deletes sessions that have expired, with their
+// refresh tokens
+func (p *PostgresDB) CleanupExpiredSessions(ctx context.Context) (int64, error) {
+	ctx, cancel := p.withTimeout(ctx, "CleanupExpiredSessions")
+	defer cancel()
+
+	query, args, err := p.builder.
+		Delete("sessions").
+		Where(sq.Lt{"expires_at": time.Now().UTC()}).
+		ToSql()
+	if err != nil {
+		return 0, fmt.Errorf("failed to build delete query: %w", err)
+	}
+
+	result, err := p.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to cleanup expired sessions: %w", err)
+	}
+
+	deleted, _ := result.RowsAffected()
+	return deleted, nil
+}
+
+// scanSession scans a row selected with sessionColumns
+func scanSession(row interface{ Scan(...interface{}) error }) (*models.Session, error) {
+	var session models.Session
+
+	err := row.Scan(
+		&session.ID,
+		&session.Username,
+		&session.Role,
+		&session.Source,
+		&session.UserAgent,
+		&session.ClientIP,
+		&session.CreatedAt,
+		&session.LastUsedAt,
+		&session.ExpiresAt,
+		&session.RevokedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &session, nil
+}
@@ -0,0 +1,285 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/google/uuid"
+)
+
+// SetUserTOTPSecret stores a new TOTP secret for a user who does not have
+// two-factor authentication enabled yet. It takes effect with EnableUserTOTP.
+func (p *PostgresDB) SetUserTOTPSecret(ctx context.Context, id uuid.UUID, secret string) error {
+	ctx, cancel := p.withTimeout(ctx, "SetUserTOTPSecret")
+	defer cancel()
+
+	sealed, err := p.keyHasher.SealTOTPSecret(secret)
+	if err != nil {
+		return err
+	}
+
+	query, args, err := p.builder.
+		Update("users").
+		Set("totp_secret", sealed).
+		Set("updated_at", time.Now().UTC()).
+		Where(sq.Eq{"id": id, "totp_enabled": false}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build update query: %w", err)
+	}
+
+	result, err := p.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to set TOTP secret: %w", err)
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return fmt.Errorf("user not found or two-factor authentication already enabled")
+	}
+
+	return nil
+}
+
+// GetUserTOTPSecret retrieves a user's TOTP secret, enabled or not
+func (p *PostgresDB) GetUserTOTPSecret(ctx context.Context, id uuid.UUID) (string, error) {
+	ctx, cancel := p.withTimeout(ctx, "GetUserTOTPSecret")
+	defer cancel()
+
+	query, args, err := p.builder.
+		Select("totp_secret").
+		From("users").
+		Where(sq.Eq{"id": id}).
+		ToSql()
+	if err != nil {
+		return "", fmt.Errorf("failed to build select query: %w", err)
+	}
+
+	var sealed sql.NullString
+	err = p.db.QueryRowContext(ctx, query, args...).Scan(&sealed)
+	if err == sql.ErrNoRows {
+		return "", fmt.Errorf("user not found")
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get TOTP secret: %w", err)
+	}
+	if !sealed.Valid {
+		return "", fmt.Errorf("TOTP secret not found")
+	}
+
+	return p.keyHasher.OpenTOTPSecret(sealed.String)
+}
+
+// EnableUserTOTP turns on two-factor authentication for a user once a code
+// from the secret was verified at step, and replaces the user's recovery
+// codes
+func (p *PostgresDB) EnableUserTOTP(ctx context.Context, id uuid.UUID, step int64, recoveryCodes []string) error {
+	ctx, cancel := p.withTimeout(ctx, "EnableUserTOTP")
+	defer cancel()
+
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query, args, err := p.builder.
+		Update("users").
+		Set("totp_enabled", true).
+		Set("totp_last_step", step).
+		Set("updated_at", time.Now().UTC()).
+		Where(sq.Eq{"id": id}).
+		Where("totp_secret IS NOT NULL").
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build update query: %w", err)
+	}
+
+	result, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to enable TOTP: %w", err)
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return fmt.Errorf("TOTP secret not found")
+	}
+
+	if err := p.replaceRecoveryCodes(ctx, tx, id, recoveryCodes); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DisableUserTOTP turns off two-factor authentication for a user and
+// removes their secret and recovery codes
+func (p *PostgresDB) DisableUserTOTP(ctx context.Context, id uuid.UUID) error {
+	ctx, cancel := p.withTimeout(ctx, "DisableUserTOTP")
+	defer cancel()
+
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query, args, err := p.builder.
+		Update("users").
+		Set("totp_secret", nil).
+		Set("totp_enabled", false).
+		Set("totp_last_step", 0).
+		Set("updated_at", time.Now().UTC()).
+		Where(sq.Eq{"id": id}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build update query: %w", err)
+	}
+
+	result, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to disable TOTP: %w", err)
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return fmt.Errorf("user not found")
+	}
+
+	if err := p.replaceRecoveryCodes(ctx, tx, id, nil); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UseUserTOTPStep records that a user's code from step was accepted. Codes
+// from that step or earlier are refused from then on, so each code works
+// once even within its validity window.
+func (p *PostgresDB) UseUserTOTPStep(ctx context.Context, id uuid.UUID, step int64) error {
+	ctx, cancel := p.withTimeout(ctx, "UseUserTOTPStep")
+	defer cancel()
+
+	query, args, err := p.builder.
+		Update("users").
+		Set("totp_last_step", step).
+		Where(sq.Eq{"id": id}).
+		Where(sq.Lt{"totp_last_step": step}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build update query: %w", err)
+	}
+
+	result, err := p.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to record TOTP code: %w", err)
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return fmt.Errorf("TOTP code already used")
+	}
+
+	return nil
+}
+
+// ReplaceRecoveryCodes replaces a user's recovery codes
+func (p *PostgresDB) ReplaceRecoveryCodes(ctx context.Context, userID uuid.UUID, recoveryCodes []string) error {
+	ctx, cancel := p.withTimeout(ctx, "ReplaceRecoveryCodes")
+	defer cancel()
+
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := p.replaceRecoveryCodes(ctx, tx, userID, recoveryCodes); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// replaceRecoveryCodes deletes a user's recovery codes and stores the
+// digests of recoveryCodes instead
+func (p *PostgresDB) replaceRecoveryCodes(ctx context.Context, tx *sql.Tx, userID uuid.UUID, recoveryCodes []string) error {
+	query, args, err := p.builder.
+		Delete("user_recovery_codes").
+		Where(sq.Eq{"user_id": userID}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build delete query: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+
+	if len(recoveryCodes) == 0 {
+		return nil
+	}
+
+	now := time.Now().UTC()
+	insert := p.builder.
+		Insert("user_recovery_codes").
+		Columns("id", "user_id", "code_digest", "created_at")
+	for _, code := range recoveryCodes {
+		insert = insert.Values(uuid.New(), userID, p.keyHasher.RecoveryCodeDigest(code), now)
+	}
+	query, args, err = insert.ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build insert query: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("failed to store recovery codes: %w", err)
+	}
+
+	return nil
+}
+
+// UseRecoveryCode marks one of a user's recovery codes as used. Each code
+// works once.
+func (p *PostgresDB) UseRecoveryCode(ctx context.Context, userID uuid.UUID, code string) error {
+	ctx, cancel := p.withTimeout(ctx, "UseRecoveryCode")
+	defer cancel()
+
+	query, args, err := p.builder.
+		Update("user_recovery_codes").
+		Set("used_at", time.Now().UTC()).
+		Where(sq.Eq{
+			"user_id":     userID,
+			"code_digest": p.keyHasher.RecoveryCodeDigest(code),
+			"used_at":     nil,
+		}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build update query: %w", err)
+	}
+
+	result, err := p.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to use recovery code: %w", err)
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return fmt.Errorf("recovery code not found")
+	}
+
+	return nil
+}
+
+// CountRecoveryCodes counts a user's unused recovery codes
+func (p *PostgresDB) CountRecoveryCodes(ctx context.Context, userID uuid.UUID) (int, error) {
+	ctx, cancel := p.withTimeout(ctx, "CountRecoveryCodes")
+	defer cancel()
+
+	query, args, err := p.builder.
+		Select("COUNT(*)").
+		From("user_recovery_codes").
+		Where(sq.Eq{"user_id": userID, "used_at": nil}).
+		ToSql()
+	if err != nil {
+		return 0, fmt.Errorf("failed to build count query: %w", err)
+	}
+
+	var count int
+	if err := p.db.QueryRowContext(ctx, query, args...).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count recovery codes: %w", err)
+	}
+
+	return count, nil
+}
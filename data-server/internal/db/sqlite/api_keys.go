@@ -1,64 +1,148 @@
 package sqlite
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"time"
 
 	"mark7888/speedtest-data-server/internal/auth"
+	"mark7888/speedtest-data-server/internal/logger"
 	"mark7888/speedtest-data-server/pkg/models"
 
 	sq "github.com/Masterminds/squirrel"
 	"github.com/google/uuid"
+	"go.uber.org/zap"
 )
 
+// signedKeyCachePrefix sets apart keys cached by key ID for signed requests
+// from keys cached by digest
+const signedKeyCachePrefix = "key_id:"
+
+// apiKeyColumns are the columns scanned by scanAPIKey
+var apiKeyColumns = []string{"id", "name", "key_id", "key_hash", "enabled", "created_at", "created_by", "last_used", "revoked_at", "node_id", "bound_at", "scopes", "expires_at", "replaced_by", "signing_key"}
+
 // CreateAPIKey creates a new API key
-func (s *SQLiteDB) CreateAPIKey(name, plainKey, createdBy string) (*models.APIKey, error) {
-	ctx, cancel := withTimeout()
+func (s *SQLiteDB) CreateAPIKey(ctx context.Context, plainKey string, key models.NewAPIKey) (*models.APIKey, error) {
+	ctx, cancel := s.withTimeout(ctx, "CreateAPIKey")
 	defer cancel()
 
-	// Hash the key
-	keyHash, err := auth.HashAPIKey(plainKey)
+	apiKey, query, args, err := s.insertAPIKey(plainKey, key)
 	if err != nil {
-		return nil, fmt.Errorf("failed to hash API key: %w", err)
+		return nil, err
 	}
 
-	apiKey := &models.APIKey{
-		ID:        uuid.New(),
-		Name:      name,
-		KeyHash:   keyHash,
-		Enabled:   true,
-		CreatedAt: time.Now().UTC(),
+	_, err = s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create API key: %w", err)
 	}
 
-	if createdBy != "" {
-		apiKey.CreatedBy = &createdBy
+	return apiKey, nil
+}
+
+// RotateAPIKey creates the successor of an API key and lets the old key
+// expire at oldExpiresAt. A key can only be replaced once.
+func (s *SQLiteDB) RotateAPIKey(ctx context.Context, oldID uuid.UUID, oldExpiresAt time.Time, plainKey string, key models.NewAPIKey) (*models.APIKey, error) {
+	ctx, cancel := s.withTimeout(ctx, "RotateAPIKey")
+	defer cancel()
+
+	apiKey, query, args, err := s.insertAPIKey(plainKey, key)
+	if err != nil {
+		return nil, err
 	}
 
-	query, args, err := s.builder.
-		Insert("api_keys").
-		Columns("id", "name", "key_hash", "enabled", "created_at", "created_by").
-		Values(apiKey.ID.String(), apiKey.Name, apiKey.KeyHash, 1, apiKey.CreatedAt, apiKey.CreatedBy).
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		return nil, fmt.Errorf("failed to create API key: %w", err)
+	}
+
+	query, args, err = s.builder.
+		Update("api_keys").
+		Set("expires_at", oldExpiresAt.UTC()).
+		Set("replaced_by", apiKey.ID.String()).
+		Where(sq.Eq{"id": oldID.String()}).
+		Where("replaced_by IS NULL").
 		ToSql()
 	if err != nil {
-		return nil, fmt.Errorf("failed to build insert query: %w", err)
+		return nil, fmt.Errorf("failed to build update query: %w", err)
 	}
 
-	_, err = s.db.ExecContext(ctx, query, args...)
+	result, err := tx.ExecContext(ctx, query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create API key: %w", err)
+		return nil, fmt.Errorf("failed to update replaced API key: %w", err)
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return nil, fmt.Errorf("API key not found or already replaced")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
 	}
+	s.keyCache.Invalidate(oldID)
 
 	return apiKey, nil
 }
 
+// insertAPIKey builds a new API key and the query inserting it
+func (s *SQLiteDB) insertAPIKey(plainKey string, key models.NewAPIKey) (*models.APIKey, string, []interface{}, error) {
+	keyID, legacy := s.keyHasher.KeyID(plainKey)
+	if keyID == "" || legacy {
+		return nil, "", nil, fmt.Errorf("API key has no key ID")
+	}
+
+	signingKey, err := s.keyHasher.SealSigningKey(plainKey)
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("failed to seal signing key: %w", err)
+	}
+
+	now := time.Now().UTC()
+	apiKey := &models.APIKey{
+		ID:         uuid.New(),
+		Name:       key.Name,
+		KeyID:      &keyID,
+		KeyHash:    s.keyHasher.Digest(plainKey),
+		Enabled:    true,
+		CreatedAt:  now,
+		NodeID:     key.NodeID,
+		Scopes:     key.Scopes,
+		ExpiresAt:  key.ExpiresAt,
+		SigningKey: &signingKey,
+	}
+	if len(apiKey.Scopes) == 0 {
+		apiKey.Scopes = models.DefaultAPIKeyScopes
+	}
+	if key.NodeID != nil {
+		apiKey.BoundAt = &now
+	}
+	if key.CreatedBy != "" {
+		apiKey.CreatedBy = &key.CreatedBy
+	}
+
+	query, args, err := s.builder.
+		Insert("api_keys").
+		Columns("id", "name", "key_id", "key_hash", "enabled", "created_at", "created_by", "node_id", "bound_at", "scopes", "expires_at", "signing_key").
+		Values(apiKey.ID.String(), apiKey.Name, apiKey.KeyID, apiKey.KeyHash, 1, apiKey.CreatedAt, apiKey.CreatedBy,
+			nodeIDValue(apiKey.NodeID), apiKey.BoundAt, models.FormatAPIKeyScopes(apiKey.Scopes), apiKey.ExpiresAt, apiKey.SigningKey).
+		ToSql()
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("failed to build insert query: %w", err)
+	}
+
+	return apiKey, query, args, nil
+}
+
 // GetAPIKeyByID retrieves an API key by ID
-func (s *SQLiteDB) GetAPIKeyByID(id uuid.UUID) (*models.APIKey, error) {
-	ctx, cancel := withTimeout()
+func (s *SQLiteDB) GetAPIKeyByID(ctx context.Context, id uuid.UUID) (*models.APIKey, error) {
+	ctx, cancel := s.withTimeout(ctx, "GetAPIKeyByID")
 	defer cancel()
 
 	query, args, err := s.builder.
-		Select("id", "name", "key_hash", "enabled", "created_at", "created_by", "last_used", "revoked_at").
+		Select(apiKeyColumns...).
 		From("api_keys").
 		Where(sq.Eq{"id": id.String()}).
 		ToSql()
@@ -66,21 +150,7 @@ func (s *SQLiteDB) GetAPIKeyByID(id uuid.UUID) (*models.APIKey, error) {
 		return nil, fmt.Errorf("failed to build select query: %w", err)
 	}
 
-	var apiKey models.APIKey
-	var idStr string
-	var enabled int
-
-	err = s.db.QueryRowContext(ctx, query, args...).Scan(
-		&idStr,
-		&apiKey.Name,
-		&apiKey.KeyHash,
-		&enabled,
-		&apiKey.CreatedAt,
-		&apiKey.CreatedBy,
-		&apiKey.LastUsed,
-		&apiKey.RevokedAt,
-	)
-
+	apiKey, err := scanAPIKey(s.db.QueryRowContext(ctx, query, args...))
 	if err == sql.ErrNoRows {
 		return nil, fmt.Errorf("API key not found")
 	}
@@ -88,19 +158,16 @@ func (s *SQLiteDB) GetAPIKeyByID(id uuid.UUID) (*models.APIKey, error) {
 		return nil, fmt.Errorf("failed to get API key: %w", err)
 	}
 
-	apiKey.ID, _ = uuid.Parse(idStr)
-	apiKey.Enabled = enabled == 1
-
-	return &apiKey, nil
+	return apiKey, nil
 }
 
 // GetAllAPIKeys retrieves all API keys
-func (s *SQLiteDB) GetAllAPIKeys() ([]models.APIKey, error) {
-	ctx, cancel := withTimeout()
+func (s *SQLiteDB) GetAllAPIKeys(ctx context.Context) ([]models.APIKey, error) {
+	ctx, cancel := s.withTimeout(ctx, "GetAllAPIKeys")
 	defer cancel()
 
 	query, args, err := s.builder.
-		Select("id", "name", "key_hash", "enabled", "created_at", "created_by", "last_used", "revoked_at").
+		Select(apiKeyColumns...).
 		From("api_keys").
 		OrderBy("created_at DESC").
 		ToSql()
@@ -108,47 +175,16 @@ func (s *SQLiteDB) GetAllAPIKeys() ([]models.APIKey, error) {
 		return nil, fmt.Errorf("failed to build select query: %w", err)
 	}
 
-	rows, err := s.db.QueryContext(ctx, query, args...)
-	if err != nil {
-		return nil, fmt.Errorf("failed to query API keys: %w", err)
-	}
-	defer rows.Close()
-
-	var apiKeys []models.APIKey
-	for rows.Next() {
-		var apiKey models.APIKey
-		var idStr string
-		var enabled int
-
-		err := rows.Scan(
-			&idStr,
-			&apiKey.Name,
-			&apiKey.KeyHash,
-			&enabled,
-			&apiKey.CreatedAt,
-			&apiKey.CreatedBy,
-			&apiKey.LastUsed,
-			&apiKey.RevokedAt,
-		)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan API key: %w", err)
-		}
-
-		apiKey.ID, _ = uuid.Parse(idStr)
-		apiKey.Enabled = enabled == 1
-		apiKeys = append(apiKeys, apiKey)
-	}
-
-	return apiKeys, nil
+	return s.queryAPIKeys(ctx, query, args...)
 }
 
 // GetEnabledAPIKeys retrieves all enabled API keys
-func (s *SQLiteDB) GetEnabledAPIKeys() ([]models.APIKey, error) {
-	ctx, cancel := withTimeout()
+func (s *SQLiteDB) GetEnabledAPIKeys(ctx context.Context) ([]models.APIKey, error) {
+	ctx, cancel := s.withTimeout(ctx, "GetEnabledAPIKeys")
 	defer cancel()
 
 	query, args, err := s.builder.
-		Select("id", "name", "key_hash", "enabled", "created_at", "created_by", "last_used", "revoked_at").
+		Select(apiKeyColumns...).
 		From("api_keys").
 		Where(sq.Eq{"enabled": 1}).
 		Where("revoked_at IS NULL").
@@ -158,43 +194,32 @@ func (s *SQLiteDB) GetEnabledAPIKeys() ([]models.APIKey, error) {
 		return nil, fmt.Errorf("failed to build select query: %w", err)
 	}
 
+	return s.queryAPIKeys(ctx, query, args...)
+}
+
+// queryAPIKeys runs a query selecting apiKeyColumns
+func (s *SQLiteDB) queryAPIKeys(ctx context.Context, query string, args ...interface{}) ([]models.APIKey, error) {
 	rows, err := s.db.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query enabled API keys: %w", err)
+		return nil, fmt.Errorf("failed to query API keys: %w", err)
 	}
 	defer rows.Close()
 
 	var apiKeys []models.APIKey
 	for rows.Next() {
-		var apiKey models.APIKey
-		var idStr string
-		var enabled int
-
-		err := rows.Scan(
-			&idStr,
-			&apiKey.Name,
-			&apiKey.KeyHash,
-			&enabled,
-			&apiKey.CreatedAt,
-			&apiKey.CreatedBy,
-			&apiKey.LastUsed,
-			&apiKey.RevokedAt,
-		)
+		apiKey, err := scanAPIKey(rows)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan API key: %w", err)
 		}
-
-		apiKey.ID, _ = uuid.Parse(idStr)
-		apiKey.Enabled = enabled == 1
-		apiKeys = append(apiKeys, apiKey)
+		apiKeys = append(apiKeys, *apiKey)
 	}
 
-	return apiKeys, nil
+	return apiKeys, rows.Err()
 }
 
 // UpdateAPIKeyEnabled updates the enabled status of an API key
-func (s *SQLiteDB) UpdateAPIKeyEnabled(id uuid.UUID, enabled bool) error {
-	ctx, cancel := withTimeout()
+func (s *SQLiteDB) UpdateAPIKeyEnabled(ctx context.Context, id uuid.UUID, enabled bool) error {
+	ctx, cancel := s.withTimeout(ctx, "UpdateAPIKeyEnabled")
 	defer cancel()
 
 	enabledInt := 0
@@ -215,6 +240,45 @@ func (s *SQLiteDB) UpdateAPIKeyEnabled(id uuid.UUID, enabled bool) error {
 	if err != nil {
 		return fmt.Errorf("failed to update API key: %w", err)
 	}
+	s.keyCache.Invalidate(id)
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return fmt.Errorf("API key not found")
+	}
+
+	return nil
+}
+
+// UpdateAPIKeyScopes replaces the scopes of an API key
+func (s *SQLiteDB) UpdateAPIKeyScopes(ctx context.Context, id uuid.UUID, scopes []string) error {
+	return s.updateAPIKey(ctx, "UpdateAPIKeyScopes", id, "scopes", models.FormatAPIKeyScopes(scopes))
+}
+
+// UpdateAPIKeyExpiry sets when an API key expires; nil means never
+func (s *SQLiteDB) UpdateAPIKeyExpiry(ctx context.Context, id uuid.UUID, expiresAt *time.Time) error {
+	return s.updateAPIKey(ctx, "UpdateAPIKeyExpiry", id, "expires_at", expiresAt)
+}
+
+// updateAPIKey sets a single column of an API key
+func (s *SQLiteDB) updateAPIKey(ctx context.Context, op string, id uuid.UUID, column string, value interface{}) error {
+	ctx, cancel := s.withTimeout(ctx, op)
+	defer cancel()
+
+	query, args, err := s.builder.
+		Update("api_keys").
+		Set(column, value).
+		Where(sq.Eq{"id": id.String()}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build update query: %w", err)
+	}
+
+	result, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to update API key: %w", err)
+	}
+	s.keyCache.Invalidate(id)
 
 	rowsAffected, _ := result.RowsAffected()
 	if rowsAffected == 0 {
@@ -225,8 +289,8 @@ func (s *SQLiteDB) UpdateAPIKeyEnabled(id uuid.UUID, enabled bool) error {
 }
 
 // DeleteAPIKey deletes an API key
-func (s *SQLiteDB) DeleteAPIKey(id uuid.UUID) error {
-	ctx, cancel := withTimeout()
+func (s *SQLiteDB) DeleteAPIKey(ctx context.Context, id uuid.UUID) error {
+	ctx, cancel := s.withTimeout(ctx, "DeleteAPIKey")
 	defer cancel()
 
 	query, args, err := s.builder.
@@ -241,6 +305,7 @@ func (s *SQLiteDB) DeleteAPIKey(id uuid.UUID) error {
 	if err != nil {
 		return fmt.Errorf("failed to delete API key: %w", err)
 	}
+	s.keyCache.Invalidate(id)
 
 	rowsAffected, _ := result.RowsAffected()
 	if rowsAffected == 0 {
@@ -251,8 +316,8 @@ func (s *SQLiteDB) DeleteAPIKey(id uuid.UUID) error {
 }
 
 // UpdateAPIKeyLastUsed updates the last_used timestamp of an API key
-func (s *SQLiteDB) UpdateAPIKeyLastUsed(id uuid.UUID) error {
-	ctx, cancel := withTimeout()
+func (s *SQLiteDB) UpdateAPIKeyLastUsed(ctx context.Context, id uuid.UUID) error {
+	ctx, cancel := s.withTimeout(ctx, "UpdateAPIKeyLastUsed")
 	defer cancel()
 
 	query, args, err := s.builder.
@@ -272,22 +337,340 @@ func (s *SQLiteDB) UpdateAPIKeyLastUsed(id uuid.UUID) error {
 	return nil
 }
 
-// VerifyAPIKey verifies an API key and returns the key details if valid
-func (s *SQLiteDB) VerifyAPIKey(plainKey string) (*models.APIKey, error) {
-	// Get all enabled keys
-	apiKeys, err := s.GetEnabledAPIKeys()
+// VerifyAPIKey verifies an API key and returns the key details if valid.
+// The key is looked up by its key ID and its digest compared in constant
+// time. Verified keys are cached briefly, so last_used is only updated once
+// per cache period.
+func (s *SQLiteDB) VerifyAPIKey(ctx context.Context, plainKey string) (*models.APIKey, error) {
+	digest := s.keyHasher.Digest(plainKey)
+	if apiKey, ok := s.keyCache.Get(digest); ok {
+		// Cached keys may have expired since
+		if err := auth.CheckAPIKeyUsable(apiKey, time.Now()); err != nil {
+			return nil, err
+		}
+		return apiKey, nil
+	}
+
+	keyID, legacy := s.keyHasher.KeyID(plainKey)
+	if keyID == "" {
+		return nil, fmt.Errorf("invalid API key")
+	}
+
+	apiKey, err := s.getAPIKeyByKeyID(ctx, keyID)
 	if err != nil {
 		return nil, err
 	}
+	if apiKey == nil && legacy {
+		if apiKey, err = s.upgradeLegacyAPIKey(ctx, plainKey, keyID, digest); err != nil {
+			return nil, err
+		}
+	}
+	if apiKey == nil || !auth.VerifyAPIKeyDigest(digest, apiKey.KeyHash) {
+		return nil, fmt.Errorf("invalid API key")
+	}
+	if err := auth.CheckAPIKeyUsable(apiKey, time.Now()); err != nil {
+		return nil, err
+	}
+	// Keys from before request signing get their signing key now; keys
+	// without a real key ID cannot sign, as nodes do not know their ID
+	if apiKey.SigningKey == nil && !legacy {
+		if err := s.storeSigningKey(ctx, apiKey, plainKey); err != nil {
+			logger.FromContext(ctx).Warn("Failed to store API key signing key",
+				zap.String("id", apiKey.ID.String()),
+				zap.Error(err),
+			)
+		}
+	}
 
-	// Check each key
-	for _, apiKey := range apiKeys {
-		if auth.VerifyAPIKey(plainKey, apiKey.KeyHash) {
-			// Update last used timestamp
-			_ = s.UpdateAPIKeyLastUsed(apiKey.ID)
-			return &apiKey, nil
+	_ = s.UpdateAPIKeyLastUsed(ctx, apiKey.ID)
+	s.keyCache.Put(digest, apiKey)
+	return apiKey, nil
+}
+
+// VerifySignedRequest finds the API key with keyID and checks that
+// signature is what expected computes with the key's signing key. Verified
+// keys are cached by key ID like VerifyAPIKey caches them by digest.
+func (s *SQLiteDB) VerifySignedRequest(ctx context.Context, keyID, signature string, expected func(signingKey []byte) string) (*models.APIKey, error) {
+	cacheKey := signedKeyCachePrefix + keyID
+	apiKey, cached := s.keyCache.Get(cacheKey)
+	if !cached {
+		var err error
+		if apiKey, err = s.getAPIKeyByKeyID(ctx, keyID); err != nil {
+			return nil, err
+		}
+		if apiKey == nil {
+			return nil, fmt.Errorf("invalid API key")
 		}
 	}
+	if err := auth.CheckAPIKeyUsable(apiKey, time.Now()); err != nil {
+		return nil, err
+	}
+	if apiKey.SigningKey == nil {
+		return nil, fmt.Errorf("API key has no signing key")
+	}
+
+	signingKey, err := s.keyHasher.OpenSigningKey(*apiKey.SigningKey)
+	if err != nil {
+		return nil, err
+	}
+	if !auth.VerifyRequestSignature(signature, expected(signingKey)) {
+		return nil, fmt.Errorf("invalid request signature")
+	}
+
+	if !cached {
+		_ = s.UpdateAPIKeyLastUsed(ctx, apiKey.ID)
+		s.keyCache.Put(cacheKey, apiKey)
+	}
+	return apiKey, nil
+}
 
-	return nil, fmt.Errorf("invalid API key")
+// storeSigningKey stores the signing key of a key created before request
+// signing
+func (s *SQLiteDB) storeSigningKey(ctx context.Context, apiKey *models.APIKey, plainKey string) error {
+	ctx, cancel := s.withTimeout(ctx, "StoreSigningKey")
+	defer cancel()
+
+	signingKey, err := s.keyHasher.SealSigningKey(plainKey)
+	if err != nil {
+		return fmt.Errorf("failed to seal signing key: %w", err)
+	}
+
+	query, args, err := s.builder.
+		Update("api_keys").
+		Set("signing_key", signingKey).
+		Where(sq.Eq{"id": apiKey.ID.String()}).
+		Where("signing_key IS NULL").
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build update query: %w", err)
+	}
+
+	if _, err := s.db.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("failed to store signing key: %w", err)
+	}
+
+	apiKey.SigningKey = &signingKey
+	return nil
+}
+
+// getAPIKeyByKeyID returns the key with the given key ID, nil if there is none
+func (s *SQLiteDB) getAPIKeyByKeyID(ctx context.Context, keyID string) (*models.APIKey, error) {
+	ctx, cancel := s.withTimeout(ctx, "GetAPIKeyByKeyID")
+	defer cancel()
+
+	query, args, err := s.builder.
+		Select(apiKeyColumns...).
+		From("api_keys").
+		Where(sq.Eq{"key_id": keyID}).
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build select query: %w", err)
+	}
+
+	apiKey, err := scanAPIKey(s.db.QueryRowContext(ctx, query, args...))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get API key: %w", err)
+	}
+	return apiKey, nil
+}
+
+// upgradeLegacyAPIKey checks a key issued before key IDs against the bcrypt
+// hashes of keys not upgraded yet. On a match it stores the key's derived
+// key ID and digest, so later requests take the indexed path. It returns nil
+// if no key matches. Only keys that could still authenticate are compared,
+// as every comparison costs a bcrypt run that anyone can trigger.
+func (s *SQLiteDB) upgradeLegacyAPIKey(ctx context.Context, plainKey, keyID, digest string) (*models.APIKey, error) {
+	ctx, cancel := s.withTimeout(ctx, "UpgradeLegacyAPIKey")
+	defer cancel()
+
+	query, args, err := s.builder.
+		Select(apiKeyColumns...).
+		From("api_keys").
+		Where("key_id IS NULL").
+		Where(sq.Eq{"enabled": 1}).
+		Where("revoked_at IS NULL").
+		Where(sq.Or{sq.Eq{"expires_at": nil}, sq.Gt{"expires_at": time.Now().UTC()}}).
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build select query: %w", err)
+	}
+
+	legacyKeys, err := s.queryAPIKeys(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, apiKey := range legacyKeys {
+		if !auth.VerifyLegacyAPIKey(plainKey, apiKey.KeyHash) {
+			continue
+		}
+
+		query, args, err := s.builder.
+			Update("api_keys").
+			Set("key_id", keyID).
+			Set("key_hash", digest).
+			Where(sq.Eq{"id": apiKey.ID.String()}).
+			ToSql()
+		if err != nil {
+			return nil, fmt.Errorf("failed to build update query: %w", err)
+		}
+		if _, err := s.db.ExecContext(ctx, query, args...); err != nil {
+			return nil, fmt.Errorf("failed to upgrade API key: %w", err)
+		}
+
+		logger.FromContext(ctx).Info("Upgraded API key to indexed lookup",
+			zap.String("id", apiKey.ID.String()),
+			zap.String("key_id", keyID),
+		)
+		apiKey.KeyID = &keyID
+		apiKey.KeyHash = digest
+		return &apiKey, nil
+	}
+
+	return nil, nil
+}
+
+// BindAPIKeyNode binds an unbound API key to nodeID and returns the node the
+// key is bound to afterwards. A key that is already bound keeps its node, so
+// of two nodes racing to use a new key only the first one wins.
+func (s *SQLiteDB) BindAPIKeyNode(ctx context.Context, id, nodeID uuid.UUID) (uuid.UUID, error) {
+	ctx, cancel := s.withTimeout(ctx, "BindAPIKeyNode")
+	defer cancel()
+
+	query, args, err := s.builder.
+		Update("api_keys").
+		Set("node_id", nodeID.String()).
+		Set("bound_at", time.Now().UTC()).
+		Where(sq.Eq{"id": id.String()}).
+		Where("node_id IS NULL").
+		ToSql()
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to build update query: %w", err)
+	}
+
+	result, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to bind API key: %w", err)
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected > 0 {
+		s.keyCache.Invalidate(id)
+		return nodeID, nil
+	}
+
+	query, args, err = s.builder.
+		Select("node_id").
+		From("api_keys").
+		Where(sq.Eq{"id": id.String()}).
+		ToSql()
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to build select query: %w", err)
+	}
+
+	var bound string
+	err = s.db.QueryRowContext(ctx, query, args...).Scan(&bound)
+	if err == sql.ErrNoRows {
+		return uuid.Nil, fmt.Errorf("API key not found")
+	}
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to get API key binding: %w", err)
+	}
+
+	return uuid.Parse(bound)
+}
+
+// SetAPIKeyNode binds an API key to nodeID, replacing any binding, or unbinds
+// it when nodeID is nil so that it is bound to the next node using it
+func (s *SQLiteDB) SetAPIKeyNode(ctx context.Context, id uuid.UUID, nodeID *uuid.UUID) error {
+	ctx, cancel := s.withTimeout(ctx, "SetAPIKeyNode")
+	defer cancel()
+
+	var boundAt *time.Time
+	if nodeID != nil {
+		now := time.Now().UTC()
+		boundAt = &now
+	}
+
+	query, args, err := s.builder.
+		Update("api_keys").
+		Set("node_id", nodeIDValue(nodeID)).
+		Set("bound_at", boundAt).
+		Where(sq.Eq{"id": id.String()}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build update query: %w", err)
+	}
+
+	result, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to update API key binding: %w", err)
+	}
+	s.keyCache.Invalidate(id)
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return fmt.Errorf("API key not found")
+	}
+
+	return nil
+}
+
+// scanAPIKey scans a row selected with apiKeyColumns
+func scanAPIKey(row interface{ Scan(...interface{}) error }) (*models.APIKey, error) {
+	var apiKey models.APIKey
+	var idStr string
+	var enabled int
+	var nodeIDStr, replacedByStr *string
+	var scopes string
+
+	err := row.Scan(
+		&idStr,
+		&apiKey.Name,
+		&apiKey.KeyID,
+		&apiKey.KeyHash,
+		&enabled,
+		&apiKey.CreatedAt,
+		&apiKey.CreatedBy,
+		&apiKey.LastUsed,
+		&apiKey.RevokedAt,
+		&nodeIDStr,
+		&apiKey.BoundAt,
+		&scopes,
+		&apiKey.ExpiresAt,
+		&replacedByStr,
+		&apiKey.SigningKey,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	apiKey.ID, _ = uuid.Parse(idStr)
+	apiKey.Enabled = enabled == 1
+	apiKey.NodeID = parseNullUUID(nodeIDStr)
+	apiKey.Scopes = models.ParseAPIKeyScopes(scopes)
+	apiKey.ReplacedBy = parseNullUUID(replacedByStr)
+
+	return &apiKey, nil
+}
+
+// nodeIDValue converts an optional UUID for storage
+func nodeIDValue(id *uuid.UUID) interface{} {
+	if id == nil {
+		return nil
+	}
+	return id.String()
+}
+
+// parseNullUUID parses an optional UUID column, nil if NULL or invalid
+func parseNullUUID(value *string) *uuid.UUID {
+	if value == nil {
+		return nil
+	}
+	id, err := uuid.Parse(*value)
+	if err != nil {
+		return nil
+	}
+	return &id
 }
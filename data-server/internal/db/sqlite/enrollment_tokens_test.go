@@ -0,0 +1,127 @@
+package sqlite
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"mark7888/speedtest-data-server/internal/auth"
+	"mark7888/speedtest-data-server/pkg/models"
+
+	"github.com/google/uuid"
+)
+
+func TestEnrollNode(t *testing.T) {
+	ctx := context.Background()
+	database := newTestDB(t)
+
+	plainToken, err := auth.GenerateEnrollmentToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := database.CreateEnrollmentToken(ctx, plainToken, models.NewEnrollmentToken{
+		Name:      "site rollout",
+		CreatedBy: "admin",
+		Scopes:    []string{models.APIKeyScopeIngest},
+		MaxUses:   2,
+		ExpiresAt: time.Now().Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrongSecret := plainToken[:strings.Index(plainToken, ".")+1] + "wrong"
+
+	first, second, third := uuid.New(), uuid.New(), uuid.New()
+	tests := []struct {
+		name    string
+		token   string
+		nodeID  uuid.UUID
+		wantErr string
+	}{
+		{name: "wrong secret", token: wrongSecret, nodeID: first, wantErr: "invalid enrollment token"},
+		{name: "unknown token", token: "et_0123456789abcdef.secret", nodeID: first, wantErr: "invalid enrollment token"},
+		{name: "API key", token: "sk_live_" + plainToken[3:], nodeID: first, wantErr: "invalid enrollment token"},
+		{name: "first use", token: plainToken, nodeID: first},
+		{name: "second use", token: plainToken, nodeID: second},
+		{name: "used up", token: plainToken, nodeID: third, wantErr: "enrollment token has been used up"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plainKey, err := auth.GenerateAPIKey()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			apiKey, err := database.EnrollNode(ctx, tt.token, plainKey, tt.nodeID, "node")
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				if _, err := database.VerifyAPIKey(ctx, plainKey); err == nil {
+					t.Error("key from a refused enrollment was stored")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			verified, err := database.VerifyAPIKey(ctx, plainKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if verified.ID != apiKey.ID || verified.NodeID == nil || *verified.NodeID != tt.nodeID {
+				t.Errorf("issued key = %+v, want bound to %s", verified, tt.nodeID)
+			}
+			if !reflect.DeepEqual(verified.Scopes, token.Scopes) {
+				t.Errorf("scopes = %v, want the token's %v", verified.Scopes, token.Scopes)
+			}
+			if verified.CreatedBy == nil || *verified.CreatedBy != models.EnrolledBy(token) {
+				t.Errorf("created_by = %v, want %q", verified.CreatedBy, models.EnrolledBy(token))
+			}
+		})
+	}
+
+	tokens, err := database.GetAllEnrollmentTokens(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tokens) != 1 || tokens[0].Uses != 2 {
+		t.Errorf("tokens = %+v, want one used twice", tokens)
+	}
+
+	if err := database.DeleteEnrollmentToken(ctx, token.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.DeleteEnrollmentToken(ctx, token.ID); err == nil {
+		t.Error("deleting a missing token succeeded")
+	}
+}
+
+func TestEnrollNodeExpired(t *testing.T) {
+	ctx := context.Background()
+	database := newTestDB(t)
+
+	plainToken, err := auth.GenerateEnrollmentToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := database.CreateEnrollmentToken(ctx, plainToken, models.NewEnrollmentToken{
+		Name:      "expired",
+		MaxUses:   1,
+		ExpiresAt: time.Now().Add(-time.Second),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	plainKey, err := auth.GenerateAPIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := database.EnrollNode(ctx, plainToken, plainKey, uuid.New(), "node"); err == nil || err.Error() != "enrollment token has expired" {
+		t.Errorf("err = %v, want expired", err)
+	}
+}
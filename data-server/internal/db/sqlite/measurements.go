@@ -1,12 +1,13 @@
 package sqlite
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"mark7888/speedtest-data-server/internal/logger"
 	"strings"
 	"time"
 
-	"mark7888/speedtest-data-server/internal/logger"
 	"mark7888/speedtest-data-server/pkg/models"
 
 	sq "github.com/Masterminds/squirrel"
@@ -15,8 +16,8 @@ import (
 )
 
 // InsertMeasurement inserts or updates a measurement
-func (s *SQLiteDB) InsertMeasurement(m *models.Measurement) error {
-	ctx, cancel := withTimeout()
+func (s *SQLiteDB) InsertMeasurement(ctx context.Context, m *models.Measurement) error {
+	ctx, cancel := s.withTimeout(ctx, "InsertMeasurement")
 	defer cancel()
 
 	// Convert boolean to integer for SQLite
@@ -36,7 +37,8 @@ func (s *SQLiteDB) InsertMeasurement(m *models.Measurement) error {
 			packet_loss, isp,
 			interface_internal_ip, interface_name, interface_mac, interface_is_vpn, interface_external_ip,
 			server_id, server_host, server_port, server_name, server_location, server_country, server_ip,
-			result_id, result_url
+			result_id, result_url,
+			clock_skew_ms, original_timestamp
 		) VALUES (
 			?, ?, CURRENT_TIMESTAMP,
 			?, ?, ?, ?,
@@ -47,6 +49,7 @@ func (s *SQLiteDB) InsertMeasurement(m *models.Measurement) error {
 			?, ?,
 			?, ?, ?, ?, ?,
 			?, ?, ?, ?, ?, ?, ?,
+			?, ?,
 			?, ?
 		)
 		ON CONFLICT (node_id, timestamp) DO UPDATE SET
@@ -83,7 +86,9 @@ func (s *SQLiteDB) InsertMeasurement(m *models.Measurement) error {
 			server_country = excluded.server_country,
 			server_ip = excluded.server_ip,
 			result_id = excluded.result_id,
-			result_url = excluded.result_url
+			result_url = excluded.result_url,
+			clock_skew_ms = excluded.clock_skew_ms,
+			original_timestamp = excluded.original_timestamp
 	`
 
 	_, err := s.db.ExecContext(ctx, query,
@@ -97,6 +102,7 @@ func (s *SQLiteDB) InsertMeasurement(m *models.Measurement) error {
 		m.InterfaceInternalIP, m.InterfaceName, m.InterfaceMacAddr, isVPN, m.InterfaceExternalIP,
 		m.ServerID, m.ServerHost, m.ServerPort, m.ServerName, m.ServerLocation, m.ServerCountry, m.ServerIP,
 		m.ResultID, m.ResultURL,
+		m.ClockSkewMs, m.OriginalTimestamp,
 	)
 
 	if err != nil {
@@ -107,14 +113,14 @@ func (s *SQLiteDB) InsertMeasurement(m *models.Measurement) error {
 }
 
 // InsertFailedMeasurement inserts a failed measurement record
-func (s *SQLiteDB) InsertFailedMeasurement(nodeID uuid.UUID, timestamp time.Time, errorMessage string, retryCount int) error {
-	ctx, cancel := withTimeout()
+func (s *SQLiteDB) InsertFailedMeasurement(ctx context.Context, f *models.FailedMeasurement) error {
+	ctx, cancel := s.withTimeout(ctx, "InsertFailedMeasurement")
 	defer cancel()
 
 	query, args, err := s.builder.
 		Insert("failed_measurements").
-		Columns("node_id", "timestamp", "error_message", "retry_count", "created_at").
-		Values(nodeID.String(), timestamp, errorMessage, retryCount, time.Now().UTC()).
+		Columns("node_id", "timestamp", "error_message", "retry_count", "created_at", "clock_skew_ms", "original_timestamp").
+		Values(f.NodeID.String(), f.Timestamp, f.ErrorMessage, f.RetryCount, time.Now().UTC(), f.ClockSkewMs, f.OriginalTimestamp).
 		ToSql()
 	if err != nil {
 		return fmt.Errorf("failed to build insert query: %w", err)
@@ -129,8 +135,8 @@ func (s *SQLiteDB) InsertFailedMeasurement(nodeID uuid.UUID, timestamp time.Time
 }
 
 // GetMeasurementsByNode retrieves measurements for a specific node
-func (s *SQLiteDB) GetMeasurementsByNode(nodeID uuid.UUID, from, to *time.Time, page, limit int, status string) ([]models.Measurement, int, error) {
-	ctx, cancel := withTimeout()
+func (s *SQLiteDB) GetMeasurementsByNode(ctx context.Context, nodeID uuid.UUID, from, to *time.Time, page, limit int, status string) ([]models.Measurement, int, error) {
+	ctx, cancel := s.withTimeout(ctx, "GetMeasurementsByNode")
 	defer cancel()
 
 	// Default to "all" if status is empty
@@ -192,7 +198,7 @@ func (s *SQLiteDB) GetMeasurementsByNode(nodeID uuid.UUID, from, to *time.Time,
 	var rows *sql.Rows
 	if status == "failed" {
 		selectQuery, selectArgs, _ := s.builder.
-			Select("id", "node_id", "timestamp", "created_at", "error_message").
+			Select("id", "node_id", "timestamp", "created_at", "error_message", "clock_skew_ms", "original_timestamp").
 			From("failed_measurements").
 			Where(whereConditions).
 			OrderBy("timestamp DESC").
@@ -225,6 +231,7 @@ func (s *SQLiteDB) GetMeasurementsByNode(nodeID uuid.UUID, from, to *time.Time,
 					interface_internal_ip, interface_name, interface_mac, interface_is_vpn, interface_external_ip,
 					server_id, server_host, server_port, server_name, server_location, server_country, server_ip,
 					result_id, result_url,
+					clock_skew_ms, original_timestamp,
 					0 as is_failed,
 					NULL as error_message
 				FROM measurements
@@ -241,6 +248,7 @@ func (s *SQLiteDB) GetMeasurementsByNode(nodeID uuid.UUID, from, to *time.Time,
 					NULL, NULL, NULL, NULL, NULL,
 					NULL, NULL, NULL, NULL, NULL, NULL, NULL,
 					NULL, NULL,
+					clock_skew_ms, original_timestamp,
 					1 as is_failed,
 					error_message
 				FROM failed_measurements
@@ -270,7 +278,7 @@ func (s *SQLiteDB) GetMeasurementsByNode(nodeID uuid.UUID, from, to *time.Time,
 			// For failed measurements, only scan these fields
 			err := rows.Scan(
 				&m.ID, &nodeIDStr, &m.Timestamp, &m.CreatedAt,
-				&m.ErrorMessage,
+				&m.ErrorMessage, &m.ClockSkewMs, &m.OriginalTimestamp,
 			)
 			if err != nil {
 				return nil, 0, fmt.Errorf("failed to scan failed measurement: %w", err)
@@ -289,6 +297,7 @@ func (s *SQLiteDB) GetMeasurementsByNode(nodeID uuid.UUID, from, to *time.Time,
 				&m.InterfaceInternalIP, &m.InterfaceName, &m.InterfaceMacAddr, &isVPNInt, &m.InterfaceExternalIP,
 				&m.ServerID, &m.ServerHost, &m.ServerPort, &m.ServerName, &m.ServerLocation, &m.ServerCountry, &m.ServerIP,
 				&m.ResultID, &m.ResultURL,
+				&m.ClockSkewMs, &m.OriginalTimestamp,
 			)
 			if err != nil {
 				return nil, 0, fmt.Errorf("failed to scan measurement: %w", err)
@@ -313,6 +322,7 @@ func (s *SQLiteDB) GetMeasurementsByNode(nodeID uuid.UUID, from, to *time.Time,
 				&m.InterfaceInternalIP, &m.InterfaceName, &m.InterfaceMacAddr, &isVPNInt, &m.InterfaceExternalIP,
 				&m.ServerID, &m.ServerHost, &m.ServerPort, &m.ServerName, &m.ServerLocation, &m.ServerCountry, &m.ServerIP,
 				&m.ResultID, &m.ResultURL,
+				&m.ClockSkewMs, &m.OriginalTimestamp,
 				&isFailedInt, &m.ErrorMessage,
 			)
 			if err != nil {
@@ -378,8 +388,8 @@ func (s *SQLiteDB) extractArgs(conditions sq.And) []interface{} {
 }
 
 // GetAggregatedMeasurements retrieves aggregated measurements for charting
-func (s *SQLiteDB) GetAggregatedMeasurements(nodeIDs []uuid.UUID, from, to time.Time, interval string, hideArchived bool) ([]models.AggregatedMeasurement, error) {
-	ctx, cancel := withTimeout()
+func (s *SQLiteDB) GetAggregatedMeasurements(ctx context.Context, nodeIDs []uuid.UUID, from, to time.Time, interval string, hideArchived bool) ([]models.AggregatedMeasurement, error) {
+	ctx, cancel := s.withTimeout(ctx, "GetAggregatedMeasurements")
 	defer cancel()
 
 	// Get database-specific date truncation function
@@ -497,8 +507,8 @@ func getDateTruncSQL(interval string) (string, error) {
 }
 
 // GetMeasurementCounts retrieves measurement counts
-func (s *SQLiteDB) GetMeasurementCounts() (total int64, last24h int64, lastTimestamp *time.Time, err error) {
-	ctx, cancel := withTimeout()
+func (s *SQLiteDB) GetMeasurementCounts(ctx context.Context) (total int64, last24h int64, lastTimestamp *time.Time, err error) {
+	ctx, cancel := s.withTimeout(ctx, "GetMeasurementCounts")
 	defer cancel()
 
 	// Get total count
@@ -543,8 +553,8 @@ func (s *SQLiteDB) GetMeasurementCounts() (total int64, last24h int64, lastTimes
 }
 
 // GetLast24hStats retrieves average statistics for the last 24 hours
-func (s *SQLiteDB) GetLast24hStats() (*models.DashboardStats24h, error) {
-	ctx, cancel := withTimeout()
+func (s *SQLiteDB) GetLast24hStats(ctx context.Context) (*models.DashboardStats24h, error) {
+	ctx, cancel := s.withTimeout(ctx, "GetLast24hStats")
 	defer cancel()
 
 	past24h := time.Now().UTC().Add(-24 * time.Hour)
@@ -579,8 +589,8 @@ func (s *SQLiteDB) GetLast24hStats() (*models.DashboardStats24h, error) {
 }
 
 // CleanupOldMeasurements removes measurements older than the retention period
-func (s *SQLiteDB) CleanupOldMeasurements(retentionDays int) (int64, error) {
-	ctx, cancel := withTimeout()
+func (s *SQLiteDB) CleanupOldMeasurements(ctx context.Context, retentionDays int) (int64, error) {
+	ctx, cancel := s.withTimeout(ctx, "CleanupOldMeasurements")
 	defer cancel()
 
 	cutoffDate := time.Now().UTC().AddDate(0, 0, -retentionDays)
@@ -600,7 +610,7 @@ func (s *SQLiteDB) CleanupOldMeasurements(retentionDays int) (int64, error) {
 
 	deleted, _ := result.RowsAffected()
 	if deleted > 0 {
-		logger.Log.Info("Cleaned up old measurements",
+		logger.FromContext(ctx).Info("Cleaned up old measurements",
 			zap.Int64("deleted", deleted),
 			zap.Time("cutoff_date", cutoffDate),
 		)
@@ -610,8 +620,8 @@ func (s *SQLiteDB) CleanupOldMeasurements(retentionDays int) (int64, error) {
 }
 
 // CleanupOldFailedMeasurements removes failed measurements older than the retention period
-func (s *SQLiteDB) CleanupOldFailedMeasurements(retentionDays int) (int64, error) {
-	ctx, cancel := withTimeout()
+func (s *SQLiteDB) CleanupOldFailedMeasurements(ctx context.Context, retentionDays int) (int64, error) {
+	ctx, cancel := s.withTimeout(ctx, "CleanupOldFailedMeasurements")
 	defer cancel()
 
 	cutoffDate := time.Now().UTC().AddDate(0, 0, -retentionDays)
@@ -631,7 +641,7 @@ func (s *SQLiteDB) CleanupOldFailedMeasurements(retentionDays int) (int64, error
 
 	deleted, _ := result.RowsAffected()
 	if deleted > 0 {
-		logger.Log.Info("Cleaned up old failed measurements",
+		logger.FromContext(ctx).Info("Cleaned up old failed measurements",
 			zap.Int64("deleted", deleted),
 			zap.Time("cutoff_date", cutoffDate),
 		)
@@ -0,0 +1,22 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS node_commands (
+	id TEXT PRIMARY KEY,
+	node_id TEXT NOT NULL,
+	command TEXT NOT NULL,
+	status TEXT NOT NULL DEFAULT 'pending',
+	created_by TEXT,
+	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	delivered_at DATETIME,
+	completed_at DATETIME,
+	error_message TEXT,
+	measurement_timestamp DATETIME,
+	FOREIGN KEY (node_id) REFERENCES nodes(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_node_commands_node_status ON node_commands(node_id, status);
+CREATE INDEX IF NOT EXISTS idx_node_commands_created_at ON node_commands(created_at);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_node_commands_created_at;
+DROP INDEX IF EXISTS idx_node_commands_node_status;
+DROP TABLE IF EXISTS node_commands;
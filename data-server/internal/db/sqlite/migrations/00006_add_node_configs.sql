@@ -0,0 +1,15 @@
+-- +goose Up
+-- scope is either 'default' (fleet-wide settings) or a node ID (per-node overrides)
+CREATE TABLE IF NOT EXISTS node_configs (
+	scope TEXT PRIMARY KEY,
+	settings TEXT NOT NULL,
+	updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_by TEXT
+);
+
+-- Config version the node reports it is running
+ALTER TABLE nodes ADD COLUMN config_version TEXT;
+
+-- +goose Down
+ALTER TABLE nodes DROP COLUMN config_version;
+DROP TABLE IF EXISTS node_configs;
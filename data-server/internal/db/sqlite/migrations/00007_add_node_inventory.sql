@@ -0,0 +1,11 @@
+-- +goose Up
+-- Latest inventory snapshot each node sent with its alive signal
+CREATE TABLE IF NOT EXISTS node_inventory (
+	node_id TEXT PRIMARY KEY,
+	inventory TEXT NOT NULL,
+	reported_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (node_id) REFERENCES nodes(id) ON DELETE CASCADE
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS node_inventory;
@@ -0,0 +1,17 @@
+-- +goose Up
+-- Offset of the node's clock from server time as last estimated by the node (server - node)
+ALTER TABLE nodes ADD COLUMN clock_offset_ms INTEGER;
+
+-- Set on results from nodes whose clock was off by more than the skew threshold.
+-- original_timestamp keeps the node's own timestamp when it was corrected.
+ALTER TABLE measurements ADD COLUMN clock_skew_ms INTEGER;
+ALTER TABLE measurements ADD COLUMN original_timestamp DATETIME;
+ALTER TABLE failed_measurements ADD COLUMN clock_skew_ms INTEGER;
+ALTER TABLE failed_measurements ADD COLUMN original_timestamp DATETIME;
+
+-- +goose Down
+ALTER TABLE failed_measurements DROP COLUMN original_timestamp;
+ALTER TABLE failed_measurements DROP COLUMN clock_skew_ms;
+ALTER TABLE measurements DROP COLUMN original_timestamp;
+ALTER TABLE measurements DROP COLUMN clock_skew_ms;
+ALTER TABLE nodes DROP COLUMN clock_offset_ms;
@@ -0,0 +1,19 @@
+-- +goose Up
+-- Measurements held back by the plausibility checks until an admin reviews them
+CREATE TABLE IF NOT EXISTS quarantined_measurements (
+	id TEXT PRIMARY KEY,
+	node_id TEXT NOT NULL,
+	timestamp DATETIME NOT NULL,
+	measurement TEXT NOT NULL,
+	reasons TEXT NOT NULL,
+	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (node_id) REFERENCES nodes(id) ON DELETE CASCADE
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_quarantined_measurements_node_timestamp ON quarantined_measurements(node_id, timestamp);
+CREATE INDEX IF NOT EXISTS idx_quarantined_measurements_created_at ON quarantined_measurements(created_at);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_quarantined_measurements_created_at;
+DROP INDEX IF EXISTS idx_quarantined_measurements_node_timestamp;
+DROP TABLE IF EXISTS quarantined_measurements;
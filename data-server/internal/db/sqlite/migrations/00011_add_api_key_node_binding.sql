@@ -0,0 +1,9 @@
+-- +goose Up
+-- An API key may only submit data for the node it is bound to. Keys are
+-- bound by an admin or to the first node that uses them.
+ALTER TABLE api_keys ADD COLUMN node_id TEXT;
+ALTER TABLE api_keys ADD COLUMN bound_at TIMESTAMP;
+
+-- +goose Down
+ALTER TABLE api_keys DROP COLUMN bound_at;
+ALTER TABLE api_keys DROP COLUMN node_id;
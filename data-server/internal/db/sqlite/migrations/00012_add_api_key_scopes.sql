@@ -0,0 +1,12 @@
+-- +goose Up
+-- Scopes limit what a key may do; existing keys keep what they could do
+-- before. Keys may expire, and a rotated key expires after a grace period
+-- once its successor is issued.
+ALTER TABLE api_keys ADD COLUMN scopes TEXT NOT NULL DEFAULT 'ingest,alive';
+ALTER TABLE api_keys ADD COLUMN expires_at TIMESTAMP;
+ALTER TABLE api_keys ADD COLUMN replaced_by TEXT;
+
+-- +goose Down
+ALTER TABLE api_keys DROP COLUMN replaced_by;
+ALTER TABLE api_keys DROP COLUMN expires_at;
+ALTER TABLE api_keys DROP COLUMN scopes;
@@ -0,0 +1,18 @@
+-- +goose Up
+-- Tokens that new nodes exchange for their own API key, each usable a
+-- limited number of times until it expires
+CREATE TABLE IF NOT EXISTS enrollment_tokens (
+	id TEXT PRIMARY KEY,
+	name TEXT NOT NULL,
+	token_id TEXT NOT NULL UNIQUE,
+	token_hash TEXT NOT NULL,
+	scopes TEXT NOT NULL,
+	max_uses INTEGER NOT NULL,
+	uses INTEGER NOT NULL DEFAULT 0,
+	expires_at TIMESTAMP NOT NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	created_by TEXT
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS enrollment_tokens;
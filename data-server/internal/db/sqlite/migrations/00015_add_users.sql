@@ -0,0 +1,16 @@
+-- +goose Up
+-- Admin API accounts, next to the admin account from the server configuration
+CREATE TABLE IF NOT EXISTS users (
+	id TEXT PRIMARY KEY,
+	username TEXT NOT NULL UNIQUE,
+	password_hash TEXT NOT NULL,
+	role TEXT NOT NULL,
+	enabled INTEGER NOT NULL DEFAULT 1,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	created_by TEXT,
+	updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	last_login_at TIMESTAMP
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,28 @@
+-- +goose Up
+-- Optional second factor for admin API accounts. The TOTP secret is kept
+-- encrypted; it is set when enrollment starts and enabled once a code from
+-- it has been verified. totp_last_step is the time step of the last code
+-- accepted, so a code cannot be used twice.
+ALTER TABLE users ADD COLUMN totp_secret TEXT;
+ALTER TABLE users ADD COLUMN totp_enabled INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN totp_last_step INTEGER NOT NULL DEFAULT 0;
+
+-- One-time codes for signing in without the authenticator; only their
+-- digests are stored
+CREATE TABLE IF NOT EXISTS user_recovery_codes (
+	id TEXT PRIMARY KEY,
+	user_id TEXT NOT NULL,
+	code_digest TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	used_at TIMESTAMP,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_recovery_codes_user_id ON user_recovery_codes(user_id);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_user_recovery_codes_user_id;
+DROP TABLE IF EXISTS user_recovery_codes;
+ALTER TABLE users DROP COLUMN totp_last_step;
+ALTER TABLE users DROP COLUMN totp_enabled;
+ALTER TABLE users DROP COLUMN totp_secret;
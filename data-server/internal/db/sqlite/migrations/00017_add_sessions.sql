@@ -0,0 +1,39 @@
+-- +goose Up
+-- Admin API logins. Access tokens name their session, so revoking it signs
+-- them out before they expire.
+CREATE TABLE IF NOT EXISTS sessions (
+	id TEXT PRIMARY KEY,
+	username TEXT NOT NULL,
+	role TEXT NOT NULL,
+	source TEXT NOT NULL DEFAULT '',
+	user_agent TEXT NOT NULL DEFAULT '',
+	client_ip TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	last_used_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	expires_at TIMESTAMP NOT NULL,
+	revoked_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_sessions_username ON sessions(username);
+CREATE INDEX IF NOT EXISTS idx_sessions_expires_at ON sessions(expires_at);
+
+-- Refresh tokens, replaced every time one is used. Used tokens are kept
+-- with their session: presenting one again means it was stolen, and the
+-- session is revoked. Only digests of the secrets are stored.
+CREATE TABLE IF NOT EXISTS session_refresh_tokens (
+	token_id TEXT PRIMARY KEY,
+	session_id TEXT NOT NULL,
+	token_digest TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	used_at TIMESTAMP,
+	FOREIGN KEY (session_id) REFERENCES sessions(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_session_refresh_tokens_session_id ON session_refresh_tokens(session_id);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_session_refresh_tokens_session_id;
+DROP TABLE IF EXISTS session_refresh_tokens;
+DROP INDEX IF EXISTS idx_sessions_expires_at;
+DROP INDEX IF EXISTS idx_sessions_username;
+DROP TABLE IF EXISTS sessions;
@@ -0,0 +1,20 @@
+-- +goose Up
+-- A node runs one command of each kind at a time. Queueing checked for an
+-- active command before inserting, so concurrent requests could both queue
+-- one; expire all but the newest of any such duplicates first.
+UPDATE node_commands SET status = 'expired', completed_at = CURRENT_TIMESTAMP
+WHERE status IN ('pending', 'delivered', 'running')
+	AND EXISTS (
+		SELECT 1 FROM node_commands newer
+		WHERE newer.node_id = node_commands.node_id
+			AND newer.command = node_commands.command
+			AND newer.status IN ('pending', 'delivered', 'running')
+			AND (newer.created_at > node_commands.created_at
+				OR (newer.created_at = node_commands.created_at AND newer.id > node_commands.id))
+	);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_node_commands_one_active ON node_commands(node_id, command)
+	WHERE status IN ('pending', 'delivered', 'running');
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_node_commands_one_active;
@@ -0,0 +1,317 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"mark7888/speedtest-data-server/internal/logger"
+	"time"
+
+	"mark7888/speedtest-data-server/pkg/models"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// nodeCommandColumns selects a command along with the ID of the measurement it
+// produced, which only resolves once the node has synced that measurement
+var nodeCommandColumns = []string{
+	"c.id", "c.node_id", "c.command", "c.status", "c.created_by", "c.created_at",
+	"c.delivered_at", "c.completed_at", "c.error_message", "c.measurement_timestamp", "m.id",
+}
+
+// activeNodeCommandStatuses are the states a command can still progress from
+var activeNodeCommandStatuses = []string{
+	string(models.NodeCommandStatusPending),
+	string(models.NodeCommandStatusDelivered),
+	string(models.NodeCommandStatusRunning),
+}
+
+// CreateNodeCommand queues a command for a node. It fails with "command
+// already active" if the node has the same command pending, delivered or
+// running.
+func (s *SQLiteDB) CreateNodeCommand(ctx context.Context, nodeID uuid.UUID, command, createdBy string) (*models.NodeCommand, error) {
+	ctx, cancel := s.withTimeout(ctx, "CreateNodeCommand")
+	defer cancel()
+
+	nodeCommand := &models.NodeCommand{
+		ID:        uuid.New(),
+		NodeID:    nodeID,
+		Command:   command,
+		Status:    models.NodeCommandStatusPending,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	if createdBy != "" {
+		nodeCommand.CreatedBy = &createdBy
+	}
+
+	query, args, err := s.builder.
+		Insert("node_commands").
+		Columns("id", "node_id", "command", "status", "created_by", "created_at").
+		Values(nodeCommand.ID.String(), nodeID.String(), command, string(nodeCommand.Status), nodeCommand.CreatedBy, nodeCommand.CreatedAt).
+		// idx_node_commands_one_active allows one active command of a kind
+		Suffix("ON CONFLICT DO NOTHING").
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build insert query: %w", err)
+	}
+
+	result, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create node command: %w", err)
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return nil, fmt.Errorf("command already active")
+	}
+
+	return nodeCommand, nil
+}
+
+// GetNodeCommand retrieves a queued command by ID
+func (s *SQLiteDB) GetNodeCommand(ctx context.Context, id uuid.UUID) (*models.NodeCommand, error) {
+	ctx, cancel := s.withTimeout(ctx, "GetNodeCommand")
+	defer cancel()
+
+	query, args, err := s.selectNodeCommands().
+		Where(sq.Eq{"c.id": id.String()}).
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build select query: %w", err)
+	}
+
+	nodeCommand, err := scanNodeCommand(s.db.QueryRowContext(ctx, query, args...))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("node command not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get node command: %w", err)
+	}
+
+	return nodeCommand, nil
+}
+
+// GetNodeCommands retrieves the most recent commands queued for a node
+func (s *SQLiteDB) GetNodeCommands(ctx context.Context, nodeID uuid.UUID, activeOnly bool, limit int) ([]models.NodeCommand, error) {
+	ctx, cancel := s.withTimeout(ctx, "GetNodeCommands")
+	defer cancel()
+
+	qb := s.selectNodeCommands().
+		Where(sq.Eq{"c.node_id": nodeID.String()}).
+		OrderBy("c.created_at DESC").
+		Limit(uint64(limit))
+	if activeOnly {
+		qb = qb.Where(sq.Eq{"c.status": activeNodeCommandStatuses})
+	}
+
+	query, args, err := qb.ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build select query: %w", err)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query node commands: %w", err)
+	}
+	defer rows.Close()
+
+	commands := []models.NodeCommand{}
+	for rows.Next() {
+		nodeCommand, err := scanNodeCommand(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan node command: %w", err)
+		}
+		commands = append(commands, *nodeCommand)
+	}
+
+	return commands, nil
+}
+
+// ClaimPendingCommands returns the node's pending commands and marks them as delivered
+func (s *SQLiteDB) ClaimPendingCommands(ctx context.Context, nodeID uuid.UUID) ([]models.NodeCommand, error) {
+	ctx, cancel := s.withTimeout(ctx, "ClaimPendingCommands")
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query, args, err := s.builder.
+		Select("id", "command").
+		From("node_commands").
+		Where(sq.Eq{
+			"node_id": nodeID.String(),
+			"status":  string(models.NodeCommandStatusPending),
+		}).
+		OrderBy("created_at ASC").
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build select query: %w", err)
+	}
+
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query pending commands: %w", err)
+	}
+
+	var commands []models.NodeCommand
+	var ids []string
+	for rows.Next() {
+		var idStr string
+		nodeCommand := models.NodeCommand{NodeID: nodeID}
+		if err := rows.Scan(&idStr, &nodeCommand.Command); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan pending command: %w", err)
+		}
+		nodeCommand.ID, _ = uuid.Parse(idStr)
+		commands = append(commands, nodeCommand)
+		ids = append(ids, idStr)
+	}
+	rows.Close()
+
+	if len(commands) == 0 {
+		return nil, nil
+	}
+
+	now := time.Now().UTC()
+	query, args, err = s.builder.
+		Update("node_commands").
+		Set("status", string(models.NodeCommandStatusDelivered)).
+		Set("delivered_at", now).
+		Where(sq.Eq{"id": ids}).
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build update query: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		return nil, fmt.Errorf("failed to mark commands as delivered: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	for i := range commands {
+		commands[i].Status = models.NodeCommandStatusDelivered
+		commands[i].DeliveredAt = &now
+	}
+
+	return commands, nil
+}
+
+// UpdateNodeCommandStatus records progress reported by the node that owns the command.
+// Commands that already reached a final state are left untouched.
+func (s *SQLiteDB) UpdateNodeCommandStatus(ctx context.Context, id, nodeID uuid.UUID, status models.NodeCommandStatus, errorMessage *string, measurementTimestamp *time.Time) error {
+	ctx, cancel := s.withTimeout(ctx, "UpdateNodeCommandStatus")
+	defer cancel()
+
+	qb := s.builder.
+		Update("node_commands").
+		Set("status", string(status)).
+		Where(sq.Eq{
+			"id":      id.String(),
+			"node_id": nodeID.String(),
+			"status":  activeNodeCommandStatuses,
+		})
+
+	if status == models.NodeCommandStatusCompleted || status == models.NodeCommandStatusFailed {
+		qb = qb.Set("completed_at", time.Now().UTC())
+	}
+	if errorMessage != nil {
+		qb = qb.Set("error_message", *errorMessage)
+	}
+	if measurementTimestamp != nil {
+		qb = qb.Set("measurement_timestamp", *measurementTimestamp)
+	}
+
+	query, args, err := qb.ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build update query: %w", err)
+	}
+
+	result, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to update node command: %w", err)
+	}
+
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return fmt.Errorf("node command not found")
+	}
+
+	return nil
+}
+
+// ExpireNodeCommands marks commands that have not finished within maxAge as expired
+func (s *SQLiteDB) ExpireNodeCommands(ctx context.Context, maxAge time.Duration) (int64, error) {
+	ctx, cancel := s.withTimeout(ctx, "ExpireNodeCommands")
+	defer cancel()
+
+	now := time.Now().UTC()
+
+	query, args, err := s.builder.
+		Update("node_commands").
+		Set("status", string(models.NodeCommandStatusExpired)).
+		Set("completed_at", now).
+		Where(sq.And{
+			sq.Eq{"status": activeNodeCommandStatuses},
+			sq.Lt{"created_at": now.Add(-maxAge)},
+		}).
+		ToSql()
+	if err != nil {
+		return 0, fmt.Errorf("failed to build update query: %w", err)
+	}
+
+	result, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to expire node commands: %w", err)
+	}
+
+	expired, _ := result.RowsAffected()
+	if expired > 0 {
+		logger.FromContext(ctx).Info("Expired node commands", zap.Int64("count", expired))
+	}
+
+	return expired, nil
+}
+
+// selectNodeCommands builds the base command query joined to the resulting measurement
+func (s *SQLiteDB) selectNodeCommands() sq.SelectBuilder {
+	return s.builder.
+		Select(nodeCommandColumns...).
+		From("node_commands c").
+		LeftJoin("measurements m ON m.node_id = c.node_id AND m.timestamp = c.measurement_timestamp")
+}
+
+// scanNodeCommand scans a row selected with nodeCommandColumns
+func scanNodeCommand(row interface{ Scan(...interface{}) error }) (*models.NodeCommand, error) {
+	var nodeCommand models.NodeCommand
+	var idStr, nodeIDStr, status string
+
+	err := row.Scan(
+		&idStr,
+		&nodeIDStr,
+		&nodeCommand.Command,
+		&status,
+		&nodeCommand.CreatedBy,
+		&nodeCommand.CreatedAt,
+		&nodeCommand.DeliveredAt,
+		&nodeCommand.CompletedAt,
+		&nodeCommand.ErrorMessage,
+		&nodeCommand.MeasurementTimestamp,
+		&nodeCommand.MeasurementID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	nodeCommand.ID, _ = uuid.Parse(idStr)
+	nodeCommand.NodeID, _ = uuid.Parse(nodeIDStr)
+	nodeCommand.Status = models.NodeCommandStatus(status)
+
+	return &nodeCommand, nil
+}
@@ -0,0 +1,66 @@
+package sqlite
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+
+	"mark7888/speedtest-data-server/pkg/models"
+
+	"github.com/google/uuid"
+)
+
+func TestOneActiveCommandPerNode(t *testing.T) {
+	ctx := context.Background()
+	database := newTestDB(t)
+
+	nodeA, nodeB := uuid.New(), uuid.New()
+	for _, nodeID := range []uuid.UUID{nodeA, nodeB} {
+		if err := database.UpsertNode(ctx, nodeID, "node", nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Concurrent requests for the same node queue a single test
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		queued  []*models.NodeCommand
+		refused int
+	)
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			command, err := database.CreateNodeCommand(ctx, nodeA, models.NodeCommandRunTest, "admin")
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				queued = append(queued, command)
+			case strings.Contains(err.Error(), "already active"):
+				refused++
+			default:
+				t.Errorf("CreateNodeCommand: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if len(queued) != 1 || refused != 7 {
+		t.Fatalf("queued %d and refused %d commands, want 1 and 7", len(queued), refused)
+	}
+
+	// Other nodes are not affected
+	if _, err := database.CreateNodeCommand(ctx, nodeB, models.NodeCommandRunTest, "admin"); err != nil {
+		t.Errorf("queueing on another node: %v", err)
+	}
+
+	// Once the test finishes, the next one can be queued
+	if err := database.UpdateNodeCommandStatus(ctx, queued[0].ID, nodeA, models.NodeCommandStatusCompleted, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := database.CreateNodeCommand(ctx, nodeA, models.NodeCommandRunTest, "admin"); err != nil {
+		t.Errorf("queueing after the test finished: %v", err)
+	}
+}
@@ -0,0 +1,39 @@
+package sqlite
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"mark7888/speedtest-data-server/pkg/models"
+
+	"github.com/google/uuid"
+)
+
+// UpsertNodeInventory replaces the inventory snapshot stored for a node
+func (s *SQLiteDB) UpsertNodeInventory(ctx context.Context, nodeID uuid.UUID, inventory *models.NodeInventory) error {
+	ctx, cancel := s.withTimeout(ctx, "UpsertNodeInventory")
+	defer cancel()
+
+	data, err := json.Marshal(inventory)
+	if err != nil {
+		return fmt.Errorf("failed to encode node inventory: %w", err)
+	}
+
+	query, args, err := s.builder.
+		Insert("node_inventory").
+		Columns("node_id", "inventory", "reported_at").
+		Values(nodeID.String(), string(data), time.Now().UTC()).
+		Suffix("ON CONFLICT (node_id) DO UPDATE SET inventory = excluded.inventory, reported_at = excluded.reported_at").
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build insert query: %w", err)
+	}
+
+	if _, err := s.db.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("failed to upsert node inventory: %w", err)
+	}
+
+	return nil
+}
@@ -1,11 +1,13 @@
 package sqlite
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
+	"mark7888/speedtest-data-server/internal/logger"
 	"time"
 
-	"mark7888/speedtest-data-server/internal/logger"
 	"mark7888/speedtest-data-server/pkg/models"
 
 	sq "github.com/Masterminds/squirrel"
@@ -14,8 +16,8 @@ import (
 )
 
 // UpsertNode creates or updates a node (used for alive signals and self-registration)
-func (s *SQLiteDB) UpsertNode(nodeID uuid.UUID, nodeName string, nodeLocation *string) error {
-	ctx, cancel := withTimeout()
+func (s *SQLiteDB) UpsertNode(ctx context.Context, nodeID uuid.UUID, nodeName string, nodeLocation *string) error {
+	ctx, cancel := s.withTimeout(ctx, "UpsertNode")
 	defer cancel()
 
 	now := time.Now().UTC()
@@ -65,12 +67,12 @@ func (s *SQLiteDB) UpsertNode(nodeID uuid.UUID, nodeName string, nodeLocation *s
 }
 
 // GetNodeByID retrieves a node by ID
-func (s *SQLiteDB) GetNodeByID(nodeID uuid.UUID) (*models.Node, error) {
-	ctx, cancel := withTimeout()
+func (s *SQLiteDB) GetNodeByID(ctx context.Context, nodeID uuid.UUID) (*models.Node, error) {
+	ctx, cancel := s.withTimeout(ctx, "GetNodeByID")
 	defer cancel()
 
 	query, args, err := s.builder.
-		Select("id", "name", "location", "first_seen", "last_seen", "last_alive", "status", "archived", "favorite", "created_at", "updated_at").
+		Select("id", "name", "location", "first_seen", "last_seen", "last_alive", "status", "archived", "favorite", "config_version", "clock_offset_ms", "created_at", "updated_at").
 		From("nodes").
 		Where(sq.Eq{"id": nodeID.String()}).
 		ToSql()
@@ -92,6 +94,8 @@ func (s *SQLiteDB) GetNodeByID(nodeID uuid.UUID) (*models.Node, error) {
 		&node.Status,
 		&archived,
 		&favorite,
+		&node.ConfigVersion,
+		&node.ClockOffsetMs,
 		&node.CreatedAt,
 		&node.UpdatedAt,
 	)
@@ -111,8 +115,8 @@ func (s *SQLiteDB) GetNodeByID(nodeID uuid.UUID) (*models.Node, error) {
 }
 
 // GetAllNodes retrieves all nodes with optional status filter
-func (s *SQLiteDB) GetAllNodes(status string, page, limit int) ([]models.Node, int, error) {
-	ctx, cancel := withTimeout()
+func (s *SQLiteDB) GetAllNodes(ctx context.Context, status string, page, limit int) ([]models.Node, int, error) {
+	ctx, cancel := s.withTimeout(ctx, "GetAllNodes")
 	defer cancel()
 
 	// Validate status against known values to prevent unexpected filter behaviour.
@@ -123,7 +127,7 @@ func (s *SQLiteDB) GetAllNodes(status string, page, limit int) ([]models.Node, i
 
 	// Build base query
 	selectQuery := s.builder.
-		Select("id", "name", "location", "first_seen", "last_seen", "last_alive", "status", "archived", "favorite", "created_at", "updated_at").
+		Select("id", "name", "location", "first_seen", "last_seen", "last_alive", "status", "archived", "favorite", "config_version", "clock_offset_ms", "created_at", "updated_at").
 		From("nodes")
 
 	countQuery := s.builder.Select("COUNT(*)").From("nodes")
@@ -178,6 +182,8 @@ func (s *SQLiteDB) GetAllNodes(status string, page, limit int) ([]models.Node, i
 			&node.Status,
 			&archived,
 			&favorite,
+			&node.ConfigVersion,
+			&node.ClockOffsetMs,
 			&node.CreatedAt,
 			&node.UpdatedAt,
 		)
@@ -195,12 +201,12 @@ func (s *SQLiteDB) GetAllNodes(status string, page, limit int) ([]models.Node, i
 }
 
 // GetNodeWithStats retrieves a node with statistics
-func (s *SQLiteDB) GetNodeWithStats(nodeID uuid.UUID) (*models.NodeWithStats, error) {
-	ctx, cancel := withTimeout()
+func (s *SQLiteDB) GetNodeWithStats(ctx context.Context, nodeID uuid.UUID) (*models.NodeWithStats, error) {
+	ctx, cancel := s.withTimeout(ctx, "GetNodeWithStats")
 	defer cancel()
 
 	// Get node
-	node, err := s.GetNodeByID(nodeID)
+	node, err := s.GetNodeByID(ctx, nodeID)
 	if err != nil {
 		return nil, err
 	}
@@ -216,11 +222,11 @@ func (s *SQLiteDB) GetNodeWithStats(nodeID uuid.UUID) (*models.NodeWithStats, er
 		Where(sq.Eq{"node_id": nodeID.String()}).
 		ToSql()
 	if err != nil {
-		logger.Log.Warn("Failed to build measurement count query", zap.Error(err))
+		logger.FromContext(ctx).Warn("Failed to build measurement count query", zap.Error(err))
 	} else {
 		err = s.db.QueryRowContext(ctx, countQuery, countArgs...).Scan(&nodeWithStats.MeasurementCount)
 		if err != nil {
-			logger.Log.Warn("Failed to get measurement count", zap.Error(err))
+			logger.FromContext(ctx).Warn("Failed to get measurement count", zap.Error(err))
 		}
 	}
 
@@ -231,11 +237,11 @@ func (s *SQLiteDB) GetNodeWithStats(nodeID uuid.UUID) (*models.NodeWithStats, er
 		Where(sq.Eq{"node_id": nodeID.String()}).
 		ToSql()
 	if err != nil {
-		logger.Log.Warn("Failed to build failed count query", zap.Error(err))
+		logger.FromContext(ctx).Warn("Failed to build failed count query", zap.Error(err))
 	} else {
 		err = s.db.QueryRowContext(ctx, failedCountQuery, failedCountArgs...).Scan(&nodeWithStats.FailedTestCount)
 		if err != nil {
-			logger.Log.Warn("Failed to get failed test count", zap.Error(err))
+			logger.FromContext(ctx).Warn("Failed to get failed test count", zap.Error(err))
 		}
 	}
 
@@ -259,7 +265,7 @@ func (s *SQLiteDB) GetNodeWithStats(nodeID uuid.UUID) (*models.NodeWithStats, er
 		&stats.AvgPacketLoss,
 	)
 	if err != nil {
-		logger.Log.Warn("Failed to get node statistics", zap.Error(err))
+		logger.FromContext(ctx).Warn("Failed to get node statistics", zap.Error(err))
 	}
 
 	// Get success rate for last 24 hours
@@ -274,7 +280,7 @@ func (s *SQLiteDB) GetNodeWithStats(nodeID uuid.UUID) (*models.NodeWithStats, er
 		&stats.FailedCount24h,
 	)
 	if err != nil {
-		logger.Log.Warn("Failed to get 24h measurement counts", zap.Error(err))
+		logger.FromContext(ctx).Warn("Failed to get 24h measurement counts", zap.Error(err))
 	} else {
 		// Calculate success rate
 		totalCount := stats.SuccessCount24h + stats.FailedCount24h
@@ -302,7 +308,7 @@ func (s *SQLiteDB) GetNodeWithStats(nodeID uuid.UUID) (*models.NodeWithStats, er
 		Limit(1).
 		ToSql()
 	if err != nil {
-		logger.Log.Warn("Failed to build latest measurement query", zap.Error(err))
+		logger.FromContext(ctx).Warn("Failed to build latest measurement query", zap.Error(err))
 	} else {
 		err = s.db.QueryRowContext(ctx, latestQuery, latestArgs...).Scan(
 			&latestMeasurement.Timestamp,
@@ -311,24 +317,59 @@ func (s *SQLiteDB) GetNodeWithStats(nodeID uuid.UUID) (*models.NodeWithStats, er
 			&latestMeasurement.PingMs,
 		)
 		if err != nil && err != sql.ErrNoRows {
-			logger.Log.Warn("Failed to get latest measurement", zap.Error(err))
+			logger.FromContext(ctx).Warn("Failed to get latest measurement", zap.Error(err))
 		} else if err == nil {
 			nodeWithStats.LatestMeasurement = latestMeasurement
 		}
 	}
 
+	// Get latest inventory snapshot
+	inventoryQuery, inventoryArgs, err := s.builder.
+		Select("inventory", "reported_at").
+		From("node_inventory").
+		Where(sq.Eq{"node_id": nodeID.String()}).
+		ToSql()
+	if err != nil {
+		logger.FromContext(ctx).Warn("Failed to build node inventory query", zap.Error(err))
+	} else {
+		var inventory string
+		var reportedAt time.Time
+		err = s.db.QueryRowContext(ctx, inventoryQuery, inventoryArgs...).Scan(&inventory, &reportedAt)
+		if err != nil && err != sql.ErrNoRows {
+			logger.FromContext(ctx).Warn("Failed to get node inventory", zap.Error(err))
+		} else if err == nil {
+			nodeWithStats.Inventory = &models.NodeInventory{}
+			if err := json.Unmarshal([]byte(inventory), nodeWithStats.Inventory); err != nil {
+				logger.FromContext(ctx).Warn("Failed to decode node inventory", zap.Error(err))
+				nodeWithStats.Inventory = nil
+			} else {
+				nodeWithStats.InventoryReportedAt = &reportedAt
+			}
+		}
+	}
+
 	return nodeWithStats, nil
 }
 
-// UpdateNodeStatus updates the status of nodes based on last_alive timestamp
-func (s *SQLiteDB) UpdateNodeStatus(aliveTimeout, inactiveTimeout time.Duration) error {
-	ctx, cancel := withTimeout()
+// UpdateNodeStatus updates the status of nodes based on last_alive timestamp.
+// Nodes in connected hold a live control channel and are left untouched.
+func (s *SQLiteDB) UpdateNodeStatus(ctx context.Context, aliveTimeout, inactiveTimeout time.Duration, connected []uuid.UUID) error {
+	ctx, cancel := s.withTimeout(ctx, "UpdateNodeStatus")
 	defer cancel()
 
 	now := time.Now().UTC()
 	unreachableThreshold := now.Add(-aliveTimeout)
 	inactiveThreshold := now.Add(-inactiveTimeout)
 
+	notConnected := sq.And{}
+	if len(connected) > 0 {
+		ids := make([]string, len(connected))
+		for i, id := range connected {
+			ids[i] = id.String()
+		}
+		notConnected = sq.And{sq.NotEq{"id": ids}}
+	}
+
 	// Update to unreachable
 	query1, args1, err := s.builder.
 		Update("nodes").
@@ -337,6 +378,7 @@ func (s *SQLiteDB) UpdateNodeStatus(aliveTimeout, inactiveTimeout time.Duration)
 		Where(sq.And{
 			sq.Eq{"status": "active"},
 			sq.Lt{"last_alive": unreachableThreshold},
+			notConnected,
 		}).
 		ToSql()
 	if err != nil {
@@ -350,7 +392,7 @@ func (s *SQLiteDB) UpdateNodeStatus(aliveTimeout, inactiveTimeout time.Duration)
 
 	unreachableCount, _ := result.RowsAffected()
 	if unreachableCount > 0 {
-		logger.Log.Info("Updated nodes to unreachable", zap.Int64("count", unreachableCount))
+		logger.FromContext(ctx).Info("Updated nodes to unreachable", zap.Int64("count", unreachableCount))
 	}
 
 	// Update to inactive
@@ -364,6 +406,7 @@ func (s *SQLiteDB) UpdateNodeStatus(aliveTimeout, inactiveTimeout time.Duration)
 				sq.Eq{"status": "unreachable"},
 			},
 			sq.Lt{"last_alive": inactiveThreshold},
+			notConnected,
 		}).
 		ToSql()
 	if err != nil {
@@ -377,15 +420,38 @@ func (s *SQLiteDB) UpdateNodeStatus(aliveTimeout, inactiveTimeout time.Duration)
 
 	inactiveCount, _ := result.RowsAffected()
 	if inactiveCount > 0 {
-		logger.Log.Info("Updated nodes to inactive", zap.Int64("count", inactiveCount))
+		logger.FromContext(ctx).Info("Updated nodes to inactive", zap.Int64("count", inactiveCount))
+	}
+
+	return nil
+}
+
+// SetNodeStatus sets the status of a single node, e.g. when its control
+// channel disconnects
+func (s *SQLiteDB) SetNodeStatus(ctx context.Context, nodeID uuid.UUID, status models.NodeStatus) error {
+	ctx, cancel := s.withTimeout(ctx, "SetNodeStatus")
+	defer cancel()
+
+	query, args, err := s.builder.
+		Update("nodes").
+		Set("status", string(status)).
+		Set("updated_at", sq.Expr("CURRENT_TIMESTAMP")).
+		Where(sq.Eq{"id": nodeID.String()}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build update query: %w", err)
+	}
+
+	if _, err := s.db.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("failed to set node status: %w", err)
 	}
 
 	return nil
 }
 
 // GetNodeCounts returns counts of nodes by status (excluding archived nodes)
-func (s *SQLiteDB) GetNodeCounts() (total, active, unreachable, inactive int, err error) {
-	ctx, cancel := withTimeout()
+func (s *SQLiteDB) GetNodeCounts(ctx context.Context) (total, active, unreachable, inactive int, err error) {
+	ctx, cancel := s.withTimeout(ctx, "GetNodeCounts")
 	defer cancel()
 
 	// SQLite doesn't support FILTER, so we use CASE WHEN.
@@ -410,8 +476,8 @@ func (s *SQLiteDB) GetNodeCounts() (total, active, unreachable, inactive int, er
 }
 
 // ArchiveNode sets the archived status of a node
-func (s *SQLiteDB) ArchiveNode(nodeID uuid.UUID, archived bool) error {
-	ctx, cancel := withTimeout()
+func (s *SQLiteDB) ArchiveNode(ctx context.Context, nodeID uuid.UUID, archived bool) error {
+	ctx, cancel := s.withTimeout(ctx, "ArchiveNode")
 	defer cancel()
 
 	archivedInt := 0
@@ -439,7 +505,7 @@ func (s *SQLiteDB) ArchiveNode(nodeID uuid.UUID, archived bool) error {
 		return fmt.Errorf("node not found")
 	}
 
-	logger.Log.Info("Node archived status updated",
+	logger.FromContext(ctx).Info("Node archived status updated",
 		zap.String("node_id", nodeID.String()),
 		zap.Bool("archived", archived),
 	)
@@ -448,8 +514,8 @@ func (s *SQLiteDB) ArchiveNode(nodeID uuid.UUID, archived bool) error {
 }
 
 // SetNodeFavorite sets the favorite status of a node
-func (s *SQLiteDB) SetNodeFavorite(nodeID uuid.UUID, favorite bool) error {
-	ctx, cancel := withTimeout()
+func (s *SQLiteDB) SetNodeFavorite(ctx context.Context, nodeID uuid.UUID, favorite bool) error {
+	ctx, cancel := s.withTimeout(ctx, "SetNodeFavorite")
 	defer cancel()
 
 	favoriteInt := 0
@@ -477,7 +543,7 @@ func (s *SQLiteDB) SetNodeFavorite(nodeID uuid.UUID, favorite bool) error {
 		return fmt.Errorf("node not found")
 	}
 
-	logger.Log.Info("Node favorite status updated",
+	logger.FromContext(ctx).Info("Node favorite status updated",
 		zap.String("node_id", nodeID.String()),
 		zap.Bool("favorite", favorite),
 	)
@@ -486,8 +552,8 @@ func (s *SQLiteDB) SetNodeFavorite(nodeID uuid.UUID, favorite bool) error {
 }
 
 // DeleteNode deletes a node and all its associated measurements
-func (s *SQLiteDB) DeleteNode(nodeID uuid.UUID) error {
-	ctx, cancel := withTimeout()
+func (s *SQLiteDB) DeleteNode(ctx context.Context, nodeID uuid.UUID) error {
+	ctx, cancel := s.withTimeout(ctx, "DeleteNode")
 	defer cancel()
 
 	// Start transaction
@@ -511,6 +577,30 @@ func (s *SQLiteDB) DeleteNode(nodeID uuid.UUID) error {
 		return fmt.Errorf("failed to delete failed measurements: %w", err)
 	}
 
+	// Delete queued commands
+	_, err = tx.ExecContext(ctx, "DELETE FROM node_commands WHERE node_id = ?", nodeIDStr)
+	if err != nil {
+		return fmt.Errorf("failed to delete node commands: %w", err)
+	}
+
+	// Delete inventory snapshot
+	_, err = tx.ExecContext(ctx, "DELETE FROM node_inventory WHERE node_id = ?", nodeIDStr)
+	if err != nil {
+		return fmt.Errorf("failed to delete node inventory: %w", err)
+	}
+
+	// Delete measurements awaiting review
+	_, err = tx.ExecContext(ctx, "DELETE FROM quarantined_measurements WHERE node_id = ?", nodeIDStr)
+	if err != nil {
+		return fmt.Errorf("failed to delete quarantined measurements: %w", err)
+	}
+
+	// Delete per-node settings
+	_, err = tx.ExecContext(ctx, "DELETE FROM node_configs WHERE scope = ?", nodeIDStr)
+	if err != nil {
+		return fmt.Errorf("failed to delete node config: %w", err)
+	}
+
 	// Delete node
 	result, err := tx.ExecContext(ctx, "DELETE FROM nodes WHERE id = ?", nodeIDStr)
 	if err != nil {
@@ -527,9 +617,30 @@ func (s *SQLiteDB) DeleteNode(nodeID uuid.UUID) error {
 		return fmt.Errorf("failed to commit transaction: %w", err)
 	}
 
-	logger.Log.Info("Node deleted successfully",
+	logger.FromContext(ctx).Info("Node deleted successfully",
 		zap.String("node_id", nodeID.String()),
 	)
 
 	return nil
 }
+
+// UpdateNodeClockOffset records the clock offset a node last estimated
+func (s *SQLiteDB) UpdateNodeClockOffset(ctx context.Context, nodeID uuid.UUID, offsetMs int64) error {
+	ctx, cancel := s.withTimeout(ctx, "UpdateNodeClockOffset")
+	defer cancel()
+
+	query, args, err := s.builder.
+		Update("nodes").
+		Set("clock_offset_ms", offsetMs).
+		Where(sq.Eq{"id": nodeID.String()}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build update query: %w", err)
+	}
+
+	if _, err := s.db.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("failed to update node clock offset: %w", err)
+	}
+
+	return nil
+}
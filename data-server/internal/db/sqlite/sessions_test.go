@@ -0,0 +1,114 @@
+package sqlite
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"mark7888/speedtest-data-server/internal/auth"
+	"mark7888/speedtest-data-server/pkg/models"
+)
+
+// refreshToken generates a refresh token
+func refreshToken(t *testing.T) string {
+	t.Helper()
+	token, err := auth.GenerateRefreshToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestSessions(t *testing.T) {
+	ctx := context.Background()
+	database := newTestDB(t)
+
+	first := refreshToken(t)
+	session, err := database.CreateSession(ctx, first, models.NewSession{
+		Username:  "alice",
+		Role:      models.UserRoleAdmin,
+		UserAgent: "test",
+		ClientIP:  "192.0.2.1",
+		ExpiresAt: time.Now().Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("refresh tokens rotate", func(t *testing.T) {
+		second := refreshToken(t)
+		rotated, err := database.RotateRefreshToken(ctx, first, second)
+		if err != nil || rotated.ID != session.ID || rotated.Username != "alice" {
+			t.Fatalf("RotateRefreshToken = %+v, %v", rotated, err)
+		}
+		if _, err := database.RotateRefreshToken(ctx, second, refreshToken(t)); err != nil {
+			t.Fatalf("rotated token: %v", err)
+		}
+
+		// The token's secret has to match, not just its ID
+		forged := second[:strings.Index(second, ".")] + ".forged"
+		if _, err := database.RotateRefreshToken(ctx, forged, refreshToken(t)); err == nil || !strings.Contains(err.Error(), "invalid") {
+			t.Errorf("forged token: %v", err)
+		}
+	})
+
+	t.Run("reused refresh token revokes the session", func(t *testing.T) {
+		_, err := database.RotateRefreshToken(ctx, first, refreshToken(t))
+		if err == nil || !strings.Contains(err.Error(), "already used") {
+			t.Fatalf("reused token: %v", err)
+		}
+		got, err := database.GetSession(ctx, session.ID)
+		if err != nil || got.Active(time.Now()) {
+			t.Errorf("session after reuse = %+v, %v; want revoked", got, err)
+		}
+	})
+
+	t.Run("revoking", func(t *testing.T) {
+		var ids []string
+		for _, username := range []string{"bob", "bob", "carol"} {
+			s, err := database.CreateSession(ctx, refreshToken(t), models.NewSession{Username: username, Role: models.UserRoleViewer, ExpiresAt: time.Now().Add(time.Hour)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids = append(ids, s.ID.String())
+		}
+
+		if sessions, err := database.GetActiveSessions(ctx, "bob"); err != nil || len(sessions) != 2 {
+			t.Fatalf("GetActiveSessions(bob) = %d sessions, %v; want 2", len(sessions), err)
+		}
+		if sessions, _ := database.GetActiveSessions(ctx, ""); len(sessions) != 3 {
+			t.Errorf("GetActiveSessions() = %d sessions, want 3", len(sessions))
+		}
+
+		revoked, err := database.RevokeUserSessions(ctx, "bob")
+		if err != nil || revoked != 2 {
+			t.Fatalf("RevokeUserSessions = %d, %v; want 2", revoked, err)
+		}
+		if sessions, _ := database.GetActiveSessions(ctx, ""); len(sessions) != 1 || sessions[0].ID.String() != ids[2] {
+			t.Errorf("active sessions after revoking bob's = %+v, want carol's", sessions)
+		}
+		if err := database.RevokeSession(ctx, session.ID); err == nil {
+			t.Error("revoked a session twice")
+		}
+	})
+
+	t.Run("expired sessions", func(t *testing.T) {
+		token := refreshToken(t)
+		expired, err := database.CreateSession(ctx, token, models.NewSession{Username: "dave", Role: models.UserRoleViewer, ExpiresAt: time.Now().Add(-time.Minute)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := database.RotateRefreshToken(ctx, token, refreshToken(t)); err == nil {
+			t.Error("refreshed an expired session")
+		}
+
+		deleted, err := database.CleanupExpiredSessions(ctx)
+		if err != nil || deleted != 1 {
+			t.Fatalf("CleanupExpiredSessions = %d, %v; want 1", deleted, err)
+		}
+		if _, err := database.GetSession(ctx, expired.ID); err == nil {
+			t.Error("expired session kept")
+		}
+	})
+}
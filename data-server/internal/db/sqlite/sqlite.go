@@ -9,8 +9,10 @@ import (
 	"sync"
 	"time"
 
+	"mark7888/speedtest-data-server/internal/auth"
 	"mark7888/speedtest-data-server/internal/config"
 	"mark7888/speedtest-data-server/internal/logger"
+	"mark7888/speedtest-data-server/internal/tracing"
 
 	sq "github.com/Masterminds/squirrel"
 	_ "github.com/mattn/go-sqlite3"
@@ -26,6 +28,10 @@ type SQLiteDB struct {
 	pingMutex    sync.RWMutex
 	lastPingTime time.Time
 	lastPingErr  error
+
+	// API key lookup and verified-key cache
+	keyHasher *auth.APIKeyHasher
+	keyCache  *auth.APIKeyCache
 }
 
 // New creates a new SQLite database connection
@@ -59,8 +65,10 @@ func New(cfg *config.Config) (*SQLiteDB, error) {
 	builder := sq.StatementBuilder.PlaceholderFormat(sq.Question)
 
 	return &SQLiteDB{
-		db:      db,
-		builder: builder,
+		db:        db,
+		builder:   builder,
+		keyHasher: auth.NewAPIKeyHasher(cfg.APIKeys.Secret),
+		keyCache:  auth.NewAPIKeyCache(cfg.APIKeys.CacheTTL),
 	}, nil
 }
 
@@ -71,15 +79,15 @@ func (s *SQLiteDB) Close() error {
 }
 
 // Ping checks if the database connection is alive
-func (s *SQLiteDB) Ping() error {
-	ctx, cancel := withTimeout()
+func (s *SQLiteDB) Ping(ctx context.Context) error {
+	ctx, cancel := s.withTimeout(ctx, "Ping")
 	defer cancel()
 	return s.db.PingContext(ctx)
 }
 
 // SafePing checks if the database connection is alive with caching to prevent DDoS
 // Only performs an actual ping if the last ping was more than 5 seconds ago
-func (s *SQLiteDB) SafePing() error {
+func (s *SQLiteDB) SafePing(ctx context.Context) error {
 	// First, try to read the cached result
 	s.pingMutex.RLock()
 	if time.Since(s.lastPingTime) < 5*time.Second {
@@ -99,7 +107,7 @@ func (s *SQLiteDB) SafePing() error {
 	}
 
 	// Perform the actual ping
-	ctx, cancel := withTimeout()
+	ctx, cancel := s.withTimeout(ctx, "SafePing")
 	defer cancel()
 	err := s.db.PingContext(ctx)
 
@@ -110,7 +118,9 @@ func (s *SQLiteDB) SafePing() error {
 	return err
 }
 
-// withTimeout creates a context with a default timeout
-func withTimeout() (context.Context, context.CancelFunc) {
-	return context.WithTimeout(context.Background(), 10*time.Second)
+// withTimeout derives the context for a single method from ctx, adding a
+// default timeout and a span named by operation. Cancelling it ends the
+// method's span and records its duration.
+func (s *SQLiteDB) withTimeout(ctx context.Context, operation string) (context.Context, context.CancelFunc) {
+	return tracing.StartQuery(ctx, "sqlite", operation, 10*time.Second)
 }
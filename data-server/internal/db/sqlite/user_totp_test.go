@@ -0,0 +1,106 @@
+package sqlite
+
+import (
+	"context"
+	"testing"
+
+	"mark7888/speedtest-data-server/pkg/models"
+)
+
+func TestUserTOTP(t *testing.T) {
+	ctx := context.Background()
+	database := newTestDB(t)
+
+	user, err := database.CreateUser(ctx, models.NewUser{Username: "alice", PasswordHash: "hash", Role: models.UserRoleAdmin})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.TOTPEnabled {
+		t.Fatal("new user has TOTP enabled")
+	}
+
+	if _, err := database.GetUserTOTPSecret(ctx, user.ID); err == nil {
+		t.Error("got a TOTP secret before enrollment")
+	}
+	if err := database.SetUserTOTPSecret(ctx, user.ID, "JBSWY3DPEHPK3PXP"); err != nil {
+		t.Fatal(err)
+	}
+	secret, err := database.GetUserTOTPSecret(ctx, user.ID)
+	if err != nil || secret != "JBSWY3DPEHPK3PXP" {
+		t.Fatalf("GetUserTOTPSecret = %q, %v", secret, err)
+	}
+
+	var stored string
+	if err := database.db.QueryRow("SELECT totp_secret FROM users WHERE id = ?", user.ID.String()).Scan(&stored); err != nil {
+		t.Fatal(err)
+	}
+	if stored == secret {
+		t.Error("TOTP secret stored unencrypted")
+	}
+
+	codes := []string{"aaaa-bbbb", "cccc-dddd"}
+	if err := database.EnableUserTOTP(ctx, user.ID, 100, codes); err != nil {
+		t.Fatal(err)
+	}
+	user, err = database.GetUserByID(ctx, user.ID)
+	if err != nil || !user.TOTPEnabled {
+		t.Fatalf("user after enabling = %+v, %v", user, err)
+	}
+	if err := database.SetUserTOTPSecret(ctx, user.ID, "KRSXG5CTMVRXEZLU"); err == nil {
+		t.Error("replaced the secret while TOTP is enabled")
+	}
+
+	t.Run("steps are used once", func(t *testing.T) {
+		for _, step := range []int64{99, 100} {
+			if err := database.UseUserTOTPStep(ctx, user.ID, step); err == nil {
+				t.Errorf("step %d accepted after step 100", step)
+			}
+		}
+		if err := database.UseUserTOTPStep(ctx, user.ID, 101); err != nil {
+			t.Errorf("step 101: %v", err)
+		}
+		if err := database.UseUserTOTPStep(ctx, user.ID, 101); err == nil {
+			t.Error("step 101 accepted twice")
+		}
+	})
+
+	t.Run("recovery codes are used once", func(t *testing.T) {
+		// Codes match however they are typed
+		if err := database.UseRecoveryCode(ctx, user.ID, "AAAA BBBB"); err != nil {
+			t.Fatal(err)
+		}
+		if err := database.UseRecoveryCode(ctx, user.ID, "aaaa-bbbb"); err == nil {
+			t.Error("recovery code used twice")
+		}
+		if err := database.UseRecoveryCode(ctx, user.ID, "eeee-ffff"); err == nil {
+			t.Error("unknown recovery code accepted")
+		}
+		if count, err := database.CountRecoveryCodes(ctx, user.ID); err != nil || count != 1 {
+			t.Errorf("CountRecoveryCodes = %d, %v; want 1", count, err)
+		}
+
+		if err := database.ReplaceRecoveryCodes(ctx, user.ID, []string{"gggg-hhhh"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := database.UseRecoveryCode(ctx, user.ID, "cccc-dddd"); err == nil {
+			t.Error("replaced recovery code still works")
+		}
+		if count, _ := database.CountRecoveryCodes(ctx, user.ID); count != 1 {
+			t.Errorf("CountRecoveryCodes after replacing = %d, want 1", count)
+		}
+	})
+
+	if err := database.DisableUserTOTP(ctx, user.ID); err != nil {
+		t.Fatal(err)
+	}
+	user, _ = database.GetUserByID(ctx, user.ID)
+	if user.TOTPEnabled {
+		t.Error("TOTP still enabled after disabling")
+	}
+	if _, err := database.GetUserTOTPSecret(ctx, user.ID); err == nil {
+		t.Error("TOTP secret kept after disabling")
+	}
+	if count, _ := database.CountRecoveryCodes(ctx, user.ID); count != 0 {
+		t.Errorf("%d recovery codes kept after disabling", count)
+	}
+}
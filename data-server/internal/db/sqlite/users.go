@@ -0,0 +1,242 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"mark7888/speedtest-data-server/pkg/models"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/google/uuid"
+)
+
+// userColumns are the columns scanned by scanUser
+var userColumns = []string{"id", "username", "password_hash", "role", "enabled", "totp_enabled", "created_at", "created_by", "updated_at", "last_login_at"}
+
+// CreateUser stores a new user. Usernames are unique.
+func (s *SQLiteDB) CreateUser(ctx context.Context, user models.NewUser) (*models.User, error) {
+	ctx, cancel := s.withTimeout(ctx, "CreateUser")
+	defer cancel()
+
+	now := time.Now().UTC()
+	created := &models.User{
+		ID:           uuid.New(),
+		Username:     user.Username,
+		PasswordHash: user.PasswordHash,
+		Role:         user.Role,
+		Enabled:      true,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	if user.CreatedBy != "" {
+		created.CreatedBy = &user.CreatedBy
+	}
+
+	query, args, err := s.builder.
+		Insert("users").
+		Columns("id", "username", "password_hash", "role", "enabled", "created_at", "created_by", "updated_at").
+		Values(created.ID.String(), created.Username, created.PasswordHash, created.Role, 1,
+			created.CreatedAt, created.CreatedBy, created.UpdatedAt).
+		Suffix("ON CONFLICT (username) DO NOTHING").
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build insert query: %w", err)
+	}
+
+	result, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create user: %w", err)
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return nil, fmt.Errorf("username already exists")
+	}
+
+	return created, nil
+}
+
+// GetUserByID retrieves a user by ID
+func (s *SQLiteDB) GetUserByID(ctx context.Context, id uuid.UUID) (*models.User, error) {
+	ctx, cancel := s.withTimeout(ctx, "GetUserByID")
+	defer cancel()
+
+	return s.getUser(ctx, sq.Eq{"id": id.String()})
+}
+
+// GetUserByUsername retrieves a user by username
+func (s *SQLiteDB) GetUserByUsername(ctx context.Context, username string) (*models.User, error) {
+	ctx, cancel := s.withTimeout(ctx, "GetUserByUsername")
+	defer cancel()
+
+	return s.getUser(ctx, sq.Eq{"username": username})
+}
+
+// getUser retrieves the user matching where
+func (s *SQLiteDB) getUser(ctx context.Context, where sq.Eq) (*models.User, error) {
+	query, args, err := s.builder.
+		Select(userColumns...).
+		From("users").
+		Where(where).
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build select query: %w", err)
+	}
+
+	user, err := scanUser(s.db.QueryRowContext(ctx, query, args...))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("user not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	return user, nil
+}
+
+// GetAllUsers retrieves all users, ordered by username
+func (s *SQLiteDB) GetAllUsers(ctx context.Context) ([]models.User, error) {
+	ctx, cancel := s.withTimeout(ctx, "GetAllUsers")
+	defer cancel()
+
+	query, args, err := s.builder.
+		Select(userColumns...).
+		From("users").
+		OrderBy("username").
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build select query: %w", err)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query users: %w", err)
+	}
+	defer rows.Close()
+
+	users := []models.User{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan user: %w", err)
+		}
+		users = append(users, *user)
+	}
+
+	return users, rows.Err()
+}
+
+// UpdateUser applies the set fields of update to a user and returns it
+func (s *SQLiteDB) UpdateUser(ctx context.Context, id uuid.UUID, update models.UserUpdate) (*models.User, error) {
+	ctx, cancel := s.withTimeout(ctx, "UpdateUser")
+	defer cancel()
+
+	builder := s.builder.
+		Update("users").
+		Set("updated_at", time.Now().UTC()).
+		Where(sq.Eq{"id": id.String()})
+	if update.Role != nil {
+		builder = builder.Set("role", *update.Role)
+	}
+	if update.PasswordHash != nil {
+		builder = builder.Set("password_hash", *update.PasswordHash)
+	}
+	if update.Enabled != nil {
+		enabledInt := 0
+		if *update.Enabled {
+			enabledInt = 1
+		}
+		builder = builder.Set("enabled", enabledInt)
+	}
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build update query: %w", err)
+	}
+
+	result, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update user: %w", err)
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return nil, fmt.Errorf("user not found")
+	}
+
+	return s.getUser(ctx, sq.Eq{"id": id.String()})
+}
+
+// DeleteUser deletes a user
+func (s *SQLiteDB) DeleteUser(ctx context.Context, id uuid.UUID) error {
+	ctx, cancel := s.withTimeout(ctx, "DeleteUser")
+	defer cancel()
+
+	query, args, err := s.builder.
+		Delete("users").
+		Where(sq.Eq{"id": id.String()}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build delete query: %w", err)
+	}
+
+	result, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to delete user: %w", err)
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return fmt.Errorf("user not found")
+	}
+
+	return nil
+}
+
+// UpdateUserLastLogin records that a user logged in just now
+func (s *SQLiteDB) UpdateUserLastLogin(ctx context.Context, id uuid.UUID) error {
+	ctx, cancel := s.withTimeout(ctx, "UpdateUserLastLogin")
+	defer cancel()
+
+	query, args, err := s.builder.
+		Update("users").
+		Set("last_login_at", time.Now().UTC()).
+		Where(sq.Eq{"id": id.String()}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build update query: %w", err)
+	}
+
+	if _, err := s.db.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("failed to update last login: %w", err)
+	}
+
+	return nil
+}
+
+// scanUser scans a row selected with userColumns
+func scanUser(row interface{ Scan(...interface{}) error }) (*models.User, error) {
+	var user models.User
+	var idStr string
+	var enabled, totpEnabled int
+
+	err := row.Scan(
+		&idStr,
+		&user.Username,
+		&user.PasswordHash,
+		&user.Role,
+		&enabled,
+		&totpEnabled,
+		&user.CreatedAt,
+		&user.CreatedBy,
+		&user.UpdatedAt,
+		&user.LastLoginAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	user.ID, _ = uuid.Parse(idStr)
+	user.Enabled = enabled == 1
+	user.TOTPEnabled = totpEnabled == 1
+
+	return &user, nil
+}
@@ -0,0 +1,108 @@
+package sqlite
+
+import (
+	"context"
+	"testing"
+
+	"mark7888/speedtest-data-server/pkg/models"
+
+	"github.com/google/uuid"
+)
+
+func TestUsers(t *testing.T) {
+	ctx := context.Background()
+	database := newTestDB(t)
+
+	alice, err := database.CreateUser(ctx, models.NewUser{Username: "alice", PasswordHash: "hash-a", Role: models.UserRoleOperator, CreatedBy: "admin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !alice.Enabled || alice.CreatedBy == nil || *alice.CreatedBy != "admin" {
+		t.Errorf("created user = %+v, want enabled and created by admin", alice)
+	}
+	if _, err := database.CreateUser(ctx, models.NewUser{Username: "bob", PasswordHash: "hash-b", Role: models.UserRoleViewer}); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("duplicate username", func(t *testing.T) {
+		_, err := database.CreateUser(ctx, models.NewUser{Username: "alice", PasswordHash: "other", Role: models.UserRoleAdmin})
+		if err == nil || err.Error() != "username already exists" {
+			t.Errorf("err = %v, want username already exists", err)
+		}
+	})
+
+	t.Run("lookup", func(t *testing.T) {
+		byName, err := database.GetUserByUsername(ctx, "alice")
+		if err != nil {
+			t.Fatal(err)
+		}
+		byID, err := database.GetUserByID(ctx, alice.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if byName.ID != alice.ID || byID.Username != "alice" || byID.PasswordHash != "hash-a" || byID.Role != models.UserRoleOperator {
+			t.Errorf("lookups = %+v, %+v; want alice", byName, byID)
+		}
+		if _, err := database.GetUserByUsername(ctx, "carol"); err == nil || err.Error() != "user not found" {
+			t.Errorf("unknown user: err = %v, want user not found", err)
+		}
+
+		users, err := database.GetAllUsers(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(users) != 2 || users[0].Username != "alice" || users[1].Username != "bob" {
+			t.Errorf("GetAllUsers = %+v, want alice and bob", users)
+		}
+	})
+
+	t.Run("update", func(t *testing.T) {
+		role, hash, disabled := models.UserRoleAdmin, "hash-new", false
+		updated, err := database.UpdateUser(ctx, alice.ID, models.UserUpdate{Role: &role, PasswordHash: &hash, Enabled: &disabled})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if updated.Role != role || updated.PasswordHash != hash || updated.Enabled {
+			t.Errorf("updated user = %+v, want admin, new hash, disabled", updated)
+		}
+
+		// Unset fields are left alone
+		enabled := true
+		updated, err = database.UpdateUser(ctx, alice.ID, models.UserUpdate{Enabled: &enabled})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if updated.Role != role || updated.PasswordHash != hash || !updated.Enabled {
+			t.Errorf("updated user = %+v, want only enabled changed", updated)
+		}
+
+		if _, err := database.UpdateUser(ctx, uuid.New(), models.UserUpdate{Enabled: &enabled}); err == nil || err.Error() != "user not found" {
+			t.Errorf("unknown user: err = %v, want user not found", err)
+		}
+	})
+
+	t.Run("last login", func(t *testing.T) {
+		if err := database.UpdateUserLastLogin(ctx, alice.ID); err != nil {
+			t.Fatal(err)
+		}
+		user, err := database.GetUserByID(ctx, alice.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.LastLoginAt == nil {
+			t.Error("LastLoginAt not set")
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		if err := database.DeleteUser(ctx, alice.ID); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := database.GetUserByID(ctx, alice.ID); err == nil {
+			t.Error("user still exists after delete")
+		}
+		if err := database.DeleteUser(ctx, alice.ID); err == nil || err.Error() != "user not found" {
+			t.Errorf("second delete: err = %v, want user not found", err)
+		}
+	})
+}
@@ -0,0 +1,288 @@
+package grpcapi
+
+import (
+	"errors"
+	"fmt"
+
+	"mark7888/speedtest-data-server/pkg/models"
+	"mark7888/speedtest-data-server/pkg/speedtestpb"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/google/uuid"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// The converters below also enforce the constraints that the REST API gets
+// from gin binding tags (required fields, non-empty batches)
+
+// parseNode validates the node identification shared by all requests
+func parseNode(nodeID, nodeName string) (uuid.UUID, error) {
+	id, err := uuid.Parse(nodeID)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("invalid node_id: %w", err)
+	}
+	if nodeName == "" {
+		return uuid.Nil, errors.New("node_name is required")
+	}
+	return id, nil
+}
+
+// aliveRequestFromProto converts and validates an alive request
+func aliveRequestFromProto(req *speedtestpb.AliveRequest) (*models.AliveRequest, error) {
+	nodeID, err := parseNode(req.GetNodeId(), req.GetNodeName())
+	if err != nil {
+		return nil, err
+	}
+	if req.GetTimestamp() == nil {
+		return nil, errors.New("timestamp is required")
+	}
+
+	alive := &models.AliveRequest{
+		NodeID:        nodeID,
+		NodeName:      req.GetNodeName(),
+		Location:      req.Location,
+		Timestamp:     req.GetTimestamp().AsTime(),
+		ConfigVersion: req.ConfigVersion,
+		ClockOffsetMs: req.ClockOffsetMs,
+	}
+
+	if inventory := req.GetInventory(); inventory != nil {
+		alive.Inventory = inventoryFromProto(inventory)
+		if err := binding.Validator.ValidateStruct(alive.Inventory); err != nil {
+			return nil, fmt.Errorf("invalid inventory: %w", err)
+		}
+	}
+
+	return alive, nil
+}
+
+// inventoryFromProto converts a node inventory snapshot
+func inventoryFromProto(inventory *speedtestpb.NodeInventory) *models.NodeInventory {
+	out := &models.NodeInventory{
+		Version:                  inventory.GetVersion(),
+		Backends:                 append([]string{}, inventory.GetBackends()...),
+		OS:                       inventory.GetOs(),
+		Kernel:                   inventory.GetKernel(),
+		Arch:                     inventory.GetArch(),
+		UptimeSeconds:            inventory.GetUptimeSeconds(),
+		DBSizeBytes:              inventory.GetDbSizeBytes(),
+		UnsentMeasurements:       inventory.GetUnsentMeasurements(),
+		UnsentFailedMeasurements: inventory.GetUnsentFailedMeasurements(),
+	}
+	if inventory.GetLastSuccessfulTest() != nil {
+		lastTest := inventory.GetLastSuccessfulTest().AsTime()
+		out.LastSuccessfulTest = &lastTest
+	}
+	return out
+}
+
+// aliveResponseToProto converts an alive response
+func aliveResponseToProto(resp *models.AliveResponse) *speedtestpb.AliveResponse {
+	out := &speedtestpb.AliveResponse{
+		Status:         resp.Status,
+		ServerTime:     timestamppb.New(resp.ServerTime),
+		NodeRegistered: resp.NodeRegistered,
+		RequestTime:    timestamppb.New(resp.RequestTime),
+		ReceiveTime:    timestamppb.New(resp.ReceiveTime),
+		ConfigVersion:  resp.ConfigVersion,
+	}
+	if resp.Config != nil {
+		out.Config = nodeSettingsToProto(resp.Config)
+	}
+	for _, command := range resp.Commands {
+		out.Commands = append(out.Commands, &speedtestpb.PendingCommand{
+			Id:      command.ID.String(),
+			Command: command.Command,
+		})
+	}
+	return out
+}
+
+// nodeSettingsToProto converts server-managed node settings
+func nodeSettingsToProto(settings *models.NodeSettings) *speedtestpb.NodeSettings {
+	out := &speedtestpb.NodeSettings{
+		SpeedtestCron:    settings.SpeedtestCron,
+		SpeedtestTimeout: settings.SpeedtestTimeout,
+		RetryOnFailure:   settings.RetryOnFailure,
+		SyncInterval:     settings.SyncInterval,
+		AliveInterval:    settings.AliveInterval,
+	}
+	if settings.BatchSize != nil {
+		batchSize := int32(*settings.BatchSize)
+		out.BatchSize = &batchSize
+	}
+	if settings.RetentionDays != nil {
+		retentionDays := int32(*settings.RetentionDays)
+		out.RetentionDays = &retentionDays
+	}
+	return out
+}
+
+// commandResultFromProto converts and validates a command result report
+func commandResultFromProto(req *speedtestpb.ReportCommandResultRequest) (uuid.UUID, *models.CommandResultRequest, error) {
+	commandID, err := uuid.Parse(req.GetCommandId())
+	if err != nil {
+		return uuid.Nil, nil, fmt.Errorf("invalid command_id: %w", err)
+	}
+	nodeID, err := uuid.Parse(req.GetNodeId())
+	if err != nil {
+		return uuid.Nil, nil, fmt.Errorf("invalid node_id: %w", err)
+	}
+
+	switch models.NodeCommandStatus(req.GetStatus()) {
+	case models.NodeCommandStatusRunning, models.NodeCommandStatusCompleted, models.NodeCommandStatusFailed:
+	default:
+		return uuid.Nil, nil, errors.New("status must be one of running, completed, failed")
+	}
+
+	result := &models.CommandResultRequest{
+		NodeID:       nodeID,
+		Status:       req.GetStatus(),
+		ErrorMessage: req.ErrorMessage,
+	}
+	if req.GetMeasurementTimestamp() != nil {
+		ts := req.GetMeasurementTimestamp().AsTime()
+		result.MeasurementTimestamp = &ts
+		result.ClockOffsetMs = req.ClockOffsetMs
+	}
+
+	return commandID, result, nil
+}
+
+// measurementRequestFromProto converts and validates a measurement batch
+func measurementRequestFromProto(req *speedtestpb.SubmitMeasurementsRequest) (*models.MeasurementRequest, error) {
+	nodeID, err := parseNode(req.GetNodeId(), req.GetNodeName())
+	if err != nil {
+		return nil, err
+	}
+	if len(req.GetMeasurements()) == 0 {
+		return nil, errors.New("at least one measurement is required")
+	}
+
+	details := make([]models.MeasurementDetail, 0, len(req.GetMeasurements()))
+	for i, m := range req.GetMeasurements() {
+		if m.GetTimestamp() == nil {
+			return nil, fmt.Errorf("measurements[%d]: timestamp is required", i)
+		}
+		details = append(details, measurementDetailFromProto(m))
+	}
+
+	return &models.MeasurementRequest{
+		NodeID:       nodeID,
+		NodeName:     req.GetNodeName(),
+		Measurements: details,
+	}, nil
+}
+
+// measurementDetailFromProto converts a single measurement
+func measurementDetailFromProto(m *speedtestpb.Measurement) models.MeasurementDetail {
+	detail := models.MeasurementDetail{
+		Timestamp:  m.GetTimestamp().AsTime(),
+		PacketLoss: m.PacketLoss,
+		ISP:        m.Isp,
+		Download:   transferFromProto(m.GetDownload()),
+		Upload:     transferFromProto(m.GetUpload()),
+
+		LocalID:       m.LocalId,
+		ClockOffsetMs: m.ClockOffsetMs,
+	}
+
+	if p := m.GetPing(); p != nil {
+		detail.Ping = &models.PingMetrics{
+			Jitter:  p.GetJitter(),
+			Latency: p.GetLatency(),
+			Low:     p.GetLow(),
+			High:    p.GetHigh(),
+		}
+	}
+
+	if iface := m.GetInterface(); iface != nil {
+		detail.Interface = &models.InterfaceInfo{
+			InternalIP: iface.GetInternalIp(),
+			Name:       iface.GetName(),
+			MacAddr:    iface.GetMacAddr(),
+			IsVPN:      iface.GetIsVpn(),
+			ExternalIP: iface.GetExternalIp(),
+		}
+	}
+
+	if srv := m.GetServer(); srv != nil {
+		detail.Server = &models.ServerInfo{
+			ID:       int(srv.GetId()),
+			Host:     srv.GetHost(),
+			Port:     int(srv.GetPort()),
+			Name:     srv.GetName(),
+			Location: srv.GetLocation(),
+			Country:  srv.GetCountry(),
+			IP:       srv.GetIp(),
+		}
+	}
+
+	if r := m.GetResult(); r != nil {
+		detail.Result = &models.ResultInfo{
+			ID:  r.GetId(),
+			URL: r.GetUrl(),
+		}
+	}
+
+	return detail
+}
+
+// transferFromProto converts download/upload metrics
+func transferFromProto(t *speedtestpb.Transfer) *models.TransferMetrics {
+	if t == nil {
+		return nil
+	}
+
+	transfer := &models.TransferMetrics{
+		Bandwidth: t.GetBandwidth(),
+		Bytes:     t.GetBytes(),
+		Elapsed:   int(t.GetElapsed()),
+	}
+
+	if l := t.GetLatency(); l != nil {
+		transfer.Latency = &models.LatencyMetrics{
+			Iqm:    l.GetIqm(),
+			Low:    l.GetLow(),
+			High:   l.GetHigh(),
+			Jitter: l.GetJitter(),
+		}
+	}
+
+	return transfer
+}
+
+// failedRequestFromProto converts and validates a failed test batch
+func failedRequestFromProto(req *speedtestpb.SubmitFailedMeasurementsRequest) (*models.FailedMeasurementRequest, error) {
+	nodeID, err := parseNode(req.GetNodeId(), req.GetNodeName())
+	if err != nil {
+		return nil, err
+	}
+	if len(req.GetFailedTests()) == 0 {
+		return nil, errors.New("at least one failed test is required")
+	}
+
+	tests := make([]models.FailedTestDetail, 0, len(req.GetFailedTests()))
+	for i, t := range req.GetFailedTests() {
+		if t.GetTimestamp() == nil {
+			return nil, fmt.Errorf("failed_tests[%d]: timestamp is required", i)
+		}
+		if t.GetErrorMessage() == "" {
+			return nil, fmt.Errorf("failed_tests[%d]: error_message is required", i)
+		}
+		tests = append(tests, models.FailedTestDetail{
+			Timestamp:    t.GetTimestamp().AsTime(),
+			ErrorMessage: t.GetErrorMessage(),
+			RetryCount:   int(t.GetRetryCount()),
+
+			LocalID:       t.LocalId,
+			ClockOffsetMs: t.ClockOffsetMs,
+		})
+	}
+
+	return &models.FailedMeasurementRequest{
+		NodeID:      nodeID,
+		NodeName:    req.GetNodeName(),
+		FailedTests: tests,
+	}, nil
+}
@@ -0,0 +1,94 @@
+package grpcapi
+
+import (
+	"context"
+	"strings"
+
+	"mark7888/speedtest-data-server/internal/api/middleware"
+	"mark7888/speedtest-data-server/internal/auth"
+	"mark7888/speedtest-data-server/internal/db"
+	"mark7888/speedtest-data-server/internal/logger"
+	"mark7888/speedtest-data-server/internal/metrics"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// apiKeyInterceptor validates the API key sent in the "authorization"
+// metadata entry, mirroring middleware.APIKeyAuth for the REST API. A
+// verified client certificate authenticates the node instead.
+func apiKeyInterceptor(database db.Database) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if p, ok := peer.FromContext(ctx); ok {
+			if tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+				cert, err := auth.NodeCertificateFromTLS(&tlsInfo.State)
+				if err != nil {
+					logger.Log.Warn("Invalid client certificate", zap.Error(err), zap.String("method", info.FullMethod))
+					return nil, status.Error(codes.Unauthenticated, "invalid client certificate")
+				}
+				if cert != nil {
+					return handler(auth.WithNodeCertificate(ctx, cert), req)
+				}
+			}
+		}
+
+		md, _ := metadata.FromIncomingContext(ctx)
+		values := md.Get("authorization")
+		if len(values) == 0 {
+			return nil, status.Error(codes.Unauthenticated, "authorization metadata required")
+		}
+
+		// Extract token from "Bearer <token>"
+		parts := strings.Split(values[0], " ")
+		if len(parts) != 2 || parts[0] != "Bearer" {
+			return nil, status.Error(codes.Unauthenticated, "invalid authorization metadata format")
+		}
+
+		// Verify API key
+		apiKey, err := database.VerifyAPIKey(ctx, parts[1])
+		if err != nil {
+			logger.Log.Warn("Invalid API key attempt", zap.Error(err), zap.String("method", info.FullMethod))
+			return nil, status.Error(codes.Unauthenticated, "invalid API key")
+		}
+
+		return handler(auth.WithAPIKey(ctx, apiKey), req)
+	}
+}
+
+// rateLimitInterceptor applies the per-API-key rate limit to gRPC calls
+func rateLimitInterceptor(limiter *middleware.RateLimiter) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		key := ""
+		if apiKey, ok := auth.APIKeyFromContext(ctx); ok {
+			key = apiKey.ID.String()
+		} else if cert, ok := auth.NodeCertificateFromContext(ctx); ok {
+			key = "cert:" + cert.NodeID.String()
+		}
+		if key != "" && !limiter.Allow(key) {
+			metrics.RateLimitRejections.WithLabelValues("grpc").Inc()
+			return nil, status.Error(codes.ResourceExhausted, "rate limit exceeded")
+		}
+		return handler(ctx, req)
+	}
+}
+
+// recoveryInterceptor turns handler panics into Internal errors, like gin.Recovery
+func recoveryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				logger.Log.Error("Panic in gRPC handler",
+					zap.Any("panic", r),
+					zap.String("method", info.FullMethod),
+				)
+				err = status.Error(codes.Internal, "internal error")
+			}
+		}()
+		return handler(ctx, req)
+	}
+}
@@ -0,0 +1,196 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"mark7888/speedtest-data-server/internal/api/middleware"
+	"mark7888/speedtest-data-server/internal/auth"
+	"mark7888/speedtest-data-server/internal/config"
+	"mark7888/speedtest-data-server/internal/db"
+	"mark7888/speedtest-data-server/internal/ingest"
+	"mark7888/speedtest-data-server/internal/logger"
+	"mark7888/speedtest-data-server/pkg/speedtestpb"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	_ "google.golang.org/grpc/encoding/gzip" // Accept gzip-compressed messages from nodes
+	"google.golang.org/grpc/status"
+)
+
+// Server exposes the ingestion service over gRPC on its own port
+type Server struct {
+	speedtestpb.UnimplementedIngestServiceServer
+
+	ingest     *ingest.Service
+	grpcServer *grpc.Server
+	addr       string
+}
+
+// NewServer creates a new gRPC ingestion server. rateLimiter is shared with
+// the HTTP API, so a node has one budget however it splits its calls.
+func NewServer(cfg *config.Config, database db.Database, ingestService *ingest.Service, rateLimiter *middleware.RateLimiter) (*Server, error) {
+	opts := []grpc.ServerOption{
+		grpc.MaxRecvMsgSize(cfg.API.MaxBodySize),
+		grpc.ChainUnaryInterceptor(
+			recoveryInterceptor(),
+			apiKeyInterceptor(database),
+			rateLimitInterceptor(rateLimiter),
+		),
+	}
+
+	// Reuse the HTTP server certificate and client CAs so nodes can use
+	// both endpoints with the same credentials
+	if cfg.Server.TLSEnabled {
+		clientCAs, err := auth.LoadCertPool(cfg.Server.TLSClientCA, cfg.Server.NodeCACert)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig, err := auth.ServerTLSConfig(cfg.Server.TLSCert, cfg.Server.TLSKey, clientCAs)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load TLS credentials: %w", err)
+		}
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+
+	s := &Server{
+		ingest:     ingestService,
+		grpcServer: grpc.NewServer(opts...),
+		addr:       fmt.Sprintf("%s:%d", cfg.Server.Host, cfg.GRPC.Port),
+	}
+	speedtestpb.RegisterIngestServiceServer(s.grpcServer, s)
+
+	return s, nil
+}
+
+// Start starts listening for gRPC connections in the background
+func (s *Server) Start() error {
+	listener, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", s.addr, err)
+	}
+
+	go func() {
+		logger.Log.Info("gRPC server listening", zap.String("addr", s.addr))
+		if err := s.grpcServer.Serve(listener); err != nil && !errors.Is(err, grpc.ErrServerStopped) {
+			logger.Log.Error("gRPC server failed", zap.Error(err))
+		}
+	}()
+
+	return nil
+}
+
+// Stop gracefully stops the gRPC server, waiting for in-flight calls
+func (s *Server) Stop() {
+	logger.Log.Info("Stopping gRPC server")
+	s.grpcServer.GracefulStop()
+}
+
+// Alive handles node alive/registration signals
+func (s *Server) Alive(ctx context.Context, req *speedtestpb.AliveRequest) (*speedtestpb.AliveResponse, error) {
+	aliveReq, err := aliveRequestFromProto(req)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	response, err := s.ingest.Alive(ctx, aliveReq)
+	if err != nil {
+		if denied := permissionDenied(err); denied != nil {
+			return nil, denied
+		}
+		logger.Log.Error("Failed to upsert node", zap.Error(err))
+		return nil, status.Error(codes.Internal, "failed to register node")
+	}
+
+	return aliveResponseToProto(response), nil
+}
+
+// SubmitMeasurements handles measurement submissions from nodes
+func (s *Server) SubmitMeasurements(ctx context.Context, req *speedtestpb.SubmitMeasurementsRequest) (*speedtestpb.SubmitMeasurementsResponse, error) {
+	measurementReq, err := measurementRequestFromProto(req)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	response, err := s.ingest.SubmitMeasurements(ctx, measurementReq)
+	if err != nil {
+		if denied := permissionDenied(err); denied != nil {
+			return nil, denied
+		}
+		logger.Log.Error("Failed to upsert node", zap.Error(err))
+		return nil, status.Error(codes.Internal, "failed to register node")
+	}
+
+	return &speedtestpb.SubmitMeasurementsResponse{
+		Status:      response.Status,
+		Received:    int32(response.Received),
+		Inserted:    int32(response.Inserted),
+		Updated:     int32(response.Updated),
+		Failed:      int32(response.Failed),
+		Rejected:    int32(response.Rejected),
+		Quarantined: int32(response.Quarantined),
+		Deferred:    response.Deferred,
+	}, nil
+}
+
+// SubmitFailedMeasurements handles failed measurement submissions
+func (s *Server) SubmitFailedMeasurements(ctx context.Context, req *speedtestpb.SubmitFailedMeasurementsRequest) (*speedtestpb.SubmitFailedMeasurementsResponse, error) {
+	failedReq, err := failedRequestFromProto(req)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	response, err := s.ingest.SubmitFailedMeasurements(ctx, failedReq)
+	if err != nil {
+		if denied := permissionDenied(err); denied != nil {
+			return nil, denied
+		}
+		logger.Log.Error("Failed to upsert node", zap.Error(err))
+		return nil, status.Error(codes.Internal, "failed to register node")
+	}
+
+	return &speedtestpb.SubmitFailedMeasurementsResponse{
+		Status:   response.Status,
+		Received: int32(response.Received),
+		Rejected: int32(response.Rejected),
+		Deferred: response.Deferred,
+	}, nil
+}
+
+// ReportCommandResult records a node's progress on a queued command
+func (s *Server) ReportCommandResult(ctx context.Context, req *speedtestpb.ReportCommandResultRequest) (*speedtestpb.ReportCommandResultResponse, error) {
+	commandID, resultReq, err := commandResultFromProto(req)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	response, err := s.ingest.ReportCommandResult(ctx, commandID, resultReq)
+	if err != nil {
+		if denied := permissionDenied(err); denied != nil {
+			return nil, denied
+		}
+		if strings.Contains(err.Error(), "not found") {
+			return nil, status.Error(codes.NotFound, "command not found or already finished")
+		}
+		logger.Log.Error("Failed to update node command", zap.Error(err))
+		return nil, status.Error(codes.Internal, "failed to record command result")
+	}
+
+	return &speedtestpb.ReportCommandResultResponse{
+		Status: response.Status,
+	}, nil
+}
+
+// permissionDenied returns a PermissionDenied status if err means the API key
+// may not make the call, nil otherwise
+func permissionDenied(err error) error {
+	if ingest.IsDenied(err) {
+		return status.Error(codes.PermissionDenied, err.Error())
+	}
+	return nil
+}
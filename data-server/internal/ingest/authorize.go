@@ -0,0 +1,125 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"mark7888/speedtest-data-server/internal/auth"
+	"mark7888/speedtest-data-server/internal/logger"
+	"mark7888/speedtest-data-server/pkg/models"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+var (
+	// ErrNodeNotAllowed is returned when the API key of a call is bound to a
+	// different node than the one the call is for
+	ErrNodeNotAllowed = errors.New("API key is bound to another node")
+
+	// ErrMissingScope is returned when the API key of a call does not grant
+	// the scope the call needs
+	ErrMissingScope = errors.New("API key lacks scope")
+
+	// ErrCertificateNotAllowed is returned when the client certificate of a
+	// call identifies a different node than the one the call is for
+	ErrCertificateNotAllowed = errors.New("client certificate is issued to another node")
+)
+
+// IsDenied reports whether err means the API key may not make the call, as
+// opposed to the call failing
+func IsDenied(err error) bool {
+	return errors.Is(err, ErrNodeNotAllowed) || errors.Is(err, ErrMissingScope) || errors.Is(err, ErrCertificateNotAllowed)
+}
+
+// Authorize checks that the API key carried by ctx grants scope and may act
+// for nodeID; see AuthorizeNode. A node with a client certificate is granted
+// models.NodeCertificateScopes.
+func (s *Service) Authorize(ctx context.Context, scope string, nodeID uuid.UUID) error {
+	if cert, ok := auth.NodeCertificateFromContext(ctx); ok {
+		if !slices.Contains(models.NodeCertificateScopes, scope) {
+			return fmt.Errorf("%w %q", ErrMissingScope, scope)
+		}
+		return authorizeCertificate(ctx, cert, nodeID)
+	}
+	if apiKey, ok := auth.APIKeyFromContext(ctx); ok && !apiKey.HasScope(scope) {
+		logger.FromContext(ctx).Warn("Rejected API key without the required scope",
+			zap.String("api_key_id", apiKey.ID.String()),
+			zap.String("scope", scope),
+			zap.String("node_id", nodeID.String()),
+		)
+		return fmt.Errorf("%w %q", ErrMissingScope, scope)
+	}
+	return s.AuthorizeNode(ctx, nodeID)
+}
+
+// AuthorizeNode checks that the API key carried by ctx may act for nodeID.
+// A key that is not bound yet is bound to nodeID here, so every key ends up
+// serving a single node. Every ingestion call checks this itself; transports
+// only need to call it to refuse a node before doing anything else.
+//
+// A client certificate in ctx takes the place of the key and must identify
+// nodeID. Calls with neither are not checked, here or in Authorize. Every
+// node transport authenticates the node and passes its credentials along
+// with auth.WithAPIKey or auth.WithNodeCertificate.
+func (s *Service) AuthorizeNode(ctx context.Context, nodeID uuid.UUID) error {
+	if cert, ok := auth.NodeCertificateFromContext(ctx); ok {
+		return authorizeCertificate(ctx, cert, nodeID)
+	}
+
+	apiKey, ok := auth.APIKeyFromContext(ctx)
+	if !ok {
+		return nil
+	}
+
+	if apiKey.NodeID != nil {
+		if *apiKey.NodeID != nodeID {
+			return rejectNode(ctx, apiKey.ID, *apiKey.NodeID, nodeID)
+		}
+		return nil
+	}
+
+	bound, err := s.db.BindAPIKeyNode(ctx, apiKey.ID, nodeID)
+	if err != nil {
+		return fmt.Errorf("failed to bind API key: %w", err)
+	}
+	if bound != nodeID {
+		return rejectNode(ctx, apiKey.ID, bound, nodeID)
+	}
+	// The key is the caller's own copy; later calls with the same context,
+	// such as heartbeats on a control channel, need not bind it again
+	apiKey.NodeID = &bound
+
+	logger.FromContext(ctx).Info("Bound API key to node",
+		zap.String("api_key_id", apiKey.ID.String()),
+		zap.String("node_id", nodeID.String()),
+	)
+	return nil
+}
+
+// authorizeCertificate checks that a client certificate identifies nodeID.
+// Unlike API keys, certificates name their node when they are issued.
+func authorizeCertificate(ctx context.Context, cert *auth.NodeCertificate, nodeID uuid.UUID) error {
+	if cert.NodeID == nodeID {
+		return nil
+	}
+
+	logger.FromContext(ctx).Warn("Rejected client certificate used for another node",
+		zap.String("serial_number", cert.SerialNumber),
+		zap.String("certificate_node_id", cert.NodeID.String()),
+		zap.String("node_id", nodeID.String()),
+	)
+	return ErrCertificateNotAllowed
+}
+
+// rejectNode logs a call for a node other than the key's own and returns ErrNodeNotAllowed
+func rejectNode(ctx context.Context, apiKeyID, boundNodeID, nodeID uuid.UUID) error {
+	logger.FromContext(ctx).Warn("Rejected API key used for another node",
+		zap.String("api_key_id", apiKeyID.String()),
+		zap.String("bound_node_id", boundNodeID.String()),
+		zap.String("node_id", nodeID.String()),
+	)
+	return ErrNodeNotAllowed
+}
@@ -0,0 +1,253 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"mark7888/speedtest-data-server/internal/auth"
+	"mark7888/speedtest-data-server/internal/db"
+	"mark7888/speedtest-data-server/pkg/models"
+
+	"github.com/google/uuid"
+)
+
+// keyContext verifies plainKey like a transport would and returns a context
+// carrying the key
+func keyContext(t *testing.T, database db.Database, plainKey string) context.Context {
+	t.Helper()
+	apiKey, err := database.VerifyAPIKey(context.Background(), plainKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return auth.WithAPIKey(context.Background(), apiKey)
+}
+
+// createKey creates an API key and returns its plain text and ID
+func createKey(t *testing.T, database db.Database) (string, uuid.UUID) {
+	t.Helper()
+	plainKey, err := auth.GenerateAPIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	apiKey, err := database.CreateAPIKey(context.Background(), plainKey, models.NewAPIKey{Name: "node key", CreatedBy: "admin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return plainKey, apiKey.ID
+}
+
+func TestNodeBinding(t *testing.T) {
+	nodeA, nodeB := uuid.New(), uuid.New()
+
+	// Each step is a call with the key; earlier steps bind it
+	type step struct {
+		nodeID  uuid.UUID
+		wantErr bool
+	}
+	tests := []struct {
+		name  string
+		bind  *uuid.UUID // explicit binding before the first call
+		reset bool       // reset the binding after the first step
+		steps []step
+	}{
+		{
+			name:  "first use binds",
+			steps: []step{{nodeID: nodeA}, {nodeID: nodeA}, {nodeID: nodeB, wantErr: true}},
+		},
+		{
+			name:  "explicit binding",
+			bind:  &nodeB,
+			steps: []step{{nodeID: nodeA, wantErr: true}, {nodeID: nodeB}},
+		},
+		{
+			name:  "reset allows another node",
+			reset: true,
+			steps: []step{{nodeID: nodeA}, {nodeID: nodeB}, {nodeID: nodeA, wantErr: true}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service, database := newTestService(t, testConfig())
+			plainKey, keyID := createKey(t, database)
+			if tt.bind != nil {
+				if err := database.SetAPIKeyNode(context.Background(), keyID, tt.bind); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			for i, step := range tt.steps {
+				// A fresh context per call, as every request verifies the key again
+				ctx := keyContext(t, database, plainKey)
+				_, err := service.SubmitMeasurements(ctx, &models.MeasurementRequest{
+					NodeID:       step.nodeID,
+					NodeName:     "test node",
+					Measurements: []models.MeasurementDetail{plausibleDetail(time.Now().Add(-time.Duration(i) * time.Minute))},
+				})
+				if step.wantErr {
+					if !errors.Is(err, ErrNodeNotAllowed) {
+						t.Fatalf("step %d: err = %v, want ErrNodeNotAllowed", i, err)
+					}
+				} else if err != nil {
+					t.Fatalf("step %d: %v", i, err)
+				}
+
+				if i == 0 && tt.reset {
+					if err := database.SetAPIKeyNode(context.Background(), keyID, nil); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestNodeBindingAllCalls(t *testing.T) {
+	service, database := newTestService(t, testConfig())
+	plainKey, keyID := createKey(t, database)
+	owner, other := uuid.New(), uuid.New()
+	if err := database.SetAPIKeyNode(context.Background(), keyID, &owner); err != nil {
+		t.Fatal(err)
+	}
+
+	calls := map[string]func(ctx context.Context, nodeID uuid.UUID) error{
+		"Alive": func(ctx context.Context, nodeID uuid.UUID) error {
+			_, err := service.Alive(ctx, &models.AliveRequest{NodeID: nodeID, NodeName: "test node", Timestamp: time.Now()})
+			return err
+		},
+		"RecordAlive": func(ctx context.Context, nodeID uuid.UUID) error {
+			return service.RecordAlive(ctx, &models.AliveRequest{NodeID: nodeID, NodeName: "test node", Timestamp: time.Now()})
+		},
+		"SubmitFailedMeasurements": func(ctx context.Context, nodeID uuid.UUID) error {
+			_, err := service.SubmitFailedMeasurements(ctx, &models.FailedMeasurementRequest{
+				NodeID:   nodeID,
+				NodeName: "test node",
+				FailedTests: []models.FailedTestDetail{
+					{Timestamp: time.Now().Add(-time.Minute), ErrorMessage: "timeout"},
+				},
+			})
+			return err
+		},
+		"ReportCommandResult": func(ctx context.Context, nodeID uuid.UUID) error {
+			_, err := service.ReportCommandResult(ctx, uuid.New(), &models.CommandResultRequest{NodeID: nodeID, Status: "running"})
+			return err
+		},
+	}
+
+	for name, call := range calls {
+		t.Run(name, func(t *testing.T) {
+			if err := call(keyContext(t, database, plainKey), other); !errors.Is(err, ErrNodeNotAllowed) {
+				t.Errorf("call for another node: err = %v, want ErrNodeNotAllowed", err)
+			}
+			if err := call(keyContext(t, database, plainKey), owner); errors.Is(err, ErrNodeNotAllowed) {
+				t.Errorf("call for the bound node rejected")
+			}
+		})
+	}
+}
+
+func TestNodeBindingWithoutKey(t *testing.T) {
+	service, _ := newTestService(t, testConfig())
+
+	for _, nodeID := range []uuid.UUID{uuid.New(), uuid.New()} {
+		if err := service.AuthorizeNode(context.Background(), nodeID); err != nil {
+			t.Errorf("AuthorizeNode without a key = %v, want nil", err)
+		}
+	}
+}
+
+func TestAuthorizeScopes(t *testing.T) {
+	tests := []struct {
+		name       string
+		scopes     []string
+		call       string
+		wantDenied bool
+	}{
+		{name: "default scopes ingest", call: "SubmitMeasurements"},
+		{name: "default scopes alive", call: "Alive"},
+		{name: "default scopes no stats", call: "NodeStats", wantDenied: true},
+		{name: "ingest only", scopes: []string{models.APIKeyScopeIngest}, call: "Alive", wantDenied: true},
+		{name: "alive only", scopes: []string{models.APIKeyScopeAlive}, call: "SubmitMeasurements", wantDenied: true},
+		{name: "alive covers command results", scopes: []string{models.APIKeyScopeAlive}, call: "ReportCommandResult"},
+		{name: "stats only", scopes: []string{models.APIKeyScopeStatsRead}, call: "NodeStats"},
+		{name: "stats only no ingest", scopes: []string{models.APIKeyScopeStatsRead}, call: "SubmitFailedMeasurements", wantDenied: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service, database := newTestService(t, testConfig())
+			plainKey, err := auth.GenerateAPIKey()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := database.CreateAPIKey(context.Background(), plainKey, models.NewAPIKey{Name: "node key", Scopes: tt.scopes}); err != nil {
+				t.Fatal(err)
+			}
+			ctx := keyContext(t, database, plainKey)
+			nodeID := uuid.New()
+			// NodeStats needs the node to exist
+			if err := database.UpsertNode(context.Background(), nodeID, "test node", nil); err != nil {
+				t.Fatal(err)
+			}
+
+			switch tt.call {
+			case "SubmitMeasurements":
+				_, err = service.SubmitMeasurements(ctx, &models.MeasurementRequest{
+					NodeID: nodeID, NodeName: "test node",
+					Measurements: []models.MeasurementDetail{plausibleDetail(time.Now().Add(-time.Minute))},
+				})
+			case "SubmitFailedMeasurements":
+				_, err = service.SubmitFailedMeasurements(ctx, &models.FailedMeasurementRequest{
+					NodeID: nodeID, NodeName: "test node",
+					FailedTests: []models.FailedTestDetail{{Timestamp: time.Now().Add(-time.Minute), ErrorMessage: "timeout"}},
+				})
+			case "Alive":
+				_, err = service.Alive(ctx, &models.AliveRequest{NodeID: nodeID, NodeName: "test node", Timestamp: time.Now()})
+			case "ReportCommandResult":
+				_, err = service.ReportCommandResult(ctx, uuid.New(), &models.CommandResultRequest{NodeID: nodeID, Status: "running"})
+			case "NodeStats":
+				_, err = service.NodeStats(ctx, nodeID)
+			}
+
+			if denied := errors.Is(err, ErrMissingScope); denied != tt.wantDenied {
+				t.Errorf("%s: err = %v, want denied: %v", tt.call, err, tt.wantDenied)
+			}
+			if IsDenied(err) != tt.wantDenied {
+				t.Errorf("IsDenied(%v) = %v", err, !tt.wantDenied)
+			}
+		})
+	}
+}
+
+func TestAuthorizeCertificate(t *testing.T) {
+	nodeID := uuid.New()
+
+	tests := []struct {
+		name    string
+		scope   string
+		nodeID  uuid.UUID
+		wantErr error
+	}{
+		{name: "own node", scope: models.APIKeyScopeIngest, nodeID: nodeID},
+		{name: "stats", scope: models.APIKeyScopeStatsRead, nodeID: nodeID},
+		{name: "another node", scope: models.APIKeyScopeAlive, nodeID: uuid.New(), wantErr: ErrCertificateNotAllowed},
+		{name: "scope not granted", scope: "admin", nodeID: nodeID, wantErr: ErrMissingScope},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service, _ := newTestService(t, testConfig())
+			ctx := auth.WithNodeCertificate(context.Background(), &auth.NodeCertificate{NodeID: nodeID, SerialNumber: "ff"})
+
+			err := service.Authorize(ctx, tt.scope, tt.nodeID)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Authorize = %v, want %v", err, tt.wantErr)
+			}
+			if IsDenied(err) != (tt.wantErr != nil) {
+				t.Errorf("IsDenied(%v) = %v", err, !IsDenied(err))
+			}
+		})
+	}
+}
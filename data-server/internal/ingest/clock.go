@@ -0,0 +1,75 @@
+package ingest
+
+import (
+	"context"
+	"time"
+
+	"mark7888/speedtest-data-server/internal/logger"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// clockCheck adjusts the timestamps a node reports for its clock offset and
+// rejects those too far in the future. Nodes estimate their offset from the
+// alive round-trip and record it with each result, so a result is corrected
+// with the offset the node had when the test ran. Older nodes only report
+// their latest offset in alive signals, which is used for their results
+// instead; until a node has reported one, timestamps are taken as they are.
+type clockCheck struct {
+	latest    *time.Duration // server - node, from the node's latest alive signal
+	threshold time.Duration
+	correct   bool
+	maxFuture time.Duration
+}
+
+// clockCheck prepares the timestamp checks for a node's results
+func (s *Service) clockCheck(ctx context.Context, nodeID uuid.UUID) *clockCheck {
+	check := &clockCheck{
+		threshold: s.config.Node.ClockSkewThreshold,
+		correct:   s.config.Node.ClockSkewCorrection,
+		maxFuture: s.config.Node.MaxFutureSkew,
+	}
+
+	node, err := s.db.GetNodeByID(ctx, nodeID)
+	if err != nil {
+		logger.FromContext(ctx).Warn("Failed to get node clock offset",
+			zap.Error(err),
+			zap.String("node_id", nodeID.String()),
+		)
+		return check
+	}
+
+	if node.ClockOffsetMs != nil {
+		latest := time.Duration(*node.ClockOffsetMs) * time.Millisecond
+		check.latest = &latest
+	}
+
+	return check
+}
+
+// apply adjusts timestamp for the node's clock offset. offsetMs is the
+// offset the node recorded with the result, nil if it did not record one.
+// skewMs is set when the node's clock was skewed and original when the
+// timestamp was corrected. ok is false if the timestamp is too far in the
+// future to accept.
+func (c *clockCheck) apply(timestamp *time.Time, offsetMs *int64) (skewMs *int64, original *time.Time, ok bool) {
+	offset := c.latest
+	if offsetMs != nil {
+		recorded := time.Duration(*offsetMs) * time.Millisecond
+		offset = &recorded
+	}
+
+	if offset != nil && offset.Abs() > c.threshold {
+		ms := offset.Milliseconds()
+		skewMs = &ms
+
+		if c.correct {
+			reported := *timestamp
+			original = &reported
+			*timestamp = timestamp.Add(*offset)
+		}
+	}
+
+	return skewMs, original, !timestamp.After(time.Now().Add(c.maxFuture))
+}
@@ -0,0 +1,106 @@
+package ingest
+
+import (
+	"testing"
+	"time"
+)
+
+func TestClockCheckApply(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	duration := func(d time.Duration) *time.Duration { return &d }
+	ms := func(n int64) *int64 { return &n }
+
+	tests := []struct {
+		name         string
+		latest       *time.Duration // offset from the node's latest alive
+		correct      bool
+		timestamp    time.Time
+		offsetMs     *int64 // offset recorded with the result
+		wantTime     time.Time
+		wantSkewMs   *int64
+		wantOriginal bool
+		wantOK       bool
+	}{
+		{
+			name:      "no offset known",
+			timestamp: now, wantTime: now, wantOK: true,
+		},
+		{
+			name:      "offset within threshold",
+			latest:    duration(time.Second),
+			timestamp: now, wantTime: now, wantOK: true,
+		},
+		{
+			name:      "latest offset flags skew without correcting",
+			latest:    duration(-time.Hour),
+			timestamp: now, wantTime: now, wantSkewMs: ms(-3600000), wantOK: true,
+		},
+		{
+			name:      "latest offset corrects",
+			latest:    duration(-time.Hour),
+			correct:   true,
+			timestamp: now, wantTime: now.Add(-time.Hour), wantSkewMs: ms(-3600000), wantOriginal: true, wantOK: true,
+		},
+		{
+			name:      "recorded offset wins over latest",
+			latest:    duration(time.Hour),
+			correct:   true,
+			timestamp: now, offsetMs: ms(-7200000),
+			wantTime: now.Add(-2 * time.Hour), wantSkewMs: ms(-7200000), wantOriginal: true, wantOK: true,
+		},
+		{
+			name:      "recorded offset within threshold ignores skewed latest",
+			latest:    duration(time.Hour),
+			correct:   true,
+			timestamp: now, offsetMs: ms(100),
+			wantTime: now, wantOK: true,
+		},
+		{
+			name:      "future timestamp rejected",
+			timestamp: now.Add(time.Hour), wantTime: now.Add(time.Hour), wantOK: false,
+		},
+		{
+			name:      "future timestamp accepted once corrected",
+			correct:   true,
+			timestamp: now.Add(time.Hour), offsetMs: ms(-3600000),
+			wantTime: now, wantSkewMs: ms(-3600000), wantOriginal: true, wantOK: true,
+		},
+		{
+			name:      "within max future skew",
+			timestamp: now.Add(time.Minute), wantTime: now.Add(time.Minute), wantOK: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check := &clockCheck{
+				latest:    tt.latest,
+				threshold: 5 * time.Second,
+				correct:   tt.correct,
+				maxFuture: 5 * time.Minute,
+			}
+
+			timestamp := tt.timestamp
+			skewMs, original, ok := check.apply(&timestamp, tt.offsetMs)
+
+			if ok != tt.wantOK {
+				t.Errorf("ok = %v, want %v", ok, tt.wantOK)
+			}
+			if !timestamp.Equal(tt.wantTime) {
+				t.Errorf("timestamp = %v, want %v", timestamp, tt.wantTime)
+			}
+			switch {
+			case tt.wantSkewMs == nil && skewMs != nil:
+				t.Errorf("skew = %d, want none", *skewMs)
+			case tt.wantSkewMs != nil && (skewMs == nil || *skewMs != *tt.wantSkewMs):
+				t.Errorf("skew = %v, want %d", skewMs, *tt.wantSkewMs)
+			}
+			if (original != nil) != tt.wantOriginal {
+				t.Errorf("original = %v, want set: %v", original, tt.wantOriginal)
+			}
+			if original != nil && !original.Equal(tt.timestamp) {
+				t.Errorf("original = %v, want %v", *original, tt.timestamp)
+			}
+		})
+	}
+}
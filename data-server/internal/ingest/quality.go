@@ -0,0 +1,133 @@
+package ingest
+
+import (
+	"fmt"
+	"time"
+
+	"mark7888/speedtest-data-server/pkg/models"
+)
+
+// Ways of handling measurements that fail the plausibility checks
+const (
+	qualityActionQuarantine = "quarantine" // hold back for an admin to review
+	qualityActionReject     = "reject"     // drop and count as rejected
+	qualityActionAccept     = "accept"     // store anyway, only log
+)
+
+// plausibilityCheck flags measurements whose values cannot come from a real
+// speedtest. It is created per batch so it can spot duplicate timestamps;
+// resending a batch is how nodes retry and is not flagged.
+type plausibilityCheck struct {
+	maxBandwidth int64   // bytes per second, as the speedtest CLI reports it
+	maxLatency   float64 // milliseconds
+	oldest       time.Time
+	seen         map[int64]bool // timestamps already in the batch
+}
+
+// plausibilityCheck prepares the plausibility checks for a batch of measurements
+func (s *Service) plausibilityCheck() *plausibilityCheck {
+	check := &plausibilityCheck{
+		maxBandwidth: int64(s.config.Quality.MaxBandwidthMbps) * 1000 * 1000 / 8,
+		maxLatency:   float64(s.config.Quality.MaxLatencyMs),
+		seen:         make(map[int64]bool),
+	}
+
+	// Anything older would be removed by the next cleanup anyway
+	if days := s.config.Retention.MeasurementsDays; days > 0 {
+		check.oldest = time.Now().AddDate(0, 0, -days)
+	}
+
+	return check
+}
+
+// check returns why the measurement is implausible, or nothing if it looks real
+func (c *plausibilityCheck) check(m *models.Measurement) []string {
+	var reasons []string
+
+	if !c.oldest.IsZero() && m.Timestamp.Before(c.oldest) {
+		reasons = append(reasons, "timestamp is older than the retention period")
+	}
+	key := m.Timestamp.UnixNano()
+	if c.seen[key] {
+		reasons = append(reasons, "timestamp is duplicated within the batch")
+	}
+	c.seen[key] = true
+
+	bandwidths := []struct {
+		name  string
+		value *int64
+	}{
+		{"download_bandwidth", m.DownloadBandwidth},
+		{"upload_bandwidth", m.UploadBandwidth},
+	}
+	for _, b := range bandwidths {
+		if b.value == nil {
+			continue
+		}
+		if *b.value < 0 {
+			reasons = append(reasons, fmt.Sprintf("%s is negative", b.name))
+		} else if *b.value > c.maxBandwidth {
+			reasons = append(reasons, fmt.Sprintf("%s exceeds %d Mbps", b.name, c.maxBandwidth*8/1000/1000))
+		}
+	}
+
+	counters := []struct {
+		name  string
+		value *int64
+	}{
+		{"download_bytes", m.DownloadBytes},
+		{"upload_bytes", m.UploadBytes},
+	}
+	for _, counter := range counters {
+		if counter.value != nil && *counter.value < 0 {
+			reasons = append(reasons, fmt.Sprintf("%s is negative", counter.name))
+		}
+	}
+
+	elapsed := []struct {
+		name  string
+		value *int
+	}{
+		{"download_elapsed", m.DownloadElapsed},
+		{"upload_elapsed", m.UploadElapsed},
+	}
+	for _, e := range elapsed {
+		if e.value != nil && *e.value < 0 {
+			reasons = append(reasons, fmt.Sprintf("%s is negative", e.name))
+		}
+	}
+
+	latencies := []struct {
+		name  string
+		value *float64
+	}{
+		{"ping_latency", m.PingLatency},
+		{"ping_jitter", m.PingJitter},
+		{"ping_low", m.PingLow},
+		{"ping_high", m.PingHigh},
+		{"download_latency_iqm", m.DownloadLatencyIqm},
+		{"download_latency_low", m.DownloadLatencyLow},
+		{"download_latency_high", m.DownloadLatencyHigh},
+		{"download_latency_jitter", m.DownloadLatencyJitter},
+		{"upload_latency_iqm", m.UploadLatencyIqm},
+		{"upload_latency_low", m.UploadLatencyLow},
+		{"upload_latency_high", m.UploadLatencyHigh},
+		{"upload_latency_jitter", m.UploadLatencyJitter},
+	}
+	for _, l := range latencies {
+		if l.value == nil {
+			continue
+		}
+		if *l.value < 0 {
+			reasons = append(reasons, fmt.Sprintf("%s is negative", l.name))
+		} else if *l.value > c.maxLatency {
+			reasons = append(reasons, fmt.Sprintf("%s exceeds %.0f ms", l.name, c.maxLatency))
+		}
+	}
+
+	if m.PacketLoss != nil && (*m.PacketLoss < 0 || *m.PacketLoss > 100) {
+		reasons = append(reasons, "packet_loss is outside 0-100")
+	}
+
+	return reasons
+}
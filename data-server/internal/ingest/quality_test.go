@@ -0,0 +1,227 @@
+package ingest
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"mark7888/speedtest-data-server/internal/config"
+	"mark7888/speedtest-data-server/internal/db"
+	"mark7888/speedtest-data-server/internal/db/sqlite"
+	"mark7888/speedtest-data-server/internal/logger"
+	"mark7888/speedtest-data-server/pkg/models"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// testConfig returns the settings the ingest tests run with
+func testConfig() *config.Config {
+	cfg := &config.Config{}
+	cfg.Node.ClockSkewThreshold = 5 * time.Second
+	cfg.Node.MaxFutureSkew = 5 * time.Minute
+	cfg.Quality.Action = qualityActionQuarantine
+	cfg.Quality.MaxBandwidthMbps = 1000
+	cfg.Quality.MaxLatencyMs = 1000
+	return cfg
+}
+
+// newTestService creates a service backed by a fresh SQLite database
+func newTestService(t *testing.T, cfg *config.Config) (*Service, db.Database) {
+	t.Helper()
+	logger.Log = zap.NewNop()
+
+	cfg.Database.Type = "sqlite"
+	cfg.Database.Path = filepath.Join(t.TempDir(), "test.db")
+	database, err := sqlite.New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close() })
+	if err := database.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	return NewService(database, cfg), database
+}
+
+// plausibleDetail returns a measurement that passes every check
+func plausibleDetail(timestamp time.Time) models.MeasurementDetail {
+	loss := 0.5
+	return models.MeasurementDetail{
+		Timestamp:  timestamp,
+		Ping:       &models.PingMetrics{Jitter: 1, Latency: 10, Low: 9, High: 12},
+		Download:   &models.TransferMetrics{Bandwidth: 12500000, Bytes: 100000000, Elapsed: 8000},
+		Upload:     &models.TransferMetrics{Bandwidth: 2500000, Bytes: 20000000, Elapsed: 8000},
+		PacketLoss: &loss,
+	}
+}
+
+func TestPlausibilityCheck(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+
+	tests := []struct {
+		name   string
+		modify func(*models.MeasurementDetail)
+		want   []string
+	}{
+		{
+			name:   "plausible",
+			modify: func(*models.MeasurementDetail) {},
+		},
+		{
+			name:   "download above max bandwidth",
+			modify: func(d *models.MeasurementDetail) { d.Download.Bandwidth = 1000*1000*1000/8 + 1 },
+			want:   []string{"download_bandwidth exceeds 1000 Mbps"},
+		},
+		{
+			name:   "download at max bandwidth",
+			modify: func(d *models.MeasurementDetail) { d.Download.Bandwidth = 1000 * 1000 * 1000 / 8 },
+		},
+		{
+			name:   "negative upload",
+			modify: func(d *models.MeasurementDetail) { d.Upload.Bandwidth = -1 },
+			want:   []string{"upload_bandwidth is negative"},
+		},
+		{
+			name:   "negative byte counter and elapsed",
+			modify: func(d *models.MeasurementDetail) { d.Download.Bytes = -1; d.Upload.Elapsed = -1 },
+			want:   []string{"download_bytes is negative", "upload_elapsed is negative"},
+		},
+		{
+			name:   "ping above max latency",
+			modify: func(d *models.MeasurementDetail) { d.Ping.Latency = 1001 },
+			want:   []string{"ping_latency exceeds 1000 ms"},
+		},
+		{
+			name:   "negative jitter",
+			modify: func(d *models.MeasurementDetail) { d.Ping.Jitter = -0.1 },
+			want:   []string{"ping_jitter is negative"},
+		},
+		{
+			name: "transfer latency above max",
+			modify: func(d *models.MeasurementDetail) {
+				d.Download.Latency = &models.LatencyMetrics{Iqm: 5000}
+			},
+			want: []string{"download_latency_iqm exceeds 1000 ms"},
+		},
+		{
+			name:   "packet loss above 100",
+			modify: func(d *models.MeasurementDetail) { loss := 100.1; d.PacketLoss = &loss },
+			want:   []string{"packet_loss is outside 0-100"},
+		},
+		{
+			name:   "missing sections are not checked",
+			modify: func(d *models.MeasurementDetail) { d.Ping, d.Download, d.Upload, d.PacketLoss = nil, nil, nil, nil },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			detail := plausibleDetail(now)
+			tt.modify(&detail)
+
+			check := &plausibilityCheck{
+				maxBandwidth: 1000 * 1000 * 1000 / 8,
+				maxLatency:   1000,
+				seen:         make(map[int64]bool),
+			}
+			got := check.check(convertToMeasurement(uuid.New(), &detail))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("reasons = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlausibilityCheckBatch(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	check := &plausibilityCheck{
+		maxBandwidth: 1000 * 1000 * 1000 / 8,
+		maxLatency:   1000,
+		oldest:       now.AddDate(0, 0, -30),
+		seen:         make(map[int64]bool),
+	}
+
+	tests := []struct {
+		name      string
+		timestamp time.Time
+		want      []string
+	}{
+		{name: "first in batch", timestamp: now},
+		{name: "duplicate timestamp", timestamp: now, want: []string{"timestamp is duplicated within the batch"}},
+		{name: "other timestamp", timestamp: now.Add(-time.Hour)},
+		{name: "older than retention", timestamp: now.AddDate(0, 0, -31), want: []string{"timestamp is older than the retention period"}},
+	}
+
+	// The cases share one check, as the measurements of a batch do
+	for _, tt := range tests {
+		detail := plausibleDetail(tt.timestamp)
+		got := check.check(convertToMeasurement(uuid.New(), &detail))
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: reasons = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSubmitMeasurementsQualityAction(t *testing.T) {
+	tests := []struct {
+		action          string
+		wantInserted    int
+		wantRejected    int
+		wantQuarantined int
+	}{
+		{action: qualityActionQuarantine, wantInserted: 1, wantQuarantined: 1},
+		{action: qualityActionReject, wantInserted: 1, wantRejected: 1},
+		{action: qualityActionAccept, wantInserted: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.action, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.Quality.Action = tt.action
+			service, database := newTestService(t, cfg)
+			ctx := context.Background()
+
+			now := time.Now().Truncate(time.Second)
+			implausible := plausibleDetail(now.Add(-time.Minute))
+			implausible.Download.Bandwidth = -1
+
+			nodeID := uuid.New()
+			resp, err := service.SubmitMeasurements(ctx, &models.MeasurementRequest{
+				NodeID:       nodeID,
+				NodeName:     "test node",
+				Measurements: []models.MeasurementDetail{plausibleDetail(now), implausible},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if resp.Received != 2 || resp.Inserted != tt.wantInserted || resp.Rejected != tt.wantRejected ||
+				resp.Quarantined != tt.wantQuarantined || resp.Failed != 0 {
+				t.Errorf("response = %+v", resp)
+			}
+
+			quarantined, total, err := database.GetQuarantinedMeasurements(ctx, &nodeID, 1, 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if total != tt.wantQuarantined {
+				t.Fatalf("quarantined %d measurements, want %d", total, tt.wantQuarantined)
+			}
+			if total > 0 && !reflect.DeepEqual(quarantined[0].Reasons, []string{"download_bandwidth is negative"}) {
+				t.Errorf("quarantine reasons = %q", quarantined[0].Reasons)
+			}
+
+			stored, count, err := database.GetMeasurementsByNode(ctx, nodeID, nil, nil, 1, 10, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if count != tt.wantInserted || len(stored) != tt.wantInserted {
+				t.Errorf("stored %d measurements, want %d", count, tt.wantInserted)
+			}
+		})
+	}
+}
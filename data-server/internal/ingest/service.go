@@ -0,0 +1,496 @@
+package ingest
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"mark7888/speedtest-data-server/internal/config"
+	"mark7888/speedtest-data-server/internal/db"
+	"mark7888/speedtest-data-server/internal/logger"
+	"mark7888/speedtest-data-server/internal/metrics"
+	"mark7888/speedtest-data-server/internal/tracing"
+	"mark7888/speedtest-data-server/pkg/models"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.uber.org/zap"
+)
+
+// Service implements node ingestion independently of the transport, so the
+// REST handlers and the gRPC server share the same semantics
+type Service struct {
+	db     db.Database
+	config *config.Config
+}
+
+// NewService creates a new ingestion service
+func NewService(database db.Database, cfg *config.Config) *Service {
+	return &Service{
+		db:     database,
+		config: cfg,
+	}
+}
+
+// startSpan traces one ingestion call. Database queries made with the
+// returned context are children of the span.
+func startSpan(ctx context.Context, name string, nodeID uuid.UUID) (context.Context, func()) {
+	ctx, span := tracing.Start(ctx, "ingest."+name)
+	span.SetAttributes(attribute.String("node.id", nodeID.String()))
+
+	return ctx, func() { span.End() }
+}
+
+// Alive registers a node (or refreshes it) in response to an alive signal and
+// hands over any commands queued for it. Transports that cannot return a
+// response to the node should use RecordAlive instead.
+func (s *Service) Alive(ctx context.Context, req *models.AliveRequest) (*models.AliveResponse, error) {
+	ctx, end := startSpan(ctx, "Alive", req.NodeID)
+	defer end()
+
+	receivedAt := time.Now()
+
+	if err := s.RecordAlive(ctx, req); err != nil {
+		return nil, err
+	}
+
+	response := &models.AliveResponse{
+		Status:         "ok",
+		NodeRegistered: true,
+		RequestTime:    req.Timestamp,
+		ReceiveTime:    receivedAt,
+	}
+
+	// Hand out the node's settings when it runs an outdated version. Nodes
+	// that do not report a version predate remote configuration.
+	if config, err := s.ResolveNodeConfig(ctx, req.NodeID); err != nil {
+		logger.FromContext(ctx).Error("Failed to resolve node config",
+			zap.Error(err),
+			zap.String("node_id", req.NodeID.String()),
+		)
+	} else {
+		response.ConfigVersion = &config.Version
+		if req.ConfigVersion != nil && *req.ConfigVersion != config.Version && config.Version != "" {
+			response.Config = &config.Effective
+		}
+	}
+
+	// A failure here must not fail the heartbeat; the commands stay pending
+	// and are delivered with the next alive
+	commands, err := s.db.ClaimPendingCommands(ctx, req.NodeID)
+	if err != nil {
+		logger.FromContext(ctx).Error("Failed to claim pending commands",
+			zap.Error(err),
+			zap.String("node_id", req.NodeID.String()),
+		)
+	}
+	for _, command := range commands {
+		response.Commands = append(response.Commands, models.PendingCommand{
+			ID:      command.ID,
+			Command: command.Command,
+		})
+		logger.FromContext(ctx).Info("Delivered command to node",
+			zap.String("node_id", req.NodeID.String()),
+			zap.String("command_id", command.ID.String()),
+			zap.String("command", command.Command),
+		)
+	}
+
+	// Taken last so the node can tell the time spent here from the network delay
+	response.ServerTime = time.Now()
+
+	return response, nil
+}
+
+// RecordAlive registers a node (or refreshes it) without delivering commands
+func (s *Service) RecordAlive(ctx context.Context, req *models.AliveRequest) error {
+	ctx, end := startSpan(ctx, "RecordAlive", req.NodeID)
+	defer end()
+
+	if err := s.Authorize(ctx, models.APIKeyScopeAlive, req.NodeID); err != nil {
+		return err
+	}
+
+	// Upsert node (create if doesn't exist, update if it does)
+	if err := s.db.UpsertNode(ctx, req.NodeID, req.NodeName, req.Location); err != nil {
+		return fmt.Errorf("failed to register node: %w", err)
+	}
+
+	if req.ConfigVersion != nil {
+		if err := s.db.UpdateNodeConfigVersion(ctx, req.NodeID, *req.ConfigVersion); err != nil {
+			logger.FromContext(ctx).Error("Failed to record node config version",
+				zap.Error(err),
+				zap.String("node_id", req.NodeID.String()),
+			)
+		}
+	}
+
+	if req.ClockOffsetMs != nil {
+		if err := s.db.UpdateNodeClockOffset(ctx, req.NodeID, *req.ClockOffsetMs); err != nil {
+			logger.FromContext(ctx).Error("Failed to record node clock offset",
+				zap.Error(err),
+				zap.String("node_id", req.NodeID.String()),
+			)
+		}
+	}
+
+	if req.Inventory != nil {
+		if err := s.db.UpsertNodeInventory(ctx, req.NodeID, req.Inventory); err != nil {
+			logger.FromContext(ctx).Error("Failed to record node inventory",
+				zap.Error(err),
+				zap.String("node_id", req.NodeID.String()),
+			)
+		}
+	}
+
+	metrics.AliveSignals.Inc()
+
+	logger.FromContext(ctx).Info("Node alive signal received",
+		zap.String("node_id", req.NodeID.String()),
+		zap.String("node_name", req.NodeName),
+	)
+
+	return nil
+}
+
+// ResolveNodeConfig combines the fleet default and the node's own overrides
+// into the settings the node should run
+func (s *Service) ResolveNodeConfig(ctx context.Context, nodeID uuid.UUID) (*models.NodeConfigResponse, error) {
+	defaults, err := s.db.GetNodeConfig(ctx, models.NodeConfigScopeDefault)
+	if err != nil {
+		return nil, err
+	}
+	override, err := s.db.GetNodeConfig(ctx, nodeID.String())
+	if err != nil {
+		return nil, err
+	}
+
+	config := &models.NodeConfigResponse{NodeID: nodeID}
+	if defaults != nil {
+		config.Default = defaults.Settings
+	}
+	if override != nil {
+		config.Override = override.Settings
+	}
+	config.Effective = config.Default.Merge(config.Override)
+	config.Version = config.Effective.Version()
+
+	return config, nil
+}
+
+// NodeStats returns a node's own statistics
+func (s *Service) NodeStats(ctx context.Context, nodeID uuid.UUID) (*models.NodeWithStats, error) {
+	ctx, end := startSpan(ctx, "NodeStats", nodeID)
+	defer end()
+
+	if err := s.Authorize(ctx, models.APIKeyScopeStatsRead, nodeID); err != nil {
+		return nil, err
+	}
+
+	return s.db.GetNodeWithStats(ctx, nodeID)
+}
+
+// ReportCommandResult records a node's progress on a queued command
+func (s *Service) ReportCommandResult(ctx context.Context, commandID uuid.UUID, req *models.CommandResultRequest) (*models.CommandResultResponse, error) {
+	ctx, end := startSpan(ctx, "ReportCommandResult", req.NodeID)
+	defer end()
+
+	if err := s.Authorize(ctx, models.APIKeyScopeAlive, req.NodeID); err != nil {
+		return nil, err
+	}
+
+	// The measurement was stored with a corrected timestamp, so correct this
+	// one the same way for the two to match up. A timestamp too far in the
+	// future belongs to a measurement that was deferred, not stored, so
+	// there is nothing to link yet.
+	if req.MeasurementTimestamp != nil {
+		if _, _, ok := s.clockCheck(ctx, req.NodeID).apply(req.MeasurementTimestamp, req.ClockOffsetMs); !ok {
+			logger.FromContext(ctx).Warn("Ignoring command measurement timestamped in the future",
+				zap.String("node_id", req.NodeID.String()),
+				zap.String("command_id", commandID.String()),
+				zap.Time("timestamp", *req.MeasurementTimestamp),
+			)
+			req.MeasurementTimestamp = nil
+		}
+	}
+
+	status := models.NodeCommandStatus(req.Status)
+	if err := s.db.UpdateNodeCommandStatus(ctx, commandID, req.NodeID, status, req.ErrorMessage, req.MeasurementTimestamp); err != nil {
+		return nil, err
+	}
+
+	logger.FromContext(ctx).Info("Node command status reported",
+		zap.String("node_id", req.NodeID.String()),
+		zap.String("command_id", commandID.String()),
+		zap.String("status", req.Status),
+	)
+
+	return &models.CommandResultResponse{Status: "ok"}, nil
+}
+
+// SubmitMeasurements stores a batch of measurements from a node.
+// Individual insert failures are counted rather than failing the whole batch.
+func (s *Service) SubmitMeasurements(ctx context.Context, req *models.MeasurementRequest) (*models.MeasurementResponse, error) {
+	ctx, end := startSpan(ctx, "SubmitMeasurements", req.NodeID)
+	defer end()
+
+	if err := s.Authorize(ctx, models.APIKeyScopeIngest, req.NodeID); err != nil {
+		return nil, err
+	}
+
+	// Ensure node exists
+	if err := s.db.UpsertNode(ctx, req.NodeID, req.NodeName, nil); err != nil {
+		return nil, fmt.Errorf("failed to register node: %w", err)
+	}
+
+	// Process each measurement
+	received := len(req.Measurements)
+	inserted := 0
+	updated := 0
+	failed := 0
+	rejected := 0
+	quarantined := 0
+	var deferred []int64
+
+	clock := s.clockCheck(ctx, req.NodeID)
+	plausibility := s.plausibilityCheck()
+
+	for _, detail := range req.Measurements {
+		measurement := convertToMeasurement(req.NodeID, &detail)
+
+		var ok bool
+		measurement.ClockSkewMs, measurement.OriginalTimestamp, ok = clock.apply(&measurement.Timestamp, detail.ClockOffsetMs)
+		if !ok {
+			logger.FromContext(ctx).Warn("Rejected measurement timestamped in the future",
+				zap.String("node_id", req.NodeID.String()),
+				zap.Time("timestamp", measurement.Timestamp),
+			)
+			rejected++
+			if detail.LocalID != nil {
+				deferred = append(deferred, *detail.LocalID)
+			}
+			continue
+		}
+
+		if reasons := plausibility.check(measurement); len(reasons) > 0 {
+			logger.FromContext(ctx).Warn("Implausible measurement",
+				zap.String("node_id", req.NodeID.String()),
+				zap.Time("timestamp", measurement.Timestamp),
+				zap.Strings("reasons", reasons),
+				zap.String("action", s.config.Quality.Action),
+			)
+
+			switch s.config.Quality.Action {
+			case qualityActionReject:
+				rejected++
+				continue
+			case qualityActionQuarantine:
+				if err := s.db.QuarantineMeasurement(ctx, measurement, reasons); err != nil {
+					logger.FromContext(ctx).Error("Failed to quarantine measurement",
+						zap.Error(err),
+						zap.String("node_id", req.NodeID.String()),
+						zap.Time("timestamp", measurement.Timestamp),
+					)
+					failed++
+				} else {
+					quarantined++
+				}
+				continue
+			case qualityActionAccept:
+				// Stored like any other measurement
+			}
+		}
+
+		err := s.db.InsertMeasurement(ctx, measurement)
+		if err != nil {
+			logger.FromContext(ctx).Error("Failed to insert measurement",
+				zap.Error(err),
+				zap.String("node_id", req.NodeID.String()),
+				zap.Time("timestamp", detail.Timestamp),
+			)
+			failed++
+		} else {
+			// We can't easily tell if it was inserted or updated without checking beforehand
+			// For simplicity, count as inserted
+			inserted++
+		}
+	}
+
+	logger.FromContext(ctx).Info("Measurements processed",
+		zap.String("node_id", req.NodeID.String()),
+		zap.Int("received", received),
+		zap.Int("inserted", inserted),
+		zap.Int("failed", failed),
+		zap.Int("rejected", rejected),
+		zap.Int("quarantined", quarantined),
+	)
+
+	metrics.IngestedMeasurements.WithLabelValues("inserted").Add(float64(inserted))
+	metrics.IngestedMeasurements.WithLabelValues("failed").Add(float64(failed))
+	metrics.IngestedMeasurements.WithLabelValues("rejected").Add(float64(rejected))
+	metrics.IngestedMeasurements.WithLabelValues("quarantined").Add(float64(quarantined))
+
+	return &models.MeasurementResponse{
+		Status:      "ok",
+		Received:    received,
+		Inserted:    inserted,
+		Updated:     updated,
+		Failed:      failed,
+		Rejected:    rejected,
+		Quarantined: quarantined,
+		Deferred:    deferred,
+	}, nil
+}
+
+// SubmitFailedMeasurements records a batch of failed test attempts from a node
+func (s *Service) SubmitFailedMeasurements(ctx context.Context, req *models.FailedMeasurementRequest) (*models.FailedMeasurementResponse, error) {
+	ctx, end := startSpan(ctx, "SubmitFailedMeasurements", req.NodeID)
+	defer end()
+
+	if err := s.Authorize(ctx, models.APIKeyScopeIngest, req.NodeID); err != nil {
+		return nil, err
+	}
+
+	// Ensure node exists
+	if err := s.db.UpsertNode(ctx, req.NodeID, req.NodeName, nil); err != nil {
+		return nil, fmt.Errorf("failed to register node: %w", err)
+	}
+
+	// Process each failed test
+	received := len(req.FailedTests)
+	inserted := 0
+	failed := 0
+	rejected := 0
+	var deferred []int64
+
+	clock := s.clockCheck(ctx, req.NodeID)
+
+	for _, failedTest := range req.FailedTests {
+		failedMeasurement := &models.FailedMeasurement{
+			NodeID:       req.NodeID,
+			Timestamp:    failedTest.Timestamp,
+			ErrorMessage: &failedTest.ErrorMessage,
+			RetryCount:   failedTest.RetryCount,
+		}
+
+		var ok bool
+		failedMeasurement.ClockSkewMs, failedMeasurement.OriginalTimestamp, ok = clock.apply(&failedMeasurement.Timestamp, failedTest.ClockOffsetMs)
+		if !ok {
+			logger.FromContext(ctx).Warn("Rejected failed measurement timestamped in the future",
+				zap.String("node_id", req.NodeID.String()),
+				zap.Time("timestamp", failedMeasurement.Timestamp),
+			)
+			rejected++
+			if failedTest.LocalID != nil {
+				deferred = append(deferred, *failedTest.LocalID)
+			}
+			continue
+		}
+
+		err := s.db.InsertFailedMeasurement(ctx, failedMeasurement)
+		if err != nil {
+			logger.FromContext(ctx).Error("Failed to insert failed measurement",
+				zap.Error(err),
+				zap.String("node_id", req.NodeID.String()),
+			)
+			failed++
+		} else {
+			inserted++
+		}
+	}
+
+	logger.FromContext(ctx).Info("Failed measurements recorded",
+		zap.String("node_id", req.NodeID.String()),
+		zap.Int("count", received),
+		zap.Int("rejected", rejected),
+	)
+
+	metrics.IngestedFailedMeasurements.WithLabelValues("inserted").Add(float64(inserted))
+	metrics.IngestedFailedMeasurements.WithLabelValues("failed").Add(float64(failed))
+	metrics.IngestedFailedMeasurements.WithLabelValues("rejected").Add(float64(rejected))
+
+	return &models.FailedMeasurementResponse{
+		Status:   "ok",
+		Received: received,
+		Rejected: rejected,
+		Deferred: deferred,
+	}, nil
+}
+
+// convertToMeasurement converts MeasurementDetail to Measurement model
+func convertToMeasurement(nodeID uuid.UUID, detail *models.MeasurementDetail) *models.Measurement {
+	m := &models.Measurement{
+		NodeID:    nodeID,
+		Timestamp: detail.Timestamp,
+	}
+
+	// Ping
+	if detail.Ping != nil {
+		m.PingJitter = &detail.Ping.Jitter
+		m.PingLatency = &detail.Ping.Latency
+		m.PingLow = &detail.Ping.Low
+		m.PingHigh = &detail.Ping.High
+	}
+
+	// Download
+	if detail.Download != nil {
+		m.DownloadBandwidth = &detail.Download.Bandwidth
+		m.DownloadBytes = &detail.Download.Bytes
+		m.DownloadElapsed = &detail.Download.Elapsed
+
+		if detail.Download.Latency != nil {
+			m.DownloadLatencyIqm = &detail.Download.Latency.Iqm
+			m.DownloadLatencyLow = &detail.Download.Latency.Low
+			m.DownloadLatencyHigh = &detail.Download.Latency.High
+			m.DownloadLatencyJitter = &detail.Download.Latency.Jitter
+		}
+	}
+
+	// Upload
+	if detail.Upload != nil {
+		m.UploadBandwidth = &detail.Upload.Bandwidth
+		m.UploadBytes = &detail.Upload.Bytes
+		m.UploadElapsed = &detail.Upload.Elapsed
+
+		if detail.Upload.Latency != nil {
+			m.UploadLatencyIqm = &detail.Upload.Latency.Iqm
+			m.UploadLatencyLow = &detail.Upload.Latency.Low
+			m.UploadLatencyHigh = &detail.Upload.Latency.High
+			m.UploadLatencyJitter = &detail.Upload.Latency.Jitter
+		}
+	}
+
+	// Packet loss
+	m.PacketLoss = detail.PacketLoss
+
+	// ISP
+	m.ISP = detail.ISP
+
+	// Interface
+	if detail.Interface != nil {
+		m.InterfaceInternalIP = &detail.Interface.InternalIP
+		m.InterfaceName = &detail.Interface.Name
+		m.InterfaceMacAddr = &detail.Interface.MacAddr
+		m.InterfaceIsVPN = &detail.Interface.IsVPN
+		m.InterfaceExternalIP = &detail.Interface.ExternalIP
+	}
+
+	// Server
+	if detail.Server != nil {
+		m.ServerID = &detail.Server.ID
+		m.ServerHost = &detail.Server.Host
+		m.ServerPort = &detail.Server.Port
+		m.ServerName = &detail.Server.Name
+		m.ServerLocation = &detail.Server.Location
+		m.ServerCountry = &detail.Server.Country
+		m.ServerIP = &detail.Server.IP
+	}
+
+	// Result
+	if detail.Result != nil {
+		m.ResultID = &detail.Result.ID
+		m.ResultURL = &detail.Result.URL
+	}
+
+	return m
+}
@@ -0,0 +1,197 @@
+package ingest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"mark7888/speedtest-data-server/pkg/models"
+
+	"github.com/google/uuid"
+)
+
+func TestAliveConfigDelivery(t *testing.T) {
+	service, database := newTestService(t, testConfig())
+	ctx := context.Background()
+
+	cron := "*/5 * * * *"
+	config, err := database.SetNodeConfig(ctx, models.NodeConfigScopeDefault, models.NodeSettings{SpeedtestCron: &cron}, "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	current := config.Settings.Version()
+	stale := "0123456789abcdef"
+	none := ""
+
+	tests := []struct {
+		name        string
+		nodeVersion *string
+		wantConfig  bool
+	}{
+		{name: "node predates remote config", nodeVersion: nil},
+		{name: "node up to date", nodeVersion: &current},
+		{name: "node on a stale version", nodeVersion: &stale, wantConfig: true},
+		{name: "node without server settings", nodeVersion: &none, wantConfig: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := service.Alive(ctx, &models.AliveRequest{
+				NodeID:        uuid.New(),
+				NodeName:      "test node",
+				Timestamp:     time.Now(),
+				ConfigVersion: tt.nodeVersion,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if resp.ConfigVersion == nil || *resp.ConfigVersion != current {
+				t.Errorf("config version = %v, want %q", resp.ConfigVersion, current)
+			}
+			if (resp.Config != nil) != tt.wantConfig {
+				t.Fatalf("config sent = %v, want %v", resp.Config != nil, tt.wantConfig)
+			}
+			if resp.Config != nil && (resp.Config.SpeedtestCron == nil || *resp.Config.SpeedtestCron != cron) {
+				t.Errorf("config = %+v, want the fleet default", resp.Config)
+			}
+		})
+	}
+}
+
+func TestResolveNodeConfig(t *testing.T) {
+	service, database := newTestService(t, testConfig())
+	ctx := context.Background()
+
+	nodeID := uuid.New()
+	hourly, fiveMinutes := "0 * * * *", "*/5 * * * *"
+	batch := 25
+
+	if _, err := database.SetNodeConfig(ctx, models.NodeConfigScopeDefault, models.NodeSettings{SpeedtestCron: &hourly, BatchSize: &batch}, "admin"); err != nil {
+		t.Fatal(err)
+	}
+	before, err := service.ResolveNodeConfig(ctx, nodeID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := database.SetNodeConfig(ctx, nodeID.String(), models.NodeSettings{SpeedtestCron: &fiveMinutes}, "admin"); err != nil {
+		t.Fatal(err)
+	}
+	after, err := service.ResolveNodeConfig(ctx, nodeID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if *after.Effective.SpeedtestCron != fiveMinutes || *after.Effective.BatchSize != batch {
+		t.Errorf("effective settings = %+v, want the override over the default", after.Effective)
+	}
+	if after.Version == before.Version {
+		t.Error("version did not change with the node override")
+	}
+	if after.Version != after.Effective.Version() {
+		t.Errorf("version %q does not match the effective settings", after.Version)
+	}
+
+	other, err := service.ResolveNodeConfig(ctx, uuid.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.Version != before.Version {
+		t.Error("another node's override changed this node's version")
+	}
+}
+
+func TestCommandLifecycle(t *testing.T) {
+	service, database := newTestService(t, testConfig())
+	ctx := context.Background()
+
+	nodeID := uuid.New()
+	alive := func() *models.AliveResponse {
+		t.Helper()
+		resp, err := service.Alive(ctx, &models.AliveRequest{NodeID: nodeID, NodeName: "test node", Timestamp: time.Now()})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	report := func(id uuid.UUID, reporter uuid.UUID, status models.NodeCommandStatus) error {
+		_, err := service.ReportCommandResult(ctx, id, &models.CommandResultRequest{
+			NodeID: reporter,
+			Status: string(status),
+		})
+		return err
+	}
+	status := func(id uuid.UUID) models.NodeCommandStatus {
+		t.Helper()
+		command, err := database.GetNodeCommand(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return command.Status
+	}
+
+	alive() // registers the node
+	command, err := database.CreateNodeCommand(ctx, nodeID, models.NodeCommandRunTest, "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := status(command.ID); got != models.NodeCommandStatusPending {
+		t.Fatalf("new command is %s, want pending", got)
+	}
+
+	// Delivered exactly once
+	if resp := alive(); len(resp.Commands) != 1 || resp.Commands[0].ID != command.ID {
+		t.Fatalf("alive delivered %+v, want the queued command", resp.Commands)
+	}
+	if resp := alive(); len(resp.Commands) != 0 {
+		t.Fatalf("alive delivered %+v again", resp.Commands)
+	}
+
+	steps := []struct {
+		name     string
+		reporter uuid.UUID
+		status   models.NodeCommandStatus
+		wantErr  bool
+		want     models.NodeCommandStatus
+	}{
+		{name: "delivered", want: models.NodeCommandStatusDelivered},
+		{name: "another node cannot report", reporter: uuid.New(), status: models.NodeCommandStatusRunning, wantErr: true, want: models.NodeCommandStatusDelivered},
+		{name: "running", reporter: nodeID, status: models.NodeCommandStatusRunning, want: models.NodeCommandStatusRunning},
+		{name: "completed", reporter: nodeID, status: models.NodeCommandStatusCompleted, want: models.NodeCommandStatusCompleted},
+		{name: "final state is kept", reporter: nodeID, status: models.NodeCommandStatusFailed, wantErr: true, want: models.NodeCommandStatusCompleted},
+	}
+	for _, step := range steps {
+		if step.status != "" {
+			err := report(command.ID, step.reporter, step.status)
+			if (err != nil) != step.wantErr {
+				t.Fatalf("%s: err = %v, want error: %v", step.name, err, step.wantErr)
+			}
+		}
+		if got := status(command.ID); got != step.want {
+			t.Fatalf("%s: command is %s, want %s", step.name, got, step.want)
+		}
+	}
+
+	// Unfinished commands expire; finished ones are left alone
+	stale, err := database.CreateNodeCommand(ctx, nodeID, models.NodeCommandRunTest, "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired, err := database.ExpireNodeCommands(ctx, -time.Minute) // everything still active
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expired != 1 {
+		t.Errorf("expired %d commands, want 1", expired)
+	}
+	if got := status(stale.ID); got != models.NodeCommandStatusExpired {
+		t.Errorf("stale command is %s, want expired", got)
+	}
+	if got := status(command.ID); got != models.NodeCommandStatusCompleted {
+		t.Errorf("completed command is %s after expiry", got)
+	}
+	if resp := alive(); len(resp.Commands) != 0 {
+		t.Errorf("alive delivered expired command %+v", resp.Commands)
+	}
+}
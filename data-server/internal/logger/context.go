@@ -0,0 +1,33 @@
+package logger
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+)
+
+// requestIDKey is the context key under which the request ID is stored
+type requestIDKey struct{}
+
+// WithRequestID returns a copy of ctx carrying the request ID
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// RequestID returns the request ID carried by ctx, or "" if there is none
+func RequestID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
+
+// FromContext returns the global logger, tagged with the request ID when
+// ctx carries one. A nil ctx is allowed.
+func FromContext(ctx context.Context) *zap.Logger {
+	if requestID := RequestID(ctx); requestID != "" {
+		return Log.With(zap.String("request_id", requestID))
+	}
+	return Log
+}
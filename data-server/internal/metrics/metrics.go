@@ -0,0 +1,138 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"mark7888/speedtest-data-server/internal/logger"
+	"mark7888/speedtest-data-server/internal/version"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+)
+
+// Registry holds the server's metrics, served on /metrics
+var Registry = prometheus.NewRegistry()
+
+var factory = promauto.With(Registry)
+
+var (
+	Info = factory.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "speedtest_server_info",
+		Help: "Data server build information, always 1.",
+	}, []string{"version"})
+
+	HTTPRequests = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "speedtest_server_http_requests_total",
+		Help: "HTTP requests handled, by method, route and status code.",
+	}, []string{"method", "route", "status"})
+
+	HTTPRequestDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "speedtest_server_http_request_duration_seconds",
+		Help:    "Time taken to handle HTTP requests, by method and route.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	RateLimitRejections = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "speedtest_server_rate_limit_rejections_total",
+		Help: "Requests rejected by the rate limiter, by transport (http or grpc).",
+	}, []string{"transport"})
+
+	IngestedMeasurements = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "speedtest_server_ingested_measurements_total",
+		Help: "Measurements received from nodes, by result (inserted, failed, rejected or quarantined).",
+	}, []string{"result"})
+
+	IngestedFailedMeasurements = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "speedtest_server_ingested_failed_measurements_total",
+		Help: "Failed test reports received from nodes, by result (inserted, failed or rejected).",
+	}, []string{"result"})
+
+	AliveSignals = factory.NewCounter(prometheus.CounterOpts{
+		Name: "speedtest_server_alive_signals_total",
+		Help: "Alive signals received from nodes.",
+	})
+
+	DBQueryDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "speedtest_server_db_query_duration_seconds",
+		Help:    "Time taken by database operations, by backend and operation.",
+		Buckets: []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+	}, []string{"backend", "operation"})
+
+	ServiceRuns = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "speedtest_server_service_runs_total",
+		Help: "Background service runs, by service and result (success or failure).",
+	}, []string{"service", "result"})
+
+	ServiceRunDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "speedtest_server_service_run_duration_seconds",
+		Help:    "Time taken by background service runs, by service.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"service"})
+
+	ServiceLastRun = factory.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "speedtest_server_service_last_run_timestamp_seconds",
+		Help: "Unix time a background service last finished a run, by service.",
+	}, []string{"service"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	Info.WithLabelValues(version.Get()).Set(1)
+}
+
+// ObserveServiceRun records a background service run that started at started
+func ObserveServiceRun(service string, started time.Time, err error) {
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+
+	ServiceRuns.WithLabelValues(service, result).Inc()
+	ServiceRunDuration.WithLabelValues(service).Observe(time.Since(started).Seconds())
+	ServiceLastRun.WithLabelValues(service).SetToCurrentTime()
+}
+
+// NodeCountsFunc returns the number of nodes in each status
+type NodeCountsFunc func(ctx context.Context) (total, active, unreachable, inactive int, err error)
+
+// nodeCountsCollector reads node counts from the database at scrape time
+type nodeCountsCollector struct {
+	counts NodeCountsFunc
+	desc   *prometheus.Desc
+}
+
+// RegisterNodeCounts exports node counts by status, read on every scrape
+func RegisterNodeCounts(counts NodeCountsFunc) {
+	Registry.MustRegister(&nodeCountsCollector{
+		counts: counts,
+		desc: prometheus.NewDesc(
+			"speedtest_server_nodes",
+			"Nodes known to the server, by status.",
+			[]string{"status"}, nil,
+		),
+	})
+}
+
+// Describe implements prometheus.Collector
+func (c *nodeCountsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+// Collect implements prometheus.Collector
+func (c *nodeCountsCollector) Collect(ch chan<- prometheus.Metric) {
+	_, active, unreachable, inactive, err := c.counts(context.Background())
+	if err != nil {
+		logger.Log.Warn("Failed to count nodes for metrics", zap.Error(err))
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(active), "active")
+	ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(unreachable), "unreachable")
+	ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(inactive), "inactive")
+}
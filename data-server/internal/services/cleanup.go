@@ -7,6 +7,7 @@ import (
 	"mark7888/speedtest-data-server/internal/config"
 	"mark7888/speedtest-data-server/internal/db"
 	"mark7888/speedtest-data-server/internal/logger"
+	"mark7888/speedtest-data-server/internal/metrics"
 
 	"go.uber.org/zap"
 )
@@ -67,22 +68,36 @@ func (cs *CleanupService) Stop() {
 // runCleanup performs the actual cleanup
 func (cs *CleanupService) runCleanup() {
 	logger.Log.Info("Running data cleanup")
+	started := time.Now()
+	var runErr error
 
 	// Cleanup old measurements
-	deletedMeasurements, err := cs.db.CleanupOldMeasurements(cs.config.Retention.MeasurementsDays)
+	deletedMeasurements, err := cs.db.CleanupOldMeasurements(cs.ctx, cs.config.Retention.MeasurementsDays)
 	if err != nil {
 		logger.Log.Error("Failed to cleanup measurements", zap.Error(err))
+		runErr = err
 	} else if deletedMeasurements > 0 {
 		logger.Log.Info("Cleaned up measurements", zap.Int64("deleted", deletedMeasurements))
 	}
 
 	// Cleanup old failed measurements
-	deletedFailed, err := cs.db.CleanupOldFailedMeasurements(cs.config.Retention.FailedDays)
+	deletedFailed, err := cs.db.CleanupOldFailedMeasurements(cs.ctx, cs.config.Retention.FailedDays)
 	if err != nil {
 		logger.Log.Error("Failed to cleanup failed measurements", zap.Error(err))
+		runErr = err
 	} else if deletedFailed > 0 {
 		logger.Log.Info("Cleaned up failed measurements", zap.Int64("deleted", deletedFailed))
 	}
 
+	// Cleanup expired admin sessions
+	deletedSessions, err := cs.db.CleanupExpiredSessions(cs.ctx)
+	if err != nil {
+		logger.Log.Error("Failed to cleanup sessions", zap.Error(err))
+		runErr = err
+	} else if deletedSessions > 0 {
+		logger.Log.Info("Cleaned up expired sessions", zap.Int64("deleted", deletedSessions))
+	}
+
+	metrics.ObserveServiceRun("cleanup", started, runErr)
 	logger.Log.Info("Data cleanup completed")
 }
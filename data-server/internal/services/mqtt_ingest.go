@@ -0,0 +1,239 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"mark7888/speedtest-data-server/internal/auth"
+	"mark7888/speedtest-data-server/internal/config"
+	"mark7888/speedtest-data-server/internal/db"
+	"mark7888/speedtest-data-server/internal/ingest"
+	"mark7888/speedtest-data-server/internal/logger"
+	"mark7888/speedtest-data-server/internal/tracing"
+	"mark7888/speedtest-data-server/pkg/models"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// MQTT ingest topic suffixes, published by nodes as {prefix}/{node_id}/{suffix}
+const (
+	mqttTopicAlive         = "alive"
+	mqttTopicMeasurements  = "measurements"
+	mqttTopicFailed        = "failed"
+	mqttTopicCommandResult = "command_result"
+)
+
+// MQTTIngest subscribes to the node topics on an MQTT broker and feeds the
+// messages into the ingestion service, for sites that can only reach the broker
+type MQTTIngest struct {
+	db     db.Database
+	ingest *ingest.Service
+	config *config.Config
+	client mqtt.Client
+	nonces *auth.NonceCache
+}
+
+// NewMQTTIngest creates a new MQTT ingest bridge
+func NewMQTTIngest(database db.Database, ingestService *ingest.Service, cfg *config.Config) *MQTTIngest {
+	m := &MQTTIngest{
+		db:     database,
+		ingest: ingestService,
+		config: cfg,
+		nonces: auth.NewNonceCache(cfg.MQTT.SignatureTolerance),
+	}
+
+	// Persistent session (CleanSession=false) so QoS 1 messages published
+	// while the server is down are delivered once it reconnects
+	opts := mqtt.NewClientOptions().
+		AddBroker(cfg.MQTT.BrokerURL).
+		SetClientID(cfg.MQTT.ClientID).
+		SetUsername(cfg.MQTT.Username).
+		SetPassword(cfg.MQTT.Password).
+		SetCleanSession(false).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetConnectRetryInterval(10 * time.Second).
+		SetOnConnectHandler(m.onConnect).
+		SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+			logger.Log.Warn("MQTT connection lost", zap.Error(err))
+		})
+
+	m.client = mqtt.NewClient(opts)
+	return m
+}
+
+// Start connects to the broker. Subscriptions are (re)established in the
+// connect handler, so reconnects restore them automatically.
+func (m *MQTTIngest) Start() {
+	logger.Log.Info("Starting MQTT ingest",
+		zap.String("broker", m.config.MQTT.BrokerURL),
+		zap.String("client_id", m.config.MQTT.ClientID),
+		zap.String("topic_prefix", m.config.MQTT.TopicPrefix),
+	)
+
+	// With ConnectRetry enabled this returns immediately and keeps retrying
+	// in the background if the broker is unreachable
+	m.client.Connect()
+}
+
+// Stop disconnects from the broker
+func (m *MQTTIngest) Stop() {
+	logger.Log.Info("Stopping MQTT ingest")
+	m.client.Disconnect(1000)
+}
+
+// onConnect subscribes to the node topics
+func (m *MQTTIngest) onConnect(client mqtt.Client) {
+	topic := m.config.MQTT.TopicPrefix + "/+/+"
+	token := client.Subscribe(topic, 1, m.handleMessage)
+	if !token.WaitTimeout(10 * time.Second) {
+		logger.Log.Error("Timed out subscribing to MQTT topic", zap.String("topic", topic))
+		return
+	}
+	if err := token.Error(); err != nil {
+		logger.Log.Error("Failed to subscribe to MQTT topic", zap.String("topic", topic), zap.Error(err))
+		return
+	}
+
+	logger.Log.Info("MQTT ingest subscribed", zap.String("topic", topic))
+}
+
+// handleMessage authenticates and ingests a single message.
+// Invalid messages are logged and dropped; they are still acknowledged so the
+// broker does not redeliver them forever.
+func (m *MQTTIngest) handleMessage(_ mqtt.Client, msg mqtt.Message) {
+	if err := m.processMessage(msg.Topic(), msg.Payload()); err != nil {
+		logger.Log.Warn("Dropped MQTT message",
+			zap.String("topic", msg.Topic()),
+			zap.Error(err),
+		)
+	}
+}
+
+// processMessage parses the topic and envelope and dispatches to the ingest service
+func (m *MQTTIngest) processMessage(topic string, data []byte) error {
+	// Topic layout: {prefix}/{node_id}/{kind}
+	parts := strings.Split(strings.TrimPrefix(topic, m.config.MQTT.TopicPrefix+"/"), "/")
+	if len(parts) != 2 {
+		return fmt.Errorf("unexpected topic layout")
+	}
+	topicNodeID, err := uuid.Parse(parts[0])
+	if err != nil {
+		return fmt.Errorf("invalid node ID in topic: %w", err)
+	}
+
+	// MQTT messages carry no trace context, so each one starts a new trace
+	ctx, span := tracing.Start(context.Background(), "mqtt."+parts[1], trace.WithSpanKind(trace.SpanKindConsumer))
+	defer span.End()
+
+	var envelope models.MQTTMessage
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return fmt.Errorf("invalid message: %w", err)
+	}
+	if err := binding.Validator.ValidateStruct(&envelope); err != nil {
+		return fmt.Errorf("invalid message: %w", err)
+	}
+
+	// Verify the signature like SignedRequestAuth does for HTTP. The topic
+	// is signed, so a message cannot be moved to another node's topic.
+	signedAt, err := auth.CheckSignatureTimestamp(envelope.Timestamp, time.Now(), m.config.MQTT.SignatureTolerance)
+	if err != nil {
+		return err
+	}
+	if err := auth.CheckSignatureNonce(envelope.Nonce); err != nil {
+		return err
+	}
+	apiKey, err := m.db.VerifySignedRequest(ctx, envelope.KeyID, envelope.Signature, func(signingKey []byte) string {
+		return auth.RequestSignature(signingKey, auth.MessageSignatureMethod, topic, envelope.Timestamp, envelope.Nonce, envelope.Payload)
+	})
+	if err != nil {
+		return fmt.Errorf("invalid signature: %w", err)
+	}
+
+	// QoS 1 may deliver a message twice; the copy was already ingested
+	if !m.nonces.Use(envelope.KeyID, envelope.Nonce, signedAt, time.Now()) {
+		return fmt.Errorf("message nonce has already been used")
+	}
+	ctx = auth.WithAPIKey(ctx, apiKey)
+
+	switch parts[1] {
+	case mqttTopicAlive:
+		var req models.AliveRequest
+		if err := decodePayload(envelope.Payload, &req); err != nil {
+			return err
+		}
+		if req.NodeID != topicNodeID {
+			return fmt.Errorf("node ID does not match topic")
+		}
+		err = m.ingest.RecordAlive(ctx, &req)
+	case mqttTopicMeasurements:
+		var req models.MeasurementRequest
+		if err := decodePayload(envelope.Payload, &req); err != nil {
+			return err
+		}
+		if req.NodeID != topicNodeID {
+			return fmt.Errorf("node ID does not match topic")
+		}
+		var response *models.MeasurementResponse
+		response, err = m.ingest.SubmitMeasurements(ctx, &req)
+		if err == nil {
+			m.warnDeferred(req.NodeID, response.Deferred)
+		}
+	case mqttTopicFailed:
+		var req models.FailedMeasurementRequest
+		if err := decodePayload(envelope.Payload, &req); err != nil {
+			return err
+		}
+		if req.NodeID != topicNodeID {
+			return fmt.Errorf("node ID does not match topic")
+		}
+		var response *models.FailedMeasurementResponse
+		response, err = m.ingest.SubmitFailedMeasurements(ctx, &req)
+		if err == nil {
+			m.warnDeferred(req.NodeID, response.Deferred)
+		}
+	case mqttTopicCommandResult:
+		var req models.MQTTCommandResult
+		if err := decodePayload(envelope.Payload, &req); err != nil {
+			return err
+		}
+		if req.NodeID != topicNodeID {
+			return fmt.Errorf("node ID does not match topic")
+		}
+		_, err = m.ingest.ReportCommandResult(ctx, req.CommandID, &req.CommandResultRequest)
+	default:
+		return fmt.Errorf("unknown topic %q", parts[1])
+	}
+
+	return err
+}
+
+// warnDeferred logs results the node would have been asked to send again.
+// MQTT has no way to answer a node, so they are dropped.
+func (m *MQTTIngest) warnDeferred(nodeID uuid.UUID, deferred []int64) {
+	if len(deferred) == 0 {
+		return
+	}
+	logger.Log.Warn("Dropped MQTT results timestamped in the future, check the node clock",
+		zap.String("node_id", nodeID.String()),
+		zap.Int("count", len(deferred)),
+	)
+}
+
+// decodePayload unmarshals and validates a payload using the REST binding rules
+func decodePayload(payload json.RawMessage, out interface{}) error {
+	if err := json.Unmarshal(payload, out); err != nil {
+		return fmt.Errorf("invalid payload: %w", err)
+	}
+	if err := binding.Validator.ValidateStruct(out); err != nil {
+		return fmt.Errorf("invalid payload: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,255 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"mark7888/speedtest-data-server/internal/auth"
+	"mark7888/speedtest-data-server/internal/config"
+	"mark7888/speedtest-data-server/internal/db"
+	"mark7888/speedtest-data-server/internal/db/sqlite"
+	"mark7888/speedtest-data-server/internal/ingest"
+	"mark7888/speedtest-data-server/internal/logger"
+	"mark7888/speedtest-data-server/pkg/models"
+
+	"github.com/google/uuid"
+	mqttserver "github.com/mochi-mqtt/server/v2"
+	mqttauth "github.com/mochi-mqtt/server/v2/hooks/auth"
+	"github.com/mochi-mqtt/server/v2/listeners"
+	"go.uber.org/zap"
+)
+
+// mqttTestEnv is an embedded broker and the database its messages go to
+type mqttTestEnv struct {
+	broker   *mqttserver.Server
+	database db.Database
+	cfg      *config.Config
+}
+
+// newMQTTTestEnv starts an embedded broker on a free local port
+func newMQTTTestEnv(t *testing.T) *mqttTestEnv {
+	t.Helper()
+	logger.Log = zap.NewNop()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	broker := mqttserver.New(&mqttserver.Options{
+		InlineClient: true,
+		Logger:       slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+	if err := broker.AddHook(new(mqttauth.AllowHook), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := broker.AddListener(listeners.NewTCP(listeners.Config{ID: "tcp", Address: addr})); err != nil {
+		t.Fatal(err)
+	}
+	if err := broker.Serve(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { broker.Close() })
+
+	cfg := &config.Config{}
+	cfg.Database.Path = filepath.Join(t.TempDir(), "test.db")
+	cfg.Node.MaxFutureSkew = 5 * time.Minute
+	cfg.Quality.Action = "quarantine"
+	cfg.Quality.MaxBandwidthMbps = 1000
+	cfg.Quality.MaxLatencyMs = 1000
+	cfg.MQTT.BrokerURL = "tcp://" + addr
+	cfg.MQTT.ClientID = "speedtest-data-server"
+	cfg.MQTT.TopicPrefix = "speedtest"
+	cfg.MQTT.SignatureTolerance = time.Hour
+
+	database, err := sqlite.New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close() })
+	if err := database.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	return &mqttTestEnv{broker: broker, database: database, cfg: cfg}
+}
+
+// startIngest connects an ingest bridge to the broker and waits until it
+// has subscribed
+func (e *mqttTestEnv) startIngest(t *testing.T) *MQTTIngest {
+	t.Helper()
+	m := NewMQTTIngest(e.database, ingest.NewService(e.database, e.cfg), e.cfg)
+	m.Start()
+	t.Cleanup(m.Stop)
+
+	waitFor(t, "the ingest subscription", func() bool {
+		subscribers := e.broker.Topics.Subscribers(e.cfg.MQTT.TopicPrefix + "/node/alive")
+		return m.client.IsConnectionOpen() && len(subscribers.Subscriptions) > 0
+	})
+	return m
+}
+
+// createKey creates an API key and returns its plain text
+func (e *mqttTestEnv) createKey(t *testing.T) string {
+	t.Helper()
+	plainKey, err := auth.GenerateAPIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.database.CreateAPIKey(context.Background(), plainKey, models.NewAPIKey{Name: "mqtt node", CreatedBy: "admin"}); err != nil {
+		t.Fatal(err)
+	}
+	return plainKey
+}
+
+// measurementCount returns how many measurements are stored
+func (e *mqttTestEnv) measurementCount(t *testing.T) int64 {
+	t.Helper()
+	total, _, _, err := e.database.GetMeasurementCounts(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return total
+}
+
+// signedMessage builds the envelope a node publishes to topic, signed with
+// plainKey
+func signedMessage(t *testing.T, plainKey, topic string, payload interface{}) []byte {
+	t.Helper()
+	body, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyID, _, _ := strings.Cut(strings.TrimPrefix(plainKey, "sk_live_"), ".")
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	nonce := uuid.NewString()[:32]
+
+	data, err := json.Marshal(models.MQTTMessage{
+		KeyID:     keyID,
+		Timestamp: timestamp,
+		Nonce:     nonce,
+		Signature: auth.RequestSignature(auth.DeriveSigningKey(plainKey), auth.MessageSignatureMethod, topic, timestamp, nonce, body),
+		Payload:   body,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// measurementBatch returns a batch of one plausible measurement
+func measurementBatch(nodeID uuid.UUID) models.MeasurementRequest {
+	loss := 0.5
+	return models.MeasurementRequest{
+		NodeID:   nodeID,
+		NodeName: "mqtt node",
+		Measurements: []models.MeasurementDetail{{
+			Timestamp:  time.Now().Add(-time.Minute).Truncate(time.Second),
+			Ping:       &models.PingMetrics{Jitter: 1, Latency: 10, Low: 9, High: 12},
+			Download:   &models.TransferMetrics{Bandwidth: 12500000, Bytes: 100000000, Elapsed: 8000},
+			Upload:     &models.TransferMetrics{Bandwidth: 2500000, Bytes: 20000000, Elapsed: 8000},
+			PacketLoss: &loss,
+		}},
+	}
+}
+
+// waitFor polls cond until it holds or a few seconds have passed
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestMQTTIngestRejectsMessages(t *testing.T) {
+	env := newMQTTTestEnv(t)
+	m := NewMQTTIngest(env.database, ingest.NewService(env.database, env.cfg), env.cfg)
+	plainKey := env.createKey(t)
+	nodeA, nodeB := uuid.New(), uuid.New()
+	topicA := "speedtest/" + nodeA.String() + "/measurements"
+	topicB := "speedtest/" + nodeB.String() + "/measurements"
+
+	unsigned, _ := json.Marshal(map[string]interface{}{"api_key": plainKey, "payload": measurementBatch(nodeA)})
+
+	tests := []struct {
+		name    string
+		topic   string
+		data    []byte
+		wantErr string
+	}{
+		{name: "API key instead of a signature", topic: topicA, data: unsigned, wantErr: "invalid message"},
+		{name: "unknown key", topic: topicA, data: signedMessage(t, "sk_live_0123456789abcdef.unknown", topicA, measurementBatch(nodeA)), wantErr: "invalid signature"},
+		{name: "wrong secret", topic: topicA, data: signedMessage(t, plainKey+"x", topicA, measurementBatch(nodeA)), wantErr: "invalid signature"},
+		// Signed for node A's topic, published to node B's
+		{name: "moved to another topic", topic: topicB, data: signedMessage(t, plainKey, topicA, measurementBatch(nodeB)), wantErr: "invalid signature"},
+		{name: "node ID does not match topic", topic: topicB, data: signedMessage(t, plainKey, topicB, measurementBatch(nodeA)), wantErr: "does not match topic"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := m.processMessage(tt.topic, tt.data)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("processMessage = %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	if count := env.measurementCount(t); count != 0 {
+		t.Errorf("%d measurements stored from rejected messages", count)
+	}
+}
+
+func TestMQTTIngestDelivery(t *testing.T) {
+	env := newMQTTTestEnv(t)
+	plainKey := env.createKey(t)
+	nodeID := uuid.New()
+	topic := "speedtest/" + nodeID.String() + "/measurements"
+
+	m := env.startIngest(t)
+
+	t.Run("signed message", func(t *testing.T) {
+		if err := env.broker.Publish(topic, signedMessage(t, plainKey, topic, measurementBatch(nodeID)), false, 1); err != nil {
+			t.Fatal(err)
+		}
+		waitFor(t, "the measurement", func() bool { return env.measurementCount(t) == 1 })
+	})
+
+	t.Run("duplicate delivery", func(t *testing.T) {
+		data := signedMessage(t, plainKey, topic, measurementBatch(nodeID))
+		if err := m.processMessage(topic, data); err != nil {
+			t.Fatal(err)
+		}
+		if err := m.processMessage(topic, data); err == nil || !strings.Contains(err.Error(), "already been used") {
+			t.Errorf("second delivery = %v, want it dropped", err)
+		}
+	})
+
+	t.Run("published while the server is offline", func(t *testing.T) {
+		before := env.measurementCount(t)
+		m.Stop()
+
+		// The broker keeps QoS 1 messages for the persistent session
+		batch := measurementBatch(nodeID)
+		batch.Measurements[0].Timestamp = batch.Measurements[0].Timestamp.Add(-time.Hour)
+		if err := env.broker.Publish(topic, signedMessage(t, plainKey, topic, batch), false, 1); err != nil {
+			t.Fatal(err)
+		}
+
+		env.startIngest(t)
+		waitFor(t, "the queued measurement", func() bool { return env.measurementCount(t) == before+1 })
+	})
+}
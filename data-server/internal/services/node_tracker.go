@@ -5,8 +5,10 @@ import (
 	"time"
 
 	"mark7888/speedtest-data-server/internal/config"
+	"mark7888/speedtest-data-server/internal/control"
 	"mark7888/speedtest-data-server/internal/db"
 	"mark7888/speedtest-data-server/internal/logger"
+	"mark7888/speedtest-data-server/internal/metrics"
 
 	"go.uber.org/zap"
 )
@@ -14,16 +16,18 @@ import (
 // NodeTracker monitors node status and updates them accordingly
 type NodeTracker struct {
 	db     db.Database
+	hub    *control.Hub
 	config *config.Config
 	ctx    context.Context
 	cancel context.CancelFunc
 }
 
 // NewNodeTracker creates a new node tracker
-func NewNodeTracker(database db.Database, cfg *config.Config) *NodeTracker {
+func NewNodeTracker(database db.Database, hub *control.Hub, cfg *config.Config) *NodeTracker {
 	ctx, cancel := context.WithCancel(context.Background())
 	return &NodeTracker{
 		db:     database,
+		hub:    hub,
 		config: cfg,
 		ctx:    ctx,
 		cancel: cancel,
@@ -62,10 +66,22 @@ func (nt *NodeTracker) Stop() {
 	nt.cancel()
 }
 
-// checkNodeStatus checks and updates node statuses
+// checkNodeStatus checks and updates node statuses.
+// Nodes with an open control channel are known to be up and are skipped;
+// the hub marks them unreachable as soon as they disconnect.
+// Queued commands the nodes never finished are expired on the same schedule.
 func (nt *NodeTracker) checkNodeStatus() {
-	err := nt.db.UpdateNodeStatus(nt.config.Node.AliveTimeout, nt.config.Node.InactiveTimeout)
+	started := time.Now()
+
+	err := nt.db.UpdateNodeStatus(nt.ctx, nt.config.Node.AliveTimeout, nt.config.Node.InactiveTimeout, nt.hub.ConnectedNodeIDs())
 	if err != nil {
 		logger.Log.Error("Failed to update node status", zap.Error(err))
 	}
+
+	if _, expireErr := nt.db.ExpireNodeCommands(nt.ctx, nt.config.Node.CommandTTL); expireErr != nil {
+		logger.Log.Error("Failed to expire node commands", zap.Error(expireErr))
+		err = expireErr
+	}
+
+	metrics.ObserveServiceRun("node_tracker", started, err)
 }
@@ -0,0 +1,111 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"mark7888/speedtest-data-server/internal/config"
+	"mark7888/speedtest-data-server/internal/metrics"
+	"mark7888/speedtest-data-server/internal/version"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// serviceName identifies the data server in traces
+const serviceName = "speedtest-data-server"
+
+// tracer is resolved through the global provider, so spans started before
+// Init (or with tracing disabled) are no-ops
+var tracer = otel.Tracer("mark7888/speedtest-data-server")
+
+// Init exports traces to the configured OTLP/HTTP collector. It always
+// installs the W3C trace context propagator so that trace IDs sent by nodes
+// are honoured. The returned func flushes pending spans on shutdown.
+func Init(cfg config.TracingConfig) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	if cfg.Endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	endpoint, err := tracesURL(cfg.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	exporter, err := otlptracehttp.New(context.Background(), otlptracehttp.WithEndpointURL(endpoint))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create trace exporter: %w", err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(
+		attribute.String("service.name", serviceName),
+		attribute.String("service.version", version.Get()),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create trace resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+// tracesURL appends the standard OTLP traces path when the endpoint is a
+// bare collector address
+func tracesURL(endpoint string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", fmt.Errorf("invalid tracing endpoint: %w", err)
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = "/v1/traces"
+	}
+	return u.String(), nil
+}
+
+// Start starts a span as a child of any span in ctx
+func Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return tracer.Start(ctx, name, opts...)
+}
+
+// StartQuery creates the context for a database method, with a timeout and
+// a span named after operation, the method name. Cancelling it ends the span
+// and records the method's duration.
+func StartQuery(parent context.Context, backend, operation string, timeout time.Duration) (context.Context, context.CancelFunc) {
+	started := time.Now()
+	ctx, span := tracer.Start(parent, backend+"."+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system.name", backend),
+			attribute.String("db.operation.name", operation),
+		),
+	)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+
+	var once sync.Once
+	return ctx, func() {
+		cancel()
+		once.Do(func() {
+			span.End()
+			metrics.DBQueryDuration.WithLabelValues(backend, operation).Observe(time.Since(started).Seconds())
+		})
+	}
+}
@@ -1,41 +1,119 @@
 package models
 
 import (
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+// API key scopes, each allowing one kind of node request
+const (
+	APIKeyScopeIngest    = "ingest"     // Submit measurements and failed tests
+	APIKeyScopeAlive     = "alive"      // Heartbeats, the control channel and command results
+	APIKeyScopeStatsRead = "stats:read" // Read the node's own statistics
+	// APIKeyScopeThroughputTest is reserved for server-side throughput tests;
+	// no endpoint requires it yet
+	APIKeyScopeThroughputTest = "throughput-test"
+)
+
+// DefaultAPIKeyScopes are granted to keys created without explicit scopes,
+// and are what keys created before scopes existed can do
+var DefaultAPIKeyScopes = []string{APIKeyScopeIngest, APIKeyScopeAlive}
+
 // APIKey represents an API key for node authentication
 type APIKey struct {
 	ID        uuid.UUID  `json:"id" db:"id"`
 	Name      string     `json:"name" db:"name"`
-	KeyHash   string     `json:"-" db:"key_hash"` // Never expose the hash
+	KeyID     *string    `json:"key_id,omitempty" db:"key_id"` // Public part of the key; nil for old keys not used since key IDs were added
+	KeyHash   string     `json:"-" db:"key_hash"`              // Never expose the hash
 	Enabled   bool       `json:"enabled" db:"enabled"`
 	CreatedAt time.Time  `json:"created_at" db:"created_at"`
 	CreatedBy *string    `json:"created_by,omitempty" db:"created_by"`
 	LastUsed  *time.Time `json:"last_used,omitempty" db:"last_used"`
 	RevokedAt *time.Time `json:"revoked_at,omitempty" db:"revoked_at"`
+	NodeID    *uuid.UUID `json:"node_id,omitempty" db:"node_id"` // Node the key may submit data for; nil until bound
+	BoundAt   *time.Time `json:"bound_at,omitempty" db:"bound_at"`
+	Scopes    []string   `json:"scopes" db:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty" db:"expires_at"`
+	// Key issued to replace this one; set while this key runs out its grace period
+	ReplacedBy *uuid.UUID `json:"replaced_by,omitempty" db:"replaced_by"`
+	// Encrypted key for verifying signed requests; nil for old keys not used since
+	SigningKey *string `json:"-" db:"signing_key"`
+}
+
+// HasScope reports whether the key grants scope
+func (k *APIKey) HasScope(scope string) bool {
+	return slices.Contains(k.Scopes, scope)
+}
+
+// Expired reports whether the key has expired at now
+func (k *APIKey) Expired(now time.Time) bool {
+	return k.ExpiresAt != nil && !now.Before(*k.ExpiresAt)
+}
+
+// FormatAPIKeyScopes joins scopes for storage in a single column
+func FormatAPIKeyScopes(scopes []string) string {
+	return strings.Join(scopes, ",")
+}
+
+// ParseAPIKeyScopes splits scopes stored with FormatAPIKeyScopes
+func ParseAPIKeyScopes(stored string) []string {
+	if stored == "" {
+		return []string{}
+	}
+	return strings.Split(stored, ",")
+}
+
+// NewAPIKey holds the settings of an API key to create
+type NewAPIKey struct {
+	Name      string
+	CreatedBy string
+	Scopes    []string
+	ExpiresAt *time.Time
+	NodeID    *uuid.UUID
 }
 
 // CreateAPIKeyRequest represents a request to create a new API key
 type CreateAPIKeyRequest struct {
 	Name string `json:"name" binding:"required,min=3,max=255"`
+	// Binds the key up front instead of to the first node using it
+	NodeID *uuid.UUID `json:"node_id"`
+	// DefaultAPIKeyScopes if empty
+	Scopes    []string   `json:"scopes" binding:"omitempty,min=1,dive,oneof=ingest alive stats:read throughput-test"`
+	ExpiresAt *time.Time `json:"expires_at"`
+
+	// Replaces makes the new key the successor of an existing one, which
+	// stays valid for GracePeriod (a duration such as "24h", 24h if empty)
+	// and then expires. Scopes and node binding not set here are taken over
+	// from the old key.
+	Replaces    *uuid.UUID `json:"replaces"`
+	GracePeriod string     `json:"grace_period"`
 }
 
 // CreateAPIKeyResponse represents the response when creating an API key
 type CreateAPIKeyResponse struct {
-	ID        uuid.UUID `json:"id"`
-	Name      string    `json:"name"`
-	Key       string    `json:"key"` // Plain key, only shown once
-	Enabled   bool      `json:"enabled"`
-	CreatedAt time.Time `json:"created_at"`
-	Warning   string    `json:"warning"`
+	ID        uuid.UUID  `json:"id"`
+	Name      string     `json:"name"`
+	Key       string     `json:"key"` // Plain key, only shown once
+	Enabled   bool       `json:"enabled"`
+	CreatedAt time.Time  `json:"created_at"`
+	NodeID    *uuid.UUID `json:"node_id,omitempty"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Replaces  *uuid.UUID `json:"replaces,omitempty"`
+	// When the replaced key stops working
+	ReplacedExpiresAt *time.Time `json:"replaced_expires_at,omitempty"`
+	Warning           string     `json:"warning"`
 }
 
 // UpdateAPIKeyRequest represents a request to update an API key
 type UpdateAPIKeyRequest struct {
-	Enabled *bool `json:"enabled"`
+	Enabled   *bool      `json:"enabled"`
+	Scopes    []string   `json:"scopes" binding:"omitempty,min=1,dive,oneof=ingest alive stats:read throughput-test"`
+	ExpiresAt *time.Time `json:"expires_at"`
+	NoExpiry  bool       `json:"no_expiry"` // Removes the expiry; cannot be combined with expires_at
 }
 
 // ListAPIKeysResponse represents the response when listing API keys
@@ -43,3 +121,16 @@ type ListAPIKeysResponse struct {
 	APIKeys []APIKey `json:"api_keys"`
 	Total   int      `json:"total"`
 }
+
+// APIKeyBinding describes the node an API key is bound to
+type APIKeyBinding struct {
+	APIKeyID uuid.UUID  `json:"api_key_id"`
+	NodeID   *uuid.UUID `json:"node_id"` // nil while the key is unbound
+	NodeName *string    `json:"node_name,omitempty"`
+	BoundAt  *time.Time `json:"bound_at,omitempty"`
+}
+
+// BindAPIKeyRequest represents a request to bind an API key to a node
+type BindAPIKeyRequest struct {
+	NodeID uuid.UUID `json:"node_id" binding:"required"`
+}
@@ -8,17 +8,42 @@ type LoginRequest struct {
 	Password string `json:"password" binding:"required"`
 }
 
-// LoginResponse represents the response after successful login
+// LoginResponse represents the response after successful login. The token
+// is a short-lived access token; the refresh token gets new ones from
+// /api/v1/admin/refresh until the session expires.
 type LoginResponse struct {
-	Token     string    `json:"token"`
-	ExpiresAt time.Time `json:"expires_at"`
-	Username  string    `json:"username"`
+	Token            string    `json:"token"`
+	ExpiresAt        time.Time `json:"expires_at"`
+	RefreshToken     string    `json:"refresh_token"`
+	SessionExpiresAt time.Time `json:"session_expires_at"`
+	Username         string    `json:"username"`
+	Role             string    `json:"role"`
+	// Set when a recovery code was used to log in
+	RecoveryCodesRemaining *int `json:"recovery_codes_remaining,omitempty"`
 }
 
-// RefreshTokenResponse represents the response after token refresh
+// MFAChallengeResponse is the response to a correct password for an account
+// with two-factor authentication. The login is completed by posting the
+// MFA token and a code to /api/v1/admin/login/mfa.
+type MFAChallengeResponse struct {
+	MFARequired bool      `json:"mfa_required"`
+	MFAToken    string    `json:"mfa_token"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// MFALoginRequest completes a login with a TOTP code or a recovery code
+type MFALoginRequest struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+	Code     string `json:"code" binding:"required,max=64"`
+}
+
+// RefreshTokenResponse represents the response after token refresh. The
+// refresh token that was sent is no longer valid; use this one next time.
 type RefreshTokenResponse struct {
-	Token     string    `json:"token"`
-	ExpiresAt time.Time `json:"expires_at"`
+	Token            string    `json:"token"`
+	ExpiresAt        time.Time `json:"expires_at"`
+	RefreshToken     string    `json:"refresh_token"`
+	SessionExpiresAt time.Time `json:"session_expires_at"`
 }
 
 // DashboardSummary represents the dashboard summary data
@@ -27,6 +52,7 @@ type DashboardSummary struct {
 	ActiveNodes         int                `json:"active_nodes"`
 	UnreachableNodes    int                `json:"unreachable_nodes"`
 	InactiveNodes       int                `json:"inactive_nodes"`
+	ConnectedNodes      int                `json:"connected_nodes"` // Nodes with an open control channel
 	TotalMeasurements   int64              `json:"total_measurements"`
 	MeasurementsLast24h int64              `json:"measurements_last_24h"`
 	LastMeasurement     *time.Time         `json:"last_measurement,omitempty"`
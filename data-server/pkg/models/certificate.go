@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// NodeCertificateScopes are granted to nodes authenticating with a client
+// certificate, which carries no scopes of its own
+var NodeCertificateScopes = []string{APIKeyScopeIngest, APIKeyScopeAlive, APIKeyScopeStatsRead}
+
+// SignCertificateRequest represents a request to issue a node client certificate
+type SignCertificateRequest struct {
+	// The node the certificate identifies; any subject in the CSR is ignored
+	NodeID uuid.UUID `json:"node_id" binding:"required"`
+	CSR    string    `json:"csr" binding:"required"` // PEM encoded certificate signing request
+}
+
+// SignCertificateResponse carries an issued node client certificate
+type SignCertificateResponse struct {
+	NodeID        uuid.UUID `json:"node_id"`
+	SerialNumber  string    `json:"serial_number"`
+	NotAfter      time.Time `json:"not_after"`
+	Certificate   string    `json:"certificate"`    // PEM encoded
+	CACertificate string    `json:"ca_certificate"` // PEM encoded CA that issued it
+}
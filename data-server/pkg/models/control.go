@@ -0,0 +1,50 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Control channel message types
+const (
+	ControlTypeAlive         = "alive"          // node -> server heartbeat, payload AliveRequest
+	ControlTypeAliveAck      = "alive_ack"      // server -> node, payload AliveResponse
+	ControlTypeCommand       = "command"        // server -> node, payload Command
+	ControlTypeCommandResult = "command_result" // node -> server, payload CommandResult
+	ControlTypeError         = "error"          // server -> node, payload ErrorResponse
+)
+
+// ControlMessage is a single message on the node control channel (WebSocket)
+type ControlMessage struct {
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// Command is an instruction sent from the server to a connected node
+type Command struct {
+	ID   string          `json:"id"`
+	Name string          `json:"name"`
+	Args json.RawMessage `json:"args,omitempty"`
+}
+
+// CommandResult is a node's reply to a Command
+type CommandResult struct {
+	ID     string          `json:"id"`
+	Status string          `json:"status"` // ok or error
+	Error  string          `json:"error,omitempty"`
+	Output json.RawMessage `json:"output,omitempty"`
+}
+
+// SendCommandRequest represents an admin request to send a command to a node
+type SendCommandRequest struct {
+	Name string          `json:"name" binding:"required"`
+	Args json.RawMessage `json:"args,omitempty"`
+}
+
+// ConnectedNode describes a node holding an open control channel
+type ConnectedNode struct {
+	NodeID         string    `json:"node_id"`
+	ConnectedSince time.Time `json:"connected_since"`
+	LastHeartbeat  time.Time `json:"last_heartbeat"`
+	RemoteAddr     string    `json:"remote_addr"`
+}
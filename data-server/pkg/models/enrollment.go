@@ -0,0 +1,81 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// EnrollmentToken lets new nodes obtain their own API key. Each use issues
+// one key bound to the enrolling node; the token itself cannot send data.
+type EnrollmentToken struct {
+	ID        uuid.UUID `json:"id" db:"id"`
+	Name      string    `json:"name" db:"name"`
+	TokenID   string    `json:"token_id" db:"token_id"` // Public part of the token
+	TokenHash string    `json:"-" db:"token_hash"`      // Never expose the hash
+	Scopes    []string  `json:"scopes" db:"scopes"`     // Scopes of the keys issued
+	MaxUses   int       `json:"max_uses" db:"max_uses"`
+	Uses      int       `json:"uses" db:"uses"`
+	ExpiresAt time.Time `json:"expires_at" db:"expires_at"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	CreatedBy *string   `json:"created_by,omitempty" db:"created_by"`
+}
+
+// Expired reports whether the token has expired at now
+func (t *EnrollmentToken) Expired(now time.Time) bool {
+	return !now.Before(t.ExpiresAt)
+}
+
+// EnrolledBy is recorded as the creator of API keys issued with the token,
+// so they can be traced back to it
+func EnrolledBy(token *EnrollmentToken) string {
+	return "enrollment:" + token.TokenID
+}
+
+// NewEnrollmentToken holds the settings of an enrollment token to create
+type NewEnrollmentToken struct {
+	Name      string
+	CreatedBy string
+	Scopes    []string
+	MaxUses   int
+	ExpiresAt time.Time
+}
+
+// CreateEnrollmentTokenRequest represents a request to create an enrollment token
+type CreateEnrollmentTokenRequest struct {
+	Name string `json:"name" binding:"required,min=3,max=255"`
+	// Number of nodes that may enroll with the token, 1 if zero
+	MaxUses int `json:"max_uses" binding:"omitempty,min=1,max=10000"`
+	// Scopes of the issued keys, DefaultAPIKeyScopes if empty
+	Scopes []string `json:"scopes" binding:"omitempty,min=1,dive,oneof=ingest alive stats:read throughput-test"`
+	// When the token stops working; 24 hours from now if not set
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// CreateEnrollmentTokenResponse represents the response when creating an enrollment token
+type CreateEnrollmentTokenResponse struct {
+	EnrollmentToken
+	Token   string `json:"token"` // Plain token, only shown once
+	Warning string `json:"warning"`
+}
+
+// ListEnrollmentTokensResponse represents the response when listing enrollment tokens
+type ListEnrollmentTokensResponse struct {
+	EnrollmentTokens []EnrollmentToken `json:"enrollment_tokens"`
+	Total            int               `json:"total"`
+}
+
+// EnrollRequest is sent by a node to exchange an enrollment token for an API key
+type EnrollRequest struct {
+	Token    string    `json:"token" binding:"required"`
+	NodeID   uuid.UUID `json:"node_id" binding:"required"`
+	NodeName string    `json:"node_name" binding:"required,max=255"`
+}
+
+// EnrollResponse carries the API key issued to an enrolled node
+type EnrollResponse struct {
+	APIKeyID uuid.UUID `json:"api_key_id"`
+	Key      string    `json:"key"` // Plain key, only shown once
+	NodeID   uuid.UUID `json:"node_id"`
+	Scopes   []string  `json:"scopes"`
+}
@@ -59,6 +59,10 @@ type Measurement struct {
 	ResultID  *string `json:"result_id,omitempty" db:"result_id"`
 	ResultURL *string `json:"result_url,omitempty" db:"result_url"`
 
+	// Clock skew, set when the node's clock was off by more than the skew threshold
+	ClockSkewMs       *int64     `json:"clock_skew_ms,omitempty" db:"clock_skew_ms"`
+	OriginalTimestamp *time.Time `json:"original_timestamp,omitempty" db:"original_timestamp"` // Node's own timestamp when Timestamp was corrected
+
 	// Failed measurement info
 	IsFailed     bool    `json:"is_failed" db:"is_failed"`
 	ErrorMessage *string `json:"error_message,omitempty" db:"error_message"`
@@ -82,6 +86,12 @@ type MeasurementDetail struct {
 	Interface  *InterfaceInfo   `json:"interface"`
 	Server     *ServerInfo      `json:"server"`
 	Result     *ResultInfo      `json:"result"`
+
+	// Set by nodes that track their clock offset: the node's own ID for the
+	// result, echoed in MeasurementResponse.Deferred, and the offset (server
+	// - node) it had estimated when the test ran
+	LocalID       *int64 `json:"local_id,omitempty"`
+	ClockOffsetMs *int64 `json:"clock_offset_ms,omitempty"`
 }
 
 // PingMetrics contains ping test results
@@ -136,11 +146,36 @@ type ResultInfo struct {
 
 // MeasurementResponse represents the response after submitting measurements
 type MeasurementResponse struct {
-	Status   string `json:"status"`
-	Received int    `json:"received"`
-	Inserted int    `json:"inserted"`
-	Updated  int    `json:"updated"`
-	Failed   int    `json:"failed"`
+	Status      string `json:"status"`
+	Received    int    `json:"received"`
+	Inserted    int    `json:"inserted"`
+	Updated     int    `json:"updated"`
+	Failed      int    `json:"failed"`
+	Rejected    int    `json:"rejected"`    // Timestamps too far in the future, or implausible values
+	Quarantined int    `json:"quarantined"` // Implausible values held back for review
+
+	// Local IDs of results timestamped too far in the future. Nodes keep
+	// these queued and send them again later.
+	Deferred []int64 `json:"deferred,omitempty"`
+}
+
+// QuarantinedMeasurement is a measurement that failed the plausibility checks
+// and is held back until an admin approves or discards it
+type QuarantinedMeasurement struct {
+	ID          uuid.UUID   `json:"id" db:"id"`
+	NodeID      uuid.UUID   `json:"node_id" db:"node_id"`
+	Timestamp   time.Time   `json:"timestamp" db:"timestamp"`
+	Reasons     []string    `json:"reasons" db:"reasons"`
+	Measurement Measurement `json:"measurement" db:"measurement"`
+	CreatedAt   time.Time   `json:"created_at" db:"created_at"`
+}
+
+// QuarantinedMeasurementsResponse lists measurements awaiting review
+type QuarantinedMeasurementsResponse struct {
+	Measurements []QuarantinedMeasurement `json:"measurements"`
+	Total        int                      `json:"total"`
+	Page         int                      `json:"page"`
+	Limit        int                      `json:"limit"`
 }
 
 // FailedMeasurement represents a failed speedtest attempt
@@ -151,6 +186,10 @@ type FailedMeasurement struct {
 	ErrorMessage *string   `json:"error_message,omitempty" db:"error_message"`
 	RetryCount   int       `json:"retry_count" db:"retry_count"`
 	CreatedAt    time.Time `json:"created_at" db:"created_at"`
+
+	// Clock skew, see Measurement
+	ClockSkewMs       *int64     `json:"clock_skew_ms,omitempty" db:"clock_skew_ms"`
+	OriginalTimestamp *time.Time `json:"original_timestamp,omitempty" db:"original_timestamp"`
 }
 
 // FailedMeasurementRequest represents failed test submissions
@@ -165,12 +204,20 @@ type FailedTestDetail struct {
 	Timestamp    time.Time `json:"timestamp" binding:"required"`
 	ErrorMessage string    `json:"error_message" binding:"required"`
 	RetryCount   int       `json:"retry_count"`
+
+	// See MeasurementDetail
+	LocalID       *int64 `json:"local_id,omitempty"`
+	ClockOffsetMs *int64 `json:"clock_offset_ms,omitempty"`
 }
 
 // FailedMeasurementResponse represents the response to failed test submission
 type FailedMeasurementResponse struct {
 	Status   string `json:"status"`
 	Received int    `json:"received"`
+	Rejected int    `json:"rejected"` // Timestamps too far in the future
+
+	// Local IDs of rejected results the node should send again later
+	Deferred []int64 `json:"deferred,omitempty"`
 }
 
 // AggregatedMeasurement represents aggregated measurement data for charts
@@ -0,0 +1,28 @@
+package models
+
+import (
+	"encoding/json"
+
+	"github.com/google/uuid"
+)
+
+// MQTTMessage is the envelope nodes publish to the MQTT ingest topics
+// ({prefix}/{node_id}/alive, /measurements, /failed and /command_result).
+// Payload holds the same JSON body the corresponding REST endpoint accepts.
+// Anyone subscribed to the topics can read the envelope, so it carries no
+// API key: it is signed like a node request (see auth.RequestSignature),
+// with the topic in place of the request URI.
+type MQTTMessage struct {
+	KeyID     string          `json:"key_id" binding:"required"`
+	Timestamp string          `json:"timestamp" binding:"required"` // Unix seconds
+	Nonce     string          `json:"nonce" binding:"required"`
+	Signature string          `json:"signature" binding:"required"`
+	Payload   json.RawMessage `json:"payload" binding:"required"`
+}
+
+// MQTTCommandResult is the command_result payload. MQTT has no path
+// parameters, so the command ID travels alongside the REST request body.
+type MQTTCommandResult struct {
+	CommandID uuid.UUID `json:"command_id" binding:"required"`
+	CommandResultRequest
+}
@@ -28,6 +28,16 @@ type Node struct {
 	Favorite  bool       `json:"favorite" db:"favorite"`
 	CreatedAt time.Time  `json:"created_at" db:"created_at"`
 	UpdatedAt time.Time  `json:"updated_at" db:"updated_at"`
+
+	// Version of the server-managed settings the node last reported running
+	ConfigVersion *string `json:"config_version,omitempty" db:"config_version"`
+
+	// Offset of the node's clock from server time (server - node) as last estimated by the node
+	ClockOffsetMs *int64 `json:"clock_offset_ms,omitempty" db:"clock_offset_ms"`
+
+	// Control channel state, tracked in memory rather than stored
+	Connected      bool       `json:"connected" db:"-"`
+	ConnectedSince *time.Time `json:"connected_since,omitempty" db:"-"`
 }
 
 // NodeWithStats extends Node with statistical information
@@ -37,6 +47,24 @@ type NodeWithStats struct {
 	FailedTestCount   int64               `json:"failed_test_count,omitempty"`
 	LatestMeasurement *MeasurementSummary `json:"latest_measurement,omitempty"`
 	Statistics        *NodeStatistics     `json:"statistics,omitempty"`
+
+	// Latest inventory snapshot the node reported, nil for nodes that never sent one
+	Inventory           *NodeInventory `json:"inventory,omitempty"`
+	InventoryReportedAt *time.Time     `json:"inventory_reported_at,omitempty"`
+}
+
+// NodeInventory describes a node's software, host and local queue state
+type NodeInventory struct {
+	Version                  string     `json:"version" binding:"max=64"`
+	Backends                 []string   `json:"backends" binding:"max=16,dive,max=64"` // Speedtest backends found on the node's host
+	OS                       string     `json:"os" binding:"max=64"`
+	Kernel                   string     `json:"kernel,omitempty" binding:"max=128"`
+	Arch                     string     `json:"arch" binding:"max=64"`
+	UptimeSeconds            int64      `json:"uptime_seconds" binding:"min=0"` // Since the node process started
+	DBSizeBytes              int64      `json:"db_size_bytes" binding:"min=0"`
+	UnsentMeasurements       int64      `json:"unsent_measurements" binding:"min=0"`
+	UnsentFailedMeasurements int64      `json:"unsent_failed_measurements" binding:"min=0"`
+	LastSuccessfulTest       *time.Time `json:"last_successful_test,omitempty"`
 }
 
 // NodeStatistics contains aggregated statistics for a node
@@ -65,11 +93,28 @@ type AliveRequest struct {
 	NodeName  string    `json:"node_name" binding:"required"`
 	Location  *string   `json:"location,omitempty"`
 	Timestamp time.Time `json:"timestamp" binding:"required"`
+
+	// Version of the server-managed settings the node is running; omitted by
+	// nodes that predate remote configuration
+	ConfigVersion *string `json:"config_version,omitempty"`
+
+	// Omitted by nodes that predate inventory reporting
+	Inventory *NodeInventory `json:"inventory,omitempty"`
+
+	// Offset of the node's clock from server time (server - node), omitted
+	// until the node has estimated it from an alive round-trip
+	ClockOffsetMs *int64 `json:"clock_offset_ms,omitempty"`
 }
 
 // AliveResponse represents the response to an alive request
 type AliveResponse struct {
-	Status         string    `json:"status"`
-	ServerTime     time.Time `json:"server_time"`
-	NodeRegistered bool      `json:"node_registered"`
+	Status         string           `json:"status"`
+	ServerTime     time.Time        `json:"server_time"`
+	NodeRegistered bool             `json:"node_registered"`
+	RequestTime    time.Time        `json:"request_time"`              // Echo of the request timestamp, for the node's clock offset estimate
+	ReceiveTime    time.Time        `json:"receive_time"`              // When the server received the request; ServerTime is when it replied
+	AcceptEncoding []string         `json:"accept_encoding,omitempty"` // Request encodings the server can decode
+	Commands       []PendingCommand `json:"commands,omitempty"`        // Queued commands for the node to execute
+	ConfigVersion  *string          `json:"config_version,omitempty"`  // Version of the node's server-managed settings ("" if none)
+	Config         *NodeSettings    `json:"config,omitempty"`          // Only sent when the node's version is out of date
 }
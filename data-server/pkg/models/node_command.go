@@ -0,0 +1,78 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// NodeCommandStatus represents the lifecycle state of a queued node command
+type NodeCommandStatus string
+
+const (
+	NodeCommandStatusPending   NodeCommandStatus = "pending"   // queued, not yet picked up by the node
+	NodeCommandStatusDelivered NodeCommandStatus = "delivered" // handed to the node in an alive response
+	NodeCommandStatusRunning   NodeCommandStatus = "running"   // node reported it started executing
+	NodeCommandStatusCompleted NodeCommandStatus = "completed"
+	NodeCommandStatusFailed    NodeCommandStatus = "failed"
+	NodeCommandStatusExpired   NodeCommandStatus = "expired" // node did not pick it up in time
+)
+
+// Queued node command names
+const (
+	NodeCommandRunTest = "run_test"
+)
+
+// NodeCommand is a command queued for a node and delivered with its next
+// alive response. Unlike control channel commands it survives the node
+// being offline or polling over plain HTTP.
+type NodeCommand struct {
+	ID                   uuid.UUID         `json:"id" db:"id"`
+	NodeID               uuid.UUID         `json:"node_id" db:"node_id"`
+	Command              string            `json:"command" db:"command"`
+	Status               NodeCommandStatus `json:"status" db:"status"`
+	CreatedBy            *string           `json:"created_by,omitempty" db:"created_by"`
+	CreatedAt            time.Time         `json:"created_at" db:"created_at"`
+	DeliveredAt          *time.Time        `json:"delivered_at,omitempty" db:"delivered_at"`
+	CompletedAt          *time.Time        `json:"completed_at,omitempty" db:"completed_at"`
+	ErrorMessage         *string           `json:"error_message,omitempty" db:"error_message"`
+	MeasurementTimestamp *time.Time        `json:"measurement_timestamp,omitempty" db:"measurement_timestamp"`
+	MeasurementID        *int64            `json:"measurement_id,omitempty" db:"-"` // Resolved once the measurement has synced
+}
+
+// Active returns true while the command has not reached a final state
+func (c *NodeCommand) Active() bool {
+	switch c.Status {
+	case NodeCommandStatusPending, NodeCommandStatusDelivered, NodeCommandStatusRunning:
+		return true
+	}
+	return false
+}
+
+// PendingCommand is a command handed to a node in an alive response
+type PendingCommand struct {
+	ID      uuid.UUID `json:"id"`
+	Command string    `json:"command"`
+}
+
+// CommandResultRequest is sent by a node to report progress on a queued command
+type CommandResultRequest struct {
+	NodeID               uuid.UUID  `json:"node_id" binding:"required"`
+	Status               string     `json:"status" binding:"required,oneof=running completed failed"`
+	ErrorMessage         *string    `json:"error_message,omitempty"`
+	MeasurementTimestamp *time.Time `json:"measurement_timestamp,omitempty"`
+
+	// Clock offset the node recorded with the measurement, so the server can
+	// correct MeasurementTimestamp the same way it corrected the measurement
+	ClockOffsetMs *int64 `json:"clock_offset_ms,omitempty"`
+}
+
+// CommandResultResponse acknowledges a command result report
+type CommandResultResponse struct {
+	Status string `json:"status"`
+}
+
+// NodeCommandsResponse represents the list of commands queued for a node
+type NodeCommandsResponse struct {
+	Commands []NodeCommand `json:"commands"`
+}
@@ -0,0 +1,88 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// NodeConfigScopeDefault is the scope of the fleet-wide node settings.
+// Per-node overrides use the node ID as their scope.
+const NodeConfigScopeDefault = "default"
+
+// NodeSettings are node settings managed from the server. Unset fields fall
+// back to the next level: node override, then fleet default, then the node's
+// own flags/environment.
+type NodeSettings struct {
+	SpeedtestCron    *string `json:"speedtest_cron,omitempty"`
+	SpeedtestTimeout *string `json:"speedtest_timeout,omitempty"` // Go duration, e.g. "2m"
+	RetryOnFailure   *bool   `json:"retry_on_failure,omitempty"`
+	BatchSize        *int    `json:"batch_size,omitempty"`
+	SyncInterval     *string `json:"sync_interval,omitempty"`  // Go duration
+	AliveInterval    *string `json:"alive_interval,omitempty"` // Go duration
+	RetentionDays    *int    `json:"retention_days,omitempty"`
+}
+
+// Merge returns the settings with every field set in override taking precedence
+func (s NodeSettings) Merge(override NodeSettings) NodeSettings {
+	if override.SpeedtestCron != nil {
+		s.SpeedtestCron = override.SpeedtestCron
+	}
+	if override.SpeedtestTimeout != nil {
+		s.SpeedtestTimeout = override.SpeedtestTimeout
+	}
+	if override.RetryOnFailure != nil {
+		s.RetryOnFailure = override.RetryOnFailure
+	}
+	if override.BatchSize != nil {
+		s.BatchSize = override.BatchSize
+	}
+	if override.SyncInterval != nil {
+		s.SyncInterval = override.SyncInterval
+	}
+	if override.AliveInterval != nil {
+		s.AliveInterval = override.AliveInterval
+	}
+	if override.RetentionDays != nil {
+		s.RetentionDays = override.RetentionDays
+	}
+	return s
+}
+
+// IsEmpty returns true if no setting is managed from the server
+func (s NodeSettings) IsEmpty() bool {
+	return s == NodeSettings{}
+}
+
+// Version identifies the settings by content so nodes can tell whether they
+// are up to date. Empty settings have an empty version.
+func (s NodeSettings) Version() string {
+	if s.IsEmpty() {
+		return ""
+	}
+	data, _ := json.Marshal(s)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+// NodeConfig is a stored set of node settings
+type NodeConfig struct {
+	Scope     string       `json:"scope" db:"scope"`
+	Settings  NodeSettings `json:"settings" db:"settings"`
+	UpdatedAt time.Time    `json:"updated_at" db:"updated_at"`
+	UpdatedBy *string      `json:"updated_by,omitempty" db:"updated_by"`
+}
+
+// NodeConfigResponse describes how a node's settings are resolved
+type NodeConfigResponse struct {
+	NodeID         uuid.UUID    `json:"node_id"`
+	Default        NodeSettings `json:"default"`
+	Override       NodeSettings `json:"override"`
+	Effective      NodeSettings `json:"effective"`
+	Version        string       `json:"version"`
+	AppliedVersion *string      `json:"applied_version"` // As last reported by the node
+	InSync         bool         `json:"in_sync"`
+}
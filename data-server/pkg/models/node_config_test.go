@@ -0,0 +1,122 @@
+package models
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func TestNodeSettingsMerge(t *testing.T) {
+	str := func(s string) *string { return &s }
+	num := func(n int) *int { return &n }
+	yes, no := true, false
+
+	tests := []struct {
+		name     string
+		base     NodeSettings
+		override NodeSettings
+		want     NodeSettings
+	}{
+		{
+			name: "both empty",
+		},
+		{
+			name: "empty override keeps base",
+			base: NodeSettings{SpeedtestCron: str("0 * * * *"), BatchSize: num(50)},
+			want: NodeSettings{SpeedtestCron: str("0 * * * *"), BatchSize: num(50)},
+		},
+		{
+			name:     "override fills unset fields",
+			override: NodeSettings{SyncInterval: str("1m")},
+			want:     NodeSettings{SyncInterval: str("1m")},
+		},
+		{
+			name:     "override takes precedence field by field",
+			base:     NodeSettings{SpeedtestCron: str("0 * * * *"), RetentionDays: num(30), RetryOnFailure: &yes},
+			override: NodeSettings{SpeedtestCron: str("*/5 * * * *"), RetryOnFailure: &no},
+			want:     NodeSettings{SpeedtestCron: str("*/5 * * * *"), RetentionDays: num(30), RetryOnFailure: &no},
+		},
+		{
+			name: "every field",
+			base: NodeSettings{
+				SpeedtestCron: str("a"), SpeedtestTimeout: str("1m"), RetryOnFailure: &yes, BatchSize: num(1),
+				SyncInterval: str("1m"), AliveInterval: str("1m"), RetentionDays: num(1),
+			},
+			override: NodeSettings{
+				SpeedtestCron: str("b"), SpeedtestTimeout: str("2m"), RetryOnFailure: &no, BatchSize: num(2),
+				SyncInterval: str("2m"), AliveInterval: str("2m"), RetentionDays: num(2),
+			},
+			want: NodeSettings{
+				SpeedtestCron: str("b"), SpeedtestTimeout: str("2m"), RetryOnFailure: &no, BatchSize: num(2),
+				SyncInterval: str("2m"), AliveInterval: str("2m"), RetentionDays: num(2),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.base.Merge(tt.override)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Merge() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNodeSettingsVersion(t *testing.T) {
+	str := func(s string) *string { return &s }
+	num := func(n int) *int { return &n }
+	hexVersion := regexp.MustCompile(`^[0-9a-f]{16}$`)
+
+	hourly := NodeSettings{SpeedtestCron: str("0 * * * *")}
+
+	tests := []struct {
+		name string
+		a, b NodeSettings
+		same bool
+	}{
+		{
+			name: "equal content, distinct pointers",
+			a:    NodeSettings{SpeedtestCron: str("0 * * * *"), BatchSize: num(10)},
+			b:    NodeSettings{SpeedtestCron: str("0 * * * *"), BatchSize: num(10)},
+			same: true,
+		},
+		{
+			name: "merged equals written out",
+			a:    NodeSettings{BatchSize: num(10)}.Merge(hourly),
+			b:    NodeSettings{SpeedtestCron: str("0 * * * *"), BatchSize: num(10)},
+			same: true,
+		},
+		{
+			name: "different value",
+			a:    hourly,
+			b:    NodeSettings{SpeedtestCron: str("*/5 * * * *")},
+		},
+		{
+			name: "extra field",
+			a:    hourly,
+			b:    hourly.Merge(NodeSettings{RetentionDays: num(7)}),
+		},
+		{
+			name: "zero value differs from unset",
+			a:    hourly,
+			b:    hourly.Merge(NodeSettings{BatchSize: num(0)}),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			va, vb := tt.a.Version(), tt.b.Version()
+			if !hexVersion.MatchString(va) || !hexVersion.MatchString(vb) {
+				t.Fatalf("versions %q and %q are not 16 hex digits", va, vb)
+			}
+			if (va == vb) != tt.same {
+				t.Errorf("versions %q and %q, want same: %v", va, vb, tt.same)
+			}
+		})
+	}
+
+	if v := (NodeSettings{}).Version(); v != "" {
+		t.Errorf("empty settings have version %q, want none", v)
+	}
+}
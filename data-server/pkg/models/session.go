@@ -0,0 +1,52 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Session is a login to the admin API. Access tokens name their session, so
+// revoking it signs them out at once; its refresh token is replaced each
+// time it is used, until the session expires.
+type Session struct {
+	ID         uuid.UUID  `json:"id" db:"id"`
+	Username   string     `json:"username" db:"username"`
+	Role       string     `json:"role" db:"role"` // Role at login; single sign-on sessions keep it
+	Source     string     `json:"source,omitempty" db:"source"`
+	UserAgent  string     `json:"user_agent,omitempty" db:"user_agent"`
+	ClientIP   string     `json:"client_ip,omitempty" db:"client_ip"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+	LastUsedAt time.Time  `json:"last_used_at" db:"last_used_at"` // Last login or refresh
+	ExpiresAt  time.Time  `json:"expires_at" db:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty" db:"revoked_at"`
+	Current    bool       `json:"current" db:"-"` // The session of the request listing it
+}
+
+// Active reports whether the session has neither been revoked nor expired
+// at now
+func (s *Session) Active(now time.Time) bool {
+	return s.RevokedAt == nil && now.Before(s.ExpiresAt)
+}
+
+// NewSession holds the settings of a session to start
+type NewSession struct {
+	Username  string
+	Role      string
+	Source    string
+	UserAgent string
+	ClientIP  string
+	ExpiresAt time.Time
+}
+
+// RefreshTokenRequest exchanges a refresh token for a new access token and
+// refresh token
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// ListSessionsResponse represents the response when listing sessions
+type ListSessionsResponse struct {
+	Sessions []Session `json:"sessions"`
+	Total    int       `json:"total"`
+}
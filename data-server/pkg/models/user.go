@@ -0,0 +1,119 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Admin user roles. Each role can do everything the ones below it can.
+const (
+	UserRoleAdmin    = "admin"    // Everything, including API keys, enrollment and users
+	UserRoleOperator = "operator" // Manage nodes: commands, settings, archiving, quarantine review
+	UserRoleViewer   = "viewer"   // Read-only access to the dashboard
+)
+
+// userRoleRanks orders the roles from least to most privileged
+var userRoleRanks = map[string]int{
+	UserRoleViewer:   1,
+	UserRoleOperator: 2,
+	UserRoleAdmin:    3,
+}
+
+// RoleAllows reports whether role grants the access of required. Unknown
+// roles grant nothing.
+func RoleAllows(role, required string) bool {
+	rank, ok := userRoleRanks[role]
+	return ok && rank >= userRoleRanks[required]
+}
+
+// ValidUserRole reports whether role is one of the user roles
+func ValidUserRole(role string) bool {
+	_, ok := userRoleRanks[role]
+	return ok
+}
+
+// User is an admin API account stored in the database. The admin account
+// from the server configuration is not stored; it always has the admin role.
+type User struct {
+	ID           uuid.UUID  `json:"id" db:"id"`
+	Username     string     `json:"username" db:"username"`
+	PasswordHash string     `json:"-" db:"password_hash"` // Never expose the hash
+	Role         string     `json:"role" db:"role"`
+	Enabled      bool       `json:"enabled" db:"enabled"`
+	TOTPEnabled  bool       `json:"totp_enabled" db:"totp_enabled"`
+	CreatedAt    time.Time  `json:"created_at" db:"created_at"`
+	CreatedBy    *string    `json:"created_by,omitempty" db:"created_by"`
+	UpdatedAt    time.Time  `json:"updated_at" db:"updated_at"`
+	LastLoginAt  *time.Time `json:"last_login_at,omitempty" db:"last_login_at"`
+}
+
+// NewUser holds the settings of a user to create
+type NewUser struct {
+	Username     string
+	PasswordHash string
+	Role         string
+	CreatedBy    string
+}
+
+// UserUpdate holds the changes to a user; nil fields are left alone
+type UserUpdate struct {
+	Role         *string
+	PasswordHash *string
+	Enabled      *bool
+}
+
+// CreateUserRequest represents a request to create a user
+type CreateUserRequest struct {
+	Username string `json:"username" binding:"required,min=3,max=64"`
+	// bcrypt ignores anything past 72 bytes
+	Password string `json:"password" binding:"required,min=12,max=72"`
+	Role     string `json:"role" binding:"required,oneof=admin operator viewer"`
+}
+
+// UpdateUserRequest represents a request to change a user
+type UpdateUserRequest struct {
+	Role     *string `json:"role" binding:"omitempty,oneof=admin operator viewer"`
+	Password *string `json:"password" binding:"omitempty,min=12,max=72"`
+	Enabled  *bool   `json:"enabled"`
+}
+
+// ChangePasswordRequest represents a user changing their own password
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required,min=12,max=72"`
+}
+
+// ListUsersResponse represents the response when listing users
+type ListUsersResponse struct {
+	Users []User `json:"users"`
+	Total int    `json:"total"`
+}
+
+// CurrentUserResponse describes the authenticated user
+type CurrentUserResponse struct {
+	Username     string `json:"username"`
+	Role         string `json:"role"`
+	Bootstrap    bool   `json:"bootstrap"`      // The admin account from the server configuration
+	SingleSignOn bool   `json:"single_sign_on"` // Logged in through the OpenID Connect provider
+	TOTPEnabled  bool   `json:"totp_enabled"`
+	// Unused recovery codes; only for accounts with two-factor authentication
+	RecoveryCodesRemaining int `json:"recovery_codes_remaining,omitempty"`
+}
+
+// TOTPEnrollmentResponse holds a new TOTP secret. It takes effect once a
+// code from it is confirmed.
+type TOTPEnrollmentResponse struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"` // otpauth:// URI, usually shown as a QR code
+}
+
+// TOTPCodeRequest carries a TOTP code, or where allowed a recovery code
+type TOTPCodeRequest struct {
+	Code string `json:"code" binding:"required,max=64"`
+}
+
+// RecoveryCodesResponse lists new recovery codes. They are shown only once.
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
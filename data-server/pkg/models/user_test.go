@@ -0,0 +1,26 @@
+package models
+
+import "testing"
+
+func TestRoleAllows(t *testing.T) {
+	tests := []struct {
+		role     string
+		required string
+		want     bool
+	}{
+		{role: UserRoleAdmin, required: UserRoleAdmin, want: true},
+		{role: UserRoleAdmin, required: UserRoleViewer, want: true},
+		{role: UserRoleOperator, required: UserRoleViewer, want: true},
+		{role: UserRoleOperator, required: UserRoleOperator, want: true},
+		{role: UserRoleOperator, required: UserRoleAdmin, want: false},
+		{role: UserRoleViewer, required: UserRoleOperator, want: false},
+		{role: "", required: UserRoleViewer, want: false},
+		{role: "root", required: UserRoleViewer, want: false},
+	}
+
+	for _, tt := range tests {
+		if got := RoleAllows(tt.role, tt.required); got != tt.want {
+			t.Errorf("RoleAllows(%q, %q) = %v, want %v", tt.role, tt.required, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,5 @@
+// Package speedtestpb contains the generated protobuf and gRPC code for the
+// node ingestion protocol defined in proto/speedtest/v1/ingest.proto.
+package speedtestpb
+
+//go:generate protoc -I ../../../proto --go_out=../.. --go_opt=module=mark7888/speedtest-data-server --go_opt=Mspeedtest/v1/ingest.proto=mark7888/speedtest-data-server/pkg/speedtestpb --go-grpc_out=../.. --go-grpc_opt=module=mark7888/speedtest-data-server --go-grpc_opt=Mspeedtest/v1/ingest.proto=mark7888/speedtest-data-server/pkg/speedtestpb speedtest/v1/ingest.proto
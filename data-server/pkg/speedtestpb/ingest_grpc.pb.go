@@ -0,0 +1,258 @@
+// Ingestion protocol between speedtest nodes and the data server.
+//
+// This is the binary equivalent of the node-facing REST endpoints
+// (/api/v1/node/alive, /api/v1/measurements and /api/v1/measurements/failed)
+// and has the same semantics. Clients authenticate by sending their API key
+// in the "authorization" metadata entry as "Bearer <key>".
+//
+// Generated Go code lives in each module (data-server/pkg/speedtestpb and
+// speedtest-node/pkg/speedtestpb); run `go generate ./...` in either module
+// after changing this file.
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.6.2
+// - protoc             v5.29.3
+// source: speedtest/v1/ingest.proto
+
+package speedtestpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	IngestService_Alive_FullMethodName                    = "/speedtest.v1.IngestService/Alive"
+	IngestService_SubmitMeasurements_FullMethodName       = "/speedtest.v1.IngestService/SubmitMeasurements"
+	IngestService_SubmitFailedMeasurements_FullMethodName = "/speedtest.v1.IngestService/SubmitFailedMeasurements"
+	IngestService_ReportCommandResult_FullMethodName      = "/speedtest.v1.IngestService/ReportCommandResult"
+)
+
+// IngestServiceClient is the client API for IngestService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// IngestService accepts alive signals and measurement batches from nodes
+type IngestServiceClient interface {
+	// Alive registers the node and refreshes its last-alive time
+	Alive(ctx context.Context, in *AliveRequest, opts ...grpc.CallOption) (*AliveResponse, error)
+	// SubmitMeasurements stores a batch of successful measurements
+	SubmitMeasurements(ctx context.Context, in *SubmitMeasurementsRequest, opts ...grpc.CallOption) (*SubmitMeasurementsResponse, error)
+	// SubmitFailedMeasurements stores a batch of failed test attempts
+	SubmitFailedMeasurements(ctx context.Context, in *SubmitFailedMeasurementsRequest, opts ...grpc.CallOption) (*SubmitFailedMeasurementsResponse, error)
+	// ReportCommandResult records progress on a command delivered in an AliveResponse
+	ReportCommandResult(ctx context.Context, in *ReportCommandResultRequest, opts ...grpc.CallOption) (*ReportCommandResultResponse, error)
+}
+
+type ingestServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewIngestServiceClient(cc grpc.ClientConnInterface) IngestServiceClient {
+	return &ingestServiceClient{cc}
+}
+
+func (c *ingestServiceClient) Alive(ctx context.Context, in *AliveRequest, opts ...grpc.CallOption) (*AliveResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(AliveResponse)
+	err := c.cc.Invoke(ctx, IngestService_Alive_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *ingestServiceClient) SubmitMeasurements(ctx context.Context, in *SubmitMeasurementsRequest, opts ...grpc.CallOption) (*SubmitMeasurementsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SubmitMeasurementsResponse)
+	err := c.cc.Invoke(ctx, IngestService_SubmitMeasurements_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *ingestServiceClient) SubmitFailedMeasurements(ctx context.Context, in *SubmitFailedMeasurementsRequest, opts ...grpc.CallOption) (*SubmitFailedMeasurementsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SubmitFailedMeasurementsResponse)
+	err := c.cc.Invoke(ctx, IngestService_SubmitFailedMeasurements_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *ingestServiceClient) ReportCommandResult(ctx context.Context, in *ReportCommandResultRequest, opts ...grpc.CallOption) (*ReportCommandResultResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ReportCommandResultResponse)
+	err := c.cc.Invoke(ctx, IngestService_ReportCommandResult_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// IngestServiceServer is the server API for IngestService service.
+// All implementations must embed UnimplementedIngestServiceServer
+// for forward compatibility.
+//
+// IngestService accepts alive signals and measurement batches from nodes
+type IngestServiceServer interface {
+	// Alive registers the node and refreshes its last-alive time
+	Alive(context.Context, *AliveRequest) (*AliveResponse, error)
+	// SubmitMeasurements stores a batch of successful measurements
+	SubmitMeasurements(context.Context, *SubmitMeasurementsRequest) (*SubmitMeasurementsResponse, error)
+	// SubmitFailedMeasurements stores a batch of failed test attempts
+	SubmitFailedMeasurements(context.Context, *SubmitFailedMeasurementsRequest) (*SubmitFailedMeasurementsResponse, error)
+	// ReportCommandResult records progress on a command delivered in an AliveResponse
+	ReportCommandResult(context.Context, *ReportCommandResultRequest) (*ReportCommandResultResponse, error)
+	mustEmbedUnimplementedIngestServiceServer()
+}
+
+// UnimplementedIngestServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedIngestServiceServer struct{}
+
+func (UnimplementedIngestServiceServer) Alive(context.Context, *AliveRequest) (*AliveResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method Alive not implemented")
+}
+func (UnimplementedIngestServiceServer) SubmitMeasurements(context.Context, *SubmitMeasurementsRequest) (*SubmitMeasurementsResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method SubmitMeasurements not implemented")
+}
+func (UnimplementedIngestServiceServer) SubmitFailedMeasurements(context.Context, *SubmitFailedMeasurementsRequest) (*SubmitFailedMeasurementsResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method SubmitFailedMeasurements not implemented")
+}
+func (UnimplementedIngestServiceServer) ReportCommandResult(context.Context, *ReportCommandResultRequest) (*ReportCommandResultResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method ReportCommandResult not implemented")
+}
+func (UnimplementedIngestServiceServer) mustEmbedUnimplementedIngestServiceServer() {}
+func (UnimplementedIngestServiceServer) testEmbeddedByValue()                       {}
+
+// UnsafeIngestServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to IngestServiceServer will
+// result in compilation errors.
+type UnsafeIngestServiceServer interface {
+	mustEmbedUnimplementedIngestServiceServer()
+}
+
+func RegisterIngestServiceServer(s grpc.ServiceRegistrar, srv IngestServiceServer) {
+	// If the following call panics, it indicates UnimplementedIngestServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&IngestService_ServiceDesc, srv)
+}
+
+func _IngestService_Alive_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AliveRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(IngestServiceServer).Alive(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: IngestService_Alive_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(IngestServiceServer).Alive(ctx, req.(*AliveRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _IngestService_SubmitMeasurements_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SubmitMeasurementsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(IngestServiceServer).SubmitMeasurements(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: IngestService_SubmitMeasurements_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(IngestServiceServer).SubmitMeasurements(ctx, req.(*SubmitMeasurementsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _IngestService_SubmitFailedMeasurements_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SubmitFailedMeasurementsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(IngestServiceServer).SubmitFailedMeasurements(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: IngestService_SubmitFailedMeasurements_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(IngestServiceServer).SubmitFailedMeasurements(ctx, req.(*SubmitFailedMeasurementsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _IngestService_ReportCommandResult_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReportCommandResultRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(IngestServiceServer).ReportCommandResult(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: IngestService_ReportCommandResult_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(IngestServiceServer).ReportCommandResult(ctx, req.(*ReportCommandResultRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// IngestService_ServiceDesc is the grpc.ServiceDesc for IngestService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var IngestService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "speedtest.v1.IngestService",
+	HandlerType: (*IngestServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Alive",
+			Handler:    _IngestService_Alive_Handler,
+		},
+		{
+			MethodName: "SubmitMeasurements",
+			Handler:    _IngestService_SubmitMeasurements_Handler,
+		},
+		{
+			MethodName: "SubmitFailedMeasurements",
+			Handler:    _IngestService_SubmitFailedMeasurements_Handler,
+		},
+		{
+			MethodName: "ReportCommandResult",
+			Handler:    _IngestService_ReportCommandResult_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "speedtest/v1/ingest.proto",
+}
@@ -1,4 +1,9 @@
-import { LoginRequest, LoginResponse } from '@/modules/auth/types/auth.types';
+import {
+  LoginRequest,
+  LoginResponse,
+  MFAChallengeResponse,
+  MFALoginRequest,
+} from '@/modules/auth/types/auth.types';
 import { NodesResponse, NodeDetails } from '@/modules/nodes/types/node.types';
 import {
   MeasurementsResponse,
@@ -22,7 +27,9 @@ import { HealthResponse } from '@/shared/types/common.types';
  */
 export interface IApiClient {
   // Auth
-  login(credentials: LoginRequest): Promise<LoginResponse>;
+  login(credentials: LoginRequest): Promise<LoginResponse | MFAChallengeResponse>;
+  loginMFA(request: MFALoginRequest): Promise<LoginResponse>;
+  logout(): Promise<void>;
 
   // Nodes
   getNodes(): Promise<NodesResponse>;
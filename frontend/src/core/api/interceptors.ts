@@ -1,6 +1,39 @@
+import { InternalAxiosRequestConfig } from 'axios';
 import api from './axiosConfig';
 import { showToast } from '@/shared/services/toastService';
 import { isMockMode } from '@/core/config/env';
+import { STORAGE_KEYS } from '@/shared/utils/constants';
+import { RefreshTokenResponse } from '@/modules/auth/types/auth.types';
+
+const REFRESH_URL = '/api/v1/admin/refresh';
+
+// A 401 from these means wrong credentials, not an expired session
+const LOGIN_URLS = ['/api/v1/admin/login', '/api/v1/admin/login/mfa'];
+
+let refreshing: Promise<void> | null = null;
+
+/**
+ * Exchange the stored refresh token for a new access token and refresh token.
+ * Requests failing at the same time share one refresh, since each refresh
+ * token works only once.
+ */
+function refreshTokens(): Promise<void> {
+  if (!refreshing) {
+    const refreshToken = localStorage.getItem(STORAGE_KEYS.REFRESH_TOKEN);
+    const request = refreshToken
+      ? api.post<RefreshTokenResponse>(REFRESH_URL, { refresh_token: refreshToken })
+      : Promise.reject(new Error('No refresh token'));
+    refreshing = request
+      .then((response) => {
+        localStorage.setItem(STORAGE_KEYS.TOKEN, response.data.token);
+        localStorage.setItem(STORAGE_KEYS.REFRESH_TOKEN, response.data.refresh_token);
+      })
+      .finally(() => {
+        refreshing = null;
+      });
+  }
+  return refreshing;
+}
 
 /**
  * Setup axios interceptors for authentication and error handling.
@@ -28,10 +61,30 @@ export const setupInterceptors = (
   // Response interceptor: Handle auth errors
   api.interceptors.response.use(
     (response) => response,
-    (error) => {
+    async (error) => {
+      const request = error.config as (InternalAxiosRequestConfig & { _retried?: boolean }) | undefined;
+
+      // A failed refresh is handled by the request that triggered it, and a
+      // failed login by the login page
+      if (request?.url === REFRESH_URL || (request?.url && LOGIN_URLS.includes(request.url))) {
+        return Promise.reject(error);
+      }
+
+      // Access tokens are short-lived: get a new one and retry once
+      if (error.response?.status === 401 && request && !request._retried) {
+        request._retried = true;
+        try {
+          await refreshTokens();
+          return api(request);
+        } catch {
+          // The session has ended; fall through to logging out
+        }
+      }
+
       if (error.response?.status === 401) {
         // Clear token and redirect to login
         localStorage.removeItem('token');
+        localStorage.removeItem(STORAGE_KEYS.REFRESH_TOKEN);
         localStorage.removeItem('username');
         onUnauthorized();
         showToast.error('Session expired. Please login again.');
@@ -1,5 +1,5 @@
 import { IApiClient } from './IApiClient';
-import { LoginRequest, LoginResponse } from '@/modules/auth/types/auth.types';
+import { LoginRequest, LoginResponse, MFALoginRequest } from '@/modules/auth/types/auth.types';
 import { Node, NodeDetails, NodesResponse } from '@/modules/nodes/types/node.types';
 import {
   Measurement,
@@ -306,6 +306,12 @@ export const mockApiClient: IApiClient = {
     return { token: 'mock-token', username: 'demo' };
   },
 
+  async loginMFA(_request: MFALoginRequest): Promise<LoginResponse> {
+    return { token: 'mock-token', username: 'demo' };
+  },
+
+  async logout(): Promise<void> {},
+
   // ── Nodes ────────────────────────────────────────────────────────────────
 
   async getNodes(): Promise<NodesResponse> {
@@ -1,6 +1,11 @@
 import api from './axiosConfig';
 import { IApiClient } from './IApiClient';
-import { LoginRequest, LoginResponse } from '@/modules/auth/types/auth.types';
+import {
+  LoginRequest,
+  LoginResponse,
+  MFAChallengeResponse,
+  MFALoginRequest,
+} from '@/modules/auth/types/auth.types';
 import { NodesResponse, NodeDetails } from '@/modules/nodes/types/node.types';
 import {
   MeasurementsResponse,
@@ -23,11 +28,20 @@ import { HealthResponse } from '@/shared/types/common.types';
 export const realApiClient: IApiClient = {
   // ── Auth ──────────────────────────────────────────────────────────────────
 
-  async login(credentials: LoginRequest): Promise<LoginResponse> {
-    const response = await api.post<LoginResponse>('/api/v1/admin/login', credentials);
+  async login(credentials: LoginRequest): Promise<LoginResponse | MFAChallengeResponse> {
+    const response = await api.post<LoginResponse | MFAChallengeResponse>('/api/v1/admin/login', credentials);
+    return response.data;
+  },
+
+  async loginMFA(request: MFALoginRequest): Promise<LoginResponse> {
+    const response = await api.post<LoginResponse>('/api/v1/admin/login/mfa', request);
     return response.data;
   },
 
+  async logout(): Promise<void> {
+    await api.post('/api/v1/admin/logout');
+  },
+
   // ── Nodes ─────────────────────────────────────────────────────────────────
 
   async getNodes(): Promise<NodesResponse> {
@@ -1,6 +1,7 @@
 import { useState, FormEvent, useEffect } from 'react';
 import { useNavigate } from 'react-router-dom';
 import { useAuth } from '../hooks/useAuth';
+import { useAuthStore } from '../store/authStore';
 import Input from '@/shared/components/ui/Input';
 import Button from '@/shared/components/ui/Button';
 import { showToast } from '@/shared/services/toastService';
@@ -10,9 +11,10 @@ import { showToast } from '@/shared/services/toastService';
  */
 export default function LoginPage() {
   const navigate = useNavigate();
-  const { isAuthenticated, isLoading, error, login, clearError } = useAuth();
+  const { isAuthenticated, isLoading, error, mfaRequired, login, verifyMFA, cancelMFA, clearError } = useAuth();
   const [username, setUsername] = useState('');
   const [password, setPassword] = useState('');
+  const [code, setCode] = useState('');
 
   // Redirect if already authenticated
   useEffect(() => {
@@ -36,6 +38,8 @@ export default function LoginPage() {
 
     try {
       await login({ username, password });
+      // Accounts with two-factor authentication continue with a code
+      if (!useAuthStore.getState().isAuthenticated) return;
       showToast.success('Login successful!');
       navigate('/dashboard', { replace: true });
     } catch (err) {
@@ -43,6 +47,31 @@ export default function LoginPage() {
     }
   };
 
+  const handleVerify = async (e: FormEvent) => {
+    e.preventDefault();
+
+    if (!code.trim()) {
+      showToast.error('Please enter a code');
+      return;
+    }
+
+    try {
+      await verifyMFA(code.trim());
+      showToast.success('Login successful!');
+      navigate('/dashboard', { replace: true });
+    } catch (err) {
+      // Error is already set in store and displayed
+      setCode('');
+    }
+  };
+
+  // Start over with the password, e.g. after too many wrong codes
+  const handleCancel = () => {
+    cancelMFA();
+    setCode('');
+    setPassword('');
+  };
+
   return (
     <div className="min-h-screen flex items-center justify-center bg-base-200">
       <div className="card w-full max-w-md bg-base-100 shadow-2xl">
@@ -64,40 +93,81 @@ export default function LoginPage() {
             </div>
           )}
 
-          {/* Login Form */}
-          <form onSubmit={handleSubmit} className="space-y-4">
-            <Input
-              label="Username"
-              type="text"
-              placeholder="Enter your username"
-              value={username}
-              onChange={(e) => setUsername(e.target.value)}
-              disabled={isLoading}
-              required
-              autoComplete="username"
-            />
-
-            <Input
-              label="Password"
-              type="password"
-              placeholder="Enter your password"
-              value={password}
-              onChange={(e) => setPassword(e.target.value)}
-              disabled={isLoading}
-              required
-              autoComplete="current-password"
-            />
-
-            <Button
-              type="submit"
-              variant="primary"
-              className="w-full mt-6"
-              loading={isLoading}
-              disabled={isLoading}
-            >
-              {isLoading ? 'Signing in...' : 'Sign In'}
-            </Button>
-          </form>
+          {mfaRequired ? (
+            /* Two-factor code */
+            <form onSubmit={handleVerify} className="space-y-4">
+              <p className="text-sm text-base-content/70">
+                Enter the code from your authenticator app, or one of your recovery codes.
+              </p>
+
+              <Input
+                label="Code"
+                type="text"
+                placeholder="123456"
+                value={code}
+                onChange={(e) => setCode(e.target.value)}
+                disabled={isLoading}
+                required
+                autoFocus
+                autoComplete="one-time-code"
+              />
+
+              <Button
+                type="submit"
+                variant="primary"
+                className="w-full mt-6"
+                loading={isLoading}
+                disabled={isLoading}
+              >
+                {isLoading ? 'Verifying...' : 'Verify'}
+              </Button>
+
+              <Button
+                type="button"
+                variant="ghost"
+                className="w-full"
+                onClick={handleCancel}
+                disabled={isLoading}
+              >
+                Back to sign in
+              </Button>
+            </form>
+          ) : (
+            /* Login Form */
+            <form onSubmit={handleSubmit} className="space-y-4">
+              <Input
+                label="Username"
+                type="text"
+                placeholder="Enter your username"
+                value={username}
+                onChange={(e) => setUsername(e.target.value)}
+                disabled={isLoading}
+                required
+                autoComplete="username"
+              />
+
+              <Input
+                label="Password"
+                type="password"
+                placeholder="Enter your password"
+                value={password}
+                onChange={(e) => setPassword(e.target.value)}
+                disabled={isLoading}
+                required
+                autoComplete="current-password"
+              />
+
+              <Button
+                type="submit"
+                variant="primary"
+                className="w-full mt-6"
+                loading={isLoading}
+                disabled={isLoading}
+              >
+                {isLoading ? 'Signing in...' : 'Sign In'}
+              </Button>
+            </form>
+          )}
 
           {/* Footer */}
           <div className="text-center mt-6 text-sm text-base-content/60">
@@ -9,7 +9,10 @@ export function useAuth() {
     isLoading,
     error,
     username,
+    mfaToken,
     login,
+    verifyMFA,
+    cancelMFA,
     logout,
     checkAuth,
     clearError,
@@ -20,7 +23,10 @@ export function useAuth() {
     isLoading,
     error,
     username,
+    mfaRequired: !!mfaToken,
     login,
+    verifyMFA,
+    cancelMFA,
     logout,
     checkAuth,
     clearError,
@@ -1,21 +1,52 @@
 import { apiClient } from '@/core/api/apiClient';
-import { LoginRequest, LoginResponse } from '../types/auth.types';
+import {
+  LoginRequest,
+  LoginResponse,
+  MFAChallengeResponse,
+  MFALoginRequest,
+} from '../types/auth.types';
+import { STORAGE_KEYS } from '@/shared/utils/constants';
 
 /**
  * Authentication API service
  */
 
 /**
- * Login with username and password
+ * Login with username and password. Accounts with two-factor authentication
+ * get an MFA challenge instead of a session; complete it with loginMFA.
  */
-export async function login(credentials: LoginRequest): Promise<LoginResponse> {
+export async function login(credentials: LoginRequest): Promise<LoginResponse | MFAChallengeResponse> {
   return apiClient.login(credentials);
 }
 
 /**
- * Logout (client-side only — clear token)
+ * Complete a login with a code from the authenticator app or a recovery code
  */
-export function logout(): void {
-  localStorage.removeItem('token');
-  localStorage.removeItem('username');
+export async function loginMFA(request: MFALoginRequest): Promise<LoginResponse> {
+  return apiClient.loginMFA(request);
+}
+
+/**
+ * Whether a login response is an MFA challenge rather than a session
+ */
+export function isMFAChallenge(
+  response: LoginResponse | MFAChallengeResponse
+): response is MFAChallengeResponse {
+  return 'mfa_required' in response && response.mfa_required === true;
+}
+
+/**
+ * Logout — end the session on the server, then clear the tokens. The tokens
+ * are cleared even if the server cannot be reached.
+ */
+export async function logout(): Promise<void> {
+  try {
+    await apiClient.logout();
+  } catch {
+    // The session expires on its own
+  } finally {
+    localStorage.removeItem('token');
+    localStorage.removeItem(STORAGE_KEYS.REFRESH_TOKEN);
+    localStorage.removeItem('username');
+  }
 }
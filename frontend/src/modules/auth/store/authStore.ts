@@ -1,5 +1,5 @@
 import { create } from 'zustand';
-import { LoginRequest } from '../types/auth.types';
+import { LoginRequest, LoginResponse } from '../types/auth.types';
 import * as authService from '../services/authService';
 import { STORAGE_KEYS } from '@/shared/utils/constants';
 import { isMockMode } from '@/core/config/env';
@@ -10,34 +10,62 @@ interface AuthStore {
   isAuthenticated: boolean;
   isLoading: boolean;
   error: string | null;
+  // Set while a login waits for a two-factor code
+  mfaToken: string | null;
 
   login: (credentials: LoginRequest) => Promise<void>;
+  verifyMFA: (code: string) => Promise<void>;
+  cancelMFA: () => void;
   logout: () => void;
   checkAuth: () => void;
   clearError: () => void;
 }
 
+/**
+ * Store the tokens of a new session
+ */
+function saveSession(data: LoginResponse) {
+  localStorage.setItem(STORAGE_KEYS.TOKEN, data.token);
+  if (data.refresh_token) {
+    localStorage.setItem(STORAGE_KEYS.REFRESH_TOKEN, data.refresh_token);
+  }
+  localStorage.setItem(STORAGE_KEYS.USERNAME, data.username);
+}
+
+/**
+ * The error message of a failed login request
+ */
+function loginError(error: unknown, fallback: string): string {
+  const err = error as { response?: { data?: { error?: string } } };
+  return err.response?.data?.error || fallback;
+}
+
 /**
  * Authentication store using Zustand.
  * In mock mode the user is automatically considered authenticated (no login required).
  */
-export const useAuthStore = create<AuthStore>((set) => ({
+export const useAuthStore = create<AuthStore>((set, get) => ({
   token: isMockMode ? 'mock-token' : localStorage.getItem(STORAGE_KEYS.TOKEN),
   username: isMockMode ? 'demo' : localStorage.getItem(STORAGE_KEYS.USERNAME),
   isAuthenticated: isMockMode ? true : !!localStorage.getItem(STORAGE_KEYS.TOKEN),
   isLoading: false,
   error: null,
+  mfaToken: null,
 
   login: async (credentials) => {
     if (isMockMode) {
       set({ token: 'mock-token', username: 'demo', isAuthenticated: true, isLoading: false, error: null });
       return;
     }
-    set({ isLoading: true, error: null });
+    set({ isLoading: true, error: null, mfaToken: null });
     try {
       const data = await authService.login(credentials);
-      localStorage.setItem(STORAGE_KEYS.TOKEN, data.token);
-      localStorage.setItem(STORAGE_KEYS.USERNAME, data.username);
+      if (authService.isMFAChallenge(data)) {
+        // The password was right; the session comes with the code
+        set({ mfaToken: data.mfa_token, isLoading: false });
+        return;
+      }
+      saveSession(data);
       set({
         token: data.token,
         username: data.username,
@@ -46,21 +74,50 @@ export const useAuthStore = create<AuthStore>((set) => ({
         error: null,
       });
     } catch (error: unknown) {
-      const err = error as { response?: { data?: { error?: string } } };
-      const errorMessage = err.response?.data?.error || 'Login failed. Please try again.';
       set({
         isLoading: false,
-        error: errorMessage,
+        error: loginError(error, 'Login failed. Please try again.'),
       });
       throw error;
     }
   },
 
+  verifyMFA: async (code) => {
+    const mfaToken = get().mfaToken;
+    if (!mfaToken) return;
+    set({ isLoading: true, error: null });
+    try {
+      const data = await authService.loginMFA({ mfa_token: mfaToken, code });
+      saveSession(data);
+      set({
+        token: data.token,
+        username: data.username,
+        isAuthenticated: true,
+        isLoading: false,
+        error: null,
+        mfaToken: null,
+      });
+    } catch (error: unknown) {
+      // The challenge stays for another try; the server ends it after too
+      // many wrong codes, and the password has to be entered again
+      set({
+        isLoading: false,
+        error: loginError(error, 'Verification failed. Please try again.'),
+      });
+      throw error;
+    }
+  },
+
+  cancelMFA: () => {
+    set({ mfaToken: null, error: null });
+  },
+
   logout: () => {
     if (isMockMode) {
       // In mock mode, skip backend logout and navigation but ensure any real
       // credentials (if present) are cleared from storage and state.
       localStorage.removeItem(STORAGE_KEYS.TOKEN);
+      localStorage.removeItem(STORAGE_KEYS.REFRESH_TOKEN);
       localStorage.removeItem(STORAGE_KEYS.USERNAME);
       set({
         token: 'mock-token',
@@ -70,14 +127,15 @@ export const useAuthStore = create<AuthStore>((set) => ({
       });
       return;
     }
-    authService.logout();
     set({
       token: null,
       username: null,
       isAuthenticated: false,
       error: null,
     });
-    window.location.href = '/login';
+    authService.logout().finally(() => {
+      window.location.href = '/login';
+    });
   },
 
   checkAuth: () => {
@@ -9,9 +9,35 @@ export interface LoginRequest {
 
 export interface LoginResponse {
   token: string;
+  refresh_token?: string;
   username: string;
 }
 
+/**
+ * The answer to a correct password for an account with two-factor
+ * authentication. The login is completed by sending the MFA token with a
+ * code from the authenticator app or a recovery code.
+ */
+export interface MFAChallengeResponse {
+  mfa_required: true;
+  mfa_token: string;
+  expires_at: string;
+}
+
+export interface MFALoginRequest {
+  mfa_token: string;
+  code: string;
+}
+
+/**
+ * A new access token and refresh token. The refresh token that was sent
+ * no longer works.
+ */
+export interface RefreshTokenResponse {
+  token: string;
+  refresh_token: string;
+}
+
 export interface AuthState {
   token: string | null;
   username: string | null;
@@ -36,11 +36,26 @@ export interface NodeStatistics {
   failed_count_24h: number;       // Failed measurements in last 24h
 }
 
+export interface NodeInventory {
+  version: string;
+  backends: string[];             // Speedtest backends found on the node's host
+  os: string;
+  kernel?: string;
+  arch: string;
+  uptime_seconds: number;         // Since the node process started
+  db_size_bytes: number;
+  unsent_measurements: number;
+  unsent_failed_measurements: number;
+  last_successful_test?: string;
+}
+
 export interface NodeDetails extends Node {
   total_measurements: number;
   failed_test_count: number;
   latest_measurement?: LatestMeasurement;
   statistics: NodeStatistics;
+  inventory?: NodeInventory;      // Latest snapshot sent with the node's alive signal
+  inventory_reported_at?: string;
 }
 
 export interface NodesResponse {
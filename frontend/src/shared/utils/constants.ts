@@ -42,6 +42,7 @@ export const STATUS_BADGE_CLASS: Record<NodeStatus, string> = {
 // Local storage keys
 export const STORAGE_KEYS = {
   TOKEN: 'token',
+  REFRESH_TOKEN: 'refreshToken',
   USERNAME: 'username',
   THEME: 'theme',
 } as const;
@@ -0,0 +1,567 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"mark7888/speedtest-node/internal/config"
+	"mark7888/speedtest-node/internal/db"
+	"mark7888/speedtest-node/internal/speedtest"
+	"mark7888/speedtest-node/internal/sync"
+	"mark7888/speedtest-node/internal/version"
+	"mark7888/speedtest-node/pkg/models"
+
+	"github.com/google/uuid"
+	"github.com/spf13/pflag"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Exit codes. Docker HEALTHCHECK only distinguishes 0 (healthy) from 1
+// (unhealthy) and reserves 2, so healthcheck never returns anything else.
+const (
+	exitOK      = 0
+	exitFailure = 1
+	exitUsage   = 64 // EX_USAGE from sysexits.h
+)
+
+// Local config keys
+const (
+	nodeIDKey = "node_id" // The node's identity
+	apiKeyKey = "api_key" // API key obtained by enrolling
+)
+
+// enrollmentTokenEnv lets images carry the enrollment token in their
+// environment instead of the command line
+const enrollmentTokenEnv = "SPEEDTEST_ENROLLMENT_TOKEN"
+
+// command is an operational subcommand run instead of the node
+type command struct {
+	summary string
+	flags   func(flags *pflag.FlagSet)
+	run     func(cfg *config.Config, flags *pflag.FlagSet) int
+}
+
+// commands are the subcommands by name. They read the same flags and
+// SPEEDTEST_ environment variables as the node, so inside the container
+// they find its database without extra arguments.
+var commands = map[string]command{
+	"run-once": {
+		summary: "Run one speedtest now, store it and print the result",
+		flags: func(flags *pflag.FlagSet) {
+			flags.Bool("json", false, "Print the measurement as JSON")
+		},
+		run: runOnce,
+	},
+	"status": {
+		summary: "Show the node ID, backlog and latest results from the local database",
+		flags: func(flags *pflag.FlagSet) {
+			flags.Bool("json", false, "Print the status as JSON")
+		},
+		run: runStatus,
+	},
+	"export": {
+		summary: "Export results from the local database as CSV or NDJSON",
+		flags: func(flags *pflag.FlagSet) {
+			flags.String("format", "csv", "Output format: csv or ndjson")
+			flags.String("since", "", "Start of the range: RFC 3339 time, date (YYYY-MM-DD) or age such as 24h (default: everything)")
+			flags.String("until", "", "End of the range, exclusive, in the same forms as --since (default: now and later)")
+			flags.Bool("failed", false, "Export failed measurements instead of measurements")
+			flags.StringP("output", "o", "", "Write to this file instead of stdout")
+		},
+		run: runExport,
+	},
+	"resync": {
+		summary: "Queue results in a time range to be sent to the server again",
+		flags: func(flags *pflag.FlagSet) {
+			flags.String("since", "", "Start of the range: RFC 3339 time, date (YYYY-MM-DD) or age such as 24h (required)")
+			flags.String("until", "", "End of the range, exclusive, in the same forms as --since (default: now and later)")
+		},
+		run: runResync,
+	},
+	"reset-id": {
+		summary: "Replace the node ID so the server sees this node as a new one",
+		flags: func(flags *pflag.FlagSet) {
+			flags.Bool("yes", false, "Confirm replacing the node ID")
+		},
+		run: runResetID,
+	},
+	"enroll": {
+		summary: "Exchange a one-time enrollment token for this node's own API key",
+		flags: func(flags *pflag.FlagSet) {
+			flags.String("token", "", "Enrollment token from the server admin (default: "+enrollmentTokenEnv+")")
+			flags.Bool("force", false, "Enroll again even if the node already has a key")
+		},
+		run: runEnroll,
+	},
+	"csr": {
+		summary: "Write a certificate signing request for this node's client certificate",
+		flags: func(flags *pflag.FlagSet) {
+			flags.String("key", "", "Private key file, generated if missing (default: --tls-client-key)")
+			flags.StringP("output", "o", "", "Write the CSR to this file instead of stdout")
+		},
+		run: runCSR,
+	},
+	"healthcheck": {
+		summary: "Exit 0 if the node is healthy and 1 otherwise, for Docker HEALTHCHECK",
+		flags: func(flags *pflag.FlagSet) {
+			flags.Duration("max-age", 0, "Also fail if the latest test, successful or not, is older than this (0 disables)")
+		},
+		run: runHealthcheck,
+	},
+}
+
+// parseCommand takes the subcommand from the first argument, if there is
+// one, and removes it so the remaining flags parse as usual. ok is false
+// for an unknown command.
+func parseCommand() (name string, cmd command, ok bool) {
+	if len(os.Args) < 2 || strings.HasPrefix(os.Args[1], "-") {
+		return "", command{}, true
+	}
+
+	name = os.Args[1]
+	cmd, ok = commands[name]
+	os.Args = append(os.Args[:1], os.Args[2:]...)
+	return name, cmd, ok
+}
+
+// commandList returns the subcommands with their summaries for help text
+func commandList() string {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&b, "  %-13s %s\n", name, commands[name].summary)
+	}
+	return b.String()
+}
+
+// commandLogger logs warnings and errors to stderr, keeping stdout for
+// command output and leaving the node's log file alone
+func commandLogger() *zap.Logger {
+	encoderConfig := zap.NewDevelopmentEncoderConfig()
+	encoderConfig.TimeKey = ""
+	core := zapcore.NewCore(zapcore.NewConsoleEncoder(encoderConfig), zapcore.Lock(os.Stderr), zapcore.WarnLevel)
+	return zap.New(core)
+}
+
+// openDatabase opens the node's database. Commands that only read it refuse
+// to create one, which would hide a wrong --db-path.
+func openDatabase(cfg *config.Config, create bool, log *zap.Logger) (*db.DB, error) {
+	if !create {
+		if _, err := os.Stat(cfg.DBPath); err != nil {
+			return nil, fmt.Errorf("no database at %s: %w", cfg.DBPath, err)
+		}
+	}
+	return db.New(cfg.DBPath, log)
+}
+
+// loadNodeID returns the node ID, generating and storing one on first run
+func loadNodeID(database *db.DB) (nodeID string, generated bool, err error) {
+	nodeID, err = database.GetConfig(nodeIDKey)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to get node ID: %w", err)
+	}
+	if nodeID != "" {
+		return nodeID, false, nil
+	}
+
+	nodeID = uuid.New().String()
+	if err := database.SetConfig(nodeIDKey, nodeID); err != nil {
+		return "", false, fmt.Errorf("failed to store node ID: %w", err)
+	}
+	return nodeID, true, nil
+}
+
+// loadAPIKey fills in the API key stored by enrolling when none is
+// configured. A configured key always wins, so an enrolled node can still be
+// pointed at a different key. It reports whether the stored key is used.
+func loadAPIKey(cfg *config.Config, database *db.DB) (stored bool, err error) {
+	if cfg.APIKey != "" {
+		return false, nil
+	}
+	key, err := database.GetConfig(apiKeyKey)
+	if err != nil {
+		return false, fmt.Errorf("failed to get API key: %w", err)
+	}
+	cfg.APIKey = key
+	return key != "", nil
+}
+
+// fail reports a command error on stderr and returns the exit code
+func fail(code int, format string, args ...interface{}) int {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+	return code
+}
+
+// runOnce runs a single speedtest with the node's settings and stores the
+// result like a scheduled run, so it is sent to the server with the rest.
+// Server-managed settings are not applied.
+func runOnce(cfg *config.Config, flags *pflag.FlagSet) int {
+	asJSON, _ := flags.GetBool("json")
+	log := commandLogger()
+
+	database, err := openDatabase(cfg, true, log)
+	if err != nil {
+		return fail(exitFailure, "Failed to open database: %v", err)
+	}
+	defer database.Close()
+
+	executor := speedtest.NewExecutor(cfg.SpeedtestTimeout, cfg.RetryOnFailure, log)
+	measurement, err := executor.Run()
+	if err != nil {
+		if storeErr := database.InsertFailedMeasurement(time.Now().UTC(), err.Error(), 1, nil); storeErr != nil {
+			log.Warn("Failed to store failed measurement", zap.Error(storeErr))
+		}
+		return fail(exitFailure, "Speedtest failed: %v", err)
+	}
+
+	if err := database.InsertMeasurement(measurement); err != nil {
+		return fail(exitFailure, "Failed to store measurement: %v", err)
+	}
+
+	if asJSON {
+		return printJSON(measurement)
+	}
+	fmt.Println(describeMeasurement(measurement))
+	return exitOK
+}
+
+// statusReport is what the status command prints
+type statusReport struct {
+	NodeID        string                    `json:"node_id"`
+	NodeName      string                    `json:"node_name"`
+	Version       string                    `json:"version"`
+	DBPath        string                    `json:"db_path"`
+	DBSizeBytes   int64                     `json:"db_size_bytes"`
+	Backlog       models.Backlog            `json:"backlog"`
+	LastResult    *models.Measurement       `json:"last_result,omitempty"`
+	LastFailure   *models.FailedMeasurement `json:"last_failure,omitempty"`
+	ServerURL     string                    `json:"server_url,omitempty"`
+	Transport     string                    `json:"transport"`
+	APIKeyPresent bool                      `json:"api_key_present"`
+	ClientCert    bool                      `json:"client_certificate"`
+}
+
+// runStatus prints what the local database knows about the node. It works
+// whether or not the node is running.
+func runStatus(cfg *config.Config, flags *pflag.FlagSet) int {
+	asJSON, _ := flags.GetBool("json")
+
+	database, err := openDatabase(cfg, false, commandLogger())
+	if err != nil {
+		return fail(exitFailure, "Failed to open database: %v", err)
+	}
+	defer database.Close()
+
+	report, err := buildStatus(cfg, database)
+	if err != nil {
+		return fail(exitFailure, "Failed to read status: %v", err)
+	}
+
+	if asJSON {
+		return printJSON(report)
+	}
+	printStatus(os.Stdout, report)
+	return exitOK
+}
+
+// buildStatus collects the status report from the database
+func buildStatus(cfg *config.Config, database *db.DB) (*statusReport, error) {
+	report := &statusReport{
+		NodeName:  cfg.NodeName,
+		Version:   version.Get(),
+		DBPath:    cfg.DBPath,
+		ServerURL: cfg.ServerURL,
+		Transport: cfg.Transport,
+	}
+
+	stored, err := database.GetConfig(apiKeyKey)
+	if err != nil {
+		return nil, err
+	}
+	report.APIKeyPresent = cfg.APIKey != "" || stored != ""
+	report.ClientCert = cfg.TLSClientCert != ""
+
+	if report.NodeID, err = database.GetConfig(nodeIDKey); err != nil {
+		return nil, err
+	}
+	if report.DBSizeBytes, err = database.Size(); err != nil {
+		return nil, err
+	}
+	if report.Backlog.UnsentMeasurements, report.Backlog.UnsentFailedMeasurements, err = database.CountUnsent(); err != nil {
+		return nil, err
+	}
+	if report.LastResult, err = database.GetLastMeasurement(); err != nil {
+		return nil, err
+	}
+	failures, err := database.GetFailedMeasurementsSince(time.Time{}, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(failures) > 0 {
+		report.LastFailure = failures[0]
+	}
+
+	return report, nil
+}
+
+// printStatus writes the status report for people
+func printStatus(w io.Writer, r *statusReport) {
+	nodeID := r.NodeID
+	if nodeID == "" {
+		nodeID = "not generated yet"
+	}
+	server := "offline (no server URL or credentials)"
+	switch {
+	case r.APIKeyPresent && (r.ServerURL != "" || r.Transport == "mqtt"):
+		server = fmt.Sprintf("%s via %s", r.ServerURL, r.Transport)
+	case r.ClientCert && r.ServerURL != "" && r.Transport != "mqtt":
+		server = fmt.Sprintf("%s via %s with a client certificate", r.ServerURL, r.Transport)
+	}
+
+	fmt.Fprintf(w, "Node:          %s (%s)\n", r.NodeName, nodeID)
+	fmt.Fprintf(w, "Version:       %s\n", r.Version)
+	fmt.Fprintf(w, "Server:        %s\n", server)
+	fmt.Fprintf(w, "Database:      %s (%.1f MiB)\n", r.DBPath, float64(r.DBSizeBytes)/(1<<20))
+	fmt.Fprintf(w, "Unsent:        %d measurements, %d failed measurements\n",
+		r.Backlog.UnsentMeasurements, r.Backlog.UnsentFailedMeasurements)
+
+	if r.LastResult != nil {
+		fmt.Fprintf(w, "Last result:   %s\n", describeMeasurement(r.LastResult))
+	} else {
+		fmt.Fprintf(w, "Last result:   none\n")
+	}
+	if r.LastFailure != nil {
+		fmt.Fprintf(w, "Last failure:  %s %s\n", r.LastFailure.Timestamp.Local().Format(time.RFC3339), r.LastFailure.ErrorMessage)
+	} else {
+		fmt.Fprintf(w, "Last failure:  none\n")
+	}
+}
+
+// describeMeasurement summarizes a measurement on one line
+func describeMeasurement(m *models.Measurement) string {
+	parts := []string{m.Timestamp.Local().Format(time.RFC3339)}
+	if m.Download != nil {
+		parts = append(parts, fmt.Sprintf("download %.2f Mbps", mbps(m.Download.Bandwidth)))
+	}
+	if m.Upload != nil {
+		parts = append(parts, fmt.Sprintf("upload %.2f Mbps", mbps(m.Upload.Bandwidth)))
+	}
+	if m.Ping != nil {
+		parts = append(parts, fmt.Sprintf("ping %.1f ms", m.Ping.Latency), fmt.Sprintf("jitter %.1f ms", m.Ping.Jitter))
+	}
+	parts = append(parts, fmt.Sprintf("packet loss %.1f%%", m.PacketLoss))
+	if m.Server != nil && m.Server.Name != "" {
+		parts = append(parts, fmt.Sprintf("server %s (%s)", m.Server.Name, m.Server.Location))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// mbps converts a bandwidth in bytes per second to megabits per second
+func mbps(bytesPerSecond int64) float64 {
+	return float64(bytesPerSecond) * 8 / 1e6
+}
+
+// printJSON writes v to stdout as indented JSON
+func printJSON(v interface{}) int {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		return fail(exitFailure, "Failed to write output: %v", err)
+	}
+	return exitOK
+}
+
+// runResetID gives the node a new identity. The server then tracks it as a
+// new node; the old one goes offline there. Use it for cloned images or
+// volumes where two nodes ended up with the same ID.
+func runResetID(cfg *config.Config, flags *pflag.FlagSet) int {
+	if yes, _ := flags.GetBool("yes"); !yes {
+		return fail(exitUsage, "This gives the node a new identity on the server. Run again with --yes to confirm.")
+	}
+
+	database, err := openDatabase(cfg, false, commandLogger())
+	if err != nil {
+		return fail(exitFailure, "Failed to open database: %v", err)
+	}
+	defer database.Close()
+
+	oldID, err := database.GetConfig(nodeIDKey)
+	if err != nil {
+		return fail(exitFailure, "Failed to get node ID: %v", err)
+	}
+	newID := uuid.New().String()
+	if err := database.SetConfig(nodeIDKey, newID); err != nil {
+		return fail(exitFailure, "Failed to store node ID: %v", err)
+	}
+
+	if oldID == "" {
+		oldID = "none"
+	}
+	fmt.Printf("Node ID changed from %s to %s\n", oldID, newID)
+	fmt.Println("Restart the node to use the new ID.")
+	return exitOK
+}
+
+// runEnroll presents an enrollment token to the server and stores the API
+// key it returns, bound to this node's ID. A node that already has a key is
+// left alone, so images can run this on every start with the token baked in.
+func runEnroll(cfg *config.Config, flags *pflag.FlagSet) int {
+	token, _ := flags.GetString("token")
+	if token == "" {
+		token = os.Getenv(enrollmentTokenEnv)
+	}
+	if token == "" {
+		return fail(exitUsage, "An enrollment token is required: pass --token or set %s.", enrollmentTokenEnv)
+	}
+	if cfg.ServerURL == "" {
+		return fail(exitUsage, "A server URL is required to enroll.")
+	}
+	force, _ := flags.GetBool("force")
+	log := commandLogger()
+
+	database, err := openDatabase(cfg, true, log)
+	if err != nil {
+		return fail(exitFailure, "Failed to open database: %v", err)
+	}
+	defer database.Close()
+
+	existing, err := database.GetConfig(apiKeyKey)
+	if err != nil {
+		return fail(exitFailure, "Failed to get API key: %v", err)
+	}
+	if existing != "" && !force {
+		fmt.Println("Node is already enrolled; run again with --force to replace its key.")
+		return exitOK
+	}
+
+	nodeID, _, err := loadNodeID(database)
+	if err != nil {
+		return fail(exitFailure, "%v", err)
+	}
+
+	// The server only trusts the token here, so no client certificate
+	tlsConfig, err := sync.NewTLSConfig(cfg.TLSVerify, cfg.TLSCACert, "", "")
+	if err != nil {
+		return fail(exitFailure, "Failed to load TLS settings: %v", err)
+	}
+	client := sync.NewClient(cfg.ServerURL, "", cfg.ServerTimeout, tlsConfig, "none", log)
+	response, err := client.Enroll(context.Background(), token, nodeID, cfg.NodeName)
+	if err != nil {
+		return fail(exitFailure, "Enrollment failed: %v", err)
+	}
+	if err := database.SetConfig(apiKeyKey, response.Key); err != nil {
+		return fail(exitFailure, "Failed to store API key: %v", err)
+	}
+
+	fmt.Printf("Enrolled node %s (%s) with API key %s\n", cfg.NodeName, nodeID, response.APIKeyID)
+	if cfg.APIKey != "" {
+		fmt.Println("An API key is also configured and takes precedence; remove it to use the enrolled key.")
+	}
+	return exitOK
+}
+
+// runHealthcheck checks the running node through its status endpoint when
+// one is configured, and the database otherwise
+func runHealthcheck(cfg *config.Config, flags *pflag.FlagSet) int {
+	maxAge, _ := flags.GetDuration("max-age")
+
+	if err := healthcheck(cfg, maxAge); err != nil {
+		return fail(exitFailure, "unhealthy: %v", err)
+	}
+	fmt.Println("ok")
+	return exitOK
+}
+
+// healthcheckTimeout bounds each check so Docker's own timeout never fires first
+const healthcheckTimeout = 5 * time.Second
+
+// healthcheck returns why the node is unhealthy, nil if it is healthy
+func healthcheck(cfg *config.Config, maxAge time.Duration) error {
+	if cfg.StatusAddr != "" {
+		url, err := healthURL(cfg.StatusAddr)
+		if err != nil {
+			return err
+		}
+		client := &http.Client{Timeout: healthcheckTimeout}
+		resp, err := client.Get(url)
+		if err != nil {
+			return fmt.Errorf("status endpoint: %w", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("status endpoint returned %s", resp.Status)
+		}
+		if maxAge == 0 {
+			return nil
+		}
+	}
+
+	database, err := openDatabase(cfg, false, zap.NewNop())
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	if err := database.Ping(); err != nil {
+		return fmt.Errorf("database unavailable: %w", err)
+	}
+	if maxAge == 0 {
+		return nil
+	}
+
+	last, err := lastTestTime(database)
+	if err != nil {
+		return err
+	}
+	if last == nil {
+		return errors.New("no test has run yet")
+	}
+	if age := time.Since(*last); age > maxAge {
+		return fmt.Errorf("latest test ran %s ago, more than %s", age.Round(time.Second), maxAge)
+	}
+	return nil
+}
+
+// healthURL returns the /healthz URL for a status listen address, using
+// loopback when it listens on all interfaces
+func healthURL(addr string) (string, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", fmt.Errorf("invalid status address %q: %w", addr, err)
+	}
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "127.0.0.1"
+	}
+	return "http://" + net.JoinHostPort(host, port) + "/healthz", nil
+}
+
+// lastTestTime returns when the latest test ran, successful or not, nil if none has
+func lastTestTime(database *db.DB) (*time.Time, error) {
+	last, err := database.GetLastMeasurementTime()
+	if err != nil {
+		return nil, err
+	}
+	failures, err := database.GetFailedMeasurementsSince(time.Time{}, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(failures) > 0 && (last == nil || failures[0].Timestamp.After(*last)) {
+		last = &failures[0].Timestamp
+	}
+	return last, nil
+}
@@ -0,0 +1,399 @@
+package main
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"mark7888/speedtest-node/internal/config"
+	"mark7888/speedtest-node/pkg/models"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+func TestParseTime(t *testing.T) {
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		value   string
+		want    time.Time
+		wantErr bool
+	}{
+		{value: "2026-03-01T08:30:00Z", want: time.Date(2026, 3, 1, 8, 30, 0, 0, time.UTC)},
+		{value: "2026-03-01T08:30:00+02:00", want: time.Date(2026, 3, 1, 6, 30, 0, 0, time.UTC)},
+		{value: "2026-03-01", want: time.Date(2026, 3, 1, 0, 0, 0, 0, time.Local)},
+		{value: "24h", want: now.Add(-24 * time.Hour)},
+		{value: "90m", want: now.Add(-90 * time.Minute)},
+		{value: "-1h", wantErr: true},
+		{value: "yesterday", wantErr: true},
+		{value: "2026-13-01", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseTime(tt.value, now)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error: %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !got.Equal(tt.want) {
+				t.Errorf("parseTime(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTimeRangeFlags(t *testing.T) {
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		args     []string
+		from, to time.Time
+		wantErr  bool
+	}{
+		{name: "everything"},
+		{name: "since only", args: []string{"--since=6h"}, from: now.Add(-6 * time.Hour)},
+		{
+			name: "closed range", args: []string{"--since=2026-03-01T00:00:00Z", "--until=2026-03-02T00:00:00Z"},
+			from: time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC), to: time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC),
+		},
+		{name: "until before since", args: []string{"--since=1h", "--until=2h"}, wantErr: true},
+		{name: "bad since", args: []string{"--since=soon"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+			commands["export"].flags(flags)
+			if err := flags.Parse(tt.args); err != nil {
+				t.Fatal(err)
+			}
+
+			from, to, err := timeRangeFlags(flags, now)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error: %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !from.Equal(tt.from) || !to.Equal(tt.to) {
+				t.Errorf("range = [%v, %v), want [%v, %v)", from, to, tt.from, tt.to)
+			}
+		})
+	}
+}
+
+func TestHealthURL(t *testing.T) {
+	tests := []struct {
+		addr    string
+		want    string
+		wantErr bool
+	}{
+		{addr: ":9101", want: "http://127.0.0.1:9101/healthz"},
+		{addr: "0.0.0.0:9101", want: "http://127.0.0.1:9101/healthz"},
+		{addr: "[::]:9101", want: "http://127.0.0.1:9101/healthz"},
+		{addr: "192.168.1.5:9101", want: "http://192.168.1.5:9101/healthz"},
+		{addr: "[::1]:9101", want: "http://[::1]:9101/healthz"},
+		{addr: "localhost:9101", want: "http://localhost:9101/healthz"},
+		{addr: "9101", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			got, err := healthURL(tt.addr)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error: %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("healthURL(%q) = %q, want %q", tt.addr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHealthcheck(t *testing.T) {
+	dir := t.TempDir()
+	withDB := &config.Config{DBPath: filepath.Join(dir, "speedtest.db")}
+	database, err := openDatabase(withDB, true, commandLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := database.InsertMeasurement(&models.Measurement{Timestamp: time.Now().Add(-time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	database.Close()
+
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/healthz" {
+			http.NotFound(w, r)
+		}
+	}))
+	defer healthy.Close()
+	unhealthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer unhealthy.Close()
+	addr := func(s *httptest.Server) string { return strings.TrimPrefix(s.URL, "http://") }
+
+	tests := []struct {
+		name    string
+		cfg     config.Config
+		maxAge  time.Duration
+		wantErr bool
+	}{
+		{name: "database", cfg: *withDB},
+		{name: "missing database", cfg: config.Config{DBPath: filepath.Join(dir, "missing.db")}, wantErr: true},
+		{name: "recent enough", cfg: *withDB, maxAge: 2 * time.Hour},
+		{name: "stale", cfg: *withDB, maxAge: 30 * time.Minute, wantErr: true},
+		{name: "status endpoint", cfg: config.Config{StatusAddr: addr(healthy), DBPath: filepath.Join(dir, "missing.db")}},
+		{name: "status endpoint unhealthy", cfg: config.Config{StatusAddr: addr(unhealthy), DBPath: withDB.DBPath}, wantErr: true},
+		{name: "status endpoint and stale", cfg: config.Config{StatusAddr: addr(healthy), DBPath: withDB.DBPath}, maxAge: 30 * time.Minute, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := healthcheck(&tt.cfg, tt.maxAge)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("healthcheck() = %v, want error: %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "missing.db")); err == nil {
+		t.Error("healthcheck created a database")
+	}
+}
+
+func TestEnroll(t *testing.T) {
+	t.Setenv(enrollmentTokenEnv, "")
+
+	var enrollments int
+	var lastRequest models.EnrollRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/enroll" || r.Header.Get("Authorization") != "" {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		if err := json.NewDecoder(r.Body).Decode(&lastRequest); err != nil || lastRequest.Token != "et_token" {
+			http.Error(w, `{"error":"invalid enrollment token"}`, http.StatusUnauthorized)
+			return
+		}
+		enrollments++
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(models.EnrollResponse{
+			APIKeyID: "key-id",
+			Key:      "sk_live_enrolled",
+			NodeID:   lastRequest.NodeID,
+		})
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{
+		NodeName:      "site-node",
+		ServerURL:     server.URL,
+		ServerTimeout: time.Second,
+		DBPath:        filepath.Join(t.TempDir(), "speedtest.db"),
+	}
+	enroll := func(args ...string) int {
+		flags := pflag.NewFlagSet("enroll", pflag.ContinueOnError)
+		commands["enroll"].flags(flags)
+		if err := flags.Parse(args); err != nil {
+			t.Fatal(err)
+		}
+		return runEnroll(cfg, flags)
+	}
+	storedKey := func() string {
+		database, err := openDatabase(cfg, false, commandLogger())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer database.Close()
+		key, err := database.GetConfig(apiKeyKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return key
+	}
+
+	if code := enroll(); code != exitUsage {
+		t.Errorf("enroll without a token exited %d, want %d", code, exitUsage)
+	}
+	if code := enroll("--token", "et_wrong"); code != exitFailure {
+		t.Errorf("enroll with a rejected token exited %d, want %d", code, exitFailure)
+	}
+	if key := storedKey(); key != "" {
+		t.Fatalf("rejected enrollment stored key %q", key)
+	}
+
+	if code := enroll("--token", "et_token"); code != exitOK {
+		t.Fatalf("enroll exited %d", code)
+	}
+	if key := storedKey(); key != "sk_live_enrolled" {
+		t.Errorf("stored key = %q, want the enrolled one", key)
+	}
+	if lastRequest.NodeID == "" || lastRequest.NodeName != "site-node" {
+		t.Errorf("enroll request = %+v", lastRequest)
+	}
+
+	if code := enroll("--token", "et_token"); code != exitOK || enrollments != 1 {
+		t.Errorf("enrolling again exited %d after %d enrollments, want no new enrollment", code, enrollments)
+	}
+	if code := enroll("--token", "et_token", "--force"); code != exitOK || enrollments != 2 {
+		t.Errorf("forced enrollment exited %d after %d enrollments", code, enrollments)
+	}
+
+	database, err := openDatabase(cfg, false, commandLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer database.Close()
+
+	tests := []struct {
+		name       string
+		configured string
+		wantKey    string
+		wantStored bool
+	}{
+		{name: "enrolled key", wantKey: "sk_live_enrolled", wantStored: true},
+		{name: "configured key wins", configured: "sk_live_configured", wantKey: "sk_live_configured"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{APIKey: tt.configured}
+			stored, err := loadAPIKey(cfg, database)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.APIKey != tt.wantKey || stored != tt.wantStored {
+				t.Errorf("loadAPIKey() = %q, %v; want %q, %v", cfg.APIKey, stored, tt.wantKey, tt.wantStored)
+			}
+		})
+	}
+}
+
+func TestCSR(t *testing.T) {
+	cfg := &config.Config{DBPath: filepath.Join(t.TempDir(), "speedtest.db")}
+	keyFile := filepath.Join(t.TempDir(), "node.key")
+	csr := func(args ...string) *x509.CertificateRequest {
+		t.Helper()
+		output := filepath.Join(t.TempDir(), "node.csr")
+		flags := pflag.NewFlagSet("csr", pflag.ContinueOnError)
+		commands["csr"].flags(flags)
+		if err := flags.Parse(append(args, "--output", output)); err != nil {
+			t.Fatal(err)
+		}
+		if code := runCSR(cfg, flags); code != exitOK {
+			t.Fatalf("csr exited %d", code)
+		}
+
+		data, err := os.ReadFile(output)
+		if err != nil {
+			t.Fatal(err)
+		}
+		block, _ := pem.Decode(data)
+		if block == nil || block.Type != "CERTIFICATE REQUEST" {
+			t.Fatalf("output is not a PEM certificate request: %q", data)
+		}
+		request, err := x509.ParseCertificateRequest(block.Bytes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := request.CheckSignature(); err != nil {
+			t.Fatal(err)
+		}
+		return request
+	}
+
+	flags := pflag.NewFlagSet("csr", pflag.ContinueOnError)
+	commands["csr"].flags(flags)
+	if code := runCSR(cfg, flags); code != exitUsage {
+		t.Errorf("csr without a key file exited %d, want %d", code, exitUsage)
+	}
+
+	first := csr("--key", keyFile)
+	info, err := os.Stat(keyFile)
+	if err != nil {
+		t.Fatalf("key not written: %v", err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("key mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	database, err := openDatabase(cfg, false, commandLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodeID, _, err := loadNodeID(database)
+	database.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Subject.CommonName != nodeID {
+		t.Errorf("CommonName = %q, want node ID %q", first.Subject.CommonName, nodeID)
+	}
+	if len(first.URIs) != 1 || first.URIs[0].String() != "urn:uuid:"+nodeID {
+		t.Errorf("URIs = %v, want urn:uuid:%s", first.URIs, nodeID)
+	}
+
+	// Renewing reuses the key, taken from the config this time
+	cfg.TLSClientKey = keyFile
+	second := csr()
+	if !bytes.Equal(first.RawSubjectPublicKeyInfo, second.RawSubjectPublicKeyInfo) {
+		t.Error("second CSR has a different key")
+	}
+}
+
+func TestExportMeasurementsCSV(t *testing.T) {
+	measurements := []*models.Measurement{
+		{
+			Timestamp:  time.Date(2026, 3, 10, 9, 0, 0, 0, time.UTC),
+			Ping:       &models.PingData{Latency: 12.345, Jitter: 1.5},
+			Download:   &models.TransferData{Bandwidth: 12500000},
+			Upload:     &models.TransferData{Bandwidth: 2500000},
+			PacketLoss: 0.5,
+			ISP:        "Example, Inc.",
+			Server:     &models.Server{ID: 42, Name: "Test", Location: "Budapest"},
+			Interface:  &models.Interface{ExternalIP: "203.0.113.7"},
+			Result:     &models.Result{URL: "https://example.com/r/1"},
+		},
+		{Timestamp: time.Date(2026, 3, 10, 10, 0, 0, 0, time.UTC)},
+	}
+
+	var buf bytes.Buffer
+	if err := exportMeasurements(&buf, "csv", measurements); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "timestamp,download_mbps,upload_mbps,ping_ms,jitter_ms,packet_loss,isp,server_id,server_name,server_location,external_ip,result_url\n" +
+		"2026-03-10T09:00:00Z,100,20,12.35,1.5,0.5,\"Example, Inc.\",42,Test,Budapest,203.0.113.7,https://example.com/r/1\n" +
+		"2026-03-10T10:00:00Z,,,,,0,,,,,,\n"
+	if got := buf.String(); got != want {
+		t.Errorf("CSV =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestExportFailedMeasurementsNDJSON(t *testing.T) {
+	failed := []*models.FailedMeasurement{
+		{ID: 1, Timestamp: time.Date(2026, 3, 10, 9, 0, 0, 0, time.UTC), ErrorMessage: "timeout", RetryCount: 1},
+		{ID: 2, Timestamp: time.Date(2026, 3, 10, 10, 0, 0, 0, time.UTC), ErrorMessage: "no network", RetryCount: 2},
+	}
+
+	var buf bytes.Buffer
+	if err := exportFailedMeasurements(&buf, "ndjson", failed); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `{"local_id":1,"timestamp":"2026-03-10T09:00:00Z","error_message":"timeout","retry_count":1}` + "\n" +
+		`{"local_id":2,"timestamp":"2026-03-10T10:00:00Z","error_message":"no network","retry_count":2}` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("NDJSON =\n%s\nwant\n%s", got, want)
+	}
+}
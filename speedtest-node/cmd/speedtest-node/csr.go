@@ -0,0 +1,144 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+
+	"mark7888/speedtest-node/internal/config"
+
+	"github.com/spf13/pflag"
+)
+
+// runCSR writes a certificate signing request for this node's ID, for the
+// server admin to sign into a client certificate. The private key stays on
+// the node: an existing key file is reused, so renewing keeps the key, and
+// a missing one is generated.
+func runCSR(cfg *config.Config, flags *pflag.FlagSet) int {
+	keyFile, _ := flags.GetString("key")
+	output, _ := flags.GetString("output")
+	if keyFile == "" {
+		keyFile = cfg.TLSClientKey
+	}
+	if keyFile == "" {
+		return fail(exitUsage, "A key file is required: pass --key or set SPEEDTEST_TLS_CLIENT_KEY.")
+	}
+
+	database, err := openDatabase(cfg, true, commandLogger())
+	if err != nil {
+		return fail(exitFailure, "Failed to open database: %v", err)
+	}
+	defer database.Close()
+
+	nodeID, _, err := loadNodeID(database)
+	if err != nil {
+		return fail(exitFailure, "%v", err)
+	}
+
+	key, generated, err := loadOrGenerateKey(keyFile)
+	if err != nil {
+		return fail(exitFailure, "%v", err)
+	}
+	if generated {
+		fmt.Fprintf(os.Stderr, "Generated a new private key in %s\n", keyFile)
+	}
+
+	var w io.Writer = os.Stdout
+	if output != "" {
+		f, err := os.Create(output)
+		if err != nil {
+			return fail(exitFailure, "Failed to create output file: %v", err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	if err := writeCSR(w, key, nodeID); err != nil {
+		return fail(exitFailure, "Failed to write CSR: %v", err)
+	}
+	return exitOK
+}
+
+// loadOrGenerateKey reads the PEM private key in keyFile, or generates an
+// ECDSA P-256 key and writes it there, readable only by the owner
+func loadOrGenerateKey(keyFile string) (key crypto.Signer, generated bool, err error) {
+	data, err := os.ReadFile(keyFile)
+	if err == nil {
+		key, err := parsePrivateKey(data)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to read key %s: %w", keyFile, err)
+		}
+		return key, false, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, false, fmt.Errorf("failed to read key: %w", err)
+	}
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to generate key: %w", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(ecKey)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to encode key: %w", err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		return nil, false, fmt.Errorf("failed to write key: %w", err)
+	}
+	return ecKey, true, nil
+}
+
+// parsePrivateKey parses a PEM private key in PKCS #8, EC or PKCS #1 form
+func parsePrivateKey(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM private key found")
+	}
+
+	var parsed interface{}
+	var err error
+	switch block.Type {
+	case "EC PRIVATE KEY":
+		parsed, err = x509.ParseECPrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	signer, ok := parsed.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type %T", parsed)
+	}
+	return signer, nil
+}
+
+// writeCSR writes a PEM certificate signing request naming nodeID as both
+// the common name and a urn:uuid: URI, the way the server issues it
+func writeCSR(w io.Writer, key crypto.Signer, nodeID string) error {
+	uri, err := url.Parse("urn:uuid:" + nodeID)
+	if err != nil {
+		return err
+	}
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: nodeID},
+		URIs:    []*url.URL{uri},
+	}, key)
+	if err != nil {
+		return err
+	}
+	return pem.Encode(w, &pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der})
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"time"
+
+	"mark7888/speedtest-node/internal/config"
+	"mark7888/speedtest-node/pkg/models"
+
+	"github.com/spf13/pflag"
+)
+
+// runExport writes the results in a time range to stdout or a file
+func runExport(cfg *config.Config, flags *pflag.FlagSet) int {
+	format, _ := flags.GetString("format")
+	failed, _ := flags.GetBool("failed")
+	output, _ := flags.GetString("output")
+
+	if format != "csv" && format != "ndjson" {
+		return fail(exitUsage, "Format must be csv or ndjson")
+	}
+	from, to, err := timeRangeFlags(flags, time.Now())
+	if err != nil {
+		return fail(exitUsage, "%v", err)
+	}
+
+	database, err := openDatabase(cfg, false, commandLogger())
+	if err != nil {
+		return fail(exitFailure, "Failed to open database: %v", err)
+	}
+	defer database.Close()
+
+	var w io.Writer = os.Stdout
+	if output != "" {
+		file, err := os.Create(output)
+		if err != nil {
+			return fail(exitFailure, "Failed to create output file: %v", err)
+		}
+		defer file.Close()
+		w = file
+	}
+
+	if failed {
+		rows, err := database.GetFailedMeasurementsBetween(from, to)
+		if err != nil {
+			return fail(exitFailure, "Failed to read failed measurements: %v", err)
+		}
+		if err := exportFailedMeasurements(w, format, rows); err != nil {
+			return fail(exitFailure, "Failed to write export: %v", err)
+		}
+		return exitOK
+	}
+
+	rows, err := database.GetMeasurementsBetween(from, to)
+	if err != nil {
+		return fail(exitFailure, "Failed to read measurements: %v", err)
+	}
+	if err := exportMeasurements(w, format, rows); err != nil {
+		return fail(exitFailure, "Failed to write export: %v", err)
+	}
+	return exitOK
+}
+
+// measurementHeader are the CSV columns for measurements. Bandwidths are in
+// Mbps here; NDJSON keeps the raw bytes per second.
+var measurementHeader = []string{
+	"timestamp", "download_mbps", "upload_mbps", "ping_ms", "jitter_ms", "packet_loss",
+	"isp", "server_id", "server_name", "server_location", "external_ip", "result_url",
+}
+
+// exportMeasurements writes measurements as CSV or one JSON object per line
+func exportMeasurements(w io.Writer, format string, measurements []*models.Measurement) error {
+	if format == "ndjson" {
+		encoder := json.NewEncoder(w)
+		for _, m := range measurements {
+			if err := encoder.Encode(m); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	cw := csv.NewWriter(w)
+	cw.Write(measurementHeader)
+	for _, m := range measurements {
+		cw.Write(measurementRecord(m))
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// measurementRecord returns a measurement's CSV fields, empty where the
+// speedtest did not report a value
+func measurementRecord(m *models.Measurement) []string {
+	record := make([]string, len(measurementHeader))
+	record[0] = m.Timestamp.UTC().Format(time.RFC3339)
+	if m.Download != nil {
+		record[1] = formatFloat(mbps(m.Download.Bandwidth))
+	}
+	if m.Upload != nil {
+		record[2] = formatFloat(mbps(m.Upload.Bandwidth))
+	}
+	if m.Ping != nil {
+		record[3] = formatFloat(m.Ping.Latency)
+		record[4] = formatFloat(m.Ping.Jitter)
+	}
+	record[5] = formatFloat(m.PacketLoss)
+	record[6] = m.ISP
+	if m.Server != nil {
+		record[7] = strconv.Itoa(m.Server.ID)
+		record[8] = m.Server.Name
+		record[9] = m.Server.Location
+	}
+	if m.Interface != nil {
+		record[10] = m.Interface.ExternalIP
+	}
+	if m.Result != nil {
+		record[11] = m.Result.URL
+	}
+	return record
+}
+
+// exportFailedMeasurements writes failed measurements as CSV or one JSON object per line
+func exportFailedMeasurements(w io.Writer, format string, failed []*models.FailedMeasurement) error {
+	if format == "ndjson" {
+		encoder := json.NewEncoder(w)
+		for _, f := range failed {
+			if err := encoder.Encode(f); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"timestamp", "error_message", "retry_count"})
+	for _, f := range failed {
+		cw.Write([]string{
+			f.Timestamp.UTC().Format(time.RFC3339),
+			f.ErrorMessage,
+			strconv.Itoa(f.RetryCount),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// formatFloat formats a value with up to two decimals
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(math.Round(v*100)/100, 'f', -1, 64)
+}
+
+// runResync marks the results in a time range unsent so the running node
+// sends them again on its next sync
+func runResync(cfg *config.Config, flags *pflag.FlagSet) int {
+	if since, _ := flags.GetString("since"); since == "" {
+		return fail(exitUsage, "--since is required")
+	}
+	from, to, err := timeRangeFlags(flags, time.Now())
+	if err != nil {
+		return fail(exitUsage, "%v", err)
+	}
+
+	database, err := openDatabase(cfg, false, commandLogger())
+	if err != nil {
+		return fail(exitFailure, "Failed to open database: %v", err)
+	}
+	defer database.Close()
+
+	measurements, failed, err := database.MarkUnsentBetween(from, to)
+	if err != nil {
+		return fail(exitFailure, "Failed to mark results unsent: %v", err)
+	}
+
+	fmt.Printf("Queued %d measurements and %d failed measurements to be sent again\n", measurements, failed)
+	return exitOK
+}
+
+// timeRangeFlags parses --since and --until. An empty --since starts at the
+// beginning and an empty --until leaves the range open-ended (zero to).
+func timeRangeFlags(flags *pflag.FlagSet, now time.Time) (from, to time.Time, err error) {
+	since, _ := flags.GetString("since")
+	until, _ := flags.GetString("until")
+
+	if since != "" {
+		if from, err = parseTime(since, now); err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid --since: %w", err)
+		}
+	}
+	if until != "" {
+		if to, err = parseTime(until, now); err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid --until: %w", err)
+		}
+		if !to.After(from) {
+			return time.Time{}, time.Time{}, fmt.Errorf("--until must be after --since")
+		}
+	}
+	return from, to, nil
+}
+
+// parseTime accepts an RFC 3339 time, a local date (YYYY-MM-DD) or an age
+// such as 90m or 24h before now
+func parseTime(value string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation(time.DateOnly, value, time.Local); err == nil {
+		return t, nil
+	}
+	if age, err := time.ParseDuration(value); err == nil && age >= 0 {
+		return now.Add(-age), nil
+	}
+	return time.Time{}, fmt.Errorf("%q is not an RFC 3339 time, YYYY-MM-DD date or duration", value)
+}
@@ -1,27 +1,58 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strings"
 	"syscall"
+	"time"
 
 	"mark7888/speedtest-node/internal/config"
 	"mark7888/speedtest-node/internal/db"
 	"mark7888/speedtest-node/internal/logger"
 	"mark7888/speedtest-node/internal/scheduler"
 	"mark7888/speedtest-node/internal/speedtest"
+	"mark7888/speedtest-node/internal/status"
 	"mark7888/speedtest-node/internal/sync"
+	"mark7888/speedtest-node/internal/tracing"
+	"mark7888/speedtest-node/internal/version"
 
-	"github.com/google/uuid"
+	"github.com/spf13/pflag"
 	"go.uber.org/zap"
 )
 
 func main() {
+	name, cmd, ok := parseCommand()
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\nCommands:\n%s", name, commandList())
+		os.Exit(exitUsage)
+	}
+	if cmd.flags != nil {
+		cmd.flags(pflag.CommandLine)
+	}
+
 	// Load configuration
-	cfg := config.Load()
+	cfg := config.Load(name, commandList())
+	if err := cfg.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid configuration: %v\n", err)
+		os.Exit(exitFailure)
+	}
+	if args := pflag.Args(); len(args) > 0 {
+		fmt.Fprintf(os.Stderr, "Unexpected arguments: %s\n", strings.Join(args, " "))
+		os.Exit(exitUsage)
+	}
+
+	if cmd.run != nil {
+		os.Exit(cmd.run(cfg, pflag.CommandLine))
+	}
+	runNode(cfg)
+}
 
+// runNode runs the node's schedule until it receives a shutdown signal
+func runNode(cfg *config.Config) {
 	// Ensure log directory exists
 	if cfg.LogOutput != "" {
 		logDir := filepath.Dir(cfg.LogOutput)
@@ -46,7 +77,7 @@ func main() {
 
 	log.Info("Starting speedtest-node",
 		zap.String("node_name", cfg.NodeName),
-		zap.String("version", "1.0.0"),
+		zap.String("version", version.Get()),
 	)
 
 	// Initialize database
@@ -57,35 +88,119 @@ func main() {
 	defer database.Close()
 
 	// Get or generate node ID
-	nodeID, err := database.GetConfig("node_id")
+	nodeID, generated, err := loadNodeID(database)
 	if err != nil {
-		log.Fatal("Failed to get node_id from config", zap.Error(err))
+		log.Fatal("Failed to load node ID", zap.Error(err))
 	}
-
-	if nodeID == "" {
-		nodeID = uuid.New().String()
-		if err := database.SetConfig("node_id", nodeID); err != nil {
-			log.Fatal("Failed to store node_id", zap.Error(err))
-		}
+	if generated {
 		log.Info("Generated new node ID", zap.String("node_id", nodeID))
 	} else {
 		log.Info("Using existing node ID", zap.String("node_id", nodeID))
 	}
 
+	// Use the key stored by enrolling unless one is configured
+	if stored, err := loadAPIKey(cfg, database); err != nil {
+		log.Fatal("Failed to load API key", zap.Error(err))
+	} else if stored {
+		log.Info("Using API key from enrollment")
+	}
+
+	// Export traces of syncs with the server when a collector is configured
+	if cfg.TracingEndpoint != "" {
+		shutdownTracing, err := tracing.Init(cfg.TracingEndpoint, cfg.TracingSampleRatio, nodeID, cfg.NodeName)
+		if err != nil {
+			log.Fatal("Failed to initialize tracing", zap.Error(err))
+		}
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := shutdownTracing(ctx); err != nil {
+				log.Warn("Failed to flush traces", zap.Error(err))
+			}
+		}()
+		log.Info("Tracing enabled", zap.String("endpoint", cfg.TracingEndpoint))
+	}
+
 	// Initialize speedtest executor
 	executor := speedtest.NewExecutor(cfg.SpeedtestTimeout, cfg.RetryOnFailure, log)
 
-	// Initialize sync client (only if server URL and API key are provided)
+	// Initialize sync client (only if server URL and credentials are provided)
 	var sender *sync.Sender
 	var aliveSender *sync.AliveSender
+	var controlChannel *sync.ControlChannel
 
-	if cfg.ServerURL != "" && cfg.APIKey != "" {
-		client := sync.NewClient(cfg.ServerURL, cfg.APIKey, cfg.ServerTimeout, cfg.TLSVerify, log)
-		sender = sync.NewSender(client, nodeID, cfg.NodeName, log)
-		aliveSender = sync.NewAliveSender(client, nodeID, cfg.NodeName, cfg.NodeLocation, log)
-		log.Info("Sync client initialized", zap.String("server_url", cfg.ServerURL))
+	// The mqtt transport only talks to the broker and needs no server URL
+	if cfg.HasCredentials() && (cfg.ServerURL != "" || cfg.Transport == "mqtt") {
+		tlsConfig, err := sync.NewTLSConfig(cfg.TLSVerify, cfg.TLSCACert, cfg.TLSClientCert, cfg.TLSClientKey)
+		if err != nil {
+			log.Fatal("Failed to load TLS settings", zap.Error(err))
+		}
+
+		var signer *sync.RequestSigner
+		if cfg.RequestSigning {
+			signer, err = sync.NewRequestSigner(cfg.APIKey)
+			if err != nil {
+				log.Fatal("Failed to set up request signing", zap.Error(err))
+			}
+		}
+
+		var transport sync.Transport
+		switch cfg.Transport {
+		case "grpc":
+			addr, useTLS, err := cfg.GRPCTarget()
+			if err != nil {
+				log.Fatal("Failed to determine gRPC address", zap.Error(err))
+			}
+			transport, err = sync.NewGRPCTransport(addr, cfg.APIKey, cfg.ServerTimeout, useTLS, tlsConfig, cfg.Compression, log)
+			if err != nil {
+				log.Fatal("Failed to initialize gRPC transport", zap.Error(err))
+			}
+		case "mqtt":
+			// Messages on the broker are always signed, since any of its
+			// clients could read an API key
+			if signer == nil {
+				signer, err = sync.NewRequestSigner(cfg.APIKey)
+				if err != nil {
+					log.Fatal("Failed to set up message signing for the mqtt transport", zap.Error(err))
+				}
+			}
+			transport = sync.NewMQTTTransport(sync.MQTTConfig{
+				BrokerURL:   cfg.MQTTBrokerURL,
+				Username:    cfg.MQTTUsername,
+				Password:    cfg.MQTTPassword,
+				TopicPrefix: cfg.MQTTTopicPrefix,
+				StoreDir:    filepath.Join(filepath.Dir(cfg.DBPath), "mqtt-store"),
+				TLSVerify:   cfg.TLSVerify,
+			}, signer, nodeID, cfg.ServerTimeout, log)
+		default:
+			client := sync.NewClient(cfg.ServerURL, cfg.APIKey, cfg.ServerTimeout, tlsConfig, cfg.Compression, log)
+			if signer != nil {
+				client.SignRequests(signer)
+			}
+			transport = sync.NewHTTPTransport(client)
+		}
+		defer transport.Close()
+
+		sender = sync.NewSender(transport, nodeID, cfg.NodeName, log)
+		aliveSender = sync.NewAliveSender(transport, nodeID, cfg.NodeName, cfg.NodeLocation, log)
+		if cfg.ControlChannel {
+			controlChannel, err = sync.NewControlChannel(cfg.ServerURL, cfg.APIKey, tlsConfig, cfg.AliveInterval, aliveSender, log)
+			if err != nil {
+				log.Fatal("Failed to initialize control channel", zap.Error(err))
+			}
+			if signer != nil {
+				controlChannel.SignRequests(signer)
+			}
+		}
+
+		log.Info("Sync client initialized",
+			zap.String("server_url", cfg.ServerURL),
+			zap.String("transport", cfg.Transport),
+			zap.Bool("client_certificate", cfg.TLSClientCert != ""),
+			zap.Bool("request_signing", signer != nil),
+		)
 	} else {
-		log.Warn("Server URL or API key not provided, running in offline mode")
+		log.Warn("Server URL or credentials not provided, running in offline mode")
 	}
 
 	// Initialize scheduler
@@ -95,6 +210,7 @@ func main() {
 		database,
 		sender,
 		aliveSender,
+		controlChannel,
 		cfg.SyncInterval,
 		cfg.AliveInterval,
 		cfg.RetentionDays,
@@ -105,8 +221,27 @@ func main() {
 		log.Fatal("Failed to initialize scheduler", zap.Error(err))
 	}
 
+	// Start local status endpoint
+	var statusServer *status.Server
+	if cfg.StatusAddr != "" {
+		transport := ""
+		if sender != nil {
+			transport = cfg.Transport
+		}
+		statusServer = status.NewServer(cfg.StatusAddr, nodeID, cfg.NodeName, transport, sched, database, log)
+		if cfg.Dashboard {
+			statusServer.EnableDashboard(database)
+		}
+		if err := statusServer.Start(); err != nil {
+			log.Fatal("Failed to start status server", zap.Error(err))
+		}
+	}
+
 	// Start scheduler
 	sched.Start()
+	if controlChannel != nil {
+		controlChannel.Start()
+	}
 
 	log.Info("Speedtest-node is running")
 
@@ -118,7 +253,13 @@ func main() {
 	log.Info("Received shutdown signal")
 
 	// Graceful shutdown
+	if controlChannel != nil {
+		controlChannel.Stop()
+	}
 	sched.Stop()
+	if statusServer != nil {
+		statusServer.Stop()
+	}
 
 	log.Info("Speedtest-node stopped")
 }
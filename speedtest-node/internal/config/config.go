@@ -2,7 +2,10 @@ package config
 
 import (
 	"fmt"
+	"net"
+	"net/url"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/spf13/pflag"
@@ -16,10 +19,24 @@ type Config struct {
 	NodeLocation string
 
 	// Server configuration
-	ServerURL     string
-	APIKey        string
-	ServerTimeout time.Duration
-	TLSVerify     bool
+	ServerURL      string
+	APIKey         string
+	ServerTimeout  time.Duration
+	TLSVerify      bool
+	TLSCACert      string // CA bundle trusted for the server, on top of the system roots
+	TLSClientCert  string // client certificate to authenticate with instead of an API key
+	TLSClientKey   string // private key of TLSClientCert
+	RequestSigning bool   // sign requests with a key derived from APIKey instead of sending it
+	Compression    string
+	Transport      string // http, grpc or mqtt
+	GRPCAddr       string // host:port of the gRPC ingestion server
+	ControlChannel bool   // keep a WebSocket control channel to the server
+
+	// MQTT transport configuration
+	MQTTBrokerURL   string
+	MQTTUsername    string
+	MQTTPassword    string
+	MQTTTopicPrefix string
 
 	// Speedtest configuration
 	SpeedtestCron    string
@@ -37,6 +54,14 @@ type Config struct {
 	// Data retention
 	RetentionDays int
 
+	// Local status endpoint, disabled when empty
+	StatusAddr string
+	Dashboard  bool
+
+	// OpenTelemetry tracing, disabled when the endpoint is empty
+	TracingEndpoint    string
+	TracingSampleRatio float64
+
 	// Logging configuration
 	LogLevel         string
 	LogFormat        string
@@ -45,8 +70,10 @@ type Config struct {
 }
 
 // Load loads configuration from command-line arguments and environment variables
-// Command-line arguments take precedence over environment variables
-func Load() *Config {
+// Command-line arguments take precedence over environment variables.
+// command is the subcommand being run, empty for the node itself, and
+// commands lists the subcommands for the help text.
+func Load(command, commands string) *Config {
 	v := viper.New()
 
 	// Set up environment variable prefix
@@ -60,6 +87,18 @@ func Load() *Config {
 	pflag.String("api-key", "", "API key for authentication")
 	pflag.Duration("server-timeout", 30*time.Second, "HTTP request timeout")
 	pflag.Bool("tls-verify", true, "Verify TLS certificates")
+	pflag.String("tls-ca-cert", "", "CA bundle to trust for the server in addition to the system roots")
+	pflag.String("tls-client-cert", "", "Client certificate to authenticate with instead of an API key")
+	pflag.String("tls-client-key", "", "Private key of the client certificate")
+	pflag.Bool("request-signing", false, "Sign requests to the server instead of sending the API key (http transport only)")
+	pflag.String("compression", "auto", "Sync payload compression: auto, zstd, gzip, none")
+	pflag.String("transport", "http", "Sync transport: http, grpc or mqtt")
+	pflag.String("grpc-addr", "", "gRPC ingestion server address host:port (default: server URL host, port 9090)")
+	pflag.Bool("control-channel", false, "Keep a WebSocket control channel to the server for heartbeats and commands")
+	pflag.String("mqtt-broker-url", "", "MQTT broker URL for the mqtt transport (tcp://, ssl:// or ws://)")
+	pflag.String("mqtt-username", "", "MQTT username")
+	pflag.String("mqtt-password", "", "MQTT password")
+	pflag.String("mqtt-topic-prefix", "speedtest", "MQTT topic prefix")
 
 	pflag.String("speedtest-cron", "*/10 * * * *", "Cron expression for measurements")
 	pflag.Duration("speedtest-timeout", 120*time.Second, "Speedtest execution timeout")
@@ -73,6 +112,12 @@ func Load() *Config {
 
 	pflag.Int("retention-days", 7, "Keep local data for N days")
 
+	pflag.String("status-addr", "", "Listen address for the local /healthz, /status and /metrics endpoints, e.g. :9101 (disabled when empty)")
+	pflag.Bool("dashboard", false, "Serve a local web dashboard and JSON API on the status address")
+
+	pflag.String("tracing-endpoint", "", "OTLP/HTTP collector URL for traces, e.g. http://localhost:4318 (disabled when empty)")
+	pflag.Float64("tracing-sample-ratio", 1, "Fraction of syncs to trace, from 0 to 1")
+
 	pflag.String("log-level", "info", "Log level: debug, info, warn, error")
 	pflag.String("log-format", "json", "Log format: json or console")
 	pflag.String("log-output", "./logs/speedtest-node.log", "Log file path")
@@ -88,7 +133,13 @@ func Load() *Config {
 	if help, _ := pflag.CommandLine.GetBool("help"); help {
 		fmt.Fprintf(os.Stdout, "Speedtest Node - Network Measurement Collector\n\n")
 		fmt.Fprintf(os.Stdout, "Usage:\n")
-		fmt.Fprintf(os.Stdout, "  speedtest-node [flags]\n\n")
+		if command != "" {
+			fmt.Fprintf(os.Stdout, "  speedtest-node %s [flags]\n\n", command)
+		} else {
+			fmt.Fprintf(os.Stdout, "  speedtest-node [command] [flags]\n\n")
+			fmt.Fprintf(os.Stdout, "Without a command the node runs its schedule until stopped.\n\n")
+			fmt.Fprintf(os.Stdout, "Commands:\n%s\n", commands)
+		}
 		fmt.Fprintf(os.Stdout, "Flags:\n")
 		pflag.PrintDefaults()
 		fmt.Fprintf(os.Stdout, "\nEnvironment Variables:\n")
@@ -118,6 +169,18 @@ func Load() *Config {
 	v.BindEnv("api-key", "SPEEDTEST_SERVER_API_KEY")
 	v.BindEnv("server-timeout", "SPEEDTEST_SERVER_TIMEOUT")
 	v.BindEnv("tls-verify", "SPEEDTEST_TLS_VERIFY")
+	v.BindEnv("tls-ca-cert", "SPEEDTEST_TLS_CA_CERT")
+	v.BindEnv("tls-client-cert", "SPEEDTEST_TLS_CLIENT_CERT")
+	v.BindEnv("tls-client-key", "SPEEDTEST_TLS_CLIENT_KEY")
+	v.BindEnv("request-signing", "SPEEDTEST_REQUEST_SIGNING")
+	v.BindEnv("compression", "SPEEDTEST_COMPRESSION")
+	v.BindEnv("transport", "SPEEDTEST_TRANSPORT")
+	v.BindEnv("grpc-addr", "SPEEDTEST_GRPC_ADDR")
+	v.BindEnv("control-channel", "SPEEDTEST_CONTROL_CHANNEL")
+	v.BindEnv("mqtt-broker-url", "SPEEDTEST_MQTT_BROKER_URL")
+	v.BindEnv("mqtt-username", "SPEEDTEST_MQTT_USERNAME")
+	v.BindEnv("mqtt-password", "SPEEDTEST_MQTT_PASSWORD")
+	v.BindEnv("mqtt-topic-prefix", "SPEEDTEST_MQTT_TOPIC_PREFIX")
 	v.BindEnv("speedtest-cron", "SPEEDTEST_CRON")
 	v.BindEnv("speedtest-timeout", "SPEEDTEST_TIMEOUT")
 	v.BindEnv("retry-on-failure", "SPEEDTEST_RETRY_ON_FAILURE")
@@ -126,6 +189,10 @@ func Load() *Config {
 	v.BindEnv("alive-interval", "SPEEDTEST_ALIVE_INTERVAL")
 	v.BindEnv("db-path", "SPEEDTEST_DB_PATH")
 	v.BindEnv("retention-days", "SPEEDTEST_RETENTION_DAYS")
+	v.BindEnv("status-addr", "SPEEDTEST_STATUS_ADDR")
+	v.BindEnv("dashboard", "SPEEDTEST_DASHBOARD")
+	v.BindEnv("tracing-endpoint", "SPEEDTEST_TRACING_ENDPOINT")
+	v.BindEnv("tracing-sample-ratio", "SPEEDTEST_TRACING_SAMPLE_RATIO")
 	v.BindEnv("log-level", "SPEEDTEST_LOG_LEVEL")
 	v.BindEnv("log-format", "SPEEDTEST_LOG_FORMAT")
 	v.BindEnv("log-output", "SPEEDTEST_LOG_OUTPUT")
@@ -133,24 +200,40 @@ func Load() *Config {
 
 	// Build config from viper
 	cfg := &Config{
-		NodeName:         v.GetString("node-name"),
-		NodeLocation:     v.GetString("node-location"),
-		ServerURL:        v.GetString("server-url"),
-		APIKey:           v.GetString("api-key"),
-		ServerTimeout:    v.GetDuration("server-timeout"),
-		TLSVerify:        v.GetBool("tls-verify"),
-		SpeedtestCron:    v.GetString("speedtest-cron"),
-		SpeedtestTimeout: v.GetDuration("speedtest-timeout"),
-		RetryOnFailure:   v.GetBool("retry-on-failure"),
-		BatchSize:        v.GetInt("batch-size"),
-		SyncInterval:     v.GetDuration("sync-interval"),
-		AliveInterval:    v.GetDuration("alive-interval"),
-		DBPath:           v.GetString("db-path"),
-		RetentionDays:    v.GetInt("retention-days"),
-		LogLevel:         v.GetString("log-level"),
-		LogFormat:        v.GetString("log-format"),
-		LogOutput:        v.GetString("log-output"),
-		LogOutputConsole: v.GetBool("log-output-console"),
+		NodeName:           v.GetString("node-name"),
+		NodeLocation:       v.GetString("node-location"),
+		ServerURL:          v.GetString("server-url"),
+		APIKey:             v.GetString("api-key"),
+		ServerTimeout:      v.GetDuration("server-timeout"),
+		TLSVerify:          v.GetBool("tls-verify"),
+		TLSCACert:          v.GetString("tls-ca-cert"),
+		TLSClientCert:      v.GetString("tls-client-cert"),
+		TLSClientKey:       v.GetString("tls-client-key"),
+		RequestSigning:     v.GetBool("request-signing"),
+		Compression:        v.GetString("compression"),
+		Transport:          v.GetString("transport"),
+		GRPCAddr:           v.GetString("grpc-addr"),
+		ControlChannel:     v.GetBool("control-channel"),
+		MQTTBrokerURL:      v.GetString("mqtt-broker-url"),
+		MQTTUsername:       v.GetString("mqtt-username"),
+		MQTTPassword:       v.GetString("mqtt-password"),
+		MQTTTopicPrefix:    v.GetString("mqtt-topic-prefix"),
+		SpeedtestCron:      v.GetString("speedtest-cron"),
+		SpeedtestTimeout:   v.GetDuration("speedtest-timeout"),
+		RetryOnFailure:     v.GetBool("retry-on-failure"),
+		BatchSize:          v.GetInt("batch-size"),
+		SyncInterval:       v.GetDuration("sync-interval"),
+		AliveInterval:      v.GetDuration("alive-interval"),
+		DBPath:             v.GetString("db-path"),
+		RetentionDays:      v.GetInt("retention-days"),
+		StatusAddr:         v.GetString("status-addr"),
+		Dashboard:          v.GetBool("dashboard"),
+		TracingEndpoint:    v.GetString("tracing-endpoint"),
+		TracingSampleRatio: v.GetFloat64("tracing-sample-ratio"),
+		LogLevel:           v.GetString("log-level"),
+		LogFormat:          v.GetString("log-format"),
+		LogOutput:          v.GetString("log-output"),
+		LogOutputConsole:   v.GetBool("log-output-console"),
 	}
 
 	return cfg
@@ -158,11 +241,81 @@ func Load() *Config {
 
 // Validate checks if the configuration is valid
 func (c *Config) Validate() error {
-	// For now, we don't require strict validation
 	// The application will fail gracefully if server URL or API key is missing
+	switch c.Compression {
+	case "auto", "zstd", "gzip", "none":
+	default:
+		return fmt.Errorf("compression must be one of auto, zstd, gzip, none")
+	}
+	switch c.Transport {
+	case "http", "grpc":
+	case "mqtt":
+		if c.MQTTBrokerURL == "" {
+			return fmt.Errorf("MQTT broker URL is required for the mqtt transport")
+		}
+		if c.MQTTTopicPrefix == "" || strings.ContainsAny(c.MQTTTopicPrefix, "+#") {
+			return fmt.Errorf("MQTT topic prefix must be non-empty and must not contain wildcards")
+		}
+	default:
+		return fmt.Errorf("transport must be one of http, grpc, mqtt")
+	}
+	if (c.TLSClientCert == "") != (c.TLSClientKey == "") {
+		return fmt.Errorf("TLS client certificate and key must be set together")
+	}
+	if c.RequestSigning {
+		if c.Transport != "http" {
+			return fmt.Errorf("request signing requires the http transport")
+		}
+		if c.APIKey == "" {
+			return fmt.Errorf("request signing requires an API key")
+		}
+	}
+	if c.ControlChannel && c.ServerURL == "" {
+		return fmt.Errorf("control channel requires a server URL")
+	}
+	if c.Dashboard && c.StatusAddr == "" {
+		return fmt.Errorf("dashboard requires a status address")
+	}
+	if c.TracingEndpoint != "" && !strings.HasPrefix(c.TracingEndpoint, "http://") && !strings.HasPrefix(c.TracingEndpoint, "https://") {
+		return fmt.Errorf("tracing endpoint must be an http:// or https:// URL")
+	}
+	if c.TracingSampleRatio < 0 || c.TracingSampleRatio > 1 {
+		return fmt.Errorf("tracing sample ratio must be between 0 and 1")
+	}
 	return nil
 }
 
+// HasCredentials reports whether the node can authenticate to the server,
+// with an API key or a client certificate. The mqtt transport talks to a
+// broker that cannot check certificates on the server's behalf, so it needs
+// the key.
+func (c *Config) HasCredentials() bool {
+	if c.Transport == "mqtt" {
+		return c.APIKey != ""
+	}
+	return c.APIKey != "" || c.TLSClientCert != ""
+}
+
+// GRPCTarget returns the gRPC server address and whether to use TLS.
+// TLS follows the server URL scheme; the address defaults to the server URL
+// host on port 9090 when not set explicitly.
+func (c *Config) GRPCTarget() (string, bool, error) {
+	u, err := url.Parse(c.ServerURL)
+	if err != nil {
+		return "", false, fmt.Errorf("invalid server URL: %w", err)
+	}
+
+	useTLS := u.Scheme == "https"
+	if c.GRPCAddr != "" {
+		return c.GRPCAddr, useTLS, nil
+	}
+	if u.Hostname() == "" {
+		return "", false, fmt.Errorf("cannot derive gRPC address from server URL %q", c.ServerURL)
+	}
+
+	return net.JoinHostPort(u.Hostname(), "9090"), useTLS, nil
+}
+
 // getHostname returns the system hostname or "unknown" if it fails
 func getHostname() string {
 	hostname, err := os.Hostname()
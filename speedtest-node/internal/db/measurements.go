@@ -3,6 +3,7 @@ package db
 import (
 	"database/sql"
 	"mark7888/speedtest-node/pkg/models"
+	"strings"
 	"time"
 
 	"go.uber.org/zap"
@@ -20,8 +21,8 @@ func (db *DB) InsertMeasurement(m *models.Measurement) error {
 			packet_loss, isp,
 			interface_internal_ip, interface_name, interface_mac, interface_is_vpn, interface_external_ip,
 			server_id, server_host, server_port, server_name, server_location, server_country, server_ip,
-			result_id, result_url
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			result_id, result_url, clock_offset_ms
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
 	var pingJitter, pingLatency, pingLow, pingHigh sql.NullFloat64
@@ -99,7 +100,7 @@ func (db *DB) InsertMeasurement(m *models.Measurement) error {
 		m.PacketLoss, m.ISP,
 		interfaceInternalIP, interfaceName, interfaceMAC, interfaceIsVPN, interfaceExternalIP,
 		serverID, serverHost, serverPort, serverName, serverLocation, serverCountry, serverIP,
-		resultID, resultURL,
+		resultID, resultURL, m.ClockOffsetMs,
 	)
 
 	if err != nil {
@@ -111,27 +112,121 @@ func (db *DB) InsertMeasurement(m *models.Measurement) error {
 	return nil
 }
 
+// measurementColumns are the columns scanned by queryMeasurements
+const measurementColumns = `
+	id, timestamp, created_at,
+	ping_jitter, ping_latency, ping_low, ping_high,
+	download_bandwidth, download_bytes, download_elapsed,
+	download_latency_iqm, download_latency_low, download_latency_high, download_latency_jitter,
+	upload_bandwidth, upload_bytes, upload_elapsed,
+	upload_latency_iqm, upload_latency_low, upload_latency_high, upload_latency_jitter,
+	packet_loss, isp,
+	interface_internal_ip, interface_name, interface_mac, interface_is_vpn, interface_external_ip,
+	server_id, server_host, server_port, server_name, server_location, server_country, server_ip,
+	result_id, result_url, clock_offset_ms
+`
+
 // GetUnsentMeasurements retrieves unsent measurements with a limit
 func (db *DB) GetUnsentMeasurements(limit int) ([]*models.Measurement, error) {
-	query := `
-		SELECT 
-			id, timestamp, created_at,
-			ping_jitter, ping_latency, ping_low, ping_high,
-			download_bandwidth, download_bytes, download_elapsed,
-			download_latency_iqm, download_latency_low, download_latency_high, download_latency_jitter,
-			upload_bandwidth, upload_bytes, upload_elapsed,
-			upload_latency_iqm, upload_latency_low, upload_latency_high, upload_latency_jitter,
-			packet_loss, isp,
-			interface_internal_ip, interface_name, interface_mac, interface_is_vpn, interface_external_ip,
-			server_id, server_host, server_port, server_name, server_location, server_country, server_ip,
-			result_id, result_url
-		FROM measurements
-		WHERE sent = 0
-		ORDER BY timestamp ASC
-		LIMIT ?
-	`
+	return db.queryMeasurements(
+		"SELECT "+measurementColumns+" FROM measurements WHERE sent = 0 ORDER BY timestamp ASC LIMIT ?",
+		limit,
+	)
+}
+
+// GetLastMeasurement returns the newest successful measurement, or nil if there is none
+func (db *DB) GetLastMeasurement() (*models.Measurement, error) {
+	measurements, err := db.queryMeasurements(
+		"SELECT " + measurementColumns + " FROM measurements ORDER BY timestamp DESC LIMIT 1",
+	)
+	if err != nil || len(measurements) == 0 {
+		return nil, err
+	}
+	return measurements[0], nil
+}
+
+// GetMeasurementsSince returns up to limit measurements taken at or after
+// since, newest first
+func (db *DB) GetMeasurementsSince(since time.Time, limit int) ([]*models.Measurement, error) {
+	return db.queryMeasurements(
+		"SELECT "+measurementColumns+" FROM measurements WHERE timestamp >= ? ORDER BY timestamp DESC LIMIT ?",
+		since, limit,
+	)
+}
+
+// GetMeasurementsBetween returns the measurements taken in [from, to),
+// oldest first. A zero to leaves the range open-ended.
+func (db *DB) GetMeasurementsBetween(from, to time.Time) ([]*models.Measurement, error) {
+	where, args := timeRange(from, to)
+	return db.queryMeasurements(
+		"SELECT "+measurementColumns+" FROM measurements WHERE "+where+" ORDER BY timestamp ASC",
+		args...,
+	)
+}
+
+// GetAggregateStats totals the results between consecutive bounds, one
+// entry per window [bounds[i], bounds[i+1]). Bounds must be in UTC like the
+// stored timestamps, which SQLite compares as strings.
+func (db *DB) GetAggregateStats(bounds []time.Time) ([]models.AggregateStats, error) {
+	if len(bounds) < 2 {
+		return nil, nil
+	}
+
+	values := make([]string, 0, len(bounds)-1)
+	args := make([]interface{}, 0, 3*(len(bounds)-1))
+	for i := 0; i < len(bounds)-1; i++ {
+		values = append(values, "(?, ?, ?)")
+		args = append(args, i, bounds[i], bounds[i+1])
+	}
+
+	rows, err := db.conn.Query(`
+		WITH windows(idx, start_at, end_at) AS (VALUES `+strings.Join(values, ", ")+`)
+		SELECT
+			w.idx,
+			COUNT(m.id),
+			(SELECT COUNT(*) FROM failed_measurements f WHERE f.timestamp >= w.start_at AND f.timestamp < w.end_at),
+			COUNT(m.download_bandwidth), COALESCE(SUM(m.download_bandwidth), 0),
+			COALESCE(MIN(m.download_bandwidth), 0), COALESCE(MAX(m.download_bandwidth), 0),
+			COUNT(m.upload_bandwidth), COALESCE(SUM(m.upload_bandwidth), 0),
+			COALESCE(MIN(m.upload_bandwidth), 0), COALESCE(MAX(m.upload_bandwidth), 0),
+			COUNT(m.ping_latency), COALESCE(SUM(m.ping_latency), 0),
+			COUNT(m.ping_jitter), COALESCE(SUM(m.ping_jitter), 0),
+			COALESCE(SUM(COALESCE(m.packet_loss, 0)), 0)
+		FROM windows w
+		LEFT JOIN measurements m ON m.timestamp >= w.start_at AND m.timestamp < w.end_at
+		GROUP BY w.idx
+		ORDER BY w.idx
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := make([]models.AggregateStats, len(bounds)-1)
+	for rows.Next() {
+		var idx int
+		var s models.AggregateStats
+		if err := rows.Scan(
+			&idx, &s.Tests, &s.Failures,
+			&s.Download.Count, &s.Download.Sum, &s.Download.Min, &s.Download.Max,
+			&s.Upload.Count, &s.Upload.Sum, &s.Upload.Min, &s.Upload.Max,
+			&s.Ping.Count, &s.Ping.Sum,
+			&s.Jitter.Count, &s.Jitter.Sum,
+			&s.PacketLoss.Sum,
+		); err != nil {
+			return nil, err
+		}
+		// Packet loss is taken as zero when the test did not report it
+		s.PacketLoss.Count = s.Tests
+		stats[idx] = s
+	}
+
+	return stats, rows.Err()
+}
 
-	rows, err := db.conn.Query(query, limit)
+// queryMeasurements runs a query selecting measurementColumns and rebuilds the measurements
+func (db *DB) queryMeasurements(query string, args ...interface{}) ([]*models.Measurement, error) {
+	rows, err := db.conn.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -150,6 +245,7 @@ func (db *DB) GetUnsentMeasurements(limit int) ([]*models.Measurement, error) {
 		var serverID, serverPort sql.NullInt64
 		var serverHost, serverName, serverLocation, serverCountry, serverIP sql.NullString
 		var resultID, resultURL sql.NullString
+		var clockOffsetMs sql.NullInt64
 
 		err := rows.Scan(
 			&m.ID, &m.Timestamp, &m.CreatedAt,
@@ -161,7 +257,7 @@ func (db *DB) GetUnsentMeasurements(limit int) ([]*models.Measurement, error) {
 			&m.PacketLoss, &m.ISP,
 			&interfaceInternalIP, &interfaceName, &interfaceMAC, &interfaceIsVPN, &interfaceExternalIP,
 			&serverID, &serverHost, &serverPort, &serverName, &serverLocation, &serverCountry, &serverIP,
-			&resultID, &resultURL,
+			&resultID, &resultURL, &clockOffsetMs,
 		)
 		if err != nil {
 			return nil, err
@@ -238,6 +334,10 @@ func (db *DB) GetUnsentMeasurements(limit int) ([]*models.Measurement, error) {
 			}
 		}
 
+		if clockOffsetMs.Valid {
+			m.ClockOffsetMs = &clockOffsetMs.Int64
+		}
+
 		measurements = append(measurements, m)
 	}
 
@@ -267,11 +367,12 @@ func (db *DB) DeleteMeasurementsBefore(before time.Time) error {
 	return err
 }
 
-// InsertFailedMeasurement stores a failed measurement attempt
-func (db *DB) InsertFailedMeasurement(timestamp time.Time, errorMsg string, retryCount int) error {
+// InsertFailedMeasurement stores a failed measurement attempt. clockOffsetMs
+// is the node's clock offset estimate at the time, nil if there is none.
+func (db *DB) InsertFailedMeasurement(timestamp time.Time, errorMsg string, retryCount int, clockOffsetMs *int64) error {
 	_, err := db.conn.Exec(
-		"INSERT INTO failed_measurements (timestamp, error_message, retry_count) VALUES (?, ?, ?)",
-		timestamp, errorMsg, retryCount,
+		"INSERT INTO failed_measurements (timestamp, error_message, retry_count, clock_offset_ms) VALUES (?, ?, ?, ?)",
+		timestamp, errorMsg, retryCount, clockOffsetMs,
 	)
 	if err != nil {
 		db.logger.Error("Failed to insert failed measurement", zap.Error(err))
@@ -283,15 +384,37 @@ func (db *DB) InsertFailedMeasurement(timestamp time.Time, errorMsg string, retr
 
 // GetUnsentFailedMeasurements retrieves unsent failed measurements with a limit
 func (db *DB) GetUnsentFailedMeasurements(limit int) ([]*models.FailedMeasurement, error) {
-	query := `
-		SELECT id, timestamp, created_at, error_message, retry_count
-		FROM failed_measurements
-		WHERE sent = 0
-		ORDER BY timestamp ASC
-		LIMIT ?
-	`
+	return db.queryFailedMeasurements(
+		"SELECT "+failedMeasurementColumns+" FROM failed_measurements WHERE sent = 0 ORDER BY timestamp ASC LIMIT ?",
+		limit,
+	)
+}
+
+// GetFailedMeasurementsSince returns up to limit failed measurements
+// recorded at or after since, newest first
+func (db *DB) GetFailedMeasurementsSince(since time.Time, limit int) ([]*models.FailedMeasurement, error) {
+	return db.queryFailedMeasurements(
+		"SELECT "+failedMeasurementColumns+" FROM failed_measurements WHERE timestamp >= ? ORDER BY timestamp DESC LIMIT ?",
+		since, limit,
+	)
+}
+
+// GetFailedMeasurementsBetween returns the failed measurements recorded in
+// [from, to), oldest first. A zero to leaves the range open-ended.
+func (db *DB) GetFailedMeasurementsBetween(from, to time.Time) ([]*models.FailedMeasurement, error) {
+	where, args := timeRange(from, to)
+	return db.queryFailedMeasurements(
+		"SELECT "+failedMeasurementColumns+" FROM failed_measurements WHERE "+where+" ORDER BY timestamp ASC",
+		args...,
+	)
+}
+
+// failedMeasurementColumns are the columns scanned by queryFailedMeasurements
+const failedMeasurementColumns = "id, timestamp, created_at, error_message, retry_count, clock_offset_ms"
 
-	rows, err := db.conn.Query(query, limit)
+// queryFailedMeasurements runs a query selecting failedMeasurementColumns
+func (db *DB) queryFailedMeasurements(query string, args ...interface{}) ([]*models.FailedMeasurement, error) {
+	rows, err := db.conn.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -300,14 +423,18 @@ func (db *DB) GetUnsentFailedMeasurements(limit int) ([]*models.FailedMeasuremen
 	var failed []*models.FailedMeasurement
 	for rows.Next() {
 		f := &models.FailedMeasurement{}
-		err := rows.Scan(&f.ID, &f.Timestamp, &f.CreatedAt, &f.ErrorMessage, &f.RetryCount)
+		var clockOffsetMs sql.NullInt64
+		err := rows.Scan(&f.ID, &f.Timestamp, &f.CreatedAt, &f.ErrorMessage, &f.RetryCount, &clockOffsetMs)
 		if err != nil {
 			return nil, err
 		}
+		if clockOffsetMs.Valid {
+			f.ClockOffsetMs = &clockOffsetMs.Int64
+		}
 		failed = append(failed, f)
 	}
 
-	return failed, nil
+	return failed, rows.Err()
 }
 
 // MarkFailedMeasurementsAsSent marks failed measurements as sent
@@ -333,6 +460,70 @@ func (db *DB) DeleteFailedMeasurementsBefore(before time.Time) error {
 	return err
 }
 
+// CountUnsent returns how many measurements and failed measurements are waiting to be sent
+func (db *DB) CountUnsent() (measurements, failed int64, err error) {
+	err = db.conn.QueryRow(`
+		SELECT
+			(SELECT COUNT(*) FROM measurements WHERE sent = 0),
+			(SELECT COUNT(*) FROM failed_measurements WHERE sent = 0)
+	`).Scan(&measurements, &failed)
+	return measurements, failed, err
+}
+
+// MarkUnsentBetween queues the results in [from, to) to be sent again and
+// returns how many measurements and failed measurements it re-queued. The
+// server stores results per node and timestamp, so resending is harmless.
+// A zero to leaves the range open-ended.
+func (db *DB) MarkUnsentBetween(from, to time.Time) (measurements, failed int64, err error) {
+	where, args := timeRange(from, to)
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("UPDATE measurements SET sent = 0, sent_at = NULL WHERE sent = 1 AND "+where, args...)
+	if err != nil {
+		return 0, 0, err
+	}
+	if measurements, err = result.RowsAffected(); err != nil {
+		return 0, 0, err
+	}
+
+	result, err = tx.Exec("UPDATE failed_measurements SET sent = 0, sent_at = NULL WHERE sent = 1 AND "+where, args...)
+	if err != nil {
+		return 0, 0, err
+	}
+	if failed, err = result.RowsAffected(); err != nil {
+		return 0, 0, err
+	}
+
+	return measurements, failed, tx.Commit()
+}
+
+// GetLastMeasurementTime returns the time of the newest successful measurement, or nil if there is none
+func (db *DB) GetLastMeasurementTime() (*time.Time, error) {
+	var timestamp time.Time
+	err := db.conn.QueryRow("SELECT timestamp FROM measurements ORDER BY timestamp DESC LIMIT 1").Scan(&timestamp)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &timestamp, nil
+}
+
+// timeRange returns a condition on timestamp for [from, to), open-ended
+// when to is zero. Times are compared in UTC like the stored timestamps.
+func timeRange(from, to time.Time) (string, []interface{}) {
+	if to.IsZero() {
+		return "timestamp >= ?", []interface{}{from.UTC()}
+	}
+	return "timestamp >= ? AND timestamp < ?", []interface{}{from.UTC(), to.UTC()}
+}
+
 // repeatPlaceholder returns a string with n repeated ", ?" for SQL IN clauses
 func repeatPlaceholder(n int) string {
 	if n <= 0 {
@@ -0,0 +1,230 @@
+package db
+
+import (
+	"mark7888/speedtest-node/pkg/models"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func newTestDB(t *testing.T) *DB {
+	t.Helper()
+	db, err := New(filepath.Join(t.TempDir(), "test.db"), zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestGetAggregateStats(t *testing.T) {
+	db := newTestDB(t)
+	base := time.Date(2026, 3, 10, 9, 0, 0, 0, time.UTC)
+	at := func(minutes int) time.Time { return base.Add(time.Duration(minutes) * time.Minute) }
+
+	measurements := []*models.Measurement{
+		{
+			Timestamp: at(0), // on the first bound, so in the first window
+			Ping:      &models.PingData{Latency: 10, Jitter: 1},
+			Download:  &models.TransferData{Bandwidth: 10000000},
+			Upload:    &models.TransferData{Bandwidth: 2000000},
+		},
+		{
+			Timestamp:  at(30),
+			Ping:       &models.PingData{Latency: 20, Jitter: 3},
+			Download:   &models.TransferData{Bandwidth: 20000000},
+			Upload:     &models.TransferData{Bandwidth: 4000000},
+			PacketLoss: 2,
+		},
+		{
+			Timestamp: at(60), // on the second bound, so in the second window
+			Ping:      &models.PingData{Latency: 30, Jitter: 5},
+		},
+		{Timestamp: at(-1)},  // before the first window
+		{Timestamp: at(120)}, // on the last bound, excluded
+	}
+	for _, m := range measurements {
+		if err := db.InsertMeasurement(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, ts := range []time.Time{at(10), at(61), at(62), at(180)} {
+		if err := db.InsertFailedMeasurement(ts, "speedtest failed", 1, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		bounds []time.Time
+		want   []models.AggregateStats
+	}{
+		{
+			name:   "hourly windows",
+			bounds: []time.Time{at(0), at(60), at(120)},
+			want: []models.AggregateStats{
+				{
+					Tests: 2, Failures: 1,
+					Download:   models.SeriesStats{Count: 2, Sum: 30000000, Min: 10000000, Max: 20000000},
+					Upload:     models.SeriesStats{Count: 2, Sum: 6000000, Min: 2000000, Max: 4000000},
+					Ping:       models.SeriesStats{Count: 2, Sum: 30},
+					Jitter:     models.SeriesStats{Count: 2, Sum: 4},
+					PacketLoss: models.SeriesStats{Count: 2, Sum: 2},
+				},
+				{
+					Tests: 1, Failures: 2,
+					Ping:       models.SeriesStats{Count: 1, Sum: 30},
+					Jitter:     models.SeriesStats{Count: 1, Sum: 5},
+					PacketLoss: models.SeriesStats{Count: 1},
+				},
+			},
+		},
+		{
+			name:   "empty window",
+			bounds: []time.Time{at(200), at(260)},
+			want:   []models.AggregateStats{{}},
+		},
+		{
+			name:   "whole range",
+			bounds: []time.Time{at(-60), at(240)},
+			want: []models.AggregateStats{
+				{
+					Tests: 5, Failures: 4,
+					Download:   models.SeriesStats{Count: 2, Sum: 30000000, Min: 10000000, Max: 20000000},
+					Upload:     models.SeriesStats{Count: 2, Sum: 6000000, Min: 2000000, Max: 4000000},
+					Ping:       models.SeriesStats{Count: 3, Sum: 60},
+					Jitter:     models.SeriesStats{Count: 3, Sum: 9},
+					PacketLoss: models.SeriesStats{Count: 5, Sum: 2},
+				},
+			},
+		},
+		{
+			name:   "no windows",
+			bounds: []time.Time{at(0)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := db.GetAggregateStats(tt.bounds)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d windows, want %d", len(got), len(tt.want))
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("window %d = %+v\nwant %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestGetMeasurementsSince(t *testing.T) {
+	db := newTestDB(t)
+	base := time.Date(2026, 3, 10, 9, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 5; i++ {
+		if err := db.InsertMeasurement(&models.Measurement{Timestamp: base.Add(time.Duration(i) * time.Hour)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		since  time.Time
+		limit  int
+		want   int
+		newest time.Time
+	}{
+		{name: "all", since: base, limit: 10, want: 5, newest: base.Add(4 * time.Hour)},
+		{name: "limited, newest first", since: base, limit: 2, want: 2, newest: base.Add(4 * time.Hour)},
+		{name: "since is inclusive", since: base.Add(3 * time.Hour), limit: 10, want: 2, newest: base.Add(4 * time.Hour)},
+		{name: "none", since: base.Add(5 * time.Hour), limit: 10, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := db.GetMeasurementsSince(tt.since, tt.limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != tt.want {
+				t.Fatalf("got %d measurements, want %d", len(got), tt.want)
+			}
+			if tt.want > 0 && !got[0].Timestamp.Equal(tt.newest) {
+				t.Errorf("first measurement at %v, want %v", got[0].Timestamp, tt.newest)
+			}
+		})
+	}
+}
+
+func TestMarkUnsentBetween(t *testing.T) {
+	base := time.Date(2026, 3, 10, 9, 0, 0, 0, time.UTC)
+	at := func(hours int) time.Time { return base.Add(time.Duration(hours) * time.Hour) }
+
+	tests := []struct {
+		name         string
+		from, to     time.Time
+		wantMeasured int64
+		wantFailed   int64
+	}{
+		{name: "closed range", from: at(1), to: at(3), wantMeasured: 2, wantFailed: 1},
+		{name: "open-ended", from: at(2), wantMeasured: 2, wantFailed: 1},
+		{name: "non-UTC bounds", from: at(1).In(time.FixedZone("UTC+5", 5*3600)), to: at(2).In(time.FixedZone("UTC-5", -5*3600)), wantMeasured: 1},
+		{name: "empty", from: at(10), to: at(20)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			for i := 0; i < 4; i++ {
+				if err := db.InsertMeasurement(&models.Measurement{Timestamp: at(i)}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := db.InsertFailedMeasurement(at(2), "speedtest failed", 1, nil); err != nil {
+				t.Fatal(err)
+			}
+			// Only the first measurement is left unsent
+			sent, err := db.GetMeasurementsBetween(at(1), time.Time{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids := []int64{}
+			for _, m := range sent {
+				ids = append(ids, m.ID)
+			}
+			if err := db.MarkMeasurementsAsSent(ids); err != nil {
+				t.Fatal(err)
+			}
+			failed, err := db.GetUnsentFailedMeasurements(10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := db.MarkFailedMeasurementsAsSent([]int64{failed[0].ID}); err != nil {
+				t.Fatal(err)
+			}
+
+			measured, failedCount, err := db.MarkUnsentBetween(tt.from, tt.to)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if measured != tt.wantMeasured || failedCount != tt.wantFailed {
+				t.Errorf("re-queued %d measurements and %d failed, want %d and %d", measured, failedCount, tt.wantMeasured, tt.wantFailed)
+			}
+
+			unsent, unsentFailed, err := db.CountUnsent()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if unsent != 1+tt.wantMeasured || unsentFailed != tt.wantFailed {
+				t.Errorf("unsent = %d and %d, want %d and %d", unsent, unsentFailed, 1+tt.wantMeasured, tt.wantFailed)
+			}
+		})
+	}
+}
@@ -104,5 +104,41 @@ func (db *DB) runMigrations() error {
 		}
 	}
 
+	// Columns added after the tables were first created
+	columns := []struct{ table, column, definition string }{
+		{"measurements", "clock_offset_ms", "INTEGER"},
+		{"failed_measurements", "clock_offset_ms", "INTEGER"},
+	}
+	for _, c := range columns {
+		if err := db.addColumn(c.table, c.column, c.definition); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
+
+// addColumn adds a column to an existing table unless it is already there
+func (db *DB) addColumn(table, column, definition string) error {
+	rows, err := db.conn.Query("SELECT name FROM pragma_table_info(?)", table)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	_, err = db.conn.Exec("ALTER TABLE " + table + " ADD COLUMN " + column + " " + definition)
+	return err
+}
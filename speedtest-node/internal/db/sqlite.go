@@ -55,6 +55,11 @@ func (db *DB) Close() error {
 	return db.conn.Close()
 }
 
+// Ping checks that the database is still reachable
+func (db *DB) Ping() error {
+	return db.conn.Ping()
+}
+
 // GetConfig retrieves a configuration value by key
 func (db *DB) GetConfig(key string) (string, error) {
 	var value string
@@ -73,3 +78,10 @@ func (db *DB) SetConfig(key, value string) error {
 	_, err := db.conn.Exec("INSERT OR REPLACE INTO config (key, value) VALUES (?, ?)", key, value)
 	return err
 }
+
+// Size returns the size of the database file in bytes
+func (db *DB) Size() (int64, error) {
+	var size int64
+	err := db.conn.QueryRow("SELECT page_count * page_size FROM pragma_page_count(), pragma_page_size()").Scan(&size)
+	return size, err
+}
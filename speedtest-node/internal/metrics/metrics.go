@@ -0,0 +1,119 @@
+package metrics
+
+import (
+	"mark7888/speedtest-node/internal/version"
+	"mark7888/speedtest-node/pkg/models"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Registry holds the node's metrics, served on the status endpoint's /metrics
+var Registry = prometheus.NewRegistry()
+
+var factory = promauto.With(Registry)
+
+var (
+	Info = factory.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "speedtest_node_info",
+		Help: "Node build information, always 1.",
+	}, []string{"version"})
+
+	TestsTotal = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "speedtest_node_tests_total",
+		Help: "Speedtests run, by result (success or failure).",
+	}, []string{"result"})
+
+	TestDuration = factory.NewHistogram(prometheus.HistogramOpts{
+		Name:    "speedtest_node_test_duration_seconds",
+		Help:    "Time taken by speedtest runs, including retries.",
+		Buckets: []float64{10, 20, 30, 45, 60, 90, 120, 180, 300},
+	})
+
+	LastTestTimestamp = factory.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "speedtest_node_last_test_timestamp_seconds",
+		Help: "Unix time of the last speedtest, by result (success or failure).",
+	}, []string{"result"})
+
+	DownloadBandwidth = factory.NewGauge(prometheus.GaugeOpts{
+		Name: "speedtest_node_download_bytes_per_second",
+		Help: "Download bandwidth of the latest successful speedtest.",
+	})
+
+	UploadBandwidth = factory.NewGauge(prometheus.GaugeOpts{
+		Name: "speedtest_node_upload_bytes_per_second",
+		Help: "Upload bandwidth of the latest successful speedtest.",
+	})
+
+	PingLatency = factory.NewGauge(prometheus.GaugeOpts{
+		Name: "speedtest_node_ping_latency_seconds",
+		Help: "Idle ping latency of the latest successful speedtest.",
+	})
+
+	PingJitter = factory.NewGauge(prometheus.GaugeOpts{
+		Name: "speedtest_node_ping_jitter_seconds",
+		Help: "Idle ping jitter of the latest successful speedtest.",
+	})
+
+	PacketLoss = factory.NewGauge(prometheus.GaugeOpts{
+		Name: "speedtest_node_packet_loss_ratio",
+		Help: "Packet loss of the latest successful speedtest, from 0 to 1.",
+	})
+
+	SyncedTotal = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "speedtest_node_synced_total",
+		Help: "Results delivered to the server, by kind (measurement or failed_measurement).",
+	}, []string{"kind"})
+
+	SyncErrorsTotal = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "speedtest_node_sync_errors_total",
+		Help: "Failed attempts to deliver a batch to the server, by kind (measurement or failed_measurement).",
+	}, []string{"kind"})
+
+	AliveTotal = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "speedtest_node_alive_signals_total",
+		Help: "Alive signals sent to the server, by result (success or failure).",
+	}, []string{"result"})
+
+	Unsent = factory.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "speedtest_node_unsent",
+		Help: "Results waiting to be sent to the server, by kind (measurement or failed_measurement).",
+	}, []string{"kind"})
+
+	DatabaseSize = factory.NewGauge(prometheus.GaugeOpts{
+		Name: "speedtest_node_database_size_bytes",
+		Help: "Size of the local SQLite database.",
+	})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	Info.WithLabelValues(version.Get()).Set(1)
+}
+
+// ObserveMeasurement records the values of a successful speedtest
+func ObserveMeasurement(m *models.Measurement) {
+	LastTestTimestamp.WithLabelValues("success").Set(float64(m.Timestamp.Unix()))
+
+	if m.Download != nil {
+		DownloadBandwidth.Set(float64(m.Download.Bandwidth))
+	}
+	if m.Upload != nil {
+		UploadBandwidth.Set(float64(m.Upload.Bandwidth))
+	}
+	if m.Ping != nil {
+		PingLatency.Set(m.Ping.Latency / 1000)
+		PingJitter.Set(m.Ping.Jitter / 1000)
+	}
+	PacketLoss.Set(m.PacketLoss / 100)
+}
+
+// ObserveFailure records a failed speedtest
+func ObserveFailure(at time.Time) {
+	LastTestTimestamp.WithLabelValues("failure").Set(float64(at.Unix()))
+}
@@ -0,0 +1,55 @@
+package scheduler
+
+import (
+	"mark7888/speedtest-node/internal/version"
+	"mark7888/speedtest-node/pkg/models"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// inventory describes this node for the server. Values that cannot be
+// determined are left empty rather than failing the alive signal.
+func (s *Scheduler) inventory() *models.NodeInventory {
+	inventory := &models.NodeInventory{
+		Version:       version.Get(),
+		Backends:      s.executor.Backends(),
+		OS:            runtime.GOOS,
+		Kernel:        kernelVersion(),
+		Arch:          runtime.GOARCH,
+		UptimeSeconds: int64(time.Since(s.startedAt).Seconds()),
+	}
+
+	size, err := s.database.Size()
+	if err != nil {
+		s.logger.Debug("Failed to get database size", zap.Error(err))
+	}
+	inventory.DBSizeBytes = size
+
+	unsent, unsentFailed, err := s.database.CountUnsent()
+	if err != nil {
+		s.logger.Debug("Failed to count unsent measurements", zap.Error(err))
+	}
+	inventory.UnsentMeasurements = unsent
+	inventory.UnsentFailedMeasurements = unsentFailed
+
+	lastTest, err := s.database.GetLastMeasurementTime()
+	if err != nil {
+		s.logger.Debug("Failed to get last measurement time", zap.Error(err))
+	}
+	inventory.LastSuccessfulTest = lastTest
+
+	return inventory
+}
+
+// kernelVersion returns the running kernel release, "" where it is not exposed (non-Linux)
+func kernelVersion() string {
+	release, err := os.ReadFile("/proc/sys/kernel/osrelease")
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(release))
+}
@@ -0,0 +1,175 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"fmt"
+	"mark7888/speedtest-node/pkg/models"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"go.uber.org/zap"
+)
+
+// Keys under which the last applied server config is kept in the local config table
+const (
+	remoteConfigKey        = "remote_config"
+	remoteConfigVersionKey = "remote_config_version"
+)
+
+// settings are the scheduler's tunables
+type settings struct {
+	speedtestCron    string
+	speedtestTimeout time.Duration
+	retryOnFailure   bool
+	batchSize        int
+	syncInterval     time.Duration
+	aliveInterval    time.Duration
+	retentionDays    int
+}
+
+// overlay returns the settings with the server-managed values applied on top
+func (s settings) overlay(remote *models.NodeSettings) (settings, error) {
+	if remote.SpeedtestCron != nil {
+		if _, err := cron.ParseStandard(*remote.SpeedtestCron); err != nil {
+			return s, fmt.Errorf("invalid speedtest_cron: %w", err)
+		}
+		s.speedtestCron = *remote.SpeedtestCron
+	}
+	if remote.RetryOnFailure != nil {
+		s.retryOnFailure = *remote.RetryOnFailure
+	}
+	if remote.BatchSize != nil {
+		if *remote.BatchSize < 1 {
+			return s, fmt.Errorf("invalid batch_size: %d", *remote.BatchSize)
+		}
+		s.batchSize = *remote.BatchSize
+	}
+	if remote.RetentionDays != nil {
+		if *remote.RetentionDays < 1 {
+			return s, fmt.Errorf("invalid retention_days: %d", *remote.RetentionDays)
+		}
+		s.retentionDays = *remote.RetentionDays
+	}
+
+	durations := []struct {
+		name  string
+		value *string
+		out   *time.Duration
+	}{
+		{"speedtest_timeout", remote.SpeedtestTimeout, &s.speedtestTimeout},
+		{"sync_interval", remote.SyncInterval, &s.syncInterval},
+		{"alive_interval", remote.AliveInterval, &s.aliveInterval},
+	}
+	for _, d := range durations {
+		if d.value == nil {
+			continue
+		}
+		parsed, err := time.ParseDuration(*d.value)
+		if err != nil || parsed <= 0 {
+			return s, fmt.Errorf("invalid %s: %q", d.name, *d.value)
+		}
+		*d.out = parsed
+	}
+
+	return s, nil
+}
+
+// applyRemoteConfig applies server-managed settings on top of the node's own
+// config without a restart. A nil remote restores the node's own config.
+// The alive interval only affects alive polling; a connected control channel
+// keeps the heartbeat interval it was started with.
+func (s *Scheduler) applyRemoteConfig(version string, remote *models.NodeSettings) error {
+	next := s.base
+	if remote != nil {
+		var err error
+		if next, err = s.base.overlay(remote); err != nil {
+			return err
+		}
+	}
+
+	s.settingsMu.Lock()
+	defer s.settingsMu.Unlock()
+
+	if next.speedtestCron != s.settings.speedtestCron {
+		entryID, err := s.cron.AddFunc(next.speedtestCron, s.runSpeedtest)
+		if err != nil {
+			return fmt.Errorf("invalid speedtest_cron: %w", err)
+		}
+		s.cron.Remove(s.cronEntry)
+		s.cronEntry = entryID
+	}
+
+	s.executor.Configure(next.speedtestTimeout, next.retryOnFailure)
+
+	if s.syncTicker != nil && next.syncInterval != s.settings.syncInterval {
+		s.syncTicker.Reset(next.syncInterval)
+	}
+	if s.aliveTicker != nil && next.aliveInterval != s.settings.aliveInterval {
+		s.aliveTicker.Reset(next.aliveInterval)
+	}
+
+	s.settings = next
+
+	s.logger.Info("Applied server config",
+		zap.String("config_version", version),
+		zap.String("speedtest_cron", next.speedtestCron),
+		zap.Duration("speedtest_timeout", next.speedtestTimeout),
+		zap.Bool("retry_on_failure", next.retryOnFailure),
+		zap.Int("batch_size", next.batchSize),
+		zap.Duration("sync_interval", next.syncInterval),
+		zap.Duration("alive_interval", next.aliveInterval),
+		zap.Int("retention_days", next.retentionDays),
+	)
+
+	// Keep the config across restarts; it is already live, so a failure here
+	// only means the server has to send it again after a restart
+	data := ""
+	if remote != nil {
+		encoded, err := json.Marshal(remote)
+		if err != nil {
+			return fmt.Errorf("failed to encode server config: %w", err)
+		}
+		data = string(encoded)
+	}
+	if err := s.database.SetConfig(remoteConfigKey, data); err != nil {
+		s.logger.Warn("Failed to store server config", zap.Error(err))
+	} else if err := s.database.SetConfig(remoteConfigVersionKey, version); err != nil {
+		s.logger.Warn("Failed to store server config version", zap.Error(err))
+	}
+
+	return nil
+}
+
+// loadRemoteConfig re-applies the server config stored by a previous run
+func (s *Scheduler) loadRemoteConfig() {
+	version, err := s.database.GetConfig(remoteConfigVersionKey)
+	if err != nil || version == "" {
+		return
+	}
+	data, err := s.database.GetConfig(remoteConfigKey)
+	if err != nil || data == "" {
+		return
+	}
+
+	var remote models.NodeSettings
+	if err := json.Unmarshal([]byte(data), &remote); err != nil {
+		s.logger.Warn("Ignoring stored server config", zap.Error(err))
+		return
+	}
+
+	if err := s.applyRemoteConfig(version, &remote); err != nil {
+		s.logger.Warn("Ignoring stored server config", zap.Error(err))
+		return
+	}
+
+	if s.aliveSender != nil {
+		s.aliveSender.SetConfigVersion(version)
+	}
+}
+
+// currentSettings returns the settings in effect
+func (s *Scheduler) currentSettings() settings {
+	s.settingsMu.Lock()
+	defer s.settingsMu.Unlock()
+	return s.settings
+}
@@ -1,9 +1,14 @@
 package scheduler
 
 import (
+	"encoding/json"
 	"mark7888/speedtest-node/internal/db"
+	"mark7888/speedtest-node/internal/metrics"
 	"mark7888/speedtest-node/internal/speedtest"
 	"mark7888/speedtest-node/internal/sync"
+	"mark7888/speedtest-node/pkg/models"
+	"slices"
+	gosync "sync"
 	"time"
 
 	"github.com/robfig/cron/v3"
@@ -18,10 +23,20 @@ type Scheduler struct {
 	database        *db.DB
 	sender          *sync.Sender
 	aliveSender     *sync.AliveSender
-	syncInterval    time.Duration
-	aliveInterval   time.Duration
-	retentionDays   int
-	batchSize       int
+	controlChannel  *sync.ControlChannel
+	syncMu          gosync.Mutex // serializes scheduled and on-demand syncs
+	testMu          gosync.Mutex // only one speedtest runs at a time
+	base            settings     // from the node's own flags/environment
+	settingsMu      gosync.Mutex // guards settings, cronEntry and the tickers
+	settings        settings     // base with server-managed settings applied
+	cronEntry       cron.EntryID
+	syncTicker      *time.Ticker
+	aliveTicker     *time.Ticker
+	startedAt       time.Time
+	statusMu        gosync.Mutex // guards lastTest, lastResult and server
+	lastTest        *models.TestStatus
+	lastResult      *models.Measurement
+	server          serverHealth
 	stopSyncChan    chan struct{}
 	stopAliveChan   chan struct{}
 	stopCleanupChan chan struct{}
@@ -34,6 +49,7 @@ func New(
 	database *db.DB,
 	sender *sync.Sender,
 	aliveSender *sync.AliveSender,
+	controlChannel *sync.ControlChannel,
 	syncInterval time.Duration,
 	aliveInterval time.Duration,
 	retentionDays int,
@@ -42,6 +58,17 @@ func New(
 ) (*Scheduler, error) {
 	c := cron.New(cron.WithLogger(cron.VerbosePrintfLogger(&cronLogger{logger})))
 
+	speedtestTimeout, retryOnFailure := executor.Options()
+	base := settings{
+		speedtestCron:    speedtestCron,
+		speedtestTimeout: speedtestTimeout,
+		retryOnFailure:   retryOnFailure,
+		batchSize:        batchSize,
+		syncInterval:     syncInterval,
+		aliveInterval:    aliveInterval,
+		retentionDays:    retentionDays,
+	}
+
 	s := &Scheduler{
 		cron:            c,
 		logger:          logger,
@@ -49,20 +76,40 @@ func New(
 		database:        database,
 		sender:          sender,
 		aliveSender:     aliveSender,
-		syncInterval:    syncInterval,
-		aliveInterval:   aliveInterval,
-		retentionDays:   retentionDays,
-		batchSize:       batchSize,
+		controlChannel:  controlChannel,
+		base:            base,
+		settings:        base,
+		startedAt:       time.Now(),
 		stopSyncChan:    make(chan struct{}),
 		stopAliveChan:   make(chan struct{}),
 		stopCleanupChan: make(chan struct{}),
 	}
 
 	// Schedule speedtest
-	_, err := c.AddFunc(speedtestCron, s.runSpeedtest)
+	entryID, err := c.AddFunc(speedtestCron, s.runSpeedtest)
 	if err != nil {
 		return nil, err
 	}
+	s.cronEntry = entryID
+
+	// Commands the server can push over the control channel
+	if controlChannel != nil {
+		controlChannel.Handle("sync_now", s.handleSyncNow)
+	}
+
+	// Commands and settings the server delivers in alive responses
+	if aliveSender != nil {
+		aliveSender.OnCommand(s.handleQueuedCommand)
+		aliveSender.OnConfig(s.applyRemoteConfig)
+		aliveSender.SetInventoryProvider(s.inventory)
+	}
+
+	// Settings received from the server before the last restart
+	s.loadRemoteConfig()
+
+	// Latest values for the status endpoint and metrics
+	s.loadLastResult()
+	s.refreshStorageMetrics()
 
 	logger.Info("Scheduler initialized", zap.String("speedtest_cron", speedtestCron))
 
@@ -76,6 +123,12 @@ func (s *Scheduler) Start() {
 	// Start cron scheduler (for speedtest)
 	s.cron.Start()
 
+	current := s.currentSettings()
+	s.settingsMu.Lock()
+	s.syncTicker = time.NewTicker(current.syncInterval)
+	s.aliveTicker = time.NewTicker(current.aliveInterval)
+	s.settingsMu.Unlock()
+
 	// Start background workers
 	go s.syncWorker()
 	go s.aliveWorker()
@@ -96,39 +149,146 @@ func (s *Scheduler) Stop() {
 	close(s.stopCleanupChan)
 }
 
-// runSpeedtest executes a speedtest and stores the result
+// runSpeedtest executes a scheduled speedtest and stores the result.
+// It is skipped if an on-demand test is still running.
 func (s *Scheduler) runSpeedtest() {
+	if !s.testMu.TryLock() {
+		s.logger.Info("Speedtest already running, skipping scheduled run")
+		return
+	}
+	defer s.testMu.Unlock()
+
 	s.logger.Info("Running scheduled speedtest")
 
+	s.executeSpeedtest()
+}
+
+// executeSpeedtest runs the speedtest and stores the result locally;
+// the caller must hold testMu
+func (s *Scheduler) executeSpeedtest() (*models.Measurement, error) {
+	defer s.refreshStorageMetrics()
+
+	startedAt := time.Now()
 	measurement, err := s.executor.Run()
 	if err != nil {
 		// Store as failed measurement
-		s.database.InsertFailedMeasurement(time.Now().UTC(), err.Error(), 1)
-		return
+		failedAt := time.Now().UTC()
+		s.recordTest(failedAt, time.Since(startedAt), nil, err)
+		s.database.InsertFailedMeasurement(failedAt, err.Error(), 1, s.clockOffsetMs())
+		return nil, err
 	}
+	s.recordTest(measurement.Timestamp, time.Since(startedAt), measurement, nil)
+
+	// Recorded with the result so the server corrects it with the offset
+	// that applied when the test ran, even if the clock is stepped later
+	measurement.ClockOffsetMs = s.clockOffsetMs()
 
 	// Store measurement
 	if err := s.database.InsertMeasurement(measurement); err != nil {
 		s.logger.Error("Failed to store measurement", zap.Error(err))
+		return nil, err
+	}
+
+	return measurement, nil
+}
+
+// clockOffsetMs returns the current estimate of the node's clock offset
+// from server time, nil when offline or not estimated yet
+func (s *Scheduler) clockOffsetMs() *int64 {
+	if s.aliveSender == nil {
+		return nil
+	}
+	offset, ok := s.aliveSender.ClockOffset()
+	if !ok {
+		return nil
+	}
+	offsetMs := offset.Milliseconds()
+	return &offsetMs
+}
+
+// handleQueuedCommand runs a command delivered in an alive response.
+// Commands run in the background so the alive worker is never blocked.
+func (s *Scheduler) handleQueuedCommand(command models.PendingCommand) {
+	switch command.Command {
+	case models.CommandRunTest:
+		go s.runOnDemandSpeedtest(command.ID)
+	default:
+		message := "unknown command: " + command.Command
+		s.reportCommand(command.ID, models.CommandStatusFailed, &message, nil, nil)
+	}
+}
+
+// runOnDemandSpeedtest runs a speedtest requested by the server outside the
+// cron schedule, syncs it right away and reports the outcome
+func (s *Scheduler) runOnDemandSpeedtest(commandID string) {
+	s.testMu.Lock()
+	defer s.testMu.Unlock()
+
+	s.logger.Info("Running on-demand speedtest", zap.String("command_id", commandID))
+	s.reportCommand(commandID, models.CommandStatusRunning, nil, nil, nil)
+
+	measurement, err := s.executeSpeedtest()
+	if err != nil {
+		message := err.Error()
+		s.syncAll()
+		s.reportCommand(commandID, models.CommandStatusFailed, &message, nil, nil)
+		return
+	}
+
+	// Sync before reporting so the server can resolve the measurement ID
+	s.syncAll()
+
+	timestamp := measurement.Timestamp.UTC()
+	s.reportCommand(commandID, models.CommandStatusCompleted, nil, &timestamp, measurement.ClockOffsetMs)
+}
+
+// reportCommand reports command progress to the server. clockOffsetMs is
+// the offset recorded with the measurement, if there is one.
+func (s *Scheduler) reportCommand(commandID, status string, errorMessage *string, measurementTimestamp *time.Time, clockOffsetMs *int64) {
+	// Skip if sender is not configured (offline mode)
+	if s.sender == nil {
+		return
 	}
+
+	// Errors are logged by the sender; the server expires commands that never finish
+	_ = s.sender.ReportCommandResult(commandID, status, errorMessage, measurementTimestamp, clockOffsetMs)
 }
 
 // syncWorker periodically syncs unsent measurements with the server
 func (s *Scheduler) syncWorker() {
-	ticker := time.NewTicker(s.syncInterval)
-	defer ticker.Stop()
+	defer s.syncTicker.Stop()
 
 	for {
 		select {
-		case <-ticker.C:
-			s.syncMeasurements()
-			s.syncFailedMeasurements()
+		case <-s.syncTicker.C:
+			s.syncAll()
 		case <-s.stopSyncChan:
 			return
 		}
 	}
 }
 
+// syncAll sends all unsent measurements and failed measurements
+func (s *Scheduler) syncAll() {
+	s.syncMu.Lock()
+	defer s.syncMu.Unlock()
+
+	s.syncMeasurements()
+	s.syncFailedMeasurements()
+	s.refreshStorageMetrics()
+}
+
+// handleSyncNow runs a sync immediately in response to a server command
+func (s *Scheduler) handleSyncNow(json.RawMessage) (interface{}, error) {
+	s.syncAll()
+
+	unsent, err := s.database.GetUnsentMeasurements(s.currentSettings().batchSize)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]int{"unsent_measurements": len(unsent)}, nil
+}
+
 // syncMeasurements sends unsent measurements to the server
 func (s *Scheduler) syncMeasurements() {
 	// Skip if sender is not configured (offline mode)
@@ -136,7 +296,7 @@ func (s *Scheduler) syncMeasurements() {
 		return
 	}
 
-	measurements, err := s.database.GetUnsentMeasurements(s.batchSize)
+	measurements, err := s.database.GetUnsentMeasurements(s.currentSettings().batchSize)
 	if err != nil {
 		s.logger.Error("Failed to get unsent measurements", zap.Error(err))
 		return
@@ -148,16 +308,23 @@ func (s *Scheduler) syncMeasurements() {
 
 	s.logger.Debug("Found unsent measurements", zap.Int("count", len(measurements)))
 
-	if err := s.sender.SendMeasurements(measurements); err != nil {
+	deferred, err := s.sender.SendMeasurements(measurements)
+	if err != nil {
 		s.logger.Warn("Failed to sync measurements", zap.Error(err))
+		metrics.SyncErrorsTotal.WithLabelValues("measurement").Inc()
+		s.recordServerResult(err)
 		return
 	}
+	s.recordServerResult(nil)
 
-	// Mark as sent
-	ids := make([]int64, len(measurements))
-	for i, m := range measurements {
-		ids[i] = m.ID
+	// Mark as sent, except those the server asked to send again later
+	ids := make([]int64, 0, len(measurements))
+	for _, m := range measurements {
+		if !slices.Contains(deferred, m.ID) {
+			ids = append(ids, m.ID)
+		}
 	}
+	metrics.SyncedTotal.WithLabelValues("measurement").Add(float64(len(ids)))
 
 	if err := s.database.MarkMeasurementsAsSent(ids); err != nil {
 		s.logger.Error("Failed to mark measurements as sent", zap.Error(err))
@@ -171,7 +338,7 @@ func (s *Scheduler) syncFailedMeasurements() {
 		return
 	}
 
-	failed, err := s.database.GetUnsentFailedMeasurements(s.batchSize)
+	failed, err := s.database.GetUnsentFailedMeasurements(s.currentSettings().batchSize)
 	if err != nil {
 		s.logger.Error("Failed to get unsent failed measurements", zap.Error(err))
 		return
@@ -183,50 +350,68 @@ func (s *Scheduler) syncFailedMeasurements() {
 
 	s.logger.Debug("Found unsent failed measurements", zap.Int("count", len(failed)))
 
-	if err := s.sender.SendFailedMeasurements(failed); err != nil {
+	deferred, err := s.sender.SendFailedMeasurements(failed)
+	if err != nil {
 		s.logger.Warn("Failed to sync failed measurements", zap.Error(err))
+		metrics.SyncErrorsTotal.WithLabelValues("failed_measurement").Inc()
+		s.recordServerResult(err)
 		return
 	}
+	s.recordServerResult(nil)
 
-	// Mark as sent
-	ids := make([]int64, len(failed))
-	for i, f := range failed {
-		ids[i] = f.ID
+	// Mark as sent, except those the server asked to send again later
+	ids := make([]int64, 0, len(failed))
+	for _, f := range failed {
+		if !slices.Contains(deferred, f.ID) {
+			ids = append(ids, f.ID)
+		}
 	}
+	metrics.SyncedTotal.WithLabelValues("failed_measurement").Add(float64(len(ids)))
 
 	if err := s.database.MarkFailedMeasurementsAsSent(ids); err != nil {
 		s.logger.Error("Failed to mark failed measurements as sent", zap.Error(err))
 	}
 }
 
-// aliveWorker periodically sends alive signals to the server
+// aliveWorker periodically sends alive signals to the server.
+// While the control channel is connected it carries the heartbeats instead.
 func (s *Scheduler) aliveWorker() {
+	defer s.aliveTicker.Stop()
+
 	// Skip if aliveSender is not configured (offline mode)
 	if s.aliveSender == nil {
 		<-s.stopAliveChan
 		return
 	}
 
-	ticker := time.NewTicker(s.aliveInterval)
-	defer ticker.Stop()
-
 	// Send immediately on start
-	if err := s.aliveSender.SendAlive(); err != nil {
-		s.logger.Warn("Failed to send alive signal", zap.Error(err))
-	}
+	s.sendAlive()
 
 	for {
 		select {
-		case <-ticker.C:
-			if err := s.aliveSender.SendAlive(); err != nil {
-				s.logger.Warn("Failed to send alive signal", zap.Error(err))
+		case <-s.aliveTicker.C:
+			if s.controlChannel != nil && s.controlChannel.Connected() {
+				continue
 			}
+			s.sendAlive()
 		case <-s.stopAliveChan:
 			return
 		}
 	}
 }
 
+// sendAlive sends an alive signal and records the outcome
+func (s *Scheduler) sendAlive() {
+	err := s.aliveSender.SendAlive()
+	s.recordServerResult(err)
+	if err != nil {
+		s.logger.Warn("Failed to send alive signal", zap.Error(err))
+		metrics.AliveTotal.WithLabelValues("failure").Inc()
+		return
+	}
+	metrics.AliveTotal.WithLabelValues("success").Inc()
+}
+
 // cleanupWorker periodically cleans up old data
 func (s *Scheduler) cleanupWorker() {
 	// Run cleanup once a day
@@ -248,7 +433,7 @@ func (s *Scheduler) cleanupWorker() {
 
 // cleanup removes old data based on retention policy
 func (s *Scheduler) cleanup() {
-	retentionDate := time.Now().AddDate(0, 0, -s.retentionDays)
+	retentionDate := time.Now().AddDate(0, 0, -s.currentSettings().retentionDays)
 
 	s.logger.Info("Running cleanup", zap.Time("before", retentionDate))
 
@@ -259,6 +444,8 @@ func (s *Scheduler) cleanup() {
 	if err := s.database.DeleteFailedMeasurementsBefore(retentionDate); err != nil {
 		s.logger.Error("Failed to delete old failed measurements", zap.Error(err))
 	}
+
+	s.refreshStorageMetrics()
 }
 
 // cronLogger wraps zap logger for cron
@@ -0,0 +1,147 @@
+package scheduler
+
+import (
+	"mark7888/speedtest-node/internal/metrics"
+	"mark7888/speedtest-node/pkg/models"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// serverHealth tracks how the latest exchanges with the server went. It only
+// feeds the status endpoint; failures do not pause syncing.
+type serverHealth struct {
+	consecutiveFailures int
+	lastSuccess         *time.Time
+	lastError           string
+	lastErrorAt         *time.Time
+}
+
+// Status reports what the node is doing for the local status endpoint.
+// Identity fields are left to the caller.
+func (s *Scheduler) Status() *models.NodeStatus {
+	status := &models.NodeStatus{
+		UptimeSeconds: int64(time.Since(s.startedAt).Seconds()),
+	}
+
+	s.settingsMu.Lock()
+	entry := s.cron.Entry(s.cronEntry)
+	s.settingsMu.Unlock()
+	if !entry.Next.IsZero() {
+		next := entry.Next
+		status.NextRun = &next
+	}
+
+	unsent, unsentFailed, err := s.database.CountUnsent()
+	if err != nil {
+		s.logger.Debug("Failed to count unsent measurements", zap.Error(err))
+	}
+	status.Backlog = models.Backlog{
+		UnsentMeasurements:       unsent,
+		UnsentFailedMeasurements: unsentFailed,
+	}
+
+	s.statusMu.Lock()
+	status.LastTest = s.lastTest
+	status.LastResult = s.lastResult
+	status.Server = models.ServerStatus{
+		Health:              models.ServerHealthOK,
+		ConsecutiveFailures: s.server.consecutiveFailures,
+		LastSuccess:         s.server.lastSuccess,
+		LastError:           s.server.lastError,
+		LastErrorAt:         s.server.lastErrorAt,
+	}
+	s.statusMu.Unlock()
+
+	switch {
+	case s.sender == nil:
+		status.Server.Health = models.ServerHealthOffline
+	case status.Server.ConsecutiveFailures > 0:
+		status.Server.Health = models.ServerHealthFailing
+	}
+
+	if s.controlChannel != nil {
+		connected := s.controlChannel.Connected()
+		status.Server.ControlChannel = &connected
+	}
+
+	return status
+}
+
+// recordTest remembers the outcome of a speedtest run and updates its metrics
+func (s *Scheduler) recordTest(at time.Time, duration time.Duration, measurement *models.Measurement, err error) {
+	metrics.TestDuration.Observe(duration.Seconds())
+
+	test := &models.TestStatus{Timestamp: at, Success: err == nil}
+	if err != nil {
+		test.Error = err.Error()
+		metrics.TestsTotal.WithLabelValues("failure").Inc()
+		metrics.ObserveFailure(at)
+	} else {
+		metrics.TestsTotal.WithLabelValues("success").Inc()
+		metrics.ObserveMeasurement(measurement)
+	}
+
+	s.statusMu.Lock()
+	defer s.statusMu.Unlock()
+	s.lastTest = test
+	if measurement != nil {
+		s.lastResult = measurement
+	}
+}
+
+// recordServerResult tracks whether an exchange with the server succeeded
+func (s *Scheduler) recordServerResult(err error) {
+	now := time.Now()
+
+	s.statusMu.Lock()
+	defer s.statusMu.Unlock()
+
+	if err != nil {
+		s.server.consecutiveFailures++
+		s.server.lastError = err.Error()
+		s.server.lastErrorAt = &now
+		return
+	}
+
+	s.server.consecutiveFailures = 0
+	s.server.lastSuccess = &now
+}
+
+// loadLastResult restores the latest measurement from the database so the
+// status endpoint and metrics have values before the first test after a restart
+func (s *Scheduler) loadLastResult() {
+	measurement, err := s.database.GetLastMeasurement()
+	if err != nil {
+		s.logger.Warn("Failed to load last measurement", zap.Error(err))
+		return
+	}
+	if measurement == nil {
+		return
+	}
+
+	metrics.ObserveMeasurement(measurement)
+
+	s.statusMu.Lock()
+	defer s.statusMu.Unlock()
+	s.lastResult = measurement
+	s.lastTest = &models.TestStatus{Timestamp: measurement.Timestamp, Success: true}
+}
+
+// refreshStorageMetrics updates the backlog and database size metrics
+func (s *Scheduler) refreshStorageMetrics() {
+	unsent, unsentFailed, err := s.database.CountUnsent()
+	if err != nil {
+		s.logger.Debug("Failed to count unsent measurements", zap.Error(err))
+	} else {
+		metrics.Unsent.WithLabelValues("measurement").Set(float64(unsent))
+		metrics.Unsent.WithLabelValues("failed_measurement").Set(float64(unsentFailed))
+	}
+
+	size, err := s.database.Size()
+	if err != nil {
+		s.logger.Debug("Failed to get database size", zap.Error(err))
+	} else {
+		metrics.DatabaseSize.Set(float64(size))
+	}
+}
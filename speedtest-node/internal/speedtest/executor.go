@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"mark7888/speedtest-node/pkg/models"
 	"os/exec"
+	"sync"
 	"time"
 
 	"go.uber.org/zap"
@@ -12,6 +13,7 @@ import (
 
 // Executor handles speedtest execution
 type Executor struct {
+	mu             sync.RWMutex
 	timeout        time.Duration
 	retryOnFailure bool
 	logger         *zap.Logger
@@ -26,22 +28,39 @@ func NewExecutor(timeout time.Duration, retryOnFailure bool, logger *zap.Logger)
 	}
 }
 
+// Configure changes the timeout and retry behaviour for subsequent runs
+func (e *Executor) Configure(timeout time.Duration, retryOnFailure bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.timeout = timeout
+	e.retryOnFailure = retryOnFailure
+}
+
+// Options returns the current timeout and retry behaviour
+func (e *Executor) Options() (time.Duration, bool) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.timeout, e.retryOnFailure
+}
+
 // Run executes a speedtest and returns the measurement
 // If enabled, it will retry once on failure
 func (e *Executor) Run() (*models.Measurement, error) {
 	e.logger.Info("Starting speedtest")
 
+	timeout, retryOnFailure := e.Options()
+
 	// Try to run speedtest
-	measurement, err := e.executeSpeedtest()
+	measurement, err := e.executeSpeedtest(timeout)
 	if err != nil {
 		e.logger.Warn("Speedtest failed", zap.Error(err))
 
 		// Retry if enabled
-		if e.retryOnFailure {
+		if retryOnFailure {
 			e.logger.Info("Retrying speedtest after 5 seconds")
 			time.Sleep(5 * time.Second)
 
-			measurement, err = e.executeSpeedtest()
+			measurement, err = e.executeSpeedtest(timeout)
 			if err != nil {
 				e.logger.Error("Speedtest failed after retry", zap.Error(err))
 				return nil, fmt.Errorf("speedtest failed after retry: %w", err)
@@ -61,10 +80,19 @@ func (e *Executor) Run() (*models.Measurement, error) {
 	return measurement, nil
 }
 
+// Backends returns the speedtest backends installed on this host
+func (e *Executor) Backends() []string {
+	backends := []string{}
+	if _, err := exec.LookPath("speedtest"); err == nil {
+		backends = append(backends, "ookla")
+	}
+	return backends
+}
+
 // executeSpeedtest runs the speedtest CLI command
-func (e *Executor) executeSpeedtest() (*models.Measurement, error) {
+func (e *Executor) executeSpeedtest(timeout time.Duration) (*models.Measurement, error) {
 	// Create context with timeout
-	ctx, cancel := context.WithTimeout(context.Background(), e.timeout)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 
 	// Run speedtest command
@@ -73,7 +101,7 @@ func (e *Executor) executeSpeedtest() (*models.Measurement, error) {
 	output, err := cmd.Output()
 	if err != nil {
 		if ctx.Err() == context.DeadlineExceeded {
-			return nil, fmt.Errorf("speedtest timeout after %v", e.timeout)
+			return nil, fmt.Errorf("speedtest timeout after %v", timeout)
 		}
 		return nil, fmt.Errorf("speedtest execution failed: %w", err)
 	}
@@ -0,0 +1,250 @@
+package status
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"mark7888/speedtest-node/pkg/models"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+//go:embed web
+var webFiles embed.FS
+
+const (
+	defaultDashboardHours = 24
+	maxDashboardHours     = 90 * 24
+	defaultDashboardLimit = 50
+	maxDashboardLimit     = 1000
+
+	// Ranges up to this long are aggregated per hour, longer ones per day
+	hourlyAggregateLimit = 72 * time.Hour
+)
+
+// Store reads local results for the dashboard
+type Store interface {
+	GetMeasurementsSince(since time.Time, limit int) ([]*models.Measurement, error)
+	GetFailedMeasurementsSince(since time.Time, limit int) ([]*models.FailedMeasurement, error)
+	GetAggregateStats(bounds []time.Time) ([]models.AggregateStats, error)
+}
+
+// EnableDashboard serves a read-only web dashboard on / with its JSON API
+// under /api, so a node without a data server still shows its results.
+// Call it before Start.
+func (s *Server) EnableDashboard(store Store) {
+	s.store = store
+
+	assets, err := fs.Sub(webFiles, "web")
+	if err != nil {
+		// The embedded directory is part of the binary
+		panic(err)
+	}
+
+	s.mux.Handle("GET /{$}", http.FileServerFS(assets))
+	s.mux.Handle("GET /assets/", http.StripPrefix("/assets/", http.FileServerFS(assets)))
+	s.mux.HandleFunc("GET /api/measurements", s.handleMeasurements)
+	s.mux.HandleFunc("GET /api/failures", s.handleFailures)
+	s.mux.HandleFunc("GET /api/aggregates", s.handleAggregates)
+}
+
+// handleMeasurements lists the latest successful measurements
+// GET /api/measurements?hours=24&limit=50
+func (s *Server) handleMeasurements(w http.ResponseWriter, r *http.Request) {
+	hours, limit, err := rangeParams(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	measurements, err := s.store.GetMeasurementsSince(since(hours), limit)
+	if err != nil {
+		s.logger.Error("Failed to read measurements for dashboard", zap.Error(err))
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to read measurements"})
+		return
+	}
+	if measurements == nil {
+		measurements = []*models.Measurement{}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"measurements": measurements})
+}
+
+// handleFailures lists the latest failed speedtest attempts
+// GET /api/failures?hours=24&limit=50
+func (s *Server) handleFailures(w http.ResponseWriter, r *http.Request) {
+	hours, limit, err := rangeParams(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	failures, err := s.store.GetFailedMeasurementsSince(since(hours), limit)
+	if err != nil {
+		s.logger.Error("Failed to read failed measurements for dashboard", zap.Error(err))
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to read failed measurements"})
+		return
+	}
+	if failures == nil {
+		failures = []*models.FailedMeasurement{}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"failures": failures})
+}
+
+// handleAggregates summarizes results per hour or per day for the charts.
+// The database does the counting, so long ranges stay cheap.
+// GET /api/aggregates?hours=24
+func (s *Server) handleAggregates(w http.ResponseWriter, r *http.Request) {
+	hours, _, err := rangeParams(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	to := time.Now()
+	from := to.Add(-time.Duration(hours) * time.Hour)
+	interval, bounds := aggregateWindows(from, to)
+
+	buckets, err := s.store.GetAggregateStats(utc(bounds))
+	if err != nil {
+		s.logger.Error("Failed to aggregate measurements for dashboard", zap.Error(err))
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to aggregate measurements"})
+		return
+	}
+	summary, err := s.store.GetAggregateStats(utc([]time.Time{from, to}))
+	if err != nil {
+		s.logger.Error("Failed to summarize measurements for dashboard", zap.Error(err))
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to aggregate measurements"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, aggregates(from, to, interval, bounds, buckets, summary[0]))
+}
+
+// since returns the start of a range reaching back hours from now. Stored
+// timestamps are UTC and compared as strings, so the bound must be too.
+func since(hours int) time.Time {
+	return time.Now().Add(-time.Duration(hours) * time.Hour).UTC()
+}
+
+// utc converts bounds to UTC for comparison with stored timestamps
+func utc(bounds []time.Time) []time.Time {
+	converted := make([]time.Time, len(bounds))
+	for i, t := range bounds {
+		converted[i] = t.UTC()
+	}
+	return converted
+}
+
+// rangeParams parses the hours and limit query parameters
+func rangeParams(r *http.Request) (int, int, error) {
+	hours, err := intParam(r, "hours", defaultDashboardHours, maxDashboardHours)
+	if err != nil {
+		return 0, 0, err
+	}
+	limit, err := intParam(r, "limit", defaultDashboardLimit, maxDashboardLimit)
+	if err != nil {
+		return 0, 0, err
+	}
+	return hours, limit, nil
+}
+
+// intParam parses a positive integer query parameter, capped at max
+func intParam(r *http.Request, name string, def, max int) (int, error) {
+	raw := r.URL.Query().Get(name)
+	if raw == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("%s must be a positive integer", name)
+	}
+	return min(n, max), nil
+}
+
+// aggregateWindows splits a range into hourly or daily buckets in the
+// node's local time zone, so days line up with the household's calendar.
+// bounds holds the start of every bucket followed by the end of the last
+// one; every bucket in the range is included, to keep gaps visible.
+func aggregateWindows(from, to time.Time) (interval string, bounds []time.Time) {
+	interval = models.AggregateIntervalHour
+	if to.Sub(from) > hourlyAggregateLimit {
+		interval = models.AggregateIntervalDay
+	}
+
+	from = from.Local()
+	t := time.Date(from.Year(), from.Month(), from.Day(), from.Hour(), 0, 0, 0, from.Location())
+	if interval == models.AggregateIntervalDay {
+		t = time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, from.Location())
+	}
+	for ; !t.After(to); t = nextWindow(t, interval) {
+		bounds = append(bounds, t)
+	}
+
+	return interval, append(bounds, t)
+}
+
+// nextWindow returns the start of the bucket after the one starting at t
+func nextWindow(t time.Time, interval string) time.Time {
+	if interval == models.AggregateIntervalDay {
+		return t.AddDate(0, 0, 1)
+	}
+	return t.Add(time.Hour)
+}
+
+// aggregates builds the dashboard response from the totals of each bucket
+// and of the whole range
+func aggregates(from, to time.Time, interval string, bounds []time.Time, buckets []models.AggregateStats, summary models.AggregateStats) *models.DashboardAggregates {
+	result := &models.DashboardAggregates{
+		From:     from,
+		To:       to,
+		Interval: interval,
+		Summary:  bucket(from, summary),
+		Buckets:  make([]models.AggregateBucket, 0, len(buckets)),
+	}
+	for i, stats := range buckets {
+		result.Buckets = append(result.Buckets, bucket(bounds[i], stats))
+	}
+	return result
+}
+
+// bucket converts the totals of one window into display units
+func bucket(start time.Time, stats models.AggregateStats) models.AggregateBucket {
+	return models.AggregateBucket{
+		Start:           start,
+		Tests:           stats.Tests,
+		Failures:        stats.Failures,
+		AvgDownloadMbps: mbps(avg(stats.Download)),
+		MinDownloadMbps: mbps(stats.Download.Min),
+		MaxDownloadMbps: mbps(stats.Download.Max),
+		AvgUploadMbps:   mbps(avg(stats.Upload)),
+		MinUploadMbps:   mbps(stats.Upload.Min),
+		MaxUploadMbps:   mbps(stats.Upload.Max),
+		AvgPingMs:       round(avg(stats.Ping)),
+		AvgJitterMs:     round(avg(stats.Jitter)),
+		AvgPacketLoss:   round(avg(stats.PacketLoss)),
+	}
+}
+
+// avg returns the mean of a series, zero if it is empty
+func avg(s models.SeriesStats) float64 {
+	if s.Count == 0 {
+		return 0
+	}
+	return s.Sum / float64(s.Count)
+}
+
+// mbps converts a bandwidth in bytes per second to Mbit/s
+func mbps(bytesPerSecond float64) float64 {
+	return round(bytesPerSecond * 8 / 1e6)
+}
+
+// round keeps two decimals, plenty for display
+func round(v float64) float64 {
+	return math.Round(v*100) / 100
+}
@@ -0,0 +1,231 @@
+package status
+
+import (
+	"encoding/json"
+	"mark7888/speedtest-node/pkg/models"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// withLocal runs the test with time.Local set to the named zone
+func withLocal(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Skipf("time zone %s not available: %v", name, err)
+	}
+	saved := time.Local
+	time.Local = loc
+	t.Cleanup(func() { time.Local = saved })
+	return loc
+}
+
+func TestAggregateWindows(t *testing.T) {
+	kolkata := withLocal(t, "Asia/Kolkata") // UTC+05:30, so local hours are not UTC hours
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2026, 3, day, hour, minute, 0, 0, kolkata)
+	}
+
+	tests := []struct {
+		name         string
+		from, to     time.Time
+		wantInterval string
+		wantFirst    time.Time
+		wantBounds   int
+	}{
+		{
+			name: "one day hourly", from: at(10, 9, 15), to: at(11, 9, 15),
+			wantInterval: models.AggregateIntervalHour, wantFirst: at(10, 9, 0), wantBounds: 26,
+		},
+		{
+			name: "on the hour", from: at(10, 9, 0), to: at(10, 12, 0),
+			wantInterval: models.AggregateIntervalHour, wantFirst: at(10, 9, 0), wantBounds: 5,
+		},
+		{
+			name: "three days is still hourly", from: at(10, 9, 15), to: at(13, 9, 15),
+			wantInterval: models.AggregateIntervalHour, wantFirst: at(10, 9, 0), wantBounds: 74,
+		},
+		{
+			name: "a week is daily", from: at(10, 9, 15), to: at(17, 9, 15),
+			wantInterval: models.AggregateIntervalDay, wantFirst: at(10, 0, 0), wantBounds: 9,
+		},
+		{
+			name: "UTC input is bucketed in local time", from: at(10, 9, 15).UTC(), to: at(10, 11, 15).UTC(),
+			wantInterval: models.AggregateIntervalHour, wantFirst: at(10, 9, 0), wantBounds: 4,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			interval, bounds := aggregateWindows(tt.from, tt.to)
+			if interval != tt.wantInterval {
+				t.Errorf("interval = %s, want %s", interval, tt.wantInterval)
+			}
+			if len(bounds) != tt.wantBounds {
+				t.Fatalf("got %d bounds, want %d", len(bounds), tt.wantBounds)
+			}
+			if !bounds[0].Equal(tt.wantFirst) {
+				t.Errorf("first bucket starts %v, want %v", bounds[0], tt.wantFirst)
+			}
+			if last := bounds[len(bounds)-1]; !last.After(tt.to) {
+				t.Errorf("last bound %v does not cover %v", last, tt.to)
+			}
+			for i := 1; i < len(bounds); i++ {
+				if !bounds[i].After(bounds[i-1]) {
+					t.Fatalf("bounds are not increasing at %d: %v", i, bounds[i-1:i+1])
+				}
+			}
+		})
+	}
+}
+
+func TestAggregateWindowsDST(t *testing.T) {
+	berlin := withLocal(t, "Europe/Berlin")
+
+	// Clocks go forward at 02:00 on 29 March 2026, so that day has 23 hours
+	from := time.Date(2026, 3, 27, 12, 0, 0, 0, berlin)
+	_, bounds := aggregateWindows(from, from.AddDate(0, 0, 4))
+	for _, b := range bounds {
+		if b.Hour() != 0 || b.Minute() != 0 {
+			t.Errorf("daily bucket starts at %v, want local midnight", b)
+		}
+	}
+}
+
+func TestBucket(t *testing.T) {
+	start := time.Date(2026, 3, 10, 9, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		stats models.AggregateStats
+		want  models.AggregateBucket
+	}{
+		{
+			name: "empty",
+			want: models.AggregateBucket{Start: start},
+		},
+		{
+			name:  "failures only",
+			stats: models.AggregateStats{Failures: 3},
+			want:  models.AggregateBucket{Start: start, Failures: 3},
+		},
+		{
+			name: "converts and averages",
+			stats: models.AggregateStats{
+				Tests:      2,
+				Download:   models.SeriesStats{Count: 2, Sum: 25000000, Min: 10000000, Max: 15000000},
+				Upload:     models.SeriesStats{Count: 2, Sum: 5000000, Min: 2000000, Max: 3000000},
+				Ping:       models.SeriesStats{Count: 2, Sum: 21},
+				Jitter:     models.SeriesStats{Count: 2, Sum: 2.5},
+				PacketLoss: models.SeriesStats{Count: 2, Sum: 1},
+			},
+			want: models.AggregateBucket{
+				Start: start, Tests: 2,
+				AvgDownloadMbps: 100, MinDownloadMbps: 80, MaxDownloadMbps: 120,
+				AvgUploadMbps: 20, MinUploadMbps: 16, MaxUploadMbps: 24,
+				AvgPingMs: 10.5, AvgJitterMs: 1.25, AvgPacketLoss: 0.5,
+			},
+		},
+		{
+			name: "averages only over reported values",
+			stats: models.AggregateStats{
+				Tests:    3,
+				Download: models.SeriesStats{Count: 1, Sum: 12500000, Min: 12500000, Max: 12500000},
+				Ping:     models.SeriesStats{Count: 3, Sum: 10},
+			},
+			want: models.AggregateBucket{
+				Start: start, Tests: 3,
+				AvgDownloadMbps: 100, MinDownloadMbps: 100, MaxDownloadMbps: 100,
+				AvgPingMs: 3.33,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := bucket(start, tt.stats); got != tt.want {
+				t.Errorf("bucket() = %+v\nwant %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// fakeStore records the bounds the dashboard queries with
+type fakeStore struct {
+	since  []time.Time
+	bounds [][]time.Time
+}
+
+func (f *fakeStore) GetMeasurementsSince(since time.Time, limit int) ([]*models.Measurement, error) {
+	f.since = append(f.since, since)
+	return nil, nil
+}
+
+func (f *fakeStore) GetFailedMeasurementsSince(since time.Time, limit int) ([]*models.FailedMeasurement, error) {
+	f.since = append(f.since, since)
+	return nil, nil
+}
+
+func (f *fakeStore) GetAggregateStats(bounds []time.Time) ([]models.AggregateStats, error) {
+	f.bounds = append(f.bounds, bounds)
+	return make([]models.AggregateStats, len(bounds)-1), nil
+}
+
+func TestDashboardQueriesInUTC(t *testing.T) {
+	withLocal(t, "America/New_York")
+
+	store := &fakeStore{}
+	server := NewServer("", "node", "node", "", nil, nil, zap.NewNop())
+	server.EnableDashboard(store)
+
+	tests := []struct {
+		path         string
+		wantInterval string
+	}{
+		{path: "/api/measurements?hours=6"},
+		{path: "/api/failures?hours=6"},
+		{path: "/api/aggregates?hours=6", wantInterval: models.AggregateIntervalHour},
+		{path: "/api/aggregates?hours=168", wantInterval: models.AggregateIntervalDay},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			*store = fakeStore{}
+			w := httptest.NewRecorder()
+			server.mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+			}
+
+			for _, since := range store.since {
+				if since.Location() != time.UTC {
+					t.Errorf("queried since %v, want UTC", since)
+				}
+			}
+			for _, bounds := range store.bounds {
+				for _, b := range bounds {
+					if b.Location() != time.UTC {
+						t.Errorf("queried bound %v, want UTC", b)
+					}
+				}
+			}
+
+			if tt.wantInterval != "" {
+				var resp models.DashboardAggregates
+				if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+					t.Fatal(err)
+				}
+				if resp.Interval != tt.wantInterval {
+					t.Errorf("interval = %s, want %s", resp.Interval, tt.wantInterval)
+				}
+				if len(resp.Buckets) != len(store.bounds[0])-1 {
+					t.Errorf("got %d buckets for %d bounds", len(resp.Buckets), len(store.bounds[0]))
+				}
+			}
+		})
+	}
+}
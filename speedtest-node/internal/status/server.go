@@ -0,0 +1,131 @@
+package status
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mark7888/speedtest-node/internal/metrics"
+	"mark7888/speedtest-node/internal/version"
+	"mark7888/speedtest-node/pkg/models"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.uber.org/zap"
+)
+
+// Provider reports what the node is doing
+type Provider interface {
+	Status() *models.NodeStatus
+}
+
+// Pinger checks a dependency the node cannot work without
+type Pinger interface {
+	Ping() error
+}
+
+// Server is the node's optional local HTTP server. It exposes /healthz for
+// container health checks, /status as JSON and /metrics for Prometheus,
+// plus the dashboard when enabled. There is no authentication, so bind it
+// to a trusted interface.
+type Server struct {
+	httpServer *http.Server
+	mux        *http.ServeMux
+	nodeID     string
+	nodeName   string
+	transport  string
+	provider   Provider
+	database   Pinger
+	store      Store
+	logger     *zap.Logger
+}
+
+// NewServer creates a status server listening on addr. transport is empty
+// when the node runs without a server.
+func NewServer(addr, nodeID, nodeName, transport string, provider Provider, database Pinger, logger *zap.Logger) *Server {
+	s := &Server{
+		nodeID:    nodeID,
+		nodeName:  nodeName,
+		transport: transport,
+		provider:  provider,
+		database:  database,
+		logger:    logger,
+	}
+
+	mux := http.NewServeMux()
+	s.mux = mux
+	mux.HandleFunc("GET /healthz", s.handleHealth)
+	mux.HandleFunc("GET /status", s.handleStatus)
+	mux.Handle("GET /metrics", promhttp.HandlerFor(metrics.Registry, promhttp.HandlerOpts{}))
+
+	s.httpServer = &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	return s
+}
+
+// Start binds the listen address and serves in the background
+func (s *Server) Start() error {
+	listener, err := net.Listen("tcp", s.httpServer.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", s.httpServer.Addr, err)
+	}
+
+	s.logger.Info("Status server listening", zap.String("addr", listener.Addr().String()))
+
+	go func() {
+		if err := s.httpServer.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.logger.Error("Status server failed", zap.Error(err))
+		}
+	}()
+
+	return nil
+}
+
+// Stop shuts the server down, waiting briefly for requests in flight
+func (s *Server) Stop() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := s.httpServer.Shutdown(ctx); err != nil {
+		s.logger.Warn("Failed to stop status server", zap.Error(err))
+	}
+}
+
+// handleHealth reports whether the node can keep collecting measurements.
+// An unreachable data server does not make the node unhealthy; results
+// queue up locally until it is back.
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	if err := s.database.Ping(); err != nil {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{
+			"status": "unhealthy",
+			"error":  "database unavailable: " + err.Error(),
+		})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// handleStatus reports the latest result, schedule, backlog and server connection
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	status := s.provider.Status()
+	status.NodeID = s.nodeID
+	status.NodeName = s.nodeName
+	status.Version = version.Get()
+	status.Server.Transport = s.transport
+
+	writeJSON(w, http.StatusOK, status)
+}
+
+// writeJSON writes v as the JSON response body
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,361 @@
+// Local dashboard for a speedtest node. Reads /status and the /api
+// endpoints served by the node itself and draws plain SVG charts, so it
+// works without internet access or any external assets.
+(function () {
+  "use strict";
+
+  var REFRESH_INTERVAL = 60 * 1000;
+  var SVG_NS = "http://www.w3.org/2000/svg";
+  var CHART = { width: 1000, height: 220, left: 48, right: 12, top: 12, bottom: 28 };
+
+  var hours = 24;
+
+  function $(id) {
+    return document.getElementById(id);
+  }
+
+  function getJSON(url) {
+    return fetch(url).then(function (res) {
+      if (!res.ok) {
+        throw new Error(url + " returned " + res.status);
+      }
+      return res.json();
+    });
+  }
+
+  function setText(id, text) {
+    $(id).textContent = text;
+  }
+
+  function mbps(bytesPerSecond) {
+    return (bytesPerSecond * 8) / 1e6;
+  }
+
+  function fixed(value, digits) {
+    return value === null || value === undefined ? "-" : Number(value).toFixed(digits);
+  }
+
+  function formatTime(value) {
+    return value ? new Date(value).toLocaleString() : "-";
+  }
+
+  function formatAgo(value) {
+    var seconds = Math.round((Date.now() - new Date(value).getTime()) / 1000);
+    var future = seconds < 0;
+    seconds = Math.abs(seconds);
+
+    var text;
+    if (seconds < 60) {
+      text = seconds + "s";
+    } else if (seconds < 3600) {
+      text = Math.round(seconds / 60) + "m";
+    } else if (seconds < 86400) {
+      text = Math.round(seconds / 3600) + "h";
+    } else {
+      text = Math.round(seconds / 86400) + "d";
+    }
+    return future ? "in " + text : text + " ago";
+  }
+
+  // Status: node identity, schedule, latest result and server connection
+
+  function renderStatus(status) {
+    setText("node-name", status.node_name || "Speedtest Node");
+    setText("node-version", status.version ? "v" + status.version : "");
+    document.title = (status.node_name || "Speedtest Node") + " - Speedtest";
+
+    if (status.last_test) {
+      setText("last-test", status.last_test.success ? "Succeeded" : "Failed");
+      setText("last-test-detail", formatAgo(status.last_test.timestamp) +
+        (status.last_test.error ? " - " + status.last_test.error : ""));
+    } else {
+      setText("last-test", "None yet");
+      setText("last-test-detail", "");
+    }
+
+    if (status.next_run) {
+      setText("next-run", new Date(status.next_run).toLocaleTimeString());
+      setText("next-run-detail", formatAgo(status.next_run));
+    } else {
+      setText("next-run", "-");
+      setText("next-run-detail", "");
+    }
+
+    var result = status.last_result;
+    if (result) {
+      setText("last-result",
+        fixed(result.download ? mbps(result.download.bandwidth) : null, 1) + " / " +
+        fixed(result.upload ? mbps(result.upload.bandwidth) : null, 1) + " Mbit/s");
+      setText("last-result-detail", "Ping " + fixed(result.ping ? result.ping.latency : null, 1) +
+        " ms, " + formatTime(result.timestamp));
+    } else {
+      setText("last-result", "-");
+      setText("last-result-detail", "");
+    }
+
+    var server = status.server || {};
+    var badge = $("server-state");
+    badge.className = "badge " + (server.health || "");
+    if (server.health === "offline") {
+      badge.textContent = "Offline mode";
+      setText("server", "Not configured");
+      setText("server-detail", "Results are kept on this node only");
+    } else {
+      badge.textContent = server.health === "ok" ? "Connected" : "Server unreachable";
+      var backlog = status.backlog || {};
+      setText("server", (backlog.unsent_measurements || 0) + " unsent");
+      setText("server-detail", server.health === "ok"
+        ? "via " + (server.transport || "http")
+        : (server.last_error || "") + " (" + server.consecutive_failures + " failures)");
+    }
+  }
+
+  // Summary cards and charts from the aggregates
+
+  function renderAggregates(data) {
+    var summary = data.summary;
+    var attempts = summary.tests + summary.failures;
+
+    setText("summary-tests", String(summary.tests));
+    setText("summary-success", attempts > 0
+      ? summary.failures + " failed, " + ((summary.tests / attempts) * 100).toFixed(1) + "% success"
+      : "No tests in this range");
+    setText("summary-download", fixed(summary.avg_download_mbps, 1) + " Mbit/s");
+    setText("summary-download-range", summary.tests > 0
+      ? "min " + fixed(summary.min_download_mbps, 1) + ", max " + fixed(summary.max_download_mbps, 1)
+      : "");
+    setText("summary-upload", fixed(summary.avg_upload_mbps, 1) + " Mbit/s");
+    setText("summary-upload-range", summary.tests > 0
+      ? "min " + fixed(summary.min_upload_mbps, 1) + ", max " + fixed(summary.max_upload_mbps, 1)
+      : "");
+    setText("summary-ping", fixed(summary.avg_ping_ms, 1) + " ms");
+    setText("summary-jitter", "jitter " + fixed(summary.avg_jitter_ms, 1) + " ms, loss " +
+      fixed(summary.avg_packet_loss, 2) + "%");
+
+    lineChart($("chart-speed"), data.buckets, data.interval, [
+      { key: "avg_download_mbps", label: "Download", color: "var(--download)" },
+      { key: "avg_upload_mbps", label: "Upload", color: "var(--upload)" }
+    ]);
+    lineChart($("chart-latency"), data.buckets, data.interval, [
+      { key: "avg_ping_ms", label: "Ping", color: "var(--ping)" },
+      { key: "avg_jitter_ms", label: "Jitter", color: "var(--jitter)" }
+    ]);
+    barChart($("chart-tests"), data.buckets, data.interval, [
+      { key: "tests", label: "Successful", color: "var(--download)" },
+      { key: "failures", label: "Failed", color: "var(--failure)" }
+    ]);
+  }
+
+  function svgElement(name, attrs) {
+    var el = document.createElementNS(SVG_NS, name);
+    Object.keys(attrs).forEach(function (key) {
+      el.setAttribute(key, attrs[key]);
+    });
+    return el;
+  }
+
+  // chartFrame draws the axes and labels shared by both chart types and
+  // returns the svg with functions that map values to coordinates
+  function chartFrame(buckets, interval, maxValue) {
+    var svg = svgElement("svg", {
+      viewBox: "0 0 " + CHART.width + " " + CHART.height,
+      preserveAspectRatio: "none"
+    });
+    var plotWidth = CHART.width - CHART.left - CHART.right;
+    var plotHeight = CHART.height - CHART.top - CHART.bottom;
+    var max = maxValue > 0 ? maxValue * 1.1 : 1;
+    var step = plotWidth / Math.max(buckets.length, 1);
+
+    var frame = {
+      svg: svg,
+      step: step,
+      x: function (i) { return CHART.left + step * i + step / 2; },
+      y: function (v) { return CHART.top + plotHeight - (v / max) * plotHeight; }
+    };
+
+    [0, 0.5, 1].forEach(function (fraction) {
+      var y = CHART.top + plotHeight - fraction * plotHeight;
+      svg.appendChild(svgElement("line", {
+        class: "axis", x1: CHART.left, x2: CHART.width - CHART.right, y1: y, y2: y
+      }));
+      var label = svgElement("text", { class: "label", x: CHART.left - 6, y: y + 4, "text-anchor": "end" });
+      label.textContent = fixed(max * fraction, max * fraction >= 10 ? 0 : 1);
+      svg.appendChild(label);
+    });
+
+    var labelEvery = Math.max(1, Math.ceil(buckets.length / 8));
+    buckets.forEach(function (bucket, i) {
+      if (i % labelEvery !== 0) {
+        return;
+      }
+      var date = new Date(bucket.start);
+      var label = svgElement("text", {
+        class: "label", x: frame.x(i), y: CHART.height - 8, "text-anchor": "middle"
+      });
+      label.textContent = interval === "day"
+        ? date.toLocaleDateString(undefined, { month: "short", day: "numeric" })
+        : date.toLocaleTimeString(undefined, { hour: "2-digit", minute: "2-digit" });
+      svg.appendChild(label);
+    });
+
+    return frame;
+  }
+
+  function legend(series) {
+    var el = document.createElement("div");
+    el.className = "legend";
+    series.forEach(function (s) {
+      var item = document.createElement("span");
+      item.style.color = s.color;
+      item.textContent = s.label;
+      el.appendChild(item);
+    });
+    return el;
+  }
+
+  // lineChart plots one line per series, leaving gaps for intervals
+  // without successful tests
+  function lineChart(container, buckets, interval, series) {
+    var maxValue = 0;
+    buckets.forEach(function (b) {
+      series.forEach(function (s) {
+        if (b.tests > 0) {
+          maxValue = Math.max(maxValue, b[s.key]);
+        }
+      });
+    });
+
+    var frame = chartFrame(buckets, interval, maxValue);
+    series.forEach(function (s) {
+      var path = "";
+      var drawing = false;
+      buckets.forEach(function (b, i) {
+        if (b.tests === 0) {
+          drawing = false;
+          return;
+        }
+        path += (drawing ? "L" : "M") + frame.x(i).toFixed(1) + " " + frame.y(b[s.key]).toFixed(1);
+        drawing = true;
+      });
+      frame.svg.appendChild(svgElement("path", { class: "line", d: path, stroke: s.color }));
+
+      // Isolated points would not show up as a line
+      buckets.forEach(function (b, i) {
+        var prev = buckets[i - 1];
+        var next = buckets[i + 1];
+        if (b.tests > 0 && (!prev || prev.tests === 0) && (!next || next.tests === 0)) {
+          frame.svg.appendChild(svgElement("circle", {
+            cx: frame.x(i), cy: frame.y(b[s.key]), r: 3, fill: s.color
+          }));
+        }
+      });
+    });
+
+    container.replaceChildren(frame.svg, legend(series));
+  }
+
+  // barChart stacks the series for each interval
+  function barChart(container, buckets, interval, series) {
+    var maxValue = 0;
+    buckets.forEach(function (b) {
+      var total = 0;
+      series.forEach(function (s) { total += b[s.key]; });
+      maxValue = Math.max(maxValue, total);
+    });
+
+    var frame = chartFrame(buckets, interval, maxValue);
+    var width = Math.max(frame.step * 0.7, 1);
+    buckets.forEach(function (b, i) {
+      var base = 0;
+      series.forEach(function (s) {
+        if (b[s.key] === 0) {
+          return;
+        }
+        var top = frame.y(base + b[s.key]);
+        frame.svg.appendChild(svgElement("rect", {
+          x: frame.x(i) - width / 2,
+          y: top,
+          width: width,
+          height: frame.y(base) - top,
+          fill: s.color
+        }));
+        base += b[s.key];
+      });
+    });
+
+    container.replaceChildren(frame.svg, legend(series));
+  }
+
+  // Tables
+
+  function row(cells, className) {
+    var tr = document.createElement("tr");
+    cells.forEach(function (text) {
+      var td = document.createElement("td");
+      td.textContent = text;
+      if (className) {
+        td.className = className;
+      }
+      tr.appendChild(td);
+    });
+    return tr;
+  }
+
+  function emptyRow(columns, text) {
+    var tr = document.createElement("tr");
+    var td = document.createElement("td");
+    td.colSpan = columns;
+    td.className = "empty";
+    td.textContent = text;
+    tr.appendChild(td);
+    return tr;
+  }
+
+  function renderMeasurements(data) {
+    var rows = data.measurements.map(function (m) {
+      return row([
+        formatTime(m.timestamp),
+        fixed(m.download ? mbps(m.download.bandwidth) : null, 1) + " Mbit/s",
+        fixed(m.upload ? mbps(m.upload.bandwidth) : null, 1) + " Mbit/s",
+        fixed(m.ping ? m.ping.latency : null, 1) + " ms",
+        fixed(m.ping ? m.ping.jitter : null, 1) + " ms",
+        fixed(m.packet_loss, 2) + "%",
+        m.server ? m.server.name + (m.server.location ? ", " + m.server.location : "") : "-",
+        m.isp || "-"
+      ]);
+    });
+    $("measurements").replaceChildren.apply($("measurements"),
+      rows.length > 0 ? rows : [emptyRow(8, "No measurements in this range")]);
+  }
+
+  function renderFailures(data) {
+    var rows = data.failures.map(function (f) {
+      var tr = row([formatTime(f.timestamp), f.error_message, String(f.retry_count)]);
+      tr.children[1].className = "error";
+      return tr;
+    });
+    $("failures").replaceChildren.apply($("failures"),
+      rows.length > 0 ? rows : [emptyRow(3, "No failures in this range")]);
+  }
+
+  function refresh() {
+    var range = "?hours=" + hours;
+    getJSON("/status").then(renderStatus).catch(console.error);
+    getJSON("/api/aggregates" + range).then(renderAggregates).catch(console.error);
+    getJSON("/api/measurements" + range + "&limit=25").then(renderMeasurements).catch(console.error);
+    getJSON("/api/failures" + range + "&limit=25").then(renderFailures).catch(console.error);
+  }
+
+  document.querySelectorAll("#ranges button").forEach(function (button) {
+    button.addEventListener("click", function () {
+      document.querySelectorAll("#ranges button").forEach(function (b) {
+        b.classList.toggle("active", b === button);
+      });
+      hours = Number(button.dataset.hours);
+      refresh();
+    });
+  });
+
+  refresh();
+  setInterval(refresh, REFRESH_INTERVAL);
+})();
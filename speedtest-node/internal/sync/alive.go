@@ -1,27 +1,47 @@
 package sync
 
 import (
-	"encoding/json"
-	"fmt"
 	"mark7888/speedtest-node/pkg/models"
+	gosync "sync"
 	"time"
 
 	"go.uber.org/zap"
 )
 
+// clockSkewWarning is how far the node's clock may be off from the server's
+// before the node warns about it
+const clockSkewWarning = time.Minute
+
+// QueuedCommandHandler runs a command the server queued for this node
+type QueuedCommandHandler func(command models.PendingCommand)
+
+// ConfigHandler applies server-managed settings; settings is nil when the
+// server no longer manages any and the node's own config should be restored
+type ConfigHandler func(version string, settings *models.NodeSettings) error
+
+// InventoryProvider describes the node for the server; it is called for every alive
+type InventoryProvider func() *models.NodeInventory
+
 // AliveSender handles sending alive/keepalive signals to the server
 type AliveSender struct {
-	client       *Client
-	nodeID       string
-	nodeName     string
-	nodeLocation string
-	logger       *zap.Logger
+	transport      Transport
+	nodeID         string
+	nodeName       string
+	nodeLocation   string
+	commandHandler QueuedCommandHandler
+	configHandler  ConfigHandler
+	configMu       gosync.Mutex
+	configVersion  string
+	inventory      InventoryProvider
+	clockMu        gosync.Mutex
+	clockOffset    *time.Duration // server - node, nil until estimated
+	logger         *zap.Logger
 }
 
 // NewAliveSender creates a new alive sender
-func NewAliveSender(client *Client, nodeID, nodeName, nodeLocation string, logger *zap.Logger) *AliveSender {
+func NewAliveSender(transport Transport, nodeID, nodeName, nodeLocation string, logger *zap.Logger) *AliveSender {
 	return &AliveSender{
-		client:       client,
+		transport:    transport,
 		nodeID:       nodeID,
 		nodeName:     nodeName,
 		nodeLocation: nodeLocation,
@@ -29,29 +49,190 @@ func NewAliveSender(client *Client, nodeID, nodeName, nodeLocation string, logge
 	}
 }
 
-// SendAlive sends an alive signal to the server
-func (a *AliveSender) SendAlive() error {
+// NewRequest builds an alive request for this node
+func (a *AliveSender) NewRequest() *models.AliveRequest {
 	request := &models.AliveRequest{
-		NodeID:    a.nodeID,
-		NodeName:  a.nodeName,
-		Timestamp: time.Now().UTC(),
+		NodeID:   a.nodeID,
+		NodeName: a.nodeName,
 	}
 
+	version := a.ConfigVersion()
+	request.ConfigVersion = &version
+
 	if a.nodeLocation != "" {
 		request.Location = &a.nodeLocation
 	}
 
-	respData, err := a.client.Post("/api/v1/node/alive", request)
-	if err != nil {
-		return err
+	if a.inventory != nil {
+		request.Inventory = a.inventory()
 	}
 
-	var response models.AliveResponse
-	if err := json.Unmarshal(respData, &response); err != nil {
-		return fmt.Errorf("failed to parse response: %w", err)
+	if offset, ok := a.ClockOffset(); ok {
+		offsetMs := offset.Milliseconds()
+		request.ClockOffsetMs = &offsetMs
+	}
+
+	// Taken last so the clock offset estimate covers as little as possible
+	// besides the round-trip itself
+	request.Timestamp = time.Now().UTC()
+
+	return request
+}
+
+// SendAlive sends an alive signal to the server
+func (a *AliveSender) SendAlive() error {
+	response, err := a.transport.SendAlive(a.NewRequest())
+	if err != nil {
+		return err
 	}
 
 	a.logger.Debug("Alive signal sent successfully", zap.String("status", response.Status))
 
+	a.estimateClockOffset(response)
+	a.dispatchConfig(response)
+	a.dispatchCommands(response.Commands)
+
 	return nil
 }
+
+// OnCommand sets the handler for commands delivered in alive responses.
+// It must be called before the first alive is sent.
+func (a *AliveSender) OnCommand(handler QueuedCommandHandler) {
+	a.commandHandler = handler
+}
+
+// HandleResponse applies an alive response received outside of the transport,
+// e.g. a heartbeat acknowledgement on the control channel
+func (a *AliveSender) HandleResponse(response *models.AliveResponse) {
+	if handler, ok := a.transport.(AliveResponseHandler); ok {
+		handler.HandleAliveResponse(response)
+	}
+
+	a.estimateClockOffset(response)
+	a.dispatchConfig(response)
+	a.dispatchCommands(response.Commands)
+}
+
+// OnConfig sets the handler for server-managed settings.
+// It must be called before the first alive is sent.
+func (a *AliveSender) OnConfig(handler ConfigHandler) {
+	a.configHandler = handler
+}
+
+// SetInventoryProvider sets where alive requests get the node inventory from.
+// It must be called before the first alive is sent.
+func (a *AliveSender) SetInventoryProvider(provider InventoryProvider) {
+	a.inventory = provider
+}
+
+// ConfigVersion returns the version of the server-managed settings in effect
+func (a *AliveSender) ConfigVersion() string {
+	a.configMu.Lock()
+	defer a.configMu.Unlock()
+	return a.configVersion
+}
+
+// SetConfigVersion records the version of the server-managed settings in effect
+func (a *AliveSender) SetConfigVersion(version string) {
+	a.configMu.Lock()
+	defer a.configMu.Unlock()
+	a.configVersion = version
+}
+
+// ClockOffset returns how far the server's clock is ahead of the node's,
+// and false if it has not been estimated yet
+func (a *AliveSender) ClockOffset() (time.Duration, bool) {
+	a.clockMu.Lock()
+	defer a.clockMu.Unlock()
+	if a.clockOffset == nil {
+		return 0, false
+	}
+	return *a.clockOffset, true
+}
+
+// estimateClockOffset estimates the clock offset from an alive round-trip the
+// way NTP does, assuming the network delay is the same in both directions
+func (a *AliveSender) estimateClockOffset(response *models.AliveResponse) {
+	// Transports without a real response (MQTT) and older servers leave these unset
+	if response.RequestTime.IsZero() || response.ReceiveTime.IsZero() || response.ServerTime.IsZero() {
+		return
+	}
+
+	offset, roundTrip, ok := roundTripOffset(response.RequestTime, response.ReceiveTime, response.ServerTime, time.Now())
+	if !ok {
+		return
+	}
+
+	a.clockMu.Lock()
+	defer a.clockMu.Unlock()
+
+	wasSkewed := a.clockOffset != nil && a.clockOffset.Abs() > clockSkewWarning
+	isSkewed := offset.Abs() > clockSkewWarning
+	a.clockOffset = &offset
+
+	if isSkewed && !wasSkewed {
+		a.logger.Warn("Node clock differs from server time",
+			zap.Duration("offset", offset),
+			zap.Duration("round_trip", roundTrip),
+		)
+	} else if !isSkewed && wasSkewed {
+		a.logger.Info("Node clock is back in line with server time", zap.Duration("offset", offset))
+	}
+}
+
+// roundTripOffset computes the clock offset (server - node) and network
+// round-trip from the four timestamps of an exchange: sent and received on
+// the node's clock, serverReceived and serverSent on the server's. ok is
+// false when the round-trip comes out negative, which means the node's clock
+// was stepped in between.
+func roundTripOffset(sent, serverReceived, serverSent, received time.Time) (offset, roundTrip time.Duration, ok bool) {
+	roundTrip = received.Sub(sent) - serverSent.Sub(serverReceived)
+	if roundTrip < 0 {
+		return 0, roundTrip, false
+	}
+	return (serverReceived.Sub(sent) + serverSent.Sub(received)) / 2, roundTrip, true
+}
+
+// dispatchConfig hands changed settings to the config handler
+func (a *AliveSender) dispatchConfig(response *models.AliveResponse) {
+	// Transports without a real response (MQTT) leave the version unset
+	if a.configHandler == nil || response.ConfigVersion == nil {
+		return
+	}
+
+	a.configMu.Lock()
+	defer a.configMu.Unlock()
+
+	version := *response.ConfigVersion
+	if version == a.configVersion {
+		return
+	}
+	if version != "" && response.Config == nil {
+		return
+	}
+
+	if err := a.configHandler(version, response.Config); err != nil {
+		a.logger.Warn("Failed to apply server config",
+			zap.String("config_version", version),
+			zap.Error(err),
+		)
+		return
+	}
+	a.configVersion = version
+}
+
+// dispatchCommands hands queued commands to the command handler
+func (a *AliveSender) dispatchCommands(commands []models.PendingCommand) {
+	for _, command := range commands {
+		a.logger.Info("Received queued command",
+			zap.String("command_id", command.ID),
+			zap.String("command", command.Command),
+		)
+
+		if a.commandHandler == nil {
+			a.logger.Warn("No handler for queued command, ignoring", zap.String("command_id", command.ID))
+			continue
+		}
+		a.commandHandler(command)
+	}
+}
@@ -0,0 +1,114 @@
+package sync
+
+import (
+	"errors"
+	"mark7888/speedtest-node/pkg/models"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestRoundTripOffset(t *testing.T) {
+	base := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	ms := func(n int) time.Time { return base.Add(time.Duration(n) * time.Millisecond) }
+
+	tests := []struct {
+		name                                       string
+		sent, serverReceived, serverSent, received time.Time
+		wantOffset, wantRoundTrip                  time.Duration
+		wantOK                                     bool
+	}{
+		{
+			name: "clocks in sync",
+			sent: ms(0), serverReceived: ms(50), serverSent: ms(60), received: ms(110),
+			wantOffset: 0, wantRoundTrip: 100 * time.Millisecond, wantOK: true,
+		},
+		{
+			name: "server ahead",
+			sent: ms(0), serverReceived: ms(2050), serverSent: ms(2060), received: ms(110),
+			wantOffset: 2 * time.Second, wantRoundTrip: 100 * time.Millisecond, wantOK: true,
+		},
+		{
+			name: "server behind",
+			sent: ms(0), serverReceived: ms(-950), serverSent: ms(-940), received: ms(110),
+			wantOffset: -time.Second, wantRoundTrip: 100 * time.Millisecond, wantOK: true,
+		},
+		{
+			name: "asymmetric delay splits the difference",
+			sent: ms(0), serverReceived: ms(90), serverSent: ms(90), received: ms(100),
+			wantOffset: 40 * time.Millisecond, wantRoundTrip: 100 * time.Millisecond, wantOK: true,
+		},
+		{
+			name: "node clock stepped back during the exchange",
+			sent: ms(0), serverReceived: ms(50), serverSent: ms(60), received: ms(-5000),
+			wantOK: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			offset, roundTrip, ok := roundTripOffset(tt.sent, tt.serverReceived, tt.serverSent, tt.received)
+			if ok != tt.wantOK {
+				t.Fatalf("ok = %v, want %v", ok, tt.wantOK)
+			}
+			if !ok {
+				return
+			}
+			if offset != tt.wantOffset {
+				t.Errorf("offset = %v, want %v", offset, tt.wantOffset)
+			}
+			if roundTrip != tt.wantRoundTrip {
+				t.Errorf("round trip = %v, want %v", roundTrip, tt.wantRoundTrip)
+			}
+		})
+	}
+}
+
+func TestDispatchConfig(t *testing.T) {
+	cron := "*/5 * * * *"
+	settings := &models.NodeSettings{SpeedtestCron: &cron}
+	version := func(v string) *string { return &v }
+
+	tests := []struct {
+		name        string
+		current     string
+		respVersion *string
+		respConfig  *models.NodeSettings
+		handlerErr  error
+		wantCalled  bool
+		wantVersion string
+	}{
+		{name: "transport without version", current: "aaa", wantVersion: "aaa"},
+		{name: "already up to date", current: "aaa", respVersion: version("aaa"), respConfig: settings, wantVersion: "aaa"},
+		{name: "new version applied", current: "aaa", respVersion: version("bbb"), respConfig: settings, wantCalled: true, wantVersion: "bbb"},
+		{name: "new version without settings", current: "aaa", respVersion: version("bbb"), wantVersion: "aaa"},
+		{name: "server settings removed", current: "aaa", respVersion: version(""), wantCalled: true, wantVersion: ""},
+		{name: "failed apply keeps old version", current: "aaa", respVersion: version("bbb"), respConfig: settings, handlerErr: errors.New("bad cron"), wantCalled: true, wantVersion: "aaa"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sender := NewAliveSender(nil, "node", "node", "", zap.NewNop())
+			sender.SetConfigVersion(tt.current)
+
+			called := false
+			sender.OnConfig(func(version string, got *models.NodeSettings) error {
+				called = true
+				if version != *tt.respVersion || got != tt.respConfig {
+					t.Errorf("handler got version %q and %v", version, got)
+				}
+				return tt.handlerErr
+			})
+
+			sender.dispatchConfig(&models.AliveResponse{ConfigVersion: tt.respVersion, Config: tt.respConfig})
+
+			if called != tt.wantCalled {
+				t.Errorf("handler called = %v, want %v", called, tt.wantCalled)
+			}
+			if v := sender.ConfigVersion(); v != tt.wantVersion {
+				t.Errorf("version = %q, want %q", v, tt.wantVersion)
+			}
+		})
+	}
+}
@@ -2,39 +2,64 @@ package sync
 
 import (
 	"bytes"
+	"compress/gzip"
+	"context"
 	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	gosync "sync"
 	"time"
 
+	"mark7888/speedtest-node/internal/tracing"
+
+	"github.com/google/uuid"
+	"github.com/klauspost/compress/zstd"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
 
+// requestIDHeader carries the ID the server logs the request under
+const requestIDHeader = "X-Request-ID"
+
+// minCompressSize is the smallest payload worth compressing; below this the
+// encoding overhead outweighs the savings
+const minCompressSize = 512
+
 // Client handles HTTP communication with the data server
 type Client struct {
-	serverURL string
-	apiKey    string
-	timeout   time.Duration
-	tlsVerify bool
-	client    *http.Client
-	logger    *zap.Logger
+	serverURL   string
+	apiKey      string
+	timeout     time.Duration
+	compression string // auto, zstd, gzip or none
+	client      *http.Client
+	logger      *zap.Logger
+
+	// signer signs requests instead of sending the API key, when set
+	signer *RequestSigner
+
+	// encoding is the negotiated request Content-Encoding, empty for none
+	encodingMu gosync.RWMutex
+	encoding   string
 }
 
-// NewClient creates a new sync client
-func NewClient(serverURL, apiKey string, timeout time.Duration, tlsVerify bool, logger *zap.Logger) *Client {
+// NewClient creates a new sync client. tlsConfig comes from NewTLSConfig;
+// apiKey may be empty when the node authenticates with a client certificate.
+func NewClient(serverURL, apiKey string, timeout time.Duration, tlsConfig *tls.Config, compression string, logger *zap.Logger) *Client {
 	transport := &http.Transport{
-		TLSClientConfig: &tls.Config{
-			InsecureSkipVerify: !tlsVerify,
-		},
+		TLSClientConfig: tlsConfig,
 	}
 
 	return &Client{
-		serverURL: serverURL,
-		apiKey:    apiKey,
-		timeout:   timeout,
-		tlsVerify: tlsVerify,
+		serverURL:   serverURL,
+		apiKey:      apiKey,
+		timeout:     timeout,
+		compression: compression,
 		client: &http.Client{
 			Timeout:   timeout,
 			Transport: transport,
@@ -43,42 +68,173 @@ func NewClient(serverURL, apiKey string, timeout time.Duration, tlsVerify bool,
 	}
 }
 
-// Post sends a POST request to the given endpoint
-func (c *Client) Post(endpoint string, payload interface{}) ([]byte, error) {
+// SignRequests makes the client sign its requests with signer instead of
+// sending the API key. Call it before the client is used.
+func (c *Client) SignRequests(signer *RequestSigner) {
+	c.signer = signer
+}
+
+// NegotiateEncoding picks the request encoding to use based on the encodings
+// the server advertised in its alive response and the configured preference
+func (c *Client) NegotiateEncoding(serverEncodings []string) {
+	supported := make(map[string]bool, len(serverEncodings))
+	for _, enc := range serverEncodings {
+		supported[enc] = true
+	}
+
+	var candidates []string
+	switch c.compression {
+	case "none", "":
+		candidates = nil
+	case "auto":
+		candidates = []string{"zstd", "gzip"}
+	default:
+		candidates = []string{c.compression}
+	}
+
+	selected := ""
+	for _, enc := range candidates {
+		if supported[enc] {
+			selected = enc
+			break
+		}
+	}
+
+	c.encodingMu.Lock()
+	previous := c.encoding
+	c.encoding = selected
+	c.encodingMu.Unlock()
+
+	if selected != previous {
+		c.logger.Info("Request compression negotiated",
+			zap.String("encoding", selected),
+			zap.Strings("server_encodings", serverEncodings),
+		)
+	}
+}
+
+// Post sends a POST request to the given endpoint. The request carries the
+// trace context of ctx so the server continues the same trace, and a request
+// ID that errors mention so failures can be found in the server logs.
+func (c *Client) Post(ctx context.Context, endpoint string, payload interface{}) (body []byte, err error) {
+	url := c.serverURL + endpoint
+	requestID := uuid.New().String()
+	ctx, span := tracing.Start(ctx, "POST",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("http.request.method", "POST"),
+			attribute.String("url.full", url),
+			attribute.String("request.id", requestID),
+		),
+	)
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
 	// Marshal payload to JSON
 	data, err := json.Marshal(payload)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal payload: %w", err)
 	}
 
+	// Compress the body if the server supports it
+	c.encodingMu.RLock()
+	encoding := c.encoding
+	c.encodingMu.RUnlock()
+
+	if encoding != "" && len(data) >= minCompressSize {
+		compressed, err := compress(encoding, data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compress payload: %w", err)
+		}
+		c.logger.Debug("Compressed request payload",
+			zap.String("encoding", encoding),
+			zap.Int("original_bytes", len(data)),
+			zap.Int("compressed_bytes", len(compressed)),
+		)
+		data = compressed
+	} else {
+		encoding = ""
+	}
+
 	// Create request
-	url := c.serverURL + endpoint
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(data))
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(data))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	// Set headers
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	switch {
+	case c.signer != nil:
+		if err := c.signer.Sign(req.Header, req.Method, req.URL.RequestURI(), data); err != nil {
+			return nil, fmt.Errorf("failed to sign request: %w", err)
+		}
+	case c.apiKey != "":
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+	req.Header.Set(requestIDHeader, requestID)
+	if encoding != "" {
+		req.Header.Set("Content-Encoding", encoding)
+	}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
 
 	// Send request
 	resp, err := c.client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("request failed: %w", err)
+		return nil, fmt.Errorf("request %s failed: %w", requestID, err)
 	}
 	defer resp.Body.Close()
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
 
 	// Read response body
-	body, err := io.ReadAll(resp.Body)
+	body, err = io.ReadAll(resp.Body)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read response: %w", err)
 	}
 
 	// Check status code
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return nil, fmt.Errorf("server returned status %d: %s", resp.StatusCode, string(body))
+		return nil, fmt.Errorf("server returned status %d for request %s: %s", resp.StatusCode, requestID, string(body))
 	}
 
 	return body, nil
 }
+
+// compress encodes data with the given content encoding
+func compress(encoding string, data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+
+	switch encoding {
+	case "gzip":
+		w, err := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+	case "zstd":
+		w, err := zstd.NewWriter(&buf, zstd.WithEncoderLevel(zstd.SpeedBetterCompression))
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported encoding %q", encoding)
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,312 @@
+package sync
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"mark7888/speedtest-node/pkg/models"
+	"net/http"
+	"net/url"
+	"strings"
+	gosync "sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+)
+
+const (
+	// controlWriteTimeout bounds a single write on the control channel
+	controlWriteTimeout = 10 * time.Second
+
+	// controlMaxBackoff caps the delay between reconnect attempts
+	controlMaxBackoff = time.Minute
+)
+
+// CommandHandler executes a server command and returns its output
+type CommandHandler func(args json.RawMessage) (interface{}, error)
+
+// ControlChannel keeps a long-lived WebSocket to the data server. It carries
+// the node's heartbeats (replacing /node/alive polling while connected) and
+// lets the server push commands to the node.
+type ControlChannel struct {
+	url         string
+	apiKey      string
+	signer      *RequestSigner // signs the handshake instead of sending apiKey, when set
+	dialer      *websocket.Dialer
+	aliveSender *AliveSender
+	interval    time.Duration
+	logger      *zap.Logger
+
+	handlersMu gosync.RWMutex
+	handlers   map[string]CommandHandler
+
+	connected atomic.Bool
+	stopChan  chan struct{}
+	wg        gosync.WaitGroup
+
+	// writeMu serializes writes; gorilla/websocket allows one writer at a time
+	writeMu gosync.Mutex
+}
+
+// NewControlChannel creates a new control channel client.
+// Heartbeats are sent every interval using the alive sender's node details.
+// apiKey may be empty when tlsConfig carries a client certificate.
+func NewControlChannel(serverURL, apiKey string, tlsConfig *tls.Config, interval time.Duration, aliveSender *AliveSender, logger *zap.Logger) (*ControlChannel, error) {
+	var wsURL string
+	switch {
+	case strings.HasPrefix(serverURL, "https://"):
+		wsURL = "wss://" + strings.TrimPrefix(serverURL, "https://")
+	case strings.HasPrefix(serverURL, "http://"):
+		wsURL = "ws://" + strings.TrimPrefix(serverURL, "http://")
+	default:
+		return nil, fmt.Errorf("server URL must start with http:// or https://")
+	}
+
+	cc := &ControlChannel{
+		url:    strings.TrimRight(wsURL, "/") + "/api/v1/node/ws",
+		apiKey: apiKey,
+		dialer: &websocket.Dialer{
+			HandshakeTimeout: 10 * time.Second,
+			TLSClientConfig:  tlsConfig,
+		},
+		aliveSender: aliveSender,
+		interval:    interval,
+		logger:      logger,
+		handlers:    make(map[string]CommandHandler),
+		stopChan:    make(chan struct{}),
+	}
+
+	// Built-in connectivity check
+	cc.Handle("ping", func(json.RawMessage) (interface{}, error) {
+		return map[string]interface{}{"pong": time.Now().UTC()}, nil
+	})
+
+	return cc, nil
+}
+
+// SignRequests makes the control channel sign its handshake with signer
+// instead of sending the API key. Call it before Start.
+func (cc *ControlChannel) SignRequests(signer *RequestSigner) {
+	cc.signer = signer
+}
+
+// Handle registers the handler for a command name
+func (cc *ControlChannel) Handle(name string, handler CommandHandler) {
+	cc.handlersMu.Lock()
+	defer cc.handlersMu.Unlock()
+	cc.handlers[name] = handler
+}
+
+// Connected reports whether the control channel is currently up
+func (cc *ControlChannel) Connected() bool {
+	return cc.connected.Load()
+}
+
+// Start connects in the background and keeps reconnecting until Stop
+func (cc *ControlChannel) Start() {
+	cc.logger.Info("Starting control channel", zap.String("url", cc.url))
+
+	cc.wg.Add(1)
+	go cc.run()
+}
+
+// Stop closes the control channel and waits for it to shut down
+func (cc *ControlChannel) Stop() {
+	cc.logger.Info("Stopping control channel")
+	close(cc.stopChan)
+	cc.wg.Wait()
+}
+
+// run is the reconnect loop
+func (cc *ControlChannel) run() {
+	defer cc.wg.Done()
+
+	backoff := time.Second
+	for {
+		connectedAt := time.Now()
+		err := cc.session()
+		cc.connected.Store(false)
+
+		select {
+		case <-cc.stopChan:
+			return
+		default:
+		}
+
+		// A session that stayed up for a while resets the backoff
+		if time.Since(connectedAt) > controlMaxBackoff {
+			backoff = time.Second
+		}
+
+		cc.logger.Warn("Control channel disconnected, reconnecting",
+			zap.Error(err),
+			zap.Duration("retry_in", backoff),
+		)
+
+		select {
+		case <-time.After(backoff):
+		case <-cc.stopChan:
+			return
+		}
+
+		backoff *= 2
+		if backoff > controlMaxBackoff {
+			backoff = controlMaxBackoff
+		}
+	}
+}
+
+// session runs a single connection until it fails or Stop is called
+func (cc *ControlChannel) session() error {
+	header := http.Header{}
+	switch {
+	case cc.signer != nil:
+		u, err := url.Parse(cc.url)
+		if err != nil {
+			return fmt.Errorf("invalid control channel URL: %w", err)
+		}
+		if err := cc.signer.Sign(header, http.MethodGet, u.RequestURI(), nil); err != nil {
+			return fmt.Errorf("failed to sign handshake: %w", err)
+		}
+	case cc.apiKey != "":
+		header.Set("Authorization", "Bearer "+cc.apiKey)
+	}
+
+	ws, resp, err := cc.dialer.Dial(cc.url, header)
+	if err != nil {
+		if resp != nil {
+			return fmt.Errorf("dial failed with status %d: %w", resp.StatusCode, err)
+		}
+		return fmt.Errorf("dial failed: %w", err)
+	}
+	defer ws.Close()
+
+	// Any message or ping from the server proves the connection is alive;
+	// the server acknowledges every heartbeat, so allow a few missed ones
+	readTimeout := 3 * cc.interval
+	ws.SetReadDeadline(time.Now().Add(readTimeout))
+	ws.SetPingHandler(func(data string) error {
+		ws.SetReadDeadline(time.Now().Add(readTimeout))
+		cc.writeMu.Lock()
+		defer cc.writeMu.Unlock()
+		return ws.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(controlWriteTimeout))
+	})
+
+	// The first heartbeat identifies the node to the server
+	if err := cc.sendHeartbeat(ws); err != nil {
+		return err
+	}
+
+	// Heartbeat loop; closing the socket on stop unblocks the reader below
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(cc.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := cc.sendHeartbeat(ws); err != nil {
+					cc.logger.Warn("Failed to send heartbeat", zap.Error(err))
+					ws.Close()
+					return
+				}
+			case <-cc.stopChan:
+				cc.writeMu.Lock()
+				ws.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseNormalClosure, "node shutting down"),
+					time.Now().Add(time.Second))
+				cc.writeMu.Unlock()
+				ws.Close()
+				return
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	for {
+		var msg models.ControlMessage
+		if err := ws.ReadJSON(&msg); err != nil {
+			return err
+		}
+		ws.SetReadDeadline(time.Now().Add(readTimeout))
+
+		switch msg.Type {
+		case models.ControlTypeAliveAck:
+			var response models.AliveResponse
+			if err := json.Unmarshal(msg.Payload, &response); err != nil {
+				cc.logger.Warn("Invalid heartbeat acknowledgement", zap.Error(err))
+				continue
+			}
+			if !cc.connected.Swap(true) {
+				cc.logger.Info("Control channel connected", zap.String("url", cc.url))
+			}
+			cc.aliveSender.HandleResponse(&response)
+			cc.logger.Debug("Heartbeat acknowledged", zap.String("status", response.Status))
+		case models.ControlTypeCommand:
+			var cmd models.Command
+			if err := json.Unmarshal(msg.Payload, &cmd); err != nil {
+				cc.logger.Warn("Invalid command", zap.Error(err))
+				continue
+			}
+			// Run commands concurrently so heartbeats keep flowing
+			go cc.execute(ws, &cmd)
+		case models.ControlTypeError:
+			cc.logger.Warn("Control channel error from server", zap.String("payload", string(msg.Payload)))
+		default:
+			cc.logger.Debug("Ignoring unknown control message", zap.String("type", msg.Type))
+		}
+	}
+}
+
+// execute runs a command and reports its result to the server
+func (cc *ControlChannel) execute(ws *websocket.Conn, cmd *models.Command) {
+	cc.logger.Info("Received command", zap.String("command", cmd.Name), zap.String("command_id", cmd.ID))
+
+	cc.handlersMu.RLock()
+	handler, ok := cc.handlers[cmd.Name]
+	cc.handlersMu.RUnlock()
+
+	result := &models.CommandResult{ID: cmd.ID, Status: "ok"}
+	if !ok {
+		result.Status = "error"
+		result.Error = fmt.Sprintf("unknown command %q", cmd.Name)
+	} else if output, err := handler(cmd.Args); err != nil {
+		result.Status = "error"
+		result.Error = err.Error()
+	} else if output != nil {
+		data, err := json.Marshal(output)
+		if err != nil {
+			result.Status = "error"
+			result.Error = fmt.Sprintf("failed to marshal output: %v", err)
+		} else {
+			result.Output = data
+		}
+	}
+
+	if err := cc.write(ws, models.ControlTypeCommandResult, result); err != nil {
+		cc.logger.Warn("Failed to send command result", zap.Error(err), zap.String("command_id", cmd.ID))
+	}
+}
+
+// sendHeartbeat sends an alive message on the control channel
+func (cc *ControlChannel) sendHeartbeat(ws *websocket.Conn) error {
+	return cc.write(ws, models.ControlTypeAlive, cc.aliveSender.NewRequest())
+}
+
+// write sends a typed message on the connection
+func (cc *ControlChannel) write(ws *websocket.Conn, msgType string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	cc.writeMu.Lock()
+	defer cc.writeMu.Unlock()
+
+	ws.SetWriteDeadline(time.Now().Add(controlWriteTimeout))
+	return ws.WriteJSON(models.ControlMessage{Type: msgType, Payload: data})
+}
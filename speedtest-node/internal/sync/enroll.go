@@ -0,0 +1,31 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"mark7888/speedtest-node/pkg/models"
+)
+
+// Enroll exchanges a one-time enrollment token for an API key bound to
+// nodeID. The client needs no API key of its own for this.
+func (c *Client) Enroll(ctx context.Context, token, nodeID, nodeName string) (*models.EnrollResponse, error) {
+	body, err := c.Post(ctx, "/api/v1/enroll", &models.EnrollRequest{
+		Token:    token,
+		NodeID:   nodeID,
+		NodeName: nodeName,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var response models.EnrollResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, fmt.Errorf("failed to parse enroll response: %w", err)
+	}
+	if response.Key == "" {
+		return nil, fmt.Errorf("server returned no API key")
+	}
+	return &response, nil
+}
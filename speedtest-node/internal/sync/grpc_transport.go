@@ -0,0 +1,348 @@
+package sync
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"mark7888/speedtest-node/pkg/models"
+	"mark7888/speedtest-node/pkg/speedtestpb"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// GRPCTransport sends data to the server's gRPC ingestion service
+type GRPCTransport struct {
+	conn    *grpc.ClientConn
+	client  speedtestpb.IngestServiceClient
+	timeout time.Duration
+	logger  *zap.Logger
+}
+
+// NewGRPCTransport creates a new gRPC transport.
+// useTLS selects a TLS connection with tlsConfig, which comes from
+// NewTLSConfig. Without an apiKey the node authenticates with the client
+// certificate in tlsConfig alone.
+// compression "none" disables message compression; any other value uses
+// gzip, the only codec gRPC servers are guaranteed to support.
+func NewGRPCTransport(addr, apiKey string, timeout time.Duration, useTLS bool, tlsConfig *tls.Config, compression string, logger *zap.Logger) (*GRPCTransport, error) {
+	transportCreds := insecure.NewCredentials()
+	if useTLS {
+		transportCreds = credentials.NewTLS(tlsConfig)
+	}
+
+	opts := []grpc.DialOption{
+		grpc.WithTransportCredentials(transportCreds),
+	}
+	if apiKey != "" {
+		opts = append(opts, grpc.WithPerRPCCredentials(apiKeyCredentials{apiKey: apiKey, requireTLS: useTLS}))
+	}
+	if compression != "none" {
+		opts = append(opts, grpc.WithDefaultCallOptions(grpc.UseCompressor(gzip.Name)))
+	}
+
+	// The connection is established lazily on the first call
+	conn, err := grpc.NewClient(addr, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create gRPC client: %w", err)
+	}
+
+	logger.Info("gRPC transport initialized",
+		zap.String("addr", addr),
+		zap.Bool("tls", useTLS),
+	)
+
+	return &GRPCTransport{
+		conn:    conn,
+		client:  speedtestpb.NewIngestServiceClient(conn),
+		timeout: timeout,
+		logger:  logger,
+	}, nil
+}
+
+// SendAlive sends an alive signal
+func (t *GRPCTransport) SendAlive(req *models.AliveRequest) (*models.AliveResponse, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), t.timeout)
+	defer cancel()
+
+	resp, err := t.client.Alive(ctx, &speedtestpb.AliveRequest{
+		NodeId:        req.NodeID,
+		NodeName:      req.NodeName,
+		Location:      req.Location,
+		Timestamp:     timestamppb.New(req.Timestamp),
+		ConfigVersion: req.ConfigVersion,
+		Inventory:     inventoryToProto(req.Inventory),
+		ClockOffsetMs: req.ClockOffsetMs,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+
+	response := &models.AliveResponse{
+		Status:        resp.GetStatus(),
+		ServerTime:    resp.GetServerTime().AsTime(),
+		RequestTime:   timeFromProto(resp.GetRequestTime()),
+		ReceiveTime:   timeFromProto(resp.GetReceiveTime()),
+		ConfigVersion: resp.ConfigVersion,
+	}
+	if config := resp.GetConfig(); config != nil {
+		response.Config = nodeSettingsFromProto(config)
+	}
+	for _, command := range resp.GetCommands() {
+		response.Commands = append(response.Commands, models.PendingCommand{
+			ID:      command.GetId(),
+			Command: command.GetCommand(),
+		})
+	}
+
+	return response, nil
+}
+
+// SendMeasurements sends a batch of measurements
+func (t *GRPCTransport) SendMeasurements(req *models.MeasurementsRequest) (*models.MeasurementsResponse, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), t.timeout)
+	defer cancel()
+
+	measurements := make([]*speedtestpb.Measurement, 0, len(req.Measurements))
+	for _, m := range req.Measurements {
+		measurements = append(measurements, measurementToProto(m))
+	}
+
+	resp, err := t.client.SubmitMeasurements(ctx, &speedtestpb.SubmitMeasurementsRequest{
+		NodeId:       req.NodeID,
+		NodeName:     req.NodeName,
+		Measurements: measurements,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+
+	return &models.MeasurementsResponse{
+		Status:      resp.GetStatus(),
+		Received:    int(resp.GetReceived()),
+		Failed:      int(resp.GetFailed()),
+		Rejected:    int(resp.GetRejected()),
+		Quarantined: int(resp.GetQuarantined()),
+		Deferred:    resp.GetDeferred(),
+	}, nil
+}
+
+// SendFailedMeasurements sends a batch of failed measurements
+func (t *GRPCTransport) SendFailedMeasurements(req *models.FailedMeasurementsRequest) (*models.FailedMeasurementsResponse, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), t.timeout)
+	defer cancel()
+
+	failedTests := make([]*speedtestpb.FailedTest, 0, len(req.FailedTests))
+	for _, f := range req.FailedTests {
+		failedTests = append(failedTests, &speedtestpb.FailedTest{
+			Timestamp:    timestamppb.New(f.Timestamp),
+			ErrorMessage: f.ErrorMessage,
+			RetryCount:   int32(f.RetryCount),
+
+			LocalId:       &f.ID,
+			ClockOffsetMs: f.ClockOffsetMs,
+		})
+	}
+
+	resp, err := t.client.SubmitFailedMeasurements(ctx, &speedtestpb.SubmitFailedMeasurementsRequest{
+		NodeId:      req.NodeID,
+		NodeName:    req.NodeName,
+		FailedTests: failedTests,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+
+	return &models.FailedMeasurementsResponse{
+		Status:   resp.GetStatus(),
+		Received: int(resp.GetReceived()),
+		Rejected: int(resp.GetRejected()),
+		Deferred: resp.GetDeferred(),
+	}, nil
+}
+
+// ReportCommandResult reports progress on a queued command
+func (t *GRPCTransport) ReportCommandResult(req *models.CommandResultRequest) (*models.CommandResultResponse, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), t.timeout)
+	defer cancel()
+
+	pbReq := &speedtestpb.ReportCommandResultRequest{
+		CommandId:    req.CommandID,
+		NodeId:       req.NodeID,
+		Status:       req.Status,
+		ErrorMessage: req.ErrorMessage,
+	}
+	if req.MeasurementTimestamp != nil {
+		pbReq.MeasurementTimestamp = timestamppb.New(*req.MeasurementTimestamp)
+		pbReq.ClockOffsetMs = req.ClockOffsetMs
+	}
+
+	resp, err := t.client.ReportCommandResult(ctx, pbReq)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+
+	return &models.CommandResultResponse{
+		Status: resp.GetStatus(),
+	}, nil
+}
+
+// Close closes the gRPC connection
+func (t *GRPCTransport) Close() error {
+	return t.conn.Close()
+}
+
+// apiKeyCredentials attaches the API key to every call as "authorization" metadata
+type apiKeyCredentials struct {
+	apiKey     string
+	requireTLS bool
+}
+
+// GetRequestMetadata implements credentials.PerRPCCredentials
+func (c apiKeyCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{
+		"authorization": "Bearer " + c.apiKey,
+	}, nil
+}
+
+// RequireTransportSecurity implements credentials.PerRPCCredentials.
+// Plaintext is allowed so nodes can reach a server on a trusted network
+// without TLS, matching what the HTTP transport permits.
+func (c apiKeyCredentials) RequireTransportSecurity() bool {
+	return c.requireTLS
+}
+
+// measurementToProto converts a local measurement to its protobuf form
+func measurementToProto(m *models.Measurement) *speedtestpb.Measurement {
+	pb := &speedtestpb.Measurement{
+		Timestamp:  timestamppb.New(m.Timestamp),
+		PacketLoss: &m.PacketLoss,
+		Isp:        &m.ISP,
+		Download:   transferToProto(m.Download),
+		Upload:     transferToProto(m.Upload),
+
+		LocalId:       &m.ID,
+		ClockOffsetMs: m.ClockOffsetMs,
+	}
+
+	if m.Ping != nil {
+		pb.Ping = &speedtestpb.Ping{
+			Jitter:  m.Ping.Jitter,
+			Latency: m.Ping.Latency,
+			Low:     m.Ping.Low,
+			High:    m.Ping.High,
+		}
+	}
+
+	if m.Interface != nil {
+		pb.Interface = &speedtestpb.Interface{
+			InternalIp: m.Interface.InternalIP,
+			Name:       m.Interface.Name,
+			MacAddr:    m.Interface.MacAddr,
+			IsVpn:      m.Interface.IsVPN,
+			ExternalIp: m.Interface.ExternalIP,
+		}
+	}
+
+	if m.Server != nil {
+		pb.Server = &speedtestpb.Server{
+			Id:       int32(m.Server.ID),
+			Host:     m.Server.Host,
+			Port:     int32(m.Server.Port),
+			Name:     m.Server.Name,
+			Location: m.Server.Location,
+			Country:  m.Server.Country,
+			Ip:       m.Server.IP,
+		}
+	}
+
+	if m.Result != nil {
+		pb.Result = &speedtestpb.Result{
+			Id:  m.Result.ID,
+			Url: m.Result.URL,
+		}
+	}
+
+	return pb
+}
+
+// transferToProto converts download/upload data
+func transferToProto(t *models.TransferData) *speedtestpb.Transfer {
+	if t == nil {
+		return nil
+	}
+
+	pb := &speedtestpb.Transfer{
+		Bandwidth: t.Bandwidth,
+		Bytes:     t.Bytes,
+		Elapsed:   int32(t.Elapsed),
+	}
+
+	if t.Latency != nil {
+		pb.Latency = &speedtestpb.Latency{
+			Iqm:    t.Latency.IQM,
+			Low:    t.Latency.Low,
+			High:   t.Latency.High,
+			Jitter: t.Latency.Jitter,
+		}
+	}
+
+	return pb
+}
+
+// timeFromProto converts an optional timestamp, zero if it is not set
+func timeFromProto(ts *timestamppb.Timestamp) time.Time {
+	if ts == nil {
+		return time.Time{}
+	}
+	return ts.AsTime()
+}
+
+// inventoryToProto converts the node inventory
+func inventoryToProto(inventory *models.NodeInventory) *speedtestpb.NodeInventory {
+	if inventory == nil {
+		return nil
+	}
+
+	pb := &speedtestpb.NodeInventory{
+		Version:                  inventory.Version,
+		Backends:                 inventory.Backends,
+		Os:                       inventory.OS,
+		Kernel:                   inventory.Kernel,
+		Arch:                     inventory.Arch,
+		UptimeSeconds:            inventory.UptimeSeconds,
+		DbSizeBytes:              inventory.DBSizeBytes,
+		UnsentMeasurements:       inventory.UnsentMeasurements,
+		UnsentFailedMeasurements: inventory.UnsentFailedMeasurements,
+	}
+	if inventory.LastSuccessfulTest != nil {
+		pb.LastSuccessfulTest = timestamppb.New(*inventory.LastSuccessfulTest)
+	}
+
+	return pb
+}
+
+// nodeSettingsFromProto converts server-managed settings
+func nodeSettingsFromProto(config *speedtestpb.NodeSettings) *models.NodeSettings {
+	settings := &models.NodeSettings{
+		SpeedtestCron:    config.SpeedtestCron,
+		SpeedtestTimeout: config.SpeedtestTimeout,
+		RetryOnFailure:   config.RetryOnFailure,
+		SyncInterval:     config.SyncInterval,
+		AliveInterval:    config.AliveInterval,
+	}
+	if config.BatchSize != nil {
+		batchSize := int(config.GetBatchSize())
+		settings.BatchSize = &batchSize
+	}
+	if config.RetentionDays != nil {
+		retentionDays := int(config.GetRetentionDays())
+		settings.RetentionDays = &retentionDays
+	}
+	return settings
+}
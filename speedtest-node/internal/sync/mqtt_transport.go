@@ -0,0 +1,163 @@
+package sync
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"mark7888/speedtest-node/pkg/models"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"go.uber.org/zap"
+)
+
+// mqttSignatureMethod takes the place of the HTTP method when signing a
+// message, as the server expects; the topic takes the place of the URI
+const mqttSignatureMethod = "PUBLISH"
+
+// MQTTConfig holds the settings for the MQTT transport
+type MQTTConfig struct {
+	BrokerURL   string // tcp://, ssl:// or ws:// URL of the broker
+	Username    string
+	Password    string
+	TopicPrefix string
+	StoreDir    string // directory for in-flight messages, survives restarts
+	TLSVerify   bool
+}
+
+// MQTTTransport publishes node data to an MQTT broker, for sites that can
+// only reach the broker. The data server's MQTT ingest bridge consumes the
+// topics. Messages are published with QoS 1 on a persistent session, so a
+// send only succeeds once the broker has acknowledged it. The server cannot
+// answer over MQTT, so results it defers for being timestamped in the
+// future are not sent again; keep MQTT nodes' clocks synchronized. Every
+// client of the broker may read the messages, so they are signed rather
+// than carrying the API key.
+type MQTTTransport struct {
+	client      mqtt.Client
+	signer      *RequestSigner
+	nodeID      string
+	topicPrefix string
+	timeout     time.Duration
+	logger      *zap.Logger
+}
+
+// NewMQTTTransport creates a new MQTT transport and starts connecting to the
+// broker. Messages are signed with signer.
+func NewMQTTTransport(cfg MQTTConfig, signer *RequestSigner, nodeID string, timeout time.Duration, logger *zap.Logger) *MQTTTransport {
+	// The client ID must be stable for the broker to keep the session
+	opts := mqtt.NewClientOptions().
+		AddBroker(cfg.BrokerURL).
+		SetClientID("speedtest-node-" + nodeID).
+		SetUsername(cfg.Username).
+		SetPassword(cfg.Password).
+		SetCleanSession(false).
+		SetStore(mqtt.NewFileStore(cfg.StoreDir)).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetConnectRetryInterval(10 * time.Second).
+		SetTLSConfig(&tls.Config{InsecureSkipVerify: !cfg.TLSVerify}).
+		SetOnConnectHandler(func(mqtt.Client) {
+			logger.Info("Connected to MQTT broker", zap.String("broker", cfg.BrokerURL))
+		}).
+		SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+			logger.Warn("MQTT connection lost", zap.Error(err))
+		})
+
+	client := mqtt.NewClient(opts)
+
+	// With ConnectRetry enabled this returns immediately and keeps retrying
+	// in the background; publishes are queued until the connection is up
+	client.Connect()
+
+	logger.Info("MQTT transport initialized",
+		zap.String("broker", cfg.BrokerURL),
+		zap.String("topic_prefix", cfg.TopicPrefix),
+	)
+
+	return &MQTTTransport{
+		client:      client,
+		signer:      signer,
+		nodeID:      nodeID,
+		topicPrefix: cfg.TopicPrefix,
+		timeout:     timeout,
+		logger:      logger,
+	}
+}
+
+// SendAlive publishes an alive signal
+func (t *MQTTTransport) SendAlive(req *models.AliveRequest) (*models.AliveResponse, error) {
+	if err := t.publish("alive", req); err != nil {
+		return nil, err
+	}
+	return &models.AliveResponse{Status: "published"}, nil
+}
+
+// SendMeasurements publishes a batch of measurements
+func (t *MQTTTransport) SendMeasurements(req *models.MeasurementsRequest) (*models.MeasurementsResponse, error) {
+	if err := t.publish("measurements", req); err != nil {
+		return nil, err
+	}
+	return &models.MeasurementsResponse{Status: "published", Received: len(req.Measurements)}, nil
+}
+
+// SendFailedMeasurements publishes a batch of failed measurements
+func (t *MQTTTransport) SendFailedMeasurements(req *models.FailedMeasurementsRequest) (*models.FailedMeasurementsResponse, error) {
+	if err := t.publish("failed", req); err != nil {
+		return nil, err
+	}
+	return &models.FailedMeasurementsResponse{Status: "published", Received: len(req.FailedTests)}, nil
+}
+
+// ReportCommandResult publishes progress on a queued command
+func (t *MQTTTransport) ReportCommandResult(req *models.CommandResultRequest) (*models.CommandResultResponse, error) {
+	if err := t.publish("command_result", req); err != nil {
+		return nil, err
+	}
+	return &models.CommandResultResponse{Status: "published"}, nil
+}
+
+// Close disconnects from the broker, giving in-flight publishes a moment to finish
+func (t *MQTTTransport) Close() error {
+	t.client.Disconnect(1000)
+	return nil
+}
+
+// publish signs the payload and sends it to {prefix}/{node_id}/{kind},
+// waiting for the broker ack
+func (t *MQTTTransport) publish(kind string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	topic := t.topicPrefix + "/" + t.nodeID + "/" + kind
+	timestamp, nonce, signature, err := t.signer.sign(mqttSignatureMethod, topic, body)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(&models.MQTTMessage{
+		KeyID:     t.signer.keyID,
+		Timestamp: timestamp,
+		Nonce:     nonce,
+		Signature: signature,
+		Payload:   body,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+
+	token := t.client.Publish(topic, 1, false, data)
+	if !token.WaitTimeout(t.timeout) {
+		// The message stays in the session store and is retried by the
+		// client, so the server may receive it twice; ingestion is idempotent
+		return fmt.Errorf("timed out waiting for broker acknowledgement on %s", topic)
+	}
+	if err := token.Error(); err != nil {
+		return fmt.Errorf("publish to %s failed: %w", topic, err)
+	}
+
+	t.logger.Debug("Published MQTT message", zap.String("topic", topic), zap.Int("bytes", len(data)))
+
+	return nil
+}
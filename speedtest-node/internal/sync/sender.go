@@ -1,35 +1,36 @@
 package sync
 
 import (
-	"encoding/json"
-	"fmt"
 	"mark7888/speedtest-node/pkg/models"
+	"time"
 
 	"go.uber.org/zap"
 )
 
 // Sender handles sending measurements and failed measurements to the server
 type Sender struct {
-	client   *Client
-	nodeID   string
-	nodeName string
-	logger   *zap.Logger
+	transport Transport
+	nodeID    string
+	nodeName  string
+	logger    *zap.Logger
 }
 
 // NewSender creates a new sender
-func NewSender(client *Client, nodeID, nodeName string, logger *zap.Logger) *Sender {
+func NewSender(transport Transport, nodeID, nodeName string, logger *zap.Logger) *Sender {
 	return &Sender{
-		client:   client,
-		nodeID:   nodeID,
-		nodeName: nodeName,
-		logger:   logger,
+		transport: transport,
+		nodeID:    nodeID,
+		nodeName:  nodeName,
+		logger:    logger,
 	}
 }
 
-// SendMeasurements sends a batch of measurements to the server
-func (s *Sender) SendMeasurements(measurements []*models.Measurement) error {
+// SendMeasurements sends a batch of measurements to the server. deferred
+// holds the IDs of measurements the server could not accept yet because
+// they are timestamped in the future; they should stay queued.
+func (s *Sender) SendMeasurements(measurements []*models.Measurement) (deferred []int64, err error) {
 	if len(measurements) == 0 {
-		return nil
+		return nil, nil
 	}
 
 	s.logger.Info("Sending measurements to server", zap.Int("count", len(measurements)))
@@ -40,15 +41,10 @@ func (s *Sender) SendMeasurements(measurements []*models.Measurement) error {
 		Measurements: measurements,
 	}
 
-	respData, err := s.client.Post("/api/v1/measurements", request)
+	response, err := s.transport.SendMeasurements(request)
 	if err != nil {
 		s.logger.Warn("Failed to send measurements", zap.Error(err))
-		return err
-	}
-
-	var response models.MeasurementsResponse
-	if err := json.Unmarshal(respData, &response); err != nil {
-		return fmt.Errorf("failed to parse response: %w", err)
+		return nil, err
 	}
 
 	s.logger.Info("Measurements sent successfully",
@@ -56,13 +52,22 @@ func (s *Sender) SendMeasurements(measurements []*models.Measurement) error {
 		zap.Int("failed", response.Failed),
 	)
 
-	return nil
+	if response.Rejected > 0 || response.Quarantined > 0 {
+		s.logger.Warn("Server did not accept all measurements, check the node clock and speedtest results",
+			zap.Int("rejected", response.Rejected),
+			zap.Int("quarantined", response.Quarantined),
+			zap.Int("deferred", len(response.Deferred)),
+		)
+	}
+
+	return response.Deferred, nil
 }
 
-// SendFailedMeasurements sends a batch of failed measurements to the server
-func (s *Sender) SendFailedMeasurements(failed []*models.FailedMeasurement) error {
+// SendFailedMeasurements sends a batch of failed measurements to the server.
+// deferred is as for SendMeasurements.
+func (s *Sender) SendFailedMeasurements(failed []*models.FailedMeasurement) (deferred []int64, err error) {
 	if len(failed) == 0 {
-		return nil
+		return nil, nil
 	}
 
 	s.logger.Info("Sending failed measurements to server", zap.Int("count", len(failed)))
@@ -73,18 +78,48 @@ func (s *Sender) SendFailedMeasurements(failed []*models.FailedMeasurement) erro
 		FailedTests: failed,
 	}
 
-	respData, err := s.client.Post("/api/v1/measurements/failed", request)
+	response, err := s.transport.SendFailedMeasurements(request)
 	if err != nil {
 		s.logger.Error("Failed to send failed measurements", zap.Error(err))
-		return err
+		return nil, err
+	}
+
+	s.logger.Info("Failed measurements sent successfully", zap.Int("received", response.Received))
+
+	if response.Rejected > 0 {
+		s.logger.Warn("Server rejected failed measurements timestamped in the future, check the node clock",
+			zap.Int("rejected", response.Rejected),
+			zap.Int("deferred", len(response.Deferred)),
+		)
 	}
 
-	var response models.FailedMeasurementsResponse
-	if err := json.Unmarshal(respData, &response); err != nil {
-		return fmt.Errorf("failed to parse response: %w", err)
+	return response.Deferred, nil
+}
+
+// ReportCommandResult reports progress on a command queued by the server
+func (s *Sender) ReportCommandResult(commandID, status string, errorMessage *string, measurementTimestamp *time.Time, clockOffsetMs *int64) error {
+	request := &models.CommandResultRequest{
+		CommandID:            commandID,
+		NodeID:               s.nodeID,
+		Status:               status,
+		ErrorMessage:         errorMessage,
+		MeasurementTimestamp: measurementTimestamp,
+		ClockOffsetMs:        clockOffsetMs,
 	}
 
-	s.logger.Info("Failed measurements sent successfully", zap.Int("received", response.Received))
+	if _, err := s.transport.ReportCommandResult(request); err != nil {
+		s.logger.Warn("Failed to report command result",
+			zap.String("command_id", commandID),
+			zap.String("status", status),
+			zap.Error(err),
+		)
+		return err
+	}
+
+	s.logger.Debug("Command result reported",
+		zap.String("command_id", commandID),
+		zap.String("status", status),
+	)
 
 	return nil
 }
@@ -0,0 +1,50 @@
+package sync
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+// NewTLSConfig builds the TLS settings for connections to the data server.
+// caFile adds a CA bundle to the system roots, for servers with a private
+// CA. certFile and keyFile set a client certificate the node authenticates
+// with instead of an API key. The pair is read again on every handshake, so
+// a renewed certificate is picked up without a restart; it is also read once
+// here to fail early on a bad pair.
+func NewTLSConfig(verify bool, caFile, certFile, keyFile string) (*tls.Config, error) {
+	config := &tls.Config{
+		InsecureSkipVerify: !verify,
+	}
+
+	if caFile != "" {
+		data, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificates found in %s", caFile)
+		}
+		config.RootCAs = pool
+	}
+
+	if certFile != "" || keyFile != "" {
+		if _, err := tls.LoadX509KeyPair(certFile, keyFile); err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		config.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load client certificate: %w", err)
+			}
+			return &cert, nil
+		}
+	}
+
+	return config, nil
+}
@@ -0,0 +1,154 @@
+package sync
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// writeClientCert writes a self-signed client certificate for commonName
+// and its key to dir
+func writeClientCert(t *testing.T, dir, commonName string) (string, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, &x509.Certificate{Subject: pkix.Name{CommonName: commonName}}, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile, keyFile := filepath.Join(dir, "node.crt"), filepath.Join(dir, "node.key")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func TestNewTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeClientCert(t, dir, "node")
+	notPEM := filepath.Join(dir, "empty.pem")
+	if err := os.WriteFile(notPEM, []byte("nothing here"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name                         string
+		caFile, certFile, keyFile    string
+		wantErr, wantRoots, wantCert bool
+	}{
+		{name: "defaults"},
+		{name: "CA bundle", caFile: certFile, wantRoots: true},
+		{name: "client certificate", certFile: certFile, keyFile: keyFile, wantCert: true},
+		{name: "missing CA bundle", caFile: filepath.Join(dir, "missing.pem"), wantErr: true},
+		{name: "CA bundle without certificates", caFile: notPEM, wantErr: true},
+		{name: "certificate without key", certFile: certFile, wantErr: true},
+		{name: "mismatched pair", certFile: certFile, keyFile: notPEM, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := NewTLSConfig(true, tt.caFile, tt.certFile, tt.keyFile)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if config.InsecureSkipVerify {
+				t.Error("verification disabled")
+			}
+			if (config.RootCAs != nil) != tt.wantRoots {
+				t.Errorf("RootCAs set = %v, want %v", config.RootCAs != nil, tt.wantRoots)
+			}
+			if (config.GetClientCertificate != nil) != tt.wantCert {
+				t.Errorf("client certificate set = %v, want %v", config.GetClientCertificate != nil, tt.wantCert)
+			}
+		})
+	}
+
+	if config, err := NewTLSConfig(false, "", "", ""); err != nil || !config.InsecureSkipVerify {
+		t.Errorf("NewTLSConfig(false) = %v, %v; want verification disabled", config, err)
+	}
+}
+
+func TestClientCertificateAuth(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "" {
+			http.Error(w, "unexpected API key", http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"node": r.TLS.PeerCertificates[0].Subject.CommonName})
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	server.StartTLS()
+	defer server.Close()
+
+	// Trust the test server through a CA bundle file
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.pem")
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile := writeClientCert(t, dir, "node-a")
+
+	tlsConfig, err := NewTLSConfig(true, caFile, certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := NewClient(server.URL, "", time.Second, tlsConfig, "none", zap.NewNop())
+	post := func() string {
+		t.Helper()
+		body, err := client.Post(context.Background(), "/", struct{}{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var response map[string]string
+		if err := json.Unmarshal(body, &response); err != nil {
+			t.Fatal(err)
+		}
+		return response["node"]
+	}
+
+	if node := post(); node != "node-a" {
+		t.Errorf("server saw certificate for %q, want node-a", node)
+	}
+
+	// A renewed certificate is used on the next connection without a new client
+	writeClientCert(t, dir, "node-b")
+	client.client.CloseIdleConnections()
+	if node := post(); node != "node-b" {
+		t.Errorf("server saw certificate for %q after renewal, want node-b", node)
+	}
+}
@@ -0,0 +1,107 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"mark7888/speedtest-node/internal/tracing"
+	"mark7888/speedtest-node/pkg/models"
+	"net/url"
+)
+
+// Transport delivers node data to the data server.
+// HTTPTransport (JSON over REST) is the default; GRPCTransport uses the
+// server's protobuf ingestion service instead.
+type Transport interface {
+	SendAlive(req *models.AliveRequest) (*models.AliveResponse, error)
+	SendMeasurements(req *models.MeasurementsRequest) (*models.MeasurementsResponse, error)
+	SendFailedMeasurements(req *models.FailedMeasurementsRequest) (*models.FailedMeasurementsResponse, error)
+	ReportCommandResult(req *models.CommandResultRequest) (*models.CommandResultResponse, error)
+	Close() error
+}
+
+// AliveResponseHandler is implemented by transports that need to see alive
+// responses delivered out of band, such as over the control channel
+type AliveResponseHandler interface {
+	HandleAliveResponse(response *models.AliveResponse)
+}
+
+// HTTPTransport sends data to the REST API using the sync Client
+type HTTPTransport struct {
+	client *Client
+}
+
+// NewHTTPTransport creates a new REST transport
+func NewHTTPTransport(client *Client) *HTTPTransport {
+	return &HTTPTransport{
+		client: client,
+	}
+}
+
+// SendAlive posts an alive signal
+func (t *HTTPTransport) SendAlive(req *models.AliveRequest) (*models.AliveResponse, error) {
+	var response models.AliveResponse
+	if err := t.post("SendAlive", "/api/v1/node/alive", req, &response); err != nil {
+		return nil, err
+	}
+
+	t.HandleAliveResponse(&response)
+
+	return &response, nil
+}
+
+// HandleAliveResponse re-negotiates request compression on every alive so
+// server upgrades and downgrades are picked up without a restart
+func (t *HTTPTransport) HandleAliveResponse(response *models.AliveResponse) {
+	t.client.NegotiateEncoding(response.AcceptEncoding)
+}
+
+// SendMeasurements posts a batch of measurements
+func (t *HTTPTransport) SendMeasurements(req *models.MeasurementsRequest) (*models.MeasurementsResponse, error) {
+	var response models.MeasurementsResponse
+	if err := t.post("SendMeasurements", "/api/v1/measurements", req, &response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// SendFailedMeasurements posts a batch of failed measurements
+func (t *HTTPTransport) SendFailedMeasurements(req *models.FailedMeasurementsRequest) (*models.FailedMeasurementsResponse, error) {
+	var response models.FailedMeasurementsResponse
+	if err := t.post("SendFailedMeasurements", "/api/v1/measurements/failed", req, &response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// ReportCommandResult posts progress on a queued command
+func (t *HTTPTransport) ReportCommandResult(req *models.CommandResultRequest) (*models.CommandResultResponse, error) {
+	var response models.CommandResultResponse
+	if err := t.post("ReportCommandResult", "/api/v1/node/commands/"+url.PathEscape(req.CommandID)+"/result", req, &response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// Close is a no-op; the underlying HTTP client keeps no dedicated connection
+func (t *HTTPTransport) Close() error {
+	return nil
+}
+
+// post sends the payload and decodes the JSON response into out. Each call
+// starts a new trace named after the operation.
+func (t *HTTPTransport) post(operation, endpoint string, payload, out interface{}) error {
+	ctx, span := tracing.Start(context.Background(), "sync."+operation)
+	defer span.End()
+
+	respData, err := t.client.Post(ctx, endpoint, payload)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(respData, out); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	return nil
+}
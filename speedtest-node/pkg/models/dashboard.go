@@ -0,0 +1,52 @@
+package models
+
+import "time"
+
+// Aggregation intervals for DashboardAggregates
+const (
+	AggregateIntervalHour = "hour"
+	AggregateIntervalDay  = "day"
+)
+
+// DashboardAggregates summarizes local results over a time range, served on
+// the node's dashboard API
+type DashboardAggregates struct {
+	From     time.Time         `json:"from"`
+	To       time.Time         `json:"to"`
+	Interval string            `json:"interval"`
+	Summary  AggregateBucket   `json:"summary"`
+	Buckets  []AggregateBucket `json:"buckets"`
+}
+
+// AggregateStats holds the raw totals of one aggregation window as read from
+// the local database. Download and Upload are in bytes per second.
+type AggregateStats struct {
+	Tests, Failures                            int
+	Download, Upload, Ping, Jitter, PacketLoss SeriesStats
+}
+
+// SeriesStats totals the non-null values of one column. Min and Max are
+// only filled in for bandwidths.
+type SeriesStats struct {
+	Count         int
+	Sum, Min, Max float64
+}
+
+// AggregateBucket holds statistics for one interval. Tests counts successful
+// measurements and Failures failed attempts. Speeds are in Mbit/s and
+// latencies in milliseconds; averages are zero when there were no
+// successful measurements.
+type AggregateBucket struct {
+	Start           time.Time `json:"start"`
+	Tests           int       `json:"tests"`
+	Failures        int       `json:"failures"`
+	AvgDownloadMbps float64   `json:"avg_download_mbps"`
+	MinDownloadMbps float64   `json:"min_download_mbps"`
+	MaxDownloadMbps float64   `json:"max_download_mbps"`
+	AvgUploadMbps   float64   `json:"avg_upload_mbps"`
+	MinUploadMbps   float64   `json:"min_upload_mbps"`
+	MaxUploadMbps   float64   `json:"max_upload_mbps"`
+	AvgPingMs       float64   `json:"avg_ping_ms"`
+	AvgJitterMs     float64   `json:"avg_jitter_ms"`
+	AvgPacketLoss   float64   `json:"avg_packet_loss"`
+}
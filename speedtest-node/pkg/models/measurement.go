@@ -1,13 +1,20 @@
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 // Measurement represents a complete speedtest measurement
 type Measurement struct {
-	ID        int64     `json:"-"`
+	ID        int64     `json:"local_id,omitempty"` // Local row ID, echoed by the server for deferred results
 	Timestamp time.Time `json:"timestamp"`
 	CreatedAt time.Time `json:"-"`
 
+	// Estimated offset of the node's clock from server time (server - node)
+	// when the test ran, nil if not estimated yet
+	ClockOffsetMs *int64 `json:"clock_offset_ms,omitempty"`
+
 	// Ping data
 	Ping *PingData `json:"ping,omitempty"`
 
@@ -85,13 +92,14 @@ type Result struct {
 
 // FailedMeasurement represents a failed speedtest attempt
 type FailedMeasurement struct {
-	ID           int64      `json:"-"`
-	Timestamp    time.Time  `json:"timestamp"`
-	CreatedAt    time.Time  `json:"-"`
-	ErrorMessage string     `json:"error_message"`
-	RetryCount   int        `json:"retry_count"`
-	Sent         bool       `json:"-"`
-	SentAt       *time.Time `json:"-"`
+	ID            int64      `json:"local_id,omitempty"` // See Measurement
+	Timestamp     time.Time  `json:"timestamp"`
+	CreatedAt     time.Time  `json:"-"`
+	ErrorMessage  string     `json:"error_message"`
+	RetryCount    int        `json:"retry_count"`
+	ClockOffsetMs *int64     `json:"clock_offset_ms,omitempty"` // See Measurement
+	Sent          bool       `json:"-"`
+	SentAt        *time.Time `json:"-"`
 }
 
 // AliveRequest represents the alive/keepalive signal request
@@ -100,12 +108,85 @@ type AliveRequest struct {
 	NodeName  string    `json:"node_name"`
 	Location  *string   `json:"location,omitempty"`
 	Timestamp time.Time `json:"timestamp"`
+
+	// Version of the server-managed settings this node runs, "" if none
+	ConfigVersion *string `json:"config_version,omitempty"`
+
+	Inventory *NodeInventory `json:"inventory,omitempty"`
+
+	// Offset of this node's clock from server time (server - node), nil until estimated
+	ClockOffsetMs *int64 `json:"clock_offset_ms,omitempty"`
+}
+
+// NodeInventory describes the node's software, host and local queue state
+type NodeInventory struct {
+	Version                  string     `json:"version"`
+	Backends                 []string   `json:"backends"` // Speedtest backends found on this host
+	OS                       string     `json:"os"`
+	Kernel                   string     `json:"kernel,omitempty"`
+	Arch                     string     `json:"arch"`
+	UptimeSeconds            int64      `json:"uptime_seconds"` // Since the node process started
+	DBSizeBytes              int64      `json:"db_size_bytes"`
+	UnsentMeasurements       int64      `json:"unsent_measurements"`
+	UnsentFailedMeasurements int64      `json:"unsent_failed_measurements"`
+	LastSuccessfulTest       *time.Time `json:"last_successful_test,omitempty"`
 }
 
 // AliveResponse represents the server response to alive signal
 type AliveResponse struct {
-	Status     string    `json:"status"`
-	ServerTime time.Time `json:"server_time"`
+	Status         string           `json:"status"`
+	ServerTime     time.Time        `json:"server_time"`
+	RequestTime    time.Time        `json:"request_time"` // Echo of AliveRequest.Timestamp; zero from servers that do not send it
+	ReceiveTime    time.Time        `json:"receive_time"` // When the server received the request; ServerTime is when it replied
+	AcceptEncoding []string         `json:"accept_encoding,omitempty"`
+	Commands       []PendingCommand `json:"commands,omitempty"`
+	ConfigVersion  *string          `json:"config_version,omitempty"` // nil if the server did not say, e.g. over MQTT
+	Config         *NodeSettings    `json:"config,omitempty"`         // set when ConfigVersion differs from ours
+}
+
+// NodeSettings are settings managed from the server. Unset fields keep the
+// value from the node's own flags/environment.
+type NodeSettings struct {
+	SpeedtestCron    *string `json:"speedtest_cron,omitempty"`
+	SpeedtestTimeout *string `json:"speedtest_timeout,omitempty"`
+	RetryOnFailure   *bool   `json:"retry_on_failure,omitempty"`
+	BatchSize        *int    `json:"batch_size,omitempty"`
+	SyncInterval     *string `json:"sync_interval,omitempty"`
+	AliveInterval    *string `json:"alive_interval,omitempty"`
+	RetentionDays    *int    `json:"retention_days,omitempty"`
+}
+
+// Queued command names, see PendingCommand
+const (
+	CommandRunTest = "run_test"
+)
+
+// Queued command statuses reported back to the server
+const (
+	CommandStatusRunning   = "running"
+	CommandStatusCompleted = "completed"
+	CommandStatusFailed    = "failed"
+)
+
+// PendingCommand is a command the server queued for this node, delivered in an alive response
+type PendingCommand struct {
+	ID      string `json:"id"`
+	Command string `json:"command"`
+}
+
+// CommandResultRequest reports progress on a queued command
+type CommandResultRequest struct {
+	CommandID            string     `json:"command_id"`
+	NodeID               string     `json:"node_id"`
+	Status               string     `json:"status"`
+	ErrorMessage         *string    `json:"error_message,omitempty"`
+	MeasurementTimestamp *time.Time `json:"measurement_timestamp,omitempty"`
+	ClockOffsetMs        *int64     `json:"clock_offset_ms,omitempty"` // Recorded with the measurement
+}
+
+// CommandResultResponse represents the server response to a command result
+type CommandResultResponse struct {
+	Status string `json:"status"`
 }
 
 // MeasurementsRequest represents a batch of measurements to send to server
@@ -117,9 +198,15 @@ type MeasurementsRequest struct {
 
 // MeasurementsResponse represents the server response to measurements
 type MeasurementsResponse struct {
-	Status   string `json:"status"`
-	Received int    `json:"received"`
-	Failed   int    `json:"failed"`
+	Status      string `json:"status"`
+	Received    int    `json:"received"`
+	Failed      int    `json:"failed"`
+	Rejected    int    `json:"rejected"`    // Timestamps too far in the future, or implausible values
+	Quarantined int    `json:"quarantined"` // Implausible values the server holds for review
+
+	// Local IDs of measurements timestamped too far in the future; they stay
+	// queued and are sent again later
+	Deferred []int64 `json:"deferred,omitempty"`
 }
 
 // FailedMeasurementsRequest represents a batch of failed measurements to send to server
@@ -133,6 +220,25 @@ type FailedMeasurementsRequest struct {
 type FailedMeasurementsResponse struct {
 	Status   string `json:"status"`
 	Received int    `json:"received"`
+	Rejected int    `json:"rejected"`
+
+	// Local IDs of rejected results to send again later
+	Deferred []int64 `json:"deferred,omitempty"`
+}
+
+// EnrollRequest exchanges an enrollment token for the node's own API key
+type EnrollRequest struct {
+	Token    string `json:"token"`
+	NodeID   string `json:"node_id"`
+	NodeName string `json:"node_name"`
+}
+
+// EnrollResponse carries the API key issued to the node, bound to its node ID
+type EnrollResponse struct {
+	APIKeyID string   `json:"api_key_id"`
+	Key      string   `json:"key"`
+	NodeID   string   `json:"node_id"`
+	Scopes   []string `json:"scopes"`
 }
 
 // SpeedtestResult represents the raw output from speedtest CLI
@@ -190,3 +296,45 @@ type SpeedtestResult struct {
 		URL string `json:"url"`
 	} `json:"result"`
 }
+
+// MQTTMessage is the envelope published to the MQTT ingest topics.
+// Payload carries the same JSON body as the corresponding REST request.
+// Other clients of the broker can read it, so instead of the API key it
+// carries a signature over the topic and payload.
+type MQTTMessage struct {
+	KeyID     string          `json:"key_id"`
+	Timestamp string          `json:"timestamp"`
+	Nonce     string          `json:"nonce"`
+	Signature string          `json:"signature"`
+	Payload   json.RawMessage `json:"payload"`
+}
+
+// Control channel message types, see ControlMessage
+const (
+	ControlTypeAlive         = "alive"
+	ControlTypeAliveAck      = "alive_ack"
+	ControlTypeCommand       = "command"
+	ControlTypeCommandResult = "command_result"
+	ControlTypeError         = "error"
+)
+
+// ControlMessage is a single message on the WebSocket control channel
+type ControlMessage struct {
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// Command is an instruction pushed by the server over the control channel
+type Command struct {
+	ID   string          `json:"id"`
+	Name string          `json:"name"`
+	Args json.RawMessage `json:"args,omitempty"`
+}
+
+// CommandResult is the node's reply to a Command
+type CommandResult struct {
+	ID     string          `json:"id"`
+	Status string          `json:"status"` // ok or error
+	Error  string          `json:"error,omitempty"`
+	Output json.RawMessage `json:"output,omitempty"`
+}
@@ -0,0 +1,49 @@
+package models
+
+import "time"
+
+// NodeStatus is served on the node's local /status endpoint
+type NodeStatus struct {
+	NodeID        string       `json:"node_id"`
+	NodeName      string       `json:"node_name"`
+	Version       string       `json:"version"`
+	UptimeSeconds int64        `json:"uptime_seconds"`
+	LastTest      *TestStatus  `json:"last_test,omitempty"`
+	LastResult    *Measurement `json:"last_result,omitempty"` // Latest successful measurement
+	NextRun       *time.Time   `json:"next_run,omitempty"`
+	Backlog       Backlog      `json:"backlog"`
+	Server        ServerStatus `json:"server"`
+}
+
+// TestStatus describes the outcome of the latest speedtest run
+type TestStatus struct {
+	Timestamp time.Time `json:"timestamp"`
+	Success   bool      `json:"success"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// Backlog counts results waiting to be sent to the server
+type Backlog struct {
+	UnsentMeasurements       int64 `json:"unsent_measurements"`
+	UnsentFailedMeasurements int64 `json:"unsent_failed_measurements"`
+}
+
+// Server health values reported in ServerStatus. They are derived from the
+// outcome of the latest exchanges only: the node has no sync circuit breaker
+// and keeps retrying on every sync and alive interval whatever the health.
+const (
+	ServerHealthOK      = "ok"      // the last exchange with the server succeeded
+	ServerHealthFailing = "failing" // the server could not be reached or refused the last exchange
+	ServerHealthOffline = "offline" // no server configured
+)
+
+// ServerStatus describes the node's connection to the data server
+type ServerStatus struct {
+	Health              string     `json:"health"` // Derived, see ServerHealthOK
+	Transport           string     `json:"transport,omitempty"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	LastSuccess         *time.Time `json:"last_success,omitempty"`
+	LastError           string     `json:"last_error,omitempty"`
+	LastErrorAt         *time.Time `json:"last_error_at,omitempty"`
+	ControlChannel      *bool      `json:"control_channel_connected,omitempty"`
+}
@@ -0,0 +1,1791 @@
+// Ingestion protocol between speedtest nodes and the data server.
+//
+// This is the binary equivalent of the node-facing REST endpoints
+// (/api/v1/node/alive, /api/v1/measurements and /api/v1/measurements/failed)
+// and has the same semantics. Clients authenticate by sending their API key
+// in the "authorization" metadata entry as "Bearer <key>".
+//
+// Generated Go code lives in each module (data-server/pkg/speedtestpb and
+// speedtest-node/pkg/speedtestpb); run `go generate ./...` in either module
+// after changing this file.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.12
+// 	protoc        v5.29.3
+// source: speedtest/v1/ingest.proto
+
+package speedtestpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type AliveRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	NodeId        string                 `protobuf:"bytes,1,opt,name=node_id,json=nodeId,proto3" json:"node_id,omitempty"` // UUID
+	NodeName      string                 `protobuf:"bytes,2,opt,name=node_name,json=nodeName,proto3" json:"node_name,omitempty"`
+	Location      *string                `protobuf:"bytes,3,opt,name=location,proto3,oneof" json:"location,omitempty"`
+	Timestamp     *timestamppb.Timestamp `protobuf:"bytes,4,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	ConfigVersion *string                `protobuf:"bytes,5,opt,name=config_version,json=configVersion,proto3,oneof" json:"config_version,omitempty"` // Version of the server-managed settings the node runs
+	Inventory     *NodeInventory         `protobuf:"bytes,6,opt,name=inventory,proto3" json:"inventory,omitempty"`
+	ClockOffsetMs *int64                 `protobuf:"varint,7,opt,name=clock_offset_ms,json=clockOffsetMs,proto3,oneof" json:"clock_offset_ms,omitempty"` // server - node, once estimated from an alive round-trip
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AliveRequest) Reset() {
+	*x = AliveRequest{}
+	mi := &file_speedtest_v1_ingest_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AliveRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AliveRequest) ProtoMessage() {}
+
+func (x *AliveRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_speedtest_v1_ingest_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AliveRequest.ProtoReflect.Descriptor instead.
+func (*AliveRequest) Descriptor() ([]byte, []int) {
+	return file_speedtest_v1_ingest_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *AliveRequest) GetNodeId() string {
+	if x != nil {
+		return x.NodeId
+	}
+	return ""
+}
+
+func (x *AliveRequest) GetNodeName() string {
+	if x != nil {
+		return x.NodeName
+	}
+	return ""
+}
+
+func (x *AliveRequest) GetLocation() string {
+	if x != nil && x.Location != nil {
+		return *x.Location
+	}
+	return ""
+}
+
+func (x *AliveRequest) GetTimestamp() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Timestamp
+	}
+	return nil
+}
+
+func (x *AliveRequest) GetConfigVersion() string {
+	if x != nil && x.ConfigVersion != nil {
+		return *x.ConfigVersion
+	}
+	return ""
+}
+
+func (x *AliveRequest) GetInventory() *NodeInventory {
+	if x != nil {
+		return x.Inventory
+	}
+	return nil
+}
+
+func (x *AliveRequest) GetClockOffsetMs() int64 {
+	if x != nil && x.ClockOffsetMs != nil {
+		return *x.ClockOffsetMs
+	}
+	return 0
+}
+
+// NodeInventory describes a node's software, host and local queue state
+type NodeInventory struct {
+	state                    protoimpl.MessageState `protogen:"open.v1"`
+	Version                  string                 `protobuf:"bytes,1,opt,name=version,proto3" json:"version,omitempty"`
+	Backends                 []string               `protobuf:"bytes,2,rep,name=backends,proto3" json:"backends,omitempty"` // Speedtest backends found on the node's host
+	Os                       string                 `protobuf:"bytes,3,opt,name=os,proto3" json:"os,omitempty"`
+	Kernel                   string                 `protobuf:"bytes,4,opt,name=kernel,proto3" json:"kernel,omitempty"`
+	Arch                     string                 `protobuf:"bytes,5,opt,name=arch,proto3" json:"arch,omitempty"`
+	UptimeSeconds            int64                  `protobuf:"varint,6,opt,name=uptime_seconds,json=uptimeSeconds,proto3" json:"uptime_seconds,omitempty"` // Since the node process started
+	DbSizeBytes              int64                  `protobuf:"varint,7,opt,name=db_size_bytes,json=dbSizeBytes,proto3" json:"db_size_bytes,omitempty"`
+	UnsentMeasurements       int64                  `protobuf:"varint,8,opt,name=unsent_measurements,json=unsentMeasurements,proto3" json:"unsent_measurements,omitempty"`
+	UnsentFailedMeasurements int64                  `protobuf:"varint,9,opt,name=unsent_failed_measurements,json=unsentFailedMeasurements,proto3" json:"unsent_failed_measurements,omitempty"`
+	LastSuccessfulTest       *timestamppb.Timestamp `protobuf:"bytes,10,opt,name=last_successful_test,json=lastSuccessfulTest,proto3" json:"last_successful_test,omitempty"`
+	unknownFields            protoimpl.UnknownFields
+	sizeCache                protoimpl.SizeCache
+}
+
+func (x *NodeInventory) Reset() {
+	*x = NodeInventory{}
+	mi := &file_speedtest_v1_ingest_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *NodeInventory) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*NodeInventory) ProtoMessage() {}
+
+func (x *NodeInventory) ProtoReflect() protoreflect.Message {
+	mi := &file_speedtest_v1_ingest_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use NodeInventory.ProtoReflect.Descriptor instead.
+func (*NodeInventory) Descriptor() ([]byte, []int) {
+	return file_speedtest_v1_ingest_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *NodeInventory) GetVersion() string {
+	if x != nil {
+		return x.Version
+	}
+	return ""
+}
+
+func (x *NodeInventory) GetBackends() []string {
+	if x != nil {
+		return x.Backends
+	}
+	return nil
+}
+
+func (x *NodeInventory) GetOs() string {
+	if x != nil {
+		return x.Os
+	}
+	return ""
+}
+
+func (x *NodeInventory) GetKernel() string {
+	if x != nil {
+		return x.Kernel
+	}
+	return ""
+}
+
+func (x *NodeInventory) GetArch() string {
+	if x != nil {
+		return x.Arch
+	}
+	return ""
+}
+
+func (x *NodeInventory) GetUptimeSeconds() int64 {
+	if x != nil {
+		return x.UptimeSeconds
+	}
+	return 0
+}
+
+func (x *NodeInventory) GetDbSizeBytes() int64 {
+	if x != nil {
+		return x.DbSizeBytes
+	}
+	return 0
+}
+
+func (x *NodeInventory) GetUnsentMeasurements() int64 {
+	if x != nil {
+		return x.UnsentMeasurements
+	}
+	return 0
+}
+
+func (x *NodeInventory) GetUnsentFailedMeasurements() int64 {
+	if x != nil {
+		return x.UnsentFailedMeasurements
+	}
+	return 0
+}
+
+func (x *NodeInventory) GetLastSuccessfulTest() *timestamppb.Timestamp {
+	if x != nil {
+		return x.LastSuccessfulTest
+	}
+	return nil
+}
+
+type AliveResponse struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	Status         string                 `protobuf:"bytes,1,opt,name=status,proto3" json:"status,omitempty"`
+	ServerTime     *timestamppb.Timestamp `protobuf:"bytes,2,opt,name=server_time,json=serverTime,proto3" json:"server_time,omitempty"`
+	NodeRegistered bool                   `protobuf:"varint,3,opt,name=node_registered,json=nodeRegistered,proto3" json:"node_registered,omitempty"`
+	Commands       []*PendingCommand      `protobuf:"bytes,4,rep,name=commands,proto3" json:"commands,omitempty"`                                      // Queued commands for the node to execute
+	ConfigVersion  *string                `protobuf:"bytes,5,opt,name=config_version,json=configVersion,proto3,oneof" json:"config_version,omitempty"` // Version of the node's server-managed settings, empty if none
+	Config         *NodeSettings          `protobuf:"bytes,6,opt,name=config,proto3" json:"config,omitempty"`                                          // Only set when the node's version is out of date
+	RequestTime    *timestamppb.Timestamp `protobuf:"bytes,7,opt,name=request_time,json=requestTime,proto3" json:"request_time,omitempty"`             // Echo of AliveRequest.timestamp
+	ReceiveTime    *timestamppb.Timestamp `protobuf:"bytes,8,opt,name=receive_time,json=receiveTime,proto3" json:"receive_time,omitempty"`             // When the server received the request; server_time is when it replied
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *AliveResponse) Reset() {
+	*x = AliveResponse{}
+	mi := &file_speedtest_v1_ingest_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AliveResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AliveResponse) ProtoMessage() {}
+
+func (x *AliveResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_speedtest_v1_ingest_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AliveResponse.ProtoReflect.Descriptor instead.
+func (*AliveResponse) Descriptor() ([]byte, []int) {
+	return file_speedtest_v1_ingest_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *AliveResponse) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *AliveResponse) GetServerTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.ServerTime
+	}
+	return nil
+}
+
+func (x *AliveResponse) GetNodeRegistered() bool {
+	if x != nil {
+		return x.NodeRegistered
+	}
+	return false
+}
+
+func (x *AliveResponse) GetCommands() []*PendingCommand {
+	if x != nil {
+		return x.Commands
+	}
+	return nil
+}
+
+func (x *AliveResponse) GetConfigVersion() string {
+	if x != nil && x.ConfigVersion != nil {
+		return *x.ConfigVersion
+	}
+	return ""
+}
+
+func (x *AliveResponse) GetConfig() *NodeSettings {
+	if x != nil {
+		return x.Config
+	}
+	return nil
+}
+
+func (x *AliveResponse) GetRequestTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.RequestTime
+	}
+	return nil
+}
+
+func (x *AliveResponse) GetReceiveTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.ReceiveTime
+	}
+	return nil
+}
+
+// NodeSettings mirrors the JSON node settings; unset fields are not managed by the server
+type NodeSettings struct {
+	state            protoimpl.MessageState `protogen:"open.v1"`
+	SpeedtestCron    *string                `protobuf:"bytes,1,opt,name=speedtest_cron,json=speedtestCron,proto3,oneof" json:"speedtest_cron,omitempty"`
+	SpeedtestTimeout *string                `protobuf:"bytes,2,opt,name=speedtest_timeout,json=speedtestTimeout,proto3,oneof" json:"speedtest_timeout,omitempty"` // Go duration, e.g. "2m"
+	RetryOnFailure   *bool                  `protobuf:"varint,3,opt,name=retry_on_failure,json=retryOnFailure,proto3,oneof" json:"retry_on_failure,omitempty"`
+	BatchSize        *int32                 `protobuf:"varint,4,opt,name=batch_size,json=batchSize,proto3,oneof" json:"batch_size,omitempty"`
+	SyncInterval     *string                `protobuf:"bytes,5,opt,name=sync_interval,json=syncInterval,proto3,oneof" json:"sync_interval,omitempty"`
+	AliveInterval    *string                `protobuf:"bytes,6,opt,name=alive_interval,json=aliveInterval,proto3,oneof" json:"alive_interval,omitempty"`
+	RetentionDays    *int32                 `protobuf:"varint,7,opt,name=retention_days,json=retentionDays,proto3,oneof" json:"retention_days,omitempty"`
+	unknownFields    protoimpl.UnknownFields
+	sizeCache        protoimpl.SizeCache
+}
+
+func (x *NodeSettings) Reset() {
+	*x = NodeSettings{}
+	mi := &file_speedtest_v1_ingest_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *NodeSettings) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*NodeSettings) ProtoMessage() {}
+
+func (x *NodeSettings) ProtoReflect() protoreflect.Message {
+	mi := &file_speedtest_v1_ingest_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use NodeSettings.ProtoReflect.Descriptor instead.
+func (*NodeSettings) Descriptor() ([]byte, []int) {
+	return file_speedtest_v1_ingest_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *NodeSettings) GetSpeedtestCron() string {
+	if x != nil && x.SpeedtestCron != nil {
+		return *x.SpeedtestCron
+	}
+	return ""
+}
+
+func (x *NodeSettings) GetSpeedtestTimeout() string {
+	if x != nil && x.SpeedtestTimeout != nil {
+		return *x.SpeedtestTimeout
+	}
+	return ""
+}
+
+func (x *NodeSettings) GetRetryOnFailure() bool {
+	if x != nil && x.RetryOnFailure != nil {
+		return *x.RetryOnFailure
+	}
+	return false
+}
+
+func (x *NodeSettings) GetBatchSize() int32 {
+	if x != nil && x.BatchSize != nil {
+		return *x.BatchSize
+	}
+	return 0
+}
+
+func (x *NodeSettings) GetSyncInterval() string {
+	if x != nil && x.SyncInterval != nil {
+		return *x.SyncInterval
+	}
+	return ""
+}
+
+func (x *NodeSettings) GetAliveInterval() string {
+	if x != nil && x.AliveInterval != nil {
+		return *x.AliveInterval
+	}
+	return ""
+}
+
+func (x *NodeSettings) GetRetentionDays() int32 {
+	if x != nil && x.RetentionDays != nil {
+		return *x.RetentionDays
+	}
+	return 0
+}
+
+type PendingCommand struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"` // UUID
+	Command       string                 `protobuf:"bytes,2,opt,name=command,proto3" json:"command,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PendingCommand) Reset() {
+	*x = PendingCommand{}
+	mi := &file_speedtest_v1_ingest_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PendingCommand) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PendingCommand) ProtoMessage() {}
+
+func (x *PendingCommand) ProtoReflect() protoreflect.Message {
+	mi := &file_speedtest_v1_ingest_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PendingCommand.ProtoReflect.Descriptor instead.
+func (*PendingCommand) Descriptor() ([]byte, []int) {
+	return file_speedtest_v1_ingest_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *PendingCommand) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *PendingCommand) GetCommand() string {
+	if x != nil {
+		return x.Command
+	}
+	return ""
+}
+
+type ReportCommandResultRequest struct {
+	state                protoimpl.MessageState `protogen:"open.v1"`
+	CommandId            string                 `protobuf:"bytes,1,opt,name=command_id,json=commandId,proto3" json:"command_id,omitempty"` // UUID
+	NodeId               string                 `protobuf:"bytes,2,opt,name=node_id,json=nodeId,proto3" json:"node_id,omitempty"`          // UUID
+	Status               string                 `protobuf:"bytes,3,opt,name=status,proto3" json:"status,omitempty"`                        // running, completed or failed
+	ErrorMessage         *string                `protobuf:"bytes,4,opt,name=error_message,json=errorMessage,proto3,oneof" json:"error_message,omitempty"`
+	MeasurementTimestamp *timestamppb.Timestamp `protobuf:"bytes,5,opt,name=measurement_timestamp,json=measurementTimestamp,proto3" json:"measurement_timestamp,omitempty"`
+	ClockOffsetMs        *int64                 `protobuf:"varint,6,opt,name=clock_offset_ms,json=clockOffsetMs,proto3,oneof" json:"clock_offset_ms,omitempty"` // Offset recorded with the measurement, see Measurement
+	unknownFields        protoimpl.UnknownFields
+	sizeCache            protoimpl.SizeCache
+}
+
+func (x *ReportCommandResultRequest) Reset() {
+	*x = ReportCommandResultRequest{}
+	mi := &file_speedtest_v1_ingest_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ReportCommandResultRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReportCommandResultRequest) ProtoMessage() {}
+
+func (x *ReportCommandResultRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_speedtest_v1_ingest_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReportCommandResultRequest.ProtoReflect.Descriptor instead.
+func (*ReportCommandResultRequest) Descriptor() ([]byte, []int) {
+	return file_speedtest_v1_ingest_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *ReportCommandResultRequest) GetCommandId() string {
+	if x != nil {
+		return x.CommandId
+	}
+	return ""
+}
+
+func (x *ReportCommandResultRequest) GetNodeId() string {
+	if x != nil {
+		return x.NodeId
+	}
+	return ""
+}
+
+func (x *ReportCommandResultRequest) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *ReportCommandResultRequest) GetErrorMessage() string {
+	if x != nil && x.ErrorMessage != nil {
+		return *x.ErrorMessage
+	}
+	return ""
+}
+
+func (x *ReportCommandResultRequest) GetMeasurementTimestamp() *timestamppb.Timestamp {
+	if x != nil {
+		return x.MeasurementTimestamp
+	}
+	return nil
+}
+
+func (x *ReportCommandResultRequest) GetClockOffsetMs() int64 {
+	if x != nil && x.ClockOffsetMs != nil {
+		return *x.ClockOffsetMs
+	}
+	return 0
+}
+
+type ReportCommandResultResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Status        string                 `protobuf:"bytes,1,opt,name=status,proto3" json:"status,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ReportCommandResultResponse) Reset() {
+	*x = ReportCommandResultResponse{}
+	mi := &file_speedtest_v1_ingest_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ReportCommandResultResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReportCommandResultResponse) ProtoMessage() {}
+
+func (x *ReportCommandResultResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_speedtest_v1_ingest_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReportCommandResultResponse.ProtoReflect.Descriptor instead.
+func (*ReportCommandResultResponse) Descriptor() ([]byte, []int) {
+	return file_speedtest_v1_ingest_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *ReportCommandResultResponse) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+type SubmitMeasurementsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	NodeId        string                 `protobuf:"bytes,1,opt,name=node_id,json=nodeId,proto3" json:"node_id,omitempty"` // UUID
+	NodeName      string                 `protobuf:"bytes,2,opt,name=node_name,json=nodeName,proto3" json:"node_name,omitempty"`
+	Measurements  []*Measurement         `protobuf:"bytes,3,rep,name=measurements,proto3" json:"measurements,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SubmitMeasurementsRequest) Reset() {
+	*x = SubmitMeasurementsRequest{}
+	mi := &file_speedtest_v1_ingest_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SubmitMeasurementsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SubmitMeasurementsRequest) ProtoMessage() {}
+
+func (x *SubmitMeasurementsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_speedtest_v1_ingest_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SubmitMeasurementsRequest.ProtoReflect.Descriptor instead.
+func (*SubmitMeasurementsRequest) Descriptor() ([]byte, []int) {
+	return file_speedtest_v1_ingest_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *SubmitMeasurementsRequest) GetNodeId() string {
+	if x != nil {
+		return x.NodeId
+	}
+	return ""
+}
+
+func (x *SubmitMeasurementsRequest) GetNodeName() string {
+	if x != nil {
+		return x.NodeName
+	}
+	return ""
+}
+
+func (x *SubmitMeasurementsRequest) GetMeasurements() []*Measurement {
+	if x != nil {
+		return x.Measurements
+	}
+	return nil
+}
+
+type SubmitMeasurementsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Status        string                 `protobuf:"bytes,1,opt,name=status,proto3" json:"status,omitempty"`
+	Received      int32                  `protobuf:"varint,2,opt,name=received,proto3" json:"received,omitempty"`
+	Inserted      int32                  `protobuf:"varint,3,opt,name=inserted,proto3" json:"inserted,omitempty"`
+	Updated       int32                  `protobuf:"varint,4,opt,name=updated,proto3" json:"updated,omitempty"`
+	Failed        int32                  `protobuf:"varint,5,opt,name=failed,proto3" json:"failed,omitempty"`
+	Rejected      int32                  `protobuf:"varint,6,opt,name=rejected,proto3" json:"rejected,omitempty"`        // Timestamps too far in the future, or implausible values
+	Quarantined   int32                  `protobuf:"varint,7,opt,name=quarantined,proto3" json:"quarantined,omitempty"`  // Implausible values held back for review
+	Deferred      []int64                `protobuf:"varint,8,rep,packed,name=deferred,proto3" json:"deferred,omitempty"` // Local IDs timestamped in the future; the node sends them again later
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SubmitMeasurementsResponse) Reset() {
+	*x = SubmitMeasurementsResponse{}
+	mi := &file_speedtest_v1_ingest_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SubmitMeasurementsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SubmitMeasurementsResponse) ProtoMessage() {}
+
+func (x *SubmitMeasurementsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_speedtest_v1_ingest_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SubmitMeasurementsResponse.ProtoReflect.Descriptor instead.
+func (*SubmitMeasurementsResponse) Descriptor() ([]byte, []int) {
+	return file_speedtest_v1_ingest_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *SubmitMeasurementsResponse) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *SubmitMeasurementsResponse) GetReceived() int32 {
+	if x != nil {
+		return x.Received
+	}
+	return 0
+}
+
+func (x *SubmitMeasurementsResponse) GetInserted() int32 {
+	if x != nil {
+		return x.Inserted
+	}
+	return 0
+}
+
+func (x *SubmitMeasurementsResponse) GetUpdated() int32 {
+	if x != nil {
+		return x.Updated
+	}
+	return 0
+}
+
+func (x *SubmitMeasurementsResponse) GetFailed() int32 {
+	if x != nil {
+		return x.Failed
+	}
+	return 0
+}
+
+func (x *SubmitMeasurementsResponse) GetRejected() int32 {
+	if x != nil {
+		return x.Rejected
+	}
+	return 0
+}
+
+func (x *SubmitMeasurementsResponse) GetQuarantined() int32 {
+	if x != nil {
+		return x.Quarantined
+	}
+	return 0
+}
+
+func (x *SubmitMeasurementsResponse) GetDeferred() []int64 {
+	if x != nil {
+		return x.Deferred
+	}
+	return nil
+}
+
+type SubmitFailedMeasurementsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	NodeId        string                 `protobuf:"bytes,1,opt,name=node_id,json=nodeId,proto3" json:"node_id,omitempty"` // UUID
+	NodeName      string                 `protobuf:"bytes,2,opt,name=node_name,json=nodeName,proto3" json:"node_name,omitempty"`
+	FailedTests   []*FailedTest          `protobuf:"bytes,3,rep,name=failed_tests,json=failedTests,proto3" json:"failed_tests,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SubmitFailedMeasurementsRequest) Reset() {
+	*x = SubmitFailedMeasurementsRequest{}
+	mi := &file_speedtest_v1_ingest_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SubmitFailedMeasurementsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SubmitFailedMeasurementsRequest) ProtoMessage() {}
+
+func (x *SubmitFailedMeasurementsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_speedtest_v1_ingest_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SubmitFailedMeasurementsRequest.ProtoReflect.Descriptor instead.
+func (*SubmitFailedMeasurementsRequest) Descriptor() ([]byte, []int) {
+	return file_speedtest_v1_ingest_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *SubmitFailedMeasurementsRequest) GetNodeId() string {
+	if x != nil {
+		return x.NodeId
+	}
+	return ""
+}
+
+func (x *SubmitFailedMeasurementsRequest) GetNodeName() string {
+	if x != nil {
+		return x.NodeName
+	}
+	return ""
+}
+
+func (x *SubmitFailedMeasurementsRequest) GetFailedTests() []*FailedTest {
+	if x != nil {
+		return x.FailedTests
+	}
+	return nil
+}
+
+type SubmitFailedMeasurementsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Status        string                 `protobuf:"bytes,1,opt,name=status,proto3" json:"status,omitempty"`
+	Received      int32                  `protobuf:"varint,2,opt,name=received,proto3" json:"received,omitempty"`
+	Rejected      int32                  `protobuf:"varint,3,opt,name=rejected,proto3" json:"rejected,omitempty"`        // Timestamps too far in the future
+	Deferred      []int64                `protobuf:"varint,4,rep,packed,name=deferred,proto3" json:"deferred,omitempty"` // Local IDs of rejected results to send again later
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SubmitFailedMeasurementsResponse) Reset() {
+	*x = SubmitFailedMeasurementsResponse{}
+	mi := &file_speedtest_v1_ingest_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SubmitFailedMeasurementsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SubmitFailedMeasurementsResponse) ProtoMessage() {}
+
+func (x *SubmitFailedMeasurementsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_speedtest_v1_ingest_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SubmitFailedMeasurementsResponse.ProtoReflect.Descriptor instead.
+func (*SubmitFailedMeasurementsResponse) Descriptor() ([]byte, []int) {
+	return file_speedtest_v1_ingest_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *SubmitFailedMeasurementsResponse) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *SubmitFailedMeasurementsResponse) GetReceived() int32 {
+	if x != nil {
+		return x.Received
+	}
+	return 0
+}
+
+func (x *SubmitFailedMeasurementsResponse) GetRejected() int32 {
+	if x != nil {
+		return x.Rejected
+	}
+	return 0
+}
+
+func (x *SubmitFailedMeasurementsResponse) GetDeferred() []int64 {
+	if x != nil {
+		return x.Deferred
+	}
+	return nil
+}
+
+// Measurement is a single speedtest result. Unset sub-messages and optional
+// fields are stored as NULL, matching omitted fields in the JSON API.
+type Measurement struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Timestamp     *timestamppb.Timestamp `protobuf:"bytes,1,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	Ping          *Ping                  `protobuf:"bytes,2,opt,name=ping,proto3" json:"ping,omitempty"`
+	Download      *Transfer              `protobuf:"bytes,3,opt,name=download,proto3" json:"download,omitempty"`
+	Upload        *Transfer              `protobuf:"bytes,4,opt,name=upload,proto3" json:"upload,omitempty"`
+	PacketLoss    *float64               `protobuf:"fixed64,5,opt,name=packet_loss,json=packetLoss,proto3,oneof" json:"packet_loss,omitempty"`
+	Isp           *string                `protobuf:"bytes,6,opt,name=isp,proto3,oneof" json:"isp,omitempty"`
+	Interface     *Interface             `protobuf:"bytes,7,opt,name=interface,proto3" json:"interface,omitempty"`
+	Server        *Server                `protobuf:"bytes,8,opt,name=server,proto3" json:"server,omitempty"`
+	Result        *Result                `protobuf:"bytes,9,opt,name=result,proto3" json:"result,omitempty"`
+	LocalId       *int64                 `protobuf:"varint,10,opt,name=local_id,json=localId,proto3,oneof" json:"local_id,omitempty"`                     // The node's ID for the result, echoed in deferred
+	ClockOffsetMs *int64                 `protobuf:"varint,11,opt,name=clock_offset_ms,json=clockOffsetMs,proto3,oneof" json:"clock_offset_ms,omitempty"` // server - node, as estimated by the node when the test ran
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Measurement) Reset() {
+	*x = Measurement{}
+	mi := &file_speedtest_v1_ingest_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Measurement) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Measurement) ProtoMessage() {}
+
+func (x *Measurement) ProtoReflect() protoreflect.Message {
+	mi := &file_speedtest_v1_ingest_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Measurement.ProtoReflect.Descriptor instead.
+func (*Measurement) Descriptor() ([]byte, []int) {
+	return file_speedtest_v1_ingest_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *Measurement) GetTimestamp() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Timestamp
+	}
+	return nil
+}
+
+func (x *Measurement) GetPing() *Ping {
+	if x != nil {
+		return x.Ping
+	}
+	return nil
+}
+
+func (x *Measurement) GetDownload() *Transfer {
+	if x != nil {
+		return x.Download
+	}
+	return nil
+}
+
+func (x *Measurement) GetUpload() *Transfer {
+	if x != nil {
+		return x.Upload
+	}
+	return nil
+}
+
+func (x *Measurement) GetPacketLoss() float64 {
+	if x != nil && x.PacketLoss != nil {
+		return *x.PacketLoss
+	}
+	return 0
+}
+
+func (x *Measurement) GetIsp() string {
+	if x != nil && x.Isp != nil {
+		return *x.Isp
+	}
+	return ""
+}
+
+func (x *Measurement) GetInterface() *Interface {
+	if x != nil {
+		return x.Interface
+	}
+	return nil
+}
+
+func (x *Measurement) GetServer() *Server {
+	if x != nil {
+		return x.Server
+	}
+	return nil
+}
+
+func (x *Measurement) GetResult() *Result {
+	if x != nil {
+		return x.Result
+	}
+	return nil
+}
+
+func (x *Measurement) GetLocalId() int64 {
+	if x != nil && x.LocalId != nil {
+		return *x.LocalId
+	}
+	return 0
+}
+
+func (x *Measurement) GetClockOffsetMs() int64 {
+	if x != nil && x.ClockOffsetMs != nil {
+		return *x.ClockOffsetMs
+	}
+	return 0
+}
+
+type Ping struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Jitter        float64                `protobuf:"fixed64,1,opt,name=jitter,proto3" json:"jitter,omitempty"`
+	Latency       float64                `protobuf:"fixed64,2,opt,name=latency,proto3" json:"latency,omitempty"`
+	Low           float64                `protobuf:"fixed64,3,opt,name=low,proto3" json:"low,omitempty"`
+	High          float64                `protobuf:"fixed64,4,opt,name=high,proto3" json:"high,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Ping) Reset() {
+	*x = Ping{}
+	mi := &file_speedtest_v1_ingest_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Ping) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Ping) ProtoMessage() {}
+
+func (x *Ping) ProtoReflect() protoreflect.Message {
+	mi := &file_speedtest_v1_ingest_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Ping.ProtoReflect.Descriptor instead.
+func (*Ping) Descriptor() ([]byte, []int) {
+	return file_speedtest_v1_ingest_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *Ping) GetJitter() float64 {
+	if x != nil {
+		return x.Jitter
+	}
+	return 0
+}
+
+func (x *Ping) GetLatency() float64 {
+	if x != nil {
+		return x.Latency
+	}
+	return 0
+}
+
+func (x *Ping) GetLow() float64 {
+	if x != nil {
+		return x.Low
+	}
+	return 0
+}
+
+func (x *Ping) GetHigh() float64 {
+	if x != nil {
+		return x.High
+	}
+	return 0
+}
+
+type Transfer struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Bandwidth     int64                  `protobuf:"varint,1,opt,name=bandwidth,proto3" json:"bandwidth,omitempty"` // bytes per second
+	Bytes         int64                  `protobuf:"varint,2,opt,name=bytes,proto3" json:"bytes,omitempty"`
+	Elapsed       int32                  `protobuf:"varint,3,opt,name=elapsed,proto3" json:"elapsed,omitempty"` // milliseconds
+	Latency       *Latency               `protobuf:"bytes,4,opt,name=latency,proto3" json:"latency,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Transfer) Reset() {
+	*x = Transfer{}
+	mi := &file_speedtest_v1_ingest_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Transfer) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Transfer) ProtoMessage() {}
+
+func (x *Transfer) ProtoReflect() protoreflect.Message {
+	mi := &file_speedtest_v1_ingest_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Transfer.ProtoReflect.Descriptor instead.
+func (*Transfer) Descriptor() ([]byte, []int) {
+	return file_speedtest_v1_ingest_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *Transfer) GetBandwidth() int64 {
+	if x != nil {
+		return x.Bandwidth
+	}
+	return 0
+}
+
+func (x *Transfer) GetBytes() int64 {
+	if x != nil {
+		return x.Bytes
+	}
+	return 0
+}
+
+func (x *Transfer) GetElapsed() int32 {
+	if x != nil {
+		return x.Elapsed
+	}
+	return 0
+}
+
+func (x *Transfer) GetLatency() *Latency {
+	if x != nil {
+		return x.Latency
+	}
+	return nil
+}
+
+type Latency struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Iqm           float64                `protobuf:"fixed64,1,opt,name=iqm,proto3" json:"iqm,omitempty"`
+	Low           float64                `protobuf:"fixed64,2,opt,name=low,proto3" json:"low,omitempty"`
+	High          float64                `protobuf:"fixed64,3,opt,name=high,proto3" json:"high,omitempty"`
+	Jitter        float64                `protobuf:"fixed64,4,opt,name=jitter,proto3" json:"jitter,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Latency) Reset() {
+	*x = Latency{}
+	mi := &file_speedtest_v1_ingest_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Latency) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Latency) ProtoMessage() {}
+
+func (x *Latency) ProtoReflect() protoreflect.Message {
+	mi := &file_speedtest_v1_ingest_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Latency.ProtoReflect.Descriptor instead.
+func (*Latency) Descriptor() ([]byte, []int) {
+	return file_speedtest_v1_ingest_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *Latency) GetIqm() float64 {
+	if x != nil {
+		return x.Iqm
+	}
+	return 0
+}
+
+func (x *Latency) GetLow() float64 {
+	if x != nil {
+		return x.Low
+	}
+	return 0
+}
+
+func (x *Latency) GetHigh() float64 {
+	if x != nil {
+		return x.High
+	}
+	return 0
+}
+
+func (x *Latency) GetJitter() float64 {
+	if x != nil {
+		return x.Jitter
+	}
+	return 0
+}
+
+type Interface struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	InternalIp    string                 `protobuf:"bytes,1,opt,name=internal_ip,json=internalIp,proto3" json:"internal_ip,omitempty"`
+	Name          string                 `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	MacAddr       string                 `protobuf:"bytes,3,opt,name=mac_addr,json=macAddr,proto3" json:"mac_addr,omitempty"`
+	IsVpn         bool                   `protobuf:"varint,4,opt,name=is_vpn,json=isVpn,proto3" json:"is_vpn,omitempty"`
+	ExternalIp    string                 `protobuf:"bytes,5,opt,name=external_ip,json=externalIp,proto3" json:"external_ip,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Interface) Reset() {
+	*x = Interface{}
+	mi := &file_speedtest_v1_ingest_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Interface) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Interface) ProtoMessage() {}
+
+func (x *Interface) ProtoReflect() protoreflect.Message {
+	mi := &file_speedtest_v1_ingest_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Interface.ProtoReflect.Descriptor instead.
+func (*Interface) Descriptor() ([]byte, []int) {
+	return file_speedtest_v1_ingest_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *Interface) GetInternalIp() string {
+	if x != nil {
+		return x.InternalIp
+	}
+	return ""
+}
+
+func (x *Interface) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Interface) GetMacAddr() string {
+	if x != nil {
+		return x.MacAddr
+	}
+	return ""
+}
+
+func (x *Interface) GetIsVpn() bool {
+	if x != nil {
+		return x.IsVpn
+	}
+	return false
+}
+
+func (x *Interface) GetExternalIp() string {
+	if x != nil {
+		return x.ExternalIp
+	}
+	return ""
+}
+
+type Server struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            int32                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	Host          string                 `protobuf:"bytes,2,opt,name=host,proto3" json:"host,omitempty"`
+	Port          int32                  `protobuf:"varint,3,opt,name=port,proto3" json:"port,omitempty"`
+	Name          string                 `protobuf:"bytes,4,opt,name=name,proto3" json:"name,omitempty"`
+	Location      string                 `protobuf:"bytes,5,opt,name=location,proto3" json:"location,omitempty"`
+	Country       string                 `protobuf:"bytes,6,opt,name=country,proto3" json:"country,omitempty"`
+	Ip            string                 `protobuf:"bytes,7,opt,name=ip,proto3" json:"ip,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Server) Reset() {
+	*x = Server{}
+	mi := &file_speedtest_v1_ingest_proto_msgTypes[16]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Server) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Server) ProtoMessage() {}
+
+func (x *Server) ProtoReflect() protoreflect.Message {
+	mi := &file_speedtest_v1_ingest_proto_msgTypes[16]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Server.ProtoReflect.Descriptor instead.
+func (*Server) Descriptor() ([]byte, []int) {
+	return file_speedtest_v1_ingest_proto_rawDescGZIP(), []int{16}
+}
+
+func (x *Server) GetId() int32 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *Server) GetHost() string {
+	if x != nil {
+		return x.Host
+	}
+	return ""
+}
+
+func (x *Server) GetPort() int32 {
+	if x != nil {
+		return x.Port
+	}
+	return 0
+}
+
+func (x *Server) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Server) GetLocation() string {
+	if x != nil {
+		return x.Location
+	}
+	return ""
+}
+
+func (x *Server) GetCountry() string {
+	if x != nil {
+		return x.Country
+	}
+	return ""
+}
+
+func (x *Server) GetIp() string {
+	if x != nil {
+		return x.Ip
+	}
+	return ""
+}
+
+type Result struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Url           string                 `protobuf:"bytes,2,opt,name=url,proto3" json:"url,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Result) Reset() {
+	*x = Result{}
+	mi := &file_speedtest_v1_ingest_proto_msgTypes[17]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Result) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Result) ProtoMessage() {}
+
+func (x *Result) ProtoReflect() protoreflect.Message {
+	mi := &file_speedtest_v1_ingest_proto_msgTypes[17]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Result.ProtoReflect.Descriptor instead.
+func (*Result) Descriptor() ([]byte, []int) {
+	return file_speedtest_v1_ingest_proto_rawDescGZIP(), []int{17}
+}
+
+func (x *Result) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Result) GetUrl() string {
+	if x != nil {
+		return x.Url
+	}
+	return ""
+}
+
+type FailedTest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Timestamp     *timestamppb.Timestamp `protobuf:"bytes,1,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	ErrorMessage  string                 `protobuf:"bytes,2,opt,name=error_message,json=errorMessage,proto3" json:"error_message,omitempty"`
+	RetryCount    int32                  `protobuf:"varint,3,opt,name=retry_count,json=retryCount,proto3" json:"retry_count,omitempty"`
+	LocalId       *int64                 `protobuf:"varint,4,opt,name=local_id,json=localId,proto3,oneof" json:"local_id,omitempty"` // See Measurement
+	ClockOffsetMs *int64                 `protobuf:"varint,5,opt,name=clock_offset_ms,json=clockOffsetMs,proto3,oneof" json:"clock_offset_ms,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FailedTest) Reset() {
+	*x = FailedTest{}
+	mi := &file_speedtest_v1_ingest_proto_msgTypes[18]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FailedTest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FailedTest) ProtoMessage() {}
+
+func (x *FailedTest) ProtoReflect() protoreflect.Message {
+	mi := &file_speedtest_v1_ingest_proto_msgTypes[18]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FailedTest.ProtoReflect.Descriptor instead.
+func (*FailedTest) Descriptor() ([]byte, []int) {
+	return file_speedtest_v1_ingest_proto_rawDescGZIP(), []int{18}
+}
+
+func (x *FailedTest) GetTimestamp() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Timestamp
+	}
+	return nil
+}
+
+func (x *FailedTest) GetErrorMessage() string {
+	if x != nil {
+		return x.ErrorMessage
+	}
+	return ""
+}
+
+func (x *FailedTest) GetRetryCount() int32 {
+	if x != nil {
+		return x.RetryCount
+	}
+	return 0
+}
+
+func (x *FailedTest) GetLocalId() int64 {
+	if x != nil && x.LocalId != nil {
+		return *x.LocalId
+	}
+	return 0
+}
+
+func (x *FailedTest) GetClockOffsetMs() int64 {
+	if x != nil && x.ClockOffsetMs != nil {
+		return *x.ClockOffsetMs
+	}
+	return 0
+}
+
+var File_speedtest_v1_ingest_proto protoreflect.FileDescriptor
+
+const file_speedtest_v1_ingest_proto_rawDesc = "" +
+	"\n" +
+	"\x19speedtest/v1/ingest.proto\x12\fspeedtest.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"\xe7\x02\n" +
+	"\fAliveRequest\x12\x17\n" +
+	"\anode_id\x18\x01 \x01(\tR\x06nodeId\x12\x1b\n" +
+	"\tnode_name\x18\x02 \x01(\tR\bnodeName\x12\x1f\n" +
+	"\blocation\x18\x03 \x01(\tH\x00R\blocation\x88\x01\x01\x128\n" +
+	"\ttimestamp\x18\x04 \x01(\v2\x1a.google.protobuf.TimestampR\ttimestamp\x12*\n" +
+	"\x0econfig_version\x18\x05 \x01(\tH\x01R\rconfigVersion\x88\x01\x01\x129\n" +
+	"\tinventory\x18\x06 \x01(\v2\x1b.speedtest.v1.NodeInventoryR\tinventory\x12+\n" +
+	"\x0fclock_offset_ms\x18\a \x01(\x03H\x02R\rclockOffsetMs\x88\x01\x01B\v\n" +
+	"\t_locationB\x11\n" +
+	"\x0f_config_versionB\x12\n" +
+	"\x10_clock_offset_ms\"\x89\x03\n" +
+	"\rNodeInventory\x12\x18\n" +
+	"\aversion\x18\x01 \x01(\tR\aversion\x12\x1a\n" +
+	"\bbackends\x18\x02 \x03(\tR\bbackends\x12\x0e\n" +
+	"\x02os\x18\x03 \x01(\tR\x02os\x12\x16\n" +
+	"\x06kernel\x18\x04 \x01(\tR\x06kernel\x12\x12\n" +
+	"\x04arch\x18\x05 \x01(\tR\x04arch\x12%\n" +
+	"\x0euptime_seconds\x18\x06 \x01(\x03R\ruptimeSeconds\x12\"\n" +
+	"\rdb_size_bytes\x18\a \x01(\x03R\vdbSizeBytes\x12/\n" +
+	"\x13unsent_measurements\x18\b \x01(\x03R\x12unsentMeasurements\x12<\n" +
+	"\x1aunsent_failed_measurements\x18\t \x01(\x03R\x18unsentFailedMeasurements\x12L\n" +
+	"\x14last_successful_test\x18\n" +
+	" \x01(\v2\x1a.google.protobuf.TimestampR\x12lastSuccessfulTest\"\xb8\x03\n" +
+	"\rAliveResponse\x12\x16\n" +
+	"\x06status\x18\x01 \x01(\tR\x06status\x12;\n" +
+	"\vserver_time\x18\x02 \x01(\v2\x1a.google.protobuf.TimestampR\n" +
+	"serverTime\x12'\n" +
+	"\x0fnode_registered\x18\x03 \x01(\bR\x0enodeRegistered\x128\n" +
+	"\bcommands\x18\x04 \x03(\v2\x1c.speedtest.v1.PendingCommandR\bcommands\x12*\n" +
+	"\x0econfig_version\x18\x05 \x01(\tH\x00R\rconfigVersion\x88\x01\x01\x122\n" +
+	"\x06config\x18\x06 \x01(\v2\x1a.speedtest.v1.NodeSettingsR\x06config\x12=\n" +
+	"\frequest_time\x18\a \x01(\v2\x1a.google.protobuf.TimestampR\vrequestTime\x12=\n" +
+	"\freceive_time\x18\b \x01(\v2\x1a.google.protobuf.TimestampR\vreceiveTimeB\x11\n" +
+	"\x0f_config_version\"\xc6\x03\n" +
+	"\fNodeSettings\x12*\n" +
+	"\x0espeedtest_cron\x18\x01 \x01(\tH\x00R\rspeedtestCron\x88\x01\x01\x120\n" +
+	"\x11speedtest_timeout\x18\x02 \x01(\tH\x01R\x10speedtestTimeout\x88\x01\x01\x12-\n" +
+	"\x10retry_on_failure\x18\x03 \x01(\bH\x02R\x0eretryOnFailure\x88\x01\x01\x12\"\n" +
+	"\n" +
+	"batch_size\x18\x04 \x01(\x05H\x03R\tbatchSize\x88\x01\x01\x12(\n" +
+	"\rsync_interval\x18\x05 \x01(\tH\x04R\fsyncInterval\x88\x01\x01\x12*\n" +
+	"\x0ealive_interval\x18\x06 \x01(\tH\x05R\raliveInterval\x88\x01\x01\x12*\n" +
+	"\x0eretention_days\x18\a \x01(\x05H\x06R\rretentionDays\x88\x01\x01B\x11\n" +
+	"\x0f_speedtest_cronB\x14\n" +
+	"\x12_speedtest_timeoutB\x13\n" +
+	"\x11_retry_on_failureB\r\n" +
+	"\v_batch_sizeB\x10\n" +
+	"\x0e_sync_intervalB\x11\n" +
+	"\x0f_alive_intervalB\x11\n" +
+	"\x0f_retention_days\":\n" +
+	"\x0ePendingCommand\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x18\n" +
+	"\acommand\x18\x02 \x01(\tR\acommand\"\xba\x02\n" +
+	"\x1aReportCommandResultRequest\x12\x1d\n" +
+	"\n" +
+	"command_id\x18\x01 \x01(\tR\tcommandId\x12\x17\n" +
+	"\anode_id\x18\x02 \x01(\tR\x06nodeId\x12\x16\n" +
+	"\x06status\x18\x03 \x01(\tR\x06status\x12(\n" +
+	"\rerror_message\x18\x04 \x01(\tH\x00R\ferrorMessage\x88\x01\x01\x12O\n" +
+	"\x15measurement_timestamp\x18\x05 \x01(\v2\x1a.google.protobuf.TimestampR\x14measurementTimestamp\x12+\n" +
+	"\x0fclock_offset_ms\x18\x06 \x01(\x03H\x01R\rclockOffsetMs\x88\x01\x01B\x10\n" +
+	"\x0e_error_messageB\x12\n" +
+	"\x10_clock_offset_ms\"5\n" +
+	"\x1bReportCommandResultResponse\x12\x16\n" +
+	"\x06status\x18\x01 \x01(\tR\x06status\"\x90\x01\n" +
+	"\x19SubmitMeasurementsRequest\x12\x17\n" +
+	"\anode_id\x18\x01 \x01(\tR\x06nodeId\x12\x1b\n" +
+	"\tnode_name\x18\x02 \x01(\tR\bnodeName\x12=\n" +
+	"\fmeasurements\x18\x03 \x03(\v2\x19.speedtest.v1.MeasurementR\fmeasurements\"\xf8\x01\n" +
+	"\x1aSubmitMeasurementsResponse\x12\x16\n" +
+	"\x06status\x18\x01 \x01(\tR\x06status\x12\x1a\n" +
+	"\breceived\x18\x02 \x01(\x05R\breceived\x12\x1a\n" +
+	"\binserted\x18\x03 \x01(\x05R\binserted\x12\x18\n" +
+	"\aupdated\x18\x04 \x01(\x05R\aupdated\x12\x16\n" +
+	"\x06failed\x18\x05 \x01(\x05R\x06failed\x12\x1a\n" +
+	"\brejected\x18\x06 \x01(\x05R\brejected\x12 \n" +
+	"\vquarantined\x18\a \x01(\x05R\vquarantined\x12\x1a\n" +
+	"\bdeferred\x18\b \x03(\x03R\bdeferred\"\x94\x01\n" +
+	"\x1fSubmitFailedMeasurementsRequest\x12\x17\n" +
+	"\anode_id\x18\x01 \x01(\tR\x06nodeId\x12\x1b\n" +
+	"\tnode_name\x18\x02 \x01(\tR\bnodeName\x12;\n" +
+	"\ffailed_tests\x18\x03 \x03(\v2\x18.speedtest.v1.FailedTestR\vfailedTests\"\x8e\x01\n" +
+	" SubmitFailedMeasurementsResponse\x12\x16\n" +
+	"\x06status\x18\x01 \x01(\tR\x06status\x12\x1a\n" +
+	"\breceived\x18\x02 \x01(\x05R\breceived\x12\x1a\n" +
+	"\brejected\x18\x03 \x01(\x05R\brejected\x12\x1a\n" +
+	"\bdeferred\x18\x04 \x03(\x03R\bdeferred\"\xa9\x04\n" +
+	"\vMeasurement\x128\n" +
+	"\ttimestamp\x18\x01 \x01(\v2\x1a.google.protobuf.TimestampR\ttimestamp\x12&\n" +
+	"\x04ping\x18\x02 \x01(\v2\x12.speedtest.v1.PingR\x04ping\x122\n" +
+	"\bdownload\x18\x03 \x01(\v2\x16.speedtest.v1.TransferR\bdownload\x12.\n" +
+	"\x06upload\x18\x04 \x01(\v2\x16.speedtest.v1.TransferR\x06upload\x12$\n" +
+	"\vpacket_loss\x18\x05 \x01(\x01H\x00R\n" +
+	"packetLoss\x88\x01\x01\x12\x15\n" +
+	"\x03isp\x18\x06 \x01(\tH\x01R\x03isp\x88\x01\x01\x125\n" +
+	"\tinterface\x18\a \x01(\v2\x17.speedtest.v1.InterfaceR\tinterface\x12,\n" +
+	"\x06server\x18\b \x01(\v2\x14.speedtest.v1.ServerR\x06server\x12,\n" +
+	"\x06result\x18\t \x01(\v2\x14.speedtest.v1.ResultR\x06result\x12\x1e\n" +
+	"\blocal_id\x18\n" +
+	" \x01(\x03H\x02R\alocalId\x88\x01\x01\x12+\n" +
+	"\x0fclock_offset_ms\x18\v \x01(\x03H\x03R\rclockOffsetMs\x88\x01\x01B\x0e\n" +
+	"\f_packet_lossB\x06\n" +
+	"\x04_ispB\v\n" +
+	"\t_local_idB\x12\n" +
+	"\x10_clock_offset_ms\"^\n" +
+	"\x04Ping\x12\x16\n" +
+	"\x06jitter\x18\x01 \x01(\x01R\x06jitter\x12\x18\n" +
+	"\alatency\x18\x02 \x01(\x01R\alatency\x12\x10\n" +
+	"\x03low\x18\x03 \x01(\x01R\x03low\x12\x12\n" +
+	"\x04high\x18\x04 \x01(\x01R\x04high\"\x89\x01\n" +
+	"\bTransfer\x12\x1c\n" +
+	"\tbandwidth\x18\x01 \x01(\x03R\tbandwidth\x12\x14\n" +
+	"\x05bytes\x18\x02 \x01(\x03R\x05bytes\x12\x18\n" +
+	"\aelapsed\x18\x03 \x01(\x05R\aelapsed\x12/\n" +
+	"\alatency\x18\x04 \x01(\v2\x15.speedtest.v1.LatencyR\alatency\"Y\n" +
+	"\aLatency\x12\x10\n" +
+	"\x03iqm\x18\x01 \x01(\x01R\x03iqm\x12\x10\n" +
+	"\x03low\x18\x02 \x01(\x01R\x03low\x12\x12\n" +
+	"\x04high\x18\x03 \x01(\x01R\x04high\x12\x16\n" +
+	"\x06jitter\x18\x04 \x01(\x01R\x06jitter\"\x93\x01\n" +
+	"\tInterface\x12\x1f\n" +
+	"\vinternal_ip\x18\x01 \x01(\tR\n" +
+	"internalIp\x12\x12\n" +
+	"\x04name\x18\x02 \x01(\tR\x04name\x12\x19\n" +
+	"\bmac_addr\x18\x03 \x01(\tR\amacAddr\x12\x15\n" +
+	"\x06is_vpn\x18\x04 \x01(\bR\x05isVpn\x12\x1f\n" +
+	"\vexternal_ip\x18\x05 \x01(\tR\n" +
+	"externalIp\"\x9a\x01\n" +
+	"\x06Server\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x05R\x02id\x12\x12\n" +
+	"\x04host\x18\x02 \x01(\tR\x04host\x12\x12\n" +
+	"\x04port\x18\x03 \x01(\x05R\x04port\x12\x12\n" +
+	"\x04name\x18\x04 \x01(\tR\x04name\x12\x1a\n" +
+	"\blocation\x18\x05 \x01(\tR\blocation\x12\x18\n" +
+	"\acountry\x18\x06 \x01(\tR\acountry\x12\x0e\n" +
+	"\x02ip\x18\a \x01(\tR\x02ip\"*\n" +
+	"\x06Result\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x10\n" +
+	"\x03url\x18\x02 \x01(\tR\x03url\"\xfa\x01\n" +
+	"\n" +
+	"FailedTest\x128\n" +
+	"\ttimestamp\x18\x01 \x01(\v2\x1a.google.protobuf.TimestampR\ttimestamp\x12#\n" +
+	"\rerror_message\x18\x02 \x01(\tR\ferrorMessage\x12\x1f\n" +
+	"\vretry_count\x18\x03 \x01(\x05R\n" +
+	"retryCount\x12\x1e\n" +
+	"\blocal_id\x18\x04 \x01(\x03H\x00R\alocalId\x88\x01\x01\x12+\n" +
+	"\x0fclock_offset_ms\x18\x05 \x01(\x03H\x01R\rclockOffsetMs\x88\x01\x01B\v\n" +
+	"\t_local_idB\x12\n" +
+	"\x10_clock_offset_ms2\xa1\x03\n" +
+	"\rIngestService\x12@\n" +
+	"\x05Alive\x12\x1a.speedtest.v1.AliveRequest\x1a\x1b.speedtest.v1.AliveResponse\x12g\n" +
+	"\x12SubmitMeasurements\x12'.speedtest.v1.SubmitMeasurementsRequest\x1a(.speedtest.v1.SubmitMeasurementsResponse\x12y\n" +
+	"\x18SubmitFailedMeasurements\x12-.speedtest.v1.SubmitFailedMeasurementsRequest\x1a..speedtest.v1.SubmitFailedMeasurementsResponse\x12j\n" +
+	"\x13ReportCommandResult\x12(.speedtest.v1.ReportCommandResultRequest\x1a).speedtest.v1.ReportCommandResultResponseb\x06proto3"
+
+var (
+	file_speedtest_v1_ingest_proto_rawDescOnce sync.Once
+	file_speedtest_v1_ingest_proto_rawDescData []byte
+)
+
+func file_speedtest_v1_ingest_proto_rawDescGZIP() []byte {
+	file_speedtest_v1_ingest_proto_rawDescOnce.Do(func() {
+		file_speedtest_v1_ingest_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_speedtest_v1_ingest_proto_rawDesc), len(file_speedtest_v1_ingest_proto_rawDesc)))
+	})
+	return file_speedtest_v1_ingest_proto_rawDescData
+}
+
+var file_speedtest_v1_ingest_proto_msgTypes = make([]protoimpl.MessageInfo, 19)
+var file_speedtest_v1_ingest_proto_goTypes = []any{
+	(*AliveRequest)(nil),                     // 0: speedtest.v1.AliveRequest
+	(*NodeInventory)(nil),                    // 1: speedtest.v1.NodeInventory
+	(*AliveResponse)(nil),                    // 2: speedtest.v1.AliveResponse
+	(*NodeSettings)(nil),                     // 3: speedtest.v1.NodeSettings
+	(*PendingCommand)(nil),                   // 4: speedtest.v1.PendingCommand
+	(*ReportCommandResultRequest)(nil),       // 5: speedtest.v1.ReportCommandResultRequest
+	(*ReportCommandResultResponse)(nil),      // 6: speedtest.v1.ReportCommandResultResponse
+	(*SubmitMeasurementsRequest)(nil),        // 7: speedtest.v1.SubmitMeasurementsRequest
+	(*SubmitMeasurementsResponse)(nil),       // 8: speedtest.v1.SubmitMeasurementsResponse
+	(*SubmitFailedMeasurementsRequest)(nil),  // 9: speedtest.v1.SubmitFailedMeasurementsRequest
+	(*SubmitFailedMeasurementsResponse)(nil), // 10: speedtest.v1.SubmitFailedMeasurementsResponse
+	(*Measurement)(nil),                      // 11: speedtest.v1.Measurement
+	(*Ping)(nil),                             // 12: speedtest.v1.Ping
+	(*Transfer)(nil),                         // 13: speedtest.v1.Transfer
+	(*Latency)(nil),                          // 14: speedtest.v1.Latency
+	(*Interface)(nil),                        // 15: speedtest.v1.Interface
+	(*Server)(nil),                           // 16: speedtest.v1.Server
+	(*Result)(nil),                           // 17: speedtest.v1.Result
+	(*FailedTest)(nil),                       // 18: speedtest.v1.FailedTest
+	(*timestamppb.Timestamp)(nil),            // 19: google.protobuf.Timestamp
+}
+var file_speedtest_v1_ingest_proto_depIdxs = []int32{
+	19, // 0: speedtest.v1.AliveRequest.timestamp:type_name -> google.protobuf.Timestamp
+	1,  // 1: speedtest.v1.AliveRequest.inventory:type_name -> speedtest.v1.NodeInventory
+	19, // 2: speedtest.v1.NodeInventory.last_successful_test:type_name -> google.protobuf.Timestamp
+	19, // 3: speedtest.v1.AliveResponse.server_time:type_name -> google.protobuf.Timestamp
+	4,  // 4: speedtest.v1.AliveResponse.commands:type_name -> speedtest.v1.PendingCommand
+	3,  // 5: speedtest.v1.AliveResponse.config:type_name -> speedtest.v1.NodeSettings
+	19, // 6: speedtest.v1.AliveResponse.request_time:type_name -> google.protobuf.Timestamp
+	19, // 7: speedtest.v1.AliveResponse.receive_time:type_name -> google.protobuf.Timestamp
+	19, // 8: speedtest.v1.ReportCommandResultRequest.measurement_timestamp:type_name -> google.protobuf.Timestamp
+	11, // 9: speedtest.v1.SubmitMeasurementsRequest.measurements:type_name -> speedtest.v1.Measurement
+	18, // 10: speedtest.v1.SubmitFailedMeasurementsRequest.failed_tests:type_name -> speedtest.v1.FailedTest
+	19, // 11: speedtest.v1.Measurement.timestamp:type_name -> google.protobuf.Timestamp
+	12, // 12: speedtest.v1.Measurement.ping:type_name -> speedtest.v1.Ping
+	13, // 13: speedtest.v1.Measurement.download:type_name -> speedtest.v1.Transfer
+	13, // 14: speedtest.v1.Measurement.upload:type_name -> speedtest.v1.Transfer
+	15, // 15: speedtest.v1.Measurement.interface:type_name -> speedtest.v1.Interface
+	16, // 16: speedtest.v1.Measurement.server:type_name -> speedtest.v1.Server
+	17, // 17: speedtest.v1.Measurement.result:type_name -> speedtest.v1.Result
+	14, // 18: speedtest.v1.Transfer.latency:type_name -> speedtest.v1.Latency
+	19, // 19: speedtest.v1.FailedTest.timestamp:type_name -> google.protobuf.Timestamp
+	0,  // 20: speedtest.v1.IngestService.Alive:input_type -> speedtest.v1.AliveRequest
+	7,  // 21: speedtest.v1.IngestService.SubmitMeasurements:input_type -> speedtest.v1.SubmitMeasurementsRequest
+	9,  // 22: speedtest.v1.IngestService.SubmitFailedMeasurements:input_type -> speedtest.v1.SubmitFailedMeasurementsRequest
+	5,  // 23: speedtest.v1.IngestService.ReportCommandResult:input_type -> speedtest.v1.ReportCommandResultRequest
+	2,  // 24: speedtest.v1.IngestService.Alive:output_type -> speedtest.v1.AliveResponse
+	8,  // 25: speedtest.v1.IngestService.SubmitMeasurements:output_type -> speedtest.v1.SubmitMeasurementsResponse
+	10, // 26: speedtest.v1.IngestService.SubmitFailedMeasurements:output_type -> speedtest.v1.SubmitFailedMeasurementsResponse
+	6,  // 27: speedtest.v1.IngestService.ReportCommandResult:output_type -> speedtest.v1.ReportCommandResultResponse
+	24, // [24:28] is the sub-list for method output_type
+	20, // [20:24] is the sub-list for method input_type
+	20, // [20:20] is the sub-list for extension type_name
+	20, // [20:20] is the sub-list for extension extendee
+	0,  // [0:20] is the sub-list for field type_name
+}
+
+func init() { file_speedtest_v1_ingest_proto_init() }
+func file_speedtest_v1_ingest_proto_init() {
+	if File_speedtest_v1_ingest_proto != nil {
+		return
+	}
+	file_speedtest_v1_ingest_proto_msgTypes[0].OneofWrappers = []any{}
+	file_speedtest_v1_ingest_proto_msgTypes[2].OneofWrappers = []any{}
+	file_speedtest_v1_ingest_proto_msgTypes[3].OneofWrappers = []any{}
+	file_speedtest_v1_ingest_proto_msgTypes[5].OneofWrappers = []any{}
+	file_speedtest_v1_ingest_proto_msgTypes[11].OneofWrappers = []any{}
+	file_speedtest_v1_ingest_proto_msgTypes[18].OneofWrappers = []any{}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_speedtest_v1_ingest_proto_rawDesc), len(file_speedtest_v1_ingest_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   19,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_speedtest_v1_ingest_proto_goTypes,
+		DependencyIndexes: file_speedtest_v1_ingest_proto_depIdxs,
+		MessageInfos:      file_speedtest_v1_ingest_proto_msgTypes,
+	}.Build()
+	File_speedtest_v1_ingest_proto = out.File
+	file_speedtest_v1_ingest_proto_goTypes = nil
+	file_speedtest_v1_ingest_proto_depIdxs = nil
+}